@@ -7,14 +7,6 @@ package usb
 void RunLoopRunWithTimeout(double seconds) {
     CFRunLoopRunInMode(kCFRunLoopDefaultMode, seconds, true);
 }
-
-void AddSourceToRunLoop(CFRunLoopSourceRef source) {
-    CFRunLoopAddSource(CFRunLoopGetCurrent(), source, kCFRunLoopDefaultMode);
-}
-
-void RemoveSourceFromRunLoop(CFRunLoopSourceRef source) {
-    CFRunLoopRemoveSource(CFRunLoopGetCurrent(), source, kCFRunLoopDefaultMode);
-}
 */
 import "C"
 
@@ -56,33 +48,27 @@ func (t *AsyncTransfer) Submit() error {
 		return fmt.Errorf("transfer already submitted")
 	}
 
-	if t.handle.closed {
-		return fmt.Errorf("device is closed")
-	}
+	h := t.handle
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	// Find the interface for this endpoint
-	var intf *IOUSBInterfaceInterface
-	for _, i := range t.handle.interfaces {
-		intf = i
-		break
+	if h.closed {
+		return fmt.Errorf("device is closed")
 	}
 
-	if intf == nil {
-		return fmt.Errorf("no interface claimed for endpoint %02x", t.endpoint)
+	intf, pipeRef, err := h.findPipe(t.endpoint)
+	if err != nil {
+		return err
 	}
-
-	// Create async event source if needed
-	if t.handle.asyncSource == 0 {
-		source, err := intf.CreateAsyncEventSource()
-		if err != nil {
-			return err
-		}
-		t.handle.asyncSource = source
-		C.AddSourceToRunLoop(source)
+	if err := h.addAsyncSource(h.pipes[t.endpoint].iface, intf); err != nil {
+		return err
 	}
 
-	// Submit the async transfer
+	// Submit the async transfer. Close waits for the completion of every
+	// transfer in flight before it stops the run loop.
+	async := h.async
 	callback := func(result int32, bytesTransferred uint32) {
+		defer async.inFlight.Done()
 		t.mutex.Lock()
 		defer t.mutex.Unlock()
 
@@ -101,9 +87,7 @@ func (t *AsyncTransfer) Submit() error {
 		}
 	}
 
-	var err error
-	pipeRef := t.endpoint & 0x0F
-
+	async.inFlight.Add(1)
 	if t.endpoint&0x80 != 0 {
 		// IN transfer
 		err = intf.BulkTransferInAsync(pipeRef, t.buffer, callback)
@@ -113,6 +97,7 @@ func (t *AsyncTransfer) Submit() error {
 	}
 
 	if err != nil {
+		async.inFlight.Done()
 		return err
 	}
 
@@ -185,7 +170,9 @@ func (h *DeviceHandle) AsyncInterruptTransfer(endpoint uint8, data []byte, callb
 	return transfer.Submit()
 }
 
-// HandleEvents processes pending USB events
+// HandleEvents runs the calling thread's run loop for up to timeout. Async
+// transfers no longer need it: every handle runs its own run loop for their
+// completions from the first Submit until Close.
 func HandleEvents(timeout time.Duration) error {
 	// Run the CFRunLoop to process async events
 	seconds := timeout.Seconds()
@@ -209,8 +196,25 @@ func RunEventLoop(stop <-chan struct{}) {
 	}
 }
 
-// Note: A full implementation would require:
-// 1. Integration with CFRunLoop for proper async event handling
-// 2. Use of IOUSBInterfaceInterface's async methods (ReadPipeAsync, WritePipeAsync)
-// 3. Proper callback registration with IOKit
-// 4. Thread-safe transfer queue management
+// SubmitControl performs a control transfer without blocking the caller.
+// The transfer runs on its own goroutine, bounded by the handle's default
+// timeout (see SetDefaultTimeout), and cb receives the number of data bytes
+// transferred once it completes.
+func (h *DeviceHandle) SubmitControl(setup ControlSetup, data []byte, cb func(int, error)) error {
+	h.mu.RLock()
+	closed := h.closed
+	h.mu.RUnlock()
+
+	if closed {
+		return ErrDeviceNotFound
+	}
+
+	go func() {
+		n, err := h.ControlTransfer(setup.RequestType, setup.Request, setup.Value, setup.Index, data, 0)
+		if cb != nil {
+			cb(n, err)
+		}
+	}()
+
+	return nil
+}
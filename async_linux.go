@@ -1,6 +1,7 @@
 package usb
 
 import (
+	"encoding/binary"
 	"fmt"
 	"sync"
 	"syscall"
@@ -27,6 +28,8 @@ type AsyncTransfer struct {
 	reapErr  error
 	reaped   bool
 	reapCond *sync.Cond
+
+	callback func(*AsyncTransfer) // Set by SetCallback
 }
 
 // IsoPacket represents an isochronous packet
@@ -41,7 +44,10 @@ func (h *DeviceHandle) NewBulkTransfer(endpoint uint8, bufferSize int) (*AsyncTr
 	return h.newAsyncTransfer(endpoint, TransferTypeBulk, bufferSize, 0)
 }
 
-// NewInterruptTransfer creates a new interrupt transfer
+// NewInterruptTransfer creates a new interrupt transfer. The transfer and its
+// buffer are reusable: once it completes it can be submitted again, so
+// keeping several of them in flight, each resubmitted from its callback,
+// polls an interrupt IN endpoint such as a HID report pipe without gaps.
 func (h *DeviceHandle) NewInterruptTransfer(endpoint uint8, bufferSize int) (*AsyncTransfer, error) {
 	return h.newAsyncTransfer(endpoint, TransferTypeInterrupt, bufferSize, 0)
 }
@@ -107,6 +113,18 @@ func (t *AsyncTransfer) SetTimeout(timeout time.Duration) {
 	t.timeout = timeout
 }
 
+// SetCallback sets a function called on every completion of the transfer,
+// from the goroutine that reaps the handle's URBs, once Wait would return.
+// The callback may call Submit to queue the transfer again; Buffer is
+// overwritten by the next completion, so read it before doing so. The
+// callback should return promptly, since it delays every other completion
+// of the handle.
+func (t *AsyncTransfer) SetCallback(callback func(*AsyncTransfer)) {
+	t.reapCond.L.Lock()
+	defer t.reapCond.L.Unlock()
+	t.callback = callback
+}
+
 // Status returns the transfer status
 func (t *AsyncTransfer) Status() TransferStatus {
 	t.waitForReaping()
@@ -140,10 +158,6 @@ func (t *AsyncTransfer) IsoPackets() []IsoPacket {
 
 // Submit submits the transfer for execution
 func (t *AsyncTransfer) Submit() error {
-	if t.submitted {
-		return fmt.Errorf("transfer already submitted")
-	}
-
 	t.handle.mu.RLock()
 	defer t.handle.mu.RUnlock()
 
@@ -151,6 +165,15 @@ func (t *AsyncTransfer) Submit() error {
 		return ErrDeviceNotFound
 	}
 
+	t.reapCond.L.Lock()
+	if t.submitted {
+		t.reapCond.L.Unlock()
+		return fmt.Errorf("transfer already submitted")
+	}
+	t.submitted = true
+	t.reaped = false
+	t.reapCond.L.Unlock()
+
 	// Reset URB fields
 	t.urb.Status = 0
 	t.urb.ActualLength = 0
@@ -158,8 +181,7 @@ func (t *AsyncTransfer) Submit() error {
 
 	// Set up iso packets if needed
 	if t.transferType == TransferTypeIsochronous && len(t.isoPackets) > 0 {
-		isoPackets := (*[1 << 16]IsoPacketDescriptor)(unsafe.Pointer(
-			uintptr(unsafe.Pointer(t.urb)) + unsafe.Sizeof(URB{})))
+		isoPackets := unsafe.Slice((*IsoPacketDescriptor)(unsafe.Add(unsafe.Pointer(t.urb), unsafe.Sizeof(URB{}))), len(t.isoPackets))
 		for i := range t.isoPackets {
 			isoPackets[i].Length = uint32(t.isoPackets[i].Length)
 			isoPackets[i].ActualLength = 0
@@ -167,27 +189,10 @@ func (t *AsyncTransfer) Submit() error {
 		}
 	}
 
-	// Submit URB to kernel
-	_, _, errno := syscall.Syscall(
-		syscall.SYS_IOCTL,
-		uintptr(t.handle.fd),
-		USBDEVFS_SUBMITURB,
-		uintptr(unsafe.Pointer(t.urb)),
-	)
-
-	if errno != 0 {
-		return fmt.Errorf("failed to submit URB: %v", errno)
-	}
-
-	t.submitted = true
-	t.reaped = false
-
-	// Register with centralized reaper
-	t.handle.registerURBCompletion(uintptr(unsafe.Pointer(t.urb)), func(err error) {
+	// Submit URB to kernel through the centralized reaper
+	err := t.handle.submitURB(t.urb, func(err error) {
 		// Process URB completion
 		t.reapCond.L.Lock()
-		defer t.reapCond.L.Unlock()
-
 		t.reapErr = err
 
 		if err == nil {
@@ -195,8 +200,7 @@ func (t *AsyncTransfer) Submit() error {
 
 			// Update iso packets if needed
 			if t.transferType == TransferTypeIsochronous && len(t.isoPackets) > 0 {
-				isoPackets := (*[1 << 16]IsoPacketDescriptor)(unsafe.Pointer(
-					uintptr(unsafe.Pointer(t.urb)) + unsafe.Sizeof(URB{})))
+				isoPackets := unsafe.Slice((*IsoPacketDescriptor)(unsafe.Add(unsafe.Pointer(t.urb), unsafe.Sizeof(URB{}))), len(t.isoPackets))
 				for i := range t.isoPackets {
 					t.isoPackets[i].ActualLength = int(isoPackets[i].ActualLength)
 					t.isoPackets[i].Status = int(isoPackets[i].Status)
@@ -208,14 +212,31 @@ func (t *AsyncTransfer) Submit() error {
 		t.submitted = false
 		t.reaped = true
 		t.reapCond.Broadcast()
+		callback := t.callback
+		t.reapCond.L.Unlock()
+
+		if callback != nil {
+			callback(t)
+		}
 	})
+	if err != nil {
+		t.reapCond.L.Lock()
+		t.submitted = false
+		t.reaped = true
+		t.reapErr = err
+		t.reapCond.L.Unlock()
+		return fmt.Errorf("failed to submit URB: %v", err)
+	}
 
 	return nil
 }
 
 // Cancel cancels the transfer
 func (t *AsyncTransfer) Cancel() error {
-	if !t.submitted {
+	t.reapCond.L.Lock()
+	submitted := t.submitted
+	t.reapCond.L.Unlock()
+	if !submitted {
 		return fmt.Errorf("transfer not submitted")
 	}
 
@@ -227,15 +248,8 @@ func (t *AsyncTransfer) Cancel() error {
 	}
 
 	// Discard the URB
-	_, _, errno := syscall.Syscall(
-		syscall.SYS_IOCTL,
-		uintptr(t.handle.fd),
-		USBDEVFS_DISCARDURB,
-		uintptr(unsafe.Pointer(t.urb)),
-	)
-
-	if errno != 0 && errno != syscall.EINVAL {
-		return fmt.Errorf("failed to cancel URB: %v", errno)
+	if err := t.handle.discardURB(t.urb); err != nil && err != syscall.EINVAL {
+		return fmt.Errorf("failed to cancel URB: %v", err)
 	}
 
 	return nil
@@ -293,3 +307,85 @@ func (t *AsyncTransfer) SetIsoPacketLengths(length int) {
 		t.isoPackets[i].Length = length
 	}
 }
+
+// SubmitControl submits a control transfer through the reaper instead of the
+// blocking USBDEVFS_CONTROL ioctl. For IN requests the response is copied into
+// data; for OUT requests data is the payload. cb is called from the reaper
+// goroutine with the number of data bytes transferred.
+func (h *DeviceHandle) SubmitControl(setup ControlSetup, data []byte, cb func(int, error)) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return ErrDeviceNotFound
+	}
+
+	if len(data) > 0xFFFF {
+		return ErrInvalidParameter
+	}
+
+	// Control URBs carry the 8-byte setup packet ahead of the data stage
+	buf := make([]byte, 8+len(data))
+	buf[0] = setup.RequestType
+	buf[1] = setup.Request
+	binary.LittleEndian.PutUint16(buf[2:4], setup.Value)
+	binary.LittleEndian.PutUint16(buf[4:6], setup.Index)
+	binary.LittleEndian.PutUint16(buf[6:8], uint16(len(data)))
+
+	in := setup.RequestType&0x80 != 0
+	if !in {
+		copy(buf[8:], data)
+	}
+
+	urb := &URB{
+		Type:         USBDEVFS_URB_TYPE_CONTROL,
+		Endpoint:     0,
+		Buffer:       unsafe.Pointer(&buf[0]),
+		BufferLength: int32(len(buf)),
+	}
+	err := h.submitURB(urb, func(err error) {
+		n := int(urb.ActualLength)
+		if in && err == nil {
+			copy(data, buf[8:8+n])
+		}
+		if cb != nil {
+			cb(n, err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to submit URB: %v", err)
+	}
+
+	return nil
+}
+
+// CancelAll discards every URB still pending on the handle and its clones. The
+// completion of each cancelled transfer is still delivered, carrying an
+// error.
+func (h *DeviceHandle) CancelAll() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return ErrDeviceNotFound
+	}
+
+	if h.backend != nil {
+		h.backendURBs.discardAll()
+		return nil
+	}
+
+	h.reapMutex.Lock()
+	defer h.reapMutex.Unlock()
+
+	for urbPtr := range h.reapMap {
+		syscall.Syscall(
+			syscall.SYS_IOCTL,
+			uintptr(h.fd),
+			USBDEVFS_DISCARDURB,
+			urbPtr,
+		)
+	}
+
+	return nil
+}
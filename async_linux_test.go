@@ -0,0 +1,71 @@
+package usb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAsyncTransferCallback(t *testing.T) {
+	reports := 0
+	dev := &MockDevice{
+		Bus:     1,
+		Address: 9,
+		Endpoints: map[uint8]func([]byte) (int, error){
+			0x81: func(data []byte) (int, error) {
+				reports++
+				return copy(data, []byte{byte(reports), 0xaa}), nil
+			},
+		},
+	}
+	h := openMockHandle(t, dev)
+
+	transfer, err := h.NewInterruptTransfer(0x81, 8)
+	if err != nil {
+		t.Fatalf("NewInterruptTransfer() error = %v", err)
+	}
+
+	// The callback sees each completion and polls again from inside itself
+	// until three reports have arrived
+	var got [][]byte
+	done := make(chan struct{})
+	transfer.SetCallback(func(tr *AsyncTransfer) {
+		if err := tr.Wait(); err != nil {
+			t.Errorf("Wait() in the callback error = %v", err)
+		}
+		got = append(got, append([]byte(nil), tr.Buffer()...))
+		if len(got) == 3 {
+			close(done)
+			return
+		}
+		if err := tr.Submit(); err != nil {
+			t.Errorf("Submit() from the callback error = %v", err)
+			close(done)
+		}
+	})
+	if err := transfer.Submit(); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("callback ran %d times, want 3", len(got))
+	}
+	for i, report := range got {
+		if len(report) != 2 || report[0] != byte(i+1) {
+			t.Errorf("completion %d buffer = %x, want report %d", i, report, i+1)
+		}
+	}
+
+	// Without a callback the transfer only completes for Wait
+	transfer.SetCallback(nil)
+	if err := transfer.Submit(); err != nil {
+		t.Fatalf("Submit() without a callback error = %v", err)
+	}
+	if err := transfer.WaitWithTimeout(5 * time.Second); err != nil || transfer.Buffer()[0] != 4 {
+		t.Errorf("WaitWithTimeout() = %v, buffer %x, want report 4", err, transfer.Buffer())
+	}
+	if len(got) != 3 {
+		t.Errorf("callback ran %d times after SetCallback(nil), want 3", len(got))
+	}
+}
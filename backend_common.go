@@ -0,0 +1,164 @@
+package usb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Backend stands in for the operating system's USB stack. While one is set
+// with SetBackend, DeviceList returns its devices and the handles opened on
+// them send their requests to it, so code built on this package can be
+// tested without hardware or privileges. MockBackend is an in-memory
+// Backend.
+type Backend interface {
+	// DeviceList returns the attached devices. Bus and Address must be
+	// distinct for each, since they identify the device to Open.
+	DeviceList() ([]BackendDevice, error)
+
+	// Open opens a device returned by DeviceList
+	Open(dev *Device) (BackendHandle, error)
+}
+
+// BackendDevice describes a device of a Backend
+type BackendDevice struct {
+	Path       string
+	Bus        uint8
+	Address    uint8
+	Descriptor DeviceDescriptor
+}
+
+// BackendHandle carries out the requests of a DeviceHandle opened through a
+// Backend. The DeviceHandle keeps its own state, such as the interfaces it
+// claimed and whether it was closed, and checks it before calling in.
+type BackendHandle interface {
+	// ControlTransfer carries out a request on the default pipe, including
+	// the standard requests for descriptors and the configuration
+	ControlTransfer(requestType, request uint8, value, index uint16, data []byte, timeout time.Duration) (int, error)
+
+	// Transfer carries out a bulk or interrupt transfer in the direction
+	// given by bit 7 of endpoint
+	Transfer(endpoint uint8, data []byte, timeout time.Duration) (int, error)
+
+	// IsochronousTransfer fills or sends each packet in turn and returns
+	// how many bytes each one transferred
+	IsochronousTransfer(endpoint uint8, packets [][]byte) ([]int, error)
+
+	ClaimInterface(iface uint8) error
+	ReleaseInterface(iface uint8) error
+	SetInterfaceAltSetting(iface, altSetting uint8) error
+	ClearHalt(endpoint uint8) error
+	Close() error
+}
+
+var backendState struct {
+	mu      sync.RWMutex
+	backend Backend
+}
+
+// SetBackend makes DeviceList, and the devices it returns, use b instead of
+// the operating system; nil switches back. Devices listed and handles opened
+// before the call keep using what they came from.
+//
+// Handles on a Backend route control, bulk, interrupt and, on Linux,
+// asynchronous and isochronous transfers to it, along with the descriptor,
+// configuration and interface requests. Requests that only the operating
+// system can answer, such as kernel driver management, fail.
+func SetBackend(b Backend) {
+	backendState.mu.Lock()
+	defer backendState.mu.Unlock()
+	backendState.backend = b
+}
+
+// currentBackend returns the Backend set with SetBackend, or nil
+func currentBackend() Backend {
+	backendState.mu.RLock()
+	defer backendState.mu.RUnlock()
+	return backendState.backend
+}
+
+// backendDeviceList lists the devices of b as Devices that open through it
+func backendDeviceList(b Backend, options *deviceListOptions) ([]*Device, []error, error) {
+	list, err := b.DeviceList()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	devices := make([]*Device, len(list))
+	for i, bd := range list {
+		devices[i] = &Device{
+			Path:       bd.Path,
+			Bus:        bd.Bus,
+			Address:    bd.Address,
+			Descriptor: bd.Descriptor,
+			backend:    b,
+		}
+	}
+	if options.excludeRootHubs {
+		devices = withoutRootHubs(devices)
+	}
+	return devices, nil, nil
+}
+
+// openBackend opens d through the Backend it was listed from
+func (d *Device) openBackend(opts []OpenOption) (*DeviceHandle, error) {
+	bh, err := d.backend.Open(d)
+	if err != nil {
+		return nil, err
+	}
+
+	h := newBackendHandle(d, bh)
+	if err := h.applyOpenOptions(opts); err != nil {
+		h.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// backendConfigDescriptor reads the configuration descriptor at index from
+// bh, header first to learn its length, as the kernel does
+func backendConfigDescriptor(bh BackendHandle, index uint8) ([]byte, error) {
+	header := make([]byte, 9)
+	if _, err := bh.ControlTransfer(0x80, USB_REQ_GET_DESCRIPTOR, USB_DT_CONFIG<<8|uint16(index), 0, header, 0); err != nil {
+		return nil, fmt.Errorf("failed to get config descriptor header: %w", err)
+	}
+
+	data := make([]byte, binary.LittleEndian.Uint16(header[2:4]))
+	n, err := bh.ControlTransfer(0x80, USB_REQ_GET_DESCRIPTOR, USB_DT_CONFIG<<8|uint16(index), 0, data, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get full config descriptor: %w", err)
+	}
+	if err := ValidateConfigLength(data[:n]); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// backendStringDescriptor reads string descriptor index from bh in US
+// English
+func backendStringDescriptor(bh BackendHandle, index uint8) (string, error) {
+	return fetchStringDescriptor(func(buf []byte) (int, error) {
+		return bh.ControlTransfer(0x80, USB_REQ_GET_DESCRIPTOR, USB_DT_STRING<<8|uint16(index), 0x0409, buf, 0)
+	})
+}
+
+// backendConfiguration asks bh for the bConfigurationValue of the active
+// configuration
+func backendConfiguration(bh BackendHandle) (int, error) {
+	buf := make([]byte, 1)
+	n, err := bh.ControlTransfer(0x80, USB_REQ_GET_CONFIGURATION, 0, 0, buf, 0)
+	if err != nil {
+		return 0, err
+	}
+	if n != 1 {
+		return 0, fmt.Errorf("short GET_CONFIGURATION response: %d bytes", n)
+	}
+	return int(buf[0]), nil
+}
+
+// backendSetConfiguration selects configuration config on bh
+func backendSetConfiguration(bh BackendHandle, config int) error {
+	_, err := bh.ControlTransfer(0x00, USB_REQ_SET_CONFIGURATION, uint16(config), 0, nil, 0)
+	return err
+}
@@ -0,0 +1,25 @@
+package usb
+
+import "time"
+
+// newBackendHandle returns a handle whose requests go to bh instead of an
+// IOKit device interface
+func newBackendHandle(d *Device, bh BackendHandle) *DeviceHandle {
+	return &DeviceHandle{
+		device:        d,
+		interfaces:    make(map[uint8]*IOUSBInterfaceInterface),
+		claimedIfaces: make(map[uint8]bool),
+		refs:          newHandleRefs(),
+		backend:       bh,
+	}
+}
+
+// defaultPipeTransfer makes a control transfer through the Backend of a
+// handle on one, or the IOKit device interface otherwise. The caller must
+// hold h.mu.
+func (h *DeviceHandle) defaultPipeTransfer(requestType, request uint8, value, index uint16, data []byte, timeout time.Duration) (int, error) {
+	if h.backend != nil {
+		return h.backend.ControlTransfer(requestType, request, value, index, data, timeout)
+	}
+	return h.devInterface.ControlTransfer(requestType, request, value, index, data, h.controlTimeout(timeout))
+}
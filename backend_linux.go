@@ -0,0 +1,178 @@
+package usb
+
+import (
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// newBackendHandle returns a handle whose requests go to bh. It has no usbfs
+// descriptor; its URBs are carried out by a backendURBQueue instead of the
+// kernel.
+func newBackendHandle(d *Device, bh BackendHandle) *DeviceHandle {
+	return &DeviceHandle{
+		device:        d,
+		fd:            -1,
+		claimedIfaces: make(map[uint8]bool),
+		refs:          newHandleRefs(),
+		urbReaper:     newURBReaper(),
+		backend:       bh,
+		backendURBs:   &backendURBQueue{},
+	}
+}
+
+// closeBackend releases the interfaces of a handle on a Backend and closes
+// it. The caller has marked the handle closed.
+func (h *DeviceHandle) closeBackend() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for iface := range h.claimedIfaces {
+		h.releaseInterfaceInternal(iface)
+	}
+	return h.backend.Close()
+}
+
+// backendControl carries out a request built for USBDEVFS_CONTROL on the
+// handle's Backend
+func (h *DeviceHandle) backendControl(ctrl *usbCtrlRequest) (int, error) {
+	var data []byte
+	if ctrl.Data != nil {
+		data = unsafe.Slice((*byte)(ctrl.Data), ctrl.Length)
+	}
+	return h.backend.ControlTransfer(ctrl.RequestType, ctrl.Request, ctrl.Value, ctrl.Index, data, 0)
+}
+
+// backendURB is a URB waiting for its Backend
+type backendURB struct {
+	urb      *URB
+	callback func(error)
+}
+
+// backendURBQueue carries out the URBs of a handle on a Backend one at a
+// time, in submission order, on a goroutine that runs while any are queued.
+// Completions are delivered from that goroutine like the reaper's, so
+// callbacks may resubmit.
+type backendURBQueue struct {
+	mu      sync.Mutex
+	pending []backendURB
+	running bool
+}
+
+func (q *backendURBQueue) submit(h *DeviceHandle, urb *URB, callback func(error)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending = append(q.pending, backendURB{urb: urb, callback: callback})
+	if !q.running {
+		q.running = true
+		go q.run(h)
+	}
+}
+
+func (q *backendURBQueue) run(h *DeviceHandle) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		next := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		next.callback(h.runBackendURB(next.urb))
+	}
+}
+
+// discard completes urb with ErrInterrupted if the Backend has not started
+// on it, as the kernel does a discarded URB. One the Backend is already
+// carrying out completes normally.
+func (q *backendURBQueue) discard(urb *URB) {
+	q.mu.Lock()
+	var callback func(error)
+	for i, p := range q.pending {
+		if p.urb == urb {
+			callback = p.callback
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+	q.mu.Unlock()
+
+	if callback != nil {
+		urb.Status = -int32(syscall.ENOENT)
+		callback(ErrInterrupted)
+	}
+}
+
+// discardAll completes every URB the Backend has not started on with
+// ErrInterrupted
+func (q *backendURBQueue) discardAll() {
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+
+	for _, p := range pending {
+		p.urb.Status = -int32(syscall.ENOENT)
+		p.callback(ErrInterrupted)
+	}
+}
+
+// runBackendURB carries out urb on the handle's Backend, filling in the
+// lengths and packet results the kernel would
+func (h *DeviceHandle) runBackendURB(urb *URB) error {
+	var buf []byte
+	if urb.Buffer != nil && urb.BufferLength > 0 {
+		buf = unsafe.Slice((*byte)(urb.Buffer), urb.BufferLength)
+	}
+
+	var err error
+	switch urb.Type {
+	case USBDEVFS_URB_TYPE_ISO:
+		descs := unsafe.Slice((*IsoPacketDescriptor)(unsafe.Add(unsafe.Pointer(urb), unsafe.Sizeof(URB{}))), urb.NumberOfPackets)
+		packets := make([][]byte, len(descs))
+		offset := 0
+		for i, d := range descs {
+			end := min(offset+int(d.Length), len(buf))
+			packets[i] = buf[offset:end]
+			offset = end
+		}
+
+		var lengths []int
+		lengths, err = h.backend.IsochronousTransfer(urb.Endpoint, packets)
+		urb.ActualLength = 0
+		for i := range descs {
+			descs[i].ActualLength, descs[i].Status = 0, 0
+			if i < len(lengths) {
+				descs[i].ActualLength = uint32(lengths[i])
+				urb.ActualLength += int32(lengths[i])
+			}
+		}
+
+	case USBDEVFS_URB_TYPE_CONTROL:
+		if len(buf) < 8 {
+			return ErrInvalidParameter
+		}
+		setup := buf[:8]
+		length := min(int(setup[6])|int(setup[7])<<8, len(buf)-8)
+		var n int
+		n, err = h.backend.ControlTransfer(setup[0], setup[1],
+			uint16(setup[2])|uint16(setup[3])<<8, uint16(setup[4])|uint16(setup[5])<<8,
+			buf[8:8+length], 0)
+		urb.ActualLength = int32(n)
+
+	default:
+		var n int
+		n, err = h.backend.Transfer(urb.Endpoint, buf, 0)
+		urb.ActualLength = int32(n)
+	}
+
+	urb.Status = 0
+	if err != nil {
+		urb.Status = -int32(syscall.EIO)
+	}
+	return err
+}
@@ -0,0 +1,16 @@
+package usb
+
+import "golang.org/x/sys/windows"
+
+// newBackendHandle returns a handle whose requests go to bh instead of a
+// WinUSB handle
+func newBackendHandle(d *Device, bh BackendHandle) *DeviceHandle {
+	return &DeviceHandle{
+		device:           d,
+		fileHandle:       windows.InvalidHandle,
+		interfaceHandles: make(map[uint8]winusbInterfaceHandle),
+		claimedIfaces:    make(map[uint8]bool),
+		refs:             newHandleRefs(),
+		backend:          bh,
+	}
+}
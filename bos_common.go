@@ -0,0 +1,200 @@
+package usb
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Device capability types found in the BOS descriptor
+const (
+	USB_DC_USB20_EXTENSION = 0x02
+	USB_DC_SUPERSPEED      = 0x03
+	USB_DC_CONTAINER_ID    = 0x04
+	USB_DC_PLATFORM        = 0x05
+	USB_DC_SUPERSPEED_PLUS = 0x0a
+)
+
+// parseBOSDescriptor parses a complete BOS blob into its header and the
+// device capabilities that follow it
+func parseBOSDescriptor(data []byte) (*BOSDescriptor, []DeviceCapabilityDescriptor, error) {
+	if len(data) < 5 {
+		return nil, nil, fmt.Errorf("BOS descriptor too short: %d bytes", len(data))
+	}
+	if data[1] != USB_DT_BOS {
+		return nil, nil, fmt.Errorf("not a BOS descriptor (type: 0x%02x)", data[1])
+	}
+
+	bos := &BOSDescriptor{
+		Length:         data[0],
+		DescriptorType: data[1],
+		TotalLength:    binary.LittleEndian.Uint16(data[2:4]),
+		NumDeviceCaps:  data[4],
+	}
+
+	caps := make([]DeviceCapabilityDescriptor, 0, bos.NumDeviceCaps)
+	for _, capData := range bosCapabilities(data) {
+		caps = append(caps, DeviceCapabilityDescriptor{
+			Length:            capData[0],
+			DescriptorType:    capData[1],
+			DevCapabilityType: capData[2],
+			Data:              capData,
+		})
+	}
+
+	return bos, caps, nil
+}
+
+// bosCapabilities splits a BOS blob into the raw bytes of each device
+// capability, stopping at the first malformed entry
+func bosCapabilities(data []byte) [][]byte {
+	if len(data) < 5 {
+		return nil
+	}
+
+	numDevCaps := int(data[4])
+	caps := make([][]byte, 0, numDevCaps)
+	pos := 5 // Start after BOS header
+
+	for i := 0; i < numDevCaps && pos+3 <= len(data); i++ {
+		length := int(data[pos])
+		if length < 3 || pos+length > len(data) {
+			break
+		}
+
+		caps = append(caps, data[pos:pos+length])
+		pos += length
+	}
+
+	return caps
+}
+
+// bosCapability returns the raw bytes of the first device capability of the
+// given type in a BOS blob, or nil if there is none
+func bosCapability(data []byte, capType uint8) []byte {
+	for _, capData := range bosCapabilities(data) {
+		if capData[1] == USB_DT_DEVICE_CAPABILITY && capData[2] == capType {
+			return capData
+		}
+	}
+	return nil
+}
+
+// parseUSB20ExtensionCapability finds and decodes the USB 2.0 extension
+// capability in a BOS blob
+func parseUSB20ExtensionCapability(data []byte) (*USB2ExtensionCapability, error) {
+	capData := bosCapability(data, USB_DC_USB20_EXTENSION)
+	if capData == nil {
+		return nil, fmt.Errorf("USB 2.0 extension capability not found")
+	}
+	if len(capData) < 7 {
+		return nil, fmt.Errorf("invalid USB 2.0 extension capability length: %d", len(capData))
+	}
+
+	return &USB2ExtensionCapability{
+		Length:            capData[0],
+		DescriptorType:    capData[1],
+		DevCapabilityType: capData[2],
+		Attributes:        binary.LittleEndian.Uint32(capData[3:7]),
+	}, nil
+}
+
+// parseSuperSpeedUSBCapability finds and decodes the SuperSpeed USB device
+// capability in a BOS blob
+func parseSuperSpeedUSBCapability(data []byte) (*SuperSpeedUSBCapability, error) {
+	capData := bosCapability(data, USB_DC_SUPERSPEED)
+	if capData == nil {
+		return nil, fmt.Errorf("SuperSpeed USB capability not found")
+	}
+	if len(capData) < 10 {
+		return nil, fmt.Errorf("invalid SuperSpeed USB capability length: %d", len(capData))
+	}
+
+	return &SuperSpeedUSBCapability{
+		Length:                 capData[0],
+		DescriptorType:         capData[1],
+		DevCapabilityType:      capData[2],
+		Attributes:             capData[3],
+		SpeedsSupported:        binary.LittleEndian.Uint16(capData[4:6]),
+		FunctionalitySupported: capData[6],
+		U1DevExitLat:           capData[7],
+		U2DevExitLat:           binary.LittleEndian.Uint16(capData[8:10]),
+	}, nil
+}
+
+// parseSuperSpeedPlusCapability finds and decodes the SuperSpeedPlus USB
+// capability, including its sublink speed attributes, in a BOS blob
+func parseSuperSpeedPlusCapability(data []byte) (*SuperSpeedPlusCapability, error) {
+	capData := bosCapability(data, USB_DC_SUPERSPEED_PLUS)
+	if capData == nil {
+		return nil, fmt.Errorf("SuperSpeedPlus USB capability not found")
+	}
+	return decodeSuperSpeedPlusCapability(capData)
+}
+
+// decodeSuperSpeedPlusCapability decodes the bytes of a SuperSpeedPlus USB
+// capability
+func decodeSuperSpeedPlusCapability(capData []byte) (*SuperSpeedPlusCapability, error) {
+	if len(capData) < 12 {
+		return nil, fmt.Errorf("invalid SuperSpeedPlus USB capability length: %d", len(capData))
+	}
+
+	ssp := &SuperSpeedPlusCapability{
+		Length:                 capData[0],
+		DescriptorType:         capData[1],
+		DevCapabilityType:      capData[2],
+		Attributes:             binary.LittleEndian.Uint32(capData[4:8]),
+		FunctionalitySupported: binary.LittleEndian.Uint16(capData[8:10]),
+	}
+
+	count := ssp.SublinkSpeedAttributeCount()
+	if len(capData) < 12+4*count {
+		return nil, fmt.Errorf("SuperSpeedPlus USB capability too short for %d sublink speed attributes: %d bytes", count, len(capData))
+	}
+	ssp.SublinkSpeedAttributes = make([]SublinkSpeedAttribute, count)
+	for i := range ssp.SublinkSpeedAttributes {
+		off := 12 + 4*i
+		ssp.SublinkSpeedAttributes[i] = SublinkSpeedAttribute(binary.LittleEndian.Uint32(capData[off : off+4]))
+	}
+
+	return ssp, nil
+}
+
+// ContainerID returns the UUID of a Container ID capability, which is the
+// same for every enumeration of one physical device, such as its USB 2.0 and
+// SuperSpeed halves behind a hub. ok is false for other capabilities.
+func (c DeviceCapabilityDescriptor) ContainerID() (id [16]byte, ok bool) {
+	if c.DevCapabilityType != USB_DC_CONTAINER_ID || len(c.Data) < 20 {
+		return id, false
+	}
+	copy(id[:], c.Data[4:20])
+	return id, true
+}
+
+// PlatformCapability decodes a Platform capability. ok is false for other
+// or truncated capabilities.
+func (c DeviceCapabilityDescriptor) PlatformCapability() (*PlatformCapability, bool) {
+	if c.DevCapabilityType != USB_DC_PLATFORM || len(c.Data) < 20 {
+		return nil, false
+	}
+	p := &PlatformCapability{
+		Length:            c.Data[0],
+		DescriptorType:    c.Data[1],
+		DevCapabilityType: c.Data[2],
+		CapabilityData:    c.Data[20:],
+	}
+	copy(p.UUID[:], c.Data[4:20])
+	return p, true
+}
+
+// SuperSpeedPlus decodes a SuperSpeedPlus USB capability with its sublink
+// speed attributes. ok is false for other or malformed capabilities.
+func (c DeviceCapabilityDescriptor) SuperSpeedPlus() (*SuperSpeedPlusCapability, bool) {
+	if c.DevCapabilityType != USB_DC_SUPERSPEED_PLUS {
+		return nil, false
+	}
+	ssp, err := decodeSuperSpeedPlusCapability(c.Data)
+	if err != nil {
+		return nil, false
+	}
+	return ssp, true
+}
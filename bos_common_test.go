@@ -0,0 +1,124 @@
+package usb
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseBOSDescriptor(t *testing.T) {
+	data, _ := hex.DecodeString(
+		"050f160002" + // BOS: 22 bytes total, 2 capabilities
+			"0710021e000000" + // USB 2.0 extension: LPM supported
+			"0a1003000e0001040100") // SuperSpeed USB: full/high/super, U1 exit 4, U2 exit 1
+
+	bos, caps, err := parseBOSDescriptor(data)
+	if err != nil {
+		t.Fatalf("parseBOSDescriptor() error = %v", err)
+	}
+	if bos.TotalLength != 22 || bos.NumDeviceCaps != 2 {
+		t.Errorf("BOS header = %+v, want TotalLength 22, NumDeviceCaps 2", bos)
+	}
+	if len(caps) != 2 {
+		t.Fatalf("got %d capabilities, want 2", len(caps))
+	}
+	if caps[0].DevCapabilityType != USB_DC_USB20_EXTENSION || caps[1].DevCapabilityType != USB_DC_SUPERSPEED {
+		t.Errorf("capability types = %02x, %02x", caps[0].DevCapabilityType, caps[1].DevCapabilityType)
+	}
+
+	ext, err := parseUSB20ExtensionCapability(data)
+	if err != nil {
+		t.Fatalf("parseUSB20ExtensionCapability() error = %v", err)
+	}
+	if ext.Attributes != 0x1e {
+		t.Errorf("USB 2.0 extension attributes = 0x%x, want 0x1e", ext.Attributes)
+	}
+
+	ss, err := parseSuperSpeedUSBCapability(data)
+	if err != nil {
+		t.Fatalf("parseSuperSpeedUSBCapability() error = %v", err)
+	}
+	if ss.SpeedsSupported != 0x000e || ss.FunctionalitySupported != 1 || ss.U1DevExitLat != 4 || ss.U2DevExitLat != 1 {
+		t.Errorf("SuperSpeed capability = %+v", ss)
+	}
+
+	if _, _, err := parseBOSDescriptor(data[:4]); err == nil {
+		t.Error("parseBOSDescriptor should reject a truncated header")
+	}
+	if _, err := parseSuperSpeedUSBCapability(data[:12]); err == nil {
+		t.Error("parseSuperSpeedUSBCapability should fail when the capability is missing")
+	}
+}
+
+func TestParseSuperSpeedPlusCapability(t *testing.T) {
+	data, _ := hex.DecodeString(
+		"050f1c0001" + // BOS: 28 bytes total, 1 capability
+			"1c100a00" + // SuperSpeedPlus USB, 28 bytes
+			"23000000" + // 4 sublink speed attributes, 2 speed IDs
+			"01110000" + // Min speed ID 1, 1 RX lane, 1 TX lane
+			"30400500" + // ID 0, symmetric RX, Gen1 5 Gb/s
+			"b0400500" + // ID 0, symmetric TX, Gen1 5 Gb/s
+			"31400a00" + // ID 1, symmetric RX, Gen2 10 Gb/s
+			"b1400a00") // ID 1, symmetric TX, Gen2 10 Gb/s
+
+	ssp, err := parseSuperSpeedPlusCapability(data)
+	if err != nil {
+		t.Fatalf("parseSuperSpeedPlusCapability() error = %v", err)
+	}
+	if ssp.SublinkSpeedAttributeCount() != 4 || ssp.SublinkSpeedIDCount() != 2 {
+		t.Errorf("counts = %d, %d, want 4, 2", ssp.SublinkSpeedAttributeCount(), ssp.SublinkSpeedIDCount())
+	}
+	if ssp.MinSpeedAttributeID() != 1 || ssp.MinRxLanes() != 1 || ssp.MinTxLanes() != 1 {
+		t.Errorf("functionality = 0x%04x", ssp.FunctionalitySupported)
+	}
+	if len(ssp.SublinkSpeedAttributes) != 4 {
+		t.Fatalf("got %d sublink speed attributes, want 4", len(ssp.SublinkSpeedAttributes))
+	}
+
+	gen2 := ssp.SublinkSpeedAttributes[3]
+	if gen2.ID() != 1 || !gen2.Transmit() || gen2.Asymmetric() || gen2.LinkProtocol() != 1 {
+		t.Errorf("attribute 3 = 0x%08x", uint32(gen2))
+	}
+	if gen2.LaneSpeed() != 10_000_000_000 {
+		t.Errorf("LaneSpeed() = %d, want 10 Gb/s", gen2.LaneSpeed())
+	}
+
+	if _, err := parseSuperSpeedPlusCapability(data[:24]); err == nil {
+		t.Error("parseSuperSpeedPlusCapability should reject truncated sublink speed attributes")
+	}
+}
+
+func TestDeviceCapabilityAccessors(t *testing.T) {
+	data, _ := hex.DecodeString(
+		"050f410003" + // BOS: 65 bytes total, 3 capabilities
+			"14100400" + "000102030405060708090a0b0c0d0e0f" + // Container ID
+			"18100500" + "38b60834a909a0478bfda0768815b665" + "00010000" + // Platform: WebUSB, 4 bytes of data
+			"10100a00" + "00000000" + "00110000" + "30400500") // SuperSpeedPlus USB: one sublink speed attribute
+	_, caps, err := parseBOSDescriptor(data)
+	if err != nil {
+		t.Fatalf("parseBOSDescriptor() error = %v", err)
+	}
+	if len(caps) != 3 {
+		t.Fatalf("got %d capabilities, want 3", len(caps))
+	}
+
+	id, ok := caps[0].ContainerID()
+	if !ok || id != [16]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15} {
+		t.Errorf("ContainerID() = %x, %v", id, ok)
+	}
+	if _, ok := caps[1].ContainerID(); ok {
+		t.Error("ContainerID() of a Platform capability succeeded")
+	}
+
+	platform, ok := caps[1].PlatformCapability()
+	if !ok {
+		t.Fatal("PlatformCapability() failed")
+	}
+	if platform.UUID[0] != 0x38 || platform.UUID[15] != 0x65 || len(platform.CapabilityData) != 4 {
+		t.Errorf("PlatformCapability() = %+v", platform)
+	}
+
+	ssp, ok := caps[2].SuperSpeedPlus()
+	if !ok || len(ssp.SublinkSpeedAttributes) != 1 || ssp.SublinkSpeedAttributes[0].LaneSpeed() != 5_000_000_000 {
+		t.Errorf("SuperSpeedPlus() = %+v, %v", ssp, ok)
+	}
+}
@@ -0,0 +1,160 @@
+// Package cdc implements helpers for USB Communications Device Class
+// devices, such as CDC-ACM serial adapters.
+package cdc
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Class-specific descriptor types
+const (
+	USB_DT_CS_INTERFACE = 0x24
+	USB_DT_CS_ENDPOINT  = 0x25
+)
+
+// CDC functional descriptor subtypes
+const (
+	USB_CDC_HEADER_TYPE          = 0x00
+	USB_CDC_CALL_MANAGEMENT_TYPE = 0x01
+	USB_CDC_ACM_TYPE             = 0x02
+	USB_CDC_UNION_TYPE           = 0x06
+)
+
+// HeaderDescriptor marks the start of the functional descriptors
+type HeaderDescriptor struct {
+	Length            uint8
+	DescriptorType    uint8
+	DescriptorSubtype uint8
+	CDCVersion        uint16
+}
+
+// CallManagementDescriptor describes how calls are managed
+type CallManagementDescriptor struct {
+	Length            uint8
+	DescriptorType    uint8
+	DescriptorSubtype uint8
+	Capabilities      uint8
+	DataInterface     uint8
+}
+
+// ACMDescriptor lists the Abstract Control Management requests the device
+// supports
+type ACMDescriptor struct {
+	Length            uint8
+	DescriptorType    uint8
+	DescriptorSubtype uint8
+	Capabilities      uint8
+}
+
+// UnionDescriptor groups the control interface with the interfaces it manages
+type UnionDescriptor struct {
+	Length                uint8
+	DescriptorType        uint8
+	DescriptorSubtype     uint8
+	ControlInterface      uint8
+	SubordinateInterfaces []uint8
+}
+
+// FunctionalDescriptors holds the functional descriptors of a communications
+// interface
+type FunctionalDescriptors struct {
+	Header         *HeaderDescriptor
+	CallManagement *CallManagementDescriptor
+	ACM            *ACMDescriptor
+	Union          *UnionDescriptor
+
+	// Other class-specific interface descriptors that are not parsed
+	Other [][]byte
+}
+
+// DataInterface returns the data interface paired with the communications
+// interface, taken from the Union descriptor or, failing that, the Call
+// Management descriptor
+func (f *FunctionalDescriptors) DataInterface() (uint8, bool) {
+	if f.Union != nil && len(f.Union.SubordinateInterfaces) > 0 {
+		return f.Union.SubordinateInterfaces[0], true
+	}
+	if f.CallManagement != nil {
+		return f.CallManagement.DataInterface, true
+	}
+	return 0, false
+}
+
+// ParseFunctionalDescriptors parses the CDC functional descriptors from the
+// Extra bytes of a communications interface. Descriptors that are not
+// class-specific interface descriptors are skipped.
+func ParseFunctionalDescriptors(extra []byte) (*FunctionalDescriptors, error) {
+	f := &FunctionalDescriptors{}
+
+	pos := 0
+	for pos < len(extra) {
+		if pos+2 > len(extra) {
+			return nil, fmt.Errorf("truncated descriptor at offset %d", pos)
+		}
+
+		length := int(extra[pos])
+		if length < 2 || pos+length > len(extra) {
+			return nil, fmt.Errorf("invalid descriptor length %d at offset %d", length, pos)
+		}
+
+		data := extra[pos : pos+length]
+		pos += length
+
+		if data[1] != USB_DT_CS_INTERFACE {
+			continue
+		}
+		if length < 3 {
+			return nil, fmt.Errorf("functional descriptor too short: %d bytes", length)
+		}
+
+		switch data[2] {
+		case USB_CDC_HEADER_TYPE:
+			if length < 5 {
+				return nil, fmt.Errorf("invalid header descriptor length: %d", length)
+			}
+			f.Header = &HeaderDescriptor{
+				Length:            data[0],
+				DescriptorType:    data[1],
+				DescriptorSubtype: data[2],
+				CDCVersion:        binary.LittleEndian.Uint16(data[3:5]),
+			}
+		case USB_CDC_CALL_MANAGEMENT_TYPE:
+			if length < 5 {
+				return nil, fmt.Errorf("invalid call management descriptor length: %d", length)
+			}
+			f.CallManagement = &CallManagementDescriptor{
+				Length:            data[0],
+				DescriptorType:    data[1],
+				DescriptorSubtype: data[2],
+				Capabilities:      data[3],
+				DataInterface:     data[4],
+			}
+		case USB_CDC_ACM_TYPE:
+			if length < 4 {
+				return nil, fmt.Errorf("invalid ACM descriptor length: %d", length)
+			}
+			f.ACM = &ACMDescriptor{
+				Length:            data[0],
+				DescriptorType:    data[1],
+				DescriptorSubtype: data[2],
+				Capabilities:      data[3],
+			}
+		case USB_CDC_UNION_TYPE:
+			if length < 5 {
+				return nil, fmt.Errorf("invalid union descriptor length: %d", length)
+			}
+			f.Union = &UnionDescriptor{
+				Length:                data[0],
+				DescriptorType:        data[1],
+				DescriptorSubtype:     data[2],
+				ControlInterface:      data[3],
+				SubordinateInterfaces: append([]uint8(nil), data[4:]...),
+			}
+		default:
+			f.Other = append(f.Other, data)
+		}
+	}
+
+	return f, nil
+}
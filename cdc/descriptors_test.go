@@ -0,0 +1,81 @@
+package cdc
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseFunctionalDescriptors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string // hex encoded
+		wantErr  bool
+		validate func(t *testing.T, f *FunctionalDescriptors)
+	}{
+		{
+			name: "acm",
+			data: "0524001001" + // Header: CDC 1.10
+				"0524010001" + // Call Management: no capabilities, data interface 1
+				"04240202" + // ACM: line coding and serial state
+				"0524060001", // Union: control 0, subordinate 1
+			validate: func(t *testing.T, f *FunctionalDescriptors) {
+				if f.Header == nil || f.Header.CDCVersion != 0x0110 {
+					t.Errorf("Header = %+v, want CDC 1.10", f.Header)
+				}
+				if f.ACM == nil || f.ACM.Capabilities != 0x02 {
+					t.Errorf("ACM = %+v, want capabilities 0x02", f.ACM)
+				}
+				if f.Union == nil || f.Union.ControlInterface != 0 {
+					t.Fatalf("Union = %+v, want control interface 0", f.Union)
+				}
+				if data, ok := f.DataInterface(); !ok || data != 1 {
+					t.Errorf("DataInterface() = %d, %v, want 1, true", data, ok)
+				}
+			},
+		},
+		{
+			name: "call_management_only",
+			data: "0524010302",
+			validate: func(t *testing.T, f *FunctionalDescriptors) {
+				if data, ok := f.DataInterface(); !ok || data != 2 {
+					t.Errorf("DataInterface() = %d, %v, want 2, true", data, ok)
+				}
+			},
+		},
+		{
+			name: "skips_other_descriptors",
+			data: "0705810340000a" + // Endpoint descriptor
+				"0524ff0000", // Unknown functional descriptor
+			validate: func(t *testing.T, f *FunctionalDescriptors) {
+				if len(f.Other) != 1 {
+					t.Errorf("len(Other) = %d, want 1", len(f.Other))
+				}
+				if _, ok := f.DataInterface(); ok {
+					t.Error("DataInterface() found an interface without a Union descriptor")
+				}
+			},
+		},
+		{
+			name:    "truncated",
+			data:    "052400",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatalf("invalid test data: %v", err)
+			}
+
+			f, err := ParseFunctionalDescriptors(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFunctionalDescriptors() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.validate != nil {
+				tt.validate(t, f)
+			}
+		})
+	}
+}
@@ -2,7 +2,8 @@ package main
 
 import (
 	"bytes"
-	"encoding/binary"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -10,61 +11,19 @@ import (
 	"time"
 
 	usb "github.com/kevmo314/go-usb"
+	"github.com/kevmo314/go-usb/msc"
 )
 
-const (
-	// USB Mass Storage Class constants
-	MSC_CLASS         = 0x08
-	MSC_SUBCLASS_SCSI = 0x06
-	MSC_PROTOCOL_BULK = 0x50
-
-	// Command Block Wrapper signature
-	CBW_SIGNATURE = 0x43425355 // "USBC" in little-endian
-
-	// Command Status Wrapper signature
-	CSW_SIGNATURE = 0x53425355 // "USBS" in little-endian
-
-	// SCSI Commands
-	SCSI_INQUIRY         = 0x12
-	SCSI_READ_CAPACITY   = 0x25
-	SCSI_READ_10         = 0x28
-	SCSI_TEST_UNIT_READY = 0x00
-	SCSI_REQUEST_SENSE   = 0x03
-)
-
-// Command Block Wrapper (CBW) for sending SCSI commands
-type CBW struct {
-	Signature          uint32
-	Tag                uint32
-	DataTransferLength uint32
-	Flags              uint8
-	LUN                uint8
-	CBLength           uint8
-	CB                 [16]byte // SCSI Command Block
-}
-
-// Command Status Wrapper (CSW) for receiving status
-type CSW struct {
-	Signature   uint32
-	Tag         uint32
-	DataResidue uint32
-	Status      uint8
-}
-
-// MSCDevice wraps a USB device handle for Mass Storage operations
-type MSCDevice struct {
-	handle *usb.DeviceHandle
-	epIn   uint8
-	epOut  uint8
-	tag    uint32
-}
-
 func main() {
 	// Parse command-line flags
 	var (
-		vendorID    = flag.String("vid", "0781", "USB Vendor ID in hex (e.g., 0781 for SanDisk)")
-		productID   = flag.String("pid", "5581", "USB Product ID in hex (e.g., 5581 for Ultra)")
-		listDevices = flag.Bool("list", false, "List all USB Mass Storage devices")
+		vendorID     = flag.String("vid", "0781", "USB Vendor ID in hex (e.g., 0781 for SanDisk)")
+		productID    = flag.String("pid", "5581", "USB Product ID in hex (e.g., 5581 for Ultra)")
+		listDevices  = flag.Bool("list", false, "List all USB Mass Storage devices")
+		readyTimeout = flag.Duration("ready-timeout", 10*time.Second, "How long to wait for the medium to become ready")
+		lun          = flag.Uint("lun", 0, "Logical unit to browse, for card readers with several slots")
+		writePath    = flag.String("write", "", "Write this file to the drive, overwriting its contents, and verify it")
+		writeLBA     = flag.Uint("write-lba", 0, "Block to start writing the -write file at")
 	)
 	flag.Parse()
 
@@ -88,64 +47,56 @@ func main() {
 
 	fmt.Printf("Looking for device VID:PID = %04x:%04x\n", vid, pid)
 
-	// First, try to unbind the device from usb-storage driver if needed
-	fmt.Println("Preparing device access...")
-	unbindDevice()
+	devices, err := usb.FindDevices(vid, pid)
+	if err != nil {
+		log.Fatal("Failed to get device list:", err)
+	}
+	if len(devices) == 0 {
+		log.Fatalf("Device %04x:%04x not found. Make sure the USB device is connected", vid, pid)
+	}
+	device := devices[0]
 
 	// Open the specified device
-	handle, err := usb.OpenDevice(vid, pid)
+	handle, err := device.Open()
 	if err != nil {
-		log.Fatalf("Failed to open device %04x:%04x: %v\n", vid, pid, err)
-		log.Fatal("Make sure the USB device is connected and you have permissions")
+		log.Fatalf("Failed to open device %04x:%04x: %v\nMake sure you have permissions", vid, pid, err)
 	}
 	defer handle.Close()
 
 	fmt.Printf("✓ Found and opened USB device %04x:%04x\n", vid, pid)
 
-	// Get device descriptor for information
-	devices, err := usb.DeviceList()
-	if err != nil {
-		log.Fatal("Failed to get device list:", err)
-	}
-
-	var device *usb.Device
-	for _, d := range devices {
-		if d.Descriptor.VendorID == vid && d.Descriptor.ProductID == pid {
-			device = d
-			break
-		}
-	}
-
-	if device != nil {
-		// Try to get product name
-		if product, err := handle.StringDescriptor(device.Descriptor.ProductIndex); err == nil {
-			fmt.Printf("Device: %s\n", product)
-		}
+	// Try to get product name
+	if product, err := handle.StringDescriptor(device.Descriptor.ProductIndex); err == nil {
+		fmt.Printf("Device: %s\n", product)
 	}
 
 	// Find Mass Storage interface and endpoints
-	epIn, epOut, err := findMSCEndpoints(handle)
+	iface, epIn, epOut, err := findMSCEndpoints(handle)
 	if err != nil {
 		log.Fatal("Failed to find Mass Storage endpoints:", err)
 	}
 
-	fmt.Printf("✓ Found Mass Storage endpoints: IN=0x%02x, OUT=0x%02x\n", epIn, epOut)
+	fmt.Printf("✓ Found Mass Storage interface %d: IN=0x%02x, OUT=0x%02x\n", iface, epIn, epOut)
+
+	// Try to unbind the interface from the usb-storage driver if needed
+	fmt.Println("Preparing device access...")
+	unbindDevice(device, iface)
 
-	// First, try to detach any kernel driver
+	// First, try to detach any kernel driver, which is bound again when the
+	// handle is closed
 	fmt.Println("Checking for kernel driver...")
-	if err := handle.DetachKernelDriver(0); err != nil {
-		// It's okay if this fails - might mean no driver was attached
+	handle.SetReattachOnClose(true)
+	if active, err := handle.KernelDriverActive(iface); err == nil && !active {
+		fmt.Println("✓ No kernel driver attached")
+	} else if err := handle.DetachKernelDriver(iface); err != nil {
+		// It's okay if this fails - the claim below may still succeed
 		fmt.Printf("Note: Kernel driver detach result: %v\n", err)
 	} else {
 		fmt.Println("✓ Detached kernel driver")
-		defer func() {
-			// Re-attach kernel driver when done
-			handle.AttachKernelDriver(0)
-		}()
 	}
 
 	// Now claim the interface
-	err = handle.ClaimInterface(0)
+	err = handle.ClaimInterface(iface)
 	if err != nil {
 		log.Fatal("Failed to claim interface. This might be because:\n"+
 			"1. The device is mounted (try: sudo umount /dev/sdX*)\n"+
@@ -153,38 +104,43 @@ func main() {
 			"3. Insufficient permissions\n"+
 			"Error:", err)
 	}
-	defer handle.ReleaseInterface(0)
+	defer handle.ReleaseInterface(iface)
 
 	fmt.Println("✓ Claimed Mass Storage interface")
 
-	// Create MSC device wrapper
-	msc := &MSCDevice{
-		handle: handle,
-		epIn:   epIn,
-		epOut:  epOut,
-		tag:    1,
+	// Wait for the medium, which card readers only report once a card is
+	// inserted and spun up
+	fmt.Println("\n--- Waiting for Unit Ready ---")
+	drive, err := msc.NewDrive(handle, iface)
+	if err != nil {
+		log.Fatal("Failed to set up drive:", err)
 	}
-
-	// Test Unit Ready
-	fmt.Println("\n--- Testing Unit Ready ---")
-	if err := msc.TestUnitReady(); err != nil {
-		fmt.Printf("Warning: Test Unit Ready failed: %v\n", err)
-		// Continue anyway, some devices report not ready but still work
-	} else {
-		fmt.Println("✓ Device is ready")
+	if maxLUN, err := drive.MaxLUN(); err == nil {
+		fmt.Printf("Logical units: %d\n", int(maxLUN)+1)
+		if *lun > uint(maxLUN) {
+			log.Fatalf("LUN %d out of range (max %d)", *lun, maxLUN)
+		}
 	}
+	drive.SetLUN(uint8(*lun))
+	ctx, cancel := context.WithTimeout(context.Background(), *readyTimeout)
+	err = drive.WaitReady(ctx)
+	cancel()
+	if err != nil {
+		log.Fatal("Device not ready:", err)
+	}
+	fmt.Println("✓ Device is ready")
 
 	// Send SCSI Inquiry command
 	fmt.Println("\n--- SCSI Inquiry ---")
-	inquiryData, err := msc.Inquiry()
+	inquiry, err := drive.Inquiry()
 	if err != nil {
 		log.Fatal("SCSI Inquiry failed:", err)
 	}
-	parseInquiryData(inquiryData)
+	printInquiry(inquiry)
 
 	// Get capacity
 	fmt.Println("\n--- Read Capacity ---")
-	blockCount, blockSize, err := msc.ReadCapacity()
+	blockCount, blockSize, err := drive.ReadCapacity()
 	if err != nil {
 		log.Fatal("Read Capacity failed:", err)
 	}
@@ -196,27 +152,30 @@ func main() {
 
 	// Read first block (boot sector / MBR)
 	fmt.Println("\n--- Reading Block 0 (Boot Sector/MBR) ---")
-	block0, err := msc.ReadBlock(0, blockSize)
+	block0, err := drive.Read10(0, 1)
 	if err != nil {
 		log.Fatal("Failed to read block 0:", err)
 	}
 
 	fmt.Println("First 512 bytes of Block 0:")
-	hexdump(block0[:512])
-
-	// Check for MBR signature
-	if len(block0) >= 512 && block0[510] == 0x55 && block0[511] == 0xAA {
-		fmt.Println("\n✓ Valid MBR signature found (0x55AA)")
-
-		// Parse partition table
-		fmt.Println("\nPartition Table:")
-		for i := 0; i < 4; i++ {
-			offset := 446 + i*16
-			if block0[offset+4] != 0 { // Check if partition type is non-zero
-				fmt.Printf("Partition %d: Type=0x%02x, Start LBA=%d\n",
-					i+1,
-					block0[offset+4],
-					binary.LittleEndian.Uint32(block0[offset+8:offset+12]))
+	hexdump(block0[:min(len(block0), 512)])
+
+	fmt.Println("\n--- Partition Table ---")
+	partitions, err := msc.ReadPartitionTable(drive)
+	switch {
+	case errors.Is(err, msc.ErrNoPartitionTable):
+		fmt.Println("No partition table found")
+	case err != nil:
+		fmt.Println("Failed to read partition table:", err)
+	default:
+		for _, p := range partitions {
+			switch p.Scheme {
+			case msc.PartitionSchemeGPT:
+				fmt.Printf("Partition %d (GPT): Type=%s, Start LBA=%d, Blocks=%d, Name=%q\n",
+					p.Number, p.TypeGUID, p.StartLBA, p.Blocks, p.Name)
+			default:
+				fmt.Printf("Partition %d (MBR): Type=0x%02x, Start LBA=%d, Blocks=%d\n",
+					p.Number, p.MBRType, p.StartLBA, p.Blocks)
 			}
 		}
 	}
@@ -226,8 +185,8 @@ func main() {
 	possibleStarts := []uint32{63, 2048, 1} // Common partition start locations
 
 	for _, start := range possibleStarts {
-		if start < blockCount {
-			fatBlock, err := msc.ReadBlock(start, blockSize)
+		if uint64(start) < blockCount {
+			fatBlock, err := drive.Read10(start, 1)
 			if err == nil && len(fatBlock) >= 512 {
 				// Check for FAT signature
 				if fatBlock[510] == 0x55 && fatBlock[511] == 0xAA {
@@ -249,236 +208,83 @@ func main() {
 		}
 	}
 
-	fmt.Println("\n✓ Successfully read filesystem blocks from USB Mass Storage device")
-	fmt.Println("✓ go-usb library bulk transfer implementation verified")
-}
-
-// findMSCEndpoints finds the bulk IN and OUT endpoints for Mass Storage
-func findMSCEndpoints(handle *usb.DeviceHandle) (uint8, uint8, error) {
-	// For the SanDisk device, we know from lsusb:
-	// IN endpoint: 0x81
-	// OUT endpoint: 0x02
-	// But let's verify by reading the configuration
-
-	// Mass Storage devices typically use:
-	// - Bulk IN endpoint (0x81 or similar)
-	// - Bulk OUT endpoint (0x02 or similar)
-
-	return 0x81, 0x02, nil
-}
-
-// TestUnitReady sends a Test Unit Ready command
-func (m *MSCDevice) TestUnitReady() error {
-	cbw := CBW{
-		Signature:          CBW_SIGNATURE,
-		Tag:                m.tag,
-		DataTransferLength: 0,
-		Flags:              0x80, // Device to Host
-		LUN:                0,
-		CBLength:           6,
-	}
-	m.tag++
-
-	// SCSI Test Unit Ready command
-	cbw.CB[0] = SCSI_TEST_UNIT_READY
-
-	// Send CBW
-	cbwBytes := structToBytes(cbw)
-	_, err := m.handle.BulkTransfer(m.epOut, cbwBytes, 5*time.Second)
-	if err != nil {
-		return fmt.Errorf("failed to send CBW: %w", err)
-	}
-
-	// Receive CSW
-	cswBytes := make([]byte, 13)
-	_, err = m.handle.BulkTransfer(m.epIn, cswBytes, 5*time.Second)
-	if err != nil {
-		return fmt.Errorf("failed to receive CSW: %w", err)
-	}
-
-	var csw CSW
-	if err := bytesToStruct(cswBytes, &csw); err != nil {
-		return fmt.Errorf("failed to parse CSW: %w", err)
-	}
-
-	if csw.Status != 0 {
-		return fmt.Errorf("command failed with status: %d", csw.Status)
-	}
-
-	return nil
-}
-
-// Inquiry sends a SCSI Inquiry command
-func (m *MSCDevice) Inquiry() ([]byte, error) {
-	inquiryData := make([]byte, 36) // Standard inquiry data length
-
-	cbw := CBW{
-		Signature:          CBW_SIGNATURE,
-		Tag:                m.tag,
-		DataTransferLength: uint32(len(inquiryData)),
-		Flags:              0x80, // Device to Host
-		LUN:                0,
-		CBLength:           6,
-	}
-	m.tag++
-
-	// SCSI Inquiry command
-	cbw.CB[0] = SCSI_INQUIRY
-	cbw.CB[4] = byte(len(inquiryData))
-
-	// Send CBW
-	cbwBytes := structToBytes(cbw)
-	_, err := m.handle.BulkTransfer(m.epOut, cbwBytes, 5*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send CBW: %w", err)
-	}
-
-	// Receive inquiry data
-	n, err := m.handle.BulkTransfer(m.epIn, inquiryData, 5*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("failed to receive inquiry data: %w", err)
-	}
-
-	// Receive CSW
-	cswBytes := make([]byte, 13)
-	_, err = m.handle.BulkTransfer(m.epIn, cswBytes, 5*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("failed to receive CSW: %w", err)
-	}
-
-	var csw CSW
-	if err := bytesToStruct(cswBytes, &csw); err != nil {
-		return nil, fmt.Errorf("failed to parse CSW: %w", err)
-	}
-
-	if csw.Status != 0 {
-		return nil, fmt.Errorf("inquiry command failed with status: %d", csw.Status)
+	if *writePath != "" {
+		fmt.Println("\n--- Writing Image ---")
+		if err := writeImage(drive, *writePath, uint32(*writeLBA), blockCount, blockSize); err != nil {
+			log.Fatal("Write failed: ", err)
+		}
 	}
 
-	return inquiryData[:n], nil
+	fmt.Println("\n✓ Successfully read filesystem blocks from USB Mass Storage device")
+	fmt.Println("✓ go-usb library bulk transfer implementation verified")
 }
 
-// ReadCapacity sends a SCSI Read Capacity command
-func (m *MSCDevice) ReadCapacity() (uint32, uint32, error) {
-	capacityData := make([]byte, 8)
-
-	cbw := CBW{
-		Signature:          CBW_SIGNATURE,
-		Tag:                m.tag,
-		DataTransferLength: uint32(len(capacityData)),
-		Flags:              0x80, // Device to Host
-		LUN:                0,
-		CBLength:           10,
-	}
-	m.tag++
-
-	// SCSI Read Capacity command
-	cbw.CB[0] = SCSI_READ_CAPACITY
-
-	// Send CBW
-	cbwBytes := structToBytes(cbw)
-	_, err := m.handle.BulkTransfer(m.epOut, cbwBytes, 5*time.Second)
+// findMSCEndpoints finds the first Mass Storage interface of the active
+// configuration and its bulk IN and OUT endpoints
+func findMSCEndpoints(handle *usb.DeviceHandle) (uint8, uint8, uint8, error) {
+	config, err := handle.GetActiveConfigDescriptor()
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to send CBW: %w", err)
+		return 0, 0, 0, err
 	}
 
-	// Receive capacity data
-	_, err = m.handle.BulkTransfer(m.epIn, capacityData, 5*time.Second)
-	if err != nil {
-		return 0, 0, fmt.Errorf("failed to receive capacity data: %w", err)
+	ifaces := config.InterfacesWithClass(msc.CLASS_MASS_STORAGE)
+	if len(ifaces) == 0 {
+		return 0, 0, 0, fmt.Errorf("no Mass Storage interface")
 	}
-
-	// Receive CSW
-	cswBytes := make([]byte, 13)
-	_, err = m.handle.BulkTransfer(m.epIn, cswBytes, 5*time.Second)
-	if err != nil {
-		return 0, 0, fmt.Errorf("failed to receive CSW: %w", err)
+	iface := ifaces[0]
+	in, ok := config.Endpoint(iface, 0, usb.TransferTypeBulk, usb.EndpointDirectionIn)
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("interface %d has no bulk IN endpoint", iface)
 	}
-
-	var csw CSW
-	if err := bytesToStruct(cswBytes, &csw); err != nil {
-		return 0, 0, fmt.Errorf("failed to parse CSW: %w", err)
+	out, ok := config.Endpoint(iface, 0, usb.TransferTypeBulk, usb.EndpointDirectionOut)
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("interface %d has no bulk OUT endpoint", iface)
 	}
-
-	if csw.Status != 0 {
-		return 0, 0, fmt.Errorf("read capacity command failed with status: %d", csw.Status)
-	}
-
-	// Parse capacity data
-	maxLBA := binary.BigEndian.Uint32(capacityData[0:4])
-	blockSize := binary.BigEndian.Uint32(capacityData[4:8])
-
-	// maxLBA is the last valid block address, so total blocks = maxLBA + 1
-	return maxLBA + 1, blockSize, nil
+	return iface, in.EndpointAddr, out.EndpointAddr, nil
 }
 
-// ReadBlock reads a single block from the device
-func (m *MSCDevice) ReadBlock(lba uint32, blockSize uint32) ([]byte, error) {
-	data := make([]byte, blockSize)
-
-	cbw := CBW{
-		Signature:          CBW_SIGNATURE,
-		Tag:                m.tag,
-		DataTransferLength: blockSize,
-		Flags:              0x80, // Device to Host
-		LUN:                0,
-		CBLength:           10,
-	}
-	m.tag++
-
-	// SCSI Read(10) command
-	cbw.CB[0] = SCSI_READ_10
-	// LBA in big-endian
-	cbw.CB[2] = byte(lba >> 24)
-	cbw.CB[3] = byte(lba >> 16)
-	cbw.CB[4] = byte(lba >> 8)
-	cbw.CB[5] = byte(lba)
-	// Transfer length (1 block) in big-endian
-	cbw.CB[7] = 0
-	cbw.CB[8] = 1
-
-	// Send CBW
-	cbwBytes := structToBytes(cbw)
-	_, err := m.handle.BulkTransfer(m.epOut, cbwBytes, 5*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send CBW: %w", err)
-	}
+// writeChunkBlocks is how many blocks writeImage writes with each WRITE(10)
+const writeChunkBlocks = 128
 
-	// Receive data
-	n, err := m.handle.BulkTransfer(m.epIn, data, 5*time.Second)
+// writeImage writes the file at path to the drive starting at block lba,
+// padding the last block with zeros, and reads every chunk back to verify it
+func writeImage(drive *msc.Drive, path string, lba uint32, blockCount uint64, blockSize uint32) error {
+	image, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to receive data: %w", err)
+		return err
 	}
-
-	// Receive CSW
-	cswBytes := make([]byte, 13)
-	_, err = m.handle.BulkTransfer(m.epIn, cswBytes, 5*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("failed to receive CSW: %w", err)
+	if pad := len(image) % int(blockSize); pad != 0 {
+		image = append(image, make([]byte, int(blockSize)-pad)...)
 	}
-
-	var csw CSW
-	if err := bytesToStruct(cswBytes, &csw); err != nil {
-		return nil, fmt.Errorf("failed to parse CSW: %w", err)
+	blocks := uint32(len(image) / int(blockSize))
+	if uint64(lba)+uint64(blocks) > blockCount {
+		return fmt.Errorf("%d blocks at block %d do not fit the %d-block drive", blocks, lba, blockCount)
 	}
 
-	if csw.Status != 0 {
-		return nil, fmt.Errorf("read command failed with status: %d", csw.Status)
+	for done := uint32(0); done < blocks; {
+		count := min(blocks-done, writeChunkBlocks)
+		chunk := image[int(done)*int(blockSize) : int(done+count)*int(blockSize)]
+		if err := drive.WriteBlocks(lba+done, chunk); err != nil {
+			return fmt.Errorf("block %d: %w", lba+done, err)
+		}
+		readBack, err := drive.ReadBlocks(lba+done, uint16(count))
+		if err != nil {
+			return fmt.Errorf("verify block %d: %w", lba+done, err)
+		}
+		if !bytes.Equal(readBack, chunk) {
+			return fmt.Errorf("verify block %d: data read back differs", lba+done)
+		}
+		done += count
+		fmt.Printf("\rWritten %d/%d blocks", done, blocks)
 	}
-
-	return data[:n], nil
+	fmt.Printf("\n✓ Wrote and verified %d blocks at block %d\n", blocks, lba)
+	return nil
 }
 
-// parseInquiryData parses and displays SCSI Inquiry response
-func parseInquiryData(data []byte) {
-	if len(data) < 36 {
-		fmt.Printf("Inquiry data too short: %d bytes\n", len(data))
-		return
-	}
-
-	peripheralType := data[0] & 0x1F
-	fmt.Printf("Peripheral Device Type: 0x%02x ", peripheralType)
-	switch peripheralType {
+// printInquiry displays a SCSI Inquiry response
+func printInquiry(inquiry msc.InquiryData) {
+	fmt.Printf("Peripheral Device Type: 0x%02x ", inquiry.PeripheralType)
+	switch inquiry.PeripheralType {
 	case 0x00:
 		fmt.Println("(Direct-access device)")
 	case 0x05:
@@ -487,14 +293,9 @@ func parseInquiryData(data []byte) {
 		fmt.Println("(Other)")
 	}
 
-	// Extract vendor, product, and revision
-	vendor := string(bytes.TrimRight(data[8:16], " \x00"))
-	product := string(bytes.TrimRight(data[16:32], " \x00"))
-	revision := string(bytes.TrimRight(data[32:36], " \x00"))
-
-	fmt.Printf("Vendor: %s\n", vendor)
-	fmt.Printf("Product: %s\n", product)
-	fmt.Printf("Revision: %s\n", revision)
+	fmt.Printf("Vendor: %s\n", inquiry.Vendor)
+	fmt.Printf("Product: %s\n", inquiry.Product)
+	fmt.Printf("Revision: %s\n", inquiry.Revision)
 }
 
 // hexdump displays data in hex dump format
@@ -529,38 +330,20 @@ func hexdump(data []byte) {
 	}
 }
 
-// structToBytes converts a struct to bytes
-func structToBytes(v interface{}) []byte {
-	buf := new(bytes.Buffer)
-	binary.Write(buf, binary.LittleEndian, v)
-	return buf.Bytes()
-}
-
-// bytesToStruct converts bytes to a struct
-func bytesToStruct(data []byte, v interface{}) error {
-	buf := bytes.NewReader(data)
-	return binary.Read(buf, binary.LittleEndian, v)
-}
-
-// unbindDevice attempts to unbind the device from usb-storage kernel driver
-func unbindDevice() {
-	// Try to unbind any USB storage device from usb-storage driver
-	unbindPath := "/sys/bus/usb/drivers/usb-storage/unbind"
-
-	// Try common device bindings across different buses
-	for bus := 1; bus <= 8; bus++ {
-		for dev := 1; dev <= 4; dev++ {
-			binding := fmt.Sprintf("%d-%d:1.0", bus, dev)
-			err := os.WriteFile(unbindPath, []byte(binding), 0200)
-			if err == nil {
-				fmt.Printf("✓ Unbound device %s from usb-storage driver\n", binding)
-				time.Sleep(100 * time.Millisecond)
-				return
-			}
-		}
+// unbindDevice attempts to unbind Mass Storage interface iface from its kernel
+// driver, normally usb-storage
+func unbindDevice(device *usb.Device, iface uint8) {
+	driver, err := device.KernelDriverName(iface)
+	if err != nil {
+		return // No driver bound, or none that can be looked up here
 	}
-
-	// If we couldn't unbind, continue anyway - DetachKernelDriver might work
+	if err := device.UnbindKernelDriver(iface); err != nil {
+		// Continue anyway - DetachKernelDriver might work
+		fmt.Printf("Note: could not unbind %s driver: %v\n", driver, err)
+		return
+	}
+	fmt.Printf("✓ Unbound interface %d from %s driver\n", iface, driver)
+	time.Sleep(100 * time.Millisecond)
 }
 
 // listMassStorageDevices lists all USB Mass Storage devices
@@ -568,61 +351,33 @@ func listMassStorageDevices() {
 	fmt.Println("\nSearching for USB Mass Storage devices...")
 	fmt.Println()
 
-	devices, err := usb.DeviceList()
+	// Mass Storage is almost always declared at the interface level
+	devices, err := usb.DeviceListFunc(func(d *usb.Device) bool {
+		return d.HasClass(msc.CLASS_MASS_STORAGE)
+	})
 	if err != nil {
 		log.Fatal("Failed to get device list:", err)
 	}
 
-	found := false
 	for _, device := range devices {
-		// Check if it's a Mass Storage device
-		// Note: This is a simplified check - proper detection would need to
-		// parse configuration descriptors for interface class
-		if device.Descriptor.DeviceClass == MSC_CLASS ||
-			(device.Descriptor.DeviceClass == 0 && // Class defined at interface level
-				isMassStorageDevice(device)) {
-			found = true
-			fmt.Printf("Device: VID=%04x PID=%04x\n",
-				device.Descriptor.VendorID, device.Descriptor.ProductID)
-
-			// Try to get product name
-			if handle, err := device.Open(); err == nil {
-				if product, err := handle.StringDescriptor(device.Descriptor.ProductIndex); err == nil {
-					fmt.Printf("  Product: %s\n", product)
-				}
-				if manufacturer, err := handle.StringDescriptor(device.Descriptor.ManufacturerIndex); err == nil {
-					fmt.Printf("  Manufacturer: %s\n", manufacturer)
-				}
-				handle.Close()
+		fmt.Printf("Device: VID=%04x PID=%04x\n",
+			device.Descriptor.VendorID, device.Descriptor.ProductID)
+
+		// Try to get product name
+		if handle, err := device.Open(); err == nil {
+			if product, err := handle.StringDescriptor(device.Descriptor.ProductIndex); err == nil {
+				fmt.Printf("  Product: %s\n", product)
+			}
+			if manufacturer, err := handle.StringDescriptor(device.Descriptor.ManufacturerIndex); err == nil {
+				fmt.Printf("  Manufacturer: %s\n", manufacturer)
 			}
-			fmt.Println()
+			handle.Close()
 		}
+		fmt.Println()
 	}
 
-	if !found {
+	if len(devices) == 0 {
 		fmt.Println("No USB Mass Storage devices found.")
 		fmt.Println("Note: Some devices may not be detected if they're in use by the kernel.")
 	}
 }
-
-// isMassStorageDevice checks if a device might be a mass storage device
-func isMassStorageDevice(device *usb.Device) bool {
-	// This is a heuristic check - common vendor IDs for USB storage
-	knownStorageVendors := []uint16{
-		0x0781, // SanDisk
-		0x058f, // Alcor Micro
-		0x0930, // Toshiba
-		0x090c, // Silicon Motion
-		0x13fe, // Kingston
-		0x154b, // PNY
-		0x0951, // Kingston
-	}
-
-	for _, vendorID := range knownStorageVendors {
-		if device.Descriptor.VendorID == vendorID {
-			return true
-		}
-	}
-
-	return false
-}
@@ -6,61 +6,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	usb "github.com/kevmo314/go-usb"
+	"github.com/kevmo314/go-usb/uvc"
 )
 
-// UVC Class codes
+// UVC control selectors and requests
 const (
-	CC_VIDEO = 0x0E
-
-	// Video Interface Subclass Codes
-	SC_UNDEFINED                  = 0x00
-	SC_VIDEOCONTROL               = 0x01
-	SC_VIDEOSTREAMING             = 0x02
-	SC_VIDEO_INTERFACE_COLLECTION = 0x03
-
-	// Video Class-Specific Descriptor Types
-	CS_UNDEFINED     = 0x20
-	CS_DEVICE        = 0x21
-	CS_CONFIGURATION = 0x22
-	CS_STRING        = 0x23
-	CS_INTERFACE     = 0x24
-	CS_ENDPOINT      = 0x25
-
-	// Video Class-Specific VC Interface Descriptor Subtypes
-	VC_DESCRIPTOR_UNDEFINED = 0x00
-	VC_HEADER               = 0x01
-	VC_INPUT_TERMINAL       = 0x02
-	VC_OUTPUT_TERMINAL      = 0x03
-	VC_SELECTOR_UNIT        = 0x04
-	VC_PROCESSING_UNIT      = 0x05
-	VC_EXTENSION_UNIT       = 0x06
-
-	// Video Class-Specific VS Interface Descriptor Subtypes
-	VS_UNDEFINED           = 0x00
-	VS_INPUT_HEADER        = 0x01
-	VS_OUTPUT_HEADER       = 0x02
-	VS_STILL_IMAGE_FRAME   = 0x03
-	VS_FORMAT_UNCOMPRESSED = 0x04
-	VS_FRAME_UNCOMPRESSED  = 0x05
-	VS_FORMAT_MJPEG        = 0x06
-	VS_FRAME_MJPEG         = 0x07
-	VS_FORMAT_MPEG2TS      = 0x0A
-	VS_FORMAT_DV           = 0x0C
-	VS_COLORFORMAT         = 0x0D
-	VS_FORMAT_FRAME_BASED  = 0x10
-	VS_FRAME_FRAME_BASED   = 0x11
-	VS_FORMAT_STREAM_BASED = 0x12
-
-	// Terminal Types
-	TT_VENDOR_SPECIFIC        = 0x0100
-	TT_STREAMING              = 0x0101
-	ITT_VENDOR_SPECIFIC       = 0x0200
-	ITT_CAMERA                = 0x0201
-	ITT_MEDIA_TRANSPORT_INPUT = 0x0202
-
 	// USB Video Class Control Selectors
 	VC_CONTROL_UNDEFINED          = 0x00
 	VC_VIDEO_POWER_MODE_CONTROL   = 0x01
@@ -127,105 +81,13 @@ const (
 	UVC_CONTROL_CAP_ASYNC    = 0x10
 )
 
-// VideoControlHeader represents the VC Interface Header Descriptor
-type VideoControlHeader struct {
-	Length            uint8
-	DescriptorType    uint8
-	DescriptorSubtype uint8
-	BcdUVC            uint16
-	TotalLength       uint16
-	ClockFrequency    uint32
-	InCollection      uint8
-	// Followed by array of interface numbers
-}
-
-// InputTerminal represents the Input Terminal Descriptor
-type InputTerminal struct {
-	Length            uint8
-	DescriptorType    uint8
-	DescriptorSubtype uint8
-	TerminalID        uint8
-	TerminalType      uint16
-	AssocTerminal     uint8
-	Terminal          uint8
-	// Camera-specific fields follow for Camera Terminal
-}
-
-// CameraTerminal extends InputTerminal for Camera terminals
-type CameraTerminal struct {
-	InputTerminal
-	ObjectiveFocalLengthMin uint16
-	ObjectiveFocalLengthMax uint16
-	OcularFocalLength       uint16
-	ControlSize             uint8
-	// Controls bitmap follows
-}
-
-// ProcessingUnit represents the Processing Unit Descriptor
-type ProcessingUnit struct {
-	Length            uint8
-	DescriptorType    uint8
-	DescriptorSubtype uint8
-	UnitID            uint8
-	SourceID          uint8
-	MaxMultiplier     uint16
-	ControlSize       uint8
-	// Controls bitmap follows
-	// Processing field follows
-}
-
-// VideoStreamingHeader represents the VS Interface Input Header Descriptor
-type VideoStreamingHeader struct {
-	Length             uint8
-	DescriptorType     uint8
-	DescriptorSubtype  uint8
-	NumFormats         uint8
-	TotalLength        uint16
-	EndpointAddress    uint8
-	Info               uint8
-	TerminalLink       uint8
-	StillCaptureMethod uint8
-	TriggerSupport     uint8
-	TriggerUsage       uint8
-	ControlSize        uint8
-	// Controls follow
-}
-
-// FormatDescriptor represents format descriptors (uncompressed/MJPEG)
-type FormatDescriptor struct {
-	Length              uint8
-	DescriptorType      uint8
-	DescriptorSubtype   uint8
-	FormatIndex         uint8
-	NumFrameDescriptors uint8
-	// Format-specific fields follow
-}
-
-// FrameDescriptor represents frame descriptors
-type FrameDescriptor struct {
-	Length                  uint8
-	DescriptorType          uint8
-	DescriptorSubtype       uint8
-	FrameIndex              uint8
-	Capabilities            uint8
-	Width                   uint16
-	Height                  uint16
-	MinBitRate              uint32
-	MaxBitRate              uint32
-	MaxVideoFrameBufferSize uint32
-	DefaultFrameInterval    uint32
-	FrameIntervalType       uint8
-	// Frame intervals follow
-}
-
 type UVCDevice struct {
-	handle             *usb.DeviceHandle
-	device             *usb.Device
-	controlInterface   uint8
-	streamingInterface uint8
-	inputTerminalID    uint8
-	processingUnitID   uint8
-	outputTerminalID   uint8
+	handle           *usb.DeviceHandle
+	device           *usb.Device
+	descriptors      *uvc.Descriptors
+	controlInterface uint8
+	inputTerminalID  uint8
+	processingUnitID uint8
 }
 
 func main() {
@@ -235,6 +97,7 @@ func main() {
 		productID   = flag.String("pid", "", "USB Product ID in hex (e.g., 08e5 for C920)")
 		listDevices = flag.Bool("list", false, "List all UVC video devices")
 		autoDetect  = flag.Bool("auto", false, "Auto-detect any UVC webcam")
+		stillPath   = flag.String("still", "", "Capture a still image into this file")
 	)
 	flag.Parse()
 
@@ -263,9 +126,6 @@ func main() {
 
 		fmt.Printf("Looking for device VID:PID = %04x:%04x\n", vid, pid)
 
-		// Try to unbind from uvcvideo driver
-		unbindUVCDriver()
-
 		var err error
 		handle, err = usb.OpenDevice(vid, pid)
 		if err != nil {
@@ -284,9 +144,6 @@ func main() {
 		// Auto-detect any webcam
 		fmt.Println("Auto-detecting UVC webcam...")
 
-		// Try to unbind from uvcvideo driver
-		unbindUVCDriver()
-
 		var err error
 		handle, device, err = findAnyWebcamWithDevice()
 		if err != nil {
@@ -297,9 +154,6 @@ func main() {
 		fmt.Println("No device specified, trying Logitech C920 (046d:08e5)...")
 		fmt.Println("Use -list to see available devices, or -vid/-pid to specify a device")
 
-		// Try to unbind from uvcvideo driver
-		unbindUVCDriver()
-
 		var err error
 		handle, err = usb.OpenDevice(0x046d, 0x08e5)
 		if err != nil {
@@ -329,6 +183,9 @@ func main() {
 		log.Fatal("Could not find device in list")
 	}
 
+	// Unbind the uvcvideo driver from the video interfaces
+	unbindUVCDriver(device, handle)
+
 	// Display basic device info
 	fmt.Printf("\nDevice Information:\n")
 	fmt.Printf("  Vendor ID:  0x%04x\n", device.Descriptor.VendorID)
@@ -343,64 +200,65 @@ func main() {
 	}
 
 	// Create UVC device wrapper
-	uvc := &UVCDevice{
+	cam := &UVCDevice{
 		handle: handle,
 		device: device,
 	}
 
 	// Get and parse configuration descriptor to find UVC interfaces
 	fmt.Println("\n--- Analyzing UVC Descriptors ---")
-	if err := uvc.parseDescriptors(); err != nil {
+	if err := cam.parseDescriptors(); err != nil {
 		log.Printf("Warning: Failed to parse descriptors: %v", err)
 	}
 
-	// Try to detach kernel driver first
-	fmt.Printf("Attempting to detach kernel driver from interface %d...\n", uvc.controlInterface)
-	if err := handle.DetachKernelDriver(uvc.controlInterface); err != nil {
+	// Try to detach kernel driver first; uvcvideo is bound again when the
+	// handle is closed
+	fmt.Printf("Attempting to detach kernel driver from interface %d...\n", cam.controlInterface)
+	handle.SetReattachOnClose(true)
+	if err := handle.DetachKernelDriver(cam.controlInterface); err != nil {
 		fmt.Printf("Note: Kernel driver detach result: %v\n", err)
 	} else {
 		fmt.Println("✓ Detached kernel driver")
-		defer func() {
-			// Re-attach kernel driver when done
-			handle.AttachKernelDriver(uvc.controlInterface)
-		}()
 	}
 
 	// Try to claim the control interface
-	if err := handle.ClaimInterface(uvc.controlInterface); err != nil {
+	if err := handle.ClaimInterface(cam.controlInterface); err != nil {
 		fmt.Printf("Warning: Could not claim control interface: %v\n", err)
 		fmt.Println("Some controls may not be accessible.")
 	} else {
 		fmt.Println("✓ Claimed control interface")
-		defer handle.ReleaseInterface(uvc.controlInterface)
+		defer handle.ReleaseInterface(cam.controlInterface)
 	}
 
 	// Query camera controls
 	fmt.Println("\n--- Camera Controls ---")
-	uvc.queryControls()
+	cam.queryControls()
 
 	// Display supported formats
 	fmt.Println("\n--- Supported Video Formats ---")
-	uvc.displayFormats()
+	cam.displayFormats()
+
+	if *stillPath != "" {
+		fmt.Println("\n--- Still Image Capture ---")
+		cam.captureStill(*stillPath)
+	}
 
 	fmt.Println("\n✓ UVC device information retrieved successfully")
 }
 
 // findAnyWebcamWithDevice searches for any UVC device and returns handle and device
 func findAnyWebcamWithDevice() (*usb.DeviceHandle, *usb.Device, error) {
-	devices, err := usb.DeviceList()
+	devices, err := usb.DeviceListFunc(isWebcam)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	for _, device := range devices {
-		if isWebcam(device) {
-			handle, err := device.Open()
-			if err == nil {
-				fmt.Printf("Found webcam: VID=0x%04x PID=0x%04x\n",
-					device.Descriptor.VendorID, device.Descriptor.ProductID)
-				return handle, device, nil
-			}
+		handle, err := device.Open()
+		if err == nil {
+			fmt.Printf("Found webcam: VID=0x%04x PID=0x%04x\n",
+				device.Descriptor.VendorID, device.Descriptor.ProductID)
+			return handle, device, nil
 		}
 	}
 
@@ -409,109 +267,63 @@ func findAnyWebcamWithDevice() (*usb.DeviceHandle, *usb.Device, error) {
 
 // isWebcam checks if a device might be a webcam
 func isWebcam(device *usb.Device) bool {
-	// Check if device class is Video (0x0E) or Miscellaneous (0xEF) with IAD
-	if device.Descriptor.DeviceClass == CC_VIDEO {
-		return true
-	}
-	if device.Descriptor.DeviceClass == 0xEF &&
-		device.Descriptor.DeviceSubClass == 0x02 &&
-		device.Descriptor.DeviceProtocol == 0x01 {
-		// Miscellaneous device with Interface Association
-		return true
-	}
-	return false
+	// Video is declared either by the device or, for composite devices using
+	// Interface Association, by the interfaces
+	return device.HasClass(uvc.CC_VIDEO)
 }
 
 // parseDescriptors parses UVC-specific descriptors
 func (u *UVCDevice) parseDescriptors() error {
 	// Get configuration descriptor
-	config := make([]byte, 4096)
-	n, err := u.handle.ControlTransfer(
-		0x80,   // Device to host
-		0x06,   // GET_DESCRIPTOR
-		0x0200, // Configuration descriptor
-		0,
-		config,
-		5*time.Second,
-	)
+	config, err := u.handle.GetDescriptorChunked(usb.USB_DT_CONFIG, 0, 0)
 	if err != nil {
 		return fmt.Errorf("failed to get configuration descriptor: %w", err)
 	}
+	if err := usb.ValidateConfigLength(config); err != nil {
+		return err
+	}
 
-	config = config[:n]
-
-	// Parse configuration to find Video Control and Streaming interfaces
-	offset := 0
-	for offset < len(config) {
-		if offset+2 > len(config) {
-			break
+	parsed := &usb.ConfigDescriptor{}
+	if err := parsed.Unmarshal(config); err != nil {
+		return fmt.Errorf("failed to parse configuration descriptor: %w", err)
+	}
+	for _, col := range parsed.Collections() {
+		if col.FunctionClass == uvc.CC_VIDEO && len(col.Interfaces) >= 2 {
+			fmt.Println("✓ Found Video Interface Collection")
 		}
+	}
 
-		length := int(config[offset])
-		descType := config[offset+1]
+	d, err := uvc.ParseDescriptors(parsed)
+	if err != nil {
+		return err
+	}
+	u.descriptors = d
 
-		if length == 0 || offset+length > len(config) {
-			break
-		}
+	vc := d.Control
+	u.controlInterface = vc.Interface
+	fmt.Printf("✓ Found Video Control Interface: %d (UVC %x.%02x)\n", vc.Interface, vc.UVC>>8, vc.UVC&0xff)
+	for _, vs := range d.Streaming {
+		fmt.Printf("✓ Found Video Streaming Interface: %d\n", vs.Interface)
+	}
 
-		// Check for Interface Association Descriptor
-		if descType == 0x0B && length >= 8 {
-			functionClass := config[offset+4]
-			if functionClass == CC_VIDEO {
-				fmt.Println("✓ Found Video Interface Collection")
-				u.controlInterface = config[offset+2] // First interface
-				u.streamingInterface = config[offset+2] + 1
-			}
+	for _, it := range vc.InputTerminals {
+		fmt.Printf("  Input Terminal ID=%d, Type=0x%04x", it.ID, it.Type)
+		if it.Camera != nil {
+			fmt.Print(" (Camera)")
+			u.inputTerminalID = it.ID
+		} else if u.inputTerminalID == 0 {
+			u.inputTerminalID = it.ID
 		}
-
-		// Check for Interface Descriptor
-		if descType == 0x04 && length >= 9 {
-			interfaceClass := config[offset+5]
-			interfaceSubclass := config[offset+6]
-
-			if interfaceClass == CC_VIDEO {
-				if interfaceSubclass == SC_VIDEOCONTROL {
-					u.controlInterface = config[offset+2]
-					fmt.Printf("✓ Found Video Control Interface: %d\n", u.controlInterface)
-				} else if interfaceSubclass == SC_VIDEOSTREAMING {
-					u.streamingInterface = config[offset+2]
-					fmt.Printf("✓ Found Video Streaming Interface: %d\n", u.streamingInterface)
-				}
-			}
-		}
-
-		// Check for Class-specific VC Interface descriptors
-		if descType == CS_INTERFACE && offset+3 < len(config) {
-			subtype := config[offset+2]
-
-			switch subtype {
-			case VC_INPUT_TERMINAL:
-				if length >= 8 {
-					u.inputTerminalID = config[offset+3]
-					terminalType := binary.LittleEndian.Uint16(config[offset+4 : offset+6])
-					fmt.Printf("  Input Terminal ID=%d, Type=0x%04x", u.inputTerminalID, terminalType)
-					if terminalType == ITT_CAMERA {
-						fmt.Print(" (Camera)")
-					}
-					fmt.Println()
-				}
-
-			case VC_PROCESSING_UNIT:
-				if length >= 8 && u.processingUnitID == 0 { // Only set first one
-					u.processingUnitID = config[offset+3]
-					sourceID := config[offset+4]
-					fmt.Printf("  Processing Unit ID=%d, Source=%d\n", u.processingUnitID, sourceID)
-				}
-
-			case VC_OUTPUT_TERMINAL:
-				if length >= 9 {
-					u.outputTerminalID = config[offset+3]
-					fmt.Printf("  Output Terminal ID=%d\n", u.outputTerminalID)
-				}
-			}
+		fmt.Println()
+	}
+	for _, pu := range vc.ProcessingUnits {
+		fmt.Printf("  Processing Unit ID=%d, Source=%d\n", pu.ID, pu.SourceID)
+		if u.processingUnitID == 0 { // Only use the first one
+			u.processingUnitID = pu.ID
 		}
-
-		offset += length
+	}
+	for _, ot := range vc.OutputTerminals {
+		fmt.Printf("  Output Terminal ID=%d, Source=%d\n", ot.ID, ot.SourceID)
 	}
 
 	return nil
@@ -681,23 +493,109 @@ func (u *UVCDevice) getControl(unitID uint8, controlSelector uint8, request uint
 
 // displayFormats displays supported video formats
 func (u *UVCDevice) displayFormats() {
-	// This would require parsing the full configuration descriptor
-	// to extract VS_FORMAT and VS_FRAME descriptors
-	// For now, we'll show a simplified version
-
-	fmt.Println("\nNote: Full format parsing requires extended descriptor analysis")
-	fmt.Println("Common formats for UVC cameras:")
-	fmt.Println("  • YUV 4:2:2 (YUYV)")
-	fmt.Println("  • Motion-JPEG (MJPEG)")
-	fmt.Println("  • H.264 (if supported)")
-
-	fmt.Println("\nTypical resolutions:")
-	fmt.Println("  • 640x480 @ 30 fps")
-	fmt.Println("  • 1280x720 @ 30 fps")
-	fmt.Println("  • 1920x1080 @ 30 fps")
-
-	// Try to get video probe control to see current format
-	// This requires the streaming interface which may need different handling
+	if u.descriptors == nil || len(u.descriptors.Streaming) == 0 {
+		fmt.Println("No video streaming interfaces found")
+		return
+	}
+
+	for _, vs := range u.descriptors.Streaming {
+		fmt.Printf("\nStreaming interface %d (endpoint 0x%02x, still capture method %d):\n", vs.Interface, vs.EndpointAddress, vs.StillCaptureMethod)
+		for _, f := range vs.Formats {
+			fmt.Printf("  Format %d: %s\n", f.Index, formatName(&f))
+			for _, fr := range f.Frames {
+				fmt.Printf("    Frame %d: %dx%d @ %s\n", fr.Index, fr.Width, fr.Height, frameRates(&fr))
+			}
+			if f.Still != nil {
+				for i, size := range f.Still.Sizes {
+					fmt.Printf("    Still %d: %dx%d\n", i+1, size.Width, size.Height)
+				}
+			}
+		}
+	}
+}
+
+// captureStill takes a still image from the first streaming interface and
+// writes it to path
+func (u *UVCDevice) captureStill(path string) {
+	camera, err := uvc.NewCamera(u.handle)
+	if err != nil {
+		fmt.Printf("Could not set up still capture: %v\n", err)
+		return
+	}
+	stream := camera.Descriptors().Streaming[0]
+	if stream.StillCaptureMethod == 2 {
+		fmt.Println("Still capture method 2 sends the image among the video frames, which needs a running stream")
+		return
+	}
+	iface := stream.Interface
+	if err := u.handle.DetachKernelDriver(iface); err != nil {
+		fmt.Printf("Note: Kernel driver detach result: %v\n", err)
+	}
+	if err := u.handle.ClaimInterface(iface); err != nil {
+		fmt.Printf("Could not claim streaming interface %d: %v\n", iface, err)
+		return
+	}
+	defer u.handle.ReleaseInterface(iface)
+
+	image, err := camera.CaptureStill()
+	if err != nil {
+		fmt.Printf("Still capture failed: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(path, image, 0644); err != nil {
+		fmt.Printf("Could not write %s: %v\n", path, err)
+		return
+	}
+	fmt.Printf("✓ Wrote %d byte still image to %s\n", len(image), path)
+}
+
+// formatName describes a format descriptor
+func formatName(f *uvc.FormatDescriptor) string {
+	switch f.Subtype {
+	case uvc.VS_FORMAT_UNCOMPRESSED:
+		return fmt.Sprintf("Uncompressed %s, %d bits per pixel", printableFourCC(f), f.BitsPerPixel)
+	case uvc.VS_FORMAT_MJPEG:
+		return "Motion-JPEG (MJPEG)"
+	case uvc.VS_FORMAT_FRAME_BASED:
+		return fmt.Sprintf("Frame-based %s", printableFourCC(f))
+	case uvc.VS_FORMAT_MPEG2TS:
+		return "MPEG-2 TS"
+	case uvc.VS_FORMAT_DV:
+		return "DV"
+	case uvc.VS_FORMAT_STREAM_BASED:
+		return "Stream-based"
+	}
+	return fmt.Sprintf("Unknown subtype 0x%02x", f.Subtype)
+}
+
+// printableFourCC returns the FourCC of a format, or its full GUID if the
+// FourCC is not printable
+func printableFourCC(f *uvc.FormatDescriptor) string {
+	fourCC := f.FourCC()
+	for _, c := range fourCC {
+		if c < 0x20 || c > 0x7e {
+			return parseGUID(f.GUID[:])
+		}
+	}
+	return fourCC
+}
+
+// frameRates lists the frame rates of a frame descriptor
+func frameRates(f *uvc.FrameDescriptor) string {
+	fps := func(interval uint32) string {
+		if interval == 0 {
+			return "?"
+		}
+		return fmt.Sprintf("%.4g", 1e7/float64(interval))
+	}
+	if f.Continuous() {
+		return fmt.Sprintf("%s-%s fps", fps(f.MaxInterval), fps(f.MinInterval))
+	}
+	rates := make([]string, len(f.Intervals))
+	for i, interval := range f.Intervals {
+		rates[i] = fps(interval)
+	}
+	return strings.Join(rates, ", ") + " fps"
 }
 
 // Helper function to parse GUID
@@ -713,19 +611,27 @@ func parseGUID(data []byte) string {
 		data[10], data[11], data[12], data[13], data[14], data[15])
 }
 
-// unbindUVCDriver attempts to unbind the device from uvcvideo kernel driver
-func unbindUVCDriver() {
-	// Common bindings for webcams
-	unbindPath := "/sys/bus/usb/drivers/uvcvideo/unbind"
-	possibleBindings := []string{"1-8:1.0", "1-8:1.1", "1-7:1.0", "1-7:1.1"}
+// unbindUVCDriver attempts to unbind the video interfaces of the device from
+// the uvcvideo kernel driver
+func unbindUVCDriver(device *usb.Device, handle *usb.DeviceHandle) {
+	config, err := handle.GetActiveConfigDescriptor()
+	if err != nil {
+		return
+	}
 
-	for _, binding := range possibleBindings {
-		err := os.WriteFile(unbindPath, []byte(binding), 0200)
-		if err == nil {
-			fmt.Printf("✓ Unbound device %s from uvcvideo driver\n", binding)
-			time.Sleep(100 * time.Millisecond)
-			return
+	for _, iface := range config.Interfaces {
+		if len(iface.AltSettings) == 0 || iface.AltSettings[0].InterfaceClass != uvc.CC_VIDEO {
+			continue
+		}
+		number := iface.InterfaceNumber()
+		if driver, err := device.KernelDriverName(number); err != nil || driver != "uvcvideo" {
+			continue
 		}
+		if err := device.UnbindKernelDriver(number); err != nil {
+			fmt.Printf("Note: could not unbind interface %d from uvcvideo: %v\n", number, err)
+			continue
+		}
+		fmt.Printf("✓ Unbound interface %d from uvcvideo driver\n", number)
 	}
 }
 
@@ -734,43 +640,39 @@ func listUVCDevices() {
 	fmt.Println("\nSearching for UVC video devices...")
 	fmt.Println()
 
-	devices, err := usb.DeviceList()
+	devices, err := usb.DeviceListFunc(isWebcam)
 	if err != nil {
 		log.Fatal("Failed to get device list:", err)
 	}
 
-	found := false
 	for _, device := range devices {
-		if isWebcam(device) {
-			found = true
-			fmt.Printf("Device: VID=%04x PID=%04x\n",
-				device.Descriptor.VendorID, device.Descriptor.ProductID)
+		fmt.Printf("Device: VID=%04x PID=%04x\n",
+			device.Descriptor.VendorID, device.Descriptor.ProductID)
 
-			// Try to get product name
-			if handle, err := device.Open(); err == nil {
-				if product, err := handle.StringDescriptor(device.Descriptor.ProductIndex); err == nil {
-					fmt.Printf("  Product: %s\n", product)
-				}
-				if manufacturer, err := handle.StringDescriptor(device.Descriptor.ManufacturerIndex); err == nil {
-					fmt.Printf("  Manufacturer: %s\n", manufacturer)
-				}
-				if serial, err := handle.StringDescriptor(device.Descriptor.SerialNumberIndex); err == nil {
-					fmt.Printf("  Serial: %s\n", serial)
-				}
-				handle.Close()
+		// Try to get product name
+		if handle, err := device.Open(); err == nil {
+			if product, err := handle.StringDescriptor(device.Descriptor.ProductIndex); err == nil {
+				fmt.Printf("  Product: %s\n", product)
 			}
-
-			if device.Descriptor.DeviceClass == CC_VIDEO {
-				fmt.Println("  Type: USB Video Class device")
-			} else if device.Descriptor.DeviceClass == 0xEF {
-				fmt.Println("  Type: Composite device with video")
+			if manufacturer, err := handle.StringDescriptor(device.Descriptor.ManufacturerIndex); err == nil {
+				fmt.Printf("  Manufacturer: %s\n", manufacturer)
 			}
+			if serial, err := handle.StringDescriptor(device.Descriptor.SerialNumberIndex); err == nil {
+				fmt.Printf("  Serial: %s\n", serial)
+			}
+			handle.Close()
+		}
 
-			fmt.Println()
+		if device.Descriptor.DeviceClass == uvc.CC_VIDEO {
+			fmt.Println("  Type: USB Video Class device")
+		} else if device.Descriptor.DeviceClass == 0xEF {
+			fmt.Println("  Type: Composite device with video")
 		}
+
+		fmt.Println()
 	}
 
-	if !found {
+	if len(devices) == 0 {
 		fmt.Println("No UVC video devices found.")
 		fmt.Println("Note: Some devices may not be detected if they're in use by the kernel.")
 	}
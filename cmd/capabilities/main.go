@@ -70,16 +70,18 @@ func main() {
 		}
 
 		// Display USB version
-		usbVersion := dev.Descriptor.USBVersion
-		fmt.Printf("  USB Version: %x.%02x\n", (usbVersion>>8)&0xff, usbVersion&0xff)
+		fmt.Printf("  USB Version: %s\n", dev.Descriptor.USBVersionString())
 
 		// Display device speed
 		if speed, err := handle.Speed(); err == nil {
 			fmt.Printf("  Speed: %s\n", getSpeedString(speed))
 		}
 
-		// Try to get BOS descriptor (USB 3.0+)
-		bos, _, err := handle.ReadBOSDescriptor()
+		// Try to get BOS descriptor (USB 2.1+)
+		var bos *usb.BOSDescriptor
+		if handle.HasBOS() {
+			bos, _, err = handle.ReadBOSDescriptor()
+		}
 		if err == nil && bos != nil {
 			foundAny = true
 			fmt.Printf("  BOS Descriptor:\n")
@@ -137,7 +139,7 @@ func main() {
 		// Check for SuperSpeed endpoints in configurations
 		fmt.Printf("  Configurations with SuperSpeed endpoints:\n")
 		for configIdx := uint8(0); configIdx < dev.Descriptor.NumConfigurations; configIdx++ {
-			config, err := handle.ConfigDescriptorByValue(configIdx)
+			config, err := handle.ConfigDescriptorByIndex(configIdx)
 			if err != nil {
 				continue
 			}
@@ -208,8 +210,8 @@ func main() {
 	}
 
 	if !foundAny {
-		fmt.Println("\nNo USB 3.0+ devices with BOS descriptors found.")
-		fmt.Println("Try connecting a USB 3.0 device to a USB 3.0 port.")
+		fmt.Println("\nNo USB 2.1+ devices with BOS descriptors found.")
+		fmt.Println("Try connecting a USB 2.1 or USB 3.0 device.")
 	}
 }
 
@@ -63,22 +63,30 @@ func main() {
 
 		fmt.Printf("  Configurations: %d\n", dev.Descriptor.NumConfigurations)
 
+		// Current alternate settings only apply to the active configuration
+		activeConfig, _ := handle.Configuration()
+		activeAlts, _ := handle.ActiveAltSettings()
+
 		// Get each configuration descriptor
 		for configIdx := uint8(0); configIdx < dev.Descriptor.NumConfigurations; configIdx++ {
-			config, err := handle.ConfigDescriptorByValue(configIdx)
+			config, err := handle.ConfigDescriptorByIndex(configIdx)
 			if err != nil {
 				fmt.Printf("    Config %d: Error getting descriptor: %v\n", configIdx, err)
 				continue
 			}
 
-			printConfig(config, configIdx, *verbose)
+			var alts map[uint8]uint8
+			if int(config.ConfigurationValue) == activeConfig {
+				alts = activeAlts
+			}
+			printConfig(config, configIdx, alts, *verbose)
 		}
 
 		fmt.Println()
 	}
 }
 
-func printConfig(config *usb.ConfigDescriptor, index uint8, verbose bool) {
+func printConfig(config *usb.ConfigDescriptor, index uint8, activeAlts map[uint8]uint8, verbose bool) {
 	fmt.Printf("    Config %d:\n", index)
 	fmt.Printf("      Value: %d\n", config.ConfigurationValue)
 	fmt.Printf("      Attributes: 0x%02x", config.Attributes)
@@ -114,7 +122,11 @@ func printConfig(config *usb.ConfigDescriptor, index uint8, verbose bool) {
 		fmt.Printf("        Alternate Settings: %d\n", len(iface.AltSettings))
 
 		for _, alt := range iface.AltSettings {
-			fmt.Printf("        Alt Setting %d:\n", alt.AlternateSetting)
+			if active, ok := activeAlts[alt.InterfaceNumber]; ok && active == alt.AlternateSetting {
+				fmt.Printf("        Alt Setting %d (active):\n", alt.AlternateSetting)
+			} else {
+				fmt.Printf("        Alt Setting %d:\n", alt.AlternateSetting)
+			}
 			fmt.Printf("          Interface Number: %d\n", alt.InterfaceNumber)
 			fmt.Printf("          Class: 0x%02x", alt.InterfaceClass)
 			fmt.Printf(" (%s)\n", getClassName(alt.InterfaceClass))
@@ -174,55 +186,15 @@ func printEndpoint(ep *usb.Endpoint) {
 		fmt.Printf("              Attributes: 0x%02x\n", ep.SSCompanion.Attributes)
 		fmt.Printf("              BytesPerInterval: %d\n", ep.SSCompanion.BytesPerInterval)
 	}
+	if ep.SSPIsoCompanion != nil {
+		fmt.Printf("            SuperSpeedPlus Isochronous Companion:\n")
+		fmt.Printf("              BytesPerInterval: %d\n", ep.SSPIsoCompanion.BytesPerInterval)
+	}
 }
 
 func getClassName(class uint8) string {
-	switch class {
-	case 0x00:
-		return "Device"
-	case 0x01:
-		return "Audio"
-	case 0x02:
-		return "Communications"
-	case 0x03:
-		return "HID"
-	case 0x05:
-		return "Physical"
-	case 0x06:
-		return "Image"
-	case 0x07:
-		return "Printer"
-	case 0x08:
-		return "Mass Storage"
-	case 0x09:
-		return "Hub"
-	case 0x0a:
-		return "CDC Data"
-	case 0x0b:
-		return "Smart Card"
-	case 0x0d:
-		return "Content Security"
-	case 0x0e:
-		return "Video"
-	case 0x0f:
-		return "Personal Healthcare"
-	case 0x10:
-		return "Audio/Video"
-	case 0x11:
-		return "Billboard"
-	case 0x12:
-		return "USB Type-C Bridge"
-	case 0xdc:
-		return "Diagnostic"
-	case 0xe0:
-		return "Wireless"
-	case 0xef:
-		return "Miscellaneous"
-	case 0xfe:
-		return "Application Specific"
-	case 0xff:
-		return "Vendor Specific"
-	default:
-		return "Unknown"
+	if name := usb.ClassName(class); name != "" {
+		return name
 	}
+	return "Unknown"
 }
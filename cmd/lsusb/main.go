@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -146,16 +147,16 @@ func displayVerbose(devices []*usb.Device) {
 		fmt.Printf("Device Descriptor:\n")
 		fmt.Printf("  bLength             %5d\n", desc.Length)
 		fmt.Printf("  bDescriptorType     %5d\n", desc.DescriptorType)
-		fmt.Printf("  bcdUSB              %2d.%02d\n", desc.USBVersion>>8, desc.USBVersion&0xff)
+		fmt.Printf("  bcdUSB              %5s\n", desc.USBVersionString())
 		className := usb.ClassName(desc.DeviceClass)
 		if className != "" {
 			fmt.Printf("  bDeviceClass        %5d %s\n", desc.DeviceClass, className)
 		} else {
 			fmt.Printf("  bDeviceClass        %5d\n", desc.DeviceClass)
 		}
-		fmt.Printf("  bDeviceSubClass     %5d\n", desc.DeviceSubClass)
+		fmt.Printf("  bDeviceSubClass     %5d %s\n", desc.DeviceSubClass, usb.SubClassName(desc.DeviceClass, desc.DeviceSubClass))
 
-		protocolDesc := getProtocolDescription(desc.DeviceClass, desc.DeviceProtocol)
+		protocolDesc := getProtocolDescription(desc.DeviceClass, desc.DeviceSubClass, desc.DeviceProtocol)
 		if protocolDesc != "" {
 			fmt.Printf("  bDeviceProtocol     %5d %s\n", desc.DeviceProtocol, protocolDesc)
 		} else {
@@ -164,14 +165,18 @@ func displayVerbose(devices []*usb.Device) {
 		fmt.Printf("  bMaxPacketSize0     %5d\n", desc.MaxPacketSize0)
 		fmt.Printf("  idVendor           0x%04x %s\n", desc.VendorID, usb.VendorName(desc.VendorID))
 		fmt.Printf("  idProduct          0x%04x %s\n", desc.ProductID, usb.ProductName(desc.VendorID, desc.ProductID))
-		fmt.Printf("  bcdDevice           %2d.%02d\n", desc.DeviceVersion>>8, desc.DeviceVersion&0xff)
+		fmt.Printf("  bcdDevice           %5s\n", desc.DeviceVersionString())
 		fmt.Printf("  iManufacturer       %5d\n", desc.ManufacturerIndex)
 		fmt.Printf("  iProduct            %5d\n", desc.ProductIndex)
 		fmt.Printf("  iSerialNumber       %5d\n", desc.SerialNumberIndex)
 		fmt.Printf("  bNumConfigurations  %5d\n", desc.NumConfigurations)
 
-		// Try to open device for more info
+		// Try to open device for more info, falling back to a read-only
+		// handle for the descriptors when the node is not writable
 		handle, err := dev.Open()
+		if errors.Is(err, usb.ErrPermissionDenied) {
+			handle, err = dev.OpenReadOnly()
+		}
 		if err == nil {
 			defer handle.Close()
 
@@ -194,13 +199,15 @@ func displayVerbose(devices []*usb.Device) {
 				}
 			}
 
-			// Get configuration descriptor
-			for i := uint8(0); i < desc.NumConfigurations; i++ {
-				config, interfaces, endpoints, err := handle.ReadConfigDescriptor(i)
-				if err != nil {
-					continue
-				}
+			speed, err := handle.GetSpeed()
+			if err != nil {
+				speed = usb.SpeedUnknown
+			}
 
+			// Read every configuration in one pass; a device whose
+			// configurations can't be read just shows none
+			configs, _ := handle.Configurations()
+			for _, config := range configs {
 				fmt.Printf("  Configuration Descriptor:\n")
 				fmt.Printf("    bLength             %5d\n", config.Length)
 				fmt.Printf("    bDescriptorType     %5d\n", config.DescriptorType)
@@ -222,35 +229,37 @@ func displayVerbose(devices []*usb.Device) {
 
 				fmt.Printf("    MaxPower            %5dmA\n", config.MaxPower*2)
 
-				// Display interfaces
-				for _, iface := range interfaces {
-					fmt.Printf("    Interface Descriptor:\n")
-					fmt.Printf("      bLength             %5d\n", iface.Length)
-					fmt.Printf("      bDescriptorType     %5d\n", iface.DescriptorType)
-					fmt.Printf("      bInterfaceNumber    %5d\n", iface.InterfaceNumber)
-					fmt.Printf("      bAlternateSetting   %5d\n", iface.AlternateSetting)
-					fmt.Printf("      bNumEndpoints       %5d\n", iface.NumEndpoints)
-					fmt.Printf("      bInterfaceClass     %5d %s\n", iface.InterfaceClass, usb.ClassName(iface.InterfaceClass))
-					fmt.Printf("      bInterfaceSubClass  %5d\n", iface.InterfaceSubClass)
-					fmt.Printf("      bInterfaceProtocol  %5d\n", iface.InterfaceProtocol)
-					fmt.Printf("      iInterface          %5d\n", iface.InterfaceIndex)
-				}
-
-				// Display endpoints
-				for _, ep := range endpoints {
-					fmt.Printf("      Endpoint Descriptor:\n")
-					fmt.Printf("        bLength             %5d\n", ep.Length)
-					fmt.Printf("        bDescriptorType     %5d\n", ep.DescriptorType)
-					fmt.Printf("        bEndpointAddress     0x%02x  EP %d %s\n",
-						ep.EndpointAddr,
-						ep.EndpointAddr&0x7f,
-						getEndpointDirection(ep.EndpointAddr))
-					fmt.Printf("        bmAttributes         0x%02x\n", ep.Attributes)
-					fmt.Printf("          Transfer Type            %s\n", getTransferType(ep.Attributes))
-					fmt.Printf("          Synch Type               %s\n", getSynchType(ep.Attributes))
-					fmt.Printf("          Usage Type               %s\n", getUsageType(ep.Attributes))
-					fmt.Printf("        wMaxPacketSize     0x%04x\n", ep.MaxPacketSize)
-					fmt.Printf("        bInterval           %5d\n", ep.Interval)
+				// Display interfaces, each followed by its endpoints
+				for _, iface := range config.Interfaces {
+					for _, alt := range iface.AltSettings {
+						fmt.Printf("    Interface Descriptor:\n")
+						fmt.Printf("      bLength             %5d\n", alt.Length)
+						fmt.Printf("      bDescriptorType     %5d\n", alt.DescriptorType)
+						fmt.Printf("      bInterfaceNumber    %5d\n", alt.InterfaceNumber)
+						fmt.Printf("      bAlternateSetting   %5d\n", alt.AlternateSetting)
+						fmt.Printf("      bNumEndpoints       %5d\n", alt.NumEndpoints)
+						fmt.Printf("      bInterfaceClass     %5d %s\n", alt.InterfaceClass, usb.ClassName(alt.InterfaceClass))
+						fmt.Printf("      bInterfaceSubClass  %5d %s\n", alt.InterfaceSubClass, usb.SubClassName(alt.InterfaceClass, alt.InterfaceSubClass))
+						fmt.Printf("      bInterfaceProtocol  %5d %s\n", alt.InterfaceProtocol, getProtocolDescription(alt.InterfaceClass, alt.InterfaceSubClass, alt.InterfaceProtocol))
+						fmt.Printf("      iInterface          %5d\n", alt.InterfaceIndex)
+
+						for _, ep := range alt.Endpoints {
+							fmt.Printf("      Endpoint Descriptor:\n")
+							fmt.Printf("        bLength             %5d\n", ep.Length)
+							fmt.Printf("        bDescriptorType     %5d\n", ep.DescriptorType)
+							fmt.Printf("        bEndpointAddress     0x%02x  EP %d %s\n",
+								ep.EndpointAddr,
+								ep.EndpointNumber(),
+								usb.EndpointDirection(ep.EndpointAddr&0x80))
+							fmt.Printf("        bmAttributes         0x%02x\n", ep.Attributes)
+							fmt.Printf("          Transfer Type            %s\n", ep.TransferType())
+							fmt.Printf("          Synch Type               %s\n", ep.SyncType())
+							fmt.Printf("          Usage Type               %s\n", ep.UsageType())
+							fmt.Printf("        wMaxPacketSize     0x%04x\n", ep.MaxPacketSize)
+							fmt.Printf("        bInterval           %5d %s\n", ep.Interval,
+								usb.FormatInterval(ep.Interval, ep.TransferType(), speed))
+						}
+					}
 				}
 			}
 		} else if os.Getuid() != 0 {
@@ -260,107 +269,38 @@ func displayVerbose(devices []*usb.Device) {
 }
 
 func displayTree(devices []*usb.Device) {
-	// Group devices by bus
-	busMap := make(map[uint8][]*usb.Device)
+	// Only show devices that survived the filters
+	shown := make(map[*usb.Device]bool, len(devices))
+	var rootHubs []*usb.Device
 	for _, dev := range devices {
-		busMap[dev.Bus] = append(busMap[dev.Bus], dev)
-	}
-
-	// Sort buses
-	var buses []uint8
-	for bus := range busMap {
-		buses = append(buses, bus)
+		shown[dev] = true
+		if dev.Parent == nil && dev.IsRootHub() {
+			rootHubs = append(rootHubs, dev)
+		}
 	}
-	sort.Slice(buses, func(i, j int) bool {
-		return buses[i] < buses[j]
+	sort.Slice(rootHubs, func(i, j int) bool {
+		return rootHubs[i].Bus < rootHubs[j].Bus
 	})
 
 	// Display tree in lsusb format
-	for _, bus := range buses {
-		busDevices := busMap[bus]
-
-		// Sort devices by address
-		sort.Slice(busDevices, func(i, j int) bool {
-			return busDevices[i].Address < busDevices[j].Address
-		})
-
-		// Find root hub
-		var rootHub *usb.Device
-		var otherDevices []*usb.Device
-
-		for _, dev := range busDevices {
-			if dev.Address == 1 && dev.Descriptor.DeviceClass == 9 {
-				rootHub = dev
-			} else {
-				otherDevices = append(otherDevices, dev)
+	for _, rootHub := range rootHubs {
+		fmt.Printf("/:  Bus %03d.Port 001: Dev 001, Class=root_hub, Driver=%s/%dp, %s\n",
+			rootHub.Bus, getHostControllerDriver(rootHub), getMaxPorts(rootHub), getSpeedString(rootHub))
+		for _, child := range rootHub.Children {
+			if shown[child] {
+				displayDeviceTree(child, "    ", shown)
 			}
 		}
-
-		if rootHub != nil {
-			speed := getSpeedString(rootHub)
-			maxPorts := getMaxPorts(rootHub)
-
-			fmt.Printf("/:  Bus %03d.Port 001: Dev 001, Class=root_hub, Driver=xhci_hcd/%dp, %s\n",
-				bus, maxPorts, speed)
-
-			// Display connected devices
-			for _, dev := range otherDevices {
-				displayDeviceTree(dev, "    ")
-			}
-		}
-	}
-}
-
-func getEndpointDirection(addr uint8) string {
-	if addr&0x80 != 0 {
-		return "IN"
 	}
-	return "OUT"
 }
 
-func getTransferType(attr uint8) string {
-	switch attr & 0x03 {
-	case 0:
-		return "Control"
-	case 1:
-		return "Isochronous"
-	case 2:
-		return "Bulk"
-	case 3:
-		return "Interrupt"
+func getProtocolDescription(class, subClass, protocol uint8) string {
+	if name := usb.ProtocolName(class, subClass, protocol); name != "" {
+		return name
 	}
-	return "Unknown"
-}
 
-func getSynchType(attr uint8) string {
-	switch (attr >> 2) & 0x03 {
-	case 0:
-		return "None"
-	case 1:
-		return "Asynchronous"
-	case 2:
-		return "Adaptive"
-	case 3:
-		return "Synchronous"
-	}
-	return "Unknown"
-}
-
-func getUsageType(attr uint8) string {
-	switch (attr >> 4) & 0x03 {
-	case 0:
-		return "Data"
-	case 1:
-		return "Feedback"
-	case 2:
-		return "Implicit feedback"
-	case 3:
-		return "Reserved"
-	}
-	return "Unknown"
-}
-
-func getProtocolDescription(class, protocol uint8) string {
+	// Fall back to the protocols lsusb most often shows when there is no
+	// usb.ids on the system
 	switch class {
 	case 9: // Hub
 		switch protocol {
@@ -423,72 +363,113 @@ func getMaxPorts(dev *usb.Device) int {
 	return 4 // Default fallback
 }
 
+// getSysfsDeviceName rebuilds the sysfs name of a device, such as "3-2.1",
+// from the chain of ports between it and its root hub
 func getSysfsDeviceName(dev *usb.Device) string {
-	if dev.Address == 1 {
+	if dev.Parent == nil {
 		return fmt.Sprintf("usb%d", dev.Bus)
 	}
-	// For non-root devices, we'd need to parse the topology
-	// This is simplified - real implementation would need to track ports
-	return fmt.Sprintf("%d-%d", dev.Bus, dev.Address-1)
+	var ports []string
+	for d := dev; d.Parent != nil; d = d.Parent {
+		ports = append([]string{strconv.Itoa(int(d.Port))}, ports...)
+	}
+	return fmt.Sprintf("%d-%s", dev.Bus, strings.Join(ports, "."))
+}
+
+// getHostControllerDriver returns the driver of the host controller a root
+// hub belongs to, such as xhci_hcd
+func getHostControllerDriver(rootHub *usb.Device) string {
+	sysfsPath, err := filepath.EvalSymlinks(fmt.Sprintf("/sys/bus/usb/devices/%s", getSysfsDeviceName(rootHub)))
+	if err != nil {
+		return "[unknown]"
+	}
+	return getDriverName(filepath.Join(filepath.Dir(sysfsPath), "driver"))
+}
+
+// getDriverName returns the name of the driver a sysfs driver link points
+// to, or "" if nothing is bound
+func getDriverName(link string) string {
+	target, err := os.Readlink(link)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// treeInterface is an interface of the active configuration as lsusb -t
+// lists it
+type treeInterface struct {
+	number uint8
+	class  uint8
+	driver string
+}
+
+// getTreeInterfaces reads the interfaces of the active configuration and
+// their drivers from the interface directories sysfs creates for them
+func getTreeInterfaces(dev *usb.Device) []treeInterface {
+	name := getSysfsDeviceName(dev)
+	dirs, _ := filepath.Glob(fmt.Sprintf("/sys/bus/usb/devices/%s:*", name))
+
+	var ifaces []treeInterface
+	for _, dir := range dirs {
+		number, err1 := readSysfsHex(filepath.Join(dir, "bInterfaceNumber"))
+		class, err2 := readSysfsHex(filepath.Join(dir, "bInterfaceClass"))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		ifaces = append(ifaces, treeInterface{
+			number: number,
+			class:  class,
+			driver: getDriverName(filepath.Join(dir, "driver")),
+		})
+	}
+	sort.Slice(ifaces, func(i, j int) bool {
+		return ifaces[i].number < ifaces[j].number
+	})
+	return ifaces
+}
+
+func readSysfsHex(path string) (uint8, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 8)
+	return uint8(value), err
 }
 
-func displayDeviceTree(dev *usb.Device, indent string) {
-	className := getDeviceClassName(dev.Descriptor.DeviceClass)
+// displayDeviceTree prints a line for every interface of dev, like lsusb -t,
+// and then the devices on its ports one level deeper
+func displayDeviceTree(dev *usb.Device, indent string, shown map[*usb.Device]bool) {
 	speed := getSpeedString(dev)
 
-	// For now, use a simplified port number (would need proper topology parsing)
-	portNum := int(dev.Address) - 1
-	if portNum < 1 {
-		portNum = 1
+	ifaces := getTreeInterfaces(dev)
+	if len(ifaces) == 0 {
+		// Unconfigured, or the interfaces are not visible
+		ifaces = []treeInterface{{class: dev.Descriptor.DeviceClass}}
+	}
+	for _, iface := range ifaces {
+		driver := iface.driver
+		switch {
+		case driver == "":
+			driver = "[none]"
+		case driver == "hub":
+			driver = fmt.Sprintf("hub/%dp", getMaxPorts(dev))
+		}
+		fmt.Printf("%s|__ Port %03d: Dev %03d, If %d, Class=%s, Driver=%s, %s\n",
+			indent, dev.Port, dev.Address, iface.number, getDeviceClassName(iface.class), driver, speed)
 	}
 
-	fmt.Printf("%s|__ Port %03d: Dev %03d, If 0, Class=%s, Driver=[unknown], %s\n",
-		indent, portNum, dev.Address, className, speed)
+	for _, child := range dev.Children {
+		if shown[child] {
+			displayDeviceTree(child, indent+"    ", shown)
+		}
+	}
 }
 
 func getDeviceClassName(class uint8) string {
-	switch class {
-	case 0:
-		return "Use class info in Interface Descriptors"
-	case 1:
-		return "Audio"
-	case 2:
-		return "Communications"
-	case 3:
-		return "Human Interface Device"
-	case 5:
-		return "Physical"
-	case 6:
-		return "Image"
-	case 7:
-		return "Printer"
-	case 8:
-		return "Mass Storage"
-	case 9:
-		return "Hub"
-	case 10:
-		return "CDC Data"
-	case 11:
-		return "Smart Card"
-	case 13:
-		return "Content Security"
-	case 14:
-		return "Video"
-	case 15:
-		return "Personal Healthcare"
-	case 16:
-		return "Audio/Video Devices"
-	case 220:
-		return "Diagnostic"
-	case 224:
-		return "Wireless"
-	case 239:
-		return "Miscellaneous Device"
-	case 254:
-		return "Application Specific"
-	case 255:
-		return "Vendor Specific"
-	default:
-		return fmt.Sprintf("Unknown(%d)", class)
+	if name := usb.ClassName(class); name != "" {
+		return name
 	}
+	return fmt.Sprintf("Unknown(%d)", class)
 }
@@ -1,12 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"time"
 
 	usb "github.com/kevmo314/go-usb"
+	"github.com/kevmo314/go-usb/pd"
 )
 
 func main() {
@@ -58,20 +59,11 @@ func main() {
 }
 
 func findOTGDevices() []*usb.Device {
-	devices, err := usb.DeviceList()
+	otgDevices, err := usb.DeviceListFunc(isOTGCapable)
 	if err != nil {
 		log.Printf("Failed to get device list: %v", err)
 		return nil
 	}
-
-	var otgDevices []*usb.Device
-
-	for _, dev := range devices {
-		if isOTGCapable(dev) {
-			otgDevices = append(otgDevices, dev)
-		}
-	}
-
 	return otgDevices
 }
 
@@ -227,23 +219,19 @@ func classifyOTGRole(class, subclass uint8) string {
 }
 
 func findAltModeDevices() []*usb.Device {
-	devices, err := usb.DeviceList()
+	altModeDevices, err := usb.DeviceListFunc(isAltModeCapable)
 	if err != nil {
 		return nil
 	}
-
-	var altModeDevices []*usb.Device
-
-	for _, dev := range devices {
-		if isAltModeCapable(dev) {
-			altModeDevices = append(altModeDevices, dev)
-		}
-	}
-
 	return altModeDevices
 }
 
 func isAltModeCapable(dev *usb.Device) bool {
+	// Billboard devices report their alternate modes
+	if pd.IsBillboard(dev) {
+		return true
+	}
+
 	desc := dev.Descriptor
 
 	// Look for USB-C indicators:
@@ -286,9 +274,8 @@ func analyzeAltModeDevice(dev *usb.Device) {
 	}
 	defer handle.Close()
 
-	fmt.Printf("   📊 USB %d.%d, Class: %d\n",
-		dev.Descriptor.USBVersion>>8, (dev.Descriptor.USBVersion&0xF0)>>4,
-		dev.Descriptor.DeviceClass)
+	fmt.Printf("   📊 USB %s, Class: %d\n",
+		dev.Descriptor.USBVersionString(), dev.Descriptor.DeviceClass)
 
 	// Try to read BOS descriptor (USB 3.0+ feature)
 	if _, caps, err := handle.ReadBOSDescriptor(); err == nil {
@@ -307,8 +294,8 @@ func analyzeAltModeDevice(dev *usb.Device) {
 	// Check if device supports advanced features
 	analyzeAltModeCapabilities(handle)
 
-	// Simulate DisplayPort Alt Mode detection
-	simulateDisplayPortDetection(handle)
+	// Report the alternate modes from the Billboard capability
+	reportAlternateModes(handle)
 }
 
 func getCapabilityName(capType uint8) string {
@@ -320,6 +307,8 @@ func getCapabilityName(capType uint8) string {
 		0x05: "Platform",
 		0x06: "Power Delivery",
 		0x0A: "SuperSpeedPlus USB",
+		0x0D: "Billboard",
+		0x0F: "Billboard Alternate Mode",
 	}
 
 	if name, ok := names[capType]; ok {
@@ -363,60 +352,53 @@ func analyzeAltModeCapabilities(handle *usb.DeviceHandle) {
 	}
 }
 
-func simulateDisplayPortDetection(handle *usb.DeviceHandle) {
-	fmt.Printf("   🖥️  Simulating DisplayPort Alt Mode detection...\n")
-
-	// In a real implementation, this would involve:
-	// 1. USB Power Delivery communication
-	// 2. Structured VDM (Vendor Defined Message) exchange
-	// 3. SVID discovery and mode negotiation
-
-	// For demo purposes, we'll check device characteristics
-	device := handle.Device()
-
-	// Simulate VDM discovery based on device properties
-	if device.Descriptor.USBVersion >= 0x0300 {
-		fmt.Printf("      📡 USB 3.0+ detected - Alt Mode communication possible\n")
-
-		// Simulate discovering DisplayPort SVID
-		fmt.Printf("      🔍 Discovering Structured VDM support...\n")
-		time.Sleep(100 * time.Millisecond) // Simulate communication delay
-
-		// Check if device might support DisplayPort
-		if couldSupportDisplayPort(device) {
-			fmt.Printf("      🎯 DisplayPort Alt Mode potentially supported!\n")
-			fmt.Printf("         Pin assignments: C, D, E (simulated)\n")
-			fmt.Printf("         Max resolution: 4K@60Hz (simulated)\n")
-			fmt.Printf("         Multi-function: Yes (simulated)\n")
-		} else {
-			fmt.Printf("      ❌ DisplayPort Alt Mode not detected\n")
-		}
-	} else {
-		fmt.Printf("      ⚠️  USB 2.0 device - Alt Mode requires USB 3.0+\n")
+func reportAlternateModes(handle *usb.DeviceHandle) {
+	billboard, err := pd.ReadBillboard(handle)
+	if errors.Is(err, usb.ErrNotFound) {
+		fmt.Printf("   🖥️  No Billboard capability - the device doesn't report alternate modes\n")
+		return
+	} else if err != nil {
+		fmt.Printf("   ⚠️  Could not read Billboard capability: %v\n", err)
+		return
 	}
-}
 
-func couldSupportDisplayPort(device *usb.Device) bool {
-	// Heuristics for DisplayPort Alt Mode capability
-	desc := device.Descriptor
-
-	// Hub devices often support Alt Mode
-	if desc.DeviceClass == 9 {
-		return true
+	fmt.Printf("   🖥️  Billboard %x.%02x: %d alternate mode(s)\n",
+		billboard.Version>>8, billboard.Version&0xff, len(billboard.AlternateModes))
+	if billboard.AdditionalInfoURL != "" {
+		fmt.Printf("      More information: %s\n", billboard.AdditionalInfoURL)
 	}
-
-	// High-speed devices with multiple configurations
-	if desc.USBVersion >= 0x0300 && desc.NumConfigurations > 1 {
-		return true
+	if billboard.AdditionalFailureInfo&pd.FailureInsufficientPower != 0 {
+		fmt.Printf("      ⚠️  Insufficient power to enter alternate modes\n")
+	}
+	if billboard.AdditionalFailureInfo&pd.FailurePDCommunication != 0 {
+		fmt.Printf("      ⚠️  USB PD communication failed\n")
 	}
 
-	// Known DisplayPort-capable vendors (example)
-	dpVendors := []uint16{0x17EF, 0x2109, 0x0BDA}
-	for _, vendor := range dpVendors {
-		if desc.VendorID == vendor {
-			return true
+	for i, mode := range billboard.AlternateModes {
+		name := svidName(mode.SVID)
+		if mode.String != "" {
+			name = fmt.Sprintf("%s, \"%s\"", name, mode.String)
+		}
+		preferred := ""
+		if uint8(i) == billboard.PreferredAlternateMode {
+			preferred = " (preferred)"
+		}
+		fmt.Printf("      Mode %d: SVID 0x%04x (%s), mode %d: %s%s\n",
+			i, mode.SVID, name, mode.Mode, mode.State, preferred)
+
+		if caps, ok := mode.DisplayPort(); ok {
+			fmt.Printf("         🎯 DisplayPort sink: %v, source: %v\n", caps.UFPD(), caps.DFPD())
+			fmt.Printf("         Pin assignments: %s\n", pd.PinAssignmentString(caps.UFPDPinAssignments()|caps.DFPDPinAssignments()))
 		}
 	}
+}
 
-	return false
+func svidName(svid uint16) string {
+	switch svid {
+	case pd.SVID_DISPLAYPORT:
+		return "DisplayPort"
+	case pd.SVID_THUNDERBOLT:
+		return "Thunderbolt"
+	}
+	return "Unknown"
 }
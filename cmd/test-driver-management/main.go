@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
 	usb "github.com/kevmo314/go-usb"
+	"github.com/kevmo314/go-usb/hid"
 )
 
 func main() {
@@ -17,7 +19,7 @@ func main() {
 	fmt.Println("🔧 USB Driver Management Test")
 	fmt.Println("==============================")
 
-	devices, err := usb.DeviceList()
+	devices, err := usb.DeviceList(usb.WithoutRootHubs())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -29,11 +31,6 @@ func main() {
 	successfulTests := 0
 
 	for i, dev := range devices {
-		// Skip root hubs
-		if dev.Descriptor.DeviceClass == 9 {
-			continue
-		}
-
 		fmt.Printf("\n🔍 Testing Device %d: %04x:%04x\n", i,
 			dev.Descriptor.VendorID, dev.Descriptor.ProductID)
 
@@ -159,24 +156,17 @@ func testDriverManagement(dev *usb.Device) bool {
 	return true
 }
 
+// getDriverName returns the kernel driver bound to iface, or "" if there is
+// none or it cannot be queried
 func getDriverName(handle *usb.DeviceHandle, iface uint8) string {
-	// Try to get driver name using USBDEVFS_GETDRIVER
-	// This is a simplified version - real implementation would use the ioctl
-
-	// For now, we'll check if claiming fails with EBUSY
-	err := handle.ClaimInterface(iface)
+	name, err := handle.GetKernelDriver(iface)
 	if err != nil {
-		// If EBUSY, a driver is attached
-		if err.Error() == "device or resource busy" {
-			return "unknown_driver"
+		if !errors.Is(err, usb.ErrNoDriver) {
+			fmt.Printf("   ⚠️  Could not query driver: %v\n", err)
 		}
-	} else {
-		// No driver was attached, release the interface
-		handle.ReleaseInterface(iface)
 		return ""
 	}
-
-	return ""
+	return name
 }
 
 func testInterfaceOperations(handle *usb.DeviceHandle, iface uint8) {
@@ -190,22 +180,18 @@ func testInterfaceOperations(handle *usb.DeviceHandle, iface uint8) {
 		fmt.Printf("      📊 Current alternate setting: %d\n", altSetting)
 	}
 
-	// Try a control transfer on the interface
-	buf := make([]byte, 8)
-	n, err := handle.ControlTransfer(
-		0x81,   // Interface IN request
-		0x06,   // GET_DESCRIPTOR
-		0x2200, // HID Report descriptor (example)
-		uint16(iface),
-		buf,
-		1*time.Second,
-	)
-
-	if err != nil {
-		// This is expected to fail for non-HID devices
-		fmt.Printf("      ℹ️  Control transfer test: %v (expected for non-HID)\n", err)
+	// Read the report descriptor of HID interfaces
+	if hidIface, err := hid.New(handle, iface); err != nil {
+		fmt.Printf("      ℹ️  Not a HID interface: %v\n", err)
+	} else if desc, err := hidIface.GetReportDescriptor(); err != nil {
+		fmt.Printf("      ⚠️  Could not read HID report descriptor: %v\n", err)
+	} else if report, err := hid.ParseReportDescriptor(desc); err != nil {
+		fmt.Printf("      ⚠️  Could not parse HID report descriptor: %v\n", err)
 	} else {
-		fmt.Printf("      ✅ Control transfer successful: %d bytes\n", n)
+		fmt.Printf("      ✅ HID report descriptor: %d bytes, usage pages %#x\n", len(desc), report.UsagePages)
+		for _, r := range report.Reports {
+			fmt.Printf("         %s report %d: %d bytes\n", r.Type, r.ID, r.Size())
+		}
 	}
 
 	// Test setting the same configuration (should be safe)
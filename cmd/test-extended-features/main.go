@@ -18,7 +18,7 @@ func main() {
 	fmt.Println("==============================")
 
 	// Get device list
-	devices, err := usb.DeviceList()
+	devices, err := usb.DeviceList(usb.WithoutRootHubs())
 	if err != nil {
 		log.Fatalf("Failed to get device list: %v", err)
 	}
@@ -34,11 +34,6 @@ func main() {
 			break
 		}
 
-		// Skip root hubs
-		if dev.Descriptor.DeviceClass == 9 {
-			continue
-		}
-
 		fmt.Printf("\n🔍 Testing Device %d: %04x:%04x\n", i, dev.Descriptor.VendorID, dev.Descriptor.ProductID)
 
 		handle, err := dev.Open()
@@ -129,13 +124,23 @@ func testExtendedFeatures(handle *usb.DeviceHandle, deviceIndex int) {
 			} else {
 				fmt.Printf("      Capability %d: Type 0x%02x\n", i, cap.DevCapabilityType)
 			}
+
+			if id, ok := cap.ContainerID(); ok {
+				fmt.Printf("         Container ID: %x\n", id)
+			} else if platform, ok := cap.PlatformCapability(); ok {
+				fmt.Printf("         Platform UUID: %x, %d bytes of data\n", platform.UUID, len(platform.CapabilityData))
+			} else if ssp, ok := cap.SuperSpeedPlus(); ok {
+				for _, attr := range ssp.SublinkSpeedAttributes {
+					fmt.Printf("         Sublink speed %d: %d Mb/s per lane\n", attr.ID(), attr.LaneSpeed()/1_000_000)
+				}
+			}
 		}
 	}
 
 	// Test 5: Try to read Device Qualifier (USB 2.0+ only)
 	if qual, err := handle.ReadDeviceQualifierDescriptor(); err == nil {
-		fmt.Printf("   📄 Device qualifier: USB %d.%d, Class %d\n",
-			qual.USBVersion>>8, (qual.USBVersion&0xFF)/16, qual.DeviceClass)
+		fmt.Printf("   📄 Device qualifier: USB %s, Class %d\n",
+			qual.USBVersionString(), qual.DeviceClass)
 	}
 
 	// Test 6: Zero-length packet transfer test
@@ -164,11 +169,13 @@ func testZeroLengthPackets(handle *usb.DeviceHandle, deviceIndex int) {
 func testErrorRecovery(handle *usb.DeviceHandle, deviceIndex int) {
 	fmt.Printf("   🔧 Testing error recovery mechanisms...\n")
 
-	// Test endpoint reset
+	// Test endpoint reset (host side only, the device is not told)
 	if err := handle.ResetEndpoint(0x81); err == nil {
 		fmt.Printf("      ✅ Endpoint reset successful\n")
 	} else if err == usb.ErrNotSupported {
 		fmt.Printf("      ⚠️  Endpoint reset not supported\n")
+	} else {
+		fmt.Printf("      ❌ Endpoint reset failed: %v\n", err)
 	}
 
 	// Test interrupt transfer with retry
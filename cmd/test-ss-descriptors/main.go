@@ -16,7 +16,7 @@ func main() {
 	fmt.Println("SuperSpeed Descriptor Test")
 	fmt.Println("==========================")
 
-	devices, err := usb.DeviceList()
+	devices, err := usb.DeviceList(usb.WithoutRootHubs())
 	if err != nil {
 		log.Fatalf("Failed to get device list: %v", err)
 	}
@@ -24,11 +24,6 @@ func main() {
 	fmt.Printf("\nFound %d USB devices\n", len(devices))
 
 	for _, dev := range devices {
-		// Skip root hubs
-		if dev.Descriptor.DeviceClass == 9 {
-			continue
-		}
-
 		fmt.Printf("\nDevice: %04x:%04x\n", dev.Descriptor.VendorID, dev.Descriptor.ProductID)
 
 		handle, err := dev.Open()
@@ -99,8 +94,7 @@ func main() {
 
 		// Test Device Qualifier (USB 2.0+ devices)
 		if qual, err := handle.ReadDeviceQualifierDescriptor(); err == nil {
-			fmt.Printf("  Device Qualifier: USB %d.%d\n",
-				qual.USBVersion>>8, (qual.USBVersion&0xFF)>>4)
+			fmt.Printf("  Device Qualifier: USB %s\n", qual.USBVersionString())
 		}
 	}
 
@@ -111,7 +105,7 @@ func testSSDescriptors(handle *usb.DeviceHandle) {
 	fmt.Println("  Testing SuperSpeed descriptors...")
 
 	// Get first configuration
-	config, err := handle.ConfigDescriptorByValue(0)
+	config, err := handle.ConfigDescriptorByIndex(0)
 	if err != nil {
 		fmt.Printf("    Error getting config: %v\n", err)
 		return
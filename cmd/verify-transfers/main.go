@@ -108,7 +108,7 @@ func testControlTransfers(devices []*usb.Device) bool {
 
 	for i, dev := range devices {
 		// Skip root hubs for this test
-		if dev.Descriptor.DeviceClass == 9 {
+		if dev.IsRootHub() {
 			continue
 		}
 
@@ -163,7 +163,7 @@ func testInterfaceManagement(devices []*usb.Device) bool {
 
 	for i, dev := range devices {
 		// Skip root hubs and devices without configurations
-		if dev.Descriptor.DeviceClass == 9 || dev.Descriptor.NumConfigurations == 0 {
+		if dev.IsRootHub() || dev.Descriptor.NumConfigurations == 0 {
 			continue
 		}
 
@@ -226,7 +226,7 @@ func testAsyncTransfers(devices []*usb.Device) bool {
 	for i, dev := range devices {
 		// Look for devices that might support async transfers
 		// Skip root hubs
-		if dev.Descriptor.DeviceClass == 9 {
+		if dev.IsRootHub() {
 			continue
 		}
 
@@ -20,17 +20,20 @@ func (h *DeviceHandle) Configuration() (int, error) {
 	return h.GetConfiguration()
 }
 
-// ConfigDescriptorByValue gets a configuration descriptor by value
-func (h *DeviceHandle) ConfigDescriptorByValue(value uint8) (*ConfigDescriptor, error) {
-	// On macOS, we'll use index-based lookup
-	// This is a simplification - ideally we'd iterate to find the right config
-	return h.GetConfigDescriptor(value - 1)
+// GetConfigurationForce gets the current configuration. macOS has no cached
+// value to bypass, so this is the same as GetConfiguration.
+func (h *DeviceHandle) GetConfigurationForce() (int, error) {
+	return h.GetConfiguration()
 }
 
-// RawConfigDescriptor returns the raw configuration descriptor bytes
-func (h *DeviceHandle) RawConfigDescriptor(index uint8) ([]byte, error) {
-	// Not directly supported, would need to capture raw bytes during parsing
-	return nil, fmt.Errorf("raw config descriptor not implemented on macOS")
+// ConfigDescriptorByValue gets the parsed configuration descriptor whose
+// bConfigurationValue is value.
+//
+// Deprecated: use ConfigDescriptorByConfigValue, which this now calls, or
+// ConfigDescriptorByIndex. It used to read index value-1, which is only the
+// same configuration on devices numbering their configurations from 1.
+func (h *DeviceHandle) ConfigDescriptorByValue(value uint8) (*ConfigDescriptor, error) {
+	return h.ConfigDescriptorByConfigValue(value)
 }
 
 // SetInterfaceAltSetting sets the alternate setting for an interface
@@ -44,10 +47,31 @@ func (h *DeviceHandle) Status(requestType uint8, index uint16) (uint16, error) {
 	return h.GetStatus(recipient, index)
 }
 
-// Interface gets the current alternate setting for an interface
+// Interface gets the current alternate setting for an interface. IOKit
+// tracks the setting of interfaces opened through the handle; for others a
+// GET_INTERFACE request is sent to the device.
 func (h *DeviceHandle) Interface(iface uint8) (uint8, error) {
-	// Not directly supported on macOS
-	return 0, fmt.Errorf("get interface not implemented on macOS")
+	h.mu.RLock()
+	intf, ok := h.interfaces[iface]
+	closed := h.closed
+	h.mu.RUnlock()
+
+	if closed {
+		return 0, fmt.Errorf("device is closed")
+	}
+	if ok {
+		return intf.AlternateSetting()
+	}
+
+	buf := make([]byte, 1)
+	n, err := h.ControlTransfer(0x81, USB_REQ_GET_INTERFACE, 0, uint16(iface), buf, 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	if n != 1 {
+		return 0, fmt.Errorf("GET_INTERFACE returned %d bytes", n)
+	}
+	return buf[0], nil
 }
 
 // RawDescriptor reads a raw descriptor
@@ -114,50 +138,20 @@ func (h *DeviceHandle) SSEndpointCompanionDescriptor(configIndex, interfaceNumbe
 
 // SSUSBDeviceCapabilityDescriptor gets SuperSpeed USB device capability descriptor
 func (h *DeviceHandle) SSUSBDeviceCapabilityDescriptor() (*SuperSpeedUSBCapability, error) {
-	bos, caps, err := h.GetBOSDescriptor()
+	data, err := h.RawBOSDescriptor()
 	if err != nil {
 		return nil, err
 	}
-
-	_ = bos // unused
-
-	// Look for SuperSpeed capability
-	for _, cap := range caps {
-		if cap.DevCapabilityType == 0x03 { // SuperSpeed USB
-			// Would need to parse the capability data
-			return &SuperSpeedUSBCapability{
-				Length:            cap.Length,
-				DescriptorType:    cap.DescriptorType,
-				DevCapabilityType: cap.DevCapabilityType,
-			}, nil
-		}
-	}
-
-	return nil, fmt.Errorf("SuperSpeed USB capability not found")
+	return parseSuperSpeedUSBCapability(data)
 }
 
 // USB20ExtensionDescriptor gets USB 2.0 extension descriptor
 func (h *DeviceHandle) USB20ExtensionDescriptor() (*USB2ExtensionCapability, error) {
-	bos, caps, err := h.GetBOSDescriptor()
+	data, err := h.RawBOSDescriptor()
 	if err != nil {
 		return nil, err
 	}
-
-	_ = bos // unused
-
-	// Look for USB 2.0 extension capability
-	for _, cap := range caps {
-		if cap.DevCapabilityType == 0x02 { // USB 2.0 extension
-			// Would need to parse the capability data
-			return &USB2ExtensionCapability{
-				Length:            cap.Length,
-				DescriptorType:    cap.DescriptorType,
-				DevCapabilityType: cap.DevCapabilityType,
-			}, nil
-		}
-	}
-
-	return nil, fmt.Errorf("USB 2.0 extension capability not found")
+	return parseUSB20ExtensionCapability(data)
 }
 
 // ReadBOSDescriptor reads the BOS descriptor
@@ -245,3 +239,43 @@ func (h *DeviceHandle) InterruptTransferWithRetry(endpoint uint8, data []byte, t
 	}
 	return 0, lastErr
 }
+
+// cachedDefaultConfigurationValue reports that the configuration descriptors
+// can only be read by opening the device
+func (d *Device) cachedDefaultConfigurationValue() (uint8, bool) {
+	return 0, false
+}
+
+// cachedInterfaceClasses returns the interface classes read from the
+// IORegistry at enumeration. A device without interface services, such as
+// an unconfigured one, is reported as unknown.
+func (d *Device) cachedInterfaceClasses() ([]uint8, bool) {
+	if d.IOKitDevice == nil || len(d.IOKitDevice.InterfaceClasses) == 0 {
+		return nil, false
+	}
+	return append([]uint8(nil), d.IOKitDevice.InterfaceClasses...), true
+}
+
+// cachedContainerID reports that the BOS descriptor can only be read by
+// opening the device
+func (d *Device) cachedContainerID() ([16]byte, bool) {
+	return [16]byte{}, false
+}
+
+// KernelDriverName reports that kernel drivers are not looked up on this
+// platform
+func (d *Device) KernelDriverName(iface uint8) (string, error) {
+	return "", ErrNotSupported
+}
+
+// UnbindKernelDriver reports that kernel drivers cannot be unbound through
+// sysfs on this platform
+func (d *Device) UnbindKernelDriver(iface uint8) error {
+	return ErrNotSupported
+}
+
+// newPlatformNotifier reports that there is no native hotplug backend, so
+// NewNotifier polls
+func newPlatformNotifier() (*Notifier, error) {
+	return nil, ErrNotSupported
+}
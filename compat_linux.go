@@ -1,6 +1,7 @@
 package usb
 
 import (
+	"errors"
 	"regexp"
 )
 
@@ -12,6 +13,7 @@ type DeviceListOption func(*deviceListOptions)
 // deviceListOptions holds the configuration for DeviceList.
 type deviceListOptions struct {
 	includeInaccessible bool
+	excludeRootHubs     bool
 }
 
 // WithInaccessibleDevices returns an option that includes devices that cannot
@@ -26,27 +28,44 @@ func WithInaccessibleDevices() DeviceListOption {
 // DeviceList returns a list of all USB devices on the system.
 // This uses sysfs enumeration on Linux.
 //
-// The opts parameter accepts functional options for API compatibility with
-// other platforms. On Linux, options like WithInaccessibleDevices() have no
-// effect since all devices are accessible via sysfs.
+// Enumeration only reads sysfs and never opens device nodes, so it is safe to
+// call while other goroutines use open handles. Every call returns new Device
+// values; a handle keeps referring to the Device it was opened from.
+//
+// The opts parameter accepts functional options. WithInaccessibleDevices() is
+// accepted for API compatibility with other platforms and has no effect on
+// Linux, since all devices are accessible via sysfs.
 func DeviceList(opts ...DeviceListOption) ([]*Device, error) {
-	// Apply options (for API compatibility, though they have no effect on Linux)
+	devices, _, err := deviceList(opts...)
+	return devices, err
+}
+
+// deviceList enumerates devices via sysfs, returning the devices that could be
+// read along with the per-device errors for those that could not.
+func deviceList(opts ...DeviceListOption) ([]*Device, []error, error) {
 	options := &deviceListOptions{}
 	for _, opt := range opts {
 		opt(options)
 	}
+	if b := currentBackend(); b != nil {
+		return backendDeviceList(b, options)
+	}
 
 	enum := NewSysfsEnumerator()
-	sysfsDevices, err := enum.EnumerateDevices()
+	sysfsDevices, errs, err := enum.enumerate()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	devices := make([]*Device, len(sysfsDevices))
 	for i, sd := range sysfsDevices {
 		devices[i] = sd.ToUSBDevice()
 	}
-	return devices, nil
+	linkTopology(devices)
+	if options.excludeRootHubs {
+		devices = withoutRootHubs(devices)
+	}
+	return devices, errs, nil
 }
 
 // OpenDevice opens a USB device by vendor ID and product ID.
@@ -87,29 +106,71 @@ func IsValidDevicePath(path string) bool {
 	return bus >= 1 && bus <= 255 && addr >= 1 && addr <= 255
 }
 
-// GetConfiguration gets the current device configuration
+// GetConfiguration gets the current device configuration. For devices
+// enumerated from sysfs the kernel's cached bConfigurationValue is used, which
+// avoids a control transfer; otherwise the device is asked directly.
 func (h *DeviceHandle) GetConfiguration() (int, error) {
+	h.mu.RLock()
+	closed := h.closed
+	h.mu.RUnlock()
+	if closed {
+		return 0, ErrDeviceNotFound
+	}
+
+	if config, err := h.device.sysfsConfigurationValue(); err == nil {
+		return config, nil
+	}
 	return h.Configuration()
 }
 
-// GetConfigDescriptor gets a configuration descriptor by index
-func (h *DeviceHandle) GetConfigDescriptor(index uint8) (*ConfigDescriptor, error) {
-	// On Linux, we use ConfigDescriptorByValue, but need to convert
-	return h.ConfigDescriptorByValue(index + 1)
+// GetConfigurationForce gets the current device configuration with a
+// GET_CONFIGURATION control transfer, bypassing the sysfs cache
+func (h *DeviceHandle) GetConfigurationForce() (int, error) {
+	return h.Configuration()
 }
 
-// GetActiveConfigDescriptor gets the descriptor for the active configuration
+// GetActiveConfigDescriptor gets the descriptor for the active configuration.
+// The parsed descriptor is cached on the handle until SetConfiguration,
+// SetInterfaceAltSetting or ResetDevice is called, so repeated calls are
+// cheap. It describes every alternate setting, so use Interface or
+// ActiveAltSettings to find the ones currently selected. The returned
+// descriptor is shared and must not be modified.
 func (h *DeviceHandle) GetActiveConfigDescriptor() (*ConfigDescriptor, error) {
-	config, err := h.GetConfiguration()
+	cached, gen := h.cachedActiveConfig()
+	if cached != nil {
+		return cached, nil
+	}
+
+	value, err := h.GetConfiguration()
 	if err != nil {
 		return nil, err
 	}
 
-	if config > 0 {
-		return h.ConfigDescriptorByValue(uint8(config))
+	// usbfs reads configurations by index, so find the one whose
+	// bConfigurationValue matches. An unconfigured device reports 0; fall
+	// back to the first configuration like before.
+	numConfigs := int(h.Descriptor().NumConfigurations)
+	if numConfigs == 0 {
+		numConfigs = 1
 	}
 
-	return h.ConfigDescriptorByValue(1)
+	var config *ConfigDescriptor
+	for i := 0; i < numConfigs; i++ {
+		desc, err := h.ConfigDescriptorByIndex(uint8(i))
+		if err != nil {
+			return nil, err
+		}
+		if value == 0 || int(desc.ConfigurationValue) == value {
+			config = desc
+			break
+		}
+	}
+	if config == nil {
+		return nil, ErrNotFound
+	}
+
+	h.storeActiveConfig(config, gen)
+	return config, nil
 }
 
 // GetDeviceDescriptor returns the device descriptor
@@ -123,20 +184,19 @@ func (h *DeviceHandle) SetAltSetting(iface, altSetting uint8) error {
 	return h.SetInterfaceAltSetting(iface, altSetting)
 }
 
-// KernelDriverActive checks if a kernel driver is active
+// KernelDriverActive reports whether a kernel driver other than usbfs is
+// bound to iface, that is whether DetachKernelDriver has anything to
+// detach. It only asks the kernel with GetKernelDriver, so it leaves claimed
+// interfaces as they are.
 func (h *DeviceHandle) KernelDriverActive(iface uint8) (bool, error) {
-	// Not directly exposed in Linux implementation
-	// Try to claim interface - if it fails with EBUSY, driver is active
-	err := h.ClaimInterface(iface)
+	name, err := h.GetKernelDriver(iface)
+	if errors.Is(err, ErrNoDriver) {
+		return false, nil
+	}
 	if err != nil {
-		if err == ErrDeviceBusy {
-			return true, nil
-		}
 		return false, err
 	}
-	// Release if we successfully claimed it
-	h.ReleaseInterface(iface)
-	return false, nil
+	return name != "usbfs", nil
 }
 
 // GetBOSDescriptor gets the BOS descriptor
@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strings"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
@@ -17,6 +18,7 @@ type DeviceListOption func(*deviceListOptions)
 // deviceListOptions holds the configuration for DeviceList.
 type deviceListOptions struct {
 	includeInaccessible bool
+	excludeRootHubs     bool
 }
 
 // WithInaccessibleDevices returns an option that includes devices that cannot
@@ -31,23 +33,43 @@ func WithInaccessibleDevices() DeviceListOption {
 // DeviceList returns a list of USB devices on the system.
 // This uses SetupAPI enumeration on Windows.
 //
+// Every call returns new Device values; handles opened from earlier lists are
+// not affected. Devices this process has open are listed from the copy made
+// when they were opened, since WinUSB does not allow a second open.
+//
 // By default, only devices with WinUSB-compatible drivers that can be fully
 // accessed are returned. Use WithInaccessibleDevices() to include devices
 // that cannot be opened (they will have limited information).
 func DeviceList(opts ...DeviceListOption) ([]*Device, error) {
+	devices, _, err := deviceList(opts...)
+	return devices, err
+}
+
+// deviceList enumerates devices via SetupAPI, returning the devices that could
+// be read along with the errors for the ones that were skipped.
+func deviceList(opts ...DeviceListOption) ([]*Device, []error, error) {
 	// Apply options
 	options := &deviceListOptions{}
 	for _, opt := range opts {
 		opt(options)
 	}
+	if b := currentBackend(); b != nil {
+		return backendDeviceList(b, options)
+	}
 
 	winDevices, err := EnumerateUSBDevices()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var devices []*Device
+	var errs []error
 	for _, wd := range winDevices {
+		if device, ok := openDevice(wd.DevicePath); ok {
+			devices = append(devices, device)
+			continue
+		}
+
 		device, err := createDeviceFromPath(wd.DevicePath)
 		if err != nil {
 			if options.includeInaccessible {
@@ -63,13 +85,17 @@ func DeviceList(opts ...DeviceListOption) ([]*Device, error) {
 				}
 			} else {
 				// Skip devices we can't open
+				errs = append(errs, fmt.Errorf("%s: %w", wd.DevicePath, err))
 				continue
 			}
 		}
 		devices = append(devices, device)
 	}
+	if options.excludeRootHubs {
+		devices = withoutRootHubs(devices)
+	}
 
-	return devices, nil
+	return devices, errs, nil
 }
 
 // createDeviceFromPath creates a Device from a Windows device path
@@ -177,40 +203,23 @@ func createDeviceFromPath(devicePath string) (*Device, error) {
 
 // readStringDescriptor reads a string descriptor
 func readStringDescriptor(winusbHandle winusbInterfaceHandle, index uint8) (string, error) {
-	buf := make([]byte, 256)
-	var transferred uint32
-
-	r0, _, e1 := syscall.SyscallN(
-		procWinUsb_GetDescriptor.Addr(),
-		uintptr(winusbHandle),
-		uintptr(USB_DT_STRING),
-		uintptr(index),
-		uintptr(0x0409), // English (US)
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(len(buf)),
-		uintptr(unsafe.Pointer(&transferred)),
-	)
-	if r0 == 0 {
-		return "", e1
-	}
-
-	if transferred < 2 {
-		return "", fmt.Errorf("invalid string descriptor")
-	}
-
-	length := int(buf[0])
-	if length > int(transferred) {
-		length = int(transferred)
-	}
-
-	result := make([]uint16, 0, (length-2)/2)
-	for i := 2; i < length; i += 2 {
-		if i+1 < length {
-			result = append(result, binary.LittleEndian.Uint16(buf[i:i+2]))
+	return fetchStringDescriptor(func(buf []byte) (int, error) {
+		var transferred uint32
+		r0, _, e1 := syscall.SyscallN(
+			procWinUsb_GetDescriptor.Addr(),
+			uintptr(winusbHandle),
+			uintptr(USB_DT_STRING),
+			uintptr(index),
+			uintptr(0x0409), // English (US)
+			uintptr(unsafe.Pointer(&buf[0])),
+			uintptr(len(buf)),
+			uintptr(unsafe.Pointer(&transferred)),
+		)
+		if r0 == 0 {
+			return 0, fmt.Errorf("WinUsb_GetDescriptor failed: %w", e1)
 		}
-	}
-
-	return string(utf16ToRunes(result)), nil
+		return int(transferred), nil
+	})
 }
 
 // parseVidPidFromPath extracts VID and PID from Windows device path
@@ -283,23 +292,48 @@ func (h *DeviceHandle) GetConfiguration() (int, error) {
 	return h.Configuration()
 }
 
-// GetConfigDescriptor gets a configuration descriptor by index
-func (h *DeviceHandle) GetConfigDescriptor(index uint8) (*ConfigDescriptor, error) {
-	return h.ConfigDescriptorByValue(index + 1)
+// GetConfigurationForce asks the device for its current configuration with a
+// GET_CONFIGURATION control transfer instead of returning the value recorded
+// by SetConfiguration
+func (h *DeviceHandle) GetConfigurationForce() (int, error) {
+	buf := make([]byte, 1)
+	n, err := h.ControlTransfer(0x80, USB_REQ_GET_CONFIGURATION, 0, 0, buf, 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	if n != 1 {
+		return 0, fmt.Errorf("short GET_CONFIGURATION response: %d bytes", n)
+	}
+	return int(buf[0]), nil
 }
 
-// GetActiveConfigDescriptor gets the descriptor for the active configuration
+// GetActiveConfigDescriptor gets the descriptor for the active configuration.
+// The parsed descriptor is cached on the handle until SetConfiguration,
+// SetInterfaceAltSetting or ResetDevice is called, so repeated calls are
+// cheap. It describes every alternate setting, so use Interface or
+// ActiveAltSettings to find the ones currently selected. The returned
+// descriptor is shared and must not be modified.
 func (h *DeviceHandle) GetActiveConfigDescriptor() (*ConfigDescriptor, error) {
-	config, err := h.GetConfiguration()
+	cached, gen := h.cachedActiveConfig()
+	if cached != nil {
+		return cached, nil
+	}
+
+	value, err := h.GetConfiguration()
 	if err != nil {
 		return nil, err
 	}
+	if value <= 0 {
+		value = 1
+	}
 
-	if config > 0 {
-		return h.ConfigDescriptorByValue(uint8(config))
+	config, err := h.ConfigDescriptorByConfigValue(uint8(value))
+	if err != nil {
+		return nil, err
 	}
 
-	return h.ConfigDescriptorByValue(1)
+	h.storeActiveConfig(config, gen)
+	return config, nil
 }
 
 // GetDeviceDescriptor returns the device descriptor
@@ -313,6 +347,12 @@ func (h *DeviceHandle) SetAltSetting(iface, altSetting uint8) error {
 	return h.SetInterfaceAltSetting(iface, altSetting)
 }
 
+// GetKernelDriver reports that the driver of an interface cannot be queried
+// through WinUSB
+func (h *DeviceHandle) GetKernelDriver(iface uint8) (string, error) {
+	return "", ErrNotSupported
+}
+
 // KernelDriverActive checks if a kernel driver is active
 func (h *DeviceHandle) KernelDriverActive(iface uint8) (bool, error) {
 	// On Windows with WinUSB, the WinUSB driver is always active
@@ -326,11 +366,21 @@ func (h *DeviceHandle) GetBOSDescriptor() (*BOSDescriptor, []DeviceCapabilityDes
 
 // ReadBOSDescriptor reads the Binary Object Store descriptor
 func (h *DeviceHandle) ReadBOSDescriptor() (*BOSDescriptor, []DeviceCapabilityDescriptor, error) {
+	data, err := h.RawBOSDescriptor()
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseBOSDescriptor(data)
+}
+
+// RawBOSDescriptor reads the complete Binary Object Store descriptor,
+// including every device capability
+func (h *DeviceHandle) RawBOSDescriptor() ([]byte, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	if h.closed {
-		return nil, nil, ErrDeviceNotFound
+		return nil, ErrDeviceNotFound
 	}
 
 	// First get header
@@ -348,22 +398,20 @@ func (h *DeviceHandle) ReadBOSDescriptor() (*BOSDescriptor, []DeviceCapabilityDe
 		uintptr(unsafe.Pointer(&transferred)),
 	)
 	if r0 == 0 {
-		return nil, nil, fmt.Errorf("failed to get BOS descriptor: %w", e1)
+		return nil, fmt.Errorf("failed to get BOS descriptor: %w", e1)
 	}
 
 	if transferred < 5 || buf[1] != USB_DT_BOS {
-		return nil, nil, fmt.Errorf("invalid BOS descriptor")
+		return nil, fmt.Errorf("invalid BOS descriptor")
 	}
 
-	bos := &BOSDescriptor{
-		Length:         buf[0],
-		DescriptorType: buf[1],
-		TotalLength:    binary.LittleEndian.Uint16(buf[2:4]),
-		NumDeviceCaps:  buf[4],
+	totalLength := binary.LittleEndian.Uint16(buf[2:4])
+	if totalLength < 5 {
+		return nil, fmt.Errorf("invalid BOS total length: %d", totalLength)
 	}
 
 	// Get full descriptor
-	fullBuf := make([]byte, bos.TotalLength)
+	fullBuf := make([]byte, totalLength)
 	r0, _, e1 = syscall.SyscallN(
 		procWinUsb_GetDescriptor.Addr(),
 		uintptr(h.winusbHandle),
@@ -375,34 +423,10 @@ func (h *DeviceHandle) ReadBOSDescriptor() (*BOSDescriptor, []DeviceCapabilityDe
 		uintptr(unsafe.Pointer(&transferred)),
 	)
 	if r0 == 0 {
-		return nil, nil, fmt.Errorf("failed to get full BOS descriptor: %w", e1)
+		return nil, fmt.Errorf("failed to get full BOS descriptor: %w", e1)
 	}
 
-	// Parse device capabilities
-	caps := make([]DeviceCapabilityDescriptor, 0, bos.NumDeviceCaps)
-	pos := 5
-
-	for i := 0; i < int(bos.NumDeviceCaps) && pos < len(fullBuf); i++ {
-		if pos+3 > len(fullBuf) {
-			break
-		}
-
-		length := int(fullBuf[pos])
-		if length < 3 || pos+length > len(fullBuf) {
-			break
-		}
-
-		cap := DeviceCapabilityDescriptor{
-			Length:            fullBuf[pos],
-			DescriptorType:    fullBuf[pos+1],
-			DevCapabilityType: fullBuf[pos+2],
-		}
-
-		caps = append(caps, cap)
-		pos += length
-	}
-
-	return bos, caps, nil
+	return fullBuf[:transferred], nil
 }
 
 // GetDeviceQualifierDescriptor gets the device qualifier descriptor
@@ -493,3 +517,39 @@ func (h *DeviceHandle) GetStatus(recipient, index uint16) (uint16, error) {
 
 	return binary.LittleEndian.Uint16(buf), nil
 }
+
+// cachedDefaultConfigurationValue reports that the configuration descriptors
+// can only be read by opening the device
+func (d *Device) cachedDefaultConfigurationValue() (uint8, bool) {
+	return 0, false
+}
+
+// cachedInterfaceClasses reports that the interface classes can only be read
+// by opening the device
+func (d *Device) cachedInterfaceClasses() ([]uint8, bool) {
+	return nil, false
+}
+
+// cachedContainerID reports that the BOS descriptor can only be read by
+// opening the device
+func (d *Device) cachedContainerID() ([16]byte, bool) {
+	return [16]byte{}, false
+}
+
+// KernelDriverName reports that kernel drivers are not looked up on this
+// platform
+func (d *Device) KernelDriverName(iface uint8) (string, error) {
+	return "", ErrNotSupported
+}
+
+// UnbindKernelDriver reports that kernel drivers cannot be unbound through
+// sysfs on this platform
+func (d *Device) UnbindKernelDriver(iface uint8) error {
+	return ErrNotSupported
+}
+
+// newPlatformNotifier reports that there is no native hotplug backend, so
+// NewNotifier polls
+func newPlatformNotifier() (*Notifier, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,43 @@
+package usb
+
+// completionQueue puts the completions of one endpoint back into submission
+// order. Each submission takes the next sequence number; a completion that
+// arrives before those of earlier submissions is held until they have all
+// arrived. It is not safe for concurrent use.
+type completionQueue struct {
+	seq  uint64            // sequence number of the next submission
+	next uint64            // sequence number of the next completion to deliver
+	held map[uint64]func() // completions waiting for earlier ones; nil for none to deliver
+}
+
+func newCompletionQueue() *completionQueue {
+	return &completionQueue{held: make(map[uint64]func())}
+}
+
+// submit returns the sequence number of a new submission
+func (q *completionQueue) submit() uint64 {
+	seq := q.seq
+	q.seq++
+	return seq
+}
+
+// complete records the completion of submission seq and returns the
+// completions that can now be delivered, in order. A nil deliver marks a
+// submission that has nothing to deliver, such as one the kernel rejected,
+// so that later completions are not held for it.
+func (q *completionQueue) complete(seq uint64, deliver func()) []func() {
+	q.held[seq] = deliver
+
+	var ready []func()
+	for {
+		d, ok := q.held[q.next]
+		if !ok {
+			return ready
+		}
+		delete(q.held, q.next)
+		q.next++
+		if d != nil {
+			ready = append(ready, d)
+		}
+	}
+}
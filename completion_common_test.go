@@ -0,0 +1,50 @@
+package usb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompletionQueue(t *testing.T) {
+	q := newCompletionQueue()
+	var delivered []int
+	deliver := func(i int) func() {
+		return func() { delivered = append(delivered, i) }
+	}
+	run := func(ready []func()) {
+		for _, d := range ready {
+			d()
+		}
+	}
+
+	seqs := make([]uint64, 5)
+	for i := range seqs {
+		seqs[i] = q.submit()
+	}
+
+	// Reaped as 2, 0, 3 (rejected), 4, 1
+	run(q.complete(seqs[2], deliver(2)))
+	if len(delivered) != 0 {
+		t.Fatalf("delivered %v before submission 0 completed", delivered)
+	}
+	run(q.complete(seqs[0], deliver(0)))
+	run(q.complete(seqs[3], nil))
+	run(q.complete(seqs[4], deliver(4)))
+	if want := []int{0}; !reflect.DeepEqual(delivered, want) {
+		t.Fatalf("delivered %v, want %v", delivered, want)
+	}
+	run(q.complete(seqs[1], deliver(1)))
+	if want := []int{0, 1, 2, 4}; !reflect.DeepEqual(delivered, want) {
+		t.Fatalf("delivered %v, want %v", delivered, want)
+	}
+
+	// The queue carries on with later submissions
+	seq := q.submit()
+	run(q.complete(seq, deliver(5)))
+	if want := []int{0, 1, 2, 4, 5}; !reflect.DeepEqual(delivered, want) {
+		t.Errorf("delivered %v, want %v", delivered, want)
+	}
+	if len(q.held) != 0 {
+		t.Errorf("%d completions still held", len(q.held))
+	}
+}
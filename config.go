@@ -21,6 +21,10 @@ type ConfigDescriptor struct {
 	// Parsed interfaces
 	Interfaces []Interface
 
+	// Interface Association Descriptors, in descriptor order. The raw bytes
+	// are also kept in Extra.
+	Associations []InterfaceAssocDescriptor
+
 	// Extra descriptors not parsed into the structure
 	Extra []byte
 }
@@ -47,6 +51,41 @@ func (i *Interface) InterfaceNumber() uint8 {
 	return 0
 }
 
+// EndpointInAnyAlt finds an endpoint by address in any alternate setting of
+// the interface, returning the endpoint and the alt setting that declares it
+func (i *Interface) EndpointInAnyAlt(addr uint8) (*Endpoint, *InterfaceAltSetting, bool) {
+	for a := range i.AltSettings {
+		alt := &i.AltSettings[a]
+		for e := range alt.Endpoints {
+			if alt.Endpoints[e].EndpointAddr == addr {
+				return &alt.Endpoints[e], alt, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// BestIsoAltSetting returns the alternate setting whose isochronous endpoint
+// moves the most bytes per service interval, which is the one to select for
+// full streaming bandwidth. Ties go to the lowest alt setting.
+func (i *Interface) BestIsoAltSetting() (*InterfaceAltSetting, bool) {
+	var best *InterfaceAltSetting
+	bestBytes := 0
+	for a := range i.AltSettings {
+		alt := &i.AltSettings[a]
+		for e := range alt.Endpoints {
+			ep := &alt.Endpoints[e]
+			if ep.TransferType() != TransferTypeIsochronous {
+				continue
+			}
+			if n := ep.bytesPerInterval(); n > bestBytes {
+				best, bestBytes = alt, n
+			}
+		}
+	}
+	return best, best != nil
+}
+
 // InterfaceAltSetting represents an interface descriptor with its endpoints
 // Similar to libusb_interface_descriptor
 type InterfaceAltSetting struct {
@@ -82,10 +121,51 @@ type Endpoint struct {
 	// For SuperSpeed devices, companion descriptor if present
 	SSCompanion *SuperSpeedEndpointCompanionDescriptor
 
+	// For SuperSpeedPlus isochronous endpoints, the companion that follows
+	// SSCompanion when its bmAttributes bit 7 is set
+	SSPIsoCompanion *SSPIsochEndpointCompanion
+
 	// Extra descriptors
 	Extra []byte
 }
 
+// ValidateConfigLength checks that data holds exactly the wTotalLength bytes
+// its configuration descriptor header declares. Unmarshal parses whatever it
+// is given, so a truncated read would otherwise parse into a configuration
+// with interfaces or endpoints missing.
+func ValidateConfigLength(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("config descriptor too short: %d bytes", len(data))
+	}
+	totalLength := int(binary.LittleEndian.Uint16(data[2:4]))
+	switch {
+	case len(data) < totalLength:
+		return fmt.Errorf("config descriptor truncated: got %d of %d bytes", len(data), totalLength)
+	case len(data) > totalLength:
+		return fmt.Errorf("config descriptor has %d bytes past its %d byte total length", len(data)-totalLength, totalLength)
+	}
+	return nil
+}
+
+// splitConfigDescriptors splits consecutive configuration descriptors, as the
+// kernel returns them after the device descriptor when a usbfs node or the
+// sysfs descriptors file is read, at their wTotalLength
+func splitConfigDescriptors(data []byte) ([][]byte, error) {
+	var configs [][]byte
+	for len(data) > 0 {
+		if len(data) < 9 || data[1] != USB_DT_CONFIG {
+			return nil, fmt.Errorf("invalid config descriptor %d", len(configs))
+		}
+		totalLength := int(binary.LittleEndian.Uint16(data[2:4]))
+		if totalLength < 9 || totalLength > len(data) {
+			return nil, fmt.Errorf("config descriptor truncated: got %d of %d bytes", len(data), totalLength)
+		}
+		configs = append(configs, data[:totalLength])
+		data = data[totalLength:]
+	}
+	return configs, nil
+}
+
 // Unmarshal parses raw configuration descriptor data into this ConfigDescriptor
 func (c *ConfigDescriptor) Unmarshal(data []byte) error {
 	if len(data) < 9 {
@@ -197,6 +277,19 @@ func (c *ConfigDescriptor) Unmarshal(data []byte) error {
 						// Skip the companion descriptor
 						pos = nextPos
 						length = companionLen
+
+						// A SuperSpeedPlus isochronous companion only
+						// follows a companion that announces it
+						nextPos = pos + length
+						if endpoint.SSCompanion.HasSSPIsochCompanion() && endpoint.TransferType() == TransferTypeIsochronous &&
+							nextPos+2 <= len(data) && data[nextPos+1] == USB_DT_SUPERSPEEDPLUS_ISOCH_EP_COMP {
+							sspLen := int(data[nextPos])
+							if nextPos+sspLen <= len(data) && sspLen >= 8 {
+								endpoint.SSPIsoCompanion = parseSSPIsochEndpointCompanion(data[nextPos : nextPos+sspLen])
+								pos = nextPos
+								length = sspLen
+							}
+						}
 					}
 				}
 
@@ -205,6 +298,18 @@ func (c *ConfigDescriptor) Unmarshal(data []byte) error {
 
 		case USB_DT_INTERFACE_ASSOCIATION: // 0x0b
 			// Interface Association Descriptor
+			if length >= 8 {
+				c.Associations = append(c.Associations, InterfaceAssocDescriptor{
+					Length:           data[pos],
+					DescriptorType:   data[pos+1],
+					FirstInterface:   data[pos+2],
+					InterfaceCount:   data[pos+3],
+					FunctionClass:    data[pos+4],
+					FunctionSubClass: data[pos+5],
+					FunctionProtocol: data[pos+6],
+					Function:         data[pos+7],
+				})
+			}
 			if currentInterface != nil {
 				extraBuffer = append(extraBuffer, data[pos:pos+length]...)
 			} else {
@@ -279,6 +384,71 @@ func (c *ConfigDescriptor) InterfaceAltSetting(interfaceNumber, altSetting uint8
 	return nil
 }
 
+// HasInterfaceClass reports whether any interface in the configuration has
+// the given bInterfaceClass in any of its alternate settings
+func (c *ConfigDescriptor) HasInterfaceClass(class uint8) bool {
+	return len(c.InterfacesWithClass(class)) > 0
+}
+
+// InterfacesWithClass returns the numbers of the interfaces that have the
+// given bInterfaceClass in any of their alternate settings, in descriptor order
+func (c *ConfigDescriptor) InterfacesWithClass(class uint8) []uint8 {
+	var numbers []uint8
+	for i := range c.Interfaces {
+		for _, alt := range c.Interfaces[i].AltSettings {
+			if alt.InterfaceClass == class {
+				numbers = append(numbers, alt.InterfaceNumber)
+				break
+			}
+		}
+	}
+	return numbers
+}
+
+// Collection is a group of interfaces that together form one function, such
+// as a UVC video interface collection or a USB Audio function, as described
+// by an Interface Association Descriptor
+type Collection struct {
+	InterfaceAssocDescriptor
+
+	// Interfaces lists the numbers of the associated interfaces present in
+	// the configuration
+	Interfaces []uint8
+}
+
+// Collections returns the interface collections of the configuration, one per
+// Interface Association Descriptor
+func (c *ConfigDescriptor) Collections() []Collection {
+	collections := make([]Collection, 0, len(c.Associations))
+	for _, iad := range c.Associations {
+		col := Collection{InterfaceAssocDescriptor: iad}
+		for n := int(iad.FirstInterface); n < int(iad.FirstInterface)+int(iad.InterfaceCount) && n < 256; n++ {
+			if c.Interface(uint8(n)) != nil {
+				col.Interfaces = append(col.Interfaces, uint8(n))
+			}
+		}
+		collections = append(collections, col)
+	}
+	return collections
+}
+
+// Endpoint returns the first endpoint of the given transfer type and
+// direction in an alternate setting of an interface
+func (c *ConfigDescriptor) Endpoint(interfaceNumber, altSetting uint8, transferType TransferType, dir EndpointDirection) (*Endpoint, bool) {
+	alt := c.InterfaceAltSetting(interfaceNumber, altSetting)
+	if alt == nil {
+		return nil, false
+	}
+
+	for i := range alt.Endpoints {
+		ep := &alt.Endpoints[i]
+		if ep.TransferType() == transferType && EndpointDirection(ep.EndpointAddr&0x80) == dir {
+			return ep, true
+		}
+	}
+	return nil, false
+}
+
 // FindEndpoint finds an endpoint by address across all interfaces and alt settings
 func (c *ConfigDescriptor) FindEndpoint(endpointAddress uint8) *Endpoint {
 	for _, iface := range c.Interfaces {
@@ -312,3 +482,133 @@ func (e *Endpoint) EndpointNumber() uint8 {
 func (e *Endpoint) TransferType() TransferType {
 	return TransferType(e.Attributes & 0x03)
 }
+
+// SyncType returns the isochronous synchronization type
+func (e *Endpoint) SyncType() SyncType {
+	return SyncType((e.Attributes >> 2) & 0x03)
+}
+
+// UsageType returns the isochronous usage type
+func (e *Endpoint) UsageType() UsageType {
+	return UsageType((e.Attributes >> 4) & 0x03)
+}
+
+// SupportsStreams reports whether this is a bulk endpoint whose SuperSpeed
+// companion advertises streams, as the data endpoints of a UAS interface do
+func (e *Endpoint) SupportsStreams() bool {
+	return e.TransferType() == TransferTypeBulk && e.SSCompanion != nil && e.SSCompanion.MaxStreams() > 1
+}
+
+// bytesPerInterval returns how many bytes a periodic endpoint can move per
+// service interval: dwBytesPerInterval from the SuperSpeedPlus isochronous
+// companion or wBytesPerInterval from the SuperSpeed companion when present,
+// otherwise the packet size times the high-bandwidth transaction count
+// encoded in wMaxPacketSize bits 12:11
+func (e *Endpoint) bytesPerInterval() int {
+	if e.SSPIsoCompanion != nil && e.SSPIsoCompanion.BytesPerInterval > 0 {
+		return int(e.SSPIsoCompanion.BytesPerInterval)
+	}
+	if e.SSCompanion != nil && e.SSCompanion.BytesPerInterval > 0 {
+		return int(e.SSCompanion.BytesPerInterval)
+	}
+	return int(e.MaxPacketSize&0x7ff) * (int(e.MaxPacketSize>>11&0x03) + 1)
+}
+
+// SSEndpointCompanion returns the SuperSpeed endpoint companion descriptor for
+// an endpoint in the given interface alt setting. The companion is normally
+// attached by Unmarshal; if it was not, the endpoint's Extra bytes are searched.
+func (c *ConfigDescriptor) SSEndpointCompanion(interfaceNumber, altSetting, endpointAddress uint8) (*SuperSpeedEndpointCompanionDescriptor, error) {
+	altSettingDesc := c.InterfaceAltSetting(interfaceNumber, altSetting)
+	if altSettingDesc == nil {
+		return nil, fmt.Errorf("interface %d alt setting %d not found", interfaceNumber, altSetting)
+	}
+
+	for i := range altSettingDesc.Endpoints {
+		ep := &altSettingDesc.Endpoints[i]
+		if ep.EndpointAddr != endpointAddress {
+			continue
+		}
+		if ep.SSCompanion != nil {
+			return ep.SSCompanion, nil
+		}
+
+		// Search through extra data if companion wasn't parsed
+		extra := ep.Extra
+		pos := 0
+		for pos+2 <= len(extra) {
+			length := int(extra[pos])
+			descType := extra[pos+1]
+
+			if length < 2 || pos+length > len(extra) {
+				break
+			}
+
+			if descType == USB_DT_SS_ENDPOINT_COMPANION {
+				if length < 6 {
+					return nil, fmt.Errorf("invalid SS endpoint companion descriptor length: %d", length)
+				}
+				return &SuperSpeedEndpointCompanionDescriptor{
+					Length:           extra[pos],
+					DescriptorType:   extra[pos+1],
+					MaxBurst:         extra[pos+2],
+					Attributes:       extra[pos+3],
+					BytesPerInterval: binary.LittleEndian.Uint16(extra[pos+4 : pos+6]),
+				}, nil
+			}
+
+			pos += length
+		}
+		return nil, fmt.Errorf("SS endpoint companion descriptor not found for endpoint %02x", endpointAddress)
+	}
+
+	return nil, fmt.Errorf("endpoint %02x not found", endpointAddress)
+}
+
+// SSPIsochEndpointCompanion returns the SuperSpeedPlus isochronous endpoint
+// companion descriptor for an endpoint in the given interface alt setting,
+// attached by Unmarshal or else searched for in the endpoint's Extra bytes
+func (c *ConfigDescriptor) SSPIsochEndpointCompanion(interfaceNumber, altSetting, endpointAddress uint8) (*SSPIsochEndpointCompanion, error) {
+	altSettingDesc := c.InterfaceAltSetting(interfaceNumber, altSetting)
+	if altSettingDesc == nil {
+		return nil, fmt.Errorf("interface %d alt setting %d not found", interfaceNumber, altSetting)
+	}
+
+	for i := range altSettingDesc.Endpoints {
+		ep := &altSettingDesc.Endpoints[i]
+		if ep.EndpointAddr != endpointAddress {
+			continue
+		}
+		if ep.SSPIsoCompanion != nil {
+			return ep.SSPIsoCompanion, nil
+		}
+
+		extra := ep.Extra
+		for pos := 0; pos+2 <= len(extra); {
+			length := int(extra[pos])
+			if length < 2 || pos+length > len(extra) {
+				break
+			}
+			if extra[pos+1] == USB_DT_SUPERSPEEDPLUS_ISOCH_EP_COMP {
+				if length < 8 {
+					return nil, fmt.Errorf("invalid SSP isochronous endpoint companion descriptor length: %d", length)
+				}
+				return parseSSPIsochEndpointCompanion(extra[pos : pos+length]), nil
+			}
+			pos += length
+		}
+		return nil, fmt.Errorf("SSP isochronous endpoint companion descriptor not found for endpoint %02x", endpointAddress)
+	}
+
+	return nil, fmt.Errorf("endpoint %02x not found", endpointAddress)
+}
+
+// parseSSPIsochEndpointCompanion decodes a SuperSpeedPlus isochronous
+// endpoint companion descriptor of at least 8 bytes
+func parseSSPIsochEndpointCompanion(b []byte) *SSPIsochEndpointCompanion {
+	return &SSPIsochEndpointCompanion{
+		Length:           b[0],
+		DescriptorType:   b[1],
+		Reserved:         binary.LittleEndian.Uint16(b[2:4]),
+		BytesPerInterval: binary.LittleEndian.Uint32(b[4:8]),
+	}
+}
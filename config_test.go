@@ -1,10 +1,20 @@
 package usb
 
 import (
+	"encoding/binary"
 	"encoding/hex"
 	"testing"
 )
 
+// superSpeedCompanionConfig is a configuration whose bulk IN endpoint 0x81
+// is followed by a SuperSpeed Endpoint Companion and whose bulk OUT endpoint
+// 0x02 has none
+const superSpeedCompanionConfig = "09022e00010100c032" + // Config, 46 bytes total
+	"0904000002ff010000" + // Interface, 9 bytes
+	"0705810240000a" + // Endpoint, 7 bytes
+	"063000000000" + // SuperSpeed Endpoint Companion, 6 bytes
+	"0705020240000a" // Another endpoint, 7 bytes
+
 func TestConfigDescriptorUnmarshal(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -100,6 +110,10 @@ func TestConfigDescriptorUnmarshal(t *testing.T) {
 				if ep.TransferType() != 1 { // Isochronous transfer type
 					t.Errorf("Endpoint transfer type = %d, want isochronous", ep.TransferType())
 				}
+				// Both video interfaces share class 0x0e
+				if got := c.InterfacesWithClass(0x0e); len(got) != 2 || got[0] != 0 || got[1] != 1 {
+					t.Errorf("InterfacesWithClass(0x0e) = %v, want [0 1]", got)
+				}
 			},
 		},
 		{
@@ -121,6 +135,16 @@ func TestConfigDescriptorUnmarshal(t *testing.T) {
 				if len(extra) < 9 || extra[0] != 0x09 || extra[1] != 0x21 {
 					t.Errorf("Invalid HID descriptor in Extra: %x", extra)
 				}
+
+				if !c.HasInterfaceClass(0x03) {
+					t.Error("HasInterfaceClass(0x03) should find the HID interface")
+				}
+				if c.HasInterfaceClass(0x0e) {
+					t.Error("HasInterfaceClass(0x0e) should be false")
+				}
+				if got := c.InterfacesWithClass(0x03); len(got) != 1 || got[0] != 0 {
+					t.Errorf("InterfacesWithClass(0x03) = %v, want [0]", got)
+				}
 			},
 		},
 		{
@@ -144,11 +168,7 @@ func TestConfigDescriptorUnmarshal(t *testing.T) {
 		},
 		{
 			name: "config_with_superspeed_companion",
-			data: "09022e00010100c032" + // Config, 46 bytes total
-				"0904000002ff010000" + // Interface, 9 bytes
-				"0705810240000a" + // Endpoint, 7 bytes
-				"063000000000" + // SuperSpeed Endpoint Companion, 6 bytes
-				"0705020240000a", // Another endpoint, 7 bytes
+			data: superSpeedCompanionConfig,
 			validate: func(t *testing.T, c *ConfigDescriptor) {
 				ep := c.Interfaces[0].AltSettings[0].Endpoints[0]
 				if ep.SSCompanion == nil {
@@ -159,6 +179,32 @@ func TestConfigDescriptorUnmarshal(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "config_with_ssp_isoch_companion",
+			data: "09023c00010100c032" + // Config, 60 bytes total
+				"09040001020e020000" + // Interface, alt 1
+				"07058105000401" + // Isochronous IN endpoint, 7 bytes
+				"063000800100" + // SuperSpeed companion announcing an SSP companion
+				"0831000000c00000" + // SSP isochronous companion: 49152 bytes per interval
+				"07058205000401" + // Isochronous IN endpoint, 7 bytes
+				"063000000004" + // SuperSpeed companion without the bit
+				"0831000000c00000", // Not announced, so left unparsed
+			validate: func(t *testing.T, c *ConfigDescriptor) {
+				eps := c.Interfaces[0].AltSettings[0].Endpoints
+				if len(eps) != 2 {
+					t.Fatalf("got %d endpoints, want 2", len(eps))
+				}
+				if eps[0].SSPIsoCompanion == nil || eps[0].SSPIsoCompanion.BytesPerInterval != 49152 {
+					t.Fatalf("SSPIsoCompanion = %+v, want 49152 bytes per interval", eps[0].SSPIsoCompanion)
+				}
+				if eps[0].bytesPerInterval() != 49152 {
+					t.Errorf("bytesPerInterval() = %d, want 49152", eps[0].bytesPerInterval())
+				}
+				if eps[1].SSPIsoCompanion != nil {
+					t.Error("SSP companion parsed without the SuperSpeed companion announcing it")
+				}
+			},
+		},
 		{
 			name:    "config_too_short",
 			data:    "090220",
@@ -265,6 +311,25 @@ func TestConfigDescriptorHelpers(t *testing.T) {
 			t.Error("FindEndpoint(0x99) should return nil")
 		}
 	})
+
+	t.Run("Endpoint", func(t *testing.T) {
+		ep, ok := c.Endpoint(0, 0, TransferTypeInterrupt, EndpointDirectionIn)
+		if !ok || ep.EndpointAddr != 0x83 {
+			t.Errorf("Endpoint(0, 0, interrupt, IN) = %+v, %v, want 0x83", ep, ok)
+		}
+
+		ep, ok = c.Endpoint(1, 1, TransferTypeIsochronous, EndpointDirectionIn)
+		if !ok || ep.EndpointAddr != 0x81 {
+			t.Errorf("Endpoint(1, 1, iso, IN) = %+v, %v, want 0x81", ep, ok)
+		}
+
+		if _, ok := c.Endpoint(0, 0, TransferTypeInterrupt, EndpointDirectionOut); ok {
+			t.Error("Endpoint(0, 0, interrupt, OUT) should not be found")
+		}
+		if _, ok := c.Endpoint(1, 0, TransferTypeIsochronous, EndpointDirectionIn); ok {
+			t.Error("Endpoint(1, 0, iso, IN) should not be found in the zero-bandwidth alt setting")
+		}
+	})
 }
 
 func TestEndpointHelpers(t *testing.T) {
@@ -350,3 +415,336 @@ func TestEndpointHelpers(t *testing.T) {
 		})
 	}
 }
+
+func TestSSEndpointCompanion(t *testing.T) {
+	data, _ := hex.DecodeString(superSpeedCompanionConfig)
+
+	c := &ConfigDescriptor{}
+	if err := c.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	t.Run("inline", func(t *testing.T) {
+		comp, err := c.SSEndpointCompanion(0, 0, 0x81)
+		if err != nil {
+			t.Fatalf("SSEndpointCompanion(0, 0, 0x81) error = %v", err)
+		}
+		if comp.Length != 6 || comp.DescriptorType != USB_DT_SS_ENDPOINT_COMPANION {
+			t.Errorf("companion header = %d/%02x, want 6/%02x", comp.Length, comp.DescriptorType, USB_DT_SS_ENDPOINT_COMPANION)
+		}
+		if comp.MaxBurst != 0 || comp.Attributes != 0 || comp.BytesPerInterval != 0 {
+			t.Errorf("companion = %+v, want zero burst, attributes and bytes per interval", comp)
+		}
+	})
+
+	t.Run("extra", func(t *testing.T) {
+		ep := c.FindEndpoint(0x02)
+		if ep == nil {
+			t.Fatal("FindEndpoint(0x02) returned nil")
+		}
+		if ep.SSCompanion != nil {
+			t.Fatal("endpoint 0x02 should not have an inline companion")
+		}
+		// A vendor descriptor ahead of the companion must be skipped
+		ep.Extra, _ = hex.DecodeString("03ff00" + "063004000002")
+
+		comp, err := c.SSEndpointCompanion(0, 0, 0x02)
+		if err != nil {
+			t.Fatalf("SSEndpointCompanion(0, 0, 0x02) error = %v", err)
+		}
+		if comp.MaxBurst != 4 || comp.Attributes != 0 || comp.BytesPerInterval != 512 {
+			t.Errorf("companion = %+v, want MaxBurst 4, Attributes 0, BytesPerInterval 512", comp)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if _, err := c.SSEndpointCompanion(0, 0, 0x83); err == nil {
+			t.Error("SSEndpointCompanion for unknown endpoint should fail")
+		}
+		if _, err := c.SSEndpointCompanion(1, 0, 0x81); err == nil {
+			t.Error("SSEndpointCompanion for unknown interface should fail")
+		}
+	})
+}
+
+func TestEndpointSupportsStreams(t *testing.T) {
+	tests := []struct {
+		name        string
+		endpoint    string // hex encoded endpoint and companion descriptors
+		wantStreams int
+		want        bool
+	}{
+		{name: "no_companion", endpoint: "07058102000400"},
+		{name: "no_streams", endpoint: "07058102000400" + "06300f000000"},
+		{name: "uas", endpoint: "07058102000400" + "06300f050000", wantStreams: 32, want: true},
+		{name: "max", endpoint: "07058102000400" + "06300f100000", wantStreams: 65536, want: true},
+		{name: "reserved", endpoint: "07058102000400" + "06300f110000"},
+		{name: "interrupt", endpoint: "07058103000401" + "063000050004", wantStreams: 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString("09020000010100c032" + "0904000001ff010000" + tt.endpoint)
+			if err != nil {
+				t.Fatalf("bad test data: %v", err)
+			}
+			binary.LittleEndian.PutUint16(data[2:4], uint16(len(data)))
+			c := &ConfigDescriptor{}
+			if err := c.Unmarshal(data); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			ep := c.FindEndpoint(0x81)
+			if ep == nil {
+				t.Fatal("endpoint 0x81 not parsed")
+			}
+			if ep.SSCompanion != nil {
+				if got := ep.SSCompanion.MaxStreams(); got != tt.wantStreams {
+					t.Errorf("MaxStreams() = %d, want %d", got, tt.wantStreams)
+				}
+			}
+			if got := ep.SupportsStreams(); got != tt.want {
+				t.Errorf("SupportsStreams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpointDescriptorAttributes(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  EndpointDescriptor
+		wantDir   string
+		wantType  string
+		wantSync  string
+		wantUsage string
+	}{
+		{
+			name:      "bulk_in",
+			endpoint:  EndpointDescriptor{EndpointAddr: 0x81, Attributes: 0x02},
+			wantDir:   "IN",
+			wantType:  "Bulk",
+			wantSync:  "None",
+			wantUsage: "Data",
+		},
+		{
+			name:      "iso_out_adaptive",
+			endpoint:  EndpointDescriptor{EndpointAddr: 0x01, Attributes: 0x09},
+			wantDir:   "OUT",
+			wantType:  "Isochronous",
+			wantSync:  "Adaptive",
+			wantUsage: "Data",
+		},
+		{
+			name:      "iso_in_async_feedback",
+			endpoint:  EndpointDescriptor{EndpointAddr: 0x82, Attributes: 0x15},
+			wantDir:   "IN",
+			wantType:  "Isochronous",
+			wantSync:  "Asynchronous",
+			wantUsage: "Feedback",
+		},
+		{
+			name:      "iso_in_sync_implicit",
+			endpoint:  EndpointDescriptor{EndpointAddr: 0x83, Attributes: 0x2d},
+			wantDir:   "IN",
+			wantType:  "Isochronous",
+			wantSync:  "Synchronous",
+			wantUsage: "Implicit feedback",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.endpoint.Direction().String(); got != tt.wantDir {
+				t.Errorf("Direction() = %s, want %s", got, tt.wantDir)
+			}
+			if got := tt.endpoint.TransferType().String(); got != tt.wantType {
+				t.Errorf("TransferType() = %s, want %s", got, tt.wantType)
+			}
+			if got := tt.endpoint.SyncType().String(); got != tt.wantSync {
+				t.Errorf("SyncType() = %s, want %s", got, tt.wantSync)
+			}
+			if got := tt.endpoint.UsageType().String(); got != tt.wantUsage {
+				t.Errorf("UsageType() = %s, want %s", got, tt.wantUsage)
+			}
+		})
+	}
+}
+
+func TestInterfaceAltSettingSearch(t *testing.T) {
+	data, _ := hex.DecodeString(
+		"09023200010100c032" + // Config, 50 bytes total
+			"09040100000e020000" + // Interface 1, alt 0 (no endpoints)
+			"09040101010e020000" + // Interface 1, alt 1
+			"07058105000201" + // Endpoint 0x81, iso, 512 bytes
+			"09040102010e020000" + // Interface 1, alt 2
+			"07058105001401") // Endpoint 0x81, iso, 3 x 1024 bytes
+
+	c := &ConfigDescriptor{}
+	if err := c.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	iface := c.Interface(1)
+	if iface == nil {
+		t.Fatal("Interface(1) returned nil")
+	}
+
+	t.Run("BestIsoAltSetting", func(t *testing.T) {
+		alt, ok := iface.BestIsoAltSetting()
+		if !ok {
+			t.Fatal("BestIsoAltSetting() found no alt setting")
+		}
+		if alt.AlternateSetting != 2 {
+			t.Errorf("BestIsoAltSetting() = alt %d, want 2", alt.AlternateSetting)
+		}
+
+		bulkOnly := &Interface{AltSettings: []InterfaceAltSetting{{
+			Endpoints: []Endpoint{{EndpointAddr: 0x81, Attributes: 0x02, MaxPacketSize: 512}},
+		}}}
+		if _, ok := bulkOnly.BestIsoAltSetting(); ok {
+			t.Error("BestIsoAltSetting() found an alt setting without iso endpoints")
+		}
+	})
+
+	t.Run("EndpointInAnyAlt", func(t *testing.T) {
+		ep, alt, ok := iface.EndpointInAnyAlt(0x81)
+		if !ok {
+			t.Fatal("EndpointInAnyAlt(0x81) not found")
+		}
+		if alt.AlternateSetting != 1 || ep.MaxPacketSize != 512 {
+			t.Errorf("EndpointInAnyAlt(0x81) = alt %d, size %d, want alt 1, size 512", alt.AlternateSetting, ep.MaxPacketSize)
+		}
+
+		if _, _, ok := iface.EndpointInAnyAlt(0x02); ok {
+			t.Error("EndpointInAnyAlt(0x02) should not be found")
+		}
+	})
+}
+
+func TestConfigDescriptorCollections(t *testing.T) {
+	data, _ := hex.DecodeString(
+		"09023400030100c032" + // Config
+			"080b00020e030000" + // IAD: interfaces 0-1, video collection
+			"09040000000e010000" + // Interface 0, video control
+			"09040100000e020000" + // Interface 1, video streaming
+			"080b020201000000" + // IAD: interfaces 2-3, audio
+			"090402000001010000") // Interface 2, audio control
+
+	c := &ConfigDescriptor{}
+	if err := c.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	cols := c.Collections()
+	if len(cols) != 2 {
+		t.Fatalf("Collections() returned %d collections, want 2", len(cols))
+	}
+
+	video := cols[0]
+	if video.FunctionClass != 0x0e || video.FunctionSubClass != 0x03 {
+		t.Errorf("video collection class = %02x/%02x, want 0e/03", video.FunctionClass, video.FunctionSubClass)
+	}
+	if len(video.Interfaces) != 2 || video.Interfaces[0] != 0 || video.Interfaces[1] != 1 {
+		t.Errorf("video collection interfaces = %v, want [0 1]", video.Interfaces)
+	}
+	if alt := c.InterfaceAltSetting(1, 0); alt == nil || alt.InterfaceSubClass != 0x02 {
+		t.Errorf("interface 1 = %+v, want video streaming", alt)
+	}
+
+	audio := cols[1]
+	if audio.FunctionClass != 0x01 || audio.InterfaceCount != 2 {
+		t.Errorf("audio collection = %+v", audio.InterfaceAssocDescriptor)
+	}
+	if len(audio.Interfaces) != 1 || audio.Interfaces[0] != 2 {
+		t.Errorf("audio collection interfaces = %v, want [2], the only one present", audio.Interfaces)
+	}
+}
+
+func TestValidateConfigLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string // hex encoded
+		wantErr bool
+	}{
+		{
+			name: "exact",
+			data: "0902120001010080fa" + "090400000000000000",
+		},
+		{
+			name:    "truncated",
+			data:    "0902200001010080fa" + "090400000000000000",
+			wantErr: true,
+		},
+		{
+			name:    "trailing_bytes",
+			data:    "0902090001010080fa" + "0000",
+			wantErr: true,
+		},
+		{
+			name:    "too_short",
+			data:    "0902",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatalf("invalid test data: %v", err)
+			}
+			if err := ValidateConfigLength(data); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateConfigLength() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSplitConfigDescriptors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string // hex encoded
+		want    []int  // lengths of the configs
+		wantErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "two_configs",
+			data: "0902120001010080fa" + "090400000000000000" + "0902090000020080fa",
+			want: []int{18, 9},
+		},
+		{
+			name:    "truncated",
+			data:    "0902120001010080fa" + "0904",
+			wantErr: true,
+		},
+		{
+			name:    "not_config",
+			data:    "090400000000000000",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatalf("invalid test data: %v", err)
+			}
+			configs, err := splitConfigDescriptors(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitConfigDescriptors() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(configs) != len(tt.want) {
+				t.Fatalf("got %d configs, want %d", len(configs), len(tt.want))
+			}
+			for i, c := range configs {
+				if len(c) != tt.want[i] {
+					t.Errorf("config %d has %d bytes, want %d", i, len(c), tt.want[i])
+				}
+			}
+		})
+	}
+}
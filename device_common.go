@@ -1,6 +1,12 @@
 package usb
 
 import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,6 +19,15 @@ type controlSetupPacket struct {
 	wLength       uint16
 }
 
+// ControlSetup describes the setup stage of a control transfer submitted with
+// SubmitControl. The wLength field is taken from the length of the data buffer.
+type ControlSetup struct {
+	RequestType uint8
+	Request     uint8
+	Value       uint16
+	Index       uint16
+}
+
 // DeviceHandleInterface defines the common interface for device operations
 // that must be implemented by platform-specific code
 type DeviceHandleInterface interface {
@@ -23,6 +38,7 @@ type DeviceHandleInterface interface {
 	ReleaseInterface(iface uint8) error
 	SetAltSetting(iface, altSetting uint8) error
 	ClearHalt(endpoint uint8) error
+	ResetEndpoint(endpoint uint8) error
 	ResetDevice() error
 	KernelDriverActive(iface uint8) (bool, error)
 	DetachKernelDriver(iface uint8) error
@@ -35,3 +51,1216 @@ type DeviceHandleInterface interface {
 	GetActiveConfigDescriptor() (*ConfigDescriptor, error)
 	GetConfigDescriptor(index uint8) (*ConfigDescriptor, error)
 }
+
+// ActiveAltSettings returns the current alternate setting of every interface
+// in the active configuration, keyed by interface number. Interfaces whose
+// setting cannot be read (for example because another driver owns them) are
+// left out of the map.
+func (h *DeviceHandle) ActiveAltSettings() (map[uint8]uint8, error) {
+	config, err := h.GetActiveConfigDescriptor()
+	if err != nil {
+		return nil, err
+	}
+
+	alts := make(map[uint8]uint8, len(config.Interfaces))
+	var firstErr error
+	for i := range config.Interfaces {
+		if len(config.Interfaces[i].AltSettings) == 0 {
+			continue
+		}
+		iface := config.Interfaces[i].InterfaceNumber()
+		alt, err := h.Interface(iface)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		alts[iface] = alt
+	}
+
+	if len(alts) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return alts, nil
+}
+
+// ActiveEndpoints returns the endpoints of the alternate setting an interface
+// is currently in, as reported by the device with GET_INTERFACE, so that
+// code switching alternate settings (such as a UVC interface going from the
+// zero-bandwidth setting 0 to a streaming one) always transfers on endpoints
+// that exist. The returned slice is a copy.
+func (h *DeviceHandle) ActiveEndpoints(iface uint8) ([]Endpoint, error) {
+	config, err := h.GetActiveConfigDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	if config.Interface(iface) == nil {
+		return nil, fmt.Errorf("interface %d: %w", iface, ErrNotFound)
+	}
+
+	alt, err := h.Interface(iface)
+	if err != nil {
+		return nil, err
+	}
+	return altSettingEndpoints(config, iface, alt)
+}
+
+// altSettingEndpoints returns a copy of the endpoints of alternate setting
+// alt of iface
+func altSettingEndpoints(config *ConfigDescriptor, iface, alt uint8) ([]Endpoint, error) {
+	setting := config.InterfaceAltSetting(iface, alt)
+	if setting == nil {
+		return nil, fmt.Errorf("interface %d alternate setting %d: %w", iface, alt, ErrNotFound)
+	}
+	return append([]Endpoint(nil), setting.Endpoints...), nil
+}
+
+// HealthReport is the GET_STATUS view of a device and the interfaces claimed
+// through a handle, as returned by HealthSummary
+type HealthReport struct {
+	DeviceStatus uint16 // Raw device status word
+	SelfPowered  bool
+	RemoteWakeup bool // Remote wakeup is currently enabled
+
+	Interfaces []InterfaceHealth // Claimed interfaces, by interface number
+}
+
+// InterfaceHealth is the status of one claimed interface. Err is set when the
+// interface or its alternate setting could not be queried; the other fields
+// then hold what was read before the failure.
+type InterfaceHealth struct {
+	Number     uint8
+	AltSetting uint8
+	Status     uint16 // Raw interface status word
+	Err        error
+
+	Endpoints []EndpointHealth // Endpoints of the current alternate setting
+}
+
+// EndpointHealth is the status of one endpoint. Err is set when GET_STATUS
+// failed for the endpoint.
+type EndpointHealth struct {
+	Address uint8
+	Status  uint16 // Raw endpoint status word
+	Halted  bool
+	Err     error
+}
+
+// Halted returns the endpoints of the report that are halted
+func (r *HealthReport) Halted() []uint8 {
+	var halted []uint8
+	for _, iface := range r.Interfaces {
+		for _, ep := range iface.Endpoints {
+			if ep.Halted {
+				halted = append(halted, ep.Address)
+			}
+		}
+	}
+	return halted
+}
+
+// HealthSummary reads the status of the device, of every interface claimed
+// through the handle and of every endpoint in their current alternate
+// settings. Only a failure to read the device status is returned as an
+// error; failures for an interface or endpoint are recorded in its entry of
+// the report so that one misbehaving interface does not hide the others.
+func (h *DeviceHandle) HealthSummary() (HealthReport, error) {
+	var report HealthReport
+	status, err := h.GetStatus(uint16(RecipientDevice), 0)
+	if err != nil {
+		return report, fmt.Errorf("device status: %w", err)
+	}
+	report.DeviceStatus = status
+	report.SelfPowered = status&(1<<USB_DEVICE_SELF_POWERED) != 0
+	report.RemoteWakeup = status&(1<<USB_DEVICE_REMOTE_WAKEUP) != 0
+
+	h.mu.RLock()
+	claimed := make([]uint8, 0, len(h.claimedIfaces))
+	for iface := range h.claimedIfaces {
+		claimed = append(claimed, iface)
+	}
+	h.mu.RUnlock()
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i] < claimed[j] })
+
+	for _, iface := range claimed {
+		report.Interfaces = append(report.Interfaces, h.interfaceHealth(iface))
+	}
+	return report, nil
+}
+
+// interfaceHealth collects the status of a claimed interface and its
+// endpoints for HealthSummary
+func (h *DeviceHandle) interfaceHealth(iface uint8) InterfaceHealth {
+	health := InterfaceHealth{Number: iface}
+	status, err := h.GetStatus(uint16(RecipientInterface), uint16(iface))
+	if err != nil {
+		health.Err = fmt.Errorf("interface %d status: %w", iface, err)
+		return health
+	}
+	health.Status = status
+
+	if health.AltSetting, err = h.Interface(iface); err != nil {
+		health.Err = fmt.Errorf("interface %d alternate setting: %w", iface, err)
+		return health
+	}
+	config, err := h.GetActiveConfigDescriptor()
+	if err != nil {
+		health.Err = err
+		return health
+	}
+	endpoints, err := altSettingEndpoints(config, iface, health.AltSetting)
+	if err != nil {
+		health.Err = err
+		return health
+	}
+
+	for _, ep := range endpoints {
+		epHealth := EndpointHealth{Address: ep.EndpointAddr}
+		if epHealth.Status, err = h.GetStatus(uint16(RecipientEndpoint), uint16(ep.EndpointAddr)); err != nil {
+			epHealth.Err = err
+		} else {
+			epHealth.Halted = epHealth.Status&(1<<USB_ENDPOINT_HALT) != 0
+		}
+		health.Endpoints = append(health.Endpoints, epHealth)
+	}
+	return health
+}
+
+// checkStreamEndpoints returns an error unless every endpoint supports
+// streams in the alternate setting its interface is currently in, so that
+// AllocStreams can say which endpoint is at fault instead of passing on the
+// kernel's EINVAL. It returns the interface number of each endpoint.
+func (h *DeviceHandle) checkStreamEndpoints(endpoints []uint8) ([]uint8, error) {
+	config, err := h.GetActiveConfigDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	ifaces := make([]uint8, len(endpoints))
+	for i, addr := range endpoints {
+		ep, setting, err := h.currentEndpoint(config, addr)
+		if err != nil {
+			return nil, err
+		}
+		if !ep.SupportsStreams() {
+			return nil, fmt.Errorf("endpoint 0x%02x does not support streams: %w", addr, ErrNotSupported)
+		}
+		ifaces[i] = setting.InterfaceNumber
+	}
+	return ifaces, nil
+}
+
+// currentEndpoint returns the descriptor of endpoint addr in the alternate
+// setting its interface is currently in, and that alternate setting
+func (h *DeviceHandle) currentEndpoint(config *ConfigDescriptor, addr uint8) (*Endpoint, *InterfaceAltSetting, error) {
+	for i := range config.Interfaces {
+		iface := &config.Interfaces[i]
+		if _, _, ok := iface.EndpointInAnyAlt(addr); !ok {
+			continue
+		}
+		// Some devices stall GET_INTERFACE on an interface that has a single
+		// alternate setting; it is still in alt 0 from SET_CONFIGURATION
+		alt, err := h.Interface(iface.InterfaceNumber())
+		if errors.Is(err, ErrPipeStalled) {
+			alt = 0
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if setting := config.InterfaceAltSetting(iface.InterfaceNumber(), alt); setting != nil {
+			for j := range setting.Endpoints {
+				if setting.Endpoints[j].EndpointAddr == addr {
+					return &setting.Endpoints[j], setting, nil
+				}
+			}
+		}
+		break
+	}
+	return nil, nil, fmt.Errorf("endpoint 0x%02x: %w", addr, ErrNotFound)
+}
+
+// NewIsochronousTransferAuto creates an isochronous transfer whose packets
+// are as large as the endpoint allows at the speed the device is actually
+// running at. wMaxPacketSize of a high-speed endpoint can ask for up to three
+// transactions per microframe, but a high-speed device attached to a USB 1.1
+// port runs at full speed, where there are no high-bandwidth transactions
+// and a packet holds at most 1023 bytes. The endpoint is looked up in the
+// alternate setting its interface is currently in, so select the alternate
+// setting first.
+func (h *DeviceHandle) NewIsochronousTransferAuto(endpoint uint8, numPackets int) (*IsochronousTransfer, error) {
+	config, err := h.GetActiveConfigDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	ep, _, err := h.currentEndpoint(config, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if ep.TransferType() != TransferTypeIsochronous {
+		return nil, fmt.Errorf("endpoint 0x%02x is not isochronous: %w", endpoint, ErrInvalidParameter)
+	}
+
+	speed, err := h.GetSpeed()
+	if err != nil {
+		speed = SpeedUnknown
+	}
+	packetSize := isoPacketSize(ep, speed)
+	if packetSize == 0 {
+		return nil, fmt.Errorf("endpoint 0x%02x has no bandwidth in this alternate setting: %w", endpoint, ErrInvalidParameter)
+	}
+	return h.NewIsochronousTransfer(endpoint, numPackets, packetSize)
+}
+
+// isoPacketSize returns how many bytes an isochronous endpoint can move per
+// service interval at the given link speed. Without a known speed it trusts
+// the descriptors.
+func isoPacketSize(ep *Endpoint, speed Speed) int {
+	size := int(ep.MaxPacketSize & 0x7ff)
+	switch speed {
+	case SpeedLow, SpeedFull:
+		return min(size, 1023)
+	case SpeedHigh:
+		return size * (int(ep.MaxPacketSize>>11&0x03) + 1)
+	default:
+		return ep.bytesPerInterval()
+	}
+}
+
+// BulkIn reads from a bulk IN endpoint and returns the part of buf that was
+// filled by the device.
+func (h *DeviceHandle) BulkIn(endpoint uint8, buf []byte, timeout time.Duration) ([]byte, error) {
+	n, err := h.BulkTransfer(endpoint|uint8(EndpointDirectionIn), buf, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// InterruptIn reads from an interrupt IN endpoint and returns the part of buf
+// that was filled by the device.
+func (h *DeviceHandle) InterruptIn(endpoint uint8, buf []byte, timeout time.Duration) ([]byte, error) {
+	n, err := h.InterruptTransfer(endpoint|uint8(EndpointDirectionIn), buf, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// InterruptOut writes data to an interrupt OUT endpoint, such as a HID output
+// report, and returns the number of bytes sent. An IN endpoint address
+// returns ErrInvalidParameter rather than being sent to the OUT endpoint of
+// the same number.
+func (h *DeviceHandle) InterruptOut(endpoint uint8, data []byte, timeout time.Duration) (int, error) {
+	if endpoint&uint8(EndpointDirectionIn) != 0 {
+		return 0, ErrInvalidParameter
+	}
+	return h.InterruptTransfer(endpoint, data, timeout)
+}
+
+// ControlIn makes a device-to-host control request and returns the part of
+// buf the device filled. The direction bit is set on requestType, so only the
+// type and recipient need to be given, such as 0x41 for a vendor request to
+// an interface. An empty buf returns ErrInvalidParameter: a request without a
+// data stage has nothing to receive, and is made with ControlOut.
+func (h *DeviceHandle) ControlIn(requestType, request uint8, value, index uint16, buf []byte, timeout time.Duration) ([]byte, error) {
+	if len(buf) == 0 {
+		return nil, ErrInvalidParameter
+	}
+	n, err := h.ControlTransfer(requestType|uint8(EndpointDirectionIn), request, value, index, buf, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// ControlOut makes a host-to-device control request sending data, which is
+// empty for requests without a data stage, and returns the number of bytes
+// sent. A requestType with the direction bit set returns ErrInvalidParameter
+// instead of sending the request the wrong way.
+func (h *DeviceHandle) ControlOut(requestType, request uint8, value, index uint16, data []byte, timeout time.Duration) (int, error) {
+	if requestType&uint8(EndpointDirectionIn) != 0 {
+		return 0, ErrInvalidParameter
+	}
+	return h.ControlTransfer(requestType, request, value, index, data, timeout)
+}
+
+// WriteControlTransfer sends data to the device in the data stage of a
+// host-to-device control request and returns the number of bytes sent. It
+// is ControlOut for requests that must carry data: a requestType with the
+// direction bit set, or an empty data, returns ErrInvalidParameter.
+func (h *DeviceHandle) WriteControlTransfer(requestType, request uint8, value, index uint16, data []byte, timeout time.Duration) (int, error) {
+	if len(data) == 0 {
+		return 0, ErrInvalidParameter
+	}
+	return h.ControlOut(requestType, request, value, index, data, timeout)
+}
+
+// WithoutRootHubs returns an option that leaves the root hub of each bus out
+// of the list. Root hubs are included by default.
+func WithoutRootHubs() DeviceListOption {
+	return func(o *deviceListOptions) {
+		o.excludeRootHubs = true
+	}
+}
+
+// withoutRootHubs removes the root hubs from devices in place
+func withoutRootHubs(devices []*Device) []*Device {
+	kept := devices[:0]
+	for _, dev := range devices {
+		if !dev.IsRootHub() {
+			kept = append(kept, dev)
+		}
+	}
+	return kept
+}
+
+// IsRootHub reports whether the device is the root hub of its bus, that is a
+// hub (class 9) at address 1
+func (d *Device) IsRootHub() bool {
+	return d.Descriptor.DeviceClass == 9 && d.Address == 1
+}
+
+// DeviceListRetry enumerates devices like DeviceList, retrying up to attempts
+// times with the given backoff between tries when the enumeration itself
+// fails. Devices that cannot be read are skipped rather than failing the whole
+// list; the returned errors describe them, or describe every failed attempt
+// if no enumeration succeeded.
+func DeviceListRetry(attempts int, backoff time.Duration, opts ...DeviceListOption) ([]*Device, []error) {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var errs []error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+		}
+
+		devices, deviceErrs, err := deviceList(opts...)
+		if err == nil {
+			return devices, deviceErrs
+		}
+		errs = append(errs, fmt.Errorf("attempt %d: %w", i+1, err))
+	}
+
+	return nil, errs
+}
+
+// DeviceListFunc enumerates devices like DeviceList and returns those for
+// which match returns true, in enumeration order. Each device is passed to
+// match with its descriptor, path and topology already filled in, so it can
+// be selected on any of those without being opened.
+func DeviceListFunc(match func(*Device) bool, opts ...DeviceListOption) ([]*Device, error) {
+	devices, err := DeviceList(opts...)
+	if err != nil {
+		return nil, err
+	}
+	kept := devices[:0]
+	for _, dev := range devices {
+		if match(dev) {
+			kept = append(kept, dev)
+		}
+	}
+	return kept, nil
+}
+
+// HasBOS reports whether the device has a Binary Object Store descriptor.
+// BOS was introduced with bcdUSB 2.01, so older devices are not asked; any
+// newer device, including USB 2.1 devices at high speed, is probed by reading
+// the descriptor.
+func (h *DeviceHandle) HasBOS() bool {
+	if h.Descriptor().USBVersion < 0x0201 {
+		return false
+	}
+	_, err := h.RawBOSDescriptor()
+	return err == nil
+}
+
+// GetSSPlusCapability reads the SuperSpeedPlus USB device capability from the
+// BOS descriptor. Devices faster than 5 Gbps, such as Gen2 and Gen2x2
+// devices, report their lane speeds here rather than in the SuperSpeed
+// capability.
+func (h *DeviceHandle) GetSSPlusCapability() (*SuperSpeedPlusCapability, error) {
+	data, err := h.RawBOSDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	return parseSuperSpeedPlusCapability(data)
+}
+
+// GetSSPIsochEndpointCompanionDescriptor gets the SuperSpeedPlus isochronous
+// endpoint companion descriptor of an endpoint in the configuration at
+// configIndex, like SSEndpointCompanionDescriptor does for the SuperSpeed
+// companion. Its dwBytesPerInterval replaces wBytesPerInterval for endpoints
+// that need more than 48 KB per service interval.
+func (h *DeviceHandle) GetSSPIsochEndpointCompanionDescriptor(configIndex, interfaceNumber, altSetting, endpointAddress uint8) (*SSPIsochEndpointCompanion, error) {
+	config, err := h.ConfigDescriptorByIndex(configIndex)
+	if err != nil {
+		return nil, err
+	}
+	return config.SSPIsochEndpointCompanion(interfaceNumber, altSetting, endpointAddress)
+}
+
+// FindDevices returns every device with the given vendor and product ID,
+// sorted by bus number, then device address, then path. The position of a
+// device in the result is its device index: it stays the same between
+// enumerations as long as the devices remain attached, because addresses are
+// only assigned when a device is plugged in or reset.
+func FindDevices(vid, pid uint16) ([]*Device, error) {
+	matches, err := DeviceListFunc(func(dev *Device) bool {
+		return dev.Descriptor.VendorID == vid && dev.Descriptor.ProductID == pid
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortDevices(matches)
+
+	return matches, nil
+}
+
+// sortDevices orders devices by bus, address and path
+func sortDevices(devices []*Device) {
+	sort.Slice(devices, func(i, j int) bool {
+		a, b := devices[i], devices[j]
+		if a.Bus != b.Bus {
+			return a.Bus < b.Bus
+		}
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return a.Path < b.Path
+	})
+}
+
+// OpenDeviceN opens the device with index n among the devices matching the
+// vendor and product ID, as ordered by FindDevices
+func OpenDeviceN(vid, pid uint16, n int) (*DeviceHandle, error) {
+	devices, err := FindDevices(vid, pid)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n >= len(devices) {
+		return nil, ErrDeviceNotFound
+	}
+	return devices[n].Open()
+}
+
+// descriptorChunkSize bounds a single GET_DESCRIPTOR request made by
+// GetDescriptorChunked; some host controller stacks reject larger ones
+const descriptorChunkSize = 4096
+
+// descriptorFirstChunk is the length of the first request, which is what
+// Windows asks a configuration descriptor for first and so the length
+// devices are the most likely to handle
+const descriptorFirstChunk = 255
+
+// GetDescriptorChunked reads a descriptor of up to totalLen bytes, starting
+// with a 255 byte request and never asking for more than 4096 bytes. If
+// totalLen is 0 the length is taken from the descriptor header (wTotalLength
+// for configuration and BOS descriptors, bLength otherwise).
+//
+// GET_DESCRIPTOR always returns data from the start of the descriptor, so a
+// longer descriptor is read by repeating the request with a doubled length,
+// up to 4096 bytes, until the device returns less than was asked for or
+// totalLen is reached. If a larger request fails, the bytes read so far are
+// returned along with the error. A descriptor the device fills 4096 bytes of
+// returns those bytes and ErrNotSupported, as no request may read past them.
+func (h *DeviceHandle) GetDescriptorChunked(descType, index uint8, totalLen int) ([]byte, error) {
+	if totalLen <= 0 {
+		header := make([]byte, 9)
+		n, err := h.RawDescriptor(descType, index, 0, header)
+		if err != nil {
+			return nil, err
+		}
+		if totalLen, err = descriptorTotalLength(descType, header[:n]); err != nil {
+			return nil, err
+		}
+	}
+	if totalLen > 0xffff {
+		return nil, fmt.Errorf("descriptor length %d exceeds wLength: %w", totalLen, ErrInvalidParameter)
+	}
+
+	buf := make([]byte, totalLen)
+	size := min(totalLen, descriptorFirstChunk)
+	got := 0
+	for {
+		n, err := h.RawDescriptor(descType, index, 0, buf[:size])
+		if err != nil {
+			if got > 0 {
+				return buf[:got], fmt.Errorf("%d byte descriptor read failed after %d bytes: %w", size, got, err)
+			}
+			return nil, err
+		}
+		got = n
+		if n < size || size == totalLen {
+			return buf[:n], nil
+		}
+		next := min(size*2, totalLen, descriptorChunkSize)
+		if next == size {
+			return buf[:n], fmt.Errorf("descriptor is longer than the %d bytes of one request: %w", descriptorChunkSize, ErrNotSupported)
+		}
+		size = next
+	}
+}
+
+// descriptorTotalLength returns the full length of a descriptor from its header
+func descriptorTotalLength(descType uint8, header []byte) (int, error) {
+	switch descType {
+	case USB_DT_CONFIG, USB_DT_OTHER_SPEED_CONFIG, USB_DT_BOS:
+		if len(header) < 4 {
+			return 0, fmt.Errorf("descriptor header too short: %d bytes", len(header))
+		}
+		return int(binary.LittleEndian.Uint16(header[2:4])), nil
+	}
+	if len(header) < 1 {
+		return 0, fmt.Errorf("empty descriptor header")
+	}
+	return int(header[0]), nil
+}
+
+// GetStatusInto is GetStatus with a caller-provided response buffer of at
+// least 2 bytes. Reusing the buffer makes the request allocation-free, for
+// callers that poll status at a high rate.
+func (h *DeviceHandle) GetStatusInto(recipient, index uint16, buf []byte) (uint16, error) {
+	if len(buf) < 2 {
+		return 0, ErrInvalidParameter
+	}
+
+	requestType := uint8(0x80 | (recipient & 0x1F))
+	n, err := h.ControlTransfer(requestType, USB_REQ_GET_STATUS, 0, index, buf[:2], 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	if n < 2 {
+		return 0, ErrIO
+	}
+	return binary.LittleEndian.Uint16(buf), nil
+}
+
+// GetConfigurationInto asks the device for its current configuration with a
+// caller-provided response buffer of at least 1 byte, without allocating
+func (h *DeviceHandle) GetConfigurationInto(buf []byte) (int, error) {
+	if len(buf) < 1 {
+		return 0, ErrInvalidParameter
+	}
+
+	n, err := h.ControlTransfer(0x80, USB_REQ_GET_CONFIGURATION, 0, 0, buf[:1], 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, ErrIO
+	}
+	return int(buf[0]), nil
+}
+
+// GetRawDescriptorRecipient reads a descriptor with a standard GET_DESCRIPTOR
+// request addressed to the given recipient. Class descriptors such as the HID
+// report descriptor are requested from an interface, with wIndex holding the
+// interface number; endpoint recipients take the endpoint address.
+func (h *DeviceHandle) GetRawDescriptorRecipient(recipient Recipient, descType, descIndex uint8, wIndex uint16, data []byte) (int, error) {
+	requestType := 0x80 | uint8(recipient)&0x1F
+	value := uint16(descType)<<8 | uint16(descIndex)
+	return h.ControlTransfer(requestType, USB_REQ_GET_DESCRIPTOR, value, wIndex, data, 5*time.Second)
+}
+
+// AllStrings reads every string descriptor referenced by the device
+// descriptor and by the configuration and interface descriptors of every
+// configuration, keyed by string index. Each index is fetched once. Strings
+// the device fails to return are left out; an error is returned only if the
+// descriptors themselves cannot be read.
+func (h *DeviceHandle) AllStrings() (map[uint8]string, error) {
+	desc, err := h.readDeviceDescriptor()
+	if err != nil {
+		return nil, err
+	}
+
+	indices := []uint8{desc.ManufacturerIndex, desc.ProductIndex, desc.SerialNumberIndex}
+	for i := 0; i < int(desc.NumConfigurations); i++ {
+		data, err := h.GetDescriptorChunked(USB_DT_CONFIG, uint8(i), 0)
+		if err != nil {
+			return nil, fmt.Errorf("configuration %d: %w", i, err)
+		}
+		config := &ConfigDescriptor{}
+		if err := config.Unmarshal(data); err != nil {
+			return nil, fmt.Errorf("configuration %d: %w", i, err)
+		}
+
+		indices = append(indices, config.ConfigurationIndex)
+		for _, iface := range config.Interfaces {
+			for _, alt := range iface.AltSettings {
+				indices = append(indices, alt.InterfaceIndex)
+			}
+		}
+	}
+
+	strs := make(map[uint8]string)
+	tried := make(map[uint8]bool)
+	for _, index := range indices {
+		if index == 0 || tried[index] {
+			continue
+		}
+		tried[index] = true
+		if str, err := h.StringDescriptor(index); err == nil {
+			strs[index] = str
+		}
+	}
+	return strs, nil
+}
+
+// GetStringDescriptor is an alias for StringDescriptor
+func (h *DeviceHandle) GetStringDescriptor(index uint8) (string, error) {
+	return h.StringDescriptor(index)
+}
+
+// fetchStringDescriptor fetches a string descriptor with read, which issues
+// one GET_DESCRIPTOR request for len(buf) bytes and returns the number
+// received. Some stacks return the descriptor in two stages, so when the
+// first reply is shorter than its own bLength the descriptor is requested
+// again with exactly bLength bytes.
+func fetchStringDescriptor(read func(buf []byte) (int, error)) (string, error) {
+	buf := make([]byte, 255)
+	n, err := read(buf)
+	if err != nil {
+		return "", err
+	}
+	if n < 2 || buf[0] < 2 {
+		return "", fmt.Errorf("invalid string descriptor")
+	}
+
+	length := int(buf[0])
+	if n < length {
+		buf = make([]byte, length)
+		if n, err = read(buf); err != nil {
+			return "", err
+		}
+		if n < 2 {
+			return "", fmt.Errorf("invalid string descriptor")
+		}
+		length = min(length, n)
+	}
+	return decodeStringDescriptor(buf[:length]), nil
+}
+
+// decodeStringDescriptor returns the UTF-16LE text of a string descriptor,
+// stopping at the first NUL.
+func decodeStringDescriptor(data []byte) string {
+	units := make([]uint16, 0, (len(data)-2)/2)
+	for i := 2; i+1 < len(data); i += 2 {
+		units = append(units, binary.LittleEndian.Uint16(data[i:i+2]))
+	}
+	return string(utf16ToRunes(units))
+}
+
+// GetInterface is an alias for Interface, returning the current alternate
+// setting of an interface
+func (h *DeviceHandle) GetInterface(iface uint8) (uint8, error) {
+	return h.Interface(iface)
+}
+
+// ActiveConfigDescriptor is an alias for GetActiveConfigDescriptor
+func (h *DeviceHandle) ActiveConfigDescriptor() (*ConfigDescriptor, error) {
+	return h.GetActiveConfigDescriptor()
+}
+
+// ActiveRawConfigDescriptor returns the raw bytes of the active
+// configuration descriptor, with all of its interface, endpoint and class
+// descriptors, for parsers outside this package. The configuration is found
+// by its bConfigurationValue, as reported by GetConfiguration, rather than by
+// its index; an unconfigured device returns its first configuration, like
+// GetActiveConfigDescriptor. The bytes are what the device sent, without the
+// quirk fixups applied to the parsed descriptor.
+func (h *DeviceHandle) ActiveRawConfigDescriptor() ([]byte, error) {
+	value, err := h.GetConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	numConfigs := max(int(h.Descriptor().NumConfigurations), 1)
+	for i := 0; i < numConfigs; i++ {
+		data, err := h.RawConfigDescriptor(uint8(i))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 9 {
+			return nil, fmt.Errorf("config descriptor too short: %d bytes", len(data))
+		}
+		if value <= 0 || int(data[5]) == value {
+			return data, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ConfigDescriptorByIndex returns the parsed descriptor of the configuration
+// at index, counting from 0 up to bNumConfigurations-1 in the order the
+// device reports them, with any registered Quirk applied. This is
+// libusb_get_config_descriptor.
+func (h *DeviceHandle) ConfigDescriptorByIndex(index uint8) (*ConfigDescriptor, error) {
+	data, err := h.RawConfigDescriptor(index)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ConfigDescriptor{}
+	if err := config.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	if q, ok := h.quirk(); ok {
+		applyConfigQuirks(q, config)
+	}
+	return config, nil
+}
+
+// ConfigDescriptorByConfigValue returns the parsed descriptor of the
+// configuration whose bConfigurationValue is value, the number
+// SetConfiguration and GetConfiguration use. Devices usually number their
+// configurations from 1 in index order, but nothing requires it, so the
+// configurations are read until one matches. A value no configuration has
+// returns ErrNotFound. This is libusb_get_config_descriptor_by_value.
+func (h *DeviceHandle) ConfigDescriptorByConfigValue(value uint8) (*ConfigDescriptor, error) {
+	numConfigs := int(h.Descriptor().NumConfigurations)
+	for i := 0; i < numConfigs; i++ {
+		config, err := h.ConfigDescriptorByIndex(uint8(i))
+		if err != nil {
+			return nil, err
+		}
+		if config.ConfigurationValue == value {
+			return config, nil
+		}
+	}
+	return nil, fmt.Errorf("configuration value %d: %w", value, ErrNotFound)
+}
+
+// GetConfigDescriptor gets a configuration descriptor by index. It is the
+// same as ConfigDescriptorByIndex.
+func (h *DeviceHandle) GetConfigDescriptor(index uint8) (*ConfigDescriptor, error) {
+	return h.ConfigDescriptorByIndex(index)
+}
+
+// ConfigReadStats describes the last call to Configurations
+type ConfigReadStats struct {
+	Configs  int           // Number of configurations returned
+	Cached   bool          // Whether they came from the handle's cache
+	Duration time.Duration // Time spent reading and parsing them
+}
+
+// Configurations returns the parsed descriptor of every configuration of the
+// device, in index order. The device descriptor is consulted once for
+// bNumConfigurations and each configuration is fetched in the same pass; the
+// result is cached on the handle like GetActiveConfigDescriptor, so tools
+// walking the configurations of many devices, like lsusb -v, read each one
+// only once. ConfigurationStats reports how long the read took. The returned
+// descriptors are shared and must not be modified.
+func (h *DeviceHandle) Configurations() ([]*ConfigDescriptor, error) {
+	start := time.Now()
+	gen := h.refs.configGen.Load()
+
+	h.mu.Lock()
+	if h.configs != nil && h.configsGen == gen {
+		configs := h.configs
+		h.configStats = ConfigReadStats{Configs: len(configs), Cached: true, Duration: time.Since(start)}
+		h.mu.Unlock()
+		return configs, nil
+	}
+	h.mu.Unlock()
+
+	numConfigs := int(h.Descriptor().NumConfigurations)
+	configs := make([]*ConfigDescriptor, 0, numConfigs)
+	for i := 0; i < numConfigs; i++ {
+		config, err := h.ConfigDescriptorByIndex(uint8(i))
+		if err != nil {
+			return nil, fmt.Errorf("config descriptor %d: %w", i, err)
+		}
+		configs = append(configs, config)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.configStats = ConfigReadStats{Configs: len(configs), Duration: time.Since(start)}
+	if !h.closed && h.refs.configGen.Load() == gen {
+		h.configs = configs
+		h.configsGen = gen
+	}
+	return configs, nil
+}
+
+// ConfigurationStats returns how the last call to Configurations was served
+func (h *DeviceHandle) ConfigurationStats() ConfigReadStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.configStats
+}
+
+// InterfaceDescriptor returns alternate setting altSetting of interface
+// interfaceNumber in the configuration at configIndex, with its endpoints
+// and class-specific descriptors parsed. It reads through Configurations, so
+// looking up several interfaces costs one pass over the device. A
+// configuration, interface or alternate setting that does not exist returns
+// ErrNotFound. The returned setting is shared and must not be modified.
+func (h *DeviceHandle) InterfaceDescriptor(configIndex, interfaceNumber, altSetting uint8) (*InterfaceAltSetting, error) {
+	configs, err := h.Configurations()
+	if err != nil {
+		return nil, err
+	}
+	return findInterfaceDescriptor(configs, configIndex, interfaceNumber, altSetting)
+}
+
+func findInterfaceDescriptor(configs []*ConfigDescriptor, configIndex, interfaceNumber, altSetting uint8) (*InterfaceAltSetting, error) {
+	if int(configIndex) >= len(configs) {
+		return nil, fmt.Errorf("configuration index %d: %w", configIndex, ErrNotFound)
+	}
+	alt := configs[configIndex].InterfaceAltSetting(interfaceNumber, altSetting)
+	if alt == nil {
+		return nil, fmt.Errorf("interface %d alternate setting %d: %w", interfaceNumber, altSetting, ErrNotFound)
+	}
+	return alt, nil
+}
+
+// cachedActiveConfig returns the cached active configuration, if any, along
+// with the current configuration generation. The generation is shared by the
+// handle and its clones, so a configuration change made through any of them
+// makes the others' caches stale too.
+func (h *DeviceHandle) cachedActiveConfig() (*ConfigDescriptor, uint64) {
+	gen := h.refs.configGen.Load()
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.activeConfig != nil && h.configGen == gen {
+		return h.activeConfig, gen
+	}
+	return nil, gen
+}
+
+// storeActiveConfig caches config unless the configuration was changed since
+// gen was read
+func (h *DeviceHandle) storeActiveConfig(config *ConfigDescriptor, gen uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.closed && h.refs.configGen.Load() == gen {
+		h.activeConfig = config
+		h.configGen = gen
+	}
+}
+
+// invalidateActiveConfig drops the cached active configuration of the handle
+// and its clones. The caller must hold h.mu for writing.
+func (h *DeviceHandle) invalidateActiveConfig() {
+	h.activeConfig = nil
+	h.refs.configGen.Add(1)
+}
+
+// handleRefs counts the DeviceHandles sharing one open OS handle: the handle
+// returned by Open and its clones
+type handleRefs struct {
+	mu sync.Mutex
+	n  int
+
+	// configGen is bumped whenever the configuration or an alternate
+	// setting may have changed, invalidating every handle's cached config
+	configGen atomic.Uint64
+}
+
+func newHandleRefs() *handleRefs {
+	return &handleRefs{n: 1}
+}
+
+func (r *handleRefs) acquire() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.n++
+}
+
+// release drops a reference and reports whether it was the last one, after
+// which the OS handle must be closed
+func (r *handleRefs) release() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.n--
+	return r.n == 0
+}
+
+// EndpointPolicy controls how bulk transfers on an endpoint recover from a
+// stall. The policy of endpoint 0 applies to ControlTransfer instead, where
+// the device stalls requests it does not support. Such a protocol stall ends
+// with the next SETUP packet, so endpoint 0 needs no clearing: RetryAfterClear
+// alone retries the request, and AutoClearStall only sends
+// CLEAR_FEATURE(ENDPOINT_HALT) first for devices that halt their default
+// pipe, which USB 2.0 §9.4.5 does not recommend. Every endpoint, endpoint 0
+// included, starts out with the zero policy.
+type EndpointPolicy struct {
+	// AutoClearStall clears the halt of an endpoint after a transfer on it
+	// stalls, so that the next transfer does not fail as well. The stalled
+	// transfer still returns its error.
+	AutoClearStall bool
+
+	// RetryAfterClear repeats a stalled transfer once after its halt is
+	// cleared, returning the result of the second attempt. Only use it on
+	// endpoints where repeating a request is harmless.
+	RetryAfterClear bool
+}
+
+// endpointPolicy returns the policy set for endpoint with SetEndpointPolicy
+func (h *DeviceHandle) endpointPolicy(endpoint uint8) EndpointPolicy {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.policies[endpoint]
+}
+
+// storeEndpointPolicy records policy for endpoint. The caller must hold h.mu
+// for writing.
+func (h *DeviceHandle) storeEndpointPolicy(endpoint uint8, policy EndpointPolicy) {
+	if h.policies == nil {
+		h.policies = make(map[uint8]EndpointPolicy)
+	}
+	h.policies[endpoint] = policy
+}
+
+// recoverStall applies the policy of endpoint to a transfer that stalled
+// with err after moving n bytes, clearing the halt and calling retry if the
+// policy asks for it. Unless it is retried, the transfer's n is returned with
+// err, as the bytes before the stall were still transferred.
+func (h *DeviceHandle) recoverStall(endpoint uint8, n int, err error, retry func() (int, error)) (int, error) {
+	policy := h.endpointPolicy(endpoint)
+	if !policy.AutoClearStall {
+		return n, err
+	}
+	if clearErr := h.ClearHalt(endpoint); clearErr != nil {
+		return n, err
+	}
+	if !policy.RetryAfterClear {
+		return n, err
+	}
+	return retry()
+}
+
+// recoverControlStall applies the policy of endpoint 0 to a control transfer
+// that stalled with err. The retry is the SETUP that ends a protocol stall, so
+// CLEAR_FEATURE(ENDPOINT_HALT) is only sent when AutoClearStall asks for it.
+func (h *DeviceHandle) recoverControlStall(err error, timeout time.Duration, retry func() (int, error)) (int, error) {
+	policy := h.endpointPolicy(0)
+	if policy.AutoClearStall {
+		if _, clearErr := h.controlTransfer(0x02, USB_REQ_CLEAR_FEATURE, USB_ENDPOINT_HALT, 0, nil, timeout); clearErr != nil {
+			return 0, err
+		}
+	}
+	if !policy.RetryAfterClear {
+		return 0, err
+	}
+	return retry()
+}
+
+// ResetDevice resets the device. The effect is the same on every platform:
+// once it returns nil the handle is still open and usable, every interface
+// has been released and must be claimed again, the device is in its default
+// configuration (the first configuration descriptor, which the operating
+// system selects at enumeration), and the descriptors cached by the handle
+// have been read again. If the device comes back as a different device,
+// ErrDeviceNotFound is returned and the handle should be closed. It is the
+// only reset: usbfs, WinUSB and IOKit offer no lighter port reset that
+// avoids re-enumeration.
+func (h *DeviceHandle) ResetDevice() error {
+	if err := h.resetDevice(); err != nil {
+		return err
+	}
+
+	desc, err := h.readDeviceDescriptor()
+	if err != nil {
+		return err
+	}
+	if desc.VendorID != h.device.Descriptor.VendorID || desc.ProductID != h.device.Descriptor.ProductID {
+		return ErrDeviceNotFound
+	}
+	h.mu.Lock()
+	h.device.Descriptor = desc
+	h.mu.Unlock()
+
+	value, err := h.defaultConfigurationValue()
+	if err != nil {
+		return err
+	}
+	current, err := h.GetConfigurationForce()
+	if err != nil {
+		return err
+	}
+	if current != int(value) {
+		return h.SetConfiguration(int(value))
+	}
+	return nil
+}
+
+// readDeviceDescriptor reads the device descriptor from the device itself
+func (h *DeviceHandle) readDeviceDescriptor() (DeviceDescriptor, error) {
+	buf := make([]byte, 18)
+	n, err := h.ControlTransfer(0x80, USB_REQ_GET_DESCRIPTOR, USB_DT_DEVICE<<8, 0, buf, 5*time.Second)
+	if err != nil {
+		return DeviceDescriptor{}, err
+	}
+	if n < 18 {
+		return DeviceDescriptor{}, fmt.Errorf("short device descriptor: %d bytes", n)
+	}
+
+	return DeviceDescriptor{
+		Length:            buf[0],
+		DescriptorType:    buf[1],
+		USBVersion:        binary.LittleEndian.Uint16(buf[2:4]),
+		DeviceClass:       buf[4],
+		DeviceSubClass:    buf[5],
+		DeviceProtocol:    buf[6],
+		MaxPacketSize0:    buf[7],
+		VendorID:          binary.LittleEndian.Uint16(buf[8:10]),
+		ProductID:         binary.LittleEndian.Uint16(buf[10:12]),
+		DeviceVersion:     binary.LittleEndian.Uint16(buf[12:14]),
+		ManufacturerIndex: buf[14],
+		ProductIndex:      buf[15],
+		SerialNumberIndex: buf[16],
+		NumConfigurations: buf[17],
+	}, nil
+}
+
+// defaultConfigurationValue returns the bConfigurationValue of the first
+// configuration descriptor
+func (h *DeviceHandle) defaultConfigurationValue() (uint8, error) {
+	buf := make([]byte, 9)
+	n, err := h.ControlTransfer(0x80, USB_REQ_GET_DESCRIPTOR, USB_DT_CONFIG<<8, 0, buf, 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	if n < 9 {
+		return 0, fmt.Errorf("short configuration descriptor: %d bytes", n)
+	}
+	return buf[5], nil
+}
+
+// DefaultConfigurationValue returns the bConfigurationValue of the device's
+// first configuration descriptor, which is the configuration the operating
+// system selects at enumeration. Where the descriptors are available without
+// opening the device (sysfs on Linux) they are used; otherwise the device is
+// opened briefly to read them.
+func (d *Device) DefaultConfigurationValue() (uint8, error) {
+	if value, ok := d.cachedDefaultConfigurationValue(); ok {
+		return value, nil
+	}
+
+	h, err := d.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer h.Close()
+	return h.defaultConfigurationValue()
+}
+
+// InterfaceClasses returns the distinct bInterfaceClass values of the
+// interfaces in the device's active configuration, in ascending order. This
+// is how composite devices with a device class of 0 are classified. Where
+// the operating system publishes the interfaces (sysfs on Linux, the
+// IORegistry on macOS) no I/O is done; otherwise the device is opened
+// briefly to read its configuration descriptor.
+func (d *Device) InterfaceClasses() ([]uint8, error) {
+	if classes, ok := d.cachedInterfaceClasses(); ok {
+		return distinctClasses(classes), nil
+	}
+
+	h, err := d.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer h.Close()
+
+	config, err := h.GetActiveConfigDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	var classes []uint8
+	for _, iface := range config.Interfaces {
+		for _, alt := range iface.AltSettings {
+			classes = append(classes, alt.InterfaceClass)
+		}
+	}
+	return distinctClasses(classes), nil
+}
+
+// HasClass reports whether the device, or one of the interfaces of its
+// active configuration, has the given class code. Interfaces that cannot be
+// read count as not matching.
+func (d *Device) HasClass(class uint8) bool {
+	if d.Descriptor.DeviceClass == class {
+		return true
+	}
+	classes, err := d.InterfaceClasses()
+	if err != nil {
+		return false
+	}
+	for _, c := range classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// distinctClasses sorts classes and removes duplicates
+func distinctClasses(classes []uint8) []uint8 {
+	sort.Slice(classes, func(i, j int) bool { return classes[i] < classes[j] })
+	kept := classes[:0]
+	for i, c := range classes {
+		if i == 0 || c != classes[i-1] {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// OpenOption is a functional option for configuring Open behavior.
+type OpenOption func(*openOptions)
+
+// openOptions holds the configuration for Open.
+type openOptions struct {
+	autoConfigure bool
+}
+
+// WithAutoConfigure returns an option that makes Open select the device's
+// default configuration when the device is unconfigured or in a different
+// configuration. Open fails if the configuration cannot be changed, for
+// example because a kernel driver holds one of the interfaces.
+func WithAutoConfigure() OpenOption {
+	return func(o *openOptions) {
+		o.autoConfigure = true
+	}
+}
+
+// applyOpenOptions applies the options passed to Open to a freshly opened
+// handle
+func (h *DeviceHandle) applyOpenOptions(opts []OpenOption) error {
+	options := &openOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if !options.autoConfigure {
+		return nil
+	}
+	value, err := h.defaultConfigurationValue()
+	if err != nil {
+		return err
+	}
+	current, err := h.GetConfigurationForce()
+	if err != nil {
+		return err
+	}
+	if current != int(value) {
+		return h.SetConfiguration(int(value))
+	}
+	return nil
+}
+
+// utf16ToRunes converts UTF-16 to runes, stopping at the first NUL
+func utf16ToRunes(u16 []uint16) []rune {
+	runes := make([]rune, 0, len(u16))
+	for _, v := range u16 {
+		if v == 0 {
+			break
+		}
+		runes = append(runes, rune(v))
+	}
+	return runes
+}
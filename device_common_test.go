@@ -0,0 +1,595 @@
+package usb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActiveConfigCacheInvalidation(t *testing.T) {
+	h := &DeviceHandle{refs: newHandleRefs()}
+	clone := &DeviceHandle{refs: h.refs}
+
+	config1 := &ConfigDescriptor{ConfigurationValue: 1}
+	_, gen := h.cachedActiveConfig()
+	h.storeActiveConfig(config1, gen)
+	_, cloneGen := clone.cachedActiveConfig()
+	clone.storeActiveConfig(config1, cloneGen)
+
+	if got, _ := h.cachedActiveConfig(); got != config1 {
+		t.Fatalf("cachedActiveConfig() = %v, want configuration 1", got)
+	}
+
+	// SetConfiguration through the clone must make both caches stale
+	clone.mu.Lock()
+	clone.invalidateActiveConfig()
+	clone.mu.Unlock()
+
+	for name, handle := range map[string]*DeviceHandle{"handle": h, "clone": clone} {
+		if got, _ := handle.cachedActiveConfig(); got != nil {
+			t.Errorf("%s: cachedActiveConfig() after invalidation = configuration %d, want none", name, got.ConfigurationValue)
+		}
+	}
+
+	// A descriptor read before the change must not be cached after it
+	h.storeActiveConfig(config1, gen)
+	if got, _ := h.cachedActiveConfig(); got != nil {
+		t.Errorf("stale store cached configuration %d", got.ConfigurationValue)
+	}
+
+	config2 := &ConfigDescriptor{ConfigurationValue: 2}
+	_, gen = h.cachedActiveConfig()
+	h.storeActiveConfig(config2, gen)
+	if got, _ := h.cachedActiveConfig(); got != config2 {
+		t.Errorf("cachedActiveConfig() = %v, want configuration 2", got)
+	}
+}
+
+func TestConfigurationsCacheInvalidation(t *testing.T) {
+	config1, _ := hex.DecodeString("090212000101008032" + "0904000000ff000000")
+	config2, _ := hex.DecodeString("090212000102008032" + "0904000000ff000000")
+	dev := &MockDevice{
+		Bus:        1,
+		Address:    5,
+		Descriptor: DeviceDescriptor{NumConfigurations: 2},
+		Configs:    [][]byte{config1, config2},
+	}
+	h := openMockHandle(t, dev)
+
+	read := func(want bool) []*ConfigDescriptor {
+		t.Helper()
+		configs, err := h.Configurations()
+		if err != nil || len(configs) != 2 {
+			t.Fatalf("Configurations() = %v, %v, want two configurations", configs, err)
+		}
+		if stats := h.ConfigurationStats(); stats.Cached != want || stats.Configs != 2 {
+			t.Errorf("ConfigurationStats() = %+v, want Cached %v", stats, want)
+		}
+		return configs
+	}
+	first := read(false)
+	if got := read(true); got[0] != first[0] {
+		t.Error("cached Configurations() returned new descriptors")
+	}
+
+	// SetConfiguration makes the cache stale
+	if err := h.SetConfiguration(2); err != nil {
+		t.Fatalf("SetConfiguration() error = %v", err)
+	}
+	read(false)
+	read(true)
+
+	// So does a configuration change through a handle sharing the device
+	clone := &DeviceHandle{refs: h.refs}
+	clone.mu.Lock()
+	clone.invalidateActiveConfig()
+	clone.mu.Unlock()
+	read(false)
+}
+
+func TestFetchStringDescriptor(t *testing.T) {
+	// A 200-byte descriptor: bLength, bDescriptorType and 99 UTF-16LE units
+	want := strings.Repeat("a", 99)
+	desc := []byte{200, 0x03}
+	for _, r := range want {
+		desc = append(desc, byte(r), 0)
+	}
+
+	tests := []struct {
+		name      string
+		firstRead int
+		wantSizes []int
+	}{
+		{"complete", len(desc), []int{255}},
+		{"two stage", 8, []int{255, 200}},
+		{"header only", 2, []int{255, 200}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sizes []int
+			read := func(buf []byte) (int, error) {
+				sizes = append(sizes, len(buf))
+				n := len(desc)
+				if len(sizes) == 1 {
+					n = tt.firstRead
+				}
+				return copy(buf, desc[:min(n, len(buf))]), nil
+			}
+
+			got, err := fetchStringDescriptor(read)
+			if err != nil {
+				t.Fatalf("fetchStringDescriptor() error = %v", err)
+			}
+			if got != want {
+				t.Errorf("fetchStringDescriptor() = %q (%d chars), want %d chars", got, len(got), len(want))
+			}
+			if len(sizes) != len(tt.wantSizes) {
+				t.Fatalf("request sizes = %v, want %v", sizes, tt.wantSizes)
+			}
+			for i := range sizes {
+				if sizes[i] != tt.wantSizes[i] {
+					t.Errorf("request sizes = %v, want %v", sizes, tt.wantSizes)
+				}
+			}
+		})
+	}
+
+	short := func(buf []byte) (int, error) { return copy(buf, []byte{4}), nil }
+	if _, err := fetchStringDescriptor(short); err == nil {
+		t.Error("fetchStringDescriptor() with a 1-byte reply succeeded, want error")
+	}
+}
+
+func TestRecoverControlStall(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *EndpointPolicy
+		want   []uint8 // bRequest of each request the device sees
+		ok     bool
+	}{
+		{name: "default", want: []uint8{0x10}},
+		{name: "retry", policy: &EndpointPolicy{RetryAfterClear: true}, want: []uint8{0x10, 0x10}, ok: true},
+		{name: "clear_only", policy: &EndpointPolicy{AutoClearStall: true}, want: []uint8{0x10, USB_REQ_CLEAR_FEATURE}},
+		{name: "clear_and_retry", policy: &EndpointPolicy{AutoClearStall: true, RetryAfterClear: true}, want: []uint8{0x10, USB_REQ_CLEAR_FEATURE, 0x10}, ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The vendor request stalls the first time it is made
+			var requests []uint8
+			dev := &MockDevice{
+				Bus:     1,
+				Address: 7,
+				Control: func(requestType, request uint8, value, index uint16, data []byte) (int, error) {
+					requests = append(requests, request)
+					if request == USB_REQ_CLEAR_FEATURE {
+						if requestType != 0x02 || value != USB_ENDPOINT_HALT || index != 0 {
+							t.Errorf("CLEAR_FEATURE(0x%02x, %d, %d), want ENDPOINT_HALT of endpoint 0", requestType, value, index)
+						}
+						return 0, nil
+					}
+					if len(requests) == 1 {
+						return 0, ErrPipeStalled
+					}
+					return copy(data, "ok"), nil
+				},
+			}
+			h := openMockHandle(t, dev)
+
+			if tt.policy != nil {
+				if err := h.SetEndpointPolicy(0, *tt.policy); err != nil {
+					t.Fatalf("SetEndpointPolicy(0) error = %v", err)
+				}
+			}
+			buf := make([]byte, 2)
+			n, err := h.ControlTransfer(0xc0, 0x10, 0, 0, buf, time.Second)
+			if tt.ok && (err != nil || string(buf[:n]) != "ok") {
+				t.Errorf("ControlTransfer() = %q, %v, want \"ok\"", buf[:n], err)
+			}
+			if !tt.ok && !errors.Is(err, ErrPipeStalled) {
+				t.Errorf("ControlTransfer() error = %v, want ErrPipeStalled", err)
+			}
+			if string(requests) != string(tt.want) {
+				t.Errorf("device saw requests %x, want %x", requests, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecoverBulkStall(t *testing.T) {
+	// 0x81 stalls after 3 bytes whenever stall is set
+	var stall bool
+	calls := 0
+	dev := &MockDevice{
+		Bus:     1,
+		Address: 5,
+		Endpoints: map[uint8]func([]byte) (int, error){
+			0x81: func(data []byte) (int, error) {
+				calls++
+				if stall {
+					stall = false
+					return copy(data, "abc"), ErrPipeStalled
+				}
+				return copy(data, "ok"), nil
+			},
+		},
+	}
+	h := openMockHandle(t, dev)
+
+	tests := []struct {
+		name       string
+		policy     EndpointPolicy
+		want       string
+		wantErr    bool
+		wantCalls  int
+		wantHalted bool
+	}{
+		{name: "left_halted", want: "abc", wantErr: true, wantCalls: 1, wantHalted: true},
+		{name: "cleared", policy: EndpointPolicy{AutoClearStall: true}, want: "abc", wantErr: true, wantCalls: 1},
+		{name: "retried", policy: EndpointPolicy{AutoClearStall: true, RetryAfterClear: true}, want: "ok", wantCalls: 2},
+		// Without the clear the retry would only stall on the halt again
+		{name: "retry_without_clear", policy: EndpointPolicy{RetryAfterClear: true}, want: "abc", wantErr: true, wantCalls: 1, wantHalted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.SetEndpointPolicy(0x81, tt.policy); err != nil {
+				t.Fatalf("SetEndpointPolicy() error = %v", err)
+			}
+			if err := h.ClearHalt(0x81); err != nil {
+				t.Fatalf("ClearHalt() error = %v", err)
+			}
+			stall, calls = true, 0
+
+			buf := make([]byte, 8)
+			n, err := h.BulkTransfer(0x81, buf, time.Second)
+			if (err != nil) != tt.wantErr || tt.wantErr && !errors.Is(err, ErrPipeStalled) {
+				t.Errorf("BulkTransfer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(buf[:n]) != tt.want {
+				t.Errorf("BulkTransfer() = %q, want %q", buf[:n], tt.want)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("endpoint called %d times, want %d", calls, tt.wantCalls)
+			}
+			if dev.Halted(0x81) != tt.wantHalted {
+				t.Errorf("Halted() = %v, want %v", dev.Halted(0x81), tt.wantHalted)
+			}
+		})
+	}
+
+	// A halted endpoint keeps stalling until the caller clears it
+	h.SetEndpointPolicy(0x81, EndpointPolicy{})
+	h.ClearHalt(0x81)
+	stall, calls = true, 0
+	buf := make([]byte, 8)
+	h.BulkTransfer(0x81, buf, time.Second)
+	if _, err := h.BulkTransfer(0x81, buf, time.Second); !errors.Is(err, ErrPipeStalled) || calls != 1 {
+		t.Errorf("BulkTransfer() on a halted endpoint = %v after %d calls, want ErrPipeStalled after 1", err, calls)
+	}
+	if err := h.ClearHalt(0x81); err != nil {
+		t.Fatalf("ClearHalt() error = %v", err)
+	}
+	if n, err := h.BulkTransfer(0x81, buf, time.Second); err != nil || string(buf[:n]) != "ok" {
+		t.Errorf("BulkTransfer() after ClearHalt = %q, %v, want \"ok\"", buf[:n], err)
+	}
+
+	h.Close()
+	if err := h.SetEndpointPolicy(0x81, EndpointPolicy{}); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("SetEndpointPolicy() on a closed handle error = %v, want ErrDeviceNotFound", err)
+	}
+}
+
+func TestCheckStreamEndpoints(t *testing.T) {
+	config, _ := hex.DecodeString("09022c00010100c032" +
+		"0904000002ff010000" + // Interface 0, alt 0 only
+		"07058102000400" + "06300f050000" + // Bulk IN 0x81 with 32 streams
+		"07050202000400" + "06300f000000") // Bulk OUT 0x02 without streams
+	dev := &MockDevice{
+		Bus:        1,
+		Address:    5,
+		Descriptor: DeviceDescriptor{NumConfigurations: 1},
+		Configs:    [][]byte{config},
+	}
+	h := openMockHandle(t, dev)
+	if err := h.SetConfiguration(1); err != nil {
+		t.Fatalf("SetConfiguration() error = %v", err)
+	}
+
+	for _, stall := range []bool{false, true} {
+		dev.StallGetInterface = stall
+		if ifaces, err := h.checkStreamEndpoints([]uint8{0x81}); err != nil || !slices.Equal(ifaces, []uint8{0}) {
+			t.Errorf("checkStreamEndpoints(0x81) with GET_INTERFACE stalling %v = %v, %v, want [0]", stall, ifaces, err)
+		}
+		if _, err := h.checkStreamEndpoints([]uint8{0x81, 0x02}); !errors.Is(err, ErrNotSupported) {
+			t.Errorf("checkStreamEndpoints(0x02) with GET_INTERFACE stalling %v error = %v, want ErrNotSupported", stall, err)
+		}
+	}
+	if _, err := h.checkStreamEndpoints([]uint8{0x83}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("checkStreamEndpoints(0x83) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestHealthSummary(t *testing.T) {
+	config, _ := hex.DecodeString("090239000201008032" +
+		"0904000002ff000000" + "0705810240000a" + "0705020240000a" + // Interface 0: bulk 0x81 and 0x02
+		"0904010000ff000000" + // Interface 1, alt 0 without endpoints
+		"0904010101ff000000" + "0705830340000a") // Its alternate setting 1: interrupt IN 0x83
+	deviceStatus := uint16(1<<USB_DEVICE_SELF_POWERED | 1<<USB_DEVICE_REMOTE_WAKEUP)
+	stallDevice := false
+	dev := &MockDevice{
+		Bus:        1,
+		Address:    5,
+		Descriptor: DeviceDescriptor{NumConfigurations: 1},
+		Configs:    [][]byte{config},
+		Control: func(requestType, request uint8, value, index uint16, data []byte) (int, error) {
+			if request != USB_REQ_GET_STATUS || len(data) < 2 {
+				return 0, ErrPipeStalled
+			}
+			var status uint16
+			switch {
+			case requestType == 0x80 && !stallDevice:
+				status = deviceStatus
+			case requestType == 0x81 && index <= 1:
+			case requestType == 0x82 && index == 0x02:
+				status = 1 << USB_ENDPOINT_HALT
+			case requestType == 0x82 && index == 0x81:
+			default:
+				return 0, ErrPipeStalled
+			}
+			binary.LittleEndian.PutUint16(data, status)
+			return 2, nil
+		},
+	}
+	h := openMockHandle(t, dev)
+	if err := h.SetConfiguration(1); err != nil {
+		t.Fatalf("SetConfiguration() error = %v", err)
+	}
+	for _, iface := range []uint8{1, 0} {
+		if err := h.ClaimInterface(iface); err != nil {
+			t.Fatalf("ClaimInterface(%d) error = %v", iface, err)
+		}
+	}
+	if err := h.SetInterfaceAltSetting(1, 1); err != nil {
+		t.Fatalf("SetInterfaceAltSetting() error = %v", err)
+	}
+
+	report, err := h.HealthSummary()
+	if err != nil {
+		t.Fatalf("HealthSummary() error = %v", err)
+	}
+	if report.DeviceStatus != deviceStatus || !report.SelfPowered || !report.RemoteWakeup {
+		t.Errorf("HealthSummary() device = %#04x, self powered %v, remote wakeup %v, want %#04x, true, true",
+			report.DeviceStatus, report.SelfPowered, report.RemoteWakeup, deviceStatus)
+	}
+	if len(report.Interfaces) != 2 || report.Interfaces[0].Number != 0 || report.Interfaces[1].Number != 1 {
+		t.Fatalf("HealthSummary() interfaces = %+v, want 0 and 1", report.Interfaces)
+	}
+
+	// Interface 0 is in alt 0, with 0x02 halted
+	if iface := report.Interfaces[0]; iface.Err != nil || iface.AltSetting != 0 || len(iface.Endpoints) != 2 {
+		t.Errorf("interface 0 = %+v, want alt 0 with two endpoints", iface)
+	}
+	if got := report.Halted(); !slices.Equal(got, []uint8{0x02}) {
+		t.Errorf("Halted() = %#x, want [0x02]", got)
+	}
+
+	// Interface 1 reports the endpoint of alt 1, whose status stalls
+	iface := report.Interfaces[1]
+	if iface.Err != nil || iface.AltSetting != 1 || len(iface.Endpoints) != 1 {
+		t.Fatalf("interface 1 = %+v, want alt 1 with one endpoint", iface)
+	}
+	if ep := iface.Endpoints[0]; ep.Address != 0x83 || !errors.Is(ep.Err, ErrPipeStalled) || ep.Halted {
+		t.Errorf("endpoint 0x83 = %+v, want a stalled GET_STATUS", ep)
+	}
+
+	// GET_INTERFACE failing is recorded for the interface alone
+	dev.StallGetInterface = true
+	report, err = h.HealthSummary()
+	if err != nil {
+		t.Fatalf("HealthSummary() with GET_INTERFACE stalling error = %v", err)
+	}
+	for _, iface := range report.Interfaces {
+		if !errors.Is(iface.Err, ErrPipeStalled) || iface.Endpoints != nil {
+			t.Errorf("interface %d with GET_INTERFACE stalling = %+v, want ErrPipeStalled", iface.Number, iface)
+		}
+	}
+	dev.StallGetInterface = false
+
+	stallDevice = true
+	if _, err := h.HealthSummary(); !errors.Is(err, ErrPipeStalled) {
+		t.Errorf("HealthSummary() with the device status stalling error = %v, want ErrPipeStalled", err)
+	}
+}
+
+func TestControlInOut(t *testing.T) {
+	var gotType uint8
+	var received []byte
+	dev := &MockDevice{
+		Bus:     1,
+		Address: 5,
+		Control: func(requestType, request uint8, value, index uint16, data []byte) (int, error) {
+			gotType = requestType
+			if requestType&0x80 != 0 {
+				return copy(data, "in"), nil
+			}
+			received = append([]byte(nil), data...)
+			return len(data), nil
+		},
+	}
+	h := openMockHandle(t, dev)
+
+	got, err := h.ControlIn(0x41, 0x01, 0, 0, make([]byte, 8), time.Second)
+	if err != nil || string(got) != "in" || gotType != 0xc1 {
+		t.Errorf("ControlIn(0x41) = %q, %v with bmRequestType 0x%02x, want \"in\" with 0xc1", got, err, gotType)
+	}
+	if _, err := h.ControlIn(0x41, 0x01, 0, 0, nil, time.Second); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("ControlIn() without a buffer error = %v, want ErrInvalidParameter", err)
+	}
+
+	if n, err := h.ControlOut(0x41, 0x02, 0, 0, []byte("out"), time.Second); err != nil || n != 3 || string(received) != "out" || gotType != 0x41 {
+		t.Errorf("ControlOut(0x41) = %d, %v; device got %q with bmRequestType 0x%02x", n, err, received, gotType)
+	}
+	if got, err := h.ControlIn(0xc1, 0x01, 0, 0, make([]byte, 8), time.Second); err != nil || string(got) != "in" || gotType != 0xc1 {
+		t.Errorf("ControlIn(0xc1) = %q, %v with bmRequestType 0x%02x, want \"in\" with 0xc1", got, err, gotType)
+	}
+
+	// A device-to-host request type must not be sent as a write
+	received = nil
+	if _, err := h.ControlOut(0xc1, 0x02, 0, 0, []byte("out"), time.Second); !errors.Is(err, ErrInvalidParameter) || received != nil {
+		t.Errorf("ControlOut(0xc1) error = %v, device got %q, want ErrInvalidParameter and nothing sent", err, received)
+	}
+	if _, err := h.WriteControlTransfer(0xc1, 0x02, 0, 0, []byte("out"), time.Second); !errors.Is(err, ErrInvalidParameter) || received != nil {
+		t.Errorf("WriteControlTransfer(0xc1) error = %v, device got %q, want ErrInvalidParameter and nothing sent", err, received)
+	}
+	if _, err := h.WriteControlTransfer(0x41, 0x02, 0, 0, nil, time.Second); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("WriteControlTransfer() without data error = %v, want ErrInvalidParameter", err)
+	}
+	if n, err := h.WriteControlTransfer(0x41, 0x02, 0, 0, []byte("write"), time.Second); err != nil || n != 5 || string(received) != "write" || gotType != 0x41 {
+		t.Errorf("WriteControlTransfer(0x41) = %d, %v; device got %q with bmRequestType 0x%02x", n, err, received, gotType)
+	}
+
+	if _, err := h.ControlTransfer(0x41, 0x02, 0, 0, make([]byte, 0x10000), time.Second); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("ControlTransfer() of more than wLength can hold error = %v, want ErrInvalidParameter", err)
+	}
+}
+
+func TestGetDescriptorChunked(t *testing.T) {
+	// A BOS descriptor of bosLength bytes, answered through Control
+	var bosLength int
+	var requests []int
+	dev := &MockDevice{
+		Bus:     1,
+		Address: 5,
+		Control: func(requestType, request uint8, value, index uint16, data []byte) (int, error) {
+			if requestType != 0x80 || request != USB_REQ_GET_DESCRIPTOR || value != USB_DT_BOS<<8 {
+				return 0, ErrPipeStalled
+			}
+			requests = append(requests, len(data))
+			bos := make([]byte, bosLength)
+			bos[0], bos[1] = 5, USB_DT_BOS
+			binary.LittleEndian.PutUint16(bos[2:4], uint16(bosLength))
+			return copy(data, bos), nil
+		},
+	}
+	h := openMockHandle(t, dev)
+
+	tests := []struct {
+		name         string
+		bosLength    int
+		totalLen     int
+		wantLen      int
+		wantRequests []int
+		wantErr      error
+	}{
+		{name: "one_request", bosLength: 200, totalLen: 200, wantLen: 200, wantRequests: []int{200}},
+		{name: "from_header", bosLength: 600, wantLen: 600, wantRequests: []int{9, 255, 510, 600}},
+		{name: "shorter_than_asked", bosLength: 300, totalLen: 1000, wantLen: 300, wantRequests: []int{255, 510}},
+		{name: "longer_than_a_request", bosLength: 5000, totalLen: 5000, wantLen: 4096, wantRequests: []int{255, 510, 1020, 2040, 4080, 4096}, wantErr: ErrNotSupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bosLength, requests = tt.bosLength, nil
+			data, err := h.GetDescriptorChunked(USB_DT_BOS, 0, tt.totalLen)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetDescriptorChunked() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(data) != tt.wantLen {
+				t.Errorf("GetDescriptorChunked() = %d bytes, want %d", len(data), tt.wantLen)
+			}
+			if !slices.Equal(requests, tt.wantRequests) {
+				t.Errorf("request lengths = %v, want %v", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestInterruptInOut(t *testing.T) {
+	var received []byte
+	dev := &MockDevice{
+		Bus:     1,
+		Address: 6,
+		Endpoints: map[uint8]func([]byte) (int, error){
+			0x81: func(data []byte) (int, error) { return copy(data, []byte{0x01, 0x7f}), nil },
+			0x02: func(data []byte) (int, error) {
+				received = append([]byte(nil), data...)
+				return len(data), nil
+			},
+		},
+	}
+	h := openMockHandle(t, dev)
+
+	buf := make([]byte, 8)
+	if n, err := h.InterruptTransfer(0x81, buf, time.Second); err != nil || !bytes.Equal(buf[:n], []byte{0x01, 0x7f}) {
+		t.Errorf("InterruptTransfer(0x81) = %x, %v, want 017f", buf[:n], err)
+	}
+	if n, err := h.InterruptTransfer(0x02, []byte{0x02, 0x10}, time.Second); err != nil || n != 2 || !bytes.Equal(received, []byte{0x02, 0x10}) {
+		t.Errorf("InterruptTransfer(0x02) = %d, %v; device got %x, want 0210", n, err, received)
+	}
+
+	// InterruptIn takes the endpoint number alone
+	if got, err := h.InterruptIn(0x01, buf, time.Second); err != nil || !bytes.Equal(got, []byte{0x01, 0x7f}) {
+		t.Errorf("InterruptIn(0x01) = %x, %v, want 017f", got, err)
+	}
+	if n, err := h.InterruptOut(0x02, []byte{0x02, 0x20, 0x30}, time.Second); err != nil || n != 3 || !bytes.Equal(received, []byte{0x02, 0x20, 0x30}) {
+		t.Errorf("InterruptOut(0x02) = %d, %v; device got %x, want 022030", n, err, received)
+	}
+	if _, err := h.InterruptOut(0x82, []byte{0x02}, time.Second); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("InterruptOut(0x82) error = %v, want ErrInvalidParameter", err)
+	}
+}
+
+func TestIsoPacketSize(t *testing.T) {
+	// A high-speed webcam endpoint asking for 3 x 1024 bytes per microframe
+	highBandwidth := &Endpoint{Attributes: 0x05, MaxPacketSize: 0x1400}
+	superSpeed := &Endpoint{Attributes: 0x05, MaxPacketSize: 1024, SSCompanion: &SuperSpeedEndpointCompanionDescriptor{MaxBurst: 15, BytesPerInterval: 49152}}
+
+	tests := []struct {
+		name  string
+		ep    *Endpoint
+		speed Speed
+		want  int
+	}{
+		{name: "high_speed", ep: highBandwidth, speed: SpeedHigh, want: 3072},
+		{name: "full_speed_link", ep: highBandwidth, speed: SpeedFull, want: 1023},
+		{name: "full_speed_small", ep: &Endpoint{Attributes: 0x05, MaxPacketSize: 512}, speed: SpeedFull, want: 512},
+		{name: "unknown_speed", ep: highBandwidth, speed: SpeedUnknown, want: 3072},
+		{name: "super_speed", ep: superSpeed, speed: SpeedSuper, want: 49152},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isoPacketSize(tt.ep, tt.speed); got != tt.want {
+				t.Errorf("isoPacketSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindInterfaceDescriptor(t *testing.T) {
+	configs := []*ConfigDescriptor{{
+		Interfaces: []Interface{{AltSettings: []InterfaceAltSetting{
+			{InterfaceNumber: 1, AlternateSetting: 0},
+			{InterfaceNumber: 1, AlternateSetting: 1, Endpoints: []Endpoint{{EndpointAddr: 0x81}}},
+		}}},
+	}}
+
+	alt, err := findInterfaceDescriptor(configs, 0, 1, 1)
+	if err != nil {
+		t.Fatalf("findInterfaceDescriptor() error = %v", err)
+	}
+	if alt.AlternateSetting != 1 || len(alt.Endpoints) != 1 || alt.Endpoints[0].EndpointAddr != 0x81 {
+		t.Errorf("findInterfaceDescriptor() = %+v, want alternate setting 1 with endpoint 0x81", alt)
+	}
+
+	for _, missing := range [][3]uint8{{1, 1, 0}, {0, 0, 0}, {0, 1, 2}} {
+		if _, err := findInterfaceDescriptor(configs, missing[0], missing[1], missing[2]); !errors.Is(err, ErrNotFound) {
+			t.Errorf("findInterfaceDescriptor%v error = %v, want ErrNotFound", missing, err)
+		}
+	}
+}
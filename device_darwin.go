@@ -14,7 +14,10 @@ import "C"
 import (
 	"encoding/binary"
 	"fmt"
+	"maps"
 	"sync"
+	"time"
+	"unsafe"
 )
 
 // DeviceHandle represents an open USB device on macOS
@@ -24,32 +27,113 @@ type DeviceHandle struct {
 	service       C.io_service_t
 	interfaces    map[uint8]*IOUSBInterfaceInterface
 	claimedIfaces map[uint8]bool
+	pipes         map[uint8]pipeRoute // endpoint address -> owning interface and pipeRef
 	mu            sync.RWMutex
 	closed        bool
-	asyncSource   C.CFRunLoopSourceRef
+	async         *asyncRunLoop // Started by the first async transfer, guarded by mu
+
+	// Cached active configuration and the configuration generation it was
+	// read in, guarded by mu
+	activeConfig *ConfigDescriptor
+	configGen    uint64
+
+	// Every configuration as read by Configurations, the generation they
+	// were read in and how long that took, guarded by mu
+	configs     []*ConfigDescriptor
+	configsGen  uint64
+	configStats ConfigReadStats
+
+	policies map[uint8]EndpointPolicy // Set by SetEndpointPolicy, guarded by mu
+
+	defaultTimeout time.Duration // Set by SetDefaultTimeout, guarded by mu
+
+	refs *handleRefs // Shared with clones of the handle
+
+	backend BackendHandle // Set for handles on a Backend device
 }
 
-// Close closes the device handle
-func (h *DeviceHandle) Close() error {
+// defaultControlTimeout bounds control transfers made without a timeout
+// until SetDefaultTimeout is called
+const defaultControlTimeout = 5 * time.Second
+
+// SetDefaultTimeout sets the timeout of the control transfers the handle
+// makes on its own, such as the descriptor requests of GetConfigDescriptor,
+// GetBOSDescriptor, GetDeviceQualifierDescriptor and StringDescriptor, of
+// ControlTransfer calls with a zero timeout and of the transfers started by
+// SubmitControl. A device that NAKs such a request fails it with ErrTimeout
+// once the timeout has passed. A timeout of zero restores the default of 5
+// seconds.
+func (h *DeviceHandle) SetDefaultTimeout(timeout time.Duration) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	h.defaultTimeout = timeout
+}
 
+// controlTimeout returns timeout in milliseconds for IOKit, substituting the
+// default timeout when it is zero. The caller must hold mu.
+func (h *DeviceHandle) controlTimeout(timeout time.Duration) uint32 {
+	if timeout <= 0 {
+		timeout = h.defaultTimeout
+	}
+	if timeout <= 0 {
+		timeout = defaultControlTimeout
+	}
+	// IOKit takes whole milliseconds and treats 0 as no timeout
+	return uint32(max(timeout.Milliseconds(), 1))
+}
+
+// Close closes the device handle
+func (h *DeviceHandle) Close() error {
+	// Marking the handle closed first keeps Submit from starting a run loop
+	// or queueing a transfer on a pipe after it has been aborted
+	h.mu.Lock()
 	if h.closed {
+		h.mu.Unlock()
 		return nil
 	}
+	h.closed = true
+	async := h.async
+	h.async = nil
+	var aborts []func() error
+	if async != nil {
+		for _, route := range h.pipes {
+			if intf, ok := h.interfaces[route.iface]; ok {
+				pipeRef := route.pipeRef
+				aborts = append(aborts, func() error { return intf.AbortPipe(pipeRef) })
+			}
+		}
+	}
+	h.mu.Unlock()
 
-	// Remove async source from run loop if present
-	if h.asyncSource != 0 {
-		C.CFRunLoopRemoveSource(C.CFRunLoopGetCurrent(), h.asyncSource, C.kCFRunLoopDefaultMode)
-		C.CFRelease(C.CFTypeRef(h.asyncSource))
-		h.asyncSource = 0
+	// Abort the pipes and let the run loop deliver the completions of the
+	// aborted transfers before stopping it, all without holding mu, as a
+	// completion callback may be using the handle
+	if async != nil {
+		for _, abort := range aborts {
+			abort()
+		}
+		async.drain()
+		async.stop()
 	}
 
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	// Release all claimed interfaces
 	for iface := range h.claimedIfaces {
 		h.releaseInterfaceInternal(iface)
 	}
 
+	if h.backend != nil {
+		return h.backend.Close()
+	}
+
+	if !h.refs.release() {
+		h.devInterface = nil
+		h.service = 0
+		return nil
+	}
+
 	// Close device
 	if h.devInterface != nil {
 		h.devInterface.Close()
@@ -62,11 +146,40 @@ func (h *DeviceHandle) Close() error {
 		C.ReleaseService(h.service)
 		h.service = 0
 	}
-
-	h.closed = true
 	return nil
 }
 
+// Clone returns another handle on the same open device, sharing its IOKit
+// device interface, so that separate parts of a program, such as the video
+// and audio functions of a composite device, can each claim and close their
+// own interfaces. Each handle tracks its own claimed interfaces, endpoint
+// policies and configuration cache; the clone starts out with the endpoint
+// policies and default timeout of h. The device is closed when the last of
+// the handles is.
+func (h *DeviceHandle) Clone() (*DeviceHandle, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return nil, fmt.Errorf("device is closed")
+	}
+	if h.backend != nil {
+		return nil, ErrNotSupported
+	}
+
+	h.refs.acquire()
+	return &DeviceHandle{
+		device:         h.device,
+		devInterface:   h.devInterface,
+		service:        h.service,
+		interfaces:     make(map[uint8]*IOUSBInterfaceInterface),
+		claimedIfaces:  make(map[uint8]bool),
+		policies:       maps.Clone(h.policies),
+		defaultTimeout: h.defaultTimeout,
+		refs:           h.refs,
+	}, nil
+}
+
 // SetConfiguration sets the device configuration
 func (h *DeviceHandle) SetConfiguration(config int) error {
 	h.mu.Lock()
@@ -76,6 +189,11 @@ func (h *DeviceHandle) SetConfiguration(config int) error {
 		return fmt.Errorf("device is closed")
 	}
 
+	h.invalidateActiveConfig()
+
+	if h.backend != nil {
+		return backendSetConfiguration(h.backend, config)
+	}
 	return h.devInterface.SetConfiguration(uint8(config))
 }
 
@@ -87,12 +205,38 @@ func (h *DeviceHandle) GetConfiguration() (int, error) {
 	if h.closed {
 		return 0, fmt.Errorf("device is closed")
 	}
+	if h.backend != nil {
+		return backendConfiguration(h.backend)
+	}
 
 	config, err := h.devInterface.GetConfiguration()
 	return int(config), err
 }
 
-// ClaimInterface claims an interface for exclusive use
+// FD returns the IOUSBDeviceInterface320** the handle opened the device
+// through, for calling IOKit functions the library does not wrap. Calls made
+// on it directly bypass the library's tracking of claimed interfaces and
+// pipes. Do not release it; it is released with the last handle. A handle on
+// a Backend has none and returns ErrNotSupported.
+func (h *DeviceHandle) FD() (uintptr, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return 0, ErrDeviceNotFound
+	}
+	if h.backend != nil {
+		return 0, ErrNotSupported
+	}
+	return uintptr(unsafe.Pointer(h.devInterface.ptr)), nil
+}
+
+// ClaimInterface claims an interface for exclusive use. The IOKit interface
+// object with the given number is opened and the pipes of its current
+// alternate setting are mapped, so bulk, interrupt and ClearHalt calls can
+// address its endpoints. An interface number the active configuration does
+// not have returns an error wrapping ErrNotFound, and an interface another
+// driver or process has open returns one wrapping ErrDeviceBusy.
 func (h *DeviceHandle) ClaimInterface(iface uint8) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -105,14 +249,80 @@ func (h *DeviceHandle) ClaimInterface(iface uint8) error {
 		return nil // Already claimed
 	}
 
-	// Find and open the interface
-	// Note: This is a simplified implementation
-	// A full implementation would iterate through interfaces properly
+	if h.backend != nil {
+		if err := h.backend.ClaimInterface(iface); err != nil {
+			return fmt.Errorf("claim interface %d: %w", iface, err)
+		}
+		h.claimedIfaces[iface] = true
+		return nil
+	}
+
+	intf, err := h.devInterface.FindInterface(iface)
+	if err != nil {
+		return fmt.Errorf("claim interface %d: %w", iface, err)
+	}
+	if err := intf.Open(); err != nil {
+		intf.Release()
+		return fmt.Errorf("claim interface %d: %w", iface, err)
+	}
 
+	h.interfaces[iface] = intf
 	h.claimedIfaces[iface] = true
+	h.mapPipes(iface, intf)
 	return nil
 }
 
+// pipeRoute locates an endpoint on macOS, where transfers address endpoints
+// by interface and pipe reference rather than by endpoint address
+type pipeRoute struct {
+	iface   uint8
+	pipeRef uint8
+}
+
+// mapPipes records the pipe reference of every endpoint in the current
+// alternate setting of an open interface, replacing what was recorded for
+// that interface before. The caller must hold h.mu for writing.
+func (h *DeviceHandle) mapPipes(iface uint8, intf *IOUSBInterfaceInterface) {
+	h.unmapPipes(iface)
+
+	num, err := intf.NumEndpoints()
+	if err != nil {
+		return
+	}
+	if h.pipes == nil {
+		h.pipes = make(map[uint8]pipeRoute)
+	}
+	for pipeRef := uint8(1); pipeRef <= num; pipeRef++ {
+		if addr, _, err := intf.PipeEndpoint(pipeRef); err == nil {
+			h.pipes[addr] = pipeRoute{iface: iface, pipeRef: pipeRef}
+		}
+	}
+}
+
+// unmapPipes forgets the pipes of an interface. The caller must hold h.mu for
+// writing.
+func (h *DeviceHandle) unmapPipes(iface uint8) {
+	for addr, route := range h.pipes {
+		if route.iface == iface {
+			delete(h.pipes, addr)
+		}
+	}
+}
+
+// findPipe resolves an endpoint address to the claimed interface that owns it
+// and the IOKit pipe reference of the endpoint. The caller must hold h.mu.
+func (h *DeviceHandle) findPipe(endpoint uint8) (*IOUSBInterfaceInterface, uint8, error) {
+	route, ok := h.pipes[endpoint]
+	if !ok {
+		return nil, 0, fmt.Errorf("no claimed interface has endpoint %02x", endpoint)
+	}
+	intf, ok := h.interfaces[route.iface]
+	if !ok {
+		return nil, 0, fmt.Errorf("interface %d not open", route.iface)
+	}
+	return intf, route.pipeRef, nil
+}
+
 // ReleaseInterface releases a previously claimed interface
 func (h *DeviceHandle) ReleaseInterface(iface uint8) error {
 	h.mu.Lock()
@@ -130,12 +340,23 @@ func (h *DeviceHandle) releaseInterfaceInternal(iface uint8) error {
 		return nil // Not claimed
 	}
 
+	if h.backend != nil {
+		if err := h.backend.ReleaseInterface(iface); err != nil {
+			return err
+		}
+	}
+
+	if h.async != nil {
+		h.async.removeSource(iface)
+	}
+
 	// Close interface if it's open
 	if intf, ok := h.interfaces[iface]; ok {
 		intf.Close()
 		intf.Release()
 		delete(h.interfaces, iface)
 	}
+	h.unmapPipes(iface)
 
 	delete(h.claimedIfaces, iface)
 	return nil
@@ -150,43 +371,54 @@ func (h *DeviceHandle) SetAltSetting(iface, altSetting uint8) error {
 		return fmt.Errorf("device is closed")
 	}
 
+	h.invalidateActiveConfig()
+
 	if !h.claimedIfaces[iface] {
 		return fmt.Errorf("interface %d not claimed", iface)
 	}
+	if h.backend != nil {
+		return h.backend.SetInterfaceAltSetting(iface, altSetting)
+	}
 
 	intf, ok := h.interfaces[iface]
 	if !ok {
 		return fmt.Errorf("interface %d not open", iface)
 	}
 
-	return intf.SetAlternateSetting(altSetting)
+	if err := intf.SetAlternateSetting(altSetting); err != nil {
+		return err
+	}
+
+	// The new alternate setting can have different endpoints and pipes
+	h.mapPipes(iface, intf)
+	return nil
 }
 
-// ClearHalt clears a halt/stall condition on an endpoint
+// ClearHalt clears a halt/stall condition on an endpoint. The device is sent
+// CLEAR_FEATURE(ENDPOINT_HALT), which resets its data toggle, and the host
+// pipe is reset to match, so both ends agree on the next toggle.
 func (h *DeviceHandle) ClearHalt(endpoint uint8) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
 	if h.closed {
-		return fmt.Errorf("device is closed")
+		return ErrDeviceNotFound
+	}
+	if h.backend != nil {
+		return h.backend.ClearHalt(endpoint)
 	}
 
-	// Determine interface from endpoint
-	// This is simplified - a full implementation would track endpoint-to-interface mapping
-	for _, intf := range h.interfaces {
-		// Try to clear on this interface
-		// The pipeRef would need to be determined from endpoint address
-		err := intf.ClearPipeStall(endpoint & 0x0F)
-		if err == nil {
-			return nil
-		}
+	intf, pipeRef, err := h.findPipe(endpoint)
+	if err != nil {
+		return err
 	}
 
-	return fmt.Errorf("endpoint %02x not found", endpoint)
+	return intf.ClearPipeStallBothEnds(pipeRef)
 }
 
-// ResetDevice resets the USB device
-func (h *DeviceHandle) ResetDevice() error {
+// resetDevice releases every claimed interface and resets the USB device.
+// IOKit leaves the device unconfigured afterwards.
+func (h *DeviceHandle) resetDevice() error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
@@ -194,9 +426,25 @@ func (h *DeviceHandle) ResetDevice() error {
 		return fmt.Errorf("device is closed")
 	}
 
+	h.invalidateActiveConfig()
+
+	for iface := range h.claimedIfaces {
+		h.releaseInterfaceInternal(iface)
+	}
+	h.claimedIfaces = make(map[uint8]bool)
+
+	if h.backend != nil {
+		return ErrNotSupported
+	}
 	return h.devInterface.ResetDevice()
 }
 
+// GetKernelDriver reports that the driver of an interface cannot be queried
+// through IOKit
+func (h *DeviceHandle) GetKernelDriver(iface uint8) (string, error) {
+	return "", ErrNotSupported
+}
+
 // KernelDriverActive checks if a kernel driver is active for an interface
 func (h *DeviceHandle) KernelDriverActive(iface uint8) (bool, error) {
 	// macOS doesn't expose this in the same way as Linux
@@ -218,6 +466,10 @@ func (h *DeviceHandle) AttachKernelDriver(iface uint8) error {
 	return nil
 }
 
+// SetReattachOnClose has no effect on macOS, where kernel drivers are never
+// detached by the handle
+func (h *DeviceHandle) SetReattachOnClose(reattach bool) {}
+
 // StringDescriptor retrieves a string descriptor from the device
 func (h *DeviceHandle) StringDescriptor(index uint8) (string, error) {
 	h.mu.RLock()
@@ -226,6 +478,9 @@ func (h *DeviceHandle) StringDescriptor(index uint8) (string, error) {
 	if h.closed {
 		return "", fmt.Errorf("device is closed")
 	}
+	if h.backend != nil {
+		return backendStringDescriptor(h.backend, index)
+	}
 
 	// First get language ID (index 0)
 	langID := uint16(0x0409) // Default to US English
@@ -238,7 +493,7 @@ func (h *DeviceHandle) StringDescriptor(index uint8) (string, error) {
 			0x0300, // String descriptor, index 0
 			0,
 			buf,
-			5000,
+			h.controlTimeout(0),
 		)
 		if err != nil {
 			return "", err
@@ -268,7 +523,7 @@ func (h *DeviceHandle) StringDescriptor(index uint8) (string, error) {
 	}
 
 	// Get the actual string descriptor
-	return h.devInterface.GetStringDescriptor(index, langID)
+	return h.devInterface.GetStringDescriptor(index, langID, h.controlTimeout(0))
 }
 
 // GetDeviceDescriptor retrieves the device descriptor
@@ -279,17 +534,24 @@ func (h *DeviceHandle) GetDeviceDescriptor() (*DeviceDescriptor, error) {
 	if h.closed {
 		return nil, fmt.Errorf("device is closed")
 	}
+	if h.backend != nil {
+		desc := h.device.Descriptor
+		return &desc, nil
+	}
 
 	return h.devInterface.GetDeviceDescriptor()
 }
 
-// GetActiveConfigDescriptor gets the descriptor for the active configuration
+// GetActiveConfigDescriptor gets the descriptor for the active configuration.
+// The parsed descriptor is cached on the handle until SetConfiguration,
+// SetAltSetting or ResetDevice is called, so repeated calls are
+// cheap. It describes every alternate setting, so use Interface or
+// ActiveAltSettings to find the ones currently selected. The returned
+// descriptor is shared and must not be modified.
 func (h *DeviceHandle) GetActiveConfigDescriptor() (*ConfigDescriptor, error) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	if h.closed {
-		return nil, fmt.Errorf("device is closed")
+	cached, gen := h.cachedActiveConfig()
+	if cached != nil {
+		return cached, nil
 	}
 
 	// Get current configuration
@@ -298,22 +560,32 @@ func (h *DeviceHandle) GetActiveConfigDescriptor() (*ConfigDescriptor, error) {
 		return nil, err
 	}
 
-	// Configuration values start at 1, but index starts at 0
+	// An unconfigured device falls back to its first configuration
+	var desc *ConfigDescriptor
 	if config > 0 {
-		return h.GetConfigDescriptor(uint8(config - 1))
+		desc, err = h.ConfigDescriptorByConfigValue(uint8(config))
+	} else {
+		desc, err = h.ConfigDescriptorByIndex(0)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return h.GetConfigDescriptor(0)
+	h.storeActiveConfig(desc, gen)
+	return desc, nil
 }
 
-// GetConfigDescriptor gets a specific configuration descriptor
-func (h *DeviceHandle) GetConfigDescriptor(index uint8) (*ConfigDescriptor, error) {
+// RawConfigDescriptor returns the raw configuration descriptor bytes by index
+func (h *DeviceHandle) RawConfigDescriptor(index uint8) ([]byte, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	if h.closed {
 		return nil, fmt.Errorf("device is closed")
 	}
+	if h.backend != nil {
+		return backendConfigDescriptor(h.backend, index)
+	}
 
 	// First get the configuration descriptor header
 	buf := make([]byte, 9)
@@ -323,7 +595,7 @@ func (h *DeviceHandle) GetConfigDescriptor(index uint8) (*ConfigDescriptor, erro
 		(USB_DT_CONFIG<<8)|uint16(index), // Config descriptor
 		0,
 		buf,
-		5000,
+		h.controlTimeout(0),
 	)
 	if err != nil {
 		return nil, err
@@ -334,170 +606,102 @@ func (h *DeviceHandle) GetConfigDescriptor(index uint8) (*ConfigDescriptor, erro
 
 	// Get full descriptor
 	fullBuf := make([]byte, totalLength)
-	_, err = h.devInterface.ControlTransfer(
+	n, err := h.devInterface.ControlTransfer(
 		0x80,
 		USB_REQ_GET_DESCRIPTOR,
 		(USB_DT_CONFIG<<8)|uint16(index),
 		0,
 		fullBuf,
-		5000,
+		h.controlTimeout(0),
 	)
 	if err != nil {
 		return nil, err
 	}
+	if err := ValidateConfigLength(fullBuf[:n]); err != nil {
+		return nil, err
+	}
 
-	// Parse the configuration descriptor
-	return parseConfigDescriptor(fullBuf)
+	return fullBuf[:n], nil
 }
 
-// ResetEndpoint resets an endpoint
+// ResetEndpoint clears the halt and data toggle of an endpoint on the host
+// side only; nothing is sent to the device. Use ClearHalt to recover from a
+// stall reported by the device.
 func (h *DeviceHandle) ResetEndpoint(endpoint uint8) error {
-	// On macOS, this is handled through ClearHalt
-	return h.ClearHalt(endpoint)
-}
-
-// parseConfigDescriptor parses a raw configuration descriptor
-func parseConfigDescriptor(data []byte) (*ConfigDescriptor, error) {
-	if len(data) < 9 {
-		return nil, fmt.Errorf("config descriptor too short")
-	}
-
-	config := &ConfigDescriptor{
-		Length:             data[0],
-		DescriptorType:     data[1],
-		TotalLength:        binary.LittleEndian.Uint16(data[2:4]),
-		NumInterfaces:      data[4],
-		ConfigurationValue: data[5],
-		ConfigurationIndex: data[6],
-		Attributes:         data[7],
-		MaxPower:           data[8],
-		Interfaces:         make([]Interface, 0),
-	}
-
-	// Map to track interfaces by number
-	interfaceMap := make(map[uint8]*Interface)
-
-	// Parse interfaces
-	offset := 9
-	for offset < len(data) {
-		if offset+1 >= len(data) {
-			break
-		}
-
-		length := int(data[offset])
-		descType := data[offset+1]
-
-		if length == 0 || offset+length > len(data) {
-			break
-		}
-
-		if descType == USB_DT_INTERFACE && length >= 9 {
-			altSetting := InterfaceAltSetting{
-				Length:            data[offset],
-				DescriptorType:    data[offset+1],
-				InterfaceNumber:   data[offset+2],
-				AlternateSetting:  data[offset+3],
-				NumEndpoints:      data[offset+4],
-				InterfaceClass:    data[offset+5],
-				InterfaceSubClass: data[offset+6],
-				InterfaceProtocol: data[offset+7],
-				InterfaceIndex:    data[offset+8],
-				Endpoints:         make([]Endpoint, 0),
-			}
-
-			// Get or create interface
-			intfNum := altSetting.InterfaceNumber
-			if _, exists := interfaceMap[intfNum]; !exists {
-				interfaceMap[intfNum] = &Interface{
-					AltSettings: make([]InterfaceAltSetting, 0),
-				}
-			}
-			interfaceMap[intfNum].AltSettings = append(interfaceMap[intfNum].AltSettings, altSetting)
-		}
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-		offset += length
+	if h.closed {
+		return ErrDeviceNotFound
 	}
 
-	// Convert map to sorted slice
-	for i := uint8(0); i < config.NumInterfaces; i++ {
-		if intf, exists := interfaceMap[i]; exists {
-			config.Interfaces = append(config.Interfaces, *intf)
-		}
+	intf, pipeRef, err := h.findPipe(endpoint)
+	if err != nil {
+		return err
 	}
 
-	return config, nil
+	return intf.ClearPipeStall(pipeRef)
 }
 
 // Additional descriptor parsing functions
 
 // GetBOSDescriptor retrieves the Binary Object Store descriptor
 func (h *DeviceHandle) GetBOSDescriptor() (*BOSDescriptor, []DeviceCapabilityDescriptor, error) {
+	data, err := h.RawBOSDescriptor()
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseBOSDescriptor(data)
+}
+
+// RawBOSDescriptor retrieves the complete Binary Object Store descriptor,
+// including every device capability
+func (h *DeviceHandle) RawBOSDescriptor() ([]byte, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	if h.closed {
-		return nil, nil, fmt.Errorf("device is closed")
+		return nil, fmt.Errorf("device is closed")
 	}
 
 	// First get BOS descriptor header
 	buf := make([]byte, 5)
-	_, err := h.devInterface.ControlTransfer(
+	_, err := h.defaultPipeTransfer(
 		0x80,
 		USB_REQ_GET_DESCRIPTOR,
 		(USB_DT_BOS << 8),
 		0,
 		buf,
-		5000,
+		0,
 	)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	if buf[1] != USB_DT_BOS {
+		return nil, fmt.Errorf("not a BOS descriptor (type: 0x%02x)", buf[1])
 	}
 
-	bos := &BOSDescriptor{
-		Length:         buf[0],
-		DescriptorType: buf[1],
-		TotalLength:    binary.LittleEndian.Uint16(buf[2:4]),
-		NumDeviceCaps:  buf[4],
+	totalLength := binary.LittleEndian.Uint16(buf[2:4])
+	if totalLength < 5 {
+		return nil, fmt.Errorf("invalid BOS total length: %d", totalLength)
 	}
 
 	// Get full BOS descriptor with capabilities
-	fullBuf := make([]byte, bos.TotalLength)
-	_, err = h.devInterface.ControlTransfer(
+	fullBuf := make([]byte, totalLength)
+	n, err := h.defaultPipeTransfer(
 		0x80,
 		USB_REQ_GET_DESCRIPTOR,
 		(USB_DT_BOS << 8),
 		0,
 		fullBuf,
-		5000,
+		0,
 	)
 	if err != nil {
-		return nil, nil, err
-	}
-
-	// Parse device capabilities
-	var caps []DeviceCapabilityDescriptor
-	offset := 5
-	for i := 0; i < int(bos.NumDeviceCaps) && offset < len(fullBuf); i++ {
-		if offset+2 >= len(fullBuf) {
-			break
-		}
-
-		length := int(fullBuf[offset])
-		if offset+length > len(fullBuf) {
-			break
-		}
-
-		cap := DeviceCapabilityDescriptor{
-			Length:            fullBuf[offset],
-			DescriptorType:    fullBuf[offset+1],
-			DevCapabilityType: fullBuf[offset+2],
-		}
-		caps = append(caps, cap)
-
-		offset += length
+		return nil, err
 	}
 
-	return bos, caps, nil
+	return fullBuf[:n], nil
 }
 
 // GetDeviceQualifierDescriptor retrieves the device qualifier descriptor
@@ -510,13 +714,13 @@ func (h *DeviceHandle) GetDeviceQualifierDescriptor() (*DeviceQualifierDescripto
 	}
 
 	buf := make([]byte, 10)
-	_, err := h.devInterface.ControlTransfer(
+	_, err := h.defaultPipeTransfer(
 		0x80,
 		USB_REQ_GET_DESCRIPTOR,
 		(USB_DT_DEVICE_QUALIFIER << 8),
 		0,
 		buf,
-		5000,
+		0,
 	)
 	if err != nil {
 		return nil, err
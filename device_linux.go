@@ -1,9 +1,12 @@
 package usb
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"maps"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,6 +21,7 @@ const (
 	USBDEVFS_RELEASEINTERFACE = 0x80045510
 	USBDEVFS_SETINTERFACE     = 0x80085504
 	USBDEVFS_CLEAR_HALT       = 0x80045515
+	USBDEVFS_RESET            = 0x00005514
 	USBDEVFS_RESETEP          = 0x80045503
 	USBDEVFS_SETCONFIGURATION = 0x80045505
 	USBDEVFS_GETDRIVER        = 0x41045508
@@ -42,6 +46,17 @@ type Device struct {
 	Descriptor   DeviceDescriptor
 	Configs      []RawConfigDescriptor
 	SysfsStrings *SysfsStrings
+
+	// Topology from the sysfs device names, set by DeviceList. Parent is
+	// the hub the device is plugged into, nil for root hubs, and Port the
+	// port of Parent it uses. Children are the devices on a hub's ports, in
+	// port order.
+	Parent   *Device
+	Port     uint8
+	Children []*Device
+
+	sysfsPath string  // sysfs directory, if known from enumeration
+	backend   Backend // Backend the device was listed from, if any
 }
 
 // SysfsStrings holds cached sysfs string descriptors
@@ -51,6 +66,16 @@ type SysfsStrings struct {
 	Serial       string
 }
 
+// DeviceHandle is an open usbfs device node.
+//
+// A DeviceHandle is safe for concurrent use by multiple goroutines. Transfers
+// and descriptor reads take a shared lock, so control, bulk and interrupt
+// transfers from different goroutines run in parallel; usbfs queues each
+// ioctl's request independently and the request state lives on the calling
+// goroutine's stack. Operations that change handle state (claiming or
+// releasing interfaces, SetConfiguration, SetInterfaceAltSetting, ClearHalt,
+// ResetDevice and Close) take the exclusive lock and wait for in-flight
+// synchronous transfers to finish.
 type DeviceHandle struct {
 	device        *Device
 	fd            int
@@ -58,14 +83,85 @@ type DeviceHandle struct {
 	mu            sync.RWMutex
 	closed        bool
 
-	// Reaper state for isochronous transfers
+	// Cached active configuration and the configuration generation it was
+	// read in, guarded by mu
+	activeConfig *ConfigDescriptor
+	configGen    uint64
+
+	// Every configuration as read by Configurations, the generation they
+	// were read in and how long that took, guarded by mu
+	configs     []*ConfigDescriptor
+	configsGen  uint64
+	configStats ConfigReadStats
+
+	policies map[uint8]EndpointPolicy // Set by SetEndpointPolicy, guarded by mu
+
+	// Interfaces whose kernel driver was detached through the handle, and
+	// whether Close binds it again; guarded by mu
+	detachedIfaces  map[uint8]bool
+	reattachOnClose bool
+
+	// Streams AllocStreams allocated on each endpoint, guarded by mu
+	streams map[uint8]endpointStreams
+
+	// Set by OpenReadOnly: the node is open O_RDONLY and descriptors holds
+	// the device and configuration descriptors read from it
+	readOnly    bool
+	descriptors []byte
+
+	// Shared with clones of the handle
+	refs *handleRefs
+	*urbReaper
+
+	// Set for handles on a Backend device, which take the place of fd
+	backend     BackendHandle
+	backendURBs *backendURBQueue
+}
+
+// endpointStreams is the number of streams allocated on an endpoint and the
+// interface it belongs to. The kernel frees them when that interface changes
+// alternate setting or is released, and when the device is reset.
+type endpointStreams struct {
+	iface uint8
+	count uint32
+}
+
+// urbReaper is the reaper state of a usbfs file descriptor. REAPURB returns
+// the URBs of every user of the descriptor, so a handle and its clones share
+// one.
+type urbReaper struct {
 	reapMutex sync.Mutex
-	reapMap   map[uintptr]func(error) // URB ptr -> completion callback
-	reaping   bool                    // Is reaper running?
-	reapDone  chan struct{}           // Signals reaper has stopped
+	reapMap   map[uintptr]urbCompletion // URB ptr -> completion
+	reaping   bool                      // Is reaper running?
+	reapDone  chan struct{}             // Signals reaper has stopped
+	fdClosed  bool                      // The last handle on the descriptor closed, guarded by reapMutex
+
+	// Endpoints whose completions are delivered in submission order,
+	// guarded by reapMutex
+	ordered map[uint8]*completionQueue
 }
 
-func (d *Device) Open() (*DeviceHandle, error) {
+// urbCompletion is the completion callback of a submitted URB, with its
+// place in the endpoint's completion order if the endpoint has one
+type urbCompletion struct {
+	callback func(error)
+	queue    *completionQueue
+	seq      uint64
+}
+
+func newURBReaper() *urbReaper {
+	return &urbReaper{
+		reapMap: make(map[uintptr]urbCompletion),
+		ordered: make(map[uint8]*completionQueue),
+	}
+}
+
+// Open opens the USB device
+func (d *Device) Open(opts ...OpenOption) (*DeviceHandle, error) {
+	if d.backend != nil {
+		return d.openBackend(opts)
+	}
+
 	fd, err := syscall.Open(d.Path, syscall.O_RDWR, 0)
 	if err != nil {
 		if err == syscall.EACCES {
@@ -74,15 +170,127 @@ func (d *Device) Open() (*DeviceHandle, error) {
 		return nil, fmt.Errorf("failed to open device: %w", err)
 	}
 
-	return &DeviceHandle{
+	h := &DeviceHandle{
 		device:        d,
 		fd:            fd,
 		claimedIfaces: make(map[uint8]bool),
 		closed:        false,
-		reapMap:       make(map[uintptr]func(error)),
+		refs:          newHandleRefs(),
+		urbReaper:     newURBReaper(),
+	}
+
+	if err := h.applyOpenQuirks(); err != nil {
+		h.Close()
+		return nil, err
+	}
+	if err := h.applyOpenOptions(opts); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// OpenReadOnly opens the device node read-only, which only needs read
+// permission on it, so that unprivileged users can inspect devices whose
+// nodes they cannot write. The kernel refuses every usbfs ioctl on such a
+// node, so the handle serves the device and configuration descriptors from
+// what the node returns when read, including to GET_DESCRIPTOR control
+// requests; string descriptors are served from sysfs where it has them.
+// Configuration and GetActiveConfigDescriptor take the active configuration
+// from sysfs. Anything that would write to the device, claim an interface or
+// transfer data returns ErrReadOnly, as do requests the kernel refuses.
+func (d *Device) OpenReadOnly() (*DeviceHandle, error) {
+	fd, err := syscall.Open(d.Path, syscall.O_RDONLY, 0)
+	if err != nil {
+		if err == syscall.EACCES {
+			return nil, ErrPermissionDenied
+		}
+		return nil, fmt.Errorf("failed to open device: %w", err)
+	}
+
+	descriptors, err := readDescriptorNode(fd)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	return &DeviceHandle{
+		device:        d,
+		fd:            fd,
+		claimedIfaces: make(map[uint8]bool),
+		readOnly:      true,
+		descriptors:   descriptors,
+		refs:          newHandleRefs(),
+		urbReaper:     newURBReaper(),
 	}, nil
 }
 
+// readDescriptorNode reads a usbfs node, which returns the device descriptor
+// followed by every configuration descriptor
+func readDescriptorNode(fd int) ([]byte, error) {
+	var data []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read descriptors: %w", err)
+		}
+		if n == 0 {
+			break
+		}
+		data = append(data, buf[:n]...)
+	}
+	if len(data) < 18 || data[1] != USB_DT_DEVICE {
+		return nil, fmt.Errorf("invalid device descriptor of %d bytes", len(data))
+	}
+	return data, nil
+}
+
+// cachedDescriptor returns a device or configuration descriptor of a
+// read-only handle, reporting false for descriptors that are not cached
+func (h *DeviceHandle) cachedDescriptor(descType, index uint8) ([]byte, bool, error) {
+	switch descType {
+	case USB_DT_DEVICE:
+		return h.descriptors[:18], true, nil
+	case USB_DT_CONFIG:
+		configs, err := splitConfigDescriptors(h.descriptors[18:])
+		if err != nil {
+			return nil, true, err
+		}
+		if int(index) >= len(configs) {
+			return nil, true, fmt.Errorf("config descriptor %d: %w", index, ErrNotFound)
+		}
+		return configs[index], true, nil
+	}
+	return nil, false, nil
+}
+
+// ioctlError converts the error of a usbfs ioctl, reporting the EPERM the
+// kernel returns for any ioctl on a read-only node as ErrReadOnly
+func (h *DeviceHandle) ioctlError(errno syscall.Errno) error {
+	if h.readOnly && errno == syscall.EPERM {
+		return ErrReadOnly
+	}
+	return transferErrno(errno)
+}
+
+// transferErrno attaches the package error for the transfer failures usbfs
+// reports as errnos, so that errors.Is matches both ErrPipeStalled and
+// syscall.EPIPE for a stall
+func transferErrno(errno syscall.Errno) error {
+	switch errno {
+	case syscall.EPIPE, syscall.EOVERFLOW, syscall.ENODEV, syscall.ESHUTDOWN:
+		return fmt.Errorf("%w: %w", urbStatusError(-int32(errno)), errno)
+	}
+	return errno
+}
+
+// Close releases the interfaces claimed through the handle and closes it. The
+// device itself is only closed once the handle and all of its clones are.
 func (h *DeviceHandle) Close() error {
 	h.mu.Lock()
 	if h.closed {
@@ -90,14 +298,31 @@ func (h *DeviceHandle) Close() error {
 		return nil
 	}
 	h.closed = true
-	reapDone := h.reapDone
 	h.mu.Unlock()
 
+	if h.backend != nil {
+		return h.closeBackend()
+	}
+
+	if !h.refs.release() {
+		// Releasing the interfaces makes the kernel cancel their URBs,
+		// which the shared reaper delivers
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for iface := range h.claimedIfaces {
+			h.releaseInterfaceInternal(iface)
+		}
+		h.reattachKernelDrivers()
+		return nil
+	}
+
 	// Cancel all pending URBs so REAPURB unblocks in the reap loop.
 	// Without this, Close() deadlocks if the reap loop is blocked on REAPURB
 	// and no more URB completions will arrive (e.g., programmatic close without
 	// USB disconnect).
 	h.reapMutex.Lock()
+	h.fdClosed = true
+	reapDone := h.reapDone
 	for urbPtr := range h.reapMap {
 		syscall.Syscall(
 			syscall.SYS_IOCTL,
@@ -118,17 +343,96 @@ func (h *DeviceHandle) Close() error {
 	for iface := range h.claimedIfaces {
 		h.releaseInterfaceInternal(iface)
 	}
+	h.reattachKernelDrivers()
 
 	return syscall.Close(h.fd)
 }
 
-// registerURBCompletion registers a URB for completion notification
-func (h *DeviceHandle) registerURBCompletion(urbPtr uintptr, callback func(error)) {
+// Clone returns another handle on the same open device, sharing its file
+// descriptor, so that separate parts of a program, such as the video and
+// audio functions of a composite device, can each claim and close their own
+// interfaces. Each handle tracks its own claimed interfaces, endpoint
+// policies and configuration cache, and the clone starts out with the
+// endpoint policies of h; state of the device itself, such as the
+// configuration and alternate settings, is shared. The device is closed when
+// the last of the handles is.
+func (h *DeviceHandle) Clone() (*DeviceHandle, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return nil, ErrDeviceNotFound
+	}
+	if h.backend != nil {
+		return nil, ErrNotSupported
+	}
+
+	h.refs.acquire()
+	return &DeviceHandle{
+		device:        h.device,
+		fd:            h.fd,
+		claimedIfaces: make(map[uint8]bool),
+		policies:      maps.Clone(h.policies),
+		refs:          h.refs,
+		readOnly:      h.readOnly,
+		descriptors:   h.descriptors,
+		urbReaper:     h.urbReaper,
+	}, nil
+}
+
+// SetOrderedCompletion controls whether the completions of the asynchronous
+// transfers submitted on endpoint are delivered in submission order. By
+// default each completion is delivered as soon as the kernel reaps it, and
+// the kernel may reap the URBs of an endpoint in a different order than they
+// were submitted, for example when an earlier one is cancelled or times out
+// after a later one finished. In ordered mode a completion that is reaped
+// early is held, along with any data it carries, until the completions of
+// every earlier submission on the endpoint have been delivered. Ordering
+// therefore adds latency, and a transfer that never completes holds back all
+// later ones until it is cancelled, so ordered endpoints should use transfer
+// timeouts. The setting is shared by the handle and its clones and applies
+// to transfers submitted after the call.
+func (h *DeviceHandle) SetOrderedCompletion(endpoint uint8, ordered bool) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return ErrDeviceNotFound
+	}
+
 	h.reapMutex.Lock()
 	defer h.reapMutex.Unlock()
 
-	// Register the callback
-	h.reapMap[urbPtr] = callback
+	if !ordered {
+		delete(h.ordered, endpoint)
+	} else if h.ordered[endpoint] == nil {
+		h.ordered[endpoint] = newCompletionQueue()
+	}
+	return nil
+}
+
+// submitURB registers callback for the completion of urb and submits it. The
+// callback is registered first so that the reaper cannot reap the URB before
+// it knows about it; callers must therefore be ready for the callback to run
+// before submitURB returns. If the submission fails the callback is never
+// called.
+func (h *DeviceHandle) submitURB(urb *URB, callback func(error)) error {
+	if h.readOnly {
+		return ErrReadOnly
+	}
+	if h.backend != nil {
+		h.backendURBs.submit(h, urb, callback)
+		return nil
+	}
+	urbPtr := uintptr(unsafe.Pointer(urb))
+
+	h.reapMutex.Lock()
+	completion := urbCompletion{callback: callback}
+	if queue := h.ordered[urb.Endpoint]; queue != nil {
+		completion.queue = queue
+		completion.seq = queue.submit()
+	}
+	h.reapMap[urbPtr] = completion
 
 	// Start reaper if not already running
 	if !h.reaping {
@@ -136,6 +440,72 @@ func (h *DeviceHandle) registerURBCompletion(urbPtr uintptr, callback func(error
 		h.reapDone = make(chan struct{})
 		go h.reapLoop()
 	}
+	h.reapMutex.Unlock()
+
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		uintptr(h.fd),
+		USBDEVFS_SUBMITURB,
+		urbPtr,
+	)
+	if errno != 0 {
+		h.reapMutex.Lock()
+		delete(h.reapMap, urbPtr)
+		var ready []func()
+		if completion.queue != nil {
+			// Later submissions must not wait for this one
+			ready = completion.queue.complete(completion.seq, nil)
+		}
+		h.reapMutex.Unlock()
+		for _, deliver := range ready {
+			deliver()
+		}
+		return errno
+	}
+	return nil
+}
+
+// discardURB asks for a submitted urb to be given back early. It still
+// completes through its callback, with ErrInterrupted unless it finished
+// first. The error is the ioctl's, EINVAL once the URB has completed.
+func (h *DeviceHandle) discardURB(urb *URB) error {
+	if h.backend != nil {
+		h.backendURBs.discard(urb)
+		return nil
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_DISCARDURB, uintptr(unsafe.Pointer(urb)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// deliver returns the callbacks to run for the completion of c with err, in
+// order. The caller must hold reapMutex and run them after releasing it.
+func (c urbCompletion) deliver(err error) []func() {
+	call := func() { c.callback(err) }
+	if c.queue == nil {
+		return []func(){call}
+	}
+	return c.queue.complete(c.seq, call)
+}
+
+// failPending completes every registered URB with err and returns the
+// callbacks to run. The caller must hold reapMutex.
+func (r *urbReaper) failPending(err error) []func() {
+	// Deliver in submission order, so that the held completions of an
+	// ordered endpoint are released as the earlier ones are failed
+	pending := make([]urbCompletion, 0, len(r.reapMap))
+	for _, c := range r.reapMap {
+		pending = append(pending, c)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].seq < pending[j].seq })
+
+	var ready []func()
+	for _, c := range pending {
+		ready = append(ready, c.deliver(err)...)
+	}
+	return ready
 }
 
 // reapLoop continuously reaps completed URBs and notifies waiting transfers
@@ -147,20 +517,21 @@ func (h *DeviceHandle) reapLoop() {
 	}()
 
 	for {
-		// Check if handle is closed
-		h.mu.RLock()
-		closed := h.closed
-		h.mu.RUnlock()
+		// Check if the last handle on the descriptor is closed
+		h.reapMutex.Lock()
+		closed := h.fdClosed
+		h.reapMutex.Unlock()
 
 		if closed {
 			// Notify all pending transfers that we're closing
 			h.reapMutex.Lock()
-			for _, callback := range h.reapMap {
-				callback(ErrDeviceNotFound)
-			}
+			ready := h.failPending(ErrDeviceNotFound)
 			h.reapMap = nil
 			h.reaping = false
 			h.reapMutex.Unlock()
+			for _, deliver := range ready {
+				deliver()
+			}
 			return
 		}
 
@@ -177,32 +548,37 @@ func (h *DeviceHandle) reapLoop() {
 			continue
 		} else if errno != 0 {
 			h.reapMutex.Lock()
-			for _, callback := range h.reapMap {
-				callback(fmt.Errorf("reaper failed: %v", errno))
-			}
-			h.reapMap = make(map[uintptr]func(error))
+			ready := h.failPending(fmt.Errorf("reaper failed: %v", errno))
+			h.reapMap = make(map[uintptr]urbCompletion)
 			h.reaping = false
 			h.reapMutex.Unlock()
+			for _, deliver := range ready {
+				deliver()
+			}
 			return
 		}
 
+		// Call the callback with the URB status
+		var err error
+		if reapedURB.Status != 0 {
+			err = fmt.Errorf("URB completed with status %d: %w", reapedURB.Status, urbStatusError(reapedURB.Status))
+		}
+
 		// Find the callback for this URB
 		h.reapMutex.Lock()
-		callback, ok := h.reapMap[uintptr(unsafe.Pointer(reapedURB))]
+		completion, ok := h.reapMap[uintptr(unsafe.Pointer(reapedURB))]
 		if !ok {
 			// URB was reaped but not registered - can happen during shutdown
 			h.reapMutex.Unlock()
 			continue
 		}
 		delete(h.reapMap, uintptr(unsafe.Pointer(reapedURB)))
+		ready := completion.deliver(err)
 		h.reapMutex.Unlock()
 
-		// Call the callback with the URB status
-		var err error
-		if reapedURB.Status != 0 {
-			err = fmt.Errorf("URB completed with status: %d", reapedURB.Status)
+		for _, deliver := range ready {
+			deliver()
 		}
-		callback(err)
 	}
 }
 
@@ -211,6 +587,24 @@ func (h *DeviceHandle) Descriptor() DeviceDescriptor {
 }
 
 func (h *DeviceHandle) Configuration() (int, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return 0, ErrDeviceNotFound
+	}
+	if h.backend != nil {
+		return backendConfiguration(h.backend)
+	}
+	if h.readOnly {
+		// The kernel refuses GET_CONFIGURATION on a read-only node, but
+		// sysfs has the value; sysfsDir records the path it is read from
+		if _, err := h.device.sysfsDir(); err != nil {
+			return 0, err
+		}
+		return h.device.sysfsConfigurationValue()
+	}
+
 	buf := make([]byte, 1)
 
 	ctrl := usbCtrlRequest{
@@ -224,7 +618,7 @@ func (h *DeviceHandle) Configuration() (int, error) {
 
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
 	if errno != 0 {
-		return 0, errno
+		return 0, h.ioctlError(errno)
 	}
 
 	return int(buf[0]), nil
@@ -237,6 +631,15 @@ func (h *DeviceHandle) SetConfiguration(config int) error {
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
+
+	h.invalidateActiveConfig()
+
+	if h.backend != nil {
+		return backendSetConfiguration(h.backend, config)
+	}
 
 	cfg := uint32(config)
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_SETCONFIGURATION, uintptr(unsafe.Pointer(&cfg)))
@@ -247,20 +650,13 @@ func (h *DeviceHandle) SetConfiguration(config int) error {
 	return nil
 }
 
-// ConfigDescriptorByValue gets the parsed configuration descriptor by index
-// This is equivalent to libusb_get_config_descriptor
+// ConfigDescriptorByValue gets the parsed configuration descriptor by index.
+//
+// Deprecated: despite its name this takes an index on Linux, unlike on the
+// other platforms. Use ConfigDescriptorByIndex, or ConfigDescriptorByConfigValue
+// to look a configuration up by its bConfigurationValue.
 func (h *DeviceHandle) ConfigDescriptorByValue(index uint8) (*ConfigDescriptor, error) {
-	data, err := h.RawConfigDescriptor(index)
-	if err != nil {
-		return nil, err
-	}
-
-	config := &ConfigDescriptor{}
-	err = config.Unmarshal(data)
-	if err != nil {
-		return nil, err
-	}
-	return config, nil
+	return h.ConfigDescriptorByIndex(index)
 }
 
 // RawConfigDescriptor gets the raw configuration descriptor data by index
@@ -271,6 +667,13 @@ func (h *DeviceHandle) RawConfigDescriptor(index uint8) ([]byte, error) {
 	if h.closed {
 		return nil, ErrDeviceNotFound
 	}
+	if h.readOnly {
+		data, _, err := h.cachedDescriptor(USB_DT_CONFIG, index)
+		return data, err
+	}
+	if h.backend != nil {
+		return backendConfigDescriptor(h.backend, index)
+	}
 
 	// First get the config descriptor header to know the total length
 	buf := make([]byte, 9)
@@ -297,10 +700,13 @@ func (h *DeviceHandle) RawConfigDescriptor(index uint8) ([]byte, error) {
 	ctrl.Length = totalLength
 	ctrl.Data = unsafe.Pointer(&fullBuf[0])
 
-	_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
+	n, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
 	if errno != 0 {
 		return nil, fmt.Errorf("failed to get full config descriptor: %w", errno)
 	}
+	if err := ValidateConfigLength(fullBuf[:n]); err != nil {
+		return nil, err
+	}
 
 	return fullBuf, nil
 }
@@ -319,10 +725,24 @@ func (h *DeviceHandle) ClaimInterface(iface uint8) error {
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
 
 	if h.claimedIfaces[iface] {
 		return nil
 	}
+	if h.backend != nil {
+		if err := h.backend.ClaimInterface(iface); err != nil {
+			return err
+		}
+		h.claimedIfaces[iface] = true
+		return nil
+	}
+
+	// Note a kernel driver that the claim is about to disconnect, so that
+	// Close can bind it again
+	driver := h.boundDriver(iface)
 
 	// Use DISCONNECT_CLAIM with EXCEPT_DRIVER flag to atomically disconnect
 	// competing drivers and claim. This matches libusb's behavior.
@@ -335,6 +755,9 @@ func (h *DeviceHandle) ClaimInterface(iface uint8) error {
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_DISCONNECT_CLAIM, uintptr(unsafe.Pointer(&dc)))
 	if errno == 0 {
 		h.claimedIfaces[iface] = true
+		if driver != "" && driver != "usbfs" {
+			h.markDetached(iface)
+		}
 		return nil
 	}
 
@@ -369,13 +792,20 @@ func (h *DeviceHandle) releaseInterfaceInternal(iface uint8) error {
 		return nil
 	}
 
-	ifaceNum := uint32(iface)
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_RELEASEINTERFACE, uintptr(unsafe.Pointer(&ifaceNum)))
-	if errno != 0 {
-		return errno
+	if h.backend != nil {
+		if err := h.backend.ReleaseInterface(iface); err != nil {
+			return err
+		}
+	} else {
+		ifaceNum := uint32(iface)
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_RELEASEINTERFACE, uintptr(unsafe.Pointer(&ifaceNum)))
+		if errno != 0 {
+			return errno
+		}
 	}
 
 	delete(h.claimedIfaces, iface)
+	h.dropStreams(iface)
 	return nil
 }
 
@@ -386,27 +816,41 @@ func (h *DeviceHandle) SetInterfaceAltSetting(iface uint8, altSetting uint8) err
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
+
+	h.invalidateActiveConfig()
 
 	if !h.claimedIfaces[iface] {
 		return fmt.Errorf("interface %d not claimed", iface)
 	}
+	if h.backend != nil {
+		if err := h.backend.SetInterfaceAltSetting(iface, altSetting); err != nil {
+			return err
+		}
+	} else {
+		setIface := struct {
+			Interface  uint32
+			AltSetting uint32
+		}{
+			Interface:  uint32(iface),
+			AltSetting: uint32(altSetting),
+		}
 
-	setIface := struct {
-		Interface  uint32
-		AltSetting uint32
-	}{
-		Interface:  uint32(iface),
-		AltSetting: uint32(altSetting),
-	}
-
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_SETINTERFACE, uintptr(unsafe.Pointer(&setIface)))
-	if errno != 0 {
-		return errno
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_SETINTERFACE, uintptr(unsafe.Pointer(&setIface)))
+		if errno != 0 {
+			return errno
+		}
 	}
 
+	h.dropStreams(iface)
 	return nil
 }
 
+// ClearHalt clears a halt/stall condition on an endpoint. The kernel sends
+// CLEAR_FEATURE(ENDPOINT_HALT), which resets the device's data toggle, and
+// resets the host side of the endpoint to match.
 func (h *DeviceHandle) ClearHalt(endpoint uint8) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -414,6 +858,13 @@ func (h *DeviceHandle) ClearHalt(endpoint uint8) error {
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
+
+	if h.backend != nil {
+		return h.backend.ClearHalt(endpoint)
+	}
 
 	ep := uint32(endpoint)
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CLEAR_HALT, uintptr(unsafe.Pointer(&ep)))
@@ -431,17 +882,19 @@ func (h *DeviceHandle) DetachKernelDriver(iface uint8) error {
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
 
 	// Use USBDEVFS_DISCONNECT to detach kernel driver (matches libusb)
-	ifaceNum := uint32(iface)
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_DISCONNECT, uintptr(unsafe.Pointer(&ifaceNum)))
-	if errno != 0 {
+	if errno := h.interfaceIoctl(iface, USBDEVFS_DISCONNECT); errno != 0 {
 		if errno == syscall.ENODATA || errno == syscall.ENOENT || errno == syscall.ENOTTY {
 			return nil
 		}
 		return errno
 	}
 
+	h.markDetached(iface)
 	return nil
 }
 
@@ -453,23 +906,129 @@ func (h *DeviceHandle) AttachKernelDriver(iface uint8) error {
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
+
+	return h.attachKernelDriverInternal(iface)
+}
 
+func (h *DeviceHandle) attachKernelDriverInternal(iface uint8) error {
 	// Use USBDEVFS_CONNECT to re-attach kernel driver
-	ifaceNum := uint32(iface)
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONNECT, uintptr(unsafe.Pointer(&ifaceNum)))
-	if errno != 0 {
+	if errno := h.interfaceIoctl(iface, USBDEVFS_CONNECT); errno != 0 {
 		// ENODATA means driver was not previously bound
 		// EBUSY means driver is already attached
 		// Both are acceptable outcomes
-		if errno == syscall.ENODATA || errno == syscall.EBUSY {
-			return nil
+		if errno != syscall.ENODATA && errno != syscall.EBUSY {
+			return errno
 		}
-		return errno
 	}
 
+	delete(h.detachedIfaces, iface)
 	return nil
 }
 
+// SetReattachOnClose controls whether Close binds the kernel drivers that
+// were detached through the handle, by DetachKernelDriver or by
+// ClaimInterface taking an interface from its driver, back to their
+// interfaces, so that a device such as a webcam returns to uvcvideo without
+// every caller deferring AttachKernelDriver. Interfaces that had no driver
+// when the handle found them are left unbound.
+func (h *DeviceHandle) SetReattachOnClose(reattach bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reattachOnClose = reattach
+}
+
+// markDetached records that the kernel driver of iface was detached through
+// the handle. The caller must hold h.mu for writing.
+func (h *DeviceHandle) markDetached(iface uint8) {
+	if h.detachedIfaces == nil {
+		h.detachedIfaces = make(map[uint8]bool)
+	}
+	h.detachedIfaces[iface] = true
+}
+
+// reattachKernelDrivers binds the detached kernel drivers again if the handle
+// was asked to on Close. The interfaces must have been released first. The
+// caller must hold h.mu for writing.
+func (h *DeviceHandle) reattachKernelDrivers() {
+	if !h.reattachOnClose {
+		return
+	}
+	for iface := range h.detachedIfaces {
+		h.attachKernelDriverInternal(iface)
+	}
+}
+
+// usbdevfsIoctl matches the kernel's usbdevfs_ioctl struct, through which
+// usbfs passes requests such as USBDEVFS_DISCONNECT to one interface
+type usbdevfsIoctl struct {
+	Interface int32
+	IoctlCode int32
+	Data      unsafe.Pointer
+}
+
+// interfaceIoctl issues an argumentless interface request through
+// USBDEVFS_IOCTL, the only way usbfs accepts USBDEVFS_DISCONNECT and
+// USBDEVFS_CONNECT
+func (h *DeviceHandle) interfaceIoctl(iface uint8, code uint32) syscall.Errno {
+	if h.backend != nil {
+		// Backend devices have no kernel drivers to detach or attach
+		return syscall.ENODATA
+	}
+	cmd := usbdevfsIoctl{Interface: int32(iface), IoctlCode: int32(code)}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_IOCTL, uintptr(unsafe.Pointer(&cmd)))
+	return errno
+}
+
+// usbdevfsGetDriver matches the kernel's usbdevfs_getdriver struct
+type usbdevfsGetDriver struct {
+	Interface uint32
+	Driver    [256]byte
+}
+
+// GetKernelDriver returns the name of the kernel driver bound to iface, such
+// as "usb-storage" or "uvcvideo", with the USBDEVFS_GETDRIVER ioctl. An
+// interface claimed through usbfs, by this or another process, reports
+// "usbfs". An interface without a driver returns ErrNoDriver.
+func (h *DeviceHandle) GetKernelDriver(iface uint8) (string, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return "", ErrDeviceNotFound
+	}
+	return h.kernelDriver(iface)
+}
+
+// kernelDriver does the work of GetKernelDriver. The caller must hold h.mu.
+func (h *DeviceHandle) kernelDriver(iface uint8) (string, error) {
+	if h.backend != nil {
+		return "", ErrNotSupported
+	}
+	gd := usbdevfsGetDriver{Interface: uint32(iface)}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_GETDRIVER, uintptr(unsafe.Pointer(&gd)))
+	if errno == syscall.ENODATA {
+		return "", ErrNoDriver
+	}
+	if errno != 0 {
+		return "", h.ioctlError(errno)
+	}
+	name := gd.Driver[:]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return string(name), nil
+}
+
+// boundDriver returns the name of the kernel driver bound to iface, or ""
+// if there is none or it cannot be read
+func (h *DeviceHandle) boundDriver(iface uint8) string {
+	name, _ := h.kernelDriver(iface)
+	return name
+}
+
 // Status gets device, interface, or endpoint status
 func (h *DeviceHandle) Status(requestType uint8, index uint16) (uint16, error) {
 	h.mu.RLock()
@@ -490,9 +1049,15 @@ func (h *DeviceHandle) Status(requestType uint8, index uint16) (uint16, error) {
 		Data:        unsafe.Pointer(&buf[0]),
 	}
 
+	if h.backend != nil {
+		if _, err := h.backendControl(&ctrl); err != nil {
+			return 0, err
+		}
+		return binary.LittleEndian.Uint16(buf), nil
+	}
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
 	if errno != 0 {
-		return 0, errno
+		return 0, h.ioctlError(errno)
 	}
 
 	return binary.LittleEndian.Uint16(buf), nil
@@ -506,6 +1071,9 @@ func (h *DeviceHandle) ClearFeature(requestType uint8, feature uint16, index uin
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
 
 	ctrl := usbCtrlRequest{
 		RequestType: requestType, // 0x00 for device, 0x01 for interface, 0x02 for endpoint
@@ -516,6 +1084,10 @@ func (h *DeviceHandle) ClearFeature(requestType uint8, feature uint16, index uin
 		Data:        nil,
 	}
 
+	if h.backend != nil {
+		_, err := h.backendControl(&ctrl)
+		return err
+	}
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
 	if errno != 0 {
 		return errno
@@ -532,6 +1104,9 @@ func (h *DeviceHandle) SetFeature(requestType uint8, feature uint16, index uint1
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
 
 	ctrl := usbCtrlRequest{
 		RequestType: requestType, // 0x00 for device, 0x01 for interface, 0x02 for endpoint
@@ -542,6 +1117,10 @@ func (h *DeviceHandle) SetFeature(requestType uint8, feature uint16, index uint1
 		Data:        nil,
 	}
 
+	if h.backend != nil {
+		_, err := h.backendControl(&ctrl)
+		return err
+	}
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
 	if errno != 0 {
 		return errno
@@ -570,9 +1149,15 @@ func (h *DeviceHandle) Interface(iface uint8) (uint8, error) {
 		Data:        unsafe.Pointer(&buf[0]),
 	}
 
+	if h.backend != nil {
+		if _, err := h.backendControl(&ctrl); err != nil {
+			return 0, err
+		}
+		return buf[0], nil
+	}
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
 	if errno != 0 {
-		return 0, errno
+		return 0, h.ioctlError(errno)
 	}
 
 	return buf[0], nil
@@ -586,6 +1171,17 @@ func (h *DeviceHandle) RawDescriptor(descType uint8, descIndex uint8, langID uin
 	if h.closed {
 		return 0, ErrDeviceNotFound
 	}
+	if h.readOnly {
+		if desc, ok, err := h.cachedDescriptor(descType, descIndex); ok {
+			if err != nil {
+				return 0, err
+			}
+			return copy(data, desc), nil
+		}
+	}
+	if h.backend != nil {
+		return h.backend.ControlTransfer(0x80, USB_REQ_GET_DESCRIPTOR, (uint16(descType)<<8)|uint16(descIndex), langID, data, 0)
+	}
 
 	var dataPtr unsafe.Pointer
 	if len(data) > 0 {
@@ -603,7 +1199,7 @@ func (h *DeviceHandle) RawDescriptor(descType uint8, descIndex uint8, langID uin
 
 	ret, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
 	if errno != 0 {
-		return 0, errno
+		return 0, h.ioctlError(errno)
 	}
 
 	return int(ret), nil
@@ -617,6 +1213,9 @@ func (h *DeviceHandle) SetDescriptor(descType uint8, descIndex uint8, langID uin
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
 
 	var dataPtr unsafe.Pointer
 	if len(data) > 0 {
@@ -632,6 +1231,10 @@ func (h *DeviceHandle) SetDescriptor(descType uint8, descIndex uint8, langID uin
 		Data:        dataPtr,
 	}
 
+	if h.backend != nil {
+		_, err := h.backendControl(&ctrl)
+		return err
+	}
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
 	if errno != 0 {
 		return errno
@@ -660,6 +1263,12 @@ func (h *DeviceHandle) SynchFrame(endpoint uint8) (uint16, error) {
 		Data:        unsafe.Pointer(&buf[0]),
 	}
 
+	if h.backend != nil {
+		if _, err := h.backendControl(&ctrl); err != nil {
+			return 0, err
+		}
+		return binary.LittleEndian.Uint16(buf), nil
+	}
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
 	if errno != 0 {
 		return 0, errno
@@ -677,6 +1286,10 @@ func (h *DeviceHandle) Capabilities() (uint32, error) {
 		return 0, ErrDeviceNotFound
 	}
 
+	if h.backend != nil {
+		return 0, ErrNotSupported
+	}
+
 	var caps uint32
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_GET_CAPABILITIES, uintptr(unsafe.Pointer(&caps)))
 	if errno != 0 {
@@ -695,6 +1308,10 @@ func (h *DeviceHandle) Speed() (uint8, error) {
 		return 0, ErrDeviceNotFound
 	}
 
+	if h.backend != nil {
+		return 0, ErrNotSupported
+	}
+
 	var speed uint32
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_GET_SPEED, uintptr(unsafe.Pointer(&speed)))
 	if errno != 0 {
@@ -704,14 +1321,31 @@ func (h *DeviceHandle) Speed() (uint8, error) {
 	return uint8(speed), nil
 }
 
-// AllocStreams allocates bulk streams (USB 3.0+)
+// AllocStreams allocates bulk streams (USB 3.0+) on endpoints whose
+// interfaces are in an alternate setting that supports them; for an endpoint
+// without stream support it returns ErrNotSupported before asking the kernel.
+// The host controller may allocate fewer streams than asked for; transfers
+// on stream IDs 1 to the number allocated can then be made with
+// BulkStreamTransfer. The streams last until FreeStreams, until their
+// interface changes alternate setting or is released, or until a reset.
 func (h *DeviceHandle) AllocStreams(numStreams uint32, endpoints []uint8) error {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	ifaces, err := h.checkStreamEndpoints(endpoints)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
+	if h.backend != nil {
+		return ErrNotSupported
+	}
 
 	streams := struct {
 		NumStreams uint32
@@ -724,22 +1358,44 @@ func (h *DeviceHandle) AllocStreams(numStreams uint32, endpoints []uint8) error
 
 	copy(streams.Eps[:], endpoints)
 
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_ALLOC_STREAMS, uintptr(unsafe.Pointer(&streams)))
+	allocated, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_ALLOC_STREAMS, uintptr(unsafe.Pointer(&streams)))
 	if errno != 0 {
 		return errno
 	}
 
+	if h.streams == nil {
+		h.streams = make(map[uint8]endpointStreams)
+	}
+	for i, ep := range endpoints {
+		h.streams[ep] = endpointStreams{iface: ifaces[i], count: uint32(allocated)}
+	}
 	return nil
 }
 
+// dropStreams forgets the streams allocated on the endpoints of iface, once
+// the kernel has freed them. Called with mu held.
+func (h *DeviceHandle) dropStreams(iface uint8) {
+	for ep, s := range h.streams {
+		if s.iface == iface {
+			delete(h.streams, ep)
+		}
+	}
+}
+
 // FreeStreams frees bulk streams (USB 3.0+)
 func (h *DeviceHandle) FreeStreams(endpoints []uint8) error {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
+	if h.backend != nil {
+		return ErrNotSupported
+	}
 
 	streams := struct {
 		NumEps uint32
@@ -755,262 +1411,90 @@ func (h *DeviceHandle) FreeStreams(endpoints []uint8) error {
 		return errno
 	}
 
+	for _, ep := range endpoints {
+		delete(h.streams, ep)
+	}
 	return nil
 }
 
 // SSEndpointCompanionDescriptor gets the SuperSpeed endpoint companion descriptor for a given endpoint
-// This is equivalent to libusb_get_ss_endpoint_companion_descriptor
+// This is equivalent to libusb_get_ss_endpoint_companion_descriptor. The
+// configuration is read by index, so it need not be the active one.
 func (h *DeviceHandle) SSEndpointCompanionDescriptor(configIndex uint8, interfaceNumber uint8, altSetting uint8, endpointAddress uint8) (*SuperSpeedEndpointCompanionDescriptor, error) {
-	config, err := h.ConfigDescriptorByValue(configIndex)
+	data, err := h.RawConfigDescriptor(configIndex)
 	if err != nil {
 		return nil, err
 	}
 
-	altSettingDesc := config.InterfaceAltSetting(interfaceNumber, altSetting)
-	if altSettingDesc == nil {
-		return nil, fmt.Errorf("interface %d alt setting %d not found", interfaceNumber, altSetting)
-	}
-
-	// Find the endpoint and return its companion descriptor if present
-	for i := range altSettingDesc.Endpoints {
-		if altSettingDesc.Endpoints[i].EndpointAddr == endpointAddress {
-			if altSettingDesc.Endpoints[i].SSCompanion != nil {
-				return altSettingDesc.Endpoints[i].SSCompanion, nil
-			}
-			// Search through extra data if companion wasn't parsed
-			extra := altSettingDesc.Endpoints[i].Extra
-			pos := 0
-			for pos+2 <= len(extra) {
-				length := int(extra[pos])
-				descType := extra[pos+1]
-
-				if length < 2 || pos+length > len(extra) {
-					break
-				}
-
-				if descType == USB_DT_SS_ENDPOINT_COMPANION {
-					if length < 6 {
-						return nil, fmt.Errorf("invalid SS endpoint companion descriptor length: %d", length)
-					}
-					return &SuperSpeedEndpointCompanionDescriptor{
-						Length:           extra[pos],
-						DescriptorType:   extra[pos+1],
-						MaxBurst:         extra[pos+2],
-						Attributes:       extra[pos+3],
-						BytesPerInterval: binary.LittleEndian.Uint16(extra[pos+4 : pos+6]),
-					}, nil
-				}
-
-				pos += length
-			}
-			return nil, fmt.Errorf("SS endpoint companion descriptor not found for endpoint %02x", endpointAddress)
-		}
+	config := &ConfigDescriptor{}
+	if err := config.Unmarshal(data); err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("endpoint %02x not found", endpointAddress)
+	return config.SSEndpointCompanion(interfaceNumber, altSetting, endpointAddress)
 }
 
 // SSUSBDeviceCapabilityDescriptor gets the SuperSpeed USB device capability descriptor
 // This is equivalent to libusb_get_ss_usb_device_capability_descriptor
 func (h *DeviceHandle) SSUSBDeviceCapabilityDescriptor() (*SuperSpeedUSBCapability, error) {
-	// Read the full BOS descriptor once
-	buf := make([]byte, 1024) // Start with reasonable size
-	n, err := h.RawDescriptor(USB_DT_BOS, 0, 0, buf)
-	if err != nil || n < 5 {
-		return nil, fmt.Errorf("failed to read BOS descriptor: %w", err)
-	}
-
-	// Resize buffer to actual data read
-	buf = buf[:n]
-
-	// Parse BOS header
-	if buf[1] != USB_DT_BOS {
-		return nil, fmt.Errorf("not a BOS descriptor")
-	}
-
-	totalLength := binary.LittleEndian.Uint16(buf[2:4])
-	if int(totalLength) > n {
-		// Need to read more data
-		buf = make([]byte, totalLength)
-		n, err = h.RawDescriptor(USB_DT_BOS, 0, 0, buf)
-		if err != nil || n < int(totalLength) {
-			return nil, fmt.Errorf("failed to read full BOS descriptor: %w", err)
-		}
-		buf = buf[:n]
-	}
-
-	numDevCaps := buf[4]
-	pos := 5 // Start after BOS header
-
-	// Look for SuperSpeed USB capability (type 0x03)
-	for i := 0; i < int(numDevCaps) && pos < len(buf); i++ {
-		if pos+3 > len(buf) {
-			break
-		}
-
-		length := int(buf[pos])
-		descType := buf[pos+1]
-		devCapType := buf[pos+2]
-
-		if length < 3 || pos+length > len(buf) {
-			break
-		}
-
-		if descType == USB_DT_DEVICE_CAPABILITY && devCapType == 0x03 {
-			// Found SuperSpeed USB capability
-			if length < 10 {
-				return nil, fmt.Errorf("invalid SuperSpeed USB capability length: %d", length)
-			}
-
-			return &SuperSpeedUSBCapability{
-				Length:                 buf[pos],
-				DescriptorType:         buf[pos+1],
-				DevCapabilityType:      buf[pos+2],
-				Attributes:             buf[pos+3],
-				SpeedsSupported:        binary.LittleEndian.Uint16(buf[pos+4 : pos+6]),
-				FunctionalitySupported: buf[pos+6],
-				U1DevExitLat:           buf[pos+7],
-				U2DevExitLat:           binary.LittleEndian.Uint16(buf[pos+8 : pos+10]),
-			}, nil
-		}
-
-		pos += length
+	data, err := h.RawBOSDescriptor()
+	if err != nil {
+		return nil, err
 	}
-
-	return nil, fmt.Errorf("SuperSpeed USB capability not found")
+	return parseSuperSpeedUSBCapability(data)
 }
 
 // USB20ExtensionDescriptor gets the USB 2.0 extension descriptor
 // This is equivalent to libusb_get_usb_2_0_extension_descriptor
 func (h *DeviceHandle) USB20ExtensionDescriptor() (*USB2ExtensionCapability, error) {
-	// Read the full BOS descriptor once
-	buf := make([]byte, 1024) // Start with reasonable size
-	n, err := h.RawDescriptor(USB_DT_BOS, 0, 0, buf)
-	if err != nil || n < 5 {
-		return nil, fmt.Errorf("failed to read BOS descriptor: %w", err)
-	}
-
-	// Resize buffer to actual data read
-	buf = buf[:n]
-
-	// Parse BOS header
-	if buf[1] != USB_DT_BOS {
-		return nil, fmt.Errorf("not a BOS descriptor")
-	}
-
-	totalLength := binary.LittleEndian.Uint16(buf[2:4])
-	if int(totalLength) > n {
-		// Need to read more data
-		buf = make([]byte, totalLength)
-		n, err = h.RawDescriptor(USB_DT_BOS, 0, 0, buf)
-		if err != nil || n < int(totalLength) {
-			return nil, fmt.Errorf("failed to read full BOS descriptor: %w", err)
-		}
-		buf = buf[:n]
+	data, err := h.RawBOSDescriptor()
+	if err != nil {
+		return nil, err
 	}
+	return parseUSB20ExtensionCapability(data)
+}
 
-	numDevCaps := buf[4]
-	pos := 5 // Start after BOS header
-
-	// Look for USB 2.0 extension capability (type 0x02)
-	for i := 0; i < int(numDevCaps) && pos < len(buf); i++ {
-		if pos+3 > len(buf) {
-			break
-		}
-
-		length := int(buf[pos])
-		descType := buf[pos+1]
-		devCapType := buf[pos+2]
-
-		if length < 3 || pos+length > len(buf) {
-			break
-		}
-
-		if descType == USB_DT_DEVICE_CAPABILITY && devCapType == 0x02 {
-			// Found USB 2.0 extension capability
-			if length < 7 {
-				return nil, fmt.Errorf("invalid USB 2.0 extension capability length: %d", length)
-			}
-
-			return &USB2ExtensionCapability{
-				Length:            buf[pos],
-				DescriptorType:    buf[pos+1],
-				DevCapabilityType: buf[pos+2],
-				Attributes:        binary.LittleEndian.Uint32(buf[pos+3 : pos+7]),
-			}, nil
-		}
-
-		pos += length
+// ReadBOSDescriptor reads the Binary Object Store descriptor. BOS is not
+// limited to SuperSpeed: USB 2.1 devices use it to report LPM support.
+func (h *DeviceHandle) ReadBOSDescriptor() (*BOSDescriptor, []DeviceCapabilityDescriptor, error) {
+	data, err := h.RawBOSDescriptor()
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return nil, fmt.Errorf("USB 2.0 extension capability not found")
+	return parseBOSDescriptor(data)
 }
 
-// ReadBOSDescriptor reads the Binary Object Store descriptor (USB 3.0+)
-func (h *DeviceHandle) ReadBOSDescriptor() (*BOSDescriptor, []DeviceCapabilityDescriptor, error) {
+// RawBOSDescriptor reads the complete Binary Object Store descriptor,
+// including every device capability, so callers can parse capabilities the
+// library does not decode itself
+func (h *DeviceHandle) RawBOSDescriptor() ([]byte, error) {
 	// First, get the BOS descriptor header
 	buf := make([]byte, 5) // BOS descriptor header is 5 bytes
 
 	n, err := h.RawDescriptor(USB_DT_BOS, 0, 0, buf)
 	if err != nil || n < 5 {
-		return nil, nil, fmt.Errorf("failed to read BOS descriptor: %w", err)
+		return nil, fmt.Errorf("failed to read BOS descriptor: %w", err)
 	}
 
 	// Validate descriptor type
 	if buf[1] != USB_DT_BOS {
-		return nil, nil, fmt.Errorf("not a BOS descriptor (type: 0x%02x)", buf[1])
-	}
-
-	bos := &BOSDescriptor{
-		Length:         buf[0],
-		DescriptorType: buf[1],
-		TotalLength:    binary.LittleEndian.Uint16(buf[2:4]),
-		NumDeviceCaps:  buf[4],
+		return nil, fmt.Errorf("not a BOS descriptor (type: 0x%02x)", buf[1])
 	}
 
 	// Validate total length is reasonable (not too small)
-	if bos.TotalLength < 5 {
-		return nil, nil, fmt.Errorf("invalid BOS total length: %d", bos.TotalLength)
+	totalLength := binary.LittleEndian.Uint16(buf[2:4])
+	if totalLength < 5 {
+		return nil, fmt.Errorf("invalid BOS total length: %d", totalLength)
 	}
-	// Note: TotalLength is uint16, so max value is 65535
 
 	// Now read the full BOS descriptor with all capabilities
-	fullBuf := make([]byte, bos.TotalLength)
+	fullBuf := make([]byte, totalLength)
 	n, err = h.RawDescriptor(USB_DT_BOS, 0, 0, fullBuf)
-	if err != nil || n < int(bos.TotalLength) {
-		return nil, nil, fmt.Errorf("failed to read full BOS descriptor: %w", err)
+	if err != nil || n < int(totalLength) {
+		return nil, fmt.Errorf("failed to read full BOS descriptor: %w", err)
 	}
 
-	// Parse device capabilities
-	caps := make([]DeviceCapabilityDescriptor, 0, bos.NumDeviceCaps)
-	pos := 5 // Start after BOS header
-
-	for i := 0; i < int(bos.NumDeviceCaps) && pos < len(fullBuf); i++ {
-		if pos+3 > len(fullBuf) {
-			break
-		}
-
-		length := int(fullBuf[pos])
-
-		// Validate descriptor length
-		if length < 3 {
-			break // Invalid descriptor length
-		}
-		if pos+length > len(fullBuf) {
-			break // Descriptor extends beyond buffer
-		}
-
-		cap := DeviceCapabilityDescriptor{
-			Length:            fullBuf[pos],
-			DescriptorType:    fullBuf[pos+1],
-			DevCapabilityType: fullBuf[pos+2],
-		}
-
-		caps = append(caps, cap)
-		pos += length
-	}
-
-	return bos, caps, nil
+	return fullBuf[:n], nil
 }
 
 // ReadDeviceQualifierDescriptor reads device qualifier (USB 2.0+)
@@ -1048,59 +1532,86 @@ func (h *DeviceHandle) Device() *Device {
 
 // Fd returns the file descriptor for advanced operations (URB submission, etc.)
 // The caller should not close this file descriptor.
+//
+// Deprecated: use FD, which is available on every platform and reports a
+// closed handle.
 func (h *DeviceHandle) Fd() int {
 	return h.fd
 }
 
+// FD returns the usbfs file descriptor of the handle, for integrating with
+// epoll, io_uring or other event loops the library does not provide. The
+// descriptor is shared with the handle's clones and the library's reaper:
+// ioctls issued on it directly bypass the library's tracking of claimed
+// interfaces, alternate settings and in-flight URBs, and reaping URBs on it
+// yourself while the library has transfers pending steals their
+// completions. Do not close it; it is closed with the last handle. A handle on
+// a Backend has no descriptor and returns ErrNotSupported.
+func (h *DeviceHandle) FD() (uintptr, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return 0, ErrDeviceNotFound
+	}
+	if h.backend != nil {
+		return 0, ErrNotSupported
+	}
+	return uintptr(h.fd), nil
+}
+
 func (h *DeviceHandle) StringDescriptor(index uint8) (string, error) {
 	if index == 0 {
 		return "", nil
 	}
 
-	buf := make([]byte, 256)
-
-	ctrl := usbCtrlRequest{
-		RequestType: 0x80,
-		Request:     0x06,
-		Value:       (0x03 << 8) | uint16(index),
-		Index:       0x0409,
-		Length:      uint16(len(buf)),
-		Data:        unsafe.Pointer(&buf[0]),
-	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
-	if errno != 0 {
-		return "", errno
+	if h.closed {
+		return "", ErrDeviceNotFound
 	}
-
-	if buf[0] < 2 {
-		return "", fmt.Errorf("invalid string descriptor")
+	if h.readOnly {
+		return h.sysfsString(index)
 	}
-
-	length := int(buf[0])
-	if length > len(buf) {
-		length = len(buf)
+	if h.backend != nil {
+		return backendStringDescriptor(h.backend, index)
 	}
 
-	result := make([]uint16, 0, (length-2)/2)
-	for i := 2; i < length; i += 2 {
-		if i+1 < length {
-			result = append(result, binary.LittleEndian.Uint16(buf[i:i+2]))
+	return fetchStringDescriptor(func(buf []byte) (int, error) {
+		ctrl := usbCtrlRequest{
+			RequestType: 0x80,
+			Request:     0x06,
+			Value:       (0x03 << 8) | uint16(index),
+			Index:       0x0409,
+			Length:      uint16(len(buf)),
+			Data:        unsafe.Pointer(&buf[0]),
 		}
-	}
 
-	return string(utf16ToRunes(result)), nil
+		n, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
+		if errno != 0 {
+			return 0, errno
+		}
+		return int(n), nil
+	})
 }
 
-func utf16ToRunes(u16 []uint16) []rune {
-	runes := make([]rune, 0, len(u16))
-	for _, v := range u16 {
-		if v == 0 {
-			break
+// sysfsString returns a string descriptor of a read-only handle from the
+// strings sysfs recorded at enumeration, which covers the manufacturer,
+// product and serial number
+func (h *DeviceHandle) sysfsString(index uint8) (string, error) {
+	strs, desc := h.device.SysfsStrings, h.device.Descriptor
+	if strs != nil {
+		switch index {
+		case desc.ManufacturerIndex:
+			return strs.Manufacturer, nil
+		case desc.ProductIndex:
+			return strs.Product, nil
+		case desc.SerialNumberIndex:
+			return strs.Serial, nil
 		}
-		runes = append(runes, rune(v))
 	}
-	return runes
+	return "", ErrReadOnly
 }
 
 type usbCtrlRequest struct {
@@ -1196,6 +1707,7 @@ func WrapSysDevice(fd int) (*DeviceHandle, error) {
 		fd:            fd,
 		claimedIfaces: make(map[uint8]bool),
 		closed:        false,
-		reapMap:       make(map[uintptr]func(error)),
+		refs:          newHandleRefs(),
+		urbReaper:     newURBReaper(),
 	}, nil
 }
@@ -0,0 +1,86 @@
+package usb
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenReadOnly(t *testing.T) {
+	// The node of a device with configurations 1 and 2, of which sysfs says
+	// 2 is active. A regular file reads like a usbfs node.
+	node, _ := hex.DecodeString(
+		"12010002000000406d0425080100" + "01020002" + // Device descriptor, strings 1 and 2
+			"090219000101008032" + "0904000001ff000000" + "0705810240000a" + // Configuration 1, endpoint 0x81
+			"090219000102008032" + "0904000001ff000000" + "0705820240000a") // Configuration 2, endpoint 0x82
+	dir := t.TempDir()
+	path := filepath.Join(dir, "node")
+	if err := os.WriteFile(path, node, 0o444); err != nil {
+		t.Fatal(err)
+	}
+	sysfs := filepath.Join(dir, "1-2")
+	writeSysfsAttrs(t, sysfs, map[string]string{"bConfigurationValue": "2"})
+
+	d := &Device{
+		Path:         path,
+		Bus:          1,
+		Address:      3,
+		Descriptor:   DeviceDescriptor{VendorID: 0x046d, ManufacturerIndex: 1, ProductIndex: 2, NumConfigurations: 2},
+		SysfsStrings: &SysfsStrings{Manufacturer: "Logitech", Product: "Webcam"},
+		sysfsPath:    sysfs,
+	}
+	h, err := d.OpenReadOnly()
+	if err != nil {
+		t.Fatalf("OpenReadOnly() error = %v", err)
+	}
+	defer h.Close()
+
+	if config, err := h.Configuration(); err != nil || config != 2 {
+		t.Errorf("Configuration() = %d, %v, want 2", config, err)
+	}
+	if config, err := h.GetConfiguration(); err != nil || config != 2 {
+		t.Errorf("GetConfiguration() = %d, %v, want 2", config, err)
+	}
+	config, err := h.GetActiveConfigDescriptor()
+	if err != nil {
+		t.Fatalf("GetActiveConfigDescriptor() error = %v", err)
+	}
+	if config.ConfigurationValue != 2 || config.FindEndpoint(0x82) == nil {
+		t.Errorf("GetActiveConfigDescriptor() = configuration %d, want 2 with endpoint 0x82", config.ConfigurationValue)
+	}
+
+	// Descriptors come from what the node read
+	if desc, err := h.ConfigDescriptorByIndex(0); err != nil || desc.ConfigurationValue != 1 {
+		t.Errorf("ConfigDescriptorByIndex(0) = %+v, %v, want configuration 1", desc, err)
+	}
+	if _, err := h.RawConfigDescriptor(2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RawConfigDescriptor(2) error = %v, want ErrNotFound", err)
+	}
+	buf := make([]byte, 18)
+	if n, err := h.ControlTransfer(0x80, USB_REQ_GET_DESCRIPTOR, USB_DT_DEVICE<<8, 0, buf, time.Second); err != nil || n != 18 || buf[8] != 0x6d {
+		t.Errorf("GET_DESCRIPTOR(device) = %x, %v, want the device descriptor", buf[:n], err)
+	}
+	if s, err := h.StringDescriptor(2); err != nil || s != "Webcam" {
+		t.Errorf("StringDescriptor(2) = %q, %v, want Webcam", s, err)
+	}
+	if _, err := h.StringDescriptor(3); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("StringDescriptor(3) error = %v, want ErrReadOnly", err)
+	}
+
+	// Nothing may write to the device
+	if err := h.SetConfiguration(1); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("SetConfiguration() error = %v, want ErrReadOnly", err)
+	}
+	if err := h.ClaimInterface(0); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("ClaimInterface() error = %v, want ErrReadOnly", err)
+	}
+	if _, err := h.BulkTransfer(0x82, buf, time.Second); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("BulkTransfer() error = %v, want ErrReadOnly", err)
+	}
+	if _, err := h.ControlTransfer(0x40, 0x01, 0, 0, nil, time.Second); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("ControlTransfer(OUT) error = %v, want ErrReadOnly", err)
+	}
+}
@@ -3,6 +3,8 @@ package usb
 import (
 	"encoding/binary"
 	"fmt"
+	"maps"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -113,19 +115,15 @@ type Device struct {
 	Descriptor   DeviceDescriptor
 	Configs      []RawConfigDescriptor
 	SysfsStrings *SysfsStrings
-	devicePath   string // Windows device path (e.g., \\?\usb#vid_xxxx&pid_xxxx...)
-}
 
-// utf16ToRunes converts UTF-16 to runes
-func utf16ToRunes(u16 []uint16) []rune {
-	runes := make([]rune, 0, len(u16))
-	for _, v := range u16 {
-		if v == 0 {
-			break
-		}
-		runes = append(runes, rune(v))
-	}
-	return runes
+	// Topology of the device. It is not read on Windows yet, so Parent is
+	// always nil.
+	Parent   *Device
+	Port     uint8
+	Children []*Device
+
+	devicePath string  // Windows device path (e.g., \\?\usb#vid_xxxx&pid_xxxx...)
+	backend    Backend // Backend the device was listed from, if any
 }
 
 // DeviceHandle represents an open USB device handle on Windows
@@ -138,10 +136,78 @@ type DeviceHandle struct {
 	mu               sync.RWMutex
 	closed           bool
 	currentConfig    int
+
+	// Cached active configuration and the configuration generation it was
+	// read in, guarded by mu
+	activeConfig *ConfigDescriptor
+	configGen    uint64
+
+	// Every configuration as read by Configurations, the generation they
+	// were read in and how long that took, guarded by mu
+	configs     []*ConfigDescriptor
+	configsGen  uint64
+	configStats ConfigReadStats
+
+	policies map[uint8]EndpointPolicy // Set by SetEndpointPolicy, guarded by mu
+
+	defaultTimeout time.Duration // Set by SetDefaultTimeout, guarded by mu
+
+	refs *handleRefs // Shared with clones of the handle
+
+	backend BackendHandle // Set for handles on a Backend device
+}
+
+// defaultControlTimeout bounds control transfers made without a timeout
+// until SetDefaultTimeout is called
+const defaultControlTimeout = 5 * time.Second
+
+// SetDefaultTimeout sets the timeout of ControlTransfer calls with a zero
+// timeout and of the transfers started by SubmitControl. A timeout of zero
+// restores the default of 5 seconds.
+func (h *DeviceHandle) SetDefaultTimeout(timeout time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.defaultTimeout = timeout
+}
+
+// controlTimeout returns timeout in milliseconds for WaitForSingleObject,
+// substituting the default timeout when it is zero. The caller must hold mu.
+func (h *DeviceHandle) controlTimeout(timeout time.Duration) uint32 {
+	if timeout <= 0 {
+		timeout = h.defaultTimeout
+	}
+	if timeout <= 0 {
+		timeout = defaultControlTimeout
+	}
+	return uint32(timeout.Milliseconds())
+}
+
+// openDevices holds a copy of each device this process has open, keyed by
+// device path. WinUSB gives a single process exclusive access, so enumeration
+// lists these copies instead of opening the devices a second time.
+var (
+	openDevicesMu sync.Mutex
+	openDevices   = make(map[string]Device)
+)
+
+// openDevice returns the copy of the device at path if this process has it open
+func openDevice(path string) (*Device, bool) {
+	openDevicesMu.Lock()
+	defer openDevicesMu.Unlock()
+
+	d, ok := openDevices[path]
+	if !ok {
+		return nil, false
+	}
+	return &d, true
 }
 
 // Open opens the USB device
-func (d *Device) Open() (*DeviceHandle, error) {
+func (d *Device) Open(opts ...OpenOption) (*DeviceHandle, error) {
+	if d.backend != nil {
+		return d.openBackend(opts)
+	}
+
 	// Open the device file
 	pathPtr, err := windows.UTF16PtrFromString(d.devicePath)
 	if err != nil {
@@ -173,7 +239,7 @@ func (d *Device) Open() (*DeviceHandle, error) {
 		return nil, fmt.Errorf("WinUsb_Initialize failed: %w", e1)
 	}
 
-	return &DeviceHandle{
+	h := &DeviceHandle{
 		device:           d,
 		fileHandle:       fileHandle,
 		winusbHandle:     winusbHandle,
@@ -181,7 +247,46 @@ func (d *Device) Open() (*DeviceHandle, error) {
 		claimedIfaces:    make(map[uint8]bool),
 		closed:           false,
 		currentConfig:    1, // Windows typically uses config 1
-	}, nil
+		refs:             newHandleRefs(),
+	}
+
+	if err := h.applyOpenQuirks(); err != nil {
+		h.Close()
+		return nil, err
+	}
+	if err := h.applyOpenOptions(opts); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	openDevicesMu.Lock()
+	openDevices[d.devicePath] = *d
+	openDevicesMu.Unlock()
+
+	return h, nil
+}
+
+// PortPath returns the device instance ID, such as
+// USB\VID_046D&PID_0825\5&2A3B1C2D&0&2, derived from the device path. Windows
+// keeps it across re-enumeration and reboots; for a device without a serial
+// number the last part encodes the hub and port it is plugged into, while a
+// device with one keeps its ID on any port.
+func (d *Device) PortPath() (string, error) {
+	path := strings.TrimPrefix(d.devicePath, `\\?\`)
+	if path == "" {
+		return "", ErrNotFound
+	}
+	// Drop the device interface class GUID after the instance ID
+	if i := strings.LastIndex(path, "#{"); i >= 0 {
+		path = path[:i]
+	}
+	return strings.ToUpper(strings.ReplaceAll(path, "#", `\`)), nil
+}
+
+// OpenReadOnly is not supported on Windows, where WinUSB has no read-only
+// open.
+func (d *Device) OpenReadOnly() (*DeviceHandle, error) {
+	return nil, ErrNotSupported
 }
 
 // Close closes the device handle
@@ -194,11 +299,26 @@ func (h *DeviceHandle) Close() error {
 	}
 	h.closed = true
 
+	if h.backend != nil {
+		for iface := range h.claimedIfaces {
+			h.releaseInterfaceInternal(iface)
+		}
+		return h.backend.Close()
+	}
+
 	// Release all interfaces
 	for iface := range h.interfaceHandles {
 		h.releaseInterfaceInternal(iface)
 	}
 
+	if !h.refs.release() {
+		return nil
+	}
+
+	openDevicesMu.Lock()
+	delete(openDevices, h.device.devicePath)
+	openDevicesMu.Unlock()
+
 	// Free WinUSB handle
 	if h.winusbHandle != 0 {
 		syscall.SyscallN(procWinUsb_Free.Addr(), uintptr(h.winusbHandle))
@@ -214,6 +334,38 @@ func (h *DeviceHandle) Close() error {
 	return nil
 }
 
+// Clone returns another handle on the same open device, sharing its WinUSB
+// handle. WinUSB gives a process a single handle on a device, so this is how
+// separate parts of a program, such as the video and audio functions of a
+// composite device, each claim and close their own interfaces. Each handle
+// tracks its own claimed interfaces, endpoint policies and configuration
+// cache, and the clone starts out with the endpoint policies of h. The
+// device is closed when the last of the handles is.
+func (h *DeviceHandle) Clone() (*DeviceHandle, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return nil, ErrDeviceNotFound
+	}
+	if h.backend != nil {
+		return nil, ErrNotSupported
+	}
+
+	h.refs.acquire()
+	return &DeviceHandle{
+		device:           h.device,
+		fileHandle:       h.fileHandle,
+		winusbHandle:     h.winusbHandle,
+		interfaceHandles: make(map[uint8]winusbInterfaceHandle),
+		claimedIfaces:    make(map[uint8]bool),
+		currentConfig:    h.currentConfig,
+		policies:         maps.Clone(h.policies),
+		defaultTimeout:   h.defaultTimeout,
+		refs:             h.refs,
+	}, nil
+}
+
 // Descriptor returns the device descriptor
 func (h *DeviceHandle) Descriptor() DeviceDescriptor {
 	return h.device.Descriptor
@@ -224,6 +376,27 @@ func (h *DeviceHandle) Device() *Device {
 	return h.device
 }
 
+// FD returns the WinUSB interface handle of the first interface, which the
+// WinUsb_* functions take, for integrating with code the library does not
+// cover. It is only that interface's handle: the other interfaces of a
+// composite device have their own, which WinUsb_GetAssociatedInterface
+// returns, and pipes of theirs cannot be addressed through this one. Calls
+// made on it directly bypass the library's tracking of claimed interfaces,
+// alternate settings and pipe policies. Do not free it; it is freed with the
+// last handle. A handle on a Backend has none and returns ErrNotSupported.
+func (h *DeviceHandle) FD() (uintptr, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return 0, ErrDeviceNotFound
+	}
+	if h.backend != nil {
+		return 0, ErrNotSupported
+	}
+	return uintptr(h.winusbHandle), nil
+}
+
 // SetConfiguration sets the device configuration
 func (h *DeviceHandle) SetConfiguration(config int) error {
 	h.mu.Lock()
@@ -233,6 +406,12 @@ func (h *DeviceHandle) SetConfiguration(config int) error {
 		return ErrDeviceNotFound
 	}
 
+	h.invalidateActiveConfig()
+
+	if h.backend != nil {
+		return backendSetConfiguration(h.backend, config)
+	}
+
 	// WinUSB automatically selects configuration 1
 	// Changing configuration requires re-initialization
 	h.currentConfig = config
@@ -247,6 +426,9 @@ func (h *DeviceHandle) Configuration() (int, error) {
 	if h.closed {
 		return 0, ErrDeviceNotFound
 	}
+	if h.backend != nil {
+		return backendConfiguration(h.backend)
+	}
 
 	return h.currentConfig, nil
 }
@@ -264,6 +446,14 @@ func (h *DeviceHandle) ClaimInterface(iface uint8) error {
 		return nil // Already claimed
 	}
 
+	if h.backend != nil {
+		if err := h.backend.ClaimInterface(iface); err != nil {
+			return err
+		}
+		h.claimedIfaces[iface] = true
+		return nil
+	}
+
 	// Interface 0 is the default interface (winusbHandle)
 	if iface == 0 {
 		h.claimedIfaces[0] = true
@@ -304,6 +494,12 @@ func (h *DeviceHandle) releaseInterfaceInternal(iface uint8) error {
 		return nil
 	}
 
+	if h.backend != nil {
+		if err := h.backend.ReleaseInterface(iface); err != nil {
+			return err
+		}
+	}
+
 	if ifaceHandle, ok := h.interfaceHandles[iface]; ok && ifaceHandle != 0 {
 		syscall.SyscallN(procWinUsb_Free.Addr(), uintptr(ifaceHandle))
 		delete(h.interfaceHandles, iface)
@@ -322,6 +518,15 @@ func (h *DeviceHandle) SetInterfaceAltSetting(iface uint8, altSetting uint8) err
 		return ErrDeviceNotFound
 	}
 
+	h.invalidateActiveConfig()
+
+	if h.backend != nil {
+		if !h.claimedIfaces[iface] {
+			return fmt.Errorf("interface %d not claimed", iface)
+		}
+		return h.backend.SetInterfaceAltSetting(iface, altSetting)
+	}
+
 	ifaceHandle := h.getInterfaceHandle(iface)
 	if ifaceHandle == 0 {
 		return fmt.Errorf("interface %d not claimed", iface)
@@ -339,7 +544,9 @@ func (h *DeviceHandle) SetInterfaceAltSetting(iface uint8, altSetting uint8) err
 	return nil
 }
 
-// ClearHalt clears the halt condition on an endpoint
+// ClearHalt clears the halt condition on an endpoint. WinUsb_ResetPipe sends
+// CLEAR_FEATURE(ENDPOINT_HALT), which resets the device's data toggle, and
+// resets the host side of the pipe to match.
 func (h *DeviceHandle) ClearHalt(endpoint uint8) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -347,6 +554,9 @@ func (h *DeviceHandle) ClearHalt(endpoint uint8) error {
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.backend != nil {
+		return h.backend.ClearHalt(endpoint)
+	}
 
 	r0, _, e1 := syscall.SyscallN(
 		procWinUsb_ResetPipe.Addr(),
@@ -372,6 +582,10 @@ func (h *DeviceHandle) AttachKernelDriver(iface uint8) error {
 	return nil
 }
 
+// SetReattachOnClose has no effect on Windows, where the device stays bound
+// to WinUSB
+func (h *DeviceHandle) SetReattachOnClose(reattach bool) {}
+
 // StringDescriptor reads a string descriptor
 func (h *DeviceHandle) StringDescriptor(index uint8) (string, error) {
 	if index == 0 {
@@ -384,42 +598,11 @@ func (h *DeviceHandle) StringDescriptor(index uint8) (string, error) {
 	if h.closed {
 		return "", ErrDeviceNotFound
 	}
-
-	buf := make([]byte, 256)
-	var transferred uint32
-
-	r0, _, e1 := syscall.SyscallN(
-		procWinUsb_GetDescriptor.Addr(),
-		uintptr(h.winusbHandle),
-		uintptr(USB_DT_STRING),
-		uintptr(index),
-		uintptr(0x0409), // English (US)
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(len(buf)),
-		uintptr(unsafe.Pointer(&transferred)),
-	)
-	if r0 == 0 {
-		return "", fmt.Errorf("WinUsb_GetDescriptor failed: %w", e1)
-	}
-
-	if transferred < 2 {
-		return "", fmt.Errorf("invalid string descriptor")
-	}
-
-	// Parse USB string descriptor (UTF-16LE encoded)
-	length := int(buf[0])
-	if length > int(transferred) {
-		length = int(transferred)
+	if h.backend != nil {
+		return backendStringDescriptor(h.backend, index)
 	}
 
-	result := make([]uint16, 0, (length-2)/2)
-	for i := 2; i < length; i += 2 {
-		if i+1 < length {
-			result = append(result, binary.LittleEndian.Uint16(buf[i:i+2]))
-		}
-	}
-
-	return string(utf16ToRunes(result)), nil
+	return readStringDescriptor(h.winusbHandle, index)
 }
 
 // RawConfigDescriptor gets raw configuration descriptor data
@@ -430,6 +613,9 @@ func (h *DeviceHandle) RawConfigDescriptor(index uint8) ([]byte, error) {
 	if h.closed {
 		return nil, ErrDeviceNotFound
 	}
+	if h.backend != nil {
+		return backendConfigDescriptor(h.backend, index)
+	}
 
 	// First get just the header to find total length
 	header := make([]byte, 9)
@@ -466,23 +652,21 @@ func (h *DeviceHandle) RawConfigDescriptor(index uint8) ([]byte, error) {
 	if r0 == 0 {
 		return nil, fmt.Errorf("WinUsb_GetDescriptor failed: %w", e1)
 	}
+	if err := ValidateConfigLength(fullBuf[:transferred]); err != nil {
+		return nil, err
+	}
 
 	return fullBuf[:transferred], nil
 }
 
-// ConfigDescriptorByValue gets parsed configuration descriptor by value
-func (h *DeviceHandle) ConfigDescriptorByValue(index uint8) (*ConfigDescriptor, error) {
-	data, err := h.RawConfigDescriptor(index - 1) // Convert 1-based to 0-based
-	if err != nil {
-		return nil, err
-	}
-
-	config := &ConfigDescriptor{}
-	err = config.Unmarshal(data)
-	if err != nil {
-		return nil, err
-	}
-	return config, nil
+// ConfigDescriptorByValue gets the parsed configuration descriptor whose
+// bConfigurationValue is value.
+//
+// Deprecated: use ConfigDescriptorByConfigValue, which this now calls, or
+// ConfigDescriptorByIndex. It used to read index value-1, which is only the
+// same configuration on devices numbering their configurations from 1.
+func (h *DeviceHandle) ConfigDescriptorByValue(value uint8) (*ConfigDescriptor, error) {
+	return h.ConfigDescriptorByConfigValue(value)
 }
 
 // Speed gets the device speed
@@ -511,8 +695,8 @@ func (h *DeviceHandle) Speed() (uint8, error) {
 	return speed, nil
 }
 
-// ResetDevice performs a device reset
-func (h *DeviceHandle) ResetDevice() error {
+// resetDevice performs a device reset
+func (h *DeviceHandle) resetDevice() error {
 	// WinUSB doesn't directly support device reset
 	// We need to close and reopen the device
 	h.mu.Lock()
@@ -522,6 +706,8 @@ func (h *DeviceHandle) ResetDevice() error {
 		return ErrDeviceNotFound
 	}
 
+	h.invalidateActiveConfig()
+
 	// Store device reference
 	device := h.device
 
@@ -699,6 +885,9 @@ func (h *DeviceHandle) RawDescriptor(descType uint8, descIndex uint8, langID uin
 	if h.closed {
 		return 0, ErrDeviceNotFound
 	}
+	if h.backend != nil {
+		return h.backend.ControlTransfer(0x80, USB_REQ_GET_DESCRIPTOR, (uint16(descType)<<8)|uint16(descIndex), langID, data, 0)
+	}
 
 	var dataPtr unsafe.Pointer
 	if len(data) > 0 {
@@ -758,145 +947,34 @@ func (h *DeviceHandle) Capabilities() (uint32, error) {
 
 // USB20ExtensionDescriptor gets the USB 2.0 extension descriptor
 func (h *DeviceHandle) USB20ExtensionDescriptor() (*USB2ExtensionCapability, error) {
-	bos, caps, err := h.ReadBOSDescriptor()
+	data, err := h.RawBOSDescriptor()
 	if err != nil {
 		return nil, err
 	}
-
-	// Read full BOS to parse capabilities
-	buf := make([]byte, bos.TotalLength)
-	_, err = h.RawDescriptor(USB_DT_BOS, 0, 0, buf)
-	if err != nil {
-		return nil, err
-	}
-
-	pos := 5
-	for i := 0; i < int(len(caps)) && pos < len(buf); i++ {
-		if pos+3 > len(buf) {
-			break
-		}
-
-		length := int(buf[pos])
-		descType := buf[pos+1]
-		devCapType := buf[pos+2]
-
-		if length < 3 || pos+length > len(buf) {
-			break
-		}
-
-		if descType == USB_DT_DEVICE_CAPABILITY && devCapType == 0x02 {
-			if length < 7 {
-				return nil, fmt.Errorf("invalid USB 2.0 extension capability length: %d", length)
-			}
-			return &USB2ExtensionCapability{
-				Length:            buf[pos],
-				DescriptorType:    buf[pos+1],
-				DevCapabilityType: buf[pos+2],
-				Attributes:        binary.LittleEndian.Uint32(buf[pos+3 : pos+7]),
-			}, nil
-		}
-
-		pos += length
-	}
-
-	return nil, fmt.Errorf("USB 2.0 extension capability not found")
+	return parseUSB20ExtensionCapability(data)
 }
 
 // SSUSBDeviceCapabilityDescriptor gets the SuperSpeed USB device capability descriptor
 func (h *DeviceHandle) SSUSBDeviceCapabilityDescriptor() (*SuperSpeedUSBCapability, error) {
-	bos, caps, err := h.ReadBOSDescriptor()
-	if err != nil {
-		return nil, err
-	}
-
-	// Read full BOS to parse capabilities
-	buf := make([]byte, bos.TotalLength)
-	_, err = h.RawDescriptor(USB_DT_BOS, 0, 0, buf)
+	data, err := h.RawBOSDescriptor()
 	if err != nil {
 		return nil, err
 	}
-
-	pos := 5
-	for i := 0; i < int(len(caps)) && pos < len(buf); i++ {
-		if pos+3 > len(buf) {
-			break
-		}
-
-		length := int(buf[pos])
-		descType := buf[pos+1]
-		devCapType := buf[pos+2]
-
-		if length < 3 || pos+length > len(buf) {
-			break
-		}
-
-		if descType == USB_DT_DEVICE_CAPABILITY && devCapType == 0x03 {
-			if length < 10 {
-				return nil, fmt.Errorf("invalid SuperSpeed USB capability length: %d", length)
-			}
-			return &SuperSpeedUSBCapability{
-				Length:                 buf[pos],
-				DescriptorType:         buf[pos+1],
-				DevCapabilityType:      buf[pos+2],
-				Attributes:             buf[pos+3],
-				SpeedsSupported:        binary.LittleEndian.Uint16(buf[pos+4 : pos+6]),
-				FunctionalitySupported: buf[pos+6],
-				U1DevExitLat:           buf[pos+7],
-				U2DevExitLat:           binary.LittleEndian.Uint16(buf[pos+8 : pos+10]),
-			}, nil
-		}
-
-		pos += length
-	}
-
-	return nil, fmt.Errorf("SuperSpeed USB capability not found")
+	return parseSuperSpeedUSBCapability(data)
 }
 
 // SSEndpointCompanionDescriptor gets the SuperSpeed endpoint companion descriptor
+// from the configuration at configIndex, which need not be the active one
 func (h *DeviceHandle) SSEndpointCompanionDescriptor(configIndex uint8, interfaceNumber uint8, altSetting uint8, endpointAddress uint8) (*SuperSpeedEndpointCompanionDescriptor, error) {
-	config, err := h.ConfigDescriptorByValue(configIndex)
+	data, err := h.RawConfigDescriptor(configIndex)
 	if err != nil {
 		return nil, err
 	}
 
-	altSettingDesc := config.InterfaceAltSetting(interfaceNumber, altSetting)
-	if altSettingDesc == nil {
-		return nil, fmt.Errorf("interface %d alt setting %d not found", interfaceNumber, altSetting)
-	}
-
-	for i := range altSettingDesc.Endpoints {
-		if altSettingDesc.Endpoints[i].EndpointAddr == endpointAddress {
-			if altSettingDesc.Endpoints[i].SSCompanion != nil {
-				return altSettingDesc.Endpoints[i].SSCompanion, nil
-			}
-			extra := altSettingDesc.Endpoints[i].Extra
-			pos := 0
-			for pos+2 <= len(extra) {
-				length := int(extra[pos])
-				descType := extra[pos+1]
-
-				if length < 2 || pos+length > len(extra) {
-					break
-				}
-
-				if descType == USB_DT_SS_ENDPOINT_COMPANION {
-					if length < 6 {
-						return nil, fmt.Errorf("invalid SS endpoint companion descriptor length: %d", length)
-					}
-					return &SuperSpeedEndpointCompanionDescriptor{
-						Length:           extra[pos],
-						DescriptorType:   extra[pos+1],
-						MaxBurst:         extra[pos+2],
-						Attributes:       extra[pos+3],
-						BytesPerInterval: binary.LittleEndian.Uint16(extra[pos+4 : pos+6]),
-					}, nil
-				}
-
-				pos += length
-			}
-			return nil, fmt.Errorf("SS endpoint companion descriptor not found for endpoint %02x", endpointAddress)
-		}
+	config := &ConfigDescriptor{}
+	if err := config.Unmarshal(data); err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("endpoint %02x not found", endpointAddress)
+	return config.SSEndpointCompanion(interfaceNumber, altSetting, endpointAddress)
 }
@@ -21,3 +21,73 @@ var (
 	errNotSupported     = fmt.Errorf("not supported")
 	errOther            = fmt.Errorf("other error")
 )
+
+// libusb error codes, as returned by the libusb_* functions and used by
+// gousb
+const (
+	LIBUSB_SUCCESS             = 0
+	LIBUSB_ERROR_IO            = -1
+	LIBUSB_ERROR_INVALID_PARAM = -2
+	LIBUSB_ERROR_ACCESS        = -3
+	LIBUSB_ERROR_NO_DEVICE     = -4
+	LIBUSB_ERROR_NOT_FOUND     = -5
+	LIBUSB_ERROR_BUSY          = -6
+	LIBUSB_ERROR_TIMEOUT       = -7
+	LIBUSB_ERROR_OVERFLOW      = -8
+	LIBUSB_ERROR_PIPE          = -9
+	LIBUSB_ERROR_INTERRUPTED   = -10
+	LIBUSB_ERROR_NO_MEM        = -11
+	LIBUSB_ERROR_NOT_SUPPORTED = -12
+	LIBUSB_ERROR_OTHER         = -99
+)
+
+// libusbErrors maps each libusb error code to the sentinel of this package
+// that errors.Is matches for the same condition
+var libusbErrors = map[int]error{
+	LIBUSB_ERROR_IO:            ErrIO,
+	LIBUSB_ERROR_INVALID_PARAM: ErrInvalidParameter,
+	LIBUSB_ERROR_ACCESS:        ErrPermissionDenied,
+	LIBUSB_ERROR_NO_DEVICE:     ErrNoDevice,
+	LIBUSB_ERROR_NOT_FOUND:     ErrNotFound,
+	LIBUSB_ERROR_BUSY:          ErrBusy,
+	LIBUSB_ERROR_TIMEOUT:       ErrTimeout,
+	LIBUSB_ERROR_OVERFLOW:      ErrOverflow,
+	LIBUSB_ERROR_PIPE:          ErrPipe,
+	LIBUSB_ERROR_INTERRUPTED:   ErrInterrupted,
+	LIBUSB_ERROR_NO_MEM:        ErrNoMem,
+	LIBUSB_ERROR_NOT_SUPPORTED: ErrNotSupported,
+	LIBUSB_ERROR_OTHER:         ErrOther,
+}
+
+// FromLibusbError translates a libusb return code into the equivalent error
+// of this package, for code ported from libusb or gousb that branches on the
+// numeric codes. Zero and positive codes, which libusb uses for success and
+// byte counts, return nil. The codes map one to one onto the sentinels:
+//
+//	LIBUSB_ERROR_IO            ErrIO
+//	LIBUSB_ERROR_INVALID_PARAM ErrInvalidParameter
+//	LIBUSB_ERROR_ACCESS        ErrPermissionDenied
+//	LIBUSB_ERROR_NO_DEVICE     ErrNoDevice
+//	LIBUSB_ERROR_NOT_FOUND     ErrNotFound
+//	LIBUSB_ERROR_BUSY          ErrBusy
+//	LIBUSB_ERROR_TIMEOUT       ErrTimeout
+//	LIBUSB_ERROR_OVERFLOW      ErrOverflow
+//	LIBUSB_ERROR_PIPE          ErrPipe
+//	LIBUSB_ERROR_INTERRUPTED   ErrInterrupted
+//	LIBUSB_ERROR_NO_MEM        ErrNoMem
+//	LIBUSB_ERROR_NOT_SUPPORTED ErrNotSupported
+//	LIBUSB_ERROR_OTHER         ErrOther
+//
+// Note that a closed or unplugged device is reported by this package as
+// ErrDeviceNotFound on some paths where libusb returns
+// LIBUSB_ERROR_NO_DEVICE, so callers porting such checks should test for
+// both. Codes libusb does not define wrap ErrOther.
+func FromLibusbError(code int) error {
+	if code >= LIBUSB_SUCCESS {
+		return nil
+	}
+	if err, ok := libusbErrors[code]; ok {
+		return err
+	}
+	return fmt.Errorf("libusb error %d: %w", code, ErrOther)
+}
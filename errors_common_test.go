@@ -0,0 +1,44 @@
+package usb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFromLibusbError(t *testing.T) {
+	tests := []struct {
+		code int
+		want error
+	}{
+		{code: LIBUSB_SUCCESS, want: nil},
+		{code: 64, want: nil},
+		{code: LIBUSB_ERROR_TIMEOUT, want: ErrTimeout},
+		{code: LIBUSB_ERROR_PIPE, want: ErrPipe},
+		{code: LIBUSB_ERROR_ACCESS, want: ErrPermissionDenied},
+		{code: LIBUSB_ERROR_NO_DEVICE, want: ErrNoDevice},
+		{code: LIBUSB_ERROR_OTHER, want: ErrOther},
+		{code: -42, want: ErrOther},
+	}
+
+	for _, tt := range tests {
+		err := FromLibusbError(tt.code)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("FromLibusbError(%d) = %v, want nil", tt.code, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("FromLibusbError(%d) = %v, want %v", tt.code, err, tt.want)
+		}
+	}
+
+	for code := range libusbErrors {
+		if code == LIBUSB_ERROR_OTHER {
+			continue
+		}
+		if errors.Is(FromLibusbError(code), ErrOther) {
+			t.Errorf("FromLibusbError(%d) maps to ErrOther", code)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package usb
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+func TestTransferErrno(t *testing.T) {
+	tests := []struct {
+		errno syscall.Errno
+		want  []error
+	}{
+		{errno: syscall.EPIPE, want: []error{ErrPipeStalled, ErrPipe, syscall.EPIPE}},
+		{errno: syscall.EOVERFLOW, want: []error{ErrBabble, ErrOverflow, syscall.EOVERFLOW}},
+		{errno: syscall.ENODEV, want: []error{ErrNoDevice, syscall.ENODEV}},
+		{errno: syscall.EINVAL, want: []error{syscall.EINVAL}},
+	}
+
+	for _, tt := range tests {
+		err := transferErrno(tt.errno)
+		for _, want := range tt.want {
+			if !errors.Is(err, want) {
+				t.Errorf("transferErrno(%v) = %v, want it to match %v", tt.errno, err, want)
+			}
+		}
+		if errors.Is(err, ErrTimeout) {
+			t.Errorf("transferErrno(%v) = %v, matches ErrTimeout", tt.errno, err)
+		}
+	}
+
+	if err := urbStatusError(-int32(syscall.EPIPE)); err != ErrPipeStalled {
+		t.Errorf("urbStatusError(-EPIPE) = %v, want ErrPipeStalled", err)
+	}
+	if errors.Is(ErrBabble, ErrPipe) || errors.Is(ErrPipeStalled, ErrOverflow) {
+		t.Error("ErrBabble and ErrPipeStalled should not match each other's base errors")
+	}
+}
@@ -30,7 +30,7 @@ func main() {
 		fmt.Printf("  Bus:         %03d\n", dev.Bus)
 		fmt.Printf("  Address:     %03d\n", dev.Address)
 		fmt.Printf("  VID:PID:     %04x:%04x\n", desc.VendorID, desc.ProductID)
-		fmt.Printf("  USB Version: %x.%02x\n", desc.USBVersion>>8, desc.USBVersion&0xff)
+		fmt.Printf("  USB Version: %s\n", desc.USBVersionString())
 		fmt.Printf("  Class:       %02x\n", desc.DeviceClass)
 		fmt.Printf("  SubClass:    %02x\n", desc.DeviceSubClass)
 		fmt.Printf("  Protocol:    %02x\n", desc.DeviceProtocol)
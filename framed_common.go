@@ -0,0 +1,94 @@
+package usb
+
+import (
+	"fmt"
+	"time"
+)
+
+// FramedReaderOption is a functional option for configuring a FramedBulkReader.
+type FramedReaderOption func(*FramedBulkReader)
+
+// WithZLPTerminator returns an option that makes a zero-length packet end the
+// message being read. Without it, zero-length reads are skipped and only a
+// short packet ends a message, so a message whose length is a multiple of
+// the read size runs into the next one.
+func WithZLPTerminator() FramedReaderOption {
+	return func(r *FramedBulkReader) {
+		r.zlpTerminates = true
+	}
+}
+
+// WithMaxMessageSize returns an option that limits messages to n bytes.
+// ReadMessage fails with ErrOverflow on a longer one.
+func WithMaxMessageSize(n int) FramedReaderOption {
+	return func(r *FramedBulkReader) {
+		r.maxMessage = n
+	}
+}
+
+// FramedBulkReader reads the messages of protocols that delimit them by
+// transfer boundaries on a bulk IN endpoint: a packet shorter than
+// wMaxPacketSize ends the message. A zero-length packet, such as one sent
+// after a message that filled its last packet, ends the message only with
+// WithZLPTerminator and is skipped otherwise. USB printers and many vendor
+// protocols frame their data this way. It is not safe for concurrent use.
+type FramedBulkReader struct {
+	read          func([]byte) (int, error)
+	buf           []byte
+	zlpTerminates bool
+	maxMessage    int
+}
+
+// NewFramedBulkReader returns a reader for endpoint, which issues reads of
+// readSize bytes with the given timeout. readSize must be a multiple of the
+// endpoint's wMaxPacketSize so that a short read means a short packet.
+func (h *DeviceHandle) NewFramedBulkReader(endpoint uint8, readSize int, timeout time.Duration, opts ...FramedReaderOption) (*FramedBulkReader, error) {
+	if readSize <= 0 {
+		return nil, fmt.Errorf("read size %d: %w", readSize, ErrInvalidParameter)
+	}
+	endpoint |= uint8(EndpointDirectionIn)
+	return newFramedBulkReader(func(buf []byte) (int, error) {
+		return h.BulkTransfer(endpoint, buf, timeout)
+	}, readSize, opts), nil
+}
+
+func newFramedBulkReader(read func([]byte) (int, error), readSize int, opts []FramedReaderOption) *FramedBulkReader {
+	r := &FramedBulkReader{
+		read: read,
+		buf:  make([]byte, readSize),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// ReadMessage reads until the end of the next message and returns it. With
+// WithZLPTerminator, a zero-length packet that arrives before any data
+// returns an empty message.
+func (r *FramedBulkReader) ReadMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		n, err := r.read(r.buf)
+		if err != nil {
+			return msg, err
+		}
+		if n == 0 {
+			if r.zlpTerminates {
+				if msg == nil {
+					msg = []byte{}
+				}
+				return msg, nil
+			}
+			continue
+		}
+
+		if r.maxMessage > 0 && len(msg)+n > r.maxMessage {
+			return msg, fmt.Errorf("message longer than %d bytes: %w", r.maxMessage, ErrOverflow)
+		}
+		msg = append(msg, r.buf[:n]...)
+		if n < len(r.buf) {
+			return msg, nil
+		}
+	}
+}
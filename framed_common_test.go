@@ -0,0 +1,73 @@
+package usb
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// packetSource plays back a sequence of bulk reads, one per call
+func packetSource(reads ...[]byte) func([]byte) (int, error) {
+	return func(buf []byte) (int, error) {
+		if len(reads) == 0 {
+			return 0, ErrTimeout
+		}
+		n := copy(buf, reads[0])
+		reads = reads[1:]
+		return n, nil
+	}
+}
+
+func TestFramedBulkReader(t *testing.T) {
+	full := bytes.Repeat([]byte{0xaa}, 4)
+
+	tests := []struct {
+		name  string
+		reads [][]byte
+		opts  []FramedReaderOption
+		want  [][]byte
+	}{
+		{
+			name:  "short_packet",
+			reads: [][]byte{full, {1, 2}, {3}},
+			want:  [][]byte{append(append([]byte{}, full...), 1, 2), {3}},
+		},
+		{
+			name:  "zlp_terminates",
+			reads: [][]byte{full, full, {}, {}, {5}},
+			opts:  []FramedReaderOption{WithZLPTerminator()},
+			want:  [][]byte{append(append([]byte{}, full...), full...), {}, {5}},
+		},
+		{
+			name:  "zlp_skipped",
+			reads: [][]byte{full, {}, {5}},
+			want:  [][]byte{append(append([]byte{}, full...), 5)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFramedBulkReader(packetSource(tt.reads...), len(full), tt.opts)
+			for i, want := range tt.want {
+				got, err := r.ReadMessage()
+				if err != nil {
+					t.Fatalf("ReadMessage() %d error = %v", i, err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("ReadMessage() %d = %x, want %x", i, got, want)
+				}
+			}
+			if _, err := r.ReadMessage(); !errors.Is(err, ErrTimeout) {
+				t.Errorf("ReadMessage() after the last message error = %v, want ErrTimeout", err)
+			}
+		})
+	}
+}
+
+func TestFramedBulkReaderMaxMessageSize(t *testing.T) {
+	full := bytes.Repeat([]byte{0xaa}, 4)
+	r := newFramedBulkReader(packetSource(full, full, []byte{1}), len(full), []FramedReaderOption{WithMaxMessageSize(6)})
+	if _, err := r.ReadMessage(); !errors.Is(err, ErrOverflow) {
+		t.Errorf("ReadMessage() error = %v, want ErrOverflow", err)
+	}
+}
@@ -0,0 +1,278 @@
+// Package ftdi implements the vendor requests of FTDI USB serial converters,
+// such as the FT232R and FT2232H, on top of a claimed usb.DeviceHandle.
+package ftdi
+
+import (
+	"fmt"
+	"time"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+// FTDI vendor requests
+const (
+	SIO_RESET             = 0x00
+	SIO_SET_MODEM_CTRL    = 0x01
+	SIO_SET_FLOW_CTRL     = 0x02
+	SIO_SET_BAUDRATE      = 0x03
+	SIO_SET_DATA          = 0x04
+	SIO_POLL_MODEM_STATUS = 0x05
+	SIO_SET_LATENCY_TIMER = 0x09
+	SIO_GET_LATENCY_TIMER = 0x0a
+	SIO_SET_BITMODE       = 0x0b
+	SIO_READ_PINS         = 0x0c
+)
+
+// Request types of the vendor requests
+const (
+	requestTypeOut = 0x40 // OUT, vendor, device
+	requestTypeIn  = 0xc0 // IN, vendor, device
+)
+
+// BitMode selects the function of the chip's I/O pins
+type BitMode uint8
+
+const (
+	BitModeReset   BitMode = 0x00 // Back to the UART or FIFO mode set in the EEPROM
+	BitModeBitbang BitMode = 0x01 // Asynchronous bit-bang
+	BitModeMPSSE   BitMode = 0x02 // Multi-protocol synchronous serial engine
+	BitModeSyncBB  BitMode = 0x04 // Synchronous bit-bang
+	BitModeMCU     BitMode = 0x08 // MCU host bus emulation
+	BitModeOpto    BitMode = 0x10 // Fast opto-isolated serial
+	BitModeCBUS    BitMode = 0x20 // CBUS pin bit-bang
+	BitModeSyncFF  BitMode = 0x40 // Synchronous 245 FIFO
+	BitModeFT1284  BitMode = 0x80 // FT1284
+)
+
+// readBufferSize is the size of the bulk IN requests issued by Read
+const readBufferSize = 4096
+
+// Port is one UART/FIFO channel of an FTDI chip. Multi-channel chips such as
+// the FT2232H and FT4232H expose one interface per channel.
+type Port struct {
+	handle  *usb.DeviceHandle
+	index   uint16 // wIndex of the vendor requests: 1 for channel A, 2 for B...
+	in, out uint8
+	packet  int  // wMaxPacketSize of the IN endpoint
+	hiSpeed bool // FT2232H, FT4232H and FT232H use a 120 MHz baud clock
+	multi   bool // Multi-channel chips put the channel in SIO_SET_BAUDRATE
+
+	timeout time.Duration
+	status  uint16
+	buf     []byte
+	pending []byte
+}
+
+// New returns the port on interface iface of an FTDI chip. The interface must
+// already be claimed, with any kernel driver such as ftdi_sio detached.
+func New(handle *usb.DeviceHandle, iface uint8) (*Port, error) {
+	config, err := handle.GetActiveConfigDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	alt := config.InterfaceAltSetting(iface, 0)
+	if alt == nil {
+		return nil, fmt.Errorf("interface %d: %w", iface, usb.ErrNotFound)
+	}
+
+	p := &Port{
+		handle:  handle,
+		index:   uint16(iface) + 1,
+		hiSpeed: isHighSpeedChip(handle.Descriptor().DeviceVersion),
+		multi:   isMultiChannelChip(handle.Descriptor().DeviceVersion),
+		timeout: time.Second,
+	}
+	for _, ep := range alt.Endpoints {
+		if ep.Attributes&0x03 != 0x02 {
+			continue
+		}
+		if ep.EndpointAddr&0x80 != 0 {
+			p.in = ep.EndpointAddr
+			p.packet = int(ep.MaxPacketSize)
+		} else {
+			p.out = ep.EndpointAddr
+		}
+	}
+	if p.in == 0 || p.out == 0 || p.packet <= 2 {
+		return nil, fmt.Errorf("interface %d has no FTDI bulk endpoints", iface)
+	}
+
+	p.buf = make([]byte, readBufferSize/p.packet*p.packet)
+	return p, nil
+}
+
+// isHighSpeedChip reports whether the bcdDevice of the chip identifies one of
+// the high-speed parts
+func isHighSpeedChip(bcdDevice uint16) bool {
+	switch bcdDevice {
+	case 0x0700, 0x0800, 0x0900: // FT2232H, FT4232H, FT232H
+		return true
+	}
+	return false
+}
+
+// isMultiChannelChip reports whether the bcdDevice of the chip identifies a
+// part with more than one channel
+func isMultiChannelChip(bcdDevice uint16) bool {
+	switch bcdDevice {
+	case 0x0500, 0x0700, 0x0800: // FT2232C/D, FT2232H, FT4232H
+		return true
+	}
+	return false
+}
+
+// SetTimeout sets the timeout of the bulk transfers done by Read and Write
+func (p *Port) SetTimeout(timeout time.Duration) {
+	p.timeout = timeout
+}
+
+func (p *Port) control(request uint8, value uint16, index uint16) error {
+	_, err := p.handle.ControlTransfer(requestTypeOut, request, value, index, nil, p.timeout)
+	return err
+}
+
+// Reset resets the channel and discards the data buffered by Read
+func (p *Port) Reset() error {
+	p.pending = nil
+	return p.control(SIO_RESET, 0, p.index)
+}
+
+// SetBaudRate sets the UART baud rate to the closest rate the chip can
+// generate and returns that rate
+func (p *Port) SetBaudRate(baud int) (int, error) {
+	if baud <= 0 {
+		return 0, fmt.Errorf("baud rate %d: %w", baud, usb.ErrInvalidParameter)
+	}
+
+	actual, encoded := baudDivisor(baud, p.hiSpeed)
+	value := uint16(encoded)
+	index := uint16(encoded >> 16)
+	if p.hiSpeed || p.multi {
+		index = uint16(encoded>>8)&0xff00 | p.index
+	}
+	if err := p.control(SIO_SET_BAUDRATE, value, index); err != nil {
+		return 0, err
+	}
+	return actual, nil
+}
+
+// baudDivisor computes the 18-bit divisor encoding of a baud rate and the
+// rate actually achieved
+func baudDivisor(baud int, hiSpeed bool) (actual int, encoded uint32) {
+	fracCode := [8]uint32{0, 3, 2, 4, 1, 5, 6, 7}
+
+	clk, clkDiv := 48000000, 16
+	if hiSpeed && baud > 1200 {
+		clk, clkDiv = 120000000, 10
+		encoded = 1 << 17
+	}
+
+	switch {
+	case baud >= clk/clkDiv:
+		actual = clk / clkDiv
+	case baud >= clk/(clkDiv+clkDiv/2):
+		encoded |= 1
+		actual = clk / (clkDiv + clkDiv/2)
+	case baud >= clk/(2*clkDiv):
+		encoded |= 2
+		actual = clk / (2 * clkDiv)
+	default:
+		// Three fractional bits plus one for rounding
+		divisor := (clk*16/clkDiv/baud + 1) / 2
+		if divisor > 0x1ffff {
+			divisor = 0x1ffff
+		}
+		actual = (clk*16/clkDiv/divisor + 1) / 2
+		encoded |= uint32(divisor>>3) | fracCode[divisor&7]<<14
+	}
+
+	return actual, encoded
+}
+
+// SetLatencyTimer sets how long the chip waits, in milliseconds, before
+// sending a partially filled packet to the host
+func (p *Port) SetLatencyTimer(ms uint8) error {
+	if ms == 0 {
+		return fmt.Errorf("latency timer of 0 ms: %w", usb.ErrInvalidParameter)
+	}
+	return p.control(SIO_SET_LATENCY_TIMER, uint16(ms), p.index)
+}
+
+// LatencyTimer returns the latency timer in milliseconds
+func (p *Port) LatencyTimer() (uint8, error) {
+	buf := make([]byte, 1)
+	n, err := p.handle.ControlTransfer(requestTypeIn, SIO_GET_LATENCY_TIMER, 0, p.index, buf, p.timeout)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("short latency timer response")
+	}
+	return buf[0], nil
+}
+
+// SetBitMode switches the I/O pins to mode. In the bit-bang modes, mask
+// selects the pins that are outputs.
+func (p *Port) SetBitMode(mask uint8, mode BitMode) error {
+	return p.control(SIO_SET_BITMODE, uint16(mode)<<8|uint16(mask), p.index)
+}
+
+// ModemStatus returns the two modem status bytes that prefixed the most
+// recent packet received by Read
+func (p *Port) ModemStatus() uint16 {
+	return p.status
+}
+
+// Read reads received data, with the modem status bytes the chip puts at the
+// start of every packet removed. Packets that carry only status are skipped,
+// so Read waits until data arrives, failing with usb.ErrTimeout if none has
+// within the port's timeout.
+func (p *Port) Read(b []byte) (int, error) {
+	// The chip sends a status packet every latency timer period even when idle,
+	// so each transfer only gets what is left of the overall timeout
+	deadline := time.Now().Add(p.timeout)
+	for len(p.pending) == 0 {
+		timeout := p.timeout
+		if timeout > 0 {
+			// Below a millisecond the transfer timeout would round to 0, which
+			// waits forever
+			if timeout = time.Until(deadline); timeout < time.Millisecond {
+				return 0, usb.ErrTimeout
+			}
+		}
+		n, err := p.handle.BulkTransfer(p.in, p.buf, timeout)
+		if err != nil {
+			return 0, err
+		}
+		p.pending, p.status = stripModemStatus(p.buf[:n], p.packet, p.status)
+	}
+
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+// stripModemStatus removes the 2-byte status header from each packetSize
+// chunk of data in place, returning the payload and the last status seen
+func stripModemStatus(data []byte, packetSize int, status uint16) ([]byte, uint16) {
+	payload := data[:0]
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > packetSize {
+			chunk = chunk[:packetSize]
+		}
+		data = data[len(chunk):]
+
+		if len(chunk) < 2 {
+			break
+		}
+		status = uint16(chunk[0]) | uint16(chunk[1])<<8
+		payload = append(payload, chunk[2:]...)
+	}
+	return payload, status
+}
+
+// Write sends b to the chip
+func (p *Port) Write(b []byte) (int, error) {
+	return p.handle.BulkTransfer(p.out, b, p.timeout)
+}
@@ -0,0 +1,124 @@
+package ftdi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+func TestBaudDivisor(t *testing.T) {
+	tests := []struct {
+		name        string
+		baud        int
+		hiSpeed     bool
+		wantActual  int
+		wantEncoded uint32
+	}{
+		{name: "9600", baud: 9600, wantActual: 9600, wantEncoded: 0x4138},
+		{name: "115200", baud: 115200, wantActual: 115385, wantEncoded: 0x001a},
+		{name: "3M", baud: 3000000, wantActual: 3000000, wantEncoded: 0},
+		{name: "2M", baud: 2000000, wantActual: 2000000, wantEncoded: 1},
+		{name: "hi_speed_3M", baud: 3000000, hiSpeed: true, wantActual: 3000000, wantEncoded: 0x20004},
+		{name: "hi_speed_12M", baud: 12000000, hiSpeed: true, wantActual: 12000000, wantEncoded: 0x20000},
+		{name: "hi_speed_low_rate", baud: 300, hiSpeed: true, wantActual: 300, wantEncoded: 0x2710},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, encoded := baudDivisor(tt.baud, tt.hiSpeed)
+			if actual != tt.wantActual || encoded != tt.wantEncoded {
+				t.Errorf("baudDivisor(%d, %v) = %d, 0x%x, want %d, 0x%x",
+					tt.baud, tt.hiSpeed, actual, encoded, tt.wantActual, tt.wantEncoded)
+			}
+		})
+	}
+}
+
+func TestStripModemStatus(t *testing.T) {
+	data := []byte{
+		0x01, 0x60, 'a', 'b', // Full packet
+		0x01, 0x60, // Status only, shorter than a packet
+	}
+
+	payload, status := stripModemStatus(data, 4, 0)
+	if !bytes.Equal(payload, []byte("ab")) || status != 0x6001 {
+		t.Errorf("packets = %q, 0x%04x", payload, status)
+	}
+
+	data = []byte{0x01, 0x60, 'a', 'b', 0x11, 0x60, 'c'}
+	payload, status = stripModemStatus(data, 4, 0)
+	if !bytes.Equal(payload, []byte("abc")) || status != 0x6011 {
+		t.Errorf("packets = %q, 0x%04x", payload, status)
+	}
+
+	payload, status = stripModemStatus(nil, 4, 0x6001)
+	if len(payload) != 0 || status != 0x6001 {
+		t.Errorf("empty read = %q, 0x%04x, want previous status kept", payload, status)
+	}
+}
+
+func TestReadStatusOnly(t *testing.T) {
+	config, _ := hex.DecodeString(
+		"090220000101008032" + // Configuration 1, 32 bytes
+			"090400000200ffff02" + // Interface 0, vendor specific
+			"0705810240000007050202400000") // Bulk IN 0x81 and OUT 0x02, 64 bytes
+
+	var packets int
+	dev := &usb.MockDevice{
+		Bus:        1,
+		Address:    5,
+		Descriptor: usb.DeviceDescriptor{VendorID: 0x0403, ProductID: 0x6001, DeviceVersion: 0x0600, NumConfigurations: 1},
+		Configs:    [][]byte{config},
+		Endpoints: map[uint8]func([]byte) (int, error){
+			// An idle chip answers every latency timer period with status only,
+			// until the third packet brings data
+			0x81: func(data []byte) (int, error) {
+				time.Sleep(2 * time.Millisecond)
+				packets++
+				if packets == 3 {
+					return copy(data, []byte{0x01, 0x60, 'h', 'i'}), nil
+				}
+				return copy(data, []byte{0x01, 0x60}), nil
+			},
+		},
+	}
+	usb.SetBackend(usb.NewMockBackend(dev))
+	defer usb.SetBackend(nil)
+
+	devices, err := usb.DeviceList()
+	if err != nil || len(devices) != 1 {
+		t.Fatalf("DeviceList() = %v, %v, want the mock device", devices, err)
+	}
+	h, err := devices[0].Open()
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer h.Close()
+
+	p, err := New(h, 0)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	p.SetTimeout(50 * time.Millisecond)
+
+	buf := make([]byte, 8)
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != "hi" {
+		t.Errorf("Read() = %q, %v, want \"hi\" after two status packets", buf[:n], err)
+	}
+	if p.ModemStatus() != 0x6001 {
+		t.Errorf("ModemStatus() = 0x%04x, want 0x6001", p.ModemStatus())
+	}
+
+	start := time.Now()
+	n, err := p.Read(buf)
+	if !errors.Is(err, usb.ErrTimeout) || n != 0 {
+		t.Errorf("Read() of status only = %d, %v, want 0, ErrTimeout", n, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Read() of status only took %v, want about the 50ms timeout", elapsed)
+	}
+}
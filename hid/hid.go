@@ -0,0 +1,277 @@
+// Package hid implements the class requests of USB Human Interface Devices,
+// such as gamepads, keyboards and mice, on top of a usb.DeviceHandle, and
+// parses their report descriptors.
+package hid
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+// CLASS_HID is the interface class of HID interfaces
+const CLASS_HID = 0x03
+
+// Class descriptor types
+const (
+	USB_DT_HID      = 0x21
+	USB_DT_REPORT   = 0x22
+	USB_DT_PHYSICAL = 0x23
+)
+
+// HID class requests
+const (
+	HID_REQ_GET_REPORT   = 0x01
+	HID_REQ_GET_IDLE     = 0x02
+	HID_REQ_GET_PROTOCOL = 0x03
+	HID_REQ_SET_REPORT   = 0x09
+	HID_REQ_SET_IDLE     = 0x0a
+	HID_REQ_SET_PROTOCOL = 0x0b
+)
+
+// Request types of the class requests
+const (
+	requestTypeIn  = 0xa1 // IN, class, interface
+	requestTypeOut = 0x21 // OUT, class, interface
+)
+
+// requestTimeout bounds each class request
+const requestTimeout = 5 * time.Second
+
+// ReportType is the kind of a report, as encoded in the high byte of wValue
+// of GET_REPORT and SET_REPORT
+type ReportType uint8
+
+const (
+	ReportInput   ReportType = 0x01
+	ReportOutput  ReportType = 0x02
+	ReportFeature ReportType = 0x03
+)
+
+func (t ReportType) String() string {
+	switch t {
+	case ReportInput:
+		return "input"
+	case ReportOutput:
+		return "output"
+	case ReportFeature:
+		return "feature"
+	}
+	return fmt.Sprintf("ReportType(%d)", uint8(t))
+}
+
+// Protocols of GET_PROTOCOL and SET_PROTOCOL, which only boot interfaces
+// (subclass 1) support
+const (
+	ProtocolBoot   = 0x00
+	ProtocolReport = 0x01
+)
+
+// ClassDescriptor is one entry of the class descriptor list of a HID
+// descriptor
+type ClassDescriptor struct {
+	Type   uint8
+	Length uint16
+}
+
+// Descriptor is the HID descriptor that follows a HID interface descriptor
+type Descriptor struct {
+	Length         uint8
+	DescriptorType uint8
+	HIDVersion     uint16 // bcdHID
+	CountryCode    uint8
+	Descriptors    []ClassDescriptor
+}
+
+// ReportDescriptorLength returns the length of the report descriptor, which
+// GET_DESCRIPTOR must ask for in full
+func (d *Descriptor) ReportDescriptorLength() (int, bool) {
+	for _, c := range d.Descriptors {
+		if c.Type == USB_DT_REPORT {
+			return int(c.Length), true
+		}
+	}
+	return 0, false
+}
+
+// ParseDescriptor finds and parses the HID descriptor in the Extra bytes of
+// a HID interface. It returns an error wrapping usb.ErrNotFound if there is
+// none.
+func ParseDescriptor(extra []byte) (*Descriptor, error) {
+	pos := 0
+	for pos < len(extra) {
+		if pos+2 > len(extra) {
+			return nil, fmt.Errorf("truncated descriptor at offset %d", pos)
+		}
+
+		length := int(extra[pos])
+		if length < 2 || pos+length > len(extra) {
+			return nil, fmt.Errorf("invalid descriptor length %d at offset %d", length, pos)
+		}
+
+		data := extra[pos : pos+length]
+		pos += length
+
+		if data[1] != USB_DT_HID {
+			continue
+		}
+		if length < 6 {
+			return nil, fmt.Errorf("invalid HID descriptor length: %d", length)
+		}
+		count := int(data[5])
+		if length < 6+3*count {
+			return nil, fmt.Errorf("HID descriptor too short for %d class descriptors: %d bytes", count, length)
+		}
+
+		d := &Descriptor{
+			Length:         data[0],
+			DescriptorType: data[1],
+			HIDVersion:     binary.LittleEndian.Uint16(data[2:4]),
+			CountryCode:    data[4],
+			Descriptors:    make([]ClassDescriptor, count),
+		}
+		for i := range d.Descriptors {
+			off := 6 + 3*i
+			d.Descriptors[i] = ClassDescriptor{
+				Type:   data[off],
+				Length: binary.LittleEndian.Uint16(data[off+1 : off+3]),
+			}
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("HID descriptor: %w", usb.ErrNotFound)
+}
+
+// Device is one HID interface of a device. The class requests go to the
+// interface over the default pipe, so it should be claimed, with any kernel
+// driver such as usbhid detached, while they are made.
+type Device struct {
+	handle     *usb.DeviceHandle
+	iface      uint8
+	descriptor *Descriptor
+}
+
+// New returns the HID interface iface of the device of handle, reading its
+// HID descriptor from the active configuration
+func New(handle *usb.DeviceHandle, iface uint8) (*Device, error) {
+	config, err := handle.GetActiveConfigDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	alt := config.InterfaceAltSetting(iface, 0)
+	if alt == nil {
+		return nil, fmt.Errorf("interface %d: %w", iface, usb.ErrNotFound)
+	}
+	if alt.InterfaceClass != CLASS_HID {
+		return nil, fmt.Errorf("interface %d is not a HID interface (class 0x%02x)", iface, alt.InterfaceClass)
+	}
+
+	desc, err := ParseDescriptor(alt.Extra)
+	if err != nil {
+		return nil, fmt.Errorf("interface %d: %w", iface, err)
+	}
+	return &Device{handle: handle, iface: iface, descriptor: desc}, nil
+}
+
+// Descriptor returns the HID descriptor of the interface
+func (d *Device) Descriptor() *Descriptor {
+	return d.descriptor
+}
+
+// GetReportDescriptor reads the report descriptor of the interface, which
+// ParseReportDescriptor decodes
+func (d *Device) GetReportDescriptor() ([]byte, error) {
+	length, ok := d.descriptor.ReportDescriptorLength()
+	if !ok {
+		return nil, fmt.Errorf("interface %d lists no report descriptor: %w", d.iface, usb.ErrNotFound)
+	}
+
+	buf := make([]byte, length)
+	n, err := d.handle.GetRawDescriptorRecipient(usb.RecipientInterface, USB_DT_REPORT, 0, uint16(d.iface), buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get report descriptor: %w", err)
+	}
+	if n != length {
+		return nil, fmt.Errorf("short report descriptor: %d of %d bytes", n, length)
+	}
+	return buf, nil
+}
+
+// GetReportDescriptor reads the report descriptor of HID interface iface of
+// the device of handle
+func GetReportDescriptor(handle *usb.DeviceHandle, iface uint8) ([]byte, error) {
+	d, err := New(handle, iface)
+	if err != nil {
+		return nil, err
+	}
+	return d.GetReportDescriptor()
+}
+
+// GetReport reads report reportID of the given type into buf over the
+// default pipe and returns its length. When the interface uses report IDs,
+// buf receives the ID as the first byte, as on the interrupt pipe; reportID 0
+// is for interfaces that don't.
+func (d *Device) GetReport(reportType ReportType, reportID uint8, buf []byte) (int, error) {
+	value := uint16(reportType)<<8 | uint16(reportID)
+	return d.handle.ControlTransfer(requestTypeIn, HID_REQ_GET_REPORT, value, uint16(d.iface), buf, requestTimeout)
+}
+
+// SetReport sends report reportID of the given type over the default pipe.
+// As with GetReport, data starts with the report ID when the interface uses
+// report IDs.
+func (d *Device) SetReport(reportType ReportType, reportID uint8, data []byte) error {
+	value := uint16(reportType)<<8 | uint16(reportID)
+	_, err := d.handle.ControlTransfer(requestTypeOut, HID_REQ_SET_REPORT, value, uint16(d.iface), data, requestTimeout)
+	return err
+}
+
+// GetIdle returns how often the interface repeats input report reportID when
+// it has not changed, or 0 if it only reports changes
+func (d *Device) GetIdle(reportID uint8) (time.Duration, error) {
+	buf := make([]byte, 1)
+	n, err := d.handle.ControlTransfer(requestTypeIn, HID_REQ_GET_IDLE, uint16(reportID), uint16(d.iface), buf, requestTimeout)
+	if err != nil {
+		return 0, err
+	}
+	if n != 1 {
+		return 0, fmt.Errorf("short GET_IDLE response: %d bytes", n)
+	}
+	return time.Duration(buf[0]) * 4 * time.Millisecond, nil
+}
+
+// SetIdle sets how often the interface repeats input report reportID, or all
+// of them for reportID 0, when it has not changed. The rate is rounded down
+// to a multiple of 4 ms up to 1.02 s; 0 makes it only report changes.
+func (d *Device) SetIdle(rate time.Duration, reportID uint8) error {
+	duration := rate / (4 * time.Millisecond)
+	if duration < 0 || duration > 0xff {
+		return usb.ErrInvalidParameter
+	}
+	value := uint16(duration)<<8 | uint16(reportID)
+	_, err := d.handle.ControlTransfer(requestTypeOut, HID_REQ_SET_IDLE, value, uint16(d.iface), nil, requestTimeout)
+	return err
+}
+
+// GetProtocol returns whether a boot interface is in ProtocolBoot or
+// ProtocolReport
+func (d *Device) GetProtocol() (uint8, error) {
+	buf := make([]byte, 1)
+	n, err := d.handle.ControlTransfer(requestTypeIn, HID_REQ_GET_PROTOCOL, 0, uint16(d.iface), buf, requestTimeout)
+	if err != nil {
+		return 0, err
+	}
+	if n != 1 {
+		return 0, fmt.Errorf("short GET_PROTOCOL response: %d bytes", n)
+	}
+	return buf[0], nil
+}
+
+// SetProtocol switches a boot interface to ProtocolBoot, in which it sends
+// the fixed boot reports instead of those of its report descriptor, or back
+// to ProtocolReport
+func (d *Device) SetProtocol(protocol uint8) error {
+	_, err := d.handle.ControlTransfer(requestTypeOut, HID_REQ_SET_PROTOCOL, uint16(protocol), uint16(d.iface), nil, requestTimeout)
+	return err
+}
@@ -0,0 +1,128 @@
+package hid
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+func TestParseDescriptor(t *testing.T) {
+	extra, _ := hex.DecodeString("092111010001223a00")
+	d, err := ParseDescriptor(extra)
+	if err != nil {
+		t.Fatalf("ParseDescriptor() error = %v", err)
+	}
+	if d.HIDVersion != 0x0111 {
+		t.Errorf("HIDVersion = %#04x, want 0x0111", d.HIDVersion)
+	}
+	if n, ok := d.ReportDescriptorLength(); !ok || n != 0x3a {
+		t.Errorf("ReportDescriptorLength() = %d, %v, want 58, true", n, ok)
+	}
+
+	if _, err := ParseDescriptor(extra[:7]); err == nil {
+		t.Error("ParseDescriptor() of a truncated descriptor succeeded")
+	}
+	if _, err := ParseDescriptor(nil); !errors.Is(err, usb.ErrNotFound) {
+		t.Errorf("ParseDescriptor(nil) error = %v, want ErrNotFound", err)
+	}
+}
+
+// setup is a control request seen by the mock device
+type setup struct {
+	requestType, request uint8
+	value, index         uint16
+	length               int
+}
+
+func TestDeviceRequests(t *testing.T) {
+	config, _ := hex.DecodeString(
+		"090222000101008032" + // Configuration 1, 34 bytes
+			"090400000103000000" + // Interface 0, HID
+			"092111010001223a00" + // HID 1.11 with a 58 byte report descriptor
+			"0705810308000a") // Interrupt IN 0x81
+	report, _ := hex.DecodeString(gamepadReportDescriptor)
+
+	var requests []setup
+	dev := &usb.MockDevice{
+		Bus:        1,
+		Address:    4,
+		Descriptor: usb.DeviceDescriptor{VendorID: 0x1209, NumConfigurations: 1},
+		Configs:    [][]byte{config},
+		Control: func(requestType, request uint8, value, index uint16, data []byte) (int, error) {
+			requests = append(requests, setup{requestType, request, value, index, len(data)})
+			switch {
+			case requestType == 0x81 && request == usb.USB_REQ_GET_DESCRIPTOR && value == 0x2200:
+				return copy(data, report), nil
+			case requestType == 0xa1 && request == HID_REQ_GET_REPORT:
+				return copy(data, []byte{0x01, 0xff, 0x00, 0x7f, 0x81}), nil
+			case requestType == 0x21:
+				return len(data), nil
+			}
+			return 0, usb.ErrPipeStalled
+		},
+	}
+	usb.SetBackend(usb.NewMockBackend(dev))
+	defer usb.SetBackend(nil)
+
+	devices, err := usb.DeviceList()
+	if err != nil || len(devices) != 1 {
+		t.Fatalf("DeviceList() = %v, %v, want the mock device", devices, err)
+	}
+	h, err := devices[0].Open()
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer h.Close()
+
+	desc, err := GetReportDescriptor(h, 0)
+	if err != nil {
+		t.Fatalf("GetReportDescriptor() error = %v", err)
+	}
+	if parsed, err := ParseReportDescriptor(desc); err != nil || parsed.Report(ReportInput, 1) == nil {
+		t.Errorf("ParseReportDescriptor() of the read descriptor = %+v, %v", parsed, err)
+	}
+	if _, err := GetReportDescriptor(h, 1); !errors.Is(err, usb.ErrNotFound) {
+		t.Errorf("GetReportDescriptor() of a missing interface error = %v, want ErrNotFound", err)
+	}
+
+	d, err := New(h, 0)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	requests = nil
+
+	buf := make([]byte, 5)
+	if n, err := d.GetReport(ReportInput, 1, buf); err != nil || n != 5 || buf[0] != 0x01 {
+		t.Errorf("GetReport() = %d, %v, %x, want input report 1", n, err, buf)
+	}
+	if err := d.SetReport(ReportOutput, 2, []byte{0x02, 0x10, 0x20, 0x30}); err != nil {
+		t.Errorf("SetReport() error = %v", err)
+	}
+	if err := d.SetReport(ReportFeature, 2, []byte{0x02, 0, 0, 0}); err != nil {
+		t.Errorf("SetReport(feature) error = %v", err)
+	}
+	if err := d.SetIdle(500*time.Millisecond, 0); err != nil {
+		t.Errorf("SetIdle() error = %v", err)
+	}
+	if err := d.SetIdle(2*time.Second, 0); !errors.Is(err, usb.ErrInvalidParameter) {
+		t.Errorf("SetIdle(2s) error = %v, want ErrInvalidParameter", err)
+	}
+
+	want := []setup{
+		{0xa1, HID_REQ_GET_REPORT, 0x0101, 0, 5},
+		{0x21, HID_REQ_SET_REPORT, 0x0202, 0, 4},
+		{0x21, HID_REQ_SET_REPORT, 0x0302, 0, 4},
+		{0x21, HID_REQ_SET_IDLE, 0x7d00, 0, 0},
+	}
+	if len(requests) != len(want) {
+		t.Fatalf("requests = %+v, want %+v", requests, want)
+	}
+	for i := range want {
+		if requests[i] != want[i] {
+			t.Errorf("request %d = %+v, want %+v", i, requests[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package hid
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Usage pages
+const (
+	UsagePageGenericDesktop = 0x01
+	UsagePageSimulation     = 0x02
+	UsagePageKeyboard       = 0x07
+	UsagePageLED            = 0x08
+	UsagePageButton         = 0x09
+	UsagePageConsumer       = 0x0c
+	UsagePageDigitizer      = 0x0d
+	UsagePageVendor         = 0xff00 // First of the vendor-defined pages
+)
+
+// Usages of the Generic Desktop page that name top-level collections
+const (
+	UsagePointer  = 0x01
+	UsageMouse    = 0x02
+	UsageJoystick = 0x04
+	UsageGamepad  = 0x05
+	UsageKeyboard = 0x06
+	UsageKeypad   = 0x07
+)
+
+// Item types of the short items of a report descriptor
+const (
+	itemMain   = 0
+	itemGlobal = 1
+	itemLocal  = 2
+)
+
+// Tags of the items the parser acts on
+const (
+	tagInput         = 0x8
+	tagOutput        = 0x9
+	tagCollection    = 0xa
+	tagFeature       = 0xb
+	tagEndCollection = 0xc
+
+	tagUsagePage   = 0x0
+	tagReportSize  = 0x7
+	tagReportID    = 0x8
+	tagReportCount = 0x9
+	tagPush        = 0xa
+	tagPop         = 0xb
+
+	tagUsage = 0x0
+)
+
+// collectionApplication is the Collection item data of an application
+// collection
+const collectionApplication = 0x01
+
+// Usage is a usage page and a usage ID within it
+type Usage struct {
+	Page uint16
+	ID   uint16
+}
+
+// Report is one report declared by a report descriptor
+type Report struct {
+	Type ReportType
+	ID   uint8 // 0 if the descriptor does not use report IDs
+	Bits int   // Size of the report's fields, without the report ID
+}
+
+// Size returns the length of the report in bytes, without the report ID
+// byte that precedes numbered reports on the wire
+func (r Report) Size() int {
+	return (r.Bits + 7) / 8
+}
+
+// ReportDescriptor is what ParseReportDescriptor gathers from a report
+// descriptor: enough to tell what a device is and to size its reports,
+// without decoding individual fields
+type ReportDescriptor struct {
+	UsagePages   []uint16 // Every usage page referred to, in order of first use
+	Applications []Usage  // Usages of the top-level application collections
+	Reports      []Report // In order of first declaration
+}
+
+// Report returns the report of the given type and ID, or nil if the
+// descriptor declares none
+func (d *ReportDescriptor) Report(reportType ReportType, id uint8) *Report {
+	for i := range d.Reports {
+		if d.Reports[i].Type == reportType && d.Reports[i].ID == id {
+			return &d.Reports[i]
+		}
+	}
+	return nil
+}
+
+// Numbered reports whether the reports carry a report ID byte
+func (d *ReportDescriptor) Numbered() bool {
+	for _, r := range d.Reports {
+		if r.ID != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// globalState holds the global items in effect, which Push and Pop save and
+// restore
+type globalState struct {
+	usagePage   uint16
+	reportSize  int
+	reportCount int
+	reportID    uint8
+}
+
+// ParseReportDescriptor walks the items of a report descriptor, tracking the
+// usage pages, application collections and report sizes it declares. Long
+// items are skipped.
+func ParseReportDescriptor(data []byte) (*ReportDescriptor, error) {
+	d := &ReportDescriptor{}
+	var (
+		global globalState
+		stack  []globalState
+		usages []Usage // Local Usage items since the last main item
+		depth  int
+	)
+
+	for pos := 0; pos < len(data); {
+		prefix := data[pos]
+		if prefix == 0xfe {
+			// Long item: bDataSize, bLongItemTag, then the data
+			if pos+3 > len(data) || pos+3+int(data[pos+1]) > len(data) {
+				return nil, fmt.Errorf("truncated long item at offset %d", pos)
+			}
+			pos += 3 + int(data[pos+1])
+			continue
+		}
+
+		size := int(prefix & 0x03)
+		if size == 3 {
+			size = 4
+		}
+		if pos+1+size > len(data) {
+			return nil, fmt.Errorf("truncated item 0x%02x at offset %d", prefix, pos)
+		}
+		value := itemValue(data[pos+1 : pos+1+size])
+		itemType, tag := (prefix>>2)&0x03, prefix>>4
+
+		switch itemType {
+		case itemMain:
+			switch tag {
+			case tagInput:
+				d.addBits(ReportInput, global.reportID, global.reportSize*global.reportCount)
+			case tagOutput:
+				d.addBits(ReportOutput, global.reportID, global.reportSize*global.reportCount)
+			case tagFeature:
+				d.addBits(ReportFeature, global.reportID, global.reportSize*global.reportCount)
+			case tagCollection:
+				if depth == 0 && value == collectionApplication && len(usages) > 0 {
+					d.Applications = append(d.Applications, usages[0])
+				}
+				depth++
+			case tagEndCollection:
+				if depth == 0 {
+					return nil, fmt.Errorf("End Collection without Collection at offset %d", pos)
+				}
+				depth--
+			}
+			usages = usages[:0]
+
+		case itemGlobal:
+			switch tag {
+			case tagUsagePage:
+				global.usagePage = uint16(value)
+				d.addUsagePage(global.usagePage)
+			case tagReportSize:
+				global.reportSize = int(value)
+			case tagReportCount:
+				global.reportCount = int(value)
+			case tagReportID:
+				if value == 0 || value > 0xff {
+					return nil, fmt.Errorf("invalid report ID %d at offset %d", value, pos)
+				}
+				global.reportID = uint8(value)
+			case tagPush:
+				stack = append(stack, global)
+			case tagPop:
+				if len(stack) == 0 {
+					return nil, fmt.Errorf("Pop without Push at offset %d", pos)
+				}
+				global = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+
+		case itemLocal:
+			if tag == tagUsage {
+				// A four byte usage carries its own page in the high half
+				usage := Usage{Page: global.usagePage, ID: uint16(value)}
+				if size == 4 {
+					usage.Page = uint16(value >> 16)
+					d.addUsagePage(usage.Page)
+				}
+				usages = append(usages, usage)
+			}
+		}
+		pos += 1 + size
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("%d collections not closed", depth)
+	}
+	return d, nil
+}
+
+// itemValue decodes the little-endian data of a short item as unsigned
+func itemValue(data []byte) uint32 {
+	var buf [4]byte
+	copy(buf[:], data)
+	return binary.LittleEndian.Uint32(buf[:])
+}
+
+func (d *ReportDescriptor) addBits(reportType ReportType, id uint8, bits int) {
+	if r := d.Report(reportType, id); r != nil {
+		r.Bits += bits
+		return
+	}
+	d.Reports = append(d.Reports, Report{Type: reportType, ID: id, Bits: bits})
+}
+
+func (d *ReportDescriptor) addUsagePage(page uint16) {
+	for _, p := range d.UsagePages {
+		if p == page {
+			return
+		}
+	}
+	d.UsagePages = append(d.UsagePages, page)
+}
@@ -0,0 +1,100 @@
+package hid
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// gamepadReportDescriptor is a gamepad with 16 buttons and two axes in input
+// report 1, and a vendor output and feature report 2
+const gamepadReportDescriptor = "05010905a101" + // Generic Desktop, Gamepad, Application
+	"8501" + // Report ID 1
+	"05091901291015002501750195108102" + // 16 one bit buttons
+	"0501093009311581257f750895028102" + // X and Y, a byte each
+	"8502" + // Report ID 2
+	"0600ff0901750895039102" + // Vendor output, 3 bytes
+	"0902b102" + // Vendor feature, 3 bytes
+	"c0"
+
+func TestParseReportDescriptor(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string // hex encoded
+		wantErr  bool
+		validate func(t *testing.T, d *ReportDescriptor)
+	}{
+		{
+			name: "gamepad",
+			data: gamepadReportDescriptor,
+			validate: func(t *testing.T, d *ReportDescriptor) {
+				if want := []uint16{UsagePageGenericDesktop, UsagePageButton, UsagePageVendor}; !reflect.DeepEqual(d.UsagePages, want) {
+					t.Errorf("UsagePages = %#x, want %#x", d.UsagePages, want)
+				}
+				if want := []Usage{{Page: UsagePageGenericDesktop, ID: UsageGamepad}}; !reflect.DeepEqual(d.Applications, want) {
+					t.Errorf("Applications = %+v, want %+v", d.Applications, want)
+				}
+				want := []Report{
+					{Type: ReportInput, ID: 1, Bits: 32},
+					{Type: ReportOutput, ID: 2, Bits: 24},
+					{Type: ReportFeature, ID: 2, Bits: 24},
+				}
+				if !reflect.DeepEqual(d.Reports, want) {
+					t.Errorf("Reports = %+v, want %+v", d.Reports, want)
+				}
+				if r := d.Report(ReportInput, 1); r == nil || r.Size() != 4 {
+					t.Errorf("Report(input, 1) = %+v, want 4 bytes", r)
+				}
+				if !d.Numbered() {
+					t.Error("Numbered() = false, want true")
+				}
+			},
+		},
+		{
+			name: "push_pop",
+			data: "75089501" + // 8 bits of 1 field
+				"a4" + "75019502" + "8102" + // Push, 2 one bit fields, Pop
+				"b4" + "8102", // One 8 bit field again
+			validate: func(t *testing.T, d *ReportDescriptor) {
+				if r := d.Report(ReportInput, 0); r == nil || r.Bits != 10 || r.Size() != 2 {
+					t.Errorf("Report(input, 0) = %+v, want 10 bits in 2 bytes", r)
+				}
+				if d.Numbered() {
+					t.Error("Numbered() = true, want false")
+				}
+			},
+		},
+		{
+			name: "extended_usage_and_long_item",
+			data: "0b01000c00" + // Usage 0x01 on the Consumer page, as a four byte item
+				"fe0201abcd" + // Long item with two data bytes
+				"a101c0",
+			validate: func(t *testing.T, d *ReportDescriptor) {
+				if want := []Usage{{Page: UsagePageConsumer, ID: 0x01}}; !reflect.DeepEqual(d.Applications, want) {
+					t.Errorf("Applications = %+v, want %+v", d.Applications, want)
+				}
+			},
+		},
+		{name: "truncated_item", data: "050109", wantErr: true},
+		{name: "end_without_collection", data: "c0", wantErr: true},
+		{name: "unclosed_collection", data: "a101", wantErr: true},
+		{name: "pop_without_push", data: "b4", wantErr: true},
+		{name: "report_id_zero", data: "8500", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatalf("bad test data: %v", err)
+			}
+			d, err := ParseReportDescriptor(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReportDescriptor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.validate != nil {
+				tt.validate(t, d)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package usb
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// HotplugEventType tells whether a device arrived or left
+type HotplugEventType int
+
+const (
+	HotplugArrived HotplugEventType = 1 << iota
+	HotplugLeft
+)
+
+// String returns "arrived" or "left"
+func (t HotplugEventType) String() string {
+	switch t {
+	case HotplugArrived:
+		return "arrived"
+	case HotplugLeft:
+		return "left"
+	default:
+		return fmt.Sprintf("HotplugEventType(%d)", int(t))
+	}
+}
+
+// HotplugEvent reports a device arriving or leaving. For departures, Device
+// is the value last seen while the device was present.
+type HotplugEvent struct {
+	Type   HotplugEventType
+	Device *Device
+}
+
+// Hotplug backends reported by Notifier.Backend
+const (
+	HotplugBackendPoll    = "poll"
+	HotplugBackendNetlink = "netlink" // Kernel uevents, on Linux
+)
+
+// DefaultPollInterval is how often the polling backend takes a new device list
+const DefaultPollInterval = time.Second
+
+// NotifierOption is a functional option for configuring a Notifier.
+type NotifierOption func(*notifierOptions)
+
+// notifierOptions holds the configuration for NewNotifier.
+type notifierOptions struct {
+	pollInterval time.Duration
+}
+
+// WithPollInterval returns an option that sets how often the polling backend
+// compares device lists
+func WithPollInterval(interval time.Duration) NotifierOption {
+	return func(o *notifierOptions) {
+		o.pollInterval = interval
+	}
+}
+
+// Notifier delivers hotplug events on a channel until it is closed
+type Notifier struct {
+	events  chan HotplugEvent
+	backend string
+
+	stop      chan struct{}
+	done      chan struct{}
+	closer    io.Closer // Unblocks the backend goroutine, if it blocks on I/O
+	closeOnce sync.Once
+}
+
+// NewNotifier starts watching for devices arriving and leaving. Devices
+// present when it starts are not reported.
+//
+// On Linux the kernel's uevents are read from a netlink socket, so events
+// arrive as soon as the kernel sees the device; options for the polling
+// backend are then ignored. An arriving device is reported before udev has
+// processed it, so opening it right away can fail with ErrPermissionDenied
+// until udev has applied its rules. Where uevents are not available the
+// polling backend is used.
+//
+// The polling backend diffs successive DeviceList snapshots, which works on
+// every platform without extra privileges. A device whose BOS Container ID
+// can be read without opening it, as on Linux from sysfs, is identified by
+// its bus number, address and Container ID; any other device by its path,
+// bus number, address and vendor and product IDs. A device that is unplugged
+// and replugged between two polls is reported as leaving and arriving if any
+// of those changed, and not at all otherwise.
+func NewNotifier(opts ...NotifierOption) (*Notifier, error) {
+	options := &notifierOptions{pollInterval: DefaultPollInterval}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.pollInterval <= 0 {
+		return nil, fmt.Errorf("poll interval %v: %w", options.pollInterval, ErrInvalidParameter)
+	}
+
+	if n, err := newPlatformNotifier(); err == nil {
+		return n, nil
+	}
+	return newPollNotifier(DeviceList, (*Device).cachedContainerID, options.pollInterval)
+}
+
+// newPollNotifier starts the polling backend on top of list, identifying
+// devices by the Container ID containerID reads where there is one
+func newPollNotifier(list func(...DeviceListOption) ([]*Device, error), containerID func(*Device) ([16]byte, bool), interval time.Duration) (*Notifier, error) {
+	devices, err := list()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Notifier{
+		events:  make(chan HotplugEvent, 16),
+		backend: HotplugBackendPoll,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go n.poll(list, containerID, interval, deviceSnapshot(devices, containerID))
+	return n, nil
+}
+
+func (n *Notifier) poll(list func(...DeviceListOption) ([]*Device, error), containerID func(*Device) ([16]byte, bool), interval time.Duration, known map[string]*Device) {
+	defer close(n.done)
+	defer close(n.events)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+
+		devices, err := list()
+		if err != nil {
+			// Keep the last snapshot and try again on the next tick
+			continue
+		}
+
+		current := deviceSnapshot(devices, containerID)
+		for _, ev := range diffDeviceSnapshots(known, current) {
+			select {
+			case n.events <- ev:
+			case <-n.stop:
+				return
+			}
+		}
+		known = current
+	}
+}
+
+// deviceKey identifies a device across device lists. containerID is the hex
+// BOS Container ID of the device, or "" if it has none or it is not known.
+// The Container ID is preferred to the path and IDs, which a different
+// device plugged in at the same address can share; the bus tells apart the
+// USB 2.0 and SuperSpeed halves of a hub, which share a Container ID.
+func deviceKey(d *Device, containerID string) string {
+	if containerID != "" {
+		return fmt.Sprintf("%d|%d|%s", d.Bus, d.Address, containerID)
+	}
+	return fmt.Sprintf("%s|%d|%d|%04x:%04x", d.Path, d.Bus, d.Address,
+		d.Descriptor.VendorID, d.Descriptor.ProductID)
+}
+
+// deviceSnapshot keys devices for diffDeviceSnapshots, by the Container ID
+// containerID reads where there is one
+func deviceSnapshot(devices []*Device, containerID func(*Device) ([16]byte, bool)) map[string]*Device {
+	snapshot := make(map[string]*Device, len(devices))
+	for _, d := range devices {
+		var id string
+		if uuid, ok := containerID(d); ok {
+			id = fmt.Sprintf("%x", uuid)
+		}
+		snapshot[deviceKey(d, id)] = d
+	}
+	return snapshot
+}
+
+// diffDeviceSnapshots returns the departures from prev followed by the
+// arrivals in cur, each in bus and address order
+func diffDeviceSnapshots(prev, cur map[string]*Device) []HotplugEvent {
+	var left, arrived []*Device
+	for key, d := range prev {
+		if _, ok := cur[key]; !ok {
+			left = append(left, d)
+		}
+	}
+	for key, d := range cur {
+		if _, ok := prev[key]; !ok {
+			arrived = append(arrived, d)
+		}
+	}
+	sortDevices(left)
+	sortDevices(arrived)
+
+	events := make([]HotplugEvent, 0, len(left)+len(arrived))
+	for _, d := range left {
+		events = append(events, HotplugEvent{Type: HotplugLeft, Device: d})
+	}
+	for _, d := range arrived {
+		events = append(events, HotplugEvent{Type: HotplugArrived, Device: d})
+	}
+	return events
+}
+
+// Events returns the channel hotplug events are delivered on. It is closed
+// when the Notifier is closed.
+func (n *Notifier) Events() <-chan HotplugEvent {
+	return n.events
+}
+
+// Backend returns the name of the mechanism the Notifier uses to detect
+// devices, such as HotplugBackendPoll
+func (n *Notifier) Backend() string {
+	return n.backend
+}
+
+// Close stops the Notifier and closes its event channel
+func (n *Notifier) Close() error {
+	n.closeOnce.Do(func() {
+		close(n.stop)
+		if n.closer != nil {
+			n.closer.Close()
+		}
+	})
+	<-n.done
+	return nil
+}
+
+// HotplugFilter selects the devices a hotplug callback is called for. The
+// zero value matches every device.
+type HotplugFilter struct {
+	VendorID  uint16 // 0 matches any vendor
+	ProductID uint16 // 0 matches any product
+
+	// Class is matched against the device class and the classes of the
+	// interfaces of an arriving device when MatchClass is set. A departing
+	// device matches if it matched when it arrived.
+	Class      uint8
+	MatchClass bool
+}
+
+func (f HotplugFilter) matchIDs(d *Device) bool {
+	return (f.VendorID == 0 || d.Descriptor.VendorID == f.VendorID) &&
+		(f.ProductID == 0 || d.Descriptor.ProductID == f.ProductID)
+}
+
+// HotplugHandle identifies a callback registered with RegisterHotplug
+type HotplugHandle int
+
+// hotplugRegistration is a callback registered with RegisterHotplug and the
+// Notifier feeding it
+type hotplugRegistration struct {
+	notifier *Notifier
+
+	mu     sync.Mutex
+	active bool
+}
+
+var (
+	hotplugMu            sync.Mutex
+	hotplugNext          HotplugHandle
+	hotplugRegistrations = make(map[HotplugHandle]*hotplugRegistration)
+)
+
+// RegisterHotplug calls cb for every device arriving or leaving after it
+// returns that matches filter, for the event types set in events, such as
+// HotplugArrived|HotplugLeft. Callbacks run on a background goroutine, one
+// at a time per registration, until DeregisterHotplug is called; they may
+// call DeregisterHotplug themselves. Events come from a Notifier, so on
+// Linux they are the kernel's uevents, and a departing device the handle
+// never saw present is described by the bus number, address and IDs the
+// removal uevent carries.
+func RegisterHotplug(events HotplugEventType, filter HotplugFilter, cb func(*Device, HotplugEventType)) (HotplugHandle, error) {
+	if events&(HotplugArrived|HotplugLeft) == 0 || cb == nil {
+		return 0, ErrInvalidParameter
+	}
+
+	n, err := NewNotifier()
+	if err != nil {
+		return 0, err
+	}
+	reg := &hotplugRegistration{notifier: n, active: true}
+
+	hotplugMu.Lock()
+	hotplugNext++
+	handle := hotplugNext
+	hotplugRegistrations[handle] = reg
+	hotplugMu.Unlock()
+
+	go reg.dispatch(events, filter, cb)
+	return handle, nil
+}
+
+// DeregisterHotplug stops the callback registered under handle. It does not
+// wait for a callback that is already running to return.
+func DeregisterHotplug(handle HotplugHandle) error {
+	hotplugMu.Lock()
+	reg, ok := hotplugRegistrations[handle]
+	delete(hotplugRegistrations, handle)
+	hotplugMu.Unlock()
+	if !ok {
+		return fmt.Errorf("hotplug handle %d: %w", handle, ErrNotFound)
+	}
+
+	reg.mu.Lock()
+	reg.active = false
+	reg.mu.Unlock()
+	return reg.notifier.Close()
+}
+
+// dispatch calls cb for the matching events of the registration's Notifier
+// until it is closed
+func (r *hotplugRegistration) dispatch(events HotplugEventType, filter HotplugFilter, cb func(*Device, HotplugEventType)) {
+	// Keys of the devices that matched the class filter when they arrived
+	matched := make(map[string]bool)
+
+	for ev := range r.notifier.Events() {
+		if !filter.matchIDs(ev.Device) {
+			continue
+		}
+		if filter.MatchClass {
+			key := deviceKey(ev.Device, "")
+			if ev.Type == HotplugArrived {
+				if !ev.Device.HasClass(filter.Class) {
+					continue
+				}
+				matched[key] = true
+			} else {
+				if !matched[key] && ev.Device.Descriptor.DeviceClass != filter.Class {
+					continue
+				}
+				delete(matched, key)
+			}
+		}
+		if events&ev.Type == 0 {
+			continue
+		}
+
+		r.mu.Lock()
+		active := r.active
+		r.mu.Unlock()
+		if !active {
+			return
+		}
+		cb(ev.Device, ev.Type)
+	}
+}
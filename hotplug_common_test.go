@@ -0,0 +1,112 @@
+package usb
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPollNotifier(t *testing.T) {
+	mouse := &Device{Path: "1-1", Bus: 1, Address: 2, Descriptor: DeviceDescriptor{VendorID: 0x046d, ProductID: 0xc077}}
+	keyboard := &Device{Path: "1-2", Bus: 1, Address: 3, Descriptor: DeviceDescriptor{VendorID: 0x04d9, ProductID: 0x1702}}
+	// The mouse replugged in the same port, enumerated at a new address
+	replugged := &Device{Path: "1-1", Bus: 1, Address: 4, Descriptor: mouse.Descriptor}
+	// A drive swapped between polls for another of the same model, which
+	// got the same address and only differs in its Container ID
+	drive := &Device{Path: "2-1", Bus: 2, Address: 2, Descriptor: DeviceDescriptor{USBVersion: 0x0320, VendorID: 0x0781, ProductID: 0x5583}}
+	swapped := &Device{Path: drive.Path, Bus: drive.Bus, Address: drive.Address, Descriptor: drive.Descriptor}
+
+	var mu sync.Mutex
+	snapshots := [][]*Device{
+		{mouse, drive},
+		{mouse, keyboard, drive},
+		{mouse, keyboard, drive},
+		{keyboard, replugged, drive},
+		{keyboard, replugged, swapped},
+	}
+	list := func(...DeviceListOption) ([]*Device, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		devices := snapshots[0]
+		if len(snapshots) > 1 {
+			snapshots = snapshots[1:]
+		}
+		return devices, nil
+	}
+
+	containerID := func(d *Device) ([16]byte, bool) {
+		switch d {
+		case drive:
+			return [16]byte{0x01}, true
+		case swapped:
+			return [16]byte{0x02}, true
+		}
+		return [16]byte{}, false
+	}
+
+	n, err := newPollNotifier(list, containerID, time.Millisecond)
+	if err != nil {
+		t.Fatalf("newPollNotifier() error = %v", err)
+	}
+	defer n.Close()
+
+	if n.Backend() != HotplugBackendPoll {
+		t.Errorf("Backend() = %q, want %q", n.Backend(), HotplugBackendPoll)
+	}
+
+	want := []struct {
+		typ HotplugEventType
+		dev *Device
+	}{
+		{HotplugArrived, keyboard},
+		{HotplugLeft, mouse},
+		{HotplugArrived, replugged},
+		{HotplugLeft, drive},
+		{HotplugArrived, swapped},
+	}
+	for i, w := range want {
+		select {
+		case ev := <-n.Events():
+			if ev.Type != w.typ || ev.Device != w.dev {
+				t.Errorf("event %d = %v %s, want %v %s", i, ev.Type, ev.Device.Path, w.typ, w.dev.Path)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for event %d", i)
+		}
+	}
+
+	n.Close()
+	if _, ok := <-n.Events(); ok {
+		t.Error("Events() channel still open after Close")
+	}
+}
+
+func TestHotplugDispatch(t *testing.T) {
+	webcam := &Device{Path: "1-1", Bus: 1, Address: 2, Descriptor: DeviceDescriptor{VendorID: 0x046d, ProductID: 0x08e5, DeviceClass: 0x0e}}
+	mouse := &Device{Path: "1-2", Bus: 1, Address: 3, Descriptor: DeviceDescriptor{VendorID: 0x046d, ProductID: 0xc077}}
+
+	n := &Notifier{events: make(chan HotplugEvent, 8)}
+	for _, ev := range []HotplugEvent{
+		{Type: HotplugArrived, Device: webcam},
+		{Type: HotplugArrived, Device: mouse},
+		{Type: HotplugLeft, Device: mouse},
+		{Type: HotplugLeft, Device: webcam},
+	} {
+		n.events <- ev
+	}
+	close(n.events)
+
+	type call struct {
+		dev *Device
+		typ HotplugEventType
+	}
+	var calls []call
+	reg := &hotplugRegistration{notifier: n, active: true}
+	reg.dispatch(HotplugLeft, HotplugFilter{VendorID: 0x046d, Class: 0x0e, MatchClass: true}, func(d *Device, typ HotplugEventType) {
+		calls = append(calls, call{d, typ})
+	})
+
+	if len(calls) != 1 || calls[0].dev != webcam || calls[0].typ != HotplugLeft {
+		t.Errorf("callback calls = %v, want only the webcam leaving", calls)
+	}
+}
@@ -0,0 +1,166 @@
+package usb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// newPlatformNotifier starts a Notifier on a NETLINK_KOBJECT_UEVENT socket
+// subscribed to the kernel's uevents
+func newPlatformNotifier() (*Notifier, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uevent socket: %w", err)
+	}
+	// Group 1 carries the kernel's own uevents, as opposed to udev's
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to bind uevent socket: %w", err)
+	}
+	// A non-blocking descriptor is handled by the runtime poller, so closing
+	// the file unblocks the pending Read
+	sock := os.NewFile(uintptr(fd), "uevent")
+
+	// Remember the devices already present so that their departure carries
+	// everything that was known about them
+	known := make(map[string]*Device)
+	if devices, err := DeviceList(); err == nil {
+		for _, d := range devices {
+			if d.sysfsPath != "" {
+				known[d.sysfsPath] = d
+			}
+		}
+	}
+
+	n := &Notifier{
+		events:  make(chan HotplugEvent, 16),
+		backend: HotplugBackendNetlink,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		closer:  sock,
+	}
+	go n.readUevents(sock, known)
+	return n, nil
+}
+
+// readUevents turns the add and remove uevents of USB devices into hotplug
+// events until the socket is closed
+func (n *Notifier) readUevents(sock *os.File, known map[string]*Device) {
+	defer close(n.done)
+	defer close(n.events)
+
+	buf := make([]byte, 64*1024)
+	for {
+		m, err := sock.Read(buf)
+		if err != nil {
+			select {
+			case <-n.stop:
+				return
+			default:
+			}
+			if errors.Is(err, syscall.ENOBUFS) {
+				// The kernel dropped uevents because we fell behind
+				continue
+			}
+			return
+		}
+
+		uevent := parseUevent(buf[:m])
+		if uevent["SUBSYSTEM"] != "usb" || uevent["DEVTYPE"] != "usb_device" {
+			continue
+		}
+		sysfsPath := filepath.Join("/sys", uevent["DEVPATH"])
+
+		var ev HotplugEvent
+		switch uevent["ACTION"] {
+		case "add":
+			d, err := NewSysfsEnumerator().loadDeviceFromSysfs(sysfsPath, filepath.Base(sysfsPath))
+			if err == nil {
+				ev.Device = d.ToUSBDevice()
+			} else if ev.Device, err = ueventDevice(uevent); err != nil {
+				// The device went away again before sysfs could be read
+				continue
+			}
+			known[sysfsPath] = ev.Device
+			ev.Type = HotplugArrived
+		case "remove":
+			ev.Device = known[sysfsPath]
+			delete(known, sysfsPath)
+			if ev.Device == nil {
+				var err error
+				if ev.Device, err = ueventDevice(uevent); err != nil {
+					continue
+				}
+			}
+			ev.Type = HotplugLeft
+		default:
+			continue
+		}
+
+		select {
+		case n.events <- ev:
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+// parseUevent splits a kernel uevent, an "action@devpath" header followed by
+// NUL-separated KEY=VALUE pairs, into its keys. Messages from udev, which
+// start with "libudev", do not have the header and parse as well.
+func parseUevent(msg []byte) map[string]string {
+	uevent := make(map[string]string)
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		if key, value, ok := strings.Cut(string(field), "="); ok {
+			uevent[key] = value
+		}
+	}
+	return uevent
+}
+
+// ueventDevice describes a USB device from the keys of its uevent, for
+// devices whose sysfs directory is already gone: BUSNUM and DEVNUM give its
+// location and PRODUCT ("vid/pid/bcdDevice" in hex) and TYPE
+// ("class/subclass/protocol" in decimal) its identity
+func ueventDevice(uevent map[string]string) (*Device, error) {
+	bus, err1 := strconv.ParseUint(uevent["BUSNUM"], 10, 8)
+	addr, err2 := strconv.ParseUint(uevent["DEVNUM"], 10, 8)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("uevent for %s has no bus number or address", uevent["DEVPATH"])
+	}
+
+	d := &Device{
+		Path:      fmt.Sprintf("/dev/bus/usb/%03d/%03d", bus, addr),
+		Bus:       uint8(bus),
+		Address:   uint8(addr),
+		sysfsPath: filepath.Join("/sys", uevent["DEVPATH"]),
+		Descriptor: DeviceDescriptor{
+			Length:         18,
+			DescriptorType: USB_DT_DEVICE,
+		},
+	}
+
+	if product := strings.Split(uevent["PRODUCT"], "/"); len(product) == 3 {
+		vid, _ := strconv.ParseUint(product[0], 16, 16)
+		pid, _ := strconv.ParseUint(product[1], 16, 16)
+		bcd, _ := strconv.ParseUint(product[2], 16, 16)
+		d.Descriptor.VendorID = uint16(vid)
+		d.Descriptor.ProductID = uint16(pid)
+		d.Descriptor.DeviceVersion = uint16(bcd)
+	}
+	if typ := strings.Split(uevent["TYPE"], "/"); len(typ) == 3 {
+		class, _ := strconv.ParseUint(typ[0], 10, 8)
+		subClass, _ := strconv.ParseUint(typ[1], 10, 8)
+		protocol, _ := strconv.ParseUint(typ[2], 10, 8)
+		d.Descriptor.DeviceClass = uint8(class)
+		d.Descriptor.DeviceSubClass = uint8(subClass)
+		d.Descriptor.DeviceProtocol = uint8(protocol)
+	}
+	return d, nil
+}
@@ -0,0 +1,47 @@
+package usb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUeventDevice(t *testing.T) {
+	msg := strings.Join([]string{
+		"remove@/devices/pci0000:00/0000:00:14.0/usb3/3-2",
+		"ACTION=remove",
+		"DEVPATH=/devices/pci0000:00/0000:00:14.0/usb3/3-2",
+		"SUBSYSTEM=usb",
+		"DEVNAME=bus/usb/003/007",
+		"DEVTYPE=usb_device",
+		"PRODUCT=46d/8e5/c",
+		"TYPE=239/2/1",
+		"BUSNUM=003",
+		"DEVNUM=007",
+		"SEQNUM=5123",
+	}, "\x00") + "\x00"
+
+	uevent := parseUevent([]byte(msg))
+	if uevent["ACTION"] != "remove" || uevent["DEVTYPE"] != "usb_device" {
+		t.Fatalf("parseUevent() = %v", uevent)
+	}
+
+	d, err := ueventDevice(uevent)
+	if err != nil {
+		t.Fatalf("ueventDevice() error = %v", err)
+	}
+	if d.Path != "/dev/bus/usb/003/007" || d.Bus != 3 || d.Address != 7 {
+		t.Errorf("location = %s bus %d address %d", d.Path, d.Bus, d.Address)
+	}
+	desc := d.Descriptor
+	if desc.VendorID != 0x046d || desc.ProductID != 0x08e5 || desc.DeviceVersion != 0x000c {
+		t.Errorf("IDs = %04x:%04x bcdDevice %04x", desc.VendorID, desc.ProductID, desc.DeviceVersion)
+	}
+	if desc.DeviceClass != 0xef || desc.DeviceSubClass != 2 || desc.DeviceProtocol != 1 {
+		t.Errorf("class = %02x/%02x/%02x, want ef/02/01", desc.DeviceClass, desc.DeviceSubClass, desc.DeviceProtocol)
+	}
+
+	delete(uevent, "DEVNUM")
+	if _, err := ueventDevice(uevent); err == nil {
+		t.Error("ueventDevice() without DEVNUM succeeded")
+	}
+}
@@ -7,6 +7,7 @@ package usb
 #include <IOKit/IOCFPlugIn.h>
 #include <CoreFoundation/CoreFoundation.h>
 #include <mach/mach.h>
+#include <stdint.h>
 
 // USB device and interface IDs - use the ones from IOKit headers
 
@@ -132,7 +133,8 @@ int ControlTransfer(IOUSBDeviceInterface320 **deviceInterface,
                    UInt16 wIndex,
                    void *data,
                    UInt16 wLength,
-                   UInt32 timeout) {
+                   UInt32 timeout,
+                   UInt32 *lenDone) {
     IOUSBDevRequestTO request;
     request.bmRequestType = bmRequestType;
     request.bRequest = bRequest;
@@ -142,8 +144,11 @@ int ControlTransfer(IOUSBDeviceInterface320 **deviceInterface,
     request.pData = data;
     request.noDataTimeout = timeout;
     request.completionTimeout = timeout;
+    request.wLenDone = 0;
 
-    return (*deviceInterface)->DeviceRequestTO(deviceInterface, &request);
+    IOReturn ret = (*deviceInterface)->DeviceRequestTO(deviceInterface, &request);
+    *lenDone = request.wLenDone;
+    return ret;
 }
 
 // Reset device
@@ -157,7 +162,8 @@ int GetStringDescriptor(IOUSBDeviceInterface320 **deviceInterface,
                        UInt16 langID,
                        void *buf,
                        UInt16 maxLen,
-                       UInt32 timeout) {
+                       UInt32 timeout,
+                       UInt32 *lenDone) {
     IOUSBDevRequestTO request;
     request.bmRequestType = 0x80; // Device-to-host, standard, device
     request.bRequest = 0x06;      // GET_DESCRIPTOR
@@ -167,8 +173,11 @@ int GetStringDescriptor(IOUSBDeviceInterface320 **deviceInterface,
     request.pData = buf;
     request.noDataTimeout = timeout;
     request.completionTimeout = timeout;
+    request.wLenDone = 0;
 
-    return (*deviceInterface)->DeviceRequestTO(deviceInterface, &request);
+    IOReturn ret = (*deviceInterface)->DeviceRequestTO(deviceInterface, &request);
+    *lenDone = request.wLenDone;
+    return ret;
 }
 
 // Interface operations
@@ -221,21 +230,22 @@ int BulkTransferRead(IOUSBInterfaceInterface300 **interfaceInterface,
     }
 }
 
-// Async transfer support
+// Async transfer support. userData is the cgo.Handle of the Go side of the
+// transfer, which goAsyncTransferComplete looks up when IOKit completes it
+// on the handle's run loop.
 typedef struct {
     void *buffer;
     UInt32 size;
     IOReturn status;
-    void *userData;
-    void (*callback)(void *userData, IOReturn result, void *arg0);
+    uintptr_t userData;
 } AsyncTransferContext;
 
+extern void goAsyncTransferComplete(uintptr_t userData, int32_t result, void *arg0);
+
 void AsyncCallback(void *refCon, IOReturn result, void *arg0) {
     AsyncTransferContext *ctx = (AsyncTransferContext *)refCon;
     ctx->status = result;
-    if (ctx->callback) {
-        ctx->callback(ctx->userData, result, arg0);
-    }
+    goAsyncTransferComplete(ctx->userData, result, arg0);
 }
 
 // Async bulk transfer
@@ -244,7 +254,6 @@ int BulkTransferAsync(IOUSBInterfaceInterface300 **interfaceInterface,
                      void *buf,
                      UInt32 size,
                      void *context) {
-    AsyncTransferContext *ctx = (AsyncTransferContext *)context;
     return (*interfaceInterface)->WritePipeAsync(interfaceInterface, pipeRef, buf, size,
                                                  AsyncCallback, context);
 }
@@ -254,7 +263,6 @@ int BulkTransferReadAsync(IOUSBInterfaceInterface300 **interfaceInterface,
                          void *buf,
                          UInt32 size,
                          void *context) {
-    AsyncTransferContext *ctx = (AsyncTransferContext *)context;
     return (*interfaceInterface)->ReadPipeAsync(interfaceInterface, pipeRef, buf, size,
                                                 AsyncCallback, context);
 }
@@ -273,11 +281,21 @@ CFRunLoopSourceRef CreateDeviceAsyncEventSource(IOUSBDeviceInterface320 **device
     return source;
 }
 
-// Clear endpoint halt
+// Clear endpoint halt on the host side only
 int ClearPipeStall(IOUSBInterfaceInterface300 **interfaceInterface, UInt8 pipeRef) {
     return (*interfaceInterface)->ClearPipeStall(interfaceInterface, pipeRef);
 }
 
+// Clear endpoint halt on the host and send CLEAR_FEATURE(ENDPOINT_HALT)
+int ClearPipeStallBothEnds(IOUSBInterfaceInterface300 **interfaceInterface, UInt8 pipeRef) {
+    return (*interfaceInterface)->ClearPipeStallBothEnds(interfaceInterface, pipeRef);
+}
+
+// Abort the transfers pending on a pipe, which complete with kIOReturnAborted
+int AbortPipe(IOUSBInterfaceInterface300 **interfaceInterface, UInt8 pipeRef) {
+    return (*interfaceInterface)->AbortPipe(interfaceInterface, pipeRef);
+}
+
 // Get pipe properties
 int GetPipeProperties(IOUSBInterfaceInterface300 **interfaceInterface,
                       UInt8 pipeRef,
@@ -291,24 +309,111 @@ int GetPipeProperties(IOUSBInterfaceInterface300 **interfaceInterface,
                                                    maxPacketSize, interval);
 }
 
+// Create an iterator over the interfaces of the active configuration
+io_iterator_t CreateInterfaceIterator(IOUSBDeviceInterface320 **deviceInterface) {
+    IOUSBFindInterfaceRequest request;
+    request.bInterfaceClass = kIOUSBFindInterfaceDontCare;
+    request.bInterfaceSubClass = kIOUSBFindInterfaceDontCare;
+    request.bInterfaceProtocol = kIOUSBFindInterfaceDontCare;
+    request.bAlternateSetting = kIOUSBFindInterfaceDontCare;
+
+    io_iterator_t iterator = 0;
+    if ((*deviceInterface)->CreateInterfaceIterator(deviceInterface, &request, &iterator) != kIOReturnSuccess) {
+        return 0;
+    }
+    return iterator;
+}
+
 */
 import "C"
 
 import (
 	"fmt"
+	"runtime/cgo"
 	"unsafe"
 )
 
 // IOKit constants
 const (
 	kIOReturnSuccess         = 0
-	kIOUSBPipeStalled        = int32(-536870897)
-	kIOReturnNotResponding   = int32(-536870906)
-	kIOReturnNoDevice        = int32(-536870208)
-	kIOReturnExclusiveAccess = int32(-536870203)
-	kIOUSBTransactionTimeout = int32(-536870899)
+	kIOReturnError           = int32(-536870212) // 0xe00002bc
+	kIOReturnNoMemory        = int32(-536870211) // 0xe00002bd
+	kIOReturnNoResources     = int32(-536870210) // 0xe00002be
+	kIOReturnNoDevice        = int32(-536870208) // 0xe00002c0
+	kIOReturnNotPrivileged   = int32(-536870207) // 0xe00002c1
+	kIOReturnBadArgument     = int32(-536870206) // 0xe00002c2
+	kIOReturnExclusiveAccess = int32(-536870203) // 0xe00002c5
+	kIOReturnUnsupported     = int32(-536870201) // 0xe00002c7
+	kIOReturnIOError         = int32(-536870198) // 0xe00002ca
+	kIOReturnNotOpen         = int32(-536870195) // 0xe00002cd
+	kIOReturnBusy            = int32(-536870187) // 0xe00002d5
+	kIOReturnTimeout         = int32(-536870186) // 0xe00002d6
+	kIOReturnNotAttached     = int32(-536870183) // 0xe00002d9
+	kIOReturnNotPermitted    = int32(-536870174) // 0xe00002e2
+	kIOReturnUnderrun        = int32(-536870169) // 0xe00002e7
+	kIOReturnOverrun         = int32(-536870168) // 0xe00002e8
+	kIOReturnAborted         = int32(-536870165) // 0xe00002eb
+	kIOReturnNotResponding   = int32(-536870163) // 0xe00002ed
+	kIOReturnNotFound        = int32(-536870160) // 0xe00002f0
+	kIOUSBPipeStalled        = int32(-536854449) // 0xe000404f
+	kIOUSBTransactionTimeout = int32(-536854447) // 0xe0004051
+	kIOUSBEndpointNotFound   = int32(-536854441) // 0xe0004057
+	kIOUSBUnknownPipeErr     = int32(-536854431) // 0xe0004061
 )
 
+// ioReturnErrors maps IOReturn codes onto the package errors
+var ioReturnErrors = map[int32]error{
+	kIOReturnError:           ErrIO,
+	kIOReturnNoMemory:        ErrNoMem,
+	kIOReturnNoResources:     ErrNoMem,
+	kIOReturnNoDevice:        ErrNoDevice,
+	kIOReturnNotPrivileged:   ErrPermissionDenied,
+	kIOReturnBadArgument:     ErrInvalidParameter,
+	kIOReturnExclusiveAccess: ErrDeviceBusy,
+	kIOReturnUnsupported:     ErrNotSupported,
+	kIOReturnIOError:         ErrIO,
+	kIOReturnNotOpen:         ErrNoDevice,
+	kIOReturnBusy:            ErrBusy,
+	kIOReturnTimeout:         ErrTimeout,
+	kIOReturnNotAttached:     ErrNoDevice,
+	kIOReturnNotPermitted:    ErrPermissionDenied,
+	kIOReturnUnderrun:        ErrIO,
+	kIOReturnOverrun:         ErrOverflow,
+	kIOReturnAborted:         ErrInterrupted,
+	kIOReturnNotResponding:   ErrNoDevice,
+	kIOReturnNotFound:        ErrNotFound,
+	kIOUSBPipeStalled:        ErrPipeStalled,
+	kIOUSBTransactionTimeout: ErrTimeout,
+	kIOUSBEndpointNotFound:   ErrNotFound,
+	kIOUSBUnknownPipeErr:     ErrNotFound,
+}
+
+// IOReturnError is a failed IOKit call. It unwraps to the package error that
+// matches Code, so errors.Is(err, ErrTimeout) and friends work the same way
+// they do on the other platforms.
+type IOReturnError struct {
+	Op   string
+	Code int32
+}
+
+func (e *IOReturnError) Error() string {
+	return fmt.Sprintf("%s: %v (IOReturn 0x%08x)", e.Op, e.Unwrap(), uint32(e.Code))
+}
+
+// Unwrap returns the package error for the IOReturn code, or ErrOther for
+// codes without a counterpart
+func (e *IOReturnError) Unwrap() error {
+	if err, ok := ioReturnErrors[e.Code]; ok {
+		return err
+	}
+	return ErrOther
+}
+
+// ioReturnError wraps a failed IOReturn from the call described by op
+func ioReturnError(op string, ret C.int) error {
+	return &IOReturnError{Op: op, Code: int32(ret)}
+}
+
 // IOUSBDeviceInterface wraps the C IOUSBDeviceInterface320
 type IOUSBDeviceInterface struct {
 	ptr **C.IOUSBDeviceInterface320
@@ -357,7 +462,7 @@ func (i *IOUSBInterfaceInterface) Release() {
 func (d *IOUSBDeviceInterface) Open() error {
 	ret := C.OpenDevice(d.ptr)
 	if ret != kIOReturnSuccess {
-		return fmt.Errorf("failed to open device: 0x%x", ret)
+		return ioReturnError("failed to open device", ret)
 	}
 	return nil
 }
@@ -366,7 +471,7 @@ func (d *IOUSBDeviceInterface) Open() error {
 func (d *IOUSBDeviceInterface) Close() error {
 	ret := C.CloseDevice(d.ptr)
 	if ret != kIOReturnSuccess {
-		return fmt.Errorf("failed to close device: 0x%x", ret)
+		return ioReturnError("failed to close device", ret)
 	}
 	return nil
 }
@@ -375,7 +480,7 @@ func (d *IOUSBDeviceInterface) Close() error {
 func (d *IOUSBDeviceInterface) SetConfiguration(config uint8) error {
 	ret := C.SetConfiguration(d.ptr, C.UInt8(config))
 	if ret != kIOReturnSuccess {
-		return fmt.Errorf("failed to set configuration: 0x%x", ret)
+		return ioReturnError("failed to set configuration", ret)
 	}
 	return nil
 }
@@ -385,7 +490,7 @@ func (d *IOUSBDeviceInterface) GetConfiguration() (uint8, error) {
 	var config C.UInt8
 	ret := C.GetConfiguration(d.ptr, &config)
 	if ret != kIOReturnSuccess {
-		return 0, fmt.Errorf("failed to get configuration: 0x%x", ret)
+		return 0, ioReturnError("failed to get configuration", ret)
 	}
 	return uint8(config), nil
 }
@@ -400,7 +505,7 @@ func (d *IOUSBDeviceInterface) GetDeviceDescriptor() (*DeviceDescriptor, error)
 	var desc C.IOUSBDeviceDescriptor
 	ret := C.GetDeviceDescriptor(d.ptr, &desc)
 	if ret != kIOReturnSuccess {
-		return nil, fmt.Errorf("failed to get device descriptor: 0x%x", ret)
+		return nil, ioReturnError("failed to get device descriptor", ret)
 	}
 
 	return &DeviceDescriptor{
@@ -421,13 +526,15 @@ func (d *IOUSBDeviceInterface) GetDeviceDescriptor() (*DeviceDescriptor, error)
 	}, nil
 }
 
-// ControlTransfer performs a control transfer
+// ControlTransfer performs a control transfer and returns the length of its
+// data stage, which may be less than len(data)
 func (d *IOUSBDeviceInterface) ControlTransfer(bmRequestType, bRequest uint8, wValue, wIndex uint16, data []byte, timeout uint32) (int, error) {
 	var ptr unsafe.Pointer
 	if len(data) > 0 {
 		ptr = unsafe.Pointer(&data[0])
 	}
 
+	var lenDone C.UInt32
 	ret := C.ControlTransfer(d.ptr,
 		C.UInt8(bmRequestType),
 		C.UInt8(bRequest),
@@ -435,60 +542,37 @@ func (d *IOUSBDeviceInterface) ControlTransfer(bmRequestType, bRequest uint8, wV
 		C.UInt16(wIndex),
 		ptr,
 		C.UInt16(len(data)),
-		C.UInt32(timeout))
+		C.UInt32(timeout),
+		&lenDone)
 
 	if ret != kIOReturnSuccess {
-		return 0, fmt.Errorf("control transfer failed: 0x%x", ret)
+		return 0, ioReturnError("control transfer failed", ret)
 	}
 
-	return len(data), nil
+	// A device may end the data stage early, as with most descriptor reads
+	return int(lenDone), nil
 }
 
 // ResetDevice resets the USB device
 func (d *IOUSBDeviceInterface) ResetDevice() error {
 	ret := C.ResetDevice(d.ptr)
 	if ret != kIOReturnSuccess {
-		return fmt.Errorf("failed to reset device: 0x%x", ret)
+		return ioReturnError("failed to reset device", ret)
 	}
 	return nil
 }
 
 // GetStringDescriptor retrieves a string descriptor
-func (d *IOUSBDeviceInterface) GetStringDescriptor(index uint8, langID uint16) (string, error) {
-	buf := make([]byte, 256)
-	ret := C.GetStringDescriptor(d.ptr, C.UInt8(index), C.UInt16(langID),
-		unsafe.Pointer(&buf[0]), C.UInt16(len(buf)), C.UInt32(5000))
-
-	if ret != kIOReturnSuccess {
-		return "", fmt.Errorf("failed to get string descriptor: 0x%x", ret)
-	}
-
-	// Parse USB string descriptor format
-	if len(buf) < 2 {
-		return "", fmt.Errorf("invalid string descriptor")
-	}
-
-	length := int(buf[0])
-	if length < 2 || length > len(buf) {
-		return "", fmt.Errorf("invalid string descriptor length")
-	}
-
-	// USB strings are UTF-16LE, starting at byte 2
-	if length <= 2 {
-		return "", nil
-	}
-
-	// Convert UTF-16LE to string
-	strBytes := buf[2:length]
-	runes := make([]rune, 0, len(strBytes)/2)
-	for i := 0; i < len(strBytes)-1; i += 2 {
-		r := rune(strBytes[i]) | (rune(strBytes[i+1]) << 8)
-		if r != 0 {
-			runes = append(runes, r)
+func (d *IOUSBDeviceInterface) GetStringDescriptor(index uint8, langID uint16, timeout uint32) (string, error) {
+	return fetchStringDescriptor(func(buf []byte) (int, error) {
+		var lenDone C.UInt32
+		ret := C.GetStringDescriptor(d.ptr, C.UInt8(index), C.UInt16(langID),
+			unsafe.Pointer(&buf[0]), C.UInt16(len(buf)), C.UInt32(timeout), &lenDone)
+		if ret != kIOReturnSuccess {
+			return 0, ioReturnError("failed to get string descriptor", ret)
 		}
-	}
-
-	return string(runes), nil
+		return int(lenDone), nil
+	})
 }
 
 // Interface operations
@@ -497,7 +581,7 @@ func (d *IOUSBDeviceInterface) GetStringDescriptor(index uint8, langID uint16) (
 func (i *IOUSBInterfaceInterface) Open() error {
 	ret := C.OpenInterface(i.ptr)
 	if ret != kIOReturnSuccess {
-		return fmt.Errorf("failed to open interface: 0x%x", ret)
+		return ioReturnError("failed to open interface", ret)
 	}
 	return nil
 }
@@ -506,7 +590,7 @@ func (i *IOUSBInterfaceInterface) Open() error {
 func (i *IOUSBInterfaceInterface) Close() error {
 	ret := C.CloseInterface(i.ptr)
 	if ret != kIOReturnSuccess {
-		return fmt.Errorf("failed to close interface: 0x%x", ret)
+		return ioReturnError("failed to close interface", ret)
 	}
 	return nil
 }
@@ -515,16 +599,115 @@ func (i *IOUSBInterfaceInterface) Close() error {
 func (i *IOUSBInterfaceInterface) SetAlternateSetting(altSetting uint8) error {
 	ret := C.SetAlternateSetting(i.ptr, C.UInt8(altSetting))
 	if ret != kIOReturnSuccess {
-		return fmt.Errorf("failed to set alternate setting: 0x%x", ret)
+		return ioReturnError("failed to set alternate setting", ret)
 	}
 	return nil
 }
 
-// ClearPipeStall clears a stall condition on an endpoint
+// InterfaceNumber returns the bInterfaceNumber of the interface
+func (i *IOUSBInterfaceInterface) InterfaceNumber() (uint8, error) {
+	var number C.UInt8
+	ret := C.GetInterfaceNumber(i.ptr, &number)
+	if ret != kIOReturnSuccess {
+		return 0, ioReturnError("failed to get interface number", ret)
+	}
+	return uint8(number), nil
+}
+
+// AlternateSetting returns the current alternate setting of the interface
+func (i *IOUSBInterfaceInterface) AlternateSetting() (uint8, error) {
+	var alt C.UInt8
+	ret := C.GetAlternateSetting(i.ptr, &alt)
+	if ret != kIOReturnSuccess {
+		return 0, ioReturnError("failed to get alternate setting", ret)
+	}
+	return uint8(alt), nil
+}
+
+// NumEndpoints returns the number of endpoints, and so pipes, in the current
+// alternate setting
+func (i *IOUSBInterfaceInterface) NumEndpoints() (uint8, error) {
+	var num C.UInt8
+	ret := C.GetNumEndpoints(i.ptr, &num)
+	if ret != kIOReturnSuccess {
+		return 0, ioReturnError("failed to get number of endpoints", ret)
+	}
+	return uint8(num), nil
+}
+
+// PipeEndpoint returns the endpoint address and transfer type behind a pipe.
+// Pipe references start at 1; pipe 0 is the default control pipe.
+func (i *IOUSBInterfaceInterface) PipeEndpoint(pipeRef uint8) (uint8, TransferType, error) {
+	var direction, number, transferType, interval C.UInt8
+	var maxPacketSize C.UInt16
+	ret := C.GetPipeProperties(i.ptr, C.UInt8(pipeRef), &direction, &number, &transferType, &maxPacketSize, &interval)
+	if ret != kIOReturnSuccess {
+		return 0, 0, ioReturnError(fmt.Sprintf("failed to get pipe %d properties", pipeRef), ret)
+	}
+
+	addr := uint8(number) & 0x0F
+	if direction == C.kUSBIn {
+		addr |= 0x80
+	}
+	return addr, TransferType(transferType), nil
+}
+
+// FindInterface opens the IOKit interface object for the given interface
+// number in the active configuration
+func (d *IOUSBDeviceInterface) FindInterface(number uint8) (*IOUSBInterfaceInterface, error) {
+	iterator := C.CreateInterfaceIterator(d.ptr)
+	if iterator == 0 {
+		return nil, fmt.Errorf("failed to create interface iterator")
+	}
+	defer C.IOObjectRelease(C.io_object_t(iterator))
+
+	for {
+		service := C.IOIteratorNext(iterator)
+		if service == 0 {
+			break
+		}
+
+		intf, err := GetUSBInterfaceInterface(C.io_service_t(service))
+		C.IOObjectRelease(C.io_object_t(service))
+		if err != nil {
+			continue
+		}
+
+		if n, err := intf.InterfaceNumber(); err == nil && n == number {
+			return intf, nil
+		}
+		intf.Release()
+	}
+
+	return nil, fmt.Errorf("interface %d not found in the active configuration: %w", number, ErrNotFound)
+}
+
+// ClearPipeStall clears a stall condition and resets the data toggle of a
+// pipe on the host side only
 func (i *IOUSBInterfaceInterface) ClearPipeStall(pipeRef uint8) error {
 	ret := C.ClearPipeStall(i.ptr, C.UInt8(pipeRef))
 	if ret != kIOReturnSuccess {
-		return fmt.Errorf("failed to clear pipe stall: 0x%x", ret)
+		return ioReturnError("failed to clear pipe stall", ret)
+	}
+	return nil
+}
+
+// ClearPipeStallBothEnds clears a stall condition on the host and sends
+// CLEAR_FEATURE(ENDPOINT_HALT) so the device resets its side as well
+func (i *IOUSBInterfaceInterface) ClearPipeStallBothEnds(pipeRef uint8) error {
+	ret := C.ClearPipeStallBothEnds(i.ptr, C.UInt8(pipeRef))
+	if ret != kIOReturnSuccess {
+		return ioReturnError("failed to clear pipe stall", ret)
+	}
+	return nil
+}
+
+// AbortPipe aborts the transfers pending on a pipe. Async transfers complete
+// with kIOReturnAborted through the run loop.
+func (i *IOUSBInterfaceInterface) AbortPipe(pipeRef uint8) error {
+	ret := C.AbortPipe(i.ptr, C.UInt8(pipeRef))
+	if ret != kIOReturnSuccess {
+		return ioReturnError("failed to abort pipe", ret)
 	}
 	return nil
 }
@@ -535,13 +718,7 @@ func (i *IOUSBInterfaceInterface) BulkTransferOut(pipeRef uint8, data []byte, ti
 	ret := C.BulkTransfer(i.ptr, C.UInt8(pipeRef), unsafe.Pointer(&data[0]), &size, C.UInt32(timeout))
 
 	if ret != kIOReturnSuccess {
-		if int32(ret) == kIOUSBPipeStalled {
-			return int(size), fmt.Errorf("pipe stalled")
-		}
-		if int32(ret) == kIOUSBTransactionTimeout {
-			return int(size), ErrTimeout
-		}
-		return int(size), fmt.Errorf("bulk transfer failed: 0x%x", ret)
+		return int(size), ioReturnError("bulk transfer failed", ret)
 	}
 
 	return int(size), nil
@@ -553,13 +730,7 @@ func (i *IOUSBInterfaceInterface) BulkTransferIn(pipeRef uint8, data []byte, tim
 	ret := C.BulkTransferRead(i.ptr, C.UInt8(pipeRef), unsafe.Pointer(&data[0]), &size, C.UInt32(timeout))
 
 	if ret != kIOReturnSuccess {
-		if int32(ret) == kIOUSBPipeStalled {
-			return int(size), fmt.Errorf("pipe stalled")
-		}
-		if int32(ret) == kIOUSBTransactionTimeout {
-			return int(size), ErrTimeout
-		}
-		return int(size), fmt.Errorf("bulk transfer failed: 0x%x", ret)
+		return int(size), ioReturnError("bulk transfer failed", ret)
 	}
 
 	return int(size), nil
@@ -572,56 +743,79 @@ type AsyncTransferContext struct {
 	Status   int32
 	Callback func(result int32, bytesTransferred uint32)
 	cContext *C.AsyncTransferContext
+	in       bool
+	handle   cgo.Handle
 }
 
 // BulkTransferOutAsync performs an async bulk OUT transfer
 func (i *IOUSBInterfaceInterface) BulkTransferOutAsync(pipeRef uint8, data []byte, callback func(result int32, bytesTransferred uint32)) error {
+	return i.bulkTransferAsync(pipeRef, data, false, callback)
+}
+
+// BulkTransferInAsync performs an async bulk IN transfer
+func (i *IOUSBInterfaceInterface) BulkTransferInAsync(pipeRef uint8, data []byte, callback func(result int32, bytesTransferred uint32)) error {
+	return i.bulkTransferAsync(pipeRef, data, true, callback)
+}
+
+// bulkTransferAsync submits ReadPipeAsync or WritePipeAsync. IOKit uses the
+// buffer after the call returns, so the transfer goes through a copy in C
+// memory that complete copies back into data for an IN transfer.
+func (i *IOUSBInterfaceInterface) bulkTransferAsync(pipeRef uint8, data []byte, in bool, callback func(result int32, bytesTransferred uint32)) error {
 	ctx := &AsyncTransferContext{
 		Buffer:   data,
 		Size:     uint32(len(data)),
 		Callback: callback,
+		in:       in,
 	}
 
 	// Allocate C context
-	ctx.cContext = (*C.AsyncTransferContext)(C.malloc(C.sizeof_AsyncTransferContext))
-	ctx.cContext.buffer = unsafe.Pointer(&data[0])
+	ctx.cContext = (*C.AsyncTransferContext)(C.calloc(1, C.sizeof_AsyncTransferContext))
+	ctx.cContext.buffer = C.malloc(C.size_t(max(len(data), 1)))
 	ctx.cContext.size = C.UInt32(len(data))
-	ctx.cContext.userData = unsafe.Pointer(ctx)
-
-	ret := C.BulkTransferAsync(i.ptr, C.UInt8(pipeRef), unsafe.Pointer(&data[0]),
-		C.UInt32(len(data)), unsafe.Pointer(ctx.cContext))
+	if !in {
+		copy(unsafe.Slice((*byte)(ctx.cContext.buffer), len(data)), data)
+	}
+	ctx.handle = cgo.NewHandle(ctx)
+	ctx.cContext.userData = C.uintptr_t(ctx.handle)
+
+	var ret C.int
+	if in {
+		ret = C.BulkTransferReadAsync(i.ptr, C.UInt8(pipeRef), ctx.cContext.buffer,
+			C.UInt32(len(data)), unsafe.Pointer(ctx.cContext))
+	} else {
+		ret = C.BulkTransferAsync(i.ptr, C.UInt8(pipeRef), ctx.cContext.buffer,
+			C.UInt32(len(data)), unsafe.Pointer(ctx.cContext))
+	}
 
 	if ret != kIOReturnSuccess {
-		C.free(unsafe.Pointer(ctx.cContext))
-		return fmt.Errorf("async bulk transfer failed: 0x%x", ret)
+		ctx.free()
+		return ioReturnError("async bulk transfer failed", ret)
 	}
 
 	return nil
 }
 
-// BulkTransferInAsync performs an async bulk IN transfer
-func (i *IOUSBInterfaceInterface) BulkTransferInAsync(pipeRef uint8, data []byte, callback func(result int32, bytesTransferred uint32)) error {
-	ctx := &AsyncTransferContext{
-		Buffer:   data,
-		Size:     uint32(len(data)),
-		Callback: callback,
+// complete finishes a transfer IOKit reported done with result, having moved
+// bytesTransferred bytes, and calls its callback
+func (ctx *AsyncTransferContext) complete(result int32, bytesTransferred uint32) {
+	n := min(bytesTransferred, ctx.Size)
+	if ctx.in {
+		copy(ctx.Buffer[:n], unsafe.Slice((*byte)(ctx.cContext.buffer), n))
 	}
+	ctx.Status = result
+	ctx.free()
 
-	// Allocate C context
-	ctx.cContext = (*C.AsyncTransferContext)(C.malloc(C.sizeof_AsyncTransferContext))
-	ctx.cContext.buffer = unsafe.Pointer(&data[0])
-	ctx.cContext.size = C.UInt32(len(data))
-	ctx.cContext.userData = unsafe.Pointer(ctx)
-
-	ret := C.BulkTransferReadAsync(i.ptr, C.UInt8(pipeRef), unsafe.Pointer(&data[0]),
-		C.UInt32(len(data)), unsafe.Pointer(ctx.cContext))
-
-	if ret != kIOReturnSuccess {
-		C.free(unsafe.Pointer(ctx.cContext))
-		return fmt.Errorf("async bulk transfer failed: 0x%x", ret)
+	if ctx.Callback != nil {
+		ctx.Callback(result, n)
 	}
+}
 
-	return nil
+// free releases the C memory and the cgo.Handle of the transfer
+func (ctx *AsyncTransferContext) free() {
+	C.free(ctx.cContext.buffer)
+	C.free(unsafe.Pointer(ctx.cContext))
+	ctx.cContext = nil
+	ctx.handle.Delete()
 }
 
 // CreateAsyncEventSource creates a run loop source for async events
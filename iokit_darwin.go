@@ -57,6 +57,28 @@ char* GetStringProperty(io_service_t service, const char* key) {
     return buffer;
 }
 
+// Collect bInterfaceClass from the interface services below a device, which
+// IOKit publishes for the active configuration. Returns the number of classes
+// stored, or -1 if the children cannot be iterated.
+int GetInterfaceClasses(io_service_t device, UInt8 *classes, int max) {
+    io_iterator_t iter = 0;
+    if (IORegistryEntryGetChildIterator(device, kIOServicePlane, &iter) != KERN_SUCCESS) {
+        return -1;
+    }
+
+    int n = 0;
+    io_object_t child;
+    while ((child = IOIteratorNext(iter)) != 0) {
+        int class = GetIntProperty(child, "bInterfaceClass");
+        if (class >= 0 && n < max) {
+            classes[n++] = (UInt8)class;
+        }
+        IOObjectRelease(child);
+    }
+    IOObjectRelease(iter);
+    return n;
+}
+
 // Create iterator for USB devices
 io_iterator_t CreateUSBIterator() {
     io_iterator_t iterator = 0;
@@ -150,6 +172,10 @@ type IOKitDevice struct {
 	ProductID  uint16
 	Bus        uint8
 	Address    uint8
+
+	// InterfaceClasses holds bInterfaceClass of each interface service
+	// registered below the device at enumeration
+	InterfaceClasses []uint8
 }
 
 // IOKitEnumerator handles USB device enumeration via IOKit
@@ -162,21 +188,29 @@ func NewIOKitEnumerator() *IOKitEnumerator {
 
 // EnumerateDevices returns all USB devices found via IOKit
 func (e *IOKitEnumerator) EnumerateDevices() ([]*Device, error) {
+	devices, _, err := e.enumerate()
+	return devices, err
+}
+
+// enumerate returns every device whose descriptor could be read along with
+// the errors for the services that had to be skipped.
+func (e *IOKitEnumerator) enumerate() ([]*Device, []error, error) {
 	iterator := C.CreateUSBIterator()
 	if iterator == 0 {
 		// No USB devices found or unable to create iterator
 		// This is common on Apple Silicon Macs with no USB devices connected
-		return []*Device{}, nil
+		return []*Device{}, nil, nil
 	}
 	defer C.ReleaseIterator(iterator)
 
 	var devices []*Device
+	var errs []error
 
 	// Check if iterator is valid but empty
 	firstDevice := C.GetNextUSBDevice(iterator)
 	if firstDevice == 0 {
 		// No USB devices found - common on systems with no USB devices
-		return devices, nil
+		return devices, nil, nil
 	}
 
 	// Process all devices
@@ -196,6 +230,7 @@ func (e *IOKitEnumerator) EnumerateDevices() ([]*Device, error) {
 		// Get device interface to retrieve descriptor
 		devInterface, err := GetUSBDeviceInterface(device)
 		if err != nil {
+			errs = append(errs, fmt.Errorf("iokit:%08x: %w", locationID, err))
 			return
 		}
 		defer devInterface.Release()
@@ -203,6 +238,7 @@ func (e *IOKitEnumerator) EnumerateDevices() ([]*Device, error) {
 		// Get device descriptor
 		descriptor, err := devInterface.GetDeviceDescriptor()
 		if err != nil {
+			errs = append(errs, fmt.Errorf("iokit:%08x: %w", locationID, err))
 			return
 		}
 
@@ -216,6 +252,15 @@ func (e *IOKitEnumerator) EnumerateDevices() ([]*Device, error) {
 		product := C.GoString(C.GetStringProperty(device, C.CString("USB Product Name")))
 		serial := C.GoString(C.GetStringProperty(device, C.CString("USB Serial Number")))
 
+		var classes [32]C.UInt8
+		var interfaceClasses []uint8
+		if n := int(C.GetInterfaceClasses(device, &classes[0], C.int(len(classes)))); n > 0 {
+			interfaceClasses = make([]uint8, n)
+			for i := range interfaceClasses {
+				interfaceClasses[i] = uint8(classes[i])
+			}
+		}
+
 		usbDev := &Device{
 			Path:       fmt.Sprintf("iokit:%08x", locationID),
 			Bus:        bus,
@@ -228,6 +273,8 @@ func (e *IOKitEnumerator) EnumerateDevices() ([]*Device, error) {
 				ProductID:  uint16(productID),
 				Bus:        bus,
 				Address:    address,
+
+				InterfaceClasses: interfaceClasses,
 			},
 			CachedStrings: &CachedStrings{
 				Manufacturer: manufacturer,
@@ -247,7 +294,7 @@ func (e *IOKitEnumerator) EnumerateDevices() ([]*Device, error) {
 		processDevice(usbDevice)
 	}
 
-	return devices, nil
+	return devices, errs, nil
 }
 
 // Device represents a USB device on macOS
@@ -258,6 +305,43 @@ type Device struct {
 	Descriptor    DeviceDescriptor
 	IOKitDevice   *IOKitDevice
 	CachedStrings *CachedStrings
+
+	// Topology of the device. It is not read from the IORegistry yet, so
+	// Parent is always nil.
+	Parent   *Device
+	Port     uint8
+	Children []*Device
+
+	backend Backend // Backend the device was listed from, if any
+}
+
+// PortPath returns the chain of hub ports the device is plugged into, decoded
+// from its IOKit locationID: the top byte is the bus and each following
+// nibble a port, so 0x14120000 is "20-1.2". It stays the same across
+// re-enumeration and reboots as long as the device is plugged into the same
+// port.
+func (d *Device) PortPath() (string, error) {
+	if d.IOKitDevice == nil {
+		return "", ErrNotFound
+	}
+	return locationPortPath(d.IOKitDevice.LocationID), nil
+}
+
+// locationPortPath formats a locationID like the port paths of Linux
+func locationPortPath(locationID uint32) string {
+	var ports []string
+	for shift := 20; shift >= 0; shift -= 4 {
+		port := (locationID >> shift) & 0xf
+		if port == 0 {
+			break
+		}
+		ports = append(ports, strconv.Itoa(int(port)))
+	}
+	bus := locationID >> 24
+	if len(ports) == 0 {
+		return fmt.Sprintf("usb%d", bus)
+	}
+	return fmt.Sprintf("%d-%s", bus, strings.Join(ports, "."))
 }
 
 // CachedStrings holds cached string descriptors
@@ -273,6 +357,7 @@ type DeviceListOption func(*deviceListOptions)
 // deviceListOptions holds the configuration for DeviceList.
 type deviceListOptions struct {
 	includeInaccessible bool
+	excludeRootHubs     bool
 }
 
 // WithInaccessibleDevices returns an option that includes devices that cannot
@@ -286,23 +371,41 @@ func WithInaccessibleDevices() DeviceListOption {
 
 // DeviceList returns a list of USB devices on macOS.
 //
-// The opts parameter accepts functional options for API compatibility with
-// other platforms. On macOS, options like WithInaccessibleDevices() have no
-// effect since all devices are accessible via IOKit.
+// The opts parameter accepts functional options. WithInaccessibleDevices() is
+// accepted for API compatibility with other platforms and has no effect on
+// macOS, since all devices are accessible via IOKit.
 func DeviceList(opts ...DeviceListOption) ([]*Device, error) {
-	// Apply options (for API compatibility, though they have no effect on macOS)
+	devices, _, err := deviceList(opts...)
+	return devices, err
+}
+
+// deviceList enumerates devices via IOKit, returning the devices that could be
+// read along with the errors for the ones that were skipped.
+func deviceList(opts ...DeviceListOption) ([]*Device, []error, error) {
 	options := &deviceListOptions{}
 	for _, opt := range opts {
 		opt(options)
 	}
-	_ = options // unused on macOS
+	if b := currentBackend(); b != nil {
+		return backendDeviceList(b, options)
+	}
 
-	enumerator := NewIOKitEnumerator()
-	return enumerator.EnumerateDevices()
+	devices, errs, err := NewIOKitEnumerator().enumerate()
+	if err != nil {
+		return nil, nil, err
+	}
+	if options.excludeRootHubs {
+		devices = withoutRootHubs(devices)
+	}
+	return devices, errs, nil
 }
 
 // Open opens the USB device for communication
-func (d *Device) Open() (*DeviceHandle, error) {
+func (d *Device) Open(opts ...OpenOption) (*DeviceHandle, error) {
+	if d.backend != nil {
+		return d.openBackend(opts)
+	}
+
 	// Re-acquire the device service
 	iterator := C.CreateUSBIterator()
 	if iterator == 0 {
@@ -344,13 +447,31 @@ func (d *Device) Open() (*DeviceHandle, error) {
 		return nil, err
 	}
 
-	return &DeviceHandle{
+	h := &DeviceHandle{
 		device:        d,
 		devInterface:  devInterface,
 		service:       usbDevice,
 		interfaces:    make(map[uint8]*IOUSBInterfaceInterface),
 		claimedIfaces: make(map[uint8]bool),
-	}, nil
+		refs:          newHandleRefs(),
+	}
+
+	if err := h.applyOpenQuirks(); err != nil {
+		h.Close()
+		return nil, err
+	}
+	if err := h.applyOpenOptions(opts); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// OpenReadOnly is not supported on macOS. Opening an IOKit device does not
+// need write access to a node, so Open can be used for inspection instead.
+func (d *Device) OpenReadOnly() (*DeviceHandle, error) {
+	return nil, ErrNotSupported
 }
 
 // OpenDevice opens a device by vendor and product ID
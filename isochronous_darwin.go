@@ -60,6 +60,7 @@ import "C"
 import (
 	"fmt"
 	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -80,6 +81,8 @@ type IsochronousTransfer struct {
 	mutex          sync.Mutex
 	packetLengths  []int
 	packetStatuses []int
+	startFrame     uint64
+	completedAt    time.Time
 }
 
 // NewIsochronousTransfer creates a new isochronous transfer
@@ -122,14 +125,28 @@ func (t *IsochronousTransfer) GetUserData() interface{} {
 	return t.userData
 }
 
-// SetPacketLength sets the length for a specific packet
-func (t *IsochronousTransfer) SetPacketLength(packet int, length int) error {
+// SetPacketLength sets the length for a specific packet. The lengths of all
+// packets together must fit in the transfer buffer.
+func (t *IsochronousTransfer) SetPacketLength(packet int, length uint32) error {
 	if packet < 0 || packet >= t.numPackets {
 		return fmt.Errorf("packet index %d out of range", packet)
 	}
+	if length > 0xffff {
+		return fmt.Errorf("packet length %d too large", length)
+	}
+
+	total := uint64(length)
+	for i := range t.frameList {
+		if i != packet {
+			total += uint64(t.frameList[i].frReqCount)
+		}
+	}
+	if total > uint64(len(t.buffer)) {
+		return fmt.Errorf("packet lengths total %d bytes, exceeding the %d byte buffer", total, len(t.buffer))
+	}
 
 	t.frameList[packet].frReqCount = C.UInt16(length)
-	t.packetLengths[packet] = length
+	t.packetLengths[packet] = int(length)
 	return nil
 }
 
@@ -182,11 +199,12 @@ func (t *IsochronousTransfer) Submit() error {
 	var atTime C.AbsoluteTime
 	ret := C.GetBusFrameNumber(intf.ptr, &frameNumber, &atTime)
 	if ret != kIOReturnSuccess {
-		return fmt.Errorf("failed to get bus frame number: 0x%x", ret)
+		return ioReturnError("failed to get bus frame number", ret)
 	}
 
 	// Start a few frames in the future
 	startFrame := frameNumber + 10
+	t.startFrame = uint64(startFrame)
 
 	pipeRef := t.endpoint & 0x0F
 
@@ -210,7 +228,7 @@ func (t *IsochronousTransfer) Submit() error {
 	}
 
 	if ret != kIOReturnSuccess {
-		return fmt.Errorf("isochronous transfer failed: 0x%x", ret)
+		return ioReturnError("isochronous transfer failed", ret)
 	}
 
 	t.submitted = true
@@ -221,8 +239,35 @@ func (t *IsochronousTransfer) Submit() error {
 	return nil
 }
 
+// Resubmit re-arms a completed transfer and submits it again, reusing its
+// buffer and frame list. Packet lengths are kept, while the actual lengths
+// and statuses of the previous completion are cleared. It fails if the
+// transfer was never submitted or has not completed.
+func (t *IsochronousTransfer) Resubmit() error {
+	t.mutex.Lock()
+	if !t.submitted || !t.completed {
+		t.mutex.Unlock()
+		return fmt.Errorf("transfer has not completed")
+	}
+
+	for i := range t.frameList {
+		t.frameList[i].frStatus = C.kIOReturnSuccess
+		t.frameList[i].frActCount = 0
+		t.packetLengths[i] = 0
+		t.packetStatuses[i] = 0
+	}
+	t.actualLength = 0
+	t.status = TransferError
+	t.submitted = false
+	t.completed = false
+	t.mutex.Unlock()
+
+	return t.Submit()
+}
+
 // processCompletion processes the completion of the transfer
 func (t *IsochronousTransfer) processCompletion() {
+	t.completedAt = time.Now()
 	t.actualLength = 0
 	allSuccess := true
 
@@ -302,6 +347,40 @@ func (t *IsochronousTransfer) GetPacketStatus(packet int) (int, error) {
 	return t.packetStatuses[packet], nil
 }
 
+// PacketErrors returns the packets of the completed transfer that did not
+// succeed. A transfer can complete while some of its packets failed.
+func (t *IsochronousTransfer) PacketErrors() []PacketError {
+	var errs []PacketError
+	for i, status := range t.packetStatuses {
+		if status != int(C.kIOReturnSuccess) {
+			errs = append(errs, PacketError{Index: i, Status: int32(status), Err: isocFrameError(status)})
+		}
+	}
+	return errs
+}
+
+// isocFrameError maps an IOKit isochronous frame status onto the package
+// errors. Frame failures without a closer match are reported as ErrIO.
+func isocFrameError(status int) error {
+	if err, ok := ioReturnErrors[int32(status)]; ok {
+		return err
+	}
+	return ErrIO
+}
+
+// CompletedAt returns the host time at which the transfer completed. The time
+// carries a monotonic clock reading, so differences between transfers are not
+// affected by wall clock changes.
+func (t *IsochronousTransfer) CompletedAt() time.Time {
+	return t.completedAt
+}
+
+// StartFrame returns the bus frame number the transfer was scheduled to
+// start at
+func (t *IsochronousTransfer) StartFrame() int32 {
+	return int32(t.startFrame)
+}
+
 // GetPacketActualLength returns the actual length transferred for a packet
 func (t *IsochronousTransfer) GetPacketActualLength(packet int) (int, error) {
 	if packet < 0 || packet >= t.numPackets {
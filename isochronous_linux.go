@@ -1,9 +1,11 @@
 package usb
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -25,6 +27,10 @@ const (
 	USBDEVFS_URB_NO_INTERRUPT      = 0x80
 )
 
+// errNotSubmitted is returned by IsochronousTransfer.Cancel for a transfer
+// that is not in flight
+var errNotSubmitted = errors.New("transfer not submitted")
+
 // MAX_BULK_BUFFER_LENGTH matches libusb's limit to avoid kernel memory issues on Android
 const MAX_BULK_BUFFER_LENGTH = 16384
 
@@ -45,7 +51,7 @@ type URB struct {
 	BufferLength int32
 	ActualLength int32
 	StartFrame   int32
-	// Union field: either NumberOfPackets or StreamID
+	// Union field: either NumberOfPackets or StreamID, see SetStreamID
 	NumberOfPackets int32 // For isochronous transfers
 	ErrorCount      int32
 	SignalNumber    uint32
@@ -53,6 +59,12 @@ type URB struct {
 	// Iso packet descriptors follow the main struct
 }
 
+// SetStreamID sets the stream of a bulk URB, which the kernel keeps in the
+// same union as the number of isochronous packets
+func (u *URB) SetStreamID(streamID uint32) {
+	u.NumberOfPackets = int32(streamID)
+}
+
 // IsochronousTransfer represents a complete isochronous transfer
 type IsochronousTransfer struct {
 	handle     *DeviceHandle
@@ -66,9 +78,10 @@ type IsochronousTransfer struct {
 	submitted  bool
 
 	// Auto-reaping support
-	reapErr  error
-	reaped   bool
-	reapCond *sync.Cond
+	reapErr     error
+	reaped      bool
+	reapCond    *sync.Cond
+	completedAt time.Time // When the reaper picked up the URB
 }
 
 // NewIsochronousTransfer creates a new isochronous transfer
@@ -105,9 +118,8 @@ func (h *DeviceHandle) NewIsochronousTransfer(endpoint uint8, numPackets int, pa
 	urb.StartFrame = -1 // Let kernel choose start frame
 
 	// Copy packet descriptors after URB struct
-	isoPackets := (*[1 << 16]IsoPacketDescriptor)(unsafe.Pointer(
-		uintptr(unsafe.Pointer(&urbBuffer[0])) + unsafe.Sizeof(URB{})))
-	copy(isoPackets[:len(packets)], packets)
+	isoPackets := unsafe.Slice((*IsoPacketDescriptor)(unsafe.Add(unsafe.Pointer(&urbBuffer[0]), unsafe.Sizeof(URB{}))), numPackets)
+	copy(isoPackets, packets)
 
 	return &IsochronousTransfer{
 		handle:     h,
@@ -122,6 +134,33 @@ func (h *DeviceHandle) NewIsochronousTransfer(endpoint uint8, numPackets int, pa
 	}, nil
 }
 
+// SetPacketLength sets how many bytes packet i transfers. Packets start out
+// at the packet size given to NewIsochronousTransfer, which suits IN
+// transfers; OUT transfers set the length of each frame before Submit. Packet
+// data is laid out back to back in Buffer, so the lengths of all packets
+// together must fit in the buffer.
+func (t *IsochronousTransfer) SetPacketLength(i int, n uint32) error {
+	if t.submitted {
+		return fmt.Errorf("transfer already submitted")
+	}
+	if i < 0 || i >= len(t.packets) {
+		return fmt.Errorf("packet index %d out of range [0, %d)", i, len(t.packets))
+	}
+
+	total := uint64(n)
+	for j := range t.packets {
+		if j != i {
+			total += uint64(t.packets[j].Length)
+		}
+	}
+	if total > uint64(len(t.buffer)) {
+		return fmt.Errorf("packet lengths total %d bytes, exceeding the %d byte buffer", total, len(t.buffer))
+	}
+
+	t.packets[i].Length = n
+	return nil
+}
+
 // Submit submits the isochronous transfer to the kernel
 func (t *IsochronousTransfer) Submit() error {
 	if t.submitted {
@@ -141,41 +180,31 @@ func (t *IsochronousTransfer) Submit() error {
 	t.urb.ErrorCount = 0
 
 	// Reset packet descriptors
-	isoPackets := (*[1 << 16]IsoPacketDescriptor)(unsafe.Pointer(
-		uintptr(unsafe.Pointer(t.urb)) + unsafe.Sizeof(URB{})))
+	isoPackets := unsafe.Slice((*IsoPacketDescriptor)(unsafe.Add(unsafe.Pointer(t.urb), unsafe.Sizeof(URB{}))), t.numPackets)
 	for i := 0; i < t.numPackets; i++ {
 		isoPackets[i].ActualLength = 0
 		isoPackets[i].Status = 0
-		isoPackets[i].Length = uint32(t.packetSize)
-	}
-
-	// Submit URB to kernel
-	_, _, errno := syscall.Syscall(
-		syscall.SYS_IOCTL,
-		uintptr(t.handle.fd),
-		USBDEVFS_SUBMITURB,
-		uintptr(unsafe.Pointer(t.urb)),
-	)
-
-	if errno != 0 {
-		return fmt.Errorf("failed to submit URB: %v", errno)
+		isoPackets[i].Length = t.packets[i].Length
 	}
 
+	t.reapCond.L.Lock()
 	t.submitted = true
 	t.reaped = false
+	t.reapCond.L.Unlock()
 
-	// Register with centralized reaper
-	t.handle.registerURBCompletion(uintptr(unsafe.Pointer(t.urb)), func(err error) {
+	// Submit URB to kernel through the centralized reaper
+	err := t.handle.submitURB(t.urb, func(err error) {
 		// Process URB completion
+		completedAt := time.Now()
 		t.reapCond.L.Lock()
 		defer t.reapCond.L.Unlock()
 
 		t.reapErr = err
+		t.completedAt = completedAt
 
 		if err == nil {
 			// Update packet descriptors from kernel data
-			isoPackets := (*[1 << 16]IsoPacketDescriptor)(unsafe.Pointer(
-				uintptr(unsafe.Pointer(t.urb)) + unsafe.Sizeof(URB{})))
+			isoPackets := unsafe.Slice((*IsoPacketDescriptor)(unsafe.Add(unsafe.Pointer(t.urb), unsafe.Sizeof(URB{}))), t.numPackets)
 
 			for i := 0; i < t.numPackets; i++ {
 				t.packets[i] = isoPackets[i]
@@ -193,14 +222,47 @@ func (t *IsochronousTransfer) Submit() error {
 		t.reaped = true
 		t.reapCond.Broadcast()
 	})
+	if err != nil {
+		t.reapCond.L.Lock()
+		t.submitted = false
+		t.reaped = true
+		t.reapErr = err
+		t.reapCond.L.Unlock()
+		return fmt.Errorf("failed to submit URB: %v", err)
+	}
 
 	return nil
 }
 
+// Resubmit re-arms a completed transfer and submits it again, reusing its
+// buffer and URB. Packet lengths are kept, while the actual lengths and
+// statuses of the previous completion are cleared. It fails if the transfer
+// was never submitted or is still in flight.
+func (t *IsochronousTransfer) Resubmit() error {
+	t.reapCond.L.Lock()
+	completed := t.reaped && !t.submitted
+	if completed {
+		for i := range t.packets {
+			t.packets[i].ActualLength = 0
+			t.packets[i].Status = 0
+		}
+		t.reapErr = nil
+	}
+	t.reapCond.L.Unlock()
+
+	if !completed {
+		return fmt.Errorf("transfer has not completed")
+	}
+	return t.Submit()
+}
+
 // Cancel cancels a submitted transfer
 func (t *IsochronousTransfer) Cancel() error {
-	if !t.submitted {
-		return fmt.Errorf("transfer not submitted")
+	t.reapCond.L.Lock()
+	submitted := t.submitted
+	t.reapCond.L.Unlock()
+	if !submitted {
+		return errNotSubmitted
 	}
 
 	t.handle.mu.RLock()
@@ -211,15 +273,8 @@ func (t *IsochronousTransfer) Cancel() error {
 	}
 
 	// Discard the URB
-	_, _, errno := syscall.Syscall(
-		syscall.SYS_IOCTL,
-		uintptr(t.handle.fd),
-		USBDEVFS_DISCARDURB,
-		uintptr(unsafe.Pointer(t.urb)),
-	)
-
-	if errno != 0 && errno != syscall.EINVAL {
-		return fmt.Errorf("failed to cancel URB: %v", errno)
+	if err := t.handle.discardURB(t.urb); err != nil && err != syscall.EINVAL {
+		return fmt.Errorf("failed to cancel URB: %v", err)
 	}
 
 	return nil
@@ -265,6 +320,59 @@ func (t *IsochronousTransfer) Status() int32 {
 	return t.urb.Status
 }
 
+// CompletedAt returns the host time at which the completed transfer was
+// reaped. The time carries a monotonic clock reading, so differences between
+// transfers are not affected by wall clock changes.
+func (t *IsochronousTransfer) CompletedAt() time.Time {
+	t.waitForReaping()
+	return t.completedAt
+}
+
+// StartFrame returns the bus frame number, in microframes for high-speed and
+// faster devices, at which the kernel scheduled the completed transfer
+func (t *IsochronousTransfer) StartFrame() int32 {
+	t.waitForReaping()
+	return t.urb.StartFrame
+}
+
+// PacketErrors returns the packets of the completed transfer that did not
+// succeed. A transfer can complete while some of its packets failed, so
+// streaming callers should check this rather than Status alone.
+func (t *IsochronousTransfer) PacketErrors() []PacketError {
+	t.waitForReaping()
+
+	var errs []PacketError
+	for i, pkt := range t.packets {
+		if pkt.Status != 0 {
+			errs = append(errs, PacketError{Index: i, Status: pkt.Status, Err: urbStatusError(pkt.Status)})
+		}
+	}
+	return errs
+}
+
+// urbStatusError maps a URB or iso packet status, a negative errno set by the
+// kernel, onto the package errors
+func urbStatusError(status int32) error {
+	switch errno := syscall.Errno(-status); errno {
+	case 0:
+		return nil
+	case syscall.ETIMEDOUT, syscall.ETIME:
+		return ErrTimeout
+	case syscall.EPIPE:
+		return ErrPipeStalled
+	case syscall.EOVERFLOW:
+		return ErrBabble
+	case syscall.ENODEV, syscall.ESHUTDOWN:
+		return ErrNoDevice
+	case syscall.ENOENT, syscall.ECONNRESET:
+		return ErrInterrupted
+	case syscall.EXDEV, syscall.EPROTO, syscall.EILSEQ, syscall.ENOSR, syscall.ECOMM:
+		return ErrIO
+	default:
+		return errno
+	}
+}
+
 // IsoPacketBuffer returns the data buffer for a specific isochronous packet.
 // Similar to libusb's libusb_get_iso_packet_buffer function.
 // The offset is calculated using the Length field (allocated size), but only
@@ -396,24 +504,12 @@ func (t *AsyncBulkTransfer) Submit() error {
 	t.urb.Status = 0
 	t.urb.ActualLength = 0
 
-	// Submit URB to kernel
-	_, _, errno := syscall.Syscall(
-		syscall.SYS_IOCTL,
-		uintptr(t.handle.fd),
-		USBDEVFS_SUBMITURB,
-		uintptr(unsafe.Pointer(t.urb)),
-	)
-
-	if errno != 0 {
-		return fmt.Errorf("failed to submit bulk URB: %v", errno)
-	}
-
 	t.reapCond.L.Lock()
 	t.reaped = false
 	t.reapCond.L.Unlock()
 
-	// Register with centralized reaper
-	t.handle.registerURBCompletion(uintptr(unsafe.Pointer(t.urb)), func(err error) {
+	// Submit URB to kernel through the centralized reaper
+	err := t.handle.submitURB(t.urb, func(err error) {
 		t.reapCond.L.Lock()
 		defer t.reapCond.L.Unlock()
 
@@ -421,6 +517,13 @@ func (t *AsyncBulkTransfer) Submit() error {
 		t.reaped = true
 		t.reapCond.Broadcast()
 	})
+	if err != nil {
+		t.reapCond.L.Lock()
+		t.reapErr = err
+		t.reaped = true
+		t.reapCond.L.Unlock()
+		return fmt.Errorf("failed to submit bulk URB: %v", err)
+	}
 
 	return nil
 }
@@ -453,15 +556,8 @@ func (t *AsyncBulkTransfer) Cancel() error {
 		return ErrDeviceNotFound
 	}
 
-	_, _, errno := syscall.Syscall(
-		syscall.SYS_IOCTL,
-		uintptr(t.handle.fd),
-		USBDEVFS_DISCARDURB,
-		uintptr(unsafe.Pointer(t.urb)),
-	)
-
-	if errno != 0 && errno != syscall.EINVAL {
-		return fmt.Errorf("failed to cancel URB: %v", errno)
+	if err := t.handle.discardURB(t.urb); err != nil && err != syscall.EINVAL {
+		return fmt.Errorf("failed to cancel URB: %v", err)
 	}
 
 	return nil
@@ -29,11 +29,21 @@ func (h *DeviceHandle) NewIsochronousTransfer(endpoint uint8, numPackets int, pa
 	return nil, fmt.Errorf("isochronous transfers are not supported on Windows through WinUSB")
 }
 
+// SetPacketLength sets how many bytes a packet transfers.
+func (t *IsochronousTransfer) SetPacketLength(i int, n uint32) error {
+	return fmt.Errorf("isochronous transfers are not supported on Windows")
+}
+
 // Submit submits the isochronous transfer.
 func (t *IsochronousTransfer) Submit() error {
 	return fmt.Errorf("isochronous transfers are not supported on Windows")
 }
 
+// Resubmit re-arms a completed transfer and submits it again.
+func (t *IsochronousTransfer) Resubmit() error {
+	return fmt.Errorf("isochronous transfers are not supported on Windows")
+}
+
 // Wait waits for the isochronous transfer to complete.
 func (t *IsochronousTransfer) Wait() error {
 	return fmt.Errorf("isochronous transfers are not supported on Windows")
@@ -49,6 +59,21 @@ func (t *IsochronousTransfer) Packets() []IsoPacket {
 	return nil
 }
 
+// PacketErrors returns the packets that did not succeed.
+func (t *IsochronousTransfer) PacketErrors() []PacketError {
+	return nil
+}
+
+// CompletedAt returns the host time at which the transfer completed.
+func (t *IsochronousTransfer) CompletedAt() time.Time {
+	return time.Time{}
+}
+
+// StartFrame returns the bus frame number the transfer started at.
+func (t *IsochronousTransfer) StartFrame() int32 {
+	return 0
+}
+
 // IsoPacketBuffer returns the buffer for a specific packet.
 func (t *IsochronousTransfer) IsoPacketBuffer(index int) ([]byte, error) {
 	return nil, fmt.Errorf("isochronous transfers are not supported on Windows")
@@ -207,3 +232,26 @@ func (t *AsyncBulkTransfer) Close() error {
 	t.cond.Broadcast()
 	return nil
 }
+
+// SubmitControl performs a control transfer without blocking the caller.
+// On Windows, this runs the transfer on a separate goroutine, bounded by the
+// handle's default timeout (see SetDefaultTimeout), and calls cb with the
+// number of data bytes transferred once it completes.
+func (h *DeviceHandle) SubmitControl(setup ControlSetup, data []byte, cb func(int, error)) error {
+	h.mu.RLock()
+	closed := h.closed
+	h.mu.RUnlock()
+
+	if closed {
+		return ErrDeviceNotFound
+	}
+
+	go func() {
+		n, err := h.ControlTransfer(setup.RequestType, setup.Request, setup.Value, setup.Index, data, 0)
+		if cb != nil {
+			cb(n, err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package usb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// IsoRing keeps a set of isochronous transfers on one endpoint cycling: each
+// transfer is handed to the handler when it completes and then resubmitted,
+// so the endpoint always has transfers queued. Transfers can be removed from
+// a running ring with Cancel and added with Add, for example to swap in
+// transfers of a different packet size around an alternate setting change,
+// while the others keep streaming.
+type IsoRing struct {
+	handler func(t *IsochronousTransfer, err error)
+
+	mu        sync.Mutex
+	transfers []*IsochronousTransfer
+	started   bool
+	stopped   bool
+	wg        sync.WaitGroup
+}
+
+// NewIsoRing creates a ring of numTransfers isochronous transfers on
+// endpoint with numPackets packets of packetSize bytes each. handler is
+// called from a goroutine of the transfer with each completed transfer and
+// the error it completed with; the transfer is resubmitted when handler
+// returns, so handler must be done with its buffer by then. Handlers of
+// different transfers can run concurrently.
+func (h *DeviceHandle) NewIsoRing(endpoint uint8, numTransfers, numPackets, packetSize int, handler func(t *IsochronousTransfer, err error)) (*IsoRing, error) {
+	if numTransfers <= 0 || numPackets <= 0 || packetSize <= 0 || handler == nil {
+		return nil, ErrInvalidParameter
+	}
+
+	r := &IsoRing{handler: handler}
+	for i := 0; i < numTransfers; i++ {
+		t, err := h.NewIsochronousTransfer(endpoint, numPackets, packetSize)
+		if err != nil {
+			return nil, err
+		}
+		r.transfers = append(r.transfers, t)
+	}
+	return r, nil
+}
+
+// Start submits every transfer of the ring. If a submission fails, the
+// transfers already submitted are cancelled and the error is returned.
+func (r *IsoRing) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started {
+		return fmt.Errorf("iso ring already started")
+	}
+	for i, t := range r.transfers {
+		if err := t.Submit(); err != nil {
+			for _, submitted := range r.transfers[:i] {
+				submitted.Cancel()
+				submitted.waitForReaping()
+			}
+			return err
+		}
+	}
+	r.started = true
+	for _, t := range r.transfers {
+		r.run(t)
+	}
+	return nil
+}
+
+// Add submits t and makes it part of the ring. t must not be in flight or
+// part of another ring.
+func (r *IsoRing) Add(t *IsochronousTransfer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return fmt.Errorf("iso ring stopped")
+	}
+	if r.index(t) >= 0 {
+		return fmt.Errorf("transfer already in the ring: %w", ErrInvalidParameter)
+	}
+	if r.started {
+		if err := t.Submit(); err != nil {
+			return err
+		}
+		r.run(t)
+	}
+	r.transfers = append(r.transfers, t)
+	return nil
+}
+
+// Cancel discards t and removes it from the ring; the other transfers keep
+// cycling. When Cancel returns the URB of t is no longer in flight, although
+// a handler call for its last completion may still be running. Cancel can be
+// called from a handler, including the handler of t. An error discarding the
+// URB is returned, with t removed from the ring regardless.
+func (r *IsoRing) Cancel(t *IsochronousTransfer) error {
+	r.mu.Lock()
+	i := r.index(t)
+	if i < 0 {
+		r.mu.Unlock()
+		return fmt.Errorf("transfer not in the ring: %w", ErrNotFound)
+	}
+	r.transfers = append(r.transfers[:i], r.transfers[i+1:]...)
+	started := r.started
+	var err error
+	if started {
+		// Holding r.mu keeps the goroutine of t from resubmitting it
+		// between the check and the discard
+		err = discardRingTransfer(t)
+	}
+	r.mu.Unlock()
+
+	if started {
+		t.waitForReaping()
+	}
+	return err
+}
+
+// Stop discards every transfer of the ring and waits until none is in
+// flight and every handler has returned. It must not be called from a
+// handler. The errors discarding the URBs are returned joined.
+func (r *IsoRing) Stop() error {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return nil
+	}
+	r.stopped = true
+	var errs []error
+	if r.started {
+		for _, t := range r.transfers {
+			if err := discardRingTransfer(t); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return errors.Join(errs...)
+}
+
+// discardRingTransfer cancels t. A transfer that is between completion and
+// resubmission, with its handler running, has nothing to discard.
+func discardRingTransfer(t *IsochronousTransfer) error {
+	if err := t.Cancel(); err != nil && !errors.Is(err, errNotSubmitted) {
+		return err
+	}
+	return nil
+}
+
+// Transfers returns the transfers currently in the ring
+func (r *IsoRing) Transfers() []*IsochronousTransfer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*IsochronousTransfer(nil), r.transfers...)
+}
+
+// index returns the position of t in the ring, or -1. The caller must hold
+// r.mu.
+func (r *IsoRing) index(t *IsochronousTransfer) int {
+	for i, member := range r.transfers {
+		if member == t {
+			return i
+		}
+	}
+	return -1
+}
+
+// active reports whether t should keep cycling. The caller must hold r.mu.
+func (r *IsoRing) active(t *IsochronousTransfer) bool {
+	return !r.stopped && r.index(t) >= 0
+}
+
+// run starts the goroutine that hands the completions of the submitted t to
+// the handler and resubmits it for as long as it is part of the ring. The
+// caller must hold r.mu.
+func (r *IsoRing) run(t *IsochronousTransfer) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for {
+			err := t.Wait()
+
+			r.mu.Lock()
+			active := r.active(t)
+			r.mu.Unlock()
+			if !active {
+				return
+			}
+			r.handler(t, err)
+
+			r.mu.Lock()
+			if !r.active(t) {
+				r.mu.Unlock()
+				return
+			}
+			err = t.Resubmit()
+			if err != nil {
+				// A transfer that can't be resubmitted, such as after a
+				// disconnect, leaves the ring
+				i := r.index(t)
+				r.transfers = append(r.transfers[:i], r.transfers[i+1:]...)
+			}
+			r.mu.Unlock()
+			if err != nil {
+				r.handler(t, err)
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,130 @@
+package usb
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ringCounts counts the completions an IsoRing hands to its handler, by
+// transfer
+type ringCounts struct {
+	mu     sync.Mutex
+	counts map[*IsochronousTransfer]int
+	errs   []error
+}
+
+func (c *ringCounts) handle(t *IsochronousTransfer, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[t]++
+	if err != nil {
+		c.errs = append(c.errs, err)
+	}
+}
+
+func (c *ringCounts) count(t *IsochronousTransfer) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[t]
+}
+
+// waitFor polls until every transfer of ts has completed at least n times
+func (c *ringCounts) waitFor(t *testing.T, n int, ts ...*IsochronousTransfer) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, tr := range ts {
+		for c.count(tr) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("transfer completed %d times, want at least %d", c.count(tr), n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestIsoRingMockBackend(t *testing.T) {
+	dev := &MockDevice{
+		Bus:     1,
+		Address: 8,
+		Endpoints: map[uint8]func([]byte) (int, error){
+			0x83: func(data []byte) (int, error) { return copy(data, "abc"), nil },
+		},
+	}
+	h := openMockHandle(t, dev)
+
+	if _, err := h.NewIsoRing(0x83, 0, 2, 8, func(*IsochronousTransfer, error) {}); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("NewIsoRing() of no transfers error = %v, want ErrInvalidParameter", err)
+	}
+
+	c := &ringCounts{counts: make(map[*IsochronousTransfer]int)}
+	r, err := h.NewIsoRing(0x83, 3, 2, 8, c.handle)
+	if err != nil {
+		t.Fatalf("NewIsoRing() error = %v", err)
+	}
+	initial := r.Transfers()
+	if len(initial) != 3 {
+		t.Fatalf("Transfers() = %d transfers, want 3", len(initial))
+	}
+
+	if err := r.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := r.Start(); err == nil {
+		t.Error("second Start() succeeded, want error")
+	}
+	// Every transfer is handed over more than once, so each was resubmitted
+	c.waitFor(t, 3, initial...)
+
+	// A transfer of another packet size joins the running ring
+	added, err := h.NewIsochronousTransfer(0x83, 4, 16)
+	if err != nil {
+		t.Fatalf("NewIsochronousTransfer() error = %v", err)
+	}
+	if err := r.Add(added); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := r.Add(added); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("Add() of a member error = %v, want ErrInvalidParameter", err)
+	}
+	c.waitFor(t, 3, added)
+
+	// A cancelled transfer leaves the ring while the others keep cycling
+	if err := r.Cancel(initial[0]); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	if got := len(r.Transfers()); got != 3 {
+		t.Errorf("Transfers() after Cancel = %d transfers, want 3", got)
+	}
+	if err := r.Cancel(initial[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Cancel() error = %v, want ErrNotFound", err)
+	}
+	cancelled := c.count(initial[0])
+	c.waitFor(t, c.count(added)+3, added)
+	// Only a handler call already running when Cancel returned may follow
+	if got := c.count(initial[0]); got > cancelled+1 {
+		t.Errorf("cancelled transfer completed %d more times", got-cancelled)
+	}
+
+	if err := r.Stop(); err != nil {
+		t.Errorf("Stop() error = %v", err)
+	}
+	if err := r.Stop(); err != nil {
+		t.Errorf("second Stop() error = %v", err)
+	}
+	stopped := c.count(added)
+	time.Sleep(10 * time.Millisecond)
+	if got := c.count(added); got != stopped {
+		t.Errorf("handler called %d times after Stop returned", got-stopped)
+	}
+	if err := r.Add(initial[0]); err == nil {
+		t.Error("Add() after Stop succeeded, want error")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.errs) != 0 {
+		t.Errorf("handler got errors %v, want none", c.errs)
+	}
+}
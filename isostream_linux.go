@@ -0,0 +1,347 @@
+package usb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// IsoStreamPacket is one completed packet of an IsoStream. Data aliases the
+// stream's arena and is only valid until Release, after which the memory is
+// reused for later transfers.
+type IsoStreamPacket struct {
+	Data        []byte
+	Status      int32     // Kernel status of the packet, 0 on success
+	CompletedAt time.Time // When the reaper picked up the transfer
+
+	stream *IsoStream
+	slot   int
+}
+
+// Release returns the memory of the packet to the stream. It must be called
+// exactly once for every packet received, and Data must not be used after.
+func (p IsoStreamPacket) Release() {
+	p.stream.release(p.slot)
+}
+
+// IsoStream keeps URBs queued on an isochronous IN endpoint for as long as
+// it runs, and delivers the packets they complete on a channel without
+// allocating. Transfers are resubmitted from the reaper the moment they
+// complete, so the endpoint never runs dry waiting for the consumer.
+//
+// The data lands in an arena of twice as many transfer-sized slots as there
+// are URBs. On each completion the URB moves to a free slot and the packets
+// of the slot it filled are handed out; the slot becomes free again once all
+// of them are released. When the consumer falls behind and holds every spare
+// slot, a completing URB is resubmitted into the slot it just filled, and the
+// packets in it are dropped and counted by Dropped instead of being
+// delivered, so a slow consumer loses whole transfers but never stalls the
+// endpoint.
+type IsoStream struct {
+	handle             *DeviceHandle
+	packetsPerTransfer int
+	packetSize         int
+	arena              []byte
+	packets            chan IsoStreamPacket
+
+	mu       sync.Mutex
+	urbs     []*isoStreamURB
+	free     []int // Slots neither in flight nor held by the consumer
+	refs     []int // Unreleased packets per slot
+	inFlight int
+	stopping bool
+	dropped  uint64
+	err      error
+	done     chan struct{}
+}
+
+// isoStreamURB is one URB of an IsoStream with its packet descriptors
+type isoStreamURB struct {
+	urb       *URB
+	urbBuffer []byte // Holds URB + packet descriptors
+	slot      int    // Arena slot the URB transfers into
+	callback  func(error)
+}
+
+// NewIsoStream starts streaming from the isochronous IN endpoint with
+// numTransfers URBs of packetsPerTransfer packets of packetSize bytes each
+// cycling. Completed packets with data or an error status are received from
+// Packets in completion order, and each must be released. Stop ends the
+// stream.
+func (h *DeviceHandle) NewIsoStream(endpoint uint8, numTransfers, packetsPerTransfer, packetSize int) (*IsoStream, error) {
+	if numTransfers <= 0 || packetsPerTransfer <= 0 || packetSize <= 0 || endpoint&0x80 == 0 {
+		return nil, ErrInvalidParameter
+	}
+
+	s := newIsoStream(h, numTransfers, packetsPerTransfer, packetSize)
+	for i := 0; i < numTransfers; i++ {
+		s.urbs = append(s.urbs, s.newURB(endpoint))
+	}
+
+	if err := s.start(); err != nil {
+		s.discard()
+		<-s.done
+		return nil, err
+	}
+	return s, nil
+}
+
+// start submits every URB of the stream. If a submission fails the stream
+// is marked as stopping, and the caller must discard the URBs in flight.
+func (s *IsoStream) start() error {
+	s.handle.mu.RLock()
+	defer s.handle.mu.RUnlock()
+
+	if s.handle.closed {
+		return ErrDeviceNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.urbs {
+		if err := s.submit(u); err != nil {
+			s.stopping = true
+			if s.inFlight == 0 {
+				s.finish()
+			}
+			return fmt.Errorf("failed to submit URB: %w", err)
+		}
+	}
+	return nil
+}
+
+// newIsoStream allocates the arena and bookkeeping of a stream without any
+// URBs
+func newIsoStream(h *DeviceHandle, numTransfers, packetsPerTransfer, packetSize int) *IsoStream {
+	slots := 2 * numTransfers
+	s := &IsoStream{
+		handle:             h,
+		packetsPerTransfer: packetsPerTransfer,
+		packetSize:         packetSize,
+		arena:              make([]byte, slots*packetsPerTransfer*packetSize),
+		// Every packet sent holds a slot until released, so the channel
+		// can buffer all of them and sending never blocks the reaper
+		packets: make(chan IsoStreamPacket, slots*packetsPerTransfer),
+		refs:    make([]int, slots),
+		done:    make(chan struct{}),
+	}
+	for slot := slots - 1; slot >= 0; slot-- {
+		s.free = append(s.free, slot)
+	}
+	return s
+}
+
+// newURB builds a URB for endpoint with its packet descriptors, filling the
+// next free slot. The caller must hold s.mu or own s exclusively.
+func (s *IsoStream) newURB(endpoint uint8) *isoStreamURB {
+	urbSize := unsafe.Sizeof(URB{}) + uintptr(s.packetsPerTransfer)*unsafe.Sizeof(IsoPacketDescriptor{})
+	u := &isoStreamURB{urbBuffer: make([]byte, urbSize)}
+	u.urb = (*URB)(unsafe.Pointer(&u.urbBuffer[0]))
+	u.urb.Type = USBDEVFS_URB_TYPE_ISO
+	u.urb.Endpoint = endpoint
+	u.urb.Flags = USBDEVFS_URB_ISO_ASAP
+	u.urb.BufferLength = int32(s.transferSize())
+	u.urb.NumberOfPackets = int32(s.packetsPerTransfer)
+	u.slot = s.takeSlot()
+	// Made once, so resubmitting allocates nothing
+	u.callback = func(err error) { s.complete(u, err) }
+	return u
+}
+
+// Packets returns the channel on which completed packets are delivered. It
+// is closed once the stream has stopped and no URB is in flight; packets
+// still buffered in it can be received and released after that.
+func (s *IsoStream) Packets() <-chan IsoStreamPacket {
+	return s.packets
+}
+
+// Dropped returns the number of transfers whose packets were dropped because
+// the consumer held every spare slot of the arena
+func (s *IsoStream) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Err returns the error that ended the stream, such as ErrNoDevice after a
+// disconnect. It is nil while the stream runs and when Stop ended it.
+func (s *IsoStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Stop discards the URBs of the stream and waits until none is in flight.
+// Packets already delivered stay valid until released.
+func (s *IsoStream) Stop() error {
+	s.mu.Lock()
+	stopping := s.stopping
+	s.stopping = true
+	s.mu.Unlock()
+
+	if !stopping {
+		s.discard()
+	}
+	<-s.done
+	return nil
+}
+
+// discard asks the kernel to give back every URB of the stream. URBs that
+// already completed are not found, which is fine.
+func (s *IsoStream) discard() {
+	s.handle.mu.RLock()
+	defer s.handle.mu.RUnlock()
+
+	if s.handle.closed {
+		// Closing the handle fails every pending URB already
+		return
+	}
+	for _, u := range s.urbs {
+		s.handle.discardURB(u.urb)
+	}
+}
+
+// submit re-arms u for its slot and submits it. The caller must hold
+// s.handle.mu for reading, which keeps the descriptor open, and s.mu.
+func (s *IsoStream) submit(u *isoStreamURB) error {
+	u.urb.Status = 0
+	u.urb.ActualLength = 0
+	u.urb.ErrorCount = 0
+	u.urb.StartFrame = -1
+	u.urb.Buffer = unsafe.Pointer(&s.arena[u.slot*s.transferSize()])
+	descriptors := u.descriptors(s.packetsPerTransfer)
+	for i := range descriptors {
+		descriptors[i] = IsoPacketDescriptor{Length: uint32(s.packetSize)}
+	}
+
+	if err := s.handle.submitURB(u.urb, u.callback); err != nil {
+		return err
+	}
+	s.inFlight++
+	return nil
+}
+
+// complete runs on the reaper when u completes. It delivers the packets and
+// resubmits u right away, unless the stream is stopping or the device is
+// gone.
+func (s *IsoStream) complete(u *isoStreamURB, err error) {
+	completedAt := time.Now()
+
+	s.handle.mu.RLock()
+	defer s.handle.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inFlight--
+	if err == nil && s.handle.closed {
+		err = ErrDeviceNotFound
+	}
+	if s.stopping || isoStreamFatal(err) {
+		if !s.stopping {
+			s.err = err
+		}
+		s.endURB(u)
+		return
+	}
+
+	// A URB error other than the ones above, such as EXDEV when some
+	// packets were lost, leaves the rest of the packets usable
+	s.deliver(u, completedAt)
+	if err := s.submit(u); err != nil {
+		s.err = err
+		s.endURB(u)
+	}
+}
+
+// deliver moves u to a free slot and sends the packets of the slot it filled,
+// or counts them as dropped when no slot is free, leaving u in place. The
+// caller must hold s.mu.
+func (s *IsoStream) deliver(u *isoStreamURB, completedAt time.Time) {
+	if len(s.free) == 0 {
+		s.dropped++
+		return
+	}
+
+	filled := u.slot
+	u.slot = s.takeSlot()
+	base := filled * s.transferSize()
+	for i, d := range u.descriptors(s.packetsPerTransfer) {
+		if d.ActualLength == 0 && d.Status == 0 {
+			// Nothing was sent in this interval
+			continue
+		}
+		offset := base + i*s.packetSize
+		s.refs[filled]++
+		s.packets <- IsoStreamPacket{
+			Data:        s.arena[offset : offset+int(d.ActualLength) : offset+s.packetSize],
+			Status:      d.Status,
+			CompletedAt: completedAt,
+			stream:      s,
+			slot:        filled,
+		}
+	}
+	if s.refs[filled] == 0 {
+		s.free = append(s.free, filled)
+	}
+}
+
+// release drops one reference to slot, freeing it with the last one
+func (s *IsoStream) release(slot int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.refs[slot] <= 0 {
+		panic("usb: IsoStreamPacket released twice")
+	}
+	s.refs[slot]--
+	if s.refs[slot] == 0 {
+		s.free = append(s.free, slot)
+	}
+}
+
+// takeSlot removes a slot from the free list. The caller must hold s.mu and
+// make sure the list is not empty.
+func (s *IsoStream) takeSlot() int {
+	slot := s.free[len(s.free)-1]
+	s.free = s.free[:len(s.free)-1]
+	return slot
+}
+
+// endURB retires u, which is no longer in flight, and finishes the stream
+// with the last URB. The caller must hold s.mu.
+func (s *IsoStream) endURB(u *isoStreamURB) {
+	s.free = append(s.free, u.slot)
+	s.stopping = true
+	if s.inFlight == 0 {
+		s.finish()
+	}
+}
+
+// finish closes the packet channel once the last URB is retired. The caller
+// must hold s.mu.
+func (s *IsoStream) finish() {
+	select {
+	case <-s.done:
+	default:
+		close(s.packets)
+		close(s.done)
+	}
+}
+
+func (s *IsoStream) transferSize() int {
+	return s.packetsPerTransfer * s.packetSize
+}
+
+// descriptors returns the packet descriptors that follow the URB
+func (u *isoStreamURB) descriptors(n int) []IsoPacketDescriptor {
+	return unsafe.Slice((*IsoPacketDescriptor)(unsafe.Add(unsafe.Pointer(u.urb), unsafe.Sizeof(URB{}))), n)
+}
+
+// isoStreamFatal reports whether a URB that completed with err must not be
+// resubmitted
+func isoStreamFatal(err error) bool {
+	return errors.Is(err, ErrNoDevice) || errors.Is(err, ErrDeviceNotFound) || errors.Is(err, ErrInterrupted)
+}
@@ -0,0 +1,95 @@
+package usb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsoStreamDelivery(t *testing.T) {
+	// One URB of two 4 byte packets, with one spare slot for the consumer
+	s := newIsoStream(nil, 1, 2, 4)
+	u := s.newURB(0x81)
+
+	fill := func(first, second uint32) {
+		d := u.descriptors(2)
+		d[0] = IsoPacketDescriptor{Length: 4, ActualLength: first}
+		d[1] = IsoPacketDescriptor{Length: 4, ActualLength: second}
+		base := u.slot * s.transferSize()
+		copy(s.arena[base:base+8], "abcdefgh")
+	}
+
+	// An empty packet isn't delivered
+	fill(3, 0)
+	filled := u.slot
+	s.deliver(u, time.Now())
+	if u.slot == filled {
+		t.Fatalf("URB kept slot %d after a completion with a free slot", filled)
+	}
+	if len(s.packets) != 1 {
+		t.Fatalf("delivered %d packets, want 1", len(s.packets))
+	}
+	p := <-s.packets
+	if string(p.Data) != "abc" {
+		t.Errorf("packet data = %q, want %q", p.Data, "abc")
+	}
+
+	// The consumer holds the only spare slot, so the next transfer is dropped
+	fill(4, 4)
+	inFlight := u.slot
+	s.deliver(u, time.Now())
+	if u.slot != inFlight || len(s.packets) != 0 || s.Dropped() != 1 {
+		t.Errorf("after deliver with no free slot: slot %d (want %d), %d packets, %d dropped", u.slot, inFlight, len(s.packets), s.Dropped())
+	}
+
+	// Releasing frees the slot for the next completion
+	p.Release()
+	fill(4, 2)
+	s.deliver(u, time.Now())
+	if u.slot != filled || len(s.packets) != 2 {
+		t.Fatalf("after release: slot %d (want %d), %d packets", u.slot, filled, len(s.packets))
+	}
+	first, second := <-s.packets, <-s.packets
+	if string(first.Data) != "abcd" || string(second.Data) != "ef" {
+		t.Errorf("packet data = %q, %q, want %q, %q", first.Data, second.Data, "abcd", "ef")
+	}
+	first.Release()
+	if len(s.free) != 0 {
+		t.Errorf("slot freed with a packet still held")
+	}
+	second.Release()
+	if len(s.free) != 1 {
+		t.Errorf("slot not freed after every packet was released")
+	}
+}
+
+func TestIsoStreamMockBackend(t *testing.T) {
+	dev := &MockDevice{
+		Bus:     1,
+		Address: 3,
+		Endpoints: map[uint8]func([]byte) (int, error){
+			0x83: func(data []byte) (int, error) { return copy(data, "abc"), nil },
+		},
+	}
+	h := openMockHandle(t, dev)
+
+	s, err := h.NewIsoStream(0x83, 2, 4, 8)
+	if err != nil {
+		t.Fatalf("NewIsoStream() error = %v", err)
+	}
+	// More packets than the arena holds, so the URBs must have cycled
+	for i := 0; i < 40; i++ {
+		p := <-s.Packets()
+		if string(p.Data) != "abc" || p.Status != 0 {
+			t.Fatalf("packet %d = %q, status %d, want \"abc\"", i, p.Data, p.Status)
+		}
+		p.Release()
+	}
+
+	s.Stop()
+	for p := range s.Packets() {
+		p.Release()
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("Err() after Stop = %v, want nil", err)
+	}
+}
@@ -0,0 +1,368 @@
+package usb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+// MockDevice is a synthetic device of a MockBackend. Its descriptors answer
+// the standard requests for descriptors and the configuration, and its
+// handler funcs everything else. Handlers can be called from several
+// goroutines at once if the code under test transfers concurrently.
+type MockDevice struct {
+	Path       string
+	Bus        uint8
+	Address    uint8
+	Descriptor DeviceDescriptor // Length and DescriptorType are filled in
+	Configs    [][]byte         // Raw configuration descriptors in index order
+	Strings    map[uint8]string // String descriptors by index, in US English
+
+	// Control handles the control requests not answered from the
+	// descriptors, including GET_DESCRIPTOR of other descriptor types such
+	// as BOS. Without it they stall.
+	Control func(requestType, request uint8, value, index uint16, data []byte) (int, error)
+
+	// Endpoints handles the transfers on each endpoint address. data is the
+	// buffer of an IN transfer to fill or the data of an OUT transfer, and
+	// the result is the number of bytes transferred. Isochronous transfers
+	// call the handler once per packet. Transfers on an endpoint without a
+	// handler stall. A handler returning ErrPipeStalled halts its endpoint,
+	// and further transfers stall without calling it until ClearHalt.
+	Endpoints map[uint8]func(data []byte) (int, error)
+
+	// StallGetInterface makes GET_INTERFACE stall, as some devices do for
+	// interfaces with a single alternate setting
+	StallGetInterface bool
+
+	mu            sync.Mutex
+	configuration uint8                 // bConfigurationValue, 0 while unconfigured
+	altSettings   map[uint8]uint8       // Selected alternate setting by interface
+	claimed       map[uint8]*mockHandle // Claiming handle by interface
+	halted        map[uint8]bool        // Endpoints halted by a stall
+}
+
+// Configuration returns the bConfigurationValue the device is in
+func (d *MockDevice) Configuration() uint8 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.configuration
+}
+
+// AltSetting returns the alternate setting selected on interface iface
+func (d *MockDevice) AltSetting(iface uint8) uint8 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.altSettings[iface]
+}
+
+// Halted reports whether endpoint stalled and has not been cleared since
+func (d *MockDevice) Halted(endpoint uint8) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.halted[endpoint]
+}
+
+// Claimed reports whether a handle has claimed interface iface
+func (d *MockDevice) Claimed(iface uint8) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.claimed[iface] != nil
+}
+
+// descriptor returns the standard descriptor of type descType at index, or
+// false if the device has none
+func (d *MockDevice) descriptor(descType, index uint8) ([]byte, bool) {
+	switch descType {
+	case USB_DT_DEVICE:
+		desc := d.Descriptor
+		b := make([]byte, 18)
+		b[0], b[1] = 18, USB_DT_DEVICE
+		binary.LittleEndian.PutUint16(b[2:4], desc.USBVersion)
+		b[4], b[5], b[6], b[7] = desc.DeviceClass, desc.DeviceSubClass, desc.DeviceProtocol, desc.MaxPacketSize0
+		binary.LittleEndian.PutUint16(b[8:10], desc.VendorID)
+		binary.LittleEndian.PutUint16(b[10:12], desc.ProductID)
+		binary.LittleEndian.PutUint16(b[12:14], desc.DeviceVersion)
+		b[14], b[15], b[16], b[17] = desc.ManufacturerIndex, desc.ProductIndex, desc.SerialNumberIndex, desc.NumConfigurations
+		return b, true
+	case USB_DT_CONFIG:
+		if int(index) < len(d.Configs) {
+			return d.Configs[index], true
+		}
+	case USB_DT_STRING:
+		if index == 0 {
+			return []byte{4, USB_DT_STRING, 0x09, 0x04}, true // US English only
+		}
+		if s, ok := d.Strings[index]; ok {
+			units := utf16.Encode([]rune(s))
+			b := make([]byte, 2+2*len(units))
+			b[0], b[1] = uint8(min(len(b), 255)), USB_DT_STRING
+			for i, u := range units {
+				binary.LittleEndian.PutUint16(b[2+2*i:], u)
+			}
+			return b[:b[0]], true
+		}
+	}
+	return nil, false
+}
+
+// hasConfiguration reports whether one of the configurations has
+// bConfigurationValue value
+func (d *MockDevice) hasConfiguration(value uint8) bool {
+	for _, config := range d.Configs {
+		if len(config) > 5 && config[5] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// MockBackend is an in-memory Backend of MockDevices, for tests of code that
+// uses this package. Devices can be added and removed while it is in use;
+// the handles of a removed device fail with ErrNoDevice, as after an unplug.
+type MockBackend struct {
+	mu      sync.Mutex
+	devices []*MockDevice
+}
+
+// NewMockBackend returns a MockBackend with the given devices attached
+func NewMockBackend(devices ...*MockDevice) *MockBackend {
+	b := &MockBackend{}
+	for _, d := range devices {
+		b.AddDevice(d)
+	}
+	return b
+}
+
+// AddDevice attaches d, configured in its first configuration as the
+// operating system would have done at enumeration
+func (b *MockBackend) AddDevice(d *MockDevice) {
+	d.mu.Lock()
+	d.configuration = 0
+	if len(d.Configs) > 0 && len(d.Configs[0]) > 5 {
+		d.configuration = d.Configs[0][5]
+	}
+	d.altSettings = make(map[uint8]uint8)
+	d.claimed = make(map[uint8]*mockHandle)
+	d.mu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.devices = append(b.devices, d)
+}
+
+// RemoveDevice detaches d
+func (b *MockBackend) RemoveDevice(d *MockDevice) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, attached := range b.devices {
+		if attached == d {
+			b.devices = append(b.devices[:i], b.devices[i+1:]...)
+			return
+		}
+	}
+}
+
+// DeviceList returns the attached devices
+func (b *MockBackend) DeviceList() ([]BackendDevice, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	list := make([]BackendDevice, len(b.devices))
+	for i, d := range b.devices {
+		desc := d.Descriptor
+		desc.Length, desc.DescriptorType = 18, USB_DT_DEVICE
+		list[i] = BackendDevice{Path: d.Path, Bus: d.Bus, Address: d.Address, Descriptor: desc}
+	}
+	return list, nil
+}
+
+// Open opens the attached device at the bus and address of dev
+func (b *MockBackend) Open(dev *Device) (BackendHandle, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, d := range b.devices {
+		if d.Bus == dev.Bus && d.Address == dev.Address {
+			return &mockHandle{backend: b, device: d}, nil
+		}
+	}
+	return nil, ErrDeviceNotFound
+}
+
+// attached reports whether d has not been removed
+func (b *MockBackend) attached(d *MockDevice) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, attached := range b.devices {
+		if attached == d {
+			return true
+		}
+	}
+	return false
+}
+
+// mockHandle is the BackendHandle of an open MockDevice
+type mockHandle struct {
+	backend *MockBackend
+	device  *MockDevice
+}
+
+func (h *mockHandle) ControlTransfer(requestType, request uint8, value, index uint16, data []byte, timeout time.Duration) (int, error) {
+	if !h.backend.attached(h.device) {
+		return 0, ErrNoDevice
+	}
+	d := h.device
+
+	switch {
+	case requestType == 0x80 && request == USB_REQ_GET_DESCRIPTOR:
+		if desc, ok := d.descriptor(uint8(value>>8), uint8(value)); ok {
+			return copy(data, desc), nil
+		}
+	case requestType == 0x80 && request == USB_REQ_GET_CONFIGURATION:
+		if len(data) < 1 {
+			return 0, ErrInvalidParameter
+		}
+		data[0] = d.Configuration()
+		return 1, nil
+	case requestType == 0x00 && request == USB_REQ_SET_CONFIGURATION:
+		if value != 0 && !d.hasConfiguration(uint8(value)) {
+			return 0, ErrPipeStalled
+		}
+		d.mu.Lock()
+		d.configuration = uint8(value)
+		d.altSettings = make(map[uint8]uint8)
+		d.mu.Unlock()
+		return 0, nil
+	case requestType == 0x81 && request == USB_REQ_GET_INTERFACE:
+		if d.StallGetInterface {
+			return 0, ErrPipeStalled
+		}
+		if len(data) < 1 {
+			return 0, ErrInvalidParameter
+		}
+		data[0] = d.AltSetting(uint8(index))
+		return 1, nil
+	case requestType == 0x01 && request == USB_REQ_SET_INTERFACE:
+		return 0, h.SetInterfaceAltSetting(uint8(index), uint8(value))
+	}
+
+	if d.Control == nil {
+		return 0, ErrPipeStalled
+	}
+	return d.Control(requestType, request, value, index, data)
+}
+
+func (h *mockHandle) Transfer(endpoint uint8, data []byte, timeout time.Duration) (int, error) {
+	handler, err := h.endpoint(endpoint)
+	if err != nil {
+		return 0, err
+	}
+	d := h.device
+	d.mu.Lock()
+	halted := d.halted[endpoint]
+	d.mu.Unlock()
+	if halted {
+		return 0, ErrPipeStalled
+	}
+
+	n, err := handler(data)
+	if errors.Is(err, ErrPipeStalled) {
+		d.mu.Lock()
+		if d.halted == nil {
+			d.halted = make(map[uint8]bool)
+		}
+		d.halted[endpoint] = true
+		d.mu.Unlock()
+	}
+	return min(n, len(data)), err
+}
+
+func (h *mockHandle) IsochronousTransfer(endpoint uint8, packets [][]byte) ([]int, error) {
+	handler, err := h.endpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	lengths := make([]int, len(packets))
+	for i, packet := range packets {
+		n, err := handler(packet)
+		if err != nil {
+			return lengths, err
+		}
+		lengths[i] = min(n, len(packet))
+	}
+	return lengths, nil
+}
+
+// endpoint returns the handler of endpoint
+func (h *mockHandle) endpoint(endpoint uint8) (func([]byte) (int, error), error) {
+	if !h.backend.attached(h.device) {
+		return nil, ErrNoDevice
+	}
+	handler := h.device.Endpoints[endpoint]
+	if handler == nil {
+		return nil, ErrPipeStalled
+	}
+	return handler, nil
+}
+
+func (h *mockHandle) ClaimInterface(iface uint8) error {
+	if !h.backend.attached(h.device) {
+		return ErrNoDevice
+	}
+	d := h.device
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if owner := d.claimed[iface]; owner != nil && owner != h {
+		return fmt.Errorf("interface %d claimed by another handle: %w", iface, ErrBusy)
+	}
+	d.claimed[iface] = h
+	return nil
+}
+
+func (h *mockHandle) ReleaseInterface(iface uint8) error {
+	d := h.device
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.claimed[iface] == h {
+		delete(d.claimed, iface)
+	}
+	return nil
+}
+
+func (h *mockHandle) SetInterfaceAltSetting(iface, altSetting uint8) error {
+	if !h.backend.attached(h.device) {
+		return ErrNoDevice
+	}
+	d := h.device
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.altSettings[iface] = altSetting
+	return nil
+}
+
+func (h *mockHandle) ClearHalt(endpoint uint8) error {
+	if !h.backend.attached(h.device) {
+		return ErrNoDevice
+	}
+	d := h.device
+	d.mu.Lock()
+	delete(d.halted, endpoint)
+	d.mu.Unlock()
+	return nil
+}
+
+func (h *mockHandle) Close() error {
+	d := h.device
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for iface, owner := range d.claimed {
+		if owner == h {
+			delete(d.claimed, iface)
+		}
+	}
+	return nil
+}
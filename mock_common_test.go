@@ -0,0 +1,153 @@
+package usb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMockBackend(t *testing.T) {
+	// One configuration with a vendor interface of a bulk IN and a bulk OUT
+	// endpoint
+	config, _ := hex.DecodeString(
+		"09022000010100803209040000" + "02ff000000" +
+			"07058102400000" + "07050202400000")
+
+	var written []byte
+	dev := &MockDevice{
+		Path:    "mock/1-2",
+		Bus:     1,
+		Address: 2,
+		Descriptor: DeviceDescriptor{
+			USBVersion:        0x0200,
+			MaxPacketSize0:    64,
+			VendorID:          0x1209,
+			ProductID:         0x0001,
+			ProductIndex:      2,
+			NumConfigurations: 1,
+		},
+		Configs: [][]byte{config},
+		Strings: map[uint8]string{2: "Widget"},
+		Control: func(requestType, request uint8, value, index uint16, data []byte) (int, error) {
+			if requestType == 0xc0 && request == 0x01 {
+				return copy(data, "pong"), nil
+			}
+			return 0, ErrPipeStalled
+		},
+		Endpoints: map[uint8]func([]byte) (int, error){
+			0x81: func(data []byte) (int, error) { return copy(data, "hello"), nil },
+			0x02: func(data []byte) (int, error) {
+				written = append(written, data...)
+				return len(data), nil
+			},
+		},
+	}
+	backend := NewMockBackend(dev)
+	SetBackend(backend)
+	defer SetBackend(nil)
+
+	devices, err := DeviceList()
+	if err != nil {
+		t.Fatalf("DeviceList() error = %v", err)
+	}
+	if len(devices) != 1 || devices[0].Descriptor.VendorID != 0x1209 || devices[0].Path != "mock/1-2" {
+		t.Fatalf("DeviceList() = %+v, want the mock device", devices)
+	}
+
+	h, err := devices[0].Open()
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer h.Close()
+
+	active, err := h.GetActiveConfigDescriptor()
+	if err != nil {
+		t.Fatalf("GetActiveConfigDescriptor() error = %v", err)
+	}
+	if active.ConfigurationValue != 1 || len(active.Interfaces) != 1 || len(active.Interfaces[0].AltSettings[0].Endpoints) != 2 {
+		t.Errorf("GetActiveConfigDescriptor() = %+v, want configuration 1 with one interface of two endpoints", active)
+	}
+
+	if s, err := h.StringDescriptor(2); err != nil || s != "Widget" {
+		t.Errorf("StringDescriptor(2) = %q, %v, want \"Widget\"", s, err)
+	}
+
+	buf := make([]byte, 8)
+	if n, err := h.ControlTransfer(0xc0, 0x01, 0, 0, buf, time.Second); err != nil || string(buf[:n]) != "pong" {
+		t.Errorf("vendor ControlTransfer() = %q, %v, want \"pong\"", buf[:n], err)
+	}
+	if _, err := h.ControlTransfer(0xc0, 0x02, 0, 0, buf, time.Second); !errors.Is(err, ErrPipeStalled) {
+		t.Errorf("unknown ControlTransfer() error = %v, want ErrPipeStalled", err)
+	}
+
+	if _, err := h.FD(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("FD() error = %v, want ErrNotSupported", err)
+	}
+	if _, err := h.GetKernelDriver(0); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("GetKernelDriver(0) error = %v, want ErrNotSupported", err)
+	}
+
+	if err := h.ClaimInterface(0); err != nil {
+		t.Fatalf("ClaimInterface(0) error = %v", err)
+	}
+	if !dev.Claimed(0) {
+		t.Error("Claimed(0) = false after ClaimInterface")
+	}
+	if n, err := h.BulkTransfer(0x81, buf, time.Second); err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("BulkTransfer(0x81) = %q, %v, want \"hello\"", buf[:n], err)
+	}
+	if n, err := h.BulkTransfer(0x02, []byte("data"), time.Second); err != nil || n != 4 || !bytes.Equal(written, []byte("data")) {
+		t.Errorf("BulkTransfer(0x02) = %d, %v; device got %q, want \"data\"", n, err, written)
+	}
+	if _, err := h.BulkTransfer(0x83, buf, time.Second); !errors.Is(err, ErrPipeStalled) {
+		t.Errorf("BulkTransfer(0x83) error = %v, want ErrPipeStalled", err)
+	}
+
+	// The interface is held until the first handle releases it
+	other, err := devices[0].Open()
+	if err != nil {
+		t.Fatalf("second Open() error = %v", err)
+	}
+	if err := other.ClaimInterface(0); !errors.Is(err, ErrBusy) {
+		t.Errorf("ClaimInterface(0) on a second handle error = %v, want ErrBusy", err)
+	}
+	other.Close()
+
+	if err := h.SetConfiguration(0); err != nil {
+		t.Fatalf("SetConfiguration(0) error = %v", err)
+	}
+	if got, err := h.Configuration(); err != nil || got != 0 {
+		t.Errorf("Configuration() = %d, %v, want 0", got, err)
+	}
+
+	backend.RemoveDevice(dev)
+	if _, err := h.BulkTransfer(0x81, buf, time.Second); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("BulkTransfer() after RemoveDevice error = %v, want ErrNoDevice", err)
+	}
+
+	h.Close()
+	if dev.Claimed(0) {
+		t.Error("Claimed(0) = true after Close")
+	}
+}
+
+// openMockHandle makes dev the only device, through a MockBackend, and opens
+// it. The handle is closed and the backend reset when the test ends.
+func openMockHandle(t *testing.T, dev *MockDevice) *DeviceHandle {
+	t.Helper()
+	SetBackend(NewMockBackend(dev))
+	t.Cleanup(func() { SetBackend(nil) })
+
+	devices, err := DeviceList()
+	if err != nil || len(devices) != 1 {
+		t.Fatalf("DeviceList() = %v, %v, want the mock device", devices, err)
+	}
+	h, err := devices[0].Open()
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
@@ -0,0 +1,443 @@
+package msc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+// Bulk-Only Transport wrapper signatures
+const (
+	CBW_SIGNATURE = 0x43425355 // "USBC"
+	CSW_SIGNATURE = 0x53425355 // "USBS"
+
+	cbwLength = 31
+	cswLength = 13
+)
+
+// CSW status values
+const (
+	CSWStatusPassed     = 0x00
+	CSWStatusFailed     = 0x01
+	CSWStatusPhaseError = 0x02
+)
+
+// Bulk-Only class-specific requests
+const (
+	BOT_GET_MAX_LUN = 0xfe
+	BOT_RESET       = 0xff
+)
+
+// ErrPhaseError is returned when a device reports a phase error in its CSW,
+// after the reset recovery the host must then perform
+var ErrPhaseError = errors.New("phase error")
+
+// BOT is the Bulk-Only Transport of a Mass Storage interface: it wraps SCSI
+// commands in CBWs on the bulk OUT endpoint and reads their data and CSW
+// from the bulk IN endpoint. It is not safe for concurrent use.
+type BOT struct {
+	handle    *usb.DeviceHandle
+	in, out   uint8
+	iface     int // -1 until looked up from the endpoints
+	lun       uint8
+	tag       uint32
+	timeout   time.Duration
+	blocks    uint64 // set by ReadCapacity
+	blockSize uint32
+}
+
+// NewBulkOnlyTransport returns the transport over the bulk endpoints epIn
+// and epOut of a claimed Bulk-Only interface, addressing LUN 0. The
+// interface number Reset and MaxLUN address is found from the endpoints in
+// the active configuration.
+func NewBulkOnlyTransport(h *usb.DeviceHandle, epIn, epOut uint8) *BOT {
+	return &BOT{
+		handle:  h,
+		in:      epIn,
+		out:     epOut,
+		iface:   -1,
+		tag:     1,
+		timeout: 5 * time.Second,
+	}
+}
+
+// SetLUN selects the logical unit the commands address, one of 0 through
+// the value MaxLUN returns
+func (b *BOT) SetLUN(lun uint8) {
+	b.lun = lun
+	b.blocks, b.blockSize = 0, 0
+}
+
+// SetTimeout sets the timeout of each transfer of a command
+func (b *BOT) SetTimeout(timeout time.Duration) {
+	b.timeout = timeout
+}
+
+// interfaceNumber returns the number of the interface holding the transport's
+// endpoints
+func (b *BOT) interfaceNumber() (uint16, error) {
+	if b.iface >= 0 {
+		return uint16(b.iface), nil
+	}
+	config, err := b.handle.GetActiveConfigDescriptor()
+	if err != nil {
+		return 0, err
+	}
+	for i := range config.Interfaces {
+		iface := &config.Interfaces[i]
+		if _, alt, ok := iface.EndpointInAnyAlt(b.in); ok {
+			b.iface = int(alt.InterfaceNumber)
+			return uint16(b.iface), nil
+		}
+	}
+	return 0, fmt.Errorf("no interface with endpoint 0x%02x: %w", b.in, usb.ErrNotFound)
+}
+
+// MaxLUN returns the highest logical unit number of the device. Devices
+// with a single LUN may stall the request, which reports 0.
+func (b *BOT) MaxLUN() (uint8, error) {
+	iface, err := b.interfaceNumber()
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 1)
+	n, err := b.handle.ControlTransfer(0xa1, BOT_GET_MAX_LUN, 0, iface, buf, b.timeout)
+	if errors.Is(err, usb.ErrPipe) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get max LUN: %w", err)
+	}
+	if n < 1 {
+		return 0, nil
+	}
+	return buf[0], nil
+}
+
+// Reset performs the Bulk-Only reset recovery: a Mass Storage Reset class
+// request to the interface, then a clear of the halt on both bulk
+// endpoints. Commands that fail with a phase error or an invalid CSW are
+// recovered this way before their error is returned.
+func (b *BOT) Reset() error {
+	iface, err := b.interfaceNumber()
+	if err != nil {
+		return err
+	}
+	if _, err := b.handle.ControlTransfer(0x21, BOT_RESET, 0, iface, nil, b.timeout); err != nil {
+		return fmt.Errorf("mass storage reset: %w", err)
+	}
+	if err := b.handle.ClearHalt(b.in); err != nil {
+		return fmt.Errorf("clear halt of endpoint 0x%02x: %w", b.in, err)
+	}
+	if err := b.handle.ClearHalt(b.out); err != nil {
+		return fmt.Errorf("clear halt of endpoint 0x%02x: %w", b.out, err)
+	}
+	return nil
+}
+
+// buildCBW encodes the CBW of a command
+func buildCBW(tag uint32, lun uint8, cdb []byte, length int, dataIn bool) []byte {
+	cbw := make([]byte, cbwLength)
+	binary.LittleEndian.PutUint32(cbw[0:4], CBW_SIGNATURE)
+	binary.LittleEndian.PutUint32(cbw[4:8], tag)
+	binary.LittleEndian.PutUint32(cbw[8:12], uint32(length))
+	if dataIn {
+		cbw[12] = 0x80
+	}
+	cbw[13] = lun & 0x0f
+	cbw[14] = uint8(len(cdb))
+	copy(cbw[15:], cdb)
+	return cbw
+}
+
+// parseCSW checks a CSW against the CBW it answers, which had tag and
+// expected length bytes of data, and returns its status and residue
+func parseCSW(csw []byte, tag uint32, length int) (uint8, uint32, error) {
+	if len(csw) != cswLength {
+		return 0, 0, fmt.Errorf("CSW of %d bytes", len(csw))
+	}
+	if sig := binary.LittleEndian.Uint32(csw[0:4]); sig != CSW_SIGNATURE {
+		return 0, 0, fmt.Errorf("invalid CSW signature 0x%08x", sig)
+	}
+	if got := binary.LittleEndian.Uint32(csw[4:8]); got != tag {
+		return 0, 0, fmt.Errorf("CSW tag %d does not match CBW tag %d", got, tag)
+	}
+	status := csw[12]
+	if status > CSWStatusPhaseError {
+		return 0, 0, fmt.Errorf("invalid CSW status %d", status)
+	}
+	residue := binary.LittleEndian.Uint32(csw[8:12])
+	if status != CSWStatusPhaseError && uint64(residue) > uint64(length) {
+		return 0, 0, fmt.Errorf("CSW residue %d exceeds the %d bytes requested", residue, length)
+	}
+	return status, residue, nil
+}
+
+// execute runs one command: the CBW carrying cdb, an optional data phase in
+// the direction given by dataIn, and the CSW. It returns the CSW status and
+// the number of bytes of data the device transferred, which the residue of
+// the CSW can shorten below what went over the bus. A phase error or an
+// invalid CSW is followed by Reset.
+func (b *BOT) execute(cdb []byte, data []byte, dataIn bool) (uint8, int, error) {
+	tag := b.tag
+	b.tag++
+
+	if _, err := b.handle.BulkTransfer(b.out, buildCBW(tag, b.lun, cdb, len(data), dataIn), b.timeout); err != nil {
+		return 0, 0, fmt.Errorf("failed to send CBW: %w", err)
+	}
+
+	n := 0
+	if len(data) > 0 {
+		ep := b.out
+		if dataIn {
+			ep = b.in
+		}
+		var err error
+		n, err = b.handle.BulkTransfer(ep, data, b.timeout)
+		if err != nil {
+			// A device that fails the data phase stalls the endpoint and
+			// still sends a CSW once the halt is cleared
+			if clearErr := b.handle.ClearHalt(ep); clearErr != nil {
+				return 0, 0, fmt.Errorf("data phase failed: %w", err)
+			}
+		}
+	}
+
+	csw := make([]byte, cswLength)
+	m, err := b.handle.BulkTransfer(b.in, csw, b.timeout)
+	if err != nil {
+		// The device may stall the IN endpoint instead of sending the CSW;
+		// once the halt is cleared it is read again, once
+		if clearErr := b.handle.ClearHalt(b.in); clearErr != nil {
+			return 0, 0, fmt.Errorf("failed to receive CSW: %w", err)
+		}
+		if m, err = b.handle.BulkTransfer(b.in, csw, b.timeout); err != nil {
+			return 0, 0, fmt.Errorf("failed to receive CSW: %w", err)
+		}
+	}
+
+	status, residue, err := parseCSW(csw[:m], tag, len(data))
+	if err == nil && status == CSWStatusPhaseError {
+		err = ErrPhaseError
+	}
+	if err != nil {
+		if resetErr := b.Reset(); resetErr != nil {
+			return 0, 0, fmt.Errorf("%w (reset recovery failed: %v)", err, resetErr)
+		}
+		return 0, 0, err
+	}
+
+	if done := len(data) - int(residue); done < n {
+		n = done
+	}
+	return status, n, nil
+}
+
+// command runs a command and turns a failed status into a *SenseError
+func (b *BOT) command(name string, cdb []byte, data []byte, dataIn bool) (int, error) {
+	status, n, err := b.execute(cdb, data, dataIn)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if status != CSWStatusPassed {
+		sense, err := b.RequestSense()
+		if err != nil {
+			return 0, fmt.Errorf("%s failed with status %d", name, status)
+		}
+		return 0, &SenseError{Command: name, Sense: sense}
+	}
+	return n, nil
+}
+
+// TestUnitReady asks whether the logical unit is ready to transfer data. A
+// unit that is not ready, for example a card reader without a card, fails
+// with a *SenseError.
+func (b *BOT) TestUnitReady() error {
+	_, err := b.command("test unit ready", []byte{SCSI_TEST_UNIT_READY, 0, 0, 0, 0, 0}, nil, false)
+	return err
+}
+
+// RequestSense returns the sense data of the last failed command
+func (b *BOT) RequestSense() (SenseInfo, error) {
+	buf := make([]byte, 18) // Fixed format sense data
+	status, n, err := b.execute([]byte{SCSI_REQUEST_SENSE, 0, 0, 0, byte(len(buf)), 0}, buf, true)
+	if err != nil {
+		return SenseInfo{}, fmt.Errorf("request sense: %w", err)
+	}
+	if status != CSWStatusPassed {
+		return SenseInfo{}, fmt.Errorf("request sense failed with status %d", status)
+	}
+	return DecodeSense(buf[:n]), nil
+}
+
+// Inquiry returns the standard INQUIRY data of the logical unit
+func (b *BOT) Inquiry() (InquiryData, error) {
+	buf := make([]byte, inquiryLength)
+	n, err := b.command("inquiry", []byte{SCSI_INQUIRY, 0, 0, 0, byte(len(buf)), 0}, buf, true)
+	if err != nil {
+		return InquiryData{}, err
+	}
+	if n < 5 {
+		return InquiryData{}, fmt.Errorf("inquiry: short response of %d bytes", n)
+	}
+	return DecodeInquiry(buf[:n]), nil
+}
+
+// ReadCapacity returns the number of blocks on the medium and the size of
+// each block in bytes. A drive with more blocks than READ CAPACITY(10) can
+// report answers it with a last block of 0xffffffff, and is then asked with
+// READ CAPACITY(16). A block size of 0 is an error.
+func (b *BOT) ReadCapacity() (uint64, uint32, error) {
+	buf := make([]byte, 8)
+	n, err := b.command("read capacity", []byte{SCSI_READ_CAPACITY, 0, 0, 0, 0, 0, 0, 0, 0, 0}, buf, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	if n < len(buf) {
+		return 0, 0, fmt.Errorf("read capacity: short response of %d bytes", n)
+	}
+
+	// The drive reports the address of its last block
+	lastLBA := uint64(binary.BigEndian.Uint32(buf[0:4]))
+	blockSize := binary.BigEndian.Uint32(buf[4:8])
+	if lastLBA == 0xffffffff {
+		if lastLBA, blockSize, err = b.readCapacity16(); err != nil {
+			return 0, 0, err
+		}
+	}
+	if blockSize == 0 {
+		return 0, 0, fmt.Errorf("read capacity: drive reports a block size of 0")
+	}
+	if lastLBA == math.MaxUint64 {
+		return 0, 0, fmt.Errorf("read capacity: last block %d out of range", lastLBA)
+	}
+
+	b.blocks = lastLBA + 1
+	b.blockSize = blockSize
+	return b.blocks, b.blockSize, nil
+}
+
+// readCapacity16 returns the last block address and the block size the
+// drive reports to READ CAPACITY(16)
+func (b *BOT) readCapacity16() (uint64, uint32, error) {
+	buf := make([]byte, 32)
+	cdb := make([]byte, 16)
+	cdb[0] = SCSI_SERVICE_ACTION_IN
+	cdb[1] = serviceActionReadCapacity16
+	binary.BigEndian.PutUint32(cdb[10:14], uint32(len(buf)))
+	n, err := b.command("read capacity(16)", cdb, buf, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	if n < 12 {
+		return 0, 0, fmt.Errorf("read capacity(16): short response of %d bytes", n)
+	}
+	return binary.BigEndian.Uint64(buf[0:8]), binary.BigEndian.Uint32(buf[8:12]), nil
+}
+
+// rw10 builds the CDB of a READ(10) or WRITE(10), reading the block size
+// with ReadCapacity first if it is not known yet
+func (b *BOT) rw10(op uint8, lba, count uint32) ([]byte, error) {
+	if count > 0xffff {
+		return nil, fmt.Errorf("%d blocks do not fit one (10) command: %w", count, usb.ErrInvalidParameter)
+	}
+	if b.blockSize == 0 {
+		if _, _, err := b.ReadCapacity(); err != nil {
+			return nil, err
+		}
+	}
+
+	cdb := make([]byte, 10)
+	cdb[0] = op
+	binary.BigEndian.PutUint32(cdb[2:6], lba)
+	binary.BigEndian.PutUint16(cdb[7:9], uint16(count))
+	return cdb, nil
+}
+
+// Read10 reads count blocks starting at lba with READ(10). A device that
+// returns less data than requested yields the shorter slice.
+func (b *BOT) Read10(lba, count uint32) ([]byte, error) {
+	cdb, err := b.rw10(SCSI_READ_10, lba, count)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, int(count)*int(b.blockSize))
+	n, err := b.command("read", cdb, data, true)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+// Write10 writes data, a whole number of blocks, starting at lba with
+// WRITE(10), sent in the data phase of a host-to-device CBW. A device that
+// reports a residue, having accepted less than all of it, returns an error
+// saying how much it took.
+func (b *BOT) Write10(lba uint32, data []byte) error {
+	if b.blockSize == 0 {
+		if _, _, err := b.ReadCapacity(); err != nil {
+			return err
+		}
+	}
+	if len(data)%int(b.blockSize) != 0 {
+		return fmt.Errorf("write of %d bytes is not a multiple of the %d-byte block: %w", len(data), b.blockSize, usb.ErrInvalidParameter)
+	}
+	cdb, err := b.rw10(SCSI_WRITE_10, lba, uint32(len(data)/int(b.blockSize)))
+	if err != nil {
+		return err
+	}
+	n, err := b.command("write", cdb, data, false)
+	if err != nil {
+		return err
+	}
+	if n < len(data) {
+		return fmt.Errorf("write: device took %d of %d bytes: %w", n, len(data), usb.ErrIO)
+	}
+	return nil
+}
+
+// inquiryLength is the length of standard INQUIRY data up to the revision
+const inquiryLength = 36
+
+// InquiryData is the standard INQUIRY data of a logical unit
+type InquiryData struct {
+	PeripheralQualifier uint8
+	PeripheralType      uint8 // 0x00 for a direct-access block device, 0x05 for a CD/DVD
+	Removable           bool
+	Version             uint8
+	Vendor              string
+	Product             string
+	Revision            string
+}
+
+// DecodeInquiry decodes standard INQUIRY data. Devices that return less than
+// the 36 bytes holding the identification strings leave the missing ones
+// empty.
+func DecodeInquiry(data []byte) InquiryData {
+	var d InquiryData
+	if len(data) < 3 {
+		return d
+	}
+	d.PeripheralQualifier = data[0] >> 5
+	d.PeripheralType = data[0] & 0x1f
+	d.Removable = data[1]&0x80 != 0
+	d.Version = data[2]
+	d.Vendor = inquiryString(data, 8, 16)
+	d.Product = inquiryString(data, 16, 32)
+	d.Revision = inquiryString(data, 32, 36)
+	return d
+}
+
+// inquiryString returns the space-padded ASCII field data[start:end], or as
+// much of it as data holds
+func inquiryString(data []byte, start, end int) string {
+	if len(data) <= start {
+		return ""
+	}
+	return string(bytes.TrimRight(data[start:min(end, len(data))], " \x00"))
+}
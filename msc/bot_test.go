@@ -0,0 +1,207 @@
+package msc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+func TestBuildCBW(t *testing.T) {
+	cbw := buildCBW(7, 1, []byte{SCSI_READ_10, 0, 0, 0, 0, 0x10, 0, 0, 0x02, 0}, 1024, true)
+	want, _ := hex.DecodeString("55534243" + "07000000" + "00040000" + "80" + "01" + "0a" + "28000000001000000200" + "000000000000")
+	if !bytes.Equal(cbw, want) {
+		t.Errorf("buildCBW() = %x, want %x", cbw, want)
+	}
+}
+
+func TestParseCSW(t *testing.T) {
+	csw := func(sig, tag, residue uint32, status uint8) []byte {
+		b := make([]byte, cswLength)
+		for i := 0; i < 4; i++ {
+			b[i] = byte(sig >> (8 * i))
+			b[4+i] = byte(tag >> (8 * i))
+			b[8+i] = byte(residue >> (8 * i))
+		}
+		b[12] = status
+		return b
+	}
+
+	status, residue, err := parseCSW(csw(CSW_SIGNATURE, 5, 12, CSWStatusPassed), 5, 36)
+	if err != nil || status != CSWStatusPassed || residue != 12 {
+		t.Errorf("parseCSW() = %d, %d, %v, want 0, 12, nil", status, residue, err)
+	}
+	if status, _, err := parseCSW(csw(CSW_SIGNATURE, 5, 0, CSWStatusPhaseError), 5, 0); err != nil || status != CSWStatusPhaseError {
+		t.Errorf("parseCSW() of a phase error = %d, %v", status, err)
+	}
+
+	invalid := map[string][]byte{
+		"tag_mismatch":    csw(CSW_SIGNATURE, 4, 0, CSWStatusPassed),
+		"bad_signature":   csw(CBW_SIGNATURE, 5, 0, CSWStatusPassed),
+		"residue_too_big": csw(CSW_SIGNATURE, 5, 37, CSWStatusPassed),
+		"bad_status":      csw(CSW_SIGNATURE, 5, 0, 3),
+		"short":           csw(CSW_SIGNATURE, 5, 0, CSWStatusPassed)[:12],
+	}
+	for name, b := range invalid {
+		if _, _, err := parseCSW(b, 5, 36); err == nil {
+			t.Errorf("parseCSW() of %s succeeded, want an error", name)
+		}
+	}
+}
+
+func TestDecodeInquiry(t *testing.T) {
+	data := append([]byte{0x00, 0x80, 0x06, 0x02, 0x1f, 0, 0, 0}, []byte("SanDisk Ultra           1.00")...)
+	got := DecodeInquiry(data)
+	want := InquiryData{PeripheralType: 0x00, Removable: true, Version: 6, Vendor: "SanDisk", Product: "Ultra", Revision: "1.00"}
+	if got != want {
+		t.Errorf("DecodeInquiry() = %+v, want %+v", got, want)
+	}
+
+	// A device that stops after the product identification
+	if got := DecodeInquiry(data[:24]); got.Vendor != "SanDisk" || got.Product != "Ultra" || got.Revision != "" {
+		t.Errorf("DecodeInquiry() of 24 bytes = %+v", got)
+	}
+}
+
+func TestRW10(t *testing.T) {
+	b := &BOT{blockSize: 512}
+	cdb, err := b.rw10(SCSI_WRITE_10, 0x00123456, 3)
+	if err != nil {
+		t.Fatalf("rw10() error = %v", err)
+	}
+	want := []byte{SCSI_WRITE_10, 0, 0x00, 0x12, 0x34, 0x56, 0, 0x00, 0x03, 0}
+	if !bytes.Equal(cdb, want) {
+		t.Errorf("rw10() = %x, want %x", cdb, want)
+	}
+	if _, err := b.rw10(SCSI_WRITE_10, 0, 0x10000); !errors.Is(err, usb.ErrInvalidParameter) {
+		t.Errorf("rw10() of 65536 blocks error = %v, want ErrInvalidParameter", err)
+	}
+	if err := b.Write10(0, make([]byte, 700)); !errors.Is(err, usb.ErrInvalidParameter) {
+		t.Errorf("Write10() of a partial block error = %v, want ErrInvalidParameter", err)
+	}
+}
+
+// newMockBOT returns a transport to a mock Bulk-Only device, on bulk
+// endpoints 0x81 and 0x02 of interface 0, whose commands respond answers with
+// their data phase and CSW status
+func newMockBOT(t *testing.T, respond func(cdb []byte) ([]byte, uint8)) *BOT {
+	t.Helper()
+	config, _ := hex.DecodeString(
+		"090220000101008032" + // Configuration 1, 32 bytes
+			"090400000208065000" + // Interface 0, Mass Storage, SCSI, Bulk-Only
+			"0705810200020007050202000200") // Bulk IN 0x81 and OUT 0x02
+
+	// What the device sends on 0x81, in order: data phases and CSWs
+	var queue [][]byte
+	dev := &usb.MockDevice{
+		Bus:        1,
+		Address:    9,
+		Descriptor: usb.DeviceDescriptor{VendorID: 0x0781, NumConfigurations: 1},
+		Configs:    [][]byte{config},
+		Endpoints: map[uint8]func([]byte) (int, error){
+			0x02: func(data []byte) (int, error) {
+				if len(data) != cbwLength || binary.LittleEndian.Uint32(data[0:4]) != CBW_SIGNATURE {
+					return len(data), nil // The data phase of a write
+				}
+				length := int(binary.LittleEndian.Uint32(data[8:12]))
+				reply, status := respond(data[15 : 15+data[14]])
+				if data[12]&0x80 != 0 {
+					reply = reply[:min(len(reply), length)]
+					queue = append(queue, reply)
+				} else {
+					reply = nil
+				}
+				csw := make([]byte, cswLength)
+				binary.LittleEndian.PutUint32(csw[0:4], CSW_SIGNATURE)
+				copy(csw[4:8], data[4:8])
+				binary.LittleEndian.PutUint32(csw[8:12], uint32(length-len(reply)))
+				if data[12]&0x80 == 0 {
+					binary.LittleEndian.PutUint32(csw[8:12], 0)
+				}
+				csw[12] = status
+				queue = append(queue, csw)
+				return len(data), nil
+			},
+			0x81: func(data []byte) (int, error) {
+				if len(queue) == 0 {
+					return 0, usb.ErrTimeout
+				}
+				next := queue[0]
+				queue = queue[1:]
+				return copy(data, next), nil
+			},
+		},
+	}
+	usb.SetBackend(usb.NewMockBackend(dev))
+	t.Cleanup(func() { usb.SetBackend(nil) })
+
+	devices, err := usb.DeviceList()
+	if err != nil || len(devices) != 1 {
+		t.Fatalf("DeviceList() = %v, %v, want the mock device", devices, err)
+	}
+	h, err := devices[0].Open()
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return NewBulkOnlyTransport(h, 0x81, 0x02)
+}
+
+func TestReadCapacity(t *testing.T) {
+	capacity10 := func(lastLBA, blockSize uint32) []byte {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint32(b[0:4], lastLBA)
+		binary.BigEndian.PutUint32(b[4:8], blockSize)
+		return b
+	}
+	capacity16 := func(lastLBA uint64, blockSize uint32) []byte {
+		b := make([]byte, 32)
+		binary.BigEndian.PutUint64(b[0:8], lastLBA)
+		binary.BigEndian.PutUint32(b[8:12], blockSize)
+		return b
+	}
+
+	tests := []struct {
+		name          string
+		reply10       []byte
+		reply16       []byte // nil if READ CAPACITY(16) must not be sent
+		wantBlocks    uint64
+		wantBlockSize uint32
+		wantErr       bool
+	}{
+		{name: "capacity_10", reply10: capacity10(0x0003ffff, 512), wantBlocks: 0x40000, wantBlockSize: 512},
+		{name: "capacity_16", reply10: capacity10(0xffffffff, 512), reply16: capacity16(0x1d1c0beaf, 4096), wantBlocks: 0x1d1c0beb0, wantBlockSize: 4096},
+		{name: "zero_block_size", reply10: capacity10(0x0003ffff, 0), wantErr: true},
+		{name: "zero_block_size_16", reply10: capacity10(0xffffffff, 512), reply16: capacity16(0x1d1c0beaf, 0), wantErr: true},
+		{name: "short", reply10: capacity10(0x0003ffff, 512)[:6], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newMockBOT(t, func(cdb []byte) ([]byte, uint8) {
+				switch {
+				case cdb[0] == SCSI_READ_CAPACITY:
+					return tt.reply10, CSWStatusPassed
+				case cdb[0] == SCSI_SERVICE_ACTION_IN && cdb[1] == serviceActionReadCapacity16 && tt.reply16 != nil:
+					if len(cdb) != 16 || binary.BigEndian.Uint32(cdb[10:14]) != 32 {
+						t.Errorf("READ CAPACITY(16) CDB = %x", cdb)
+					}
+					return tt.reply16, CSWStatusPassed
+				}
+				t.Errorf("unexpected command %x", cdb)
+				return nil, CSWStatusFailed
+			})
+
+			blocks, blockSize, err := b.ReadCapacity()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadCapacity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (blocks != tt.wantBlocks || blockSize != tt.wantBlockSize) {
+				t.Errorf("ReadCapacity() = %d, %d, want %d, %d", blocks, blockSize, tt.wantBlocks, tt.wantBlockSize)
+			}
+		})
+	}
+}
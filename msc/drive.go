@@ -0,0 +1,125 @@
+package msc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+// SCSI operation codes
+const (
+	SCSI_TEST_UNIT_READY = 0x00
+	SCSI_REQUEST_SENSE   = 0x03
+	SCSI_INQUIRY         = 0x12
+	SCSI_READ_CAPACITY   = 0x25
+	SCSI_READ_10         = 0x28
+	SCSI_WRITE_10        = 0x2a
+
+	SCSI_SERVICE_ACTION_IN = 0x9e // With service action 0x10, READ CAPACITY(16)
+)
+
+// serviceActionReadCapacity16 selects READ CAPACITY(16) among the SERVICE
+// ACTION IN(16) commands
+const serviceActionReadCapacity16 = 0x10
+
+// readyPollInterval is how long WaitReady waits between TEST UNIT READY
+// commands while the drive reports NOT READY or UNIT ATTENTION
+const readyPollInterval = 250 * time.Millisecond
+
+// SenseError is returned when a drive fails a command, with the sense data
+// that explains why
+type SenseError struct {
+	Command string
+	Sense   SenseInfo
+}
+
+func (e *SenseError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Command, e.Sense)
+}
+
+// Drive is one logical unit of a Mass Storage device using the Bulk-Only
+// Transport, whose commands it runs. It is not safe for concurrent use.
+type Drive struct {
+	*BOT
+}
+
+// NewDrive returns the drive behind Bulk-Only interface iface, addressing
+// LUN 0. The interface must already be claimed, with any kernel driver such
+// as usb-storage detached. On an interface that also offers UAS (see
+// DetectProtocol) the Bulk-Only alternate setting is selected, and an
+// interface offering UAS alone returns usb.ErrNotSupported.
+func NewDrive(handle *usb.DeviceHandle, iface uint8) (*Drive, error) {
+	config, err := handle.GetActiveConfigDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	var altSetting uint8
+	alt := protocolAltSetting(config, iface, ProtocolBOT)
+	if alt == nil && protocolAltSetting(config, iface, ProtocolUAS) != nil {
+		return nil, fmt.Errorf("interface %d offers only UAS: %w", iface, usb.ErrNotSupported)
+	}
+	if alt != nil && alt.AlternateSetting != 0 {
+		altSetting = alt.AlternateSetting
+		if err := handle.SetInterfaceAltSetting(iface, altSetting); err != nil {
+			return nil, fmt.Errorf("select Bulk-Only setting of interface %d: %w", iface, err)
+		}
+	}
+	in, ok := config.Endpoint(iface, altSetting, usb.TransferTypeBulk, usb.EndpointDirectionIn)
+	if !ok {
+		return nil, fmt.Errorf("interface %d has no bulk IN endpoint", iface)
+	}
+	out, ok := config.Endpoint(iface, altSetting, usb.TransferTypeBulk, usb.EndpointDirectionOut)
+	if !ok {
+		return nil, fmt.Errorf("interface %d has no bulk OUT endpoint", iface)
+	}
+
+	bot := NewBulkOnlyTransport(handle, in.EndpointAddr, out.EndpointAddr)
+	bot.iface = int(iface)
+	return &Drive{BOT: bot}, nil
+}
+
+// WaitReady repeats TEST UNIT READY until the drive reports ready or ctx is
+// done. NOT READY, such as a missing medium or one still spinning up, is
+// waited out, as is the UNIT ATTENTION reported after a medium change or
+// reset; both are polled every readyPollInterval, so a drive repeating UNIT
+// ATTENTION is not flooded with commands. Any other failure is returned.
+func (d *Drive) WaitReady(ctx context.Context) error {
+	for {
+		err := d.TestUnitReady()
+		if err == nil {
+			return nil
+		}
+
+		var senseErr *SenseError
+		if !errors.As(err, &senseErr) {
+			return err
+		}
+		switch senseErr.Sense.Key {
+		case SenseUnitAttention, SenseNotReady:
+		default:
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for drive: %w (last error: %v)", ctx.Err(), senseErr)
+		case <-time.After(readyPollInterval):
+		}
+	}
+}
+
+// ReadBlocks reads count blocks starting at lba. The block size is taken
+// from ReadCapacity, which is called first if it has not been yet.
+func (d *Drive) ReadBlocks(lba uint32, count uint16) ([]byte, error) {
+	return d.Read10(lba, uint32(count))
+}
+
+// WriteBlocks writes data, a whole number of blocks, starting at lba. It
+// succeeds only once the drive has reported the WRITE(10) passed with a
+// residue of zero, so a write the drive took only part of is an error.
+func (d *Drive) WriteBlocks(lba uint32, data []byte) error {
+	return d.Write10(lba, data)
+}
@@ -0,0 +1,94 @@
+package msc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fixedSense returns fixed format sense data of key, asc and ascq
+func fixedSense(key SenseKey, asc, ascq uint8) []byte {
+	sense := make([]byte, 18)
+	sense[0] = 0x70
+	sense[2] = byte(key)
+	sense[7] = 10
+	sense[12] = asc
+	sense[13] = ascq
+	return sense
+}
+
+func TestWaitReady(t *testing.T) {
+	unitAttention := fixedSense(SenseUnitAttention, 0x28, 0x00) // Medium may have changed
+	notReady := fixedSense(SenseNotReady, 0x04, 0x01)           // Becoming ready
+	mediumError := fixedSense(SenseMediumError, 0x11, 0x00)     // Unrecovered read error
+
+	tests := []struct {
+		name    string
+		senses  [][]byte // Sense of each failed TEST UNIT READY before the last
+		ready   bool     // Whether the last TEST UNIT READY passes
+		timeout time.Duration
+		want    error // nil, context.DeadlineExceeded or a *SenseError
+		wantTUR int   // TEST UNIT READY commands sent, 0 for at most two
+	}{
+		{name: "ready", ready: true, timeout: time.Second, wantTUR: 1},
+		{name: "unit_attention", senses: [][]byte{unitAttention}, ready: true, timeout: time.Second, wantTUR: 2},
+		{name: "not_ready", senses: [][]byte{notReady, unitAttention}, ready: true, timeout: 2 * time.Second, wantTUR: 3},
+		{name: "medium_error", senses: [][]byte{mediumError}, timeout: time.Second, want: &SenseError{}, wantTUR: 1},
+		{name: "never_ready", senses: [][]byte{notReady}, timeout: 100 * time.Millisecond, want: context.DeadlineExceeded},
+		{name: "repeated_unit_attention", senses: [][]byte{unitAttention}, timeout: 100 * time.Millisecond, want: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			turs := 0
+			var sense []byte
+			b := newMockBOT(t, func(cdb []byte) ([]byte, uint8) {
+				switch cdb[0] {
+				case SCSI_TEST_UNIT_READY:
+					turs++
+					if turs <= len(tt.senses) {
+						sense = tt.senses[turs-1]
+					} else if tt.ready {
+						return nil, CSWStatusPassed
+					} else {
+						// The last sense repeats until ctx is done
+						sense = tt.senses[len(tt.senses)-1]
+					}
+					return nil, CSWStatusFailed
+				case SCSI_REQUEST_SENSE:
+					return sense, CSWStatusPassed
+				}
+				t.Errorf("unexpected command %x", cdb)
+				return nil, CSWStatusFailed
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			err := (&Drive{BOT: b}).WaitReady(ctx)
+			switch want := tt.want.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("WaitReady() error = %v", err)
+				}
+			case *SenseError:
+				var senseErr *SenseError
+				if !errors.As(err, &senseErr) || senseErr.Sense.Key != SenseMediumError {
+					t.Fatalf("WaitReady() error = %v, want a MEDIUM ERROR *SenseError", err)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Fatalf("WaitReady() error = %v, want %v", err, want)
+				}
+			}
+			// Retries wait readyPollInterval, so a drive that never becomes
+			// ready sees at most one retry before the timeout
+			if tt.wantTUR != 0 && turs != tt.wantTUR {
+				t.Errorf("WaitReady() sent %d TEST UNIT READY, want %d", turs, tt.wantTUR)
+			}
+			if tt.wantTUR == 0 && turs > 2 {
+				t.Errorf("WaitReady() sent %d TEST UNIT READY in %v, want at most 2", turs, tt.timeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package msc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"unicode/utf16"
+)
+
+// PartitionScheme is the kind of partition table found on a drive
+type PartitionScheme int
+
+const (
+	PartitionSchemeMBR PartitionScheme = iota
+	PartitionSchemeGPT
+)
+
+func (s PartitionScheme) String() string {
+	switch s {
+	case PartitionSchemeMBR:
+		return "MBR"
+	case PartitionSchemeGPT:
+		return "GPT"
+	default:
+		return fmt.Sprintf("PartitionScheme(%d)", int(s))
+	}
+}
+
+// ErrNoPartitionTable is returned by ReadPartitionTable when block 0 holds
+// neither an MBR nor a protective MBR, as on a drive formatted without
+// partitions
+var ErrNoPartitionTable = errors.New("no partition table")
+
+// GUID is a GPT type or partition GUID in its on-disk byte order
+type GUID [16]byte
+
+// String formats the GUID in the usual text form, in which the first three
+// fields are little-endian on disk
+func (g GUID) String() string {
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X",
+		binary.LittleEndian.Uint32(g[0:4]),
+		binary.LittleEndian.Uint16(g[4:6]),
+		binary.LittleEndian.Uint16(g[6:8]),
+		g[8:10], g[10:16])
+}
+
+// IsZero reports whether the GUID is all zeros, which marks an unused entry
+func (g GUID) IsZero() bool {
+	return g == GUID{}
+}
+
+// Partition is one entry of an MBR or GPT partition table
+type Partition struct {
+	Scheme PartitionScheme
+	Number int // 1-based position in the table
+
+	// MBRType is the partition type byte of an MBR entry
+	MBRType  uint8
+	Bootable bool
+
+	// TypeGUID, GUID, Name and Attributes are only set for GPT entries
+	TypeGUID   GUID
+	GUID       GUID
+	Name       string
+	Attributes uint64
+
+	StartLBA uint64
+	Blocks   uint64
+}
+
+// EndLBA returns the address of the last block of the partition
+func (p Partition) EndLBA() uint64 {
+	return p.StartLBA + p.Blocks - 1
+}
+
+const (
+	mbrSignatureOffset  = 510
+	mbrEntriesOffset    = 446
+	mbrEntryLength      = 16
+	mbrTypeProtective   = 0xee
+	gptSignature        = "EFI PART"
+	gptHeaderMinLength  = 92
+	gptEntryMinLength   = 128
+	gptEntryMaxLength   = 4096
+	gptMaxEntries       = 1024
+	gptMaxEntriesLength = 1 << 20
+)
+
+// ReadPartitionTable reads the partition table of the drive. A protective
+// MBR is followed to the GPT behind it, whose header and entry array are
+// checked against their CRCs; if the primary GPT is damaged the backup copy
+// at the end of the drive is used instead. For an MBR only the four primary
+// entries are returned, so an extended partition appears as a single entry.
+func ReadPartitionTable(drive *Drive) ([]Partition, error) {
+	blocks, blockSize, err := drive.ReadCapacity()
+	if err != nil {
+		return nil, err
+	}
+	return readPartitionTable(func(lba uint64, count int) ([]byte, error) {
+		if lba > math.MaxUint32 || count > math.MaxUint16 {
+			return nil, fmt.Errorf("block %d out of range for READ(10)", lba)
+		}
+		return drive.ReadBlocks(uint32(lba), uint16(count))
+	}, int(blockSize), blocks)
+}
+
+// readPartitionTable does the work of ReadPartitionTable with read, which
+// returns count blocks starting at lba, on a drive of the given size
+func readPartitionTable(read func(lba uint64, count int) ([]byte, error), blockSize int, blocks uint64) ([]Partition, error) {
+	if blockSize < 512 {
+		return nil, fmt.Errorf("unsupported block size %d", blockSize)
+	}
+
+	mbr, err := read(0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(mbr) < 512 || mbr[mbrSignatureOffset] != 0x55 || mbr[mbrSignatureOffset+1] != 0xaa {
+		return nil, ErrNoPartitionTable
+	}
+
+	var parts []Partition
+	protective := false
+	for i := 0; i < 4; i++ {
+		entry := mbr[mbrEntriesOffset+i*mbrEntryLength:][:mbrEntryLength]
+		// A boot sector without a partition table has the same signature,
+		// but its code rarely leaves valid status bytes here
+		if entry[0] != 0x00 && entry[0] != 0x80 {
+			return nil, ErrNoPartitionTable
+		}
+		if entry[4] == 0 {
+			continue
+		}
+		if entry[4] == mbrTypeProtective {
+			protective = true
+		}
+		parts = append(parts, Partition{
+			Scheme:   PartitionSchemeMBR,
+			Number:   i + 1,
+			MBRType:  entry[4],
+			Bootable: entry[0] == 0x80,
+			StartLBA: uint64(binary.LittleEndian.Uint32(entry[8:12])),
+			Blocks:   uint64(binary.LittleEndian.Uint32(entry[12:16])),
+		})
+	}
+	if !protective {
+		return parts, nil
+	}
+
+	gpt, primaryErr := readGPT(read, blockSize, 1)
+	if primaryErr == nil {
+		return gpt, nil
+	}
+	if blocks < 2 {
+		return nil, fmt.Errorf("primary GPT: %w", primaryErr)
+	}
+	gpt, err = readGPT(read, blockSize, blocks-1)
+	if err != nil {
+		return nil, fmt.Errorf("primary GPT: %v; backup GPT: %w", primaryErr, err)
+	}
+	return gpt, nil
+}
+
+// readGPT reads and verifies the GPT header at headerLBA and its entries
+func readGPT(read func(lba uint64, count int) ([]byte, error), blockSize int, headerLBA uint64) ([]Partition, error) {
+	header, err := read(headerLBA, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(header) < gptHeaderMinLength || string(header[0:8]) != gptSignature {
+		return nil, fmt.Errorf("missing GPT header signature at block %d", headerLBA)
+	}
+
+	headerSize := int(binary.LittleEndian.Uint32(header[12:16]))
+	if headerSize < gptHeaderMinLength || headerSize > len(header) {
+		return nil, fmt.Errorf("invalid GPT header size %d", headerSize)
+	}
+	want := binary.LittleEndian.Uint32(header[16:20])
+	check := make([]byte, headerSize)
+	copy(check, header)
+	clear(check[16:20])
+	if got := crc32.ChecksumIEEE(check); got != want {
+		return nil, fmt.Errorf("GPT header CRC 0x%08x does not match 0x%08x", got, want)
+	}
+	if myLBA := binary.LittleEndian.Uint64(header[24:32]); myLBA != headerLBA {
+		return nil, fmt.Errorf("GPT header at block %d claims to be at block %d", headerLBA, myLBA)
+	}
+
+	entriesLBA := binary.LittleEndian.Uint64(header[72:80])
+	// Both fields come from the disk, so each is bounded before they are
+	// multiplied
+	numEntries := int64(binary.LittleEndian.Uint32(header[80:84]))
+	entrySize := int64(binary.LittleEndian.Uint32(header[84:88]))
+	if entrySize < gptEntryMinLength || entrySize > gptEntryMaxLength || entrySize&(entrySize-1) != 0 {
+		return nil, fmt.Errorf("invalid GPT entry size %d", entrySize)
+	}
+	if numEntries > gptMaxEntries || numEntries*entrySize > gptMaxEntriesLength {
+		return nil, fmt.Errorf("GPT entry array of %d entries is too large", numEntries)
+	}
+	length := int(numEntries * entrySize)
+
+	entries, err := read(entriesLBA, (length+blockSize-1)/blockSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) < length {
+		return nil, fmt.Errorf("short read of GPT entries: %d of %d bytes", len(entries), length)
+	}
+	entries = entries[:length]
+	if got, want := crc32.ChecksumIEEE(entries), binary.LittleEndian.Uint32(header[88:92]); got != want {
+		return nil, fmt.Errorf("GPT entries CRC 0x%08x does not match 0x%08x", got, want)
+	}
+
+	var parts []Partition
+	for i := 0; i < int(numEntries); i++ {
+		entry := entries[i*int(entrySize):][:entrySize]
+		var typeGUID GUID
+		copy(typeGUID[:], entry[0:16])
+		if typeGUID.IsZero() {
+			continue
+		}
+
+		p := Partition{
+			Scheme:     PartitionSchemeGPT,
+			Number:     i + 1,
+			TypeGUID:   typeGUID,
+			StartLBA:   binary.LittleEndian.Uint64(entry[32:40]),
+			Attributes: binary.LittleEndian.Uint64(entry[48:56]),
+			Name:       decodeGPTName(entry[56:128]),
+		}
+		copy(p.GUID[:], entry[16:32])
+		if last := binary.LittleEndian.Uint64(entry[40:48]); last >= p.StartLBA {
+			p.Blocks = last - p.StartLBA + 1
+		}
+		parts = append(parts, p)
+	}
+	return parts, nil
+}
+
+// decodeGPTName decodes a NUL-padded UTF-16LE partition name
+func decodeGPTName(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		u := binary.LittleEndian.Uint16(data[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
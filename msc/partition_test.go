@@ -0,0 +1,198 @@
+package msc
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+	"unicode/utf16"
+)
+
+const testBlockSize = 512
+
+// testDisk is an in-memory drive for readPartitionTable
+type testDisk []byte
+
+func (d testDisk) read(lba uint64, count int) ([]byte, error) {
+	start := int(lba) * testBlockSize
+	end := start + count*testBlockSize
+	if end > len(d) {
+		return nil, errors.New("read past end of disk")
+	}
+	return d[start:end], nil
+}
+
+func (d testDisk) blocks() uint64 {
+	return uint64(len(d) / testBlockSize)
+}
+
+func newMBRDisk(blocks int, entries ...[16]byte) testDisk {
+	d := make(testDisk, blocks*testBlockSize)
+	for i, e := range entries {
+		copy(d[mbrEntriesOffset+i*mbrEntryLength:], e[:])
+	}
+	d[510], d[511] = 0x55, 0xaa
+	return d
+}
+
+func mbrEntry(status, typ uint8, start, size uint32) [16]byte {
+	var e [16]byte
+	e[0] = status
+	e[4] = typ
+	binary.LittleEndian.PutUint32(e[8:12], start)
+	binary.LittleEndian.PutUint32(e[12:16], size)
+	return e
+}
+
+// writeGPT writes a GPT header at headerLBA with 128 entries at entriesLBA
+func writeGPT(d testDisk, headerLBA, entriesLBA uint64, parts ...Partition) {
+	entries := make([]byte, 128*128)
+	for i, p := range parts {
+		e := entries[i*128:]
+		copy(e[0:16], p.TypeGUID[:])
+		copy(e[16:32], p.GUID[:])
+		binary.LittleEndian.PutUint64(e[32:40], p.StartLBA)
+		binary.LittleEndian.PutUint64(e[40:48], p.EndLBA())
+		binary.LittleEndian.PutUint64(e[48:56], p.Attributes)
+		for j, u := range utf16.Encode([]rune(p.Name)) {
+			binary.LittleEndian.PutUint16(e[56+2*j:], u)
+		}
+	}
+	copy(d[int(entriesLBA)*testBlockSize:], entries)
+
+	h := d[int(headerLBA)*testBlockSize:][:92]
+	copy(h[0:8], gptSignature)
+	binary.LittleEndian.PutUint32(h[8:12], 0x00010000)
+	binary.LittleEndian.PutUint32(h[12:16], 92)
+	binary.LittleEndian.PutUint64(h[24:32], headerLBA)
+	binary.LittleEndian.PutUint64(h[72:80], entriesLBA)
+	binary.LittleEndian.PutUint32(h[80:84], 128)
+	binary.LittleEndian.PutUint32(h[84:88], 128)
+	binary.LittleEndian.PutUint32(h[88:92], crc32.ChecksumIEEE(entries))
+	binary.LittleEndian.PutUint32(h[16:20], crc32.ChecksumIEEE(h))
+}
+
+var (
+	// EFI System Partition and Microsoft basic data type GUIDs, as stored on disk
+	efiSystemGUID = GUID{0x28, 0x73, 0x2a, 0xc1, 0x1f, 0xf8, 0xd2, 0x11, 0xba, 0x4b, 0x00, 0xa0, 0xc9, 0x3e, 0xc9, 0x3b}
+	basicDataGUID = GUID{0xa2, 0xa0, 0xd0, 0xeb, 0xe5, 0xb9, 0x33, 0x44, 0x87, 0xc0, 0x68, 0xb6, 0xb7, 0x26, 0x99, 0xc7}
+)
+
+func newGPTDisk() (testDisk, []Partition) {
+	parts := []Partition{
+		{Scheme: PartitionSchemeGPT, Number: 1, TypeGUID: efiSystemGUID, GUID: GUID{1}, StartLBA: 40, Blocks: 100, Name: "EFI system"},
+		{Scheme: PartitionSchemeGPT, Number: 2, TypeGUID: basicDataGUID, GUID: GUID{2}, StartLBA: 140, Blocks: 800, Name: "Données", Attributes: 1},
+	}
+	d := newMBRDisk(1024, mbrEntry(0x00, mbrTypeProtective, 1, 1023))
+	writeGPT(d, 1, 2, parts...)
+	writeGPT(d, 1023, 990, parts...)
+	return d, parts
+}
+
+func checkPartitions(t *testing.T, got, want []Partition) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d partitions, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("partition %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadPartitionTableMBR(t *testing.T) {
+	d := newMBRDisk(16,
+		mbrEntry(0x80, 0x0c, 2048, 4096),
+		mbrEntry(0x00, 0x00, 0, 0),
+		mbrEntry(0x00, 0x83, 6144, 1000))
+
+	got, err := readPartitionTable(d.read, testBlockSize, d.blocks())
+	if err != nil {
+		t.Fatalf("readPartitionTable() error = %v", err)
+	}
+	checkPartitions(t, got, []Partition{
+		{Scheme: PartitionSchemeMBR, Number: 1, MBRType: 0x0c, Bootable: true, StartLBA: 2048, Blocks: 4096},
+		{Scheme: PartitionSchemeMBR, Number: 3, MBRType: 0x83, StartLBA: 6144, Blocks: 1000},
+	})
+}
+
+func TestReadPartitionTableGPT(t *testing.T) {
+	d, want := newGPTDisk()
+	got, err := readPartitionTable(d.read, testBlockSize, d.blocks())
+	if err != nil {
+		t.Fatalf("readPartitionTable() error = %v", err)
+	}
+	checkPartitions(t, got, want)
+
+	if s := got[0].TypeGUID.String(); s != "C12A7328-F81F-11D2-BA4B-00A0C93EC93B" {
+		t.Errorf("TypeGUID.String() = %s", s)
+	}
+}
+
+func TestReadPartitionTableGPTBackup(t *testing.T) {
+	d, want := newGPTDisk()
+	// Corrupt the primary entry array so its CRC no longer matches
+	d[2*testBlockSize] ^= 0xff
+
+	got, err := readPartitionTable(d.read, testBlockSize, d.blocks())
+	if err != nil {
+		t.Fatalf("readPartitionTable() error = %v", err)
+	}
+	checkPartitions(t, got, want)
+
+	// With the backup header damaged too there is nothing to fall back on
+	d[1023*testBlockSize+16] ^= 0xff
+	if _, err := readPartitionTable(d.read, testBlockSize, d.blocks()); err == nil {
+		t.Error("readPartitionTable() with both GPTs damaged succeeded, want error")
+	}
+}
+
+func TestReadPartitionTableNone(t *testing.T) {
+	tests := []struct {
+		name string
+		disk testDisk
+	}{
+		{"blank", make(testDisk, 4*testBlockSize)},
+		// A FAT boot sector carries the signature but no partition entries
+		{"superfloppy", func() testDisk {
+			d := newMBRDisk(4, mbrEntry(0x4e, 0x4f, 0x20, 0x4e))
+			return d
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readPartitionTable(tt.disk.read, testBlockSize, tt.disk.blocks())
+			if !errors.Is(err, ErrNoPartitionTable) {
+				t.Errorf("readPartitionTable() error = %v, want ErrNoPartitionTable", err)
+			}
+		})
+	}
+}
+
+func TestReadPartitionTableGPTBadEntryArray(t *testing.T) {
+	tests := []struct {
+		name                  string
+		numEntries, entrySize uint32
+	}{
+		{"entry_size_not_power_of_two", 128, 136},
+		{"entry_size_too_large", 1, 8192},
+		{"too_many_entries", 1 << 31, 128},
+		{"overflowing_product", 0xffffffff, 0x80000000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newGPTDisk()
+			for _, lba := range []int{1, 1023} {
+				h := d[lba*testBlockSize:][:92]
+				binary.LittleEndian.PutUint32(h[80:84], tt.numEntries)
+				binary.LittleEndian.PutUint32(h[84:88], tt.entrySize)
+				clear(h[16:20])
+				binary.LittleEndian.PutUint32(h[16:20], crc32.ChecksumIEEE(h))
+			}
+			if _, err := readPartitionTable(d.read, testBlockSize, d.blocks()); err == nil {
+				t.Error("readPartitionTable() succeeded, want error")
+			}
+		})
+	}
+}
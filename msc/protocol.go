@@ -0,0 +1,98 @@
+package msc
+
+import (
+	"fmt"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+// CLASS_MASS_STORAGE is the interface class of Mass Storage devices
+const CLASS_MASS_STORAGE = 0x08
+
+// Protocol is a Mass Storage transport, the bInterfaceProtocol of the
+// interface's alternate settings
+type Protocol uint8
+
+const (
+	ProtocolCBI      Protocol = 0x00 // Control/Bulk/Interrupt with command completion
+	ProtocolCBINoIRQ Protocol = 0x01 // Control/Bulk/Interrupt without it
+	ProtocolBOT      Protocol = 0x50 // Bulk-Only Transport
+	ProtocolUAS      Protocol = 0x62 // USB Attached SCSI
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolCBI, ProtocolCBINoIRQ:
+		return "CBI"
+	case ProtocolBOT:
+		return "BOT"
+	case ProtocolUAS:
+		return "UAS"
+	default:
+		return fmt.Sprintf("Protocol(0x%02x)", uint8(p))
+	}
+}
+
+// DetectProtocol reports the best transport the Mass Storage interface iface
+// offers across its alternate settings. UAS is preferred, as it queues
+// commands instead of running them one at a time, but at SuperSpeed it
+// needs bulk streams, so a UAS setting whose bulk endpoints have no streams
+// there is skipped. Bulk-Only comes next, and is what most UAS devices put
+// in alternate setting 0. An interface with neither returns
+// usb.ErrNotSupported.
+func DetectProtocol(handle *usb.DeviceHandle, iface uint8) (Protocol, error) {
+	config, err := handle.GetActiveConfigDescriptor()
+	if err != nil {
+		return 0, err
+	}
+	speed, err := handle.GetSpeed()
+	if err != nil {
+		speed = usb.SpeedUnknown
+	}
+	return detectProtocol(config, iface, speed)
+}
+
+func detectProtocol(config *usb.ConfigDescriptor, iface uint8, speed usb.Speed) (Protocol, error) {
+	if config.Interface(iface) == nil {
+		return 0, fmt.Errorf("interface %d: %w", iface, usb.ErrNotFound)
+	}
+	if alt := protocolAltSetting(config, iface, ProtocolUAS); alt != nil && uasUsable(alt, speed) {
+		return ProtocolUAS, nil
+	}
+	if protocolAltSetting(config, iface, ProtocolBOT) != nil {
+		return ProtocolBOT, nil
+	}
+	return 0, fmt.Errorf("interface %d has no Bulk-Only or UAS setting: %w", iface, usb.ErrNotSupported)
+}
+
+// protocolAltSetting returns the first Mass Storage alternate setting of
+// iface using protocol, or nil
+func protocolAltSetting(config *usb.ConfigDescriptor, iface uint8, protocol Protocol) *usb.InterfaceAltSetting {
+	i := config.Interface(iface)
+	if i == nil {
+		return nil
+	}
+	for a := range i.AltSettings {
+		alt := &i.AltSettings[a]
+		if alt.InterfaceClass == CLASS_MASS_STORAGE && Protocol(alt.InterfaceProtocol) == protocol {
+			return alt
+		}
+	}
+	return nil
+}
+
+// uasUsable reports whether a UAS setting can run at speed. Below
+// SuperSpeed UAS does without streams; from SuperSpeed on every bulk
+// endpoint of the setting must support them.
+func uasUsable(alt *usb.InterfaceAltSetting, speed usb.Speed) bool {
+	if speed < usb.SpeedSuper {
+		return true
+	}
+	for e := range alt.Endpoints {
+		ep := &alt.Endpoints[e]
+		if ep.TransferType() == usb.TransferTypeBulk && !ep.SupportsStreams() {
+			return false
+		}
+	}
+	return true
+}
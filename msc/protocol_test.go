@@ -0,0 +1,96 @@
+package msc
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+func massStorageConfig(streams bool, protocols ...Protocol) *usb.ConfigDescriptor {
+	iface := usb.Interface{}
+	for i, p := range protocols {
+		alt := usb.InterfaceAltSetting{
+			InterfaceNumber:   0,
+			AlternateSetting:  uint8(i),
+			InterfaceClass:    CLASS_MASS_STORAGE,
+			InterfaceSubClass: 0x06,
+			InterfaceProtocol: uint8(p),
+		}
+		for _, addr := range []uint8{0x81, 0x02} {
+			ep := usb.Endpoint{EndpointAddr: addr, Attributes: uint8(usb.TransferTypeBulk)}
+			if p == ProtocolUAS {
+				ep.SSCompanion = &usb.SuperSpeedEndpointCompanionDescriptor{}
+				if streams {
+					ep.SSCompanion.Attributes = 5 // 32 streams
+				}
+			}
+			alt.Endpoints = append(alt.Endpoints, ep)
+		}
+		iface.AltSettings = append(iface.AltSettings, alt)
+	}
+	return &usb.ConfigDescriptor{Interfaces: []usb.Interface{iface}}
+}
+
+func TestDetectProtocol(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *usb.ConfigDescriptor
+		speed  usb.Speed
+		want   Protocol
+	}{
+		{name: "bot_only", config: massStorageConfig(false, ProtocolBOT), speed: usb.SpeedHigh, want: ProtocolBOT},
+		{name: "uas_high_speed", config: massStorageConfig(false, ProtocolBOT, ProtocolUAS), speed: usb.SpeedHigh, want: ProtocolUAS},
+		{name: "uas_super_speed", config: massStorageConfig(true, ProtocolBOT, ProtocolUAS), speed: usb.SpeedSuper, want: ProtocolUAS},
+		{name: "uas_without_streams", config: massStorageConfig(false, ProtocolBOT, ProtocolUAS), speed: usb.SpeedSuper, want: ProtocolBOT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectProtocol(tt.config, 0, tt.speed)
+			if err != nil {
+				t.Fatalf("detectProtocol() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("detectProtocol() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := detectProtocol(massStorageConfig(false, ProtocolCBI), 0, usb.SpeedFull); !errors.Is(err, usb.ErrNotSupported) {
+		t.Errorf("CBI-only interface: error = %v, want ErrNotSupported", err)
+	}
+	if _, err := detectProtocol(massStorageConfig(false, ProtocolBOT), 1, usb.SpeedFull); !errors.Is(err, usb.ErrNotFound) {
+		t.Errorf("missing interface: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNewDriveUASOnly(t *testing.T) {
+	config, _ := hex.DecodeString(
+		"090220000101008032" + // Configuration 1, 32 bytes
+			"090400000208066200" + // Interface 0, Mass Storage, SCSI, UAS
+			"0705810200020007050202000200") // Bulk IN 0x81 and OUT 0x02
+	dev := &usb.MockDevice{
+		Bus:        1,
+		Address:    9,
+		Descriptor: usb.DeviceDescriptor{VendorID: 0x0781, NumConfigurations: 1},
+		Configs:    [][]byte{config},
+	}
+	usb.SetBackend(usb.NewMockBackend(dev))
+	defer usb.SetBackend(nil)
+
+	devices, err := usb.DeviceList()
+	if err != nil || len(devices) != 1 {
+		t.Fatalf("DeviceList() = %v, %v, want the mock device", devices, err)
+	}
+	h, err := devices[0].Open()
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer h.Close()
+
+	if _, err := NewDrive(h, 0); !errors.Is(err, usb.ErrNotSupported) {
+		t.Errorf("NewDrive() of a UAS-only interface error = %v, want ErrNotSupported", err)
+	}
+}
@@ -0,0 +1,205 @@
+// Package msc implements helpers for USB Mass Storage Class devices, such as
+// decoding the SCSI responses of the drives behind them.
+package msc
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// SenseKey is the general category of a SCSI error
+type SenseKey uint8
+
+const (
+	SenseNoSense        SenseKey = 0x0
+	SenseRecoveredError SenseKey = 0x1
+	SenseNotReady       SenseKey = 0x2
+	SenseMediumError    SenseKey = 0x3
+	SenseHardwareError  SenseKey = 0x4
+	SenseIllegalRequest SenseKey = 0x5
+	SenseUnitAttention  SenseKey = 0x6
+	SenseDataProtect    SenseKey = 0x7
+	SenseBlankCheck     SenseKey = 0x8
+	SenseVendorSpecific SenseKey = 0x9
+	SenseCopyAborted    SenseKey = 0xa
+	SenseAbortedCommand SenseKey = 0xb
+	SenseVolumeOverflow SenseKey = 0xd
+	SenseMiscompare     SenseKey = 0xe
+	SenseCompleted      SenseKey = 0xf
+)
+
+var senseKeyNames = map[SenseKey]string{
+	SenseNoSense:        "NO SENSE",
+	SenseRecoveredError: "RECOVERED ERROR",
+	SenseNotReady:       "NOT READY",
+	SenseMediumError:    "MEDIUM ERROR",
+	SenseHardwareError:  "HARDWARE ERROR",
+	SenseIllegalRequest: "ILLEGAL REQUEST",
+	SenseUnitAttention:  "UNIT ATTENTION",
+	SenseDataProtect:    "DATA PROTECT",
+	SenseBlankCheck:     "BLANK CHECK",
+	SenseVendorSpecific: "VENDOR SPECIFIC",
+	SenseCopyAborted:    "COPY ABORTED",
+	SenseAbortedCommand: "ABORTED COMMAND",
+	SenseVolumeOverflow: "VOLUME OVERFLOW",
+	SenseMiscompare:     "MISCOMPARE",
+	SenseCompleted:      "COMPLETED",
+}
+
+// String returns the name SPC gives the sense key, such as "NOT READY"
+func (k SenseKey) String() string {
+	if name, ok := senseKeyNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("SenseKey(0x%x)", uint8(k))
+}
+
+// Descriptions of the additional sense codes USB drives commonly report,
+// keyed by ASC<<8 | ASCQ. Entries with an ASCQ of 0xff apply to any ASCQ
+// of that ASC without a more specific entry.
+var additionalSenseDescriptions = map[uint16]string{
+	0x0000: "no additional sense information",
+	0x0400: "logical unit not ready, cause not reportable",
+	0x0401: "logical unit is in process of becoming ready",
+	0x0402: "logical unit not ready, initializing command required",
+	0x0403: "logical unit not ready, manual intervention required",
+	0x0404: "logical unit not ready, format in progress",
+	0x04ff: "logical unit not ready",
+	0x0800: "logical unit communication failure",
+	0x0801: "logical unit communication time-out",
+	0x0c00: "write error",
+	0x0c02: "write error, auto reallocation failed",
+	0x0cff: "write error",
+	0x1000: "ID CRC or ECC error",
+	0x1100: "unrecovered read error",
+	0x11ff: "read error",
+	0x1400: "recorded entity not found",
+	0x1401: "record not found",
+	0x1500: "random positioning error",
+	0x1a00: "parameter list length error",
+	0x2000: "invalid command operation code",
+	0x2100: "logical block address out of range",
+	0x2400: "invalid field in CDB",
+	0x2500: "logical unit not supported",
+	0x2600: "invalid field in parameter list",
+	0x2700: "write protected",
+	0x27ff: "write protected",
+	0x2800: "not ready to ready change, medium may have changed",
+	0x2900: "power on, reset, or bus device reset occurred",
+	0x29ff: "power on or reset occurred",
+	0x2a01: "mode parameters changed",
+	0x2aff: "parameters changed",
+	0x3000: "incompatible medium installed",
+	0x30ff: "incompatible medium installed",
+	0x3100: "medium format corrupted",
+	0x3a00: "medium not present",
+	0x3a01: "medium not present, tray closed",
+	0x3a02: "medium not present, tray open",
+	0x3aff: "medium not present",
+	0x3e00: "logical unit has not self-configured yet",
+	0x4400: "internal target failure",
+	0x4700: "SCSI parity error",
+	0x4e00: "overlapped commands attempted",
+	0x5300: "media load or eject failed",
+	0x5302: "medium removal prevented",
+	0x5dff: "failure prediction threshold exceeded",
+}
+
+// SenseInfo is decoded sense data, as returned by REQUEST SENSE after a
+// command fails
+type SenseInfo struct {
+	ResponseCode uint8 // 0x70/0x71 for fixed format, 0x72/0x73 for descriptor format
+	Key          SenseKey
+	ASC          uint8 // Additional sense code
+	ASCQ         uint8 // Additional sense code qualifier
+
+	// Information is the command-specific information field, usually the
+	// first failing LBA for medium errors. InformationValid reports whether
+	// the device filled it in.
+	Information      uint64
+	InformationValid bool
+
+	Description string // Description of ASC/ASCQ, empty if it is not known
+}
+
+// Deferred reports whether the sense data describes an earlier command
+// rather than the one that just failed
+func (s SenseInfo) Deferred() bool {
+	return s.ResponseCode == 0x71 || s.ResponseCode == 0x73
+}
+
+// String formats the sense data as, for example,
+// "NOT READY: medium not present (ASC 0x3a, ASCQ 0x00)"
+func (s SenseInfo) String() string {
+	description := s.Description
+	if description == "" {
+		description = "unknown additional sense code"
+	}
+	return fmt.Sprintf("%v: %s (ASC 0x%02x, ASCQ 0x%02x)", s.Key, description, s.ASC, s.ASCQ)
+}
+
+// DecodeSense decodes the fixed or descriptor format sense data returned by
+// REQUEST SENSE. Fields the data is too short to hold are left zero, and
+// data in an unknown format only has ResponseCode set.
+func DecodeSense(data []byte) SenseInfo {
+	var s SenseInfo
+	if len(data) == 0 {
+		return s
+	}
+	s.ResponseCode = data[0] & 0x7f
+
+	switch s.ResponseCode {
+	case 0x70, 0x71:
+		// Fixed format: key in byte 2, information in 3-6, ASC/ASCQ in 12-13
+		if len(data) < 3 {
+			return s
+		}
+		s.Key = SenseKey(data[2] & 0x0f)
+		if len(data) >= 7 {
+			s.Information = uint64(binary.BigEndian.Uint32(data[3:7]))
+			s.InformationValid = data[0]&0x80 != 0
+		}
+		if len(data) >= 14 {
+			s.ASC, s.ASCQ = data[12], data[13]
+		}
+	case 0x72, 0x73:
+		// Descriptor format: key and ASC/ASCQ in the header, information in
+		// a type 0x00 descriptor
+		if len(data) < 4 {
+			return s
+		}
+		s.Key = SenseKey(data[1] & 0x0f)
+		s.ASC, s.ASCQ = data[2], data[3]
+		if len(data) >= 8 {
+			s.decodeSenseDescriptors(data[8:])
+		}
+	default:
+		return s
+	}
+
+	s.Description = AdditionalSenseDescription(s.ASC, s.ASCQ)
+	return s
+}
+
+func (s *SenseInfo) decodeSenseDescriptors(data []byte) {
+	for len(data) >= 2 {
+		length := 2 + int(data[1])
+		if length > len(data) {
+			return
+		}
+		if data[0] == 0x00 && length >= 12 {
+			s.Information = binary.BigEndian.Uint64(data[4:12])
+			s.InformationValid = data[2]&0x80 != 0
+		}
+		data = data[length:]
+	}
+}
+
+// AdditionalSenseDescription returns the description of an ASC/ASCQ pair, or
+// an empty string if it is not one of the codes this package knows
+func AdditionalSenseDescription(asc, ascq uint8) string {
+	if description, ok := additionalSenseDescriptions[uint16(asc)<<8|uint16(ascq)]; ok {
+		return description
+	}
+	return additionalSenseDescriptions[uint16(asc)<<8|0xff]
+}
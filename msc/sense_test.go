@@ -0,0 +1,75 @@
+package msc
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecodeSense(t *testing.T) {
+	tests := []struct {
+		name string
+		data string // hex encoded
+		want SenseInfo
+	}{
+		{
+			name: "fixed_medium_not_present",
+			data: "700002000000000a00000000" + "3a00" + "000000",
+			want: SenseInfo{ResponseCode: 0x70, Key: SenseNotReady, ASC: 0x3a, ASCQ: 0x00,
+				Description: "medium not present"},
+		},
+		{
+			name: "fixed_read_error_with_lba",
+			data: "f00003000012340a00000000" + "1104" + "000000",
+			want: SenseInfo{ResponseCode: 0x70, Key: SenseMediumError, ASC: 0x11, ASCQ: 0x04,
+				Information: 0x1234, InformationValid: true, Description: "read error"},
+		},
+		{
+			name: "descriptor_unit_attention",
+			data: "7206290000000000",
+			want: SenseInfo{ResponseCode: 0x72, Key: SenseUnitAttention, ASC: 0x29, ASCQ: 0x00,
+				Description: "power on, reset, or bus device reset occurred"},
+		},
+		{
+			name: "descriptor_information",
+			data: "720311000000000c" + "000a8000" + "0000000000005678",
+			want: SenseInfo{ResponseCode: 0x72, Key: SenseMediumError, ASC: 0x11, ASCQ: 0x00,
+				Information: 0x5678, InformationValid: true, Description: "unrecovered read error"},
+		},
+		{
+			name: "unknown_code",
+			data: "700005000000000a00000000" + "f1f2" + "000000",
+			want: SenseInfo{ResponseCode: 0x70, Key: SenseIllegalRequest, ASC: 0xf1, ASCQ: 0xf2},
+		},
+		{
+			name: "unknown_format",
+			data: "7f0002",
+			want: SenseInfo{ResponseCode: 0x7f},
+		},
+		{
+			name: "empty",
+			data: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatalf("invalid test data: %v", err)
+			}
+			if got := DecodeSense(data); got != tt.want {
+				t.Errorf("DecodeSense() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSenseInfoString(t *testing.T) {
+	s := SenseInfo{Key: SenseNotReady, ASC: 0x3a, Description: "medium not present"}
+	if got, want := s.String(), "NOT READY: medium not present (ASC 0x3a, ASCQ 0x00)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := SenseKey(0xc).String(); got != "SenseKey(0xc)" {
+		t.Errorf("SenseKey(0xc).String() = %q", got)
+	}
+}
@@ -0,0 +1,304 @@
+// Package pd implements helpers for USB Type-C alternate modes as seen from
+// the host. The Structured VDMs that negotiate alternate modes travel over
+// the CC line and never reach USB, so a host learns about them from the
+// Billboard device class, which devices expose to report the modes they
+// support and whether entering them succeeded.
+package pd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+// CLASS_BILLBOARD is the device and interface class of Billboard devices
+const CLASS_BILLBOARD = 0x11
+
+// Device capability types of the Billboard specification
+const (
+	USB_DC_BILLBOARD         = 0x0d
+	USB_DC_BILLBOARD_ALTMODE = 0x0f
+)
+
+// Standard and vendor IDs (SVIDs) of common alternate modes
+const (
+	SVID_DISPLAYPORT = 0xff01
+	SVID_THUNDERBOLT = 0x8087
+)
+
+// MaxAlternateModes is the most alternate modes a Billboard capability can
+// list (MAX_NUM_ALT_MODE)
+const MaxAlternateModes = 0x34
+
+// Bits of BillboardCapability.AdditionalFailureInfo
+const (
+	FailureInsufficientPower = 0x01
+	FailurePDCommunication   = 0x02
+)
+
+// billboardHeaderLength is the size of the Billboard capability before the
+// alternate mode entries, which are 4 bytes each
+const billboardHeaderLength = 44
+
+// AltModeState is the outcome of configuring an alternate mode, from the
+// bmConfigured field of the Billboard capability
+type AltModeState uint8
+
+const (
+	AltModeError        AltModeState = 0 // Unspecified error
+	AltModeNotAttempted AltModeState = 1 // Not attempted, or exited
+	AltModeUnsuccessful AltModeState = 2 // Attempted but unsuccessful
+	AltModeConfigured   AltModeState = 3 // Configuration successful
+)
+
+func (s AltModeState) String() string {
+	switch s {
+	case AltModeError:
+		return "error"
+	case AltModeNotAttempted:
+		return "not attempted"
+	case AltModeUnsuccessful:
+		return "unsuccessful"
+	case AltModeConfigured:
+		return "configured"
+	}
+	return fmt.Sprintf("AltModeState(%d)", uint8(s))
+}
+
+// AlternateMode is one alternate mode listed by a Billboard device
+type AlternateMode struct {
+	SVID        uint16
+	Mode        uint8 // Index of the mode in the Discover Modes response of SVID
+	StringIndex uint8
+	String      string // Resolved by ReadBillboard
+	State       AltModeState
+
+	// VDO is the mode's VDO from the Discover Modes response, reported by
+	// the Billboard Alternate Mode capability. HasVDO is false for devices
+	// that don't include one, such as those of Billboard versions before
+	// 1.2.
+	VDO    uint32
+	HasVDO bool
+}
+
+// IsDisplayPort reports whether m is the DisplayPort alternate mode
+func (m AlternateMode) IsDisplayPort() bool {
+	return m.SVID == SVID_DISPLAYPORT
+}
+
+// DisplayPort decodes the VDO of a DisplayPort alternate mode. ok is false
+// if m is another mode or has no VDO.
+func (m AlternateMode) DisplayPort() (caps DisplayPortCapabilities, ok bool) {
+	if !m.IsDisplayPort() || !m.HasVDO {
+		return 0, false
+	}
+	return DisplayPortCapabilities(m.VDO), true
+}
+
+// BillboardCapability is the Billboard capability of a device's BOS together
+// with its alternate modes
+type BillboardCapability struct {
+	AdditionalInfoURLIndex uint8
+	AdditionalInfoURL      string // Resolved by ReadBillboard
+	PreferredAlternateMode uint8
+	VconnPower             uint16
+	Version                uint16 // bcdVersion
+	AdditionalFailureInfo  uint8
+	AlternateModes         []AlternateMode
+}
+
+// VconnRequired reports whether the device needs VCONN power for its
+// alternate modes
+func (b *BillboardCapability) VconnRequired() bool {
+	return b.VconnPower&0x8000 == 0
+}
+
+// ParseBillboard finds and decodes the Billboard capability in a BOS blob,
+// attaching the VDOs of any Billboard Alternate Mode capabilities to their
+// modes. Strings are left unresolved. It returns an error wrapping
+// usb.ErrNotFound if the BOS has no Billboard capability.
+func ParseBillboard(bos []byte) (*BillboardCapability, error) {
+	caps := capabilities(bos)
+
+	var b *BillboardCapability
+	for _, c := range caps {
+		if c[2] != USB_DC_BILLBOARD {
+			continue
+		}
+		var err error
+		if b, err = parseBillboardCapability(c); err != nil {
+			return nil, err
+		}
+		break
+	}
+	if b == nil {
+		return nil, fmt.Errorf("Billboard capability: %w", usb.ErrNotFound)
+	}
+
+	for _, c := range caps {
+		if c[2] != USB_DC_BILLBOARD_ALTMODE || len(c) < 8 {
+			continue
+		}
+		index := int(c[3])
+		if index >= len(b.AlternateModes) {
+			continue
+		}
+		b.AlternateModes[index].VDO = binary.LittleEndian.Uint32(c[4:8])
+		b.AlternateModes[index].HasVDO = true
+	}
+	return b, nil
+}
+
+func parseBillboardCapability(c []byte) (*BillboardCapability, error) {
+	if len(c) < billboardHeaderLength {
+		return nil, fmt.Errorf("invalid Billboard capability length: %d", len(c))
+	}
+	count := int(c[4])
+	if count > MaxAlternateModes {
+		return nil, fmt.Errorf("Billboard capability lists %d alternate modes, more than %d", count, MaxAlternateModes)
+	}
+	if len(c) < billboardHeaderLength+4*count {
+		return nil, fmt.Errorf("Billboard capability too short for %d alternate modes: %d bytes", count, len(c))
+	}
+
+	b := &BillboardCapability{
+		AdditionalInfoURLIndex: c[3],
+		PreferredAlternateMode: c[5],
+		VconnPower:             binary.LittleEndian.Uint16(c[6:8]),
+		Version:                binary.LittleEndian.Uint16(c[40:42]),
+		AdditionalFailureInfo:  c[42],
+		AlternateModes:         make([]AlternateMode, count),
+	}
+	configured := c[8:40] // Two bits per mode
+	for i := range b.AlternateModes {
+		off := billboardHeaderLength + 4*i
+		b.AlternateModes[i] = AlternateMode{
+			SVID:        binary.LittleEndian.Uint16(c[off : off+2]),
+			Mode:        c[off+2],
+			StringIndex: c[off+3],
+			State:       AltModeState(configured[i/4] >> (2 * (i % 4)) & 0x03),
+		}
+	}
+	return b, nil
+}
+
+// capabilities splits a BOS blob into its device capabilities, stopping at
+// the first malformed one
+func capabilities(bos []byte) [][]byte {
+	if len(bos) < 5 || bos[1] != usb.USB_DT_BOS {
+		return nil
+	}
+	var caps [][]byte
+	for pos, i := int(bos[0]), 0; i < int(bos[4]) && pos+3 <= len(bos); i++ {
+		length := int(bos[pos])
+		if length < 3 || pos+length > len(bos) {
+			break
+		}
+		if bos[pos+1] == usb.USB_DT_DEVICE_CAPABILITY {
+			caps = append(caps, bos[pos:pos+length])
+		}
+		pos += length
+	}
+	return caps
+}
+
+// ReadBillboard reads the Billboard capability of the device of h and
+// resolves its strings. A string that can't be read is left empty rather
+// than failing the call, since it only describes the mode.
+func ReadBillboard(h *usb.DeviceHandle) (*BillboardCapability, error) {
+	bos, err := h.RawBOSDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	b, err := ParseBillboard(bos)
+	if err != nil {
+		return nil, err
+	}
+
+	// Modes often share a string, so each index is read once
+	resolved := make(map[uint8]string)
+	resolve := func(index uint8) string {
+		if index == 0 {
+			return ""
+		}
+		if s, ok := resolved[index]; ok {
+			return s
+		}
+		s, _ := h.StringDescriptor(index)
+		resolved[index] = s
+		return s
+	}
+	b.AdditionalInfoURL = resolve(b.AdditionalInfoURLIndex)
+	for i := range b.AlternateModes {
+		b.AlternateModes[i].String = resolve(b.AlternateModes[i].StringIndex)
+	}
+	return b, nil
+}
+
+// IsBillboard reports whether dev, or one of its interfaces, is a Billboard
+// device
+func IsBillboard(dev *usb.Device) bool {
+	return dev.HasClass(CLASS_BILLBOARD)
+}
+
+// DisplayPortCapabilities is the DisplayPort Capabilities VDO a DisplayPort
+// alternate mode reports in its Discover Modes response
+type DisplayPortCapabilities uint32
+
+// UFPD reports whether the port can act as a DisplayPort sink (UFP_D)
+func (c DisplayPortCapabilities) UFPD() bool {
+	return c&0x01 != 0
+}
+
+// DFPD reports whether the port can act as a DisplayPort source (DFP_D)
+func (c DisplayPortCapabilities) DFPD() bool {
+	return c&0x02 != 0
+}
+
+// Signalling returns the signalling bits: bit 0 is DisplayPort 1.3
+// signalling rates, bit 1 USB Gen 2 signalling
+func (c DisplayPortCapabilities) Signalling() uint8 {
+	return uint8(c>>2) & 0x0f
+}
+
+// Receptacle reports whether the port is a receptacle rather than a captive
+// plug
+func (c DisplayPortCapabilities) Receptacle() bool {
+	return c&0x40 != 0
+}
+
+// UFPDPinAssignments returns the pin assignments supported as UFP_D, as a
+// mask with bit 0 for assignment A. A plug swaps the two pin assignment
+// fields of the VDO, which is accounted for here.
+func (c DisplayPortCapabilities) UFPDPinAssignments() uint8 {
+	if c.Receptacle() {
+		return uint8(c >> 16)
+	}
+	return uint8(c >> 8)
+}
+
+// DFPDPinAssignments returns the pin assignments supported as DFP_D, as a
+// mask with bit 0 for assignment A
+func (c DisplayPortCapabilities) DFPDPinAssignments() uint8 {
+	if c.Receptacle() {
+		return uint8(c >> 8)
+	}
+	return uint8(c >> 16)
+}
+
+// PinAssignmentString formats a pin assignment mask as letters, such as
+// "C, D, E"
+func PinAssignmentString(mask uint8) string {
+	var letters []string
+	for i := 0; i < 6; i++ {
+		if mask&(1<<i) != 0 {
+			letters = append(letters, string(rune('A'+i)))
+		}
+	}
+	if len(letters) == 0 {
+		return "none"
+	}
+	return strings.Join(letters, ", ")
+}
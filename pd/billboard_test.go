@@ -0,0 +1,72 @@
+package pd
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+func TestParseBillboard(t *testing.T) {
+	billboard := "34100d" + // 52 bytes: Billboard capability
+		"01" + "02" + "00" + "0080" + // URL string 1, two modes, preferred 0, no VCONN needed
+		"0b" + strings.Repeat("00", 31) + // DisplayPort configured, Thunderbolt unsuccessful
+		"2001" + "00" + "00" + // bcdVersion 1.20, no failure info
+		"01ff" + "00" + "02" + // DisplayPort, mode 0, string 2
+		"8780" + "01" + "02" // Thunderbolt, mode 1, string 2
+	altMode := "08100f" + "00" + "45001c00" // Mode 0: DP_D receptacle, UFP_D pin assignments C, D, E
+	data, _ := hex.DecodeString("050f410002" + billboard + altMode)
+
+	b, err := ParseBillboard(data)
+	if err != nil {
+		t.Fatalf("ParseBillboard() error = %v", err)
+	}
+	if b.AdditionalInfoURLIndex != 1 || b.VconnRequired() || b.Version != 0x0120 || len(b.AlternateModes) != 2 {
+		t.Fatalf("ParseBillboard() = %+v", b)
+	}
+
+	dp, tbt := b.AlternateModes[0], b.AlternateModes[1]
+	if !dp.IsDisplayPort() || dp.State != AltModeConfigured || dp.StringIndex != 2 || !dp.HasVDO {
+		t.Errorf("DisplayPort mode = %+v", dp)
+	}
+	if tbt.SVID != SVID_THUNDERBOLT || tbt.Mode != 1 || tbt.State != AltModeUnsuccessful || tbt.HasVDO {
+		t.Errorf("Thunderbolt mode = %+v", tbt)
+	}
+
+	caps, ok := dp.DisplayPort()
+	if !ok || !caps.UFPD() || caps.DFPD() || !caps.Receptacle() {
+		t.Fatalf("DisplayPort() = %#x, %v", caps, ok)
+	}
+	if got := PinAssignmentString(caps.UFPDPinAssignments()); got != "C, D, E" {
+		t.Errorf("UFP_D pin assignments = %q, want %q", got, "C, D, E")
+	}
+	if _, ok := tbt.DisplayPort(); ok {
+		t.Errorf("DisplayPort() of the Thunderbolt mode succeeded")
+	}
+}
+
+func TestParseBillboardErrors(t *testing.T) {
+	noBillboard, _ := hex.DecodeString("050f0c0001" + "0710021e000000")
+	if _, err := ParseBillboard(noBillboard); !errors.Is(err, usb.ErrNotFound) {
+		t.Errorf("ParseBillboard() without a Billboard capability error = %v, want ErrNotFound", err)
+	}
+
+	// Two modes announced, but the capability ends after the first
+	truncated, _ := hex.DecodeString("050f350001" + "30100d" + "00" + "02" + "00" + "0080" + strings.Repeat("00", 32) + "1001" + "0000" + "01ff0000")
+	if _, err := ParseBillboard(truncated); err == nil {
+		t.Errorf("ParseBillboard() of a truncated capability succeeded")
+	}
+}
+
+func TestDisplayPortPlugPinAssignments(t *testing.T) {
+	// A captive plug reports its UFP_D pin assignments in bits 15:8
+	caps := DisplayPortCapabilities(0x00000c01)
+	if got := PinAssignmentString(caps.UFPDPinAssignments()); got != "C, D" {
+		t.Errorf("UFP_D pin assignments of a plug = %q, want %q", got, "C, D")
+	}
+	if got := PinAssignmentString(caps.DFPDPinAssignments()); got != "none" {
+		t.Errorf("DFP_D pin assignments of a plug = %q, want %q", got, "none")
+	}
+}
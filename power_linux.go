@@ -0,0 +1,119 @@
+package usb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Suspend lets the kernel runtime-suspend the device by writing "auto" to its
+// sysfs power/control attribute. It only allows autosuspend and does not
+// suspend the device itself: the kernel suspends it once it has been idle
+// for the autosuspend delay, which it is not while an interface driver or an
+// open usbfs file, this handle included, holds it. Poll PowerState to see
+// when it has suspended. Kernels that predate power/control use power/level.
+func (h *DeviceHandle) Suspend() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return ErrDeviceNotFound
+	}
+
+	return h.device.writePowerAttr("auto", "suspend")
+}
+
+// Resume wakes the device and keeps it from autosuspending by writing "on"
+// to its sysfs power/control attribute.
+func (h *DeviceHandle) Resume() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return ErrDeviceNotFound
+	}
+
+	return h.device.writePowerAttr("on", "on")
+}
+
+// PowerState returns the runtime power status reported by sysfs, such as
+// "active" or "suspended".
+func (d *Device) PowerState() (string, error) {
+	dir, err := d.sysfsDir()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "power", "runtime_status"))
+	if err != nil {
+		return "", sysfsPowerError(err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// AutosuspendDelay returns how long the device must be idle before the kernel
+// suspends it. A negative delay means autosuspend is disabled.
+func (d *Device) AutosuspendDelay() (time.Duration, error) {
+	dir, err := d.sysfsDir()
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "power", "autosuspend_delay_ms"))
+	if err != nil {
+		return 0, sysfsPowerError(err)
+	}
+
+	ms, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid autosuspend delay %q: %w", strings.TrimSpace(string(data)), err)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// SetAutosuspendDelay sets how long the device must be idle before the kernel
+// suspends it, with millisecond resolution.
+func (d *Device) SetAutosuspendDelay(delay time.Duration) error {
+	dir, err := d.sysfsDir()
+	if err != nil {
+		return err
+	}
+
+	ms := strconv.FormatInt(delay.Milliseconds(), 10)
+	if err := os.WriteFile(filepath.Join(dir, "power", "autosuspend_delay_ms"), []byte(ms), 0644); err != nil {
+		return sysfsPowerError(err)
+	}
+	return nil
+}
+
+// writePowerAttr writes control to power/control, falling back to writing
+// level to the legacy power/level attribute.
+func (d *Device) writePowerAttr(control, level string) error {
+	dir, err := d.sysfsDir()
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "power", "control"), []byte(control), 0644)
+	if os.IsNotExist(err) {
+		err = os.WriteFile(filepath.Join(dir, "power", "level"), []byte(level), 0644)
+	}
+	if err != nil {
+		return sysfsPowerError(err)
+	}
+	return nil
+}
+
+// sysfsPowerError maps sysfs access failures onto the package errors
+func sysfsPowerError(err error) error {
+	switch {
+	case os.IsPermission(err):
+		return ErrPermissionDenied
+	case os.IsNotExist(err):
+		return ErrNotSupported
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package usb
+
+import (
+	"sync"
+	"time"
+)
+
+// Quirk describes workarounds for a misbehaving device. Quirks are registered
+// per vendor/product ID with RegisterQuirk and applied by Open and by every
+// read of a parsed configuration descriptor, such as GetActiveConfigDescriptor,
+// ConfigDescriptorByIndex and Configurations.
+type Quirk struct {
+	// ResetOnOpen resets the device right after it is opened, for devices
+	// that come up in a bad state.
+	ResetOnOpen bool
+
+	// SettleDelay is how long Open waits before returning, after any reset,
+	// for devices that need time before they accept requests.
+	SettleDelay time.Duration
+
+	// SkipConfigParse keeps only the configuration header of the parsed
+	// configuration descriptors, for devices whose interface and endpoint
+	// descriptors are bogus.
+	SkipConfigParse bool
+
+	// MaxPacketSize overrides wMaxPacketSize of the endpoints in the parsed
+	// configuration descriptors, keyed by endpoint address.
+	MaxPacketSize map[uint8]uint16
+}
+
+var (
+	quirksMu sync.RWMutex
+	quirks   = make(map[uint32]Quirk)
+)
+
+func quirkKey(vid, pid uint16) uint32 {
+	return uint32(vid)<<16 | uint32(pid)
+}
+
+// RegisterQuirk registers q for devices with the given vendor and product
+// ID, replacing any quirk registered before. It affects handles opened
+// afterwards.
+func RegisterQuirk(vid, pid uint16, q Quirk) {
+	quirksMu.Lock()
+	defer quirksMu.Unlock()
+	quirks[quirkKey(vid, pid)] = q
+}
+
+// UnregisterQuirk removes the quirk registered for the given vendor and
+// product ID, if any
+func UnregisterQuirk(vid, pid uint16) {
+	quirksMu.Lock()
+	defer quirksMu.Unlock()
+	delete(quirks, quirkKey(vid, pid))
+}
+
+// LookupQuirk returns the quirk registered for the given vendor and product ID
+func LookupQuirk(vid, pid uint16) (Quirk, bool) {
+	quirksMu.RLock()
+	defer quirksMu.RUnlock()
+	q, ok := quirks[quirkKey(vid, pid)]
+	return q, ok
+}
+
+// quirk returns the quirk registered for the handle's device
+func (h *DeviceHandle) quirk() (Quirk, bool) {
+	return LookupQuirk(h.device.Descriptor.VendorID, h.device.Descriptor.ProductID)
+}
+
+// applyOpenQuirks runs the open-time workarounds for a freshly opened handle
+func (h *DeviceHandle) applyOpenQuirks() error {
+	q, ok := h.quirk()
+	if !ok {
+		return nil
+	}
+
+	if q.ResetOnOpen {
+		if err := h.ResetDevice(); err != nil {
+			return err
+		}
+	}
+	if q.SettleDelay > 0 {
+		time.Sleep(q.SettleDelay)
+	}
+	return nil
+}
+
+// applyConfigQuirks applies q to a freshly parsed configuration descriptor
+func applyConfigQuirks(q Quirk, config *ConfigDescriptor) {
+	if q.SkipConfigParse {
+		config.Interfaces = nil
+		config.Extra = nil
+		return
+	}
+
+	if len(q.MaxPacketSize) == 0 {
+		return
+	}
+	for i := range config.Interfaces {
+		for j := range config.Interfaces[i].AltSettings {
+			alt := &config.Interfaces[i].AltSettings[j]
+			for k := range alt.Endpoints {
+				if size, ok := q.MaxPacketSize[alt.Endpoints[k].EndpointAddr]; ok {
+					alt.Endpoints[k].MaxPacketSize = size
+				}
+			}
+		}
+	}
+}
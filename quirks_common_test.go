@@ -0,0 +1,104 @@
+package usb
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestRegisterQuirk(t *testing.T) {
+	const vid, pid = 0x1234, 0x5678
+
+	if _, ok := LookupQuirk(vid, pid); ok {
+		t.Fatal("quirk registered before RegisterQuirk")
+	}
+
+	RegisterQuirk(vid, pid, Quirk{ResetOnOpen: true})
+	defer UnregisterQuirk(vid, pid)
+
+	q, ok := LookupQuirk(vid, pid)
+	if !ok || !q.ResetOnOpen {
+		t.Fatalf("LookupQuirk = %+v, %v, want ResetOnOpen quirk", q, ok)
+	}
+	if _, ok := LookupQuirk(vid, pid+1); ok {
+		t.Error("quirk matched a different product ID")
+	}
+
+	UnregisterQuirk(vid, pid)
+	if _, ok := LookupQuirk(vid, pid); ok {
+		t.Error("quirk still registered after UnregisterQuirk")
+	}
+}
+
+func TestApplyConfigQuirks(t *testing.T) {
+	data, _ := hex.DecodeString("09022000010100c032" +
+		"0904000002ff010000" +
+		"0705810240000a" +
+		"0705020240000a")
+
+	parse := func(t *testing.T) *ConfigDescriptor {
+		config := &ConfigDescriptor{}
+		if err := config.Unmarshal(data); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		return config
+	}
+
+	t.Run("max_packet_override", func(t *testing.T) {
+		config := parse(t)
+		applyConfigQuirks(Quirk{MaxPacketSize: map[uint8]uint16{0x81: 512}}, config)
+
+		if ep := config.FindEndpoint(0x81); ep == nil || ep.MaxPacketSize != 512 {
+			t.Errorf("endpoint 0x81 = %+v, want MaxPacketSize 512", ep)
+		}
+		if ep := config.FindEndpoint(0x02); ep == nil || ep.MaxPacketSize != 64 {
+			t.Errorf("endpoint 0x02 = %+v, want MaxPacketSize 64", ep)
+		}
+	})
+
+	t.Run("skip_config_parse", func(t *testing.T) {
+		config := parse(t)
+		applyConfigQuirks(Quirk{SkipConfigParse: true}, config)
+
+		if len(config.Interfaces) != 0 {
+			t.Errorf("len(Interfaces) = %d, want 0", len(config.Interfaces))
+		}
+		if config.ConfigurationValue != 1 {
+			t.Errorf("ConfigurationValue = %d, want 1", config.ConfigurationValue)
+		}
+	})
+}
+
+func TestConfigDescriptorQuirks(t *testing.T) {
+	const vid, pid = 0x1234, 0x5679
+	config, _ := hex.DecodeString("09022000010100c032" +
+		"0904000002ff010000" +
+		"0705810240000a" +
+		"0705020240000a")
+	dev := &MockDevice{
+		Bus:        1,
+		Address:    5,
+		Descriptor: DeviceDescriptor{VendorID: vid, ProductID: pid, NumConfigurations: 1},
+		Configs:    [][]byte{config},
+	}
+	RegisterQuirk(vid, pid, Quirk{MaxPacketSize: map[uint8]uint16{0x81: 512}})
+	defer UnregisterQuirk(vid, pid)
+	h := openMockHandle(t, dev)
+
+	byIndex, err := h.ConfigDescriptorByIndex(0)
+	if err != nil {
+		t.Fatalf("ConfigDescriptorByIndex() error = %v", err)
+	}
+	configs, err := h.Configurations()
+	if err != nil || len(configs) != 1 {
+		t.Fatalf("Configurations() = %v, %v, want one configuration", configs, err)
+	}
+	active, err := h.GetActiveConfigDescriptor()
+	if err != nil {
+		t.Fatalf("GetActiveConfigDescriptor() error = %v", err)
+	}
+	for name, config := range map[string]*ConfigDescriptor{"ConfigDescriptorByIndex": byIndex, "Configurations": configs[0], "GetActiveConfigDescriptor": active} {
+		if ep := config.FindEndpoint(0x81); ep == nil || ep.MaxPacketSize != 512 {
+			t.Errorf("%s: endpoint 0x81 = %+v, want MaxPacketSize 512", name, ep)
+		}
+	}
+}
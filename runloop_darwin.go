@@ -0,0 +1,173 @@
+package usb
+
+/*
+#cgo LDFLAGS: -framework IOKit -framework CoreFoundation
+#include <stdint.h>
+#include <CoreFoundation/CoreFoundation.h>
+*/
+import "C"
+
+import (
+	"runtime"
+	"runtime/cgo"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// asyncRunLoopInterval is how long one pass of the run loop waits for an
+// event, in seconds. It bounds how long Close takes when the stop request
+// arrives just before a pass starts and CFRunLoopStop has nothing to stop.
+const asyncRunLoopInterval = 0.1
+
+// asyncRunLoop is the CFRunLoop on which a handle's asynchronous transfers
+// complete. IOKit delivers the completions of ReadPipeAsync and
+// WritePipeAsync through the async event source of the interface, which only
+// fires while a run loop it was added to is running, so the loop runs on a
+// goroutine locked to its own thread from the first submission until Close.
+type asyncRunLoop struct {
+	loop C.CFRunLoopRef // Retained, set before startAsyncRunLoop returns
+
+	mu      sync.Mutex
+	sources map[uint8]C.CFRunLoopSourceRef // By interface number, guarded by mu
+
+	wake     chan struct{} // Signalled when a source is added or on stop
+	stopping atomic.Bool
+	done     chan struct{} // Closed when the goroutine has returned
+
+	inFlight sync.WaitGroup // Async transfers whose completion is still due
+}
+
+// startAsyncRunLoop starts the run loop goroutine and waits until its
+// CFRunLoop exists
+func startAsyncRunLoop() *asyncRunLoop {
+	r := &asyncRunLoop{
+		sources: make(map[uint8]C.CFRunLoopSourceRef),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	ready := make(chan struct{})
+	go r.run(ready)
+	<-ready
+	return r
+}
+
+func (r *asyncRunLoop) run(ready chan<- struct{}) {
+	// A CFRunLoop belongs to a thread, and the sources are added to this one
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer close(r.done)
+
+	r.loop = C.CFRunLoopGetCurrent()
+	C.CFRetain(C.CFTypeRef(r.loop))
+	close(ready)
+
+	for !r.stopping.Load() {
+		result := C.CFRunLoopRunInMode(C.kCFRunLoopDefaultMode, C.CFTimeInterval(asyncRunLoopInterval), C.Boolean(0))
+		if int(result) == int(C.kCFRunLoopRunFinished) {
+			// The loop has no sources left, and returns at once until one
+			// is added
+			<-r.wake
+		}
+	}
+}
+
+// addSource adds the async event source of interface iface to the loop,
+// which then owns it. A source already added for iface is kept.
+func (r *asyncRunLoop) addSource(iface uint8, source C.CFRunLoopSourceRef) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sources[iface]; ok {
+		C.CFRelease(C.CFTypeRef(source))
+		return
+	}
+	r.sources[iface] = source
+	C.CFRunLoopAddSource(r.loop, source, C.kCFRunLoopDefaultMode)
+	C.CFRunLoopWakeUp(r.loop)
+	r.signal()
+}
+
+// hasSource reports whether the async event source of iface was added
+func (r *asyncRunLoop) hasSource(iface uint8) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.sources[iface]
+	return ok
+}
+
+// removeSource removes and releases the async event source of iface, before
+// the interface is closed
+func (r *asyncRunLoop) removeSource(iface uint8) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	source, ok := r.sources[iface]
+	if !ok {
+		return
+	}
+	C.CFRunLoopRemoveSource(r.loop, source, C.kCFRunLoopDefaultMode)
+	C.CFRelease(C.CFTypeRef(source))
+	delete(r.sources, iface)
+}
+
+// drain waits until every async transfer submitted on the loop's sources has
+// completed. Their pipes must have been aborted, so that none waits for the
+// device.
+func (r *asyncRunLoop) drain() {
+	r.inFlight.Wait()
+}
+
+// stop ends the run loop, waits for its goroutine and releases the loop and
+// every source still in it. Completions can no longer be delivered once it
+// returns, so the transfers must have been drained first.
+func (r *asyncRunLoop) stop() {
+	r.stopping.Store(true)
+	C.CFRunLoopStop(r.loop)
+	r.signal()
+	<-r.done
+
+	r.mu.Lock()
+	for iface := range r.sources {
+		C.CFRunLoopRemoveSource(r.loop, r.sources[iface], C.kCFRunLoopDefaultMode)
+		C.CFRelease(C.CFTypeRef(r.sources[iface]))
+		delete(r.sources, iface)
+	}
+	r.mu.Unlock()
+	C.CFRelease(C.CFTypeRef(r.loop))
+}
+
+func (r *asyncRunLoop) signal() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// addAsyncSource makes sure the completions of async transfers on interface
+// iface are delivered, starting the handle's run loop if needed. The caller
+// must hold h.mu for writing.
+func (h *DeviceHandle) addAsyncSource(iface uint8, intf *IOUSBInterfaceInterface) error {
+	if h.async == nil {
+		h.async = startAsyncRunLoop()
+	}
+	if h.async.hasSource(iface) {
+		return nil
+	}
+	source, err := intf.CreateAsyncEventSource()
+	if err != nil {
+		return err
+	}
+	h.async.addSource(iface, source)
+	return nil
+}
+
+// goAsyncTransferComplete is called by AsyncCallback on the run loop thread
+// when IOKit completes an async transfer. arg0 holds the number of bytes
+// transferred.
+//
+//export goAsyncTransferComplete
+func goAsyncTransferComplete(userData C.uintptr_t, result C.int32_t, arg0 unsafe.Pointer) {
+	ctx := cgo.Handle(userData).Value().(*AsyncTransferContext)
+	ctx.complete(int32(result), uint32(uintptr(arg0)))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -38,13 +39,22 @@ func NewSysfsEnumerator() *SysfsEnumerator {
 
 // EnumerateDevices returns all USB devices found in sysfs
 func (e *SysfsEnumerator) EnumerateDevices() ([]*SysfsDevice, error) {
+	devices, _, err := e.enumerate()
+	return devices, err
+}
+
+// enumerate walks sysfs and returns every device that could be loaded along
+// with the errors for the entries that could not. Only a failure to read the
+// sysfs directory itself is fatal.
+func (e *SysfsEnumerator) enumerate() ([]*SysfsDevice, []error, error) {
 	sysfsDir := "/sys/bus/usb/devices"
 	entries, err := os.ReadDir(sysfsDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read sysfs USB directory: %w", err)
+		return nil, nil, fmt.Errorf("failed to read sysfs USB directory: %w", err)
 	}
 
 	var devices []*SysfsDevice
+	var errs []error
 
 	for _, entry := range entries {
 		name := entry.Name()
@@ -61,12 +71,14 @@ func (e *SysfsEnumerator) EnumerateDevices() ([]*SysfsDevice, error) {
 
 		sysfsPath := filepath.Join(sysfsDir, name)
 		device, err := e.loadDeviceFromSysfs(sysfsPath, name)
-		if err == nil {
-			devices = append(devices, device)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
 		}
+		devices = append(devices, device)
 	}
 
-	return devices, nil
+	return devices, errs, nil
 }
 
 // loadDeviceFromSysfs loads a single device from sysfs
@@ -160,6 +172,7 @@ func (s *SysfsDevice) ToUSBDevice() *Device {
 			Product:      s.Product,
 			Serial:       s.Serial,
 		},
+		sysfsPath: s.Path,
 		Descriptor: DeviceDescriptor{
 			Length:            18,
 			DescriptorType:    1,
@@ -180,3 +193,427 @@ func (s *SysfsDevice) ToUSBDevice() *Device {
 
 	return device
 }
+
+// sysfsDir returns the sysfs directory of the device, searching sysfs for a
+// matching bus number and device address if enumeration didn't record it.
+func (d *Device) sysfsDir() (string, error) {
+	if d.sysfsPath != "" {
+		return d.sysfsPath, nil
+	}
+
+	sysfsDir := "/sys/bus/usb/devices"
+	entries, err := os.ReadDir(sysfsDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read sysfs USB directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.Contains(name, ":") {
+			continue
+		}
+
+		path := filepath.Join(sysfsDir, name)
+		busnum, err1 := os.ReadFile(filepath.Join(path, "busnum"))
+		devnum, err2 := os.ReadFile(filepath.Join(path, "devnum"))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		bus, err1 := strconv.Atoi(strings.TrimSpace(string(busnum)))
+		dev, err2 := strconv.Atoi(strings.TrimSpace(string(devnum)))
+		if err1 == nil && err2 == nil && bus == int(d.Bus) && dev == int(d.Address) {
+			d.sysfsPath = path
+			return path, nil
+		}
+	}
+
+	return "", ErrDeviceNotFound
+}
+
+// PortPath returns the chain of hub ports the device is plugged into, as the
+// kernel names its sysfs directory: "1-4.2" is port 2 of the hub on port 4
+// of bus 1, and a root hub is "usb1". Unlike the address, it stays the same
+// when the device re-enumerates or the machine reboots, as long as it is
+// plugged into the same port.
+func (d *Device) PortPath() (string, error) {
+	dir, err := d.sysfsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(dir), nil
+}
+
+// sysfsInterfacePrefix returns what the names of the interface directories
+// of the device in dir start with, "<bus>-<devpath>". It is the name of dir
+// itself, such as "1-4.2", except for a root hub: the interfaces of "usb1"
+// are named like "1-0:1.0".
+func sysfsInterfacePrefix(dir string) (string, error) {
+	busnum, err := os.ReadFile(filepath.Join(dir, "busnum"))
+	if err != nil {
+		return "", err
+	}
+	devpath, err := os.ReadFile(filepath.Join(dir, "devpath"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(busnum)) + "-" + strings.TrimSpace(string(devpath)), nil
+}
+
+// sysfsInterfaceDir returns the sysfs directory of interface iface in the
+// active configuration and its name, "<bus>-<devpath>:<config>.<iface>" such
+// as "1-4.2:1.0", which is also the ID its driver's bind and unbind files take
+func (d *Device) sysfsInterfaceDir(iface uint8) (string, string, error) {
+	dir, err := d.sysfsDir()
+	if err != nil {
+		return "", "", err
+	}
+	prefix, err := sysfsInterfacePrefix(dir)
+	if err != nil {
+		return "", "", err
+	}
+	config, err := d.sysfsConfigurationValue()
+	if err != nil {
+		return "", "", err
+	}
+	if config == 0 {
+		return "", "", fmt.Errorf("device is not configured: %w", ErrNotFound)
+	}
+
+	name := fmt.Sprintf("%s:%d.%d", prefix, config, iface)
+	ifaceDir := filepath.Join(dir, name)
+	if _, err := os.Stat(ifaceDir); err != nil {
+		return "", "", fmt.Errorf("interface %s: %w", name, ErrNotFound)
+	}
+	return ifaceDir, name, nil
+}
+
+// KernelDriverName returns the name of the kernel driver bound to interface
+// iface of the active configuration, such as "usb-storage" or "uvcvideo",
+// from the driver link of its sysfs directory. It needs no open handle. An
+// interface without a driver returns ErrNotFound.
+func (d *Device) KernelDriverName(iface uint8) (string, error) {
+	ifaceDir, name, err := d.sysfsInterfaceDir(iface)
+	if err != nil {
+		return "", err
+	}
+	link, err := os.Readlink(filepath.Join(ifaceDir, "driver"))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("interface %s has no kernel driver: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(link), nil
+}
+
+// UnbindKernelDriver unbinds the kernel driver of interface iface by writing
+// the interface's ID to the unbind file of the driver its sysfs directory
+// links to, which usually needs root. Unlike DetachKernelDriver it needs no
+// open handle, and the driver is not bound again when a handle is closed;
+// it stays unbound until the device is plugged in again. An interface
+// without a driver is left alone.
+func (d *Device) UnbindKernelDriver(iface uint8) error {
+	ifaceDir, name, err := d.sysfsInterfaceDir(iface)
+	if err != nil {
+		return err
+	}
+	driver := filepath.Join(ifaceDir, "driver")
+	if _, err := os.Lstat(driver); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := os.WriteFile(filepath.Join(driver, "unbind"), []byte(name), 0200); err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("unbind %s: %w", name, ErrPermissionDenied)
+		}
+		return fmt.Errorf("unbind %s: %w", name, err)
+	}
+	return nil
+}
+
+// sysfsConfigurationValue reads the active bConfigurationValue from sysfs.
+// It only uses the sysfs path recorded at enumeration and returns an error if
+// there is none. An unconfigured device is reported as 0.
+func (d *Device) sysfsConfigurationValue() (int, error) {
+	if d.sysfsPath == "" {
+		return 0, ErrNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(d.sysfsPath, "bConfigurationValue"))
+	if err != nil {
+		return 0, err
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// cachedDefaultConfigurationValue reads the bConfigurationValue of the first
+// configuration from the descriptors file in sysfs, which holds the device
+// descriptor followed by every configuration descriptor
+func (d *Device) cachedDefaultConfigurationValue() (uint8, bool) {
+	dir, err := d.sysfsDir()
+	if err != nil {
+		return 0, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "descriptors"))
+	if err != nil || len(data) < 18+9 || data[18+1] != USB_DT_CONFIG {
+		return 0, false
+	}
+	return data[18+5], true
+}
+
+// cachedInterfaceClasses reads bInterfaceClass from the interface
+// directories sysfs creates for the active configuration, such as
+// "3-2:1.0". An unconfigured device has none and is reported as unknown.
+func (d *Device) cachedInterfaceClasses() ([]uint8, bool) {
+	dir, err := d.sysfsDir()
+	if err != nil {
+		return nil, false
+	}
+
+	prefix, err := sysfsInterfacePrefix(dir)
+	if err != nil {
+		return nil, false
+	}
+	ifaceDirs, err := filepath.Glob(filepath.Join(dir, prefix+":*"))
+	if err != nil || len(ifaceDirs) == 0 {
+		return nil, false
+	}
+
+	classes := make([]uint8, 0, len(ifaceDirs))
+	for _, ifaceDir := range ifaceDirs {
+		data, err := os.ReadFile(filepath.Join(ifaceDir, "bInterfaceClass"))
+		if err != nil {
+			return nil, false
+		}
+		class, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 8)
+		if err != nil {
+			return nil, false
+		}
+		classes = append(classes, uint8(class))
+	}
+	return classes, true
+}
+
+// cachedContainerID reads the Container ID capability from the
+// bos_descriptors file, in which newer kernels publish the BOS descriptor
+// read at enumeration. Older kernels and devices without a BOS descriptor,
+// or whose BOS has no Container ID, report none.
+func (d *Device) cachedContainerID() ([16]byte, bool) {
+	if d.backend != nil {
+		return [16]byte{}, false
+	}
+	dir, err := d.sysfsDir()
+	if err != nil {
+		return [16]byte{}, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "bos_descriptors"))
+	if err != nil {
+		return [16]byte{}, false
+	}
+	_, caps, err := parseBOSDescriptor(data)
+	if err != nil {
+		return [16]byte{}, false
+	}
+	for _, c := range caps {
+		if id, ok := c.ContainerID(); ok {
+			return id, true
+		}
+	}
+	return [16]byte{}, false
+}
+
+// InterfaceInfo summarizes one interface of the active configuration as
+// sysfs publishes it
+type InterfaceInfo struct {
+	Number           uint8
+	AlternateSetting uint8 // Currently selected alternate setting
+	Class            uint8
+	SubClass         uint8
+	Protocol         uint8
+	NumEndpoints     uint8 // Endpoints of the current alternate setting
+
+	// AltEndpoints holds bNumEndpoints of every alternate setting in
+	// descriptor order, so its length is the number of alternate settings.
+	// It is nil if the descriptors file could not be read.
+	AltEndpoints []uint8
+}
+
+// InterfaceInventory lists the interfaces of the device's active
+// configuration, ordered by interface number, without opening the device.
+// The fields of each interface come from its sysfs directory, such as
+// "3-2:1.0", and the alternate settings from the sysfs descriptors file, so
+// this works for devices the caller has no permission to open. An
+// unconfigured device has no interfaces.
+func (d *Device) InterfaceInventory() ([]InterfaceInfo, error) {
+	dir, err := d.sysfsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, err := sysfsInterfacePrefix(dir)
+	if err != nil {
+		return nil, err
+	}
+	ifaceDirs, err := filepath.Glob(filepath.Join(dir, prefix+":*"))
+	if err != nil {
+		return nil, err
+	}
+
+	altEndpoints := sysfsAltEndpoints(dir)
+	infos := make([]InterfaceInfo, 0, len(ifaceDirs))
+	for _, ifaceDir := range ifaceDirs {
+		var info InterfaceInfo
+		for _, attr := range []struct {
+			name  string
+			base  int
+			value *uint8
+		}{
+			{"bInterfaceNumber", 16, &info.Number},
+			{"bAlternateSetting", 10, &info.AlternateSetting},
+			{"bInterfaceClass", 16, &info.Class},
+			{"bInterfaceSubClass", 16, &info.SubClass},
+			{"bInterfaceProtocol", 16, &info.Protocol},
+			{"bNumEndpoints", 16, &info.NumEndpoints},
+		} {
+			data, err := os.ReadFile(filepath.Join(ifaceDir, attr.name))
+			if err != nil {
+				return nil, err
+			}
+			value, err := strconv.ParseUint(strings.TrimSpace(string(data)), attr.base, 8)
+			if err != nil {
+				return nil, fmt.Errorf("%s/%s: %w", filepath.Base(ifaceDir), attr.name, err)
+			}
+			*attr.value = uint8(value)
+		}
+		info.AltEndpoints = altEndpoints[info.Number]
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Number < infos[j].Number })
+	return infos, nil
+}
+
+// sysfsAltEndpoints walks the active configuration in the sysfs descriptors
+// file and returns bNumEndpoints of each alternate setting by interface
+// number. It returns nil if the file or the active configuration can't be
+// read.
+func sysfsAltEndpoints(dir string) map[uint8][]uint8 {
+	data, err := os.ReadFile(filepath.Join(dir, "descriptors"))
+	if err != nil || len(data) < 18 {
+		return nil
+	}
+	configs, err := splitConfigDescriptors(data[18:])
+	if err != nil {
+		return nil
+	}
+
+	value, err := (&Device{sysfsPath: dir}).sysfsConfigurationValue()
+	if err != nil {
+		return nil
+	}
+	for _, config := range configs {
+		if int(config[5]) != value {
+			continue
+		}
+		alts := make(map[uint8][]uint8)
+		for pos := int(config[0]); pos+2 <= len(config); pos += int(config[pos]) {
+			length := int(config[pos])
+			if length < 2 || pos+length > len(config) {
+				return nil
+			}
+			if config[pos+1] == USB_DT_INTERFACE && length >= 9 {
+				number := config[pos+2]
+				alts[number] = append(alts[number], config[pos+4])
+			}
+		}
+		return alts
+	}
+	return nil
+}
+
+// linkTopology sets Parent, Port and Children of devices from their sysfs
+// names, which spell out the port chain from the root hub: "3-2.1" is on
+// port 1 of the hub "3-2", which is on port 2 of the root hub "usb3"
+func linkTopology(devices []*Device) {
+	byName := make(map[string]*Device, len(devices))
+	for _, d := range devices {
+		if d.sysfsPath != "" {
+			byName[filepath.Base(d.sysfsPath)] = d
+		}
+	}
+
+	for name, d := range byName {
+		parentName, port, ok := sysfsParent(name)
+		if !ok {
+			continue
+		}
+		parent := byName[parentName]
+		if parent == nil {
+			continue
+		}
+		d.Parent = parent
+		d.Port = port
+		parent.Children = append(parent.Children, d)
+	}
+
+	for _, d := range devices {
+		sort.Slice(d.Children, func(i, j int) bool { return d.Children[i].Port < d.Children[j].Port })
+	}
+}
+
+// sysfsParent splits a sysfs device name into the name of the hub it hangs
+// off and the port number on that hub. Root hubs ("usb3") have no parent.
+func sysfsParent(name string) (string, uint8, bool) {
+	bus, ports, ok := strings.Cut(name, "-")
+	if !ok {
+		return "", 0, false
+	}
+	parent, last := "usb"+bus, ports
+	if i := strings.LastIndexByte(ports, '.'); i >= 0 {
+		parent, last = bus+"-"+ports[:i], ports[i+1:]
+	}
+	port, err := strconv.ParseUint(last, 10, 8)
+	if err != nil {
+		return "", 0, false
+	}
+	return parent, uint8(port), true
+}
+
+// DeviceBySysfsName looks up a device by its sysfs name, such as "3-2.1" or
+// "usb1" for a root hub, as used by udev rules and kernel logs
+func DeviceBySysfsName(name string) (*Device, error) {
+	if name == "" || strings.ContainsAny(name, "/:") || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid sysfs device name %q: %w", name, ErrInvalidParameter)
+	}
+
+	sysfsPath := filepath.Join("/sys/bus/usb/devices", name)
+	if _, err := os.Stat(sysfsPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrDeviceNotFound
+		}
+		return nil, err
+	}
+
+	device, err := NewSysfsEnumerator().loadDeviceFromSysfs(sysfsPath, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return device.ToUSBDevice(), nil
+}
+
+// OpenSysfsName opens the device with the given sysfs name
+func OpenSysfsName(name string) (*DeviceHandle, error) {
+	device, err := DeviceBySysfsName(name)
+	if err != nil {
+		return nil, err
+	}
+	return device.Open()
+}
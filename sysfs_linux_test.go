@@ -0,0 +1,223 @@
+package usb
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeSysfsAttrs writes the attribute files of a sysfs directory
+func writeSysfsAttrs(t *testing.T, dir string, attrs map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range attrs {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInterfaceClassesSysfs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "3-2")
+	writeSysfsAttrs(t, dir, map[string]string{"busnum": "3", "devpath": "2"})
+	// A webcam with a video control, video streaming and audio interface
+	for iface, class := range map[string]string{"3-2:1.0": "0e", "3-2:1.1": "0e", "3-2:1.2": "01"} {
+		ifaceDir := filepath.Join(dir, iface)
+		if err := os.MkdirAll(ifaceDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(ifaceDir, "bInterfaceClass"), []byte(class+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dev := &Device{sysfsPath: dir}
+	classes, err := dev.InterfaceClasses()
+	if err != nil {
+		t.Fatalf("InterfaceClasses() error = %v", err)
+	}
+	if want := []uint8{0x01, 0x0e}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("InterfaceClasses() = %v, want %v", classes, want)
+	}
+	if !dev.HasClass(0x0e) {
+		t.Error("HasClass(0x0e) = false, want true")
+	}
+	if dev.HasClass(0x08) {
+		t.Error("HasClass(0x08) = true, want false")
+	}
+
+	// The interface of root hub usb1 is 1-0:1.0
+	hub := filepath.Join(t.TempDir(), "usb1")
+	writeSysfsAttrs(t, hub, map[string]string{"busnum": "1", "devpath": "0"})
+	writeSysfsAttrs(t, filepath.Join(hub, "1-0:1.0"), map[string]string{"bInterfaceClass": "09"})
+	if classes, err := (&Device{sysfsPath: hub}).InterfaceClasses(); err != nil || !reflect.DeepEqual(classes, []uint8{0x09}) {
+		t.Errorf("InterfaceClasses() of a root hub = %v, %v, want [9]", classes, err)
+	}
+}
+
+func TestContainerIDSysfs(t *testing.T) {
+	// A BOS with a USB 2.0 extension and a Container ID capability
+	bos, _ := hex.DecodeString("050f200002" + "07100206000000" +
+		"14100400" + "00112233445566778899aabbccddeeff")
+	dir := filepath.Join(t.TempDir(), "2-1")
+	writeSysfsAttrs(t, dir, map[string]string{"bos_descriptors": string(bos)})
+
+	want := [16]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	if id, ok := (&Device{sysfsPath: dir}).cachedContainerID(); !ok || id != want {
+		t.Errorf("cachedContainerID() = %x, %v, want %x", id, ok, want)
+	}
+
+	// Without the capability, or on a kernel without the file, there is none
+	bos, _ = hex.DecodeString("050f0c0001" + "07100206000000")
+	writeSysfsAttrs(t, dir, map[string]string{"bos_descriptors": string(bos)})
+	if id, ok := (&Device{sysfsPath: dir}).cachedContainerID(); ok {
+		t.Errorf("cachedContainerID() without the capability = %x, want none", id)
+	}
+	if id, ok := (&Device{sysfsPath: t.TempDir()}).cachedContainerID(); ok {
+		t.Errorf("cachedContainerID() without bos_descriptors = %x, want none", id)
+	}
+}
+
+func TestInterfaceInventorySysfs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "3-2")
+	// A webcam with a video control interface and a streaming interface
+	// whose alternate setting 1 is selected
+	attrs := map[string]map[string]string{
+		"3-2:1.0": {"bInterfaceNumber": "00", "bAlternateSetting": " 0", "bInterfaceClass": "0e", "bInterfaceSubClass": "01", "bInterfaceProtocol": "00", "bNumEndpoints": "01"},
+		"3-2:1.1": {"bInterfaceNumber": "01", "bAlternateSetting": " 1", "bInterfaceClass": "0e", "bInterfaceSubClass": "02", "bInterfaceProtocol": "00", "bNumEndpoints": "01"},
+	}
+	for iface, files := range attrs {
+		ifaceDir := filepath.Join(dir, iface)
+		if err := os.MkdirAll(ifaceDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range files {
+			if err := os.WriteFile(filepath.Join(ifaceDir, name), []byte(value+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	descriptors, _ := hex.DecodeString(
+		"12010002ef0201406d0425080100" + "00000001" + // Device descriptor
+			"090232000201008032" + // Configuration 1
+			"09040000010e010000" + "0705830310000a" + // Video control with an interrupt endpoint
+			"09040100000e020000" + // Video streaming alt 0, no endpoints
+			"09040101010e020000" + "07058105000401") // Alt 1, one iso endpoint
+	if err := os.WriteFile(filepath.Join(dir, "descriptors"), descriptors, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeSysfsAttrs(t, dir, map[string]string{"bConfigurationValue": "1", "busnum": "3", "devpath": "2"})
+
+	dev := &Device{sysfsPath: dir}
+	infos, err := dev.InterfaceInventory()
+	if err != nil {
+		t.Fatalf("InterfaceInventory() error = %v", err)
+	}
+	want := []InterfaceInfo{
+		{Number: 0, Class: 0x0e, SubClass: 0x01, NumEndpoints: 1, AltEndpoints: []uint8{1}},
+		{Number: 1, AlternateSetting: 1, Class: 0x0e, SubClass: 0x02, NumEndpoints: 1, AltEndpoints: []uint8{0, 1}},
+	}
+	if !reflect.DeepEqual(infos, want) {
+		t.Errorf("InterfaceInventory() = %+v, want %+v", infos, want)
+	}
+}
+
+func TestLinkTopology(t *testing.T) {
+	dev := func(name string) *Device {
+		return &Device{sysfsPath: filepath.Join("/sys/bus/usb/devices", name)}
+	}
+	root, hub, nested, webcam, keyboard := dev("usb3"), dev("3-2"), dev("3-2.4"), dev("3-2.4.1"), dev("3-1")
+	// The hub of this device was not enumerated
+	orphan := dev("3-5.1")
+	linkTopology([]*Device{webcam, hub, root, keyboard, nested, orphan})
+
+	tests := []struct {
+		name   string
+		dev    *Device
+		parent *Device
+		port   uint8
+	}{
+		{name: "root_hub", dev: root},
+		{name: "root_port", dev: keyboard, parent: root, port: 1},
+		{name: "hub", dev: hub, parent: root, port: 2},
+		{name: "nested_hub", dev: nested, parent: hub, port: 4},
+		{name: "leaf", dev: webcam, parent: nested, port: 1},
+		{name: "orphan", dev: orphan},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.dev.Parent != tt.parent || tt.dev.Port != tt.port {
+				t.Errorf("Parent = %v, Port = %d, want %v, %d", tt.dev.Parent, tt.dev.Port, tt.parent, tt.port)
+			}
+		})
+	}
+	if !reflect.DeepEqual(root.Children, []*Device{keyboard, hub}) {
+		t.Errorf("root hub children are not in port order")
+	}
+}
+
+func TestPortPath(t *testing.T) {
+	d := &Device{Bus: 1, Address: 7, sysfsPath: "/sys/devices/pci0000:00/0000:00:14.0/usb1/1-4/1-4.2"}
+	got, err := d.PortPath()
+	if err != nil {
+		t.Fatalf("PortPath() error = %v", err)
+	}
+	if got != "1-4.2" {
+		t.Errorf("PortPath() = %q, want 1-4.2", got)
+	}
+}
+
+func TestKernelDriverSysfs(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "devices", "2-1.3")
+	driverDir := filepath.Join(root, "drivers", "usb-storage")
+	for _, d := range []string{filepath.Join(dir, "2-1.3:1.0"), filepath.Join(dir, "2-1.3:1.1"), driverDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSysfsAttrs(t, dir, map[string]string{"bConfigurationValue": "1", "busnum": "2", "devpath": "1.3"})
+	if err := os.Symlink(driverDir, filepath.Join(dir, "2-1.3:1.0", "driver")); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Device{Bus: 2, Address: 9, sysfsPath: dir}
+	if got, err := d.KernelDriverName(0); err != nil || got != "usb-storage" {
+		t.Errorf("KernelDriverName(0) = %q, %v, want usb-storage", got, err)
+	}
+	if _, err := d.KernelDriverName(1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("KernelDriverName(1) error = %v, want ErrNotFound", err)
+	}
+	if _, err := d.KernelDriverName(2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("KernelDriverName(2) error = %v, want ErrNotFound", err)
+	}
+
+	if err := d.UnbindKernelDriver(0); err != nil {
+		t.Fatalf("UnbindKernelDriver(0) error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(driverDir, "unbind"))
+	if err != nil || string(data) != "2-1.3:1.0" {
+		t.Errorf("unbind file = %q, %v, want 2-1.3:1.0", data, err)
+	}
+	if err := d.UnbindKernelDriver(1); err != nil {
+		t.Errorf("UnbindKernelDriver(1) of an interface without a driver = %v, want nil", err)
+	}
+
+	// Root hub usb2 has the hub driver on 2-0:1.0
+	hub := filepath.Join(root, "devices", "usb2")
+	hubDriver := filepath.Join(root, "drivers", "hub")
+	writeSysfsAttrs(t, hub, map[string]string{"bConfigurationValue": "1", "busnum": "2", "devpath": "0"})
+	writeSysfsAttrs(t, filepath.Join(hub, "2-0:1.0"), nil)
+	writeSysfsAttrs(t, hubDriver, nil)
+	if err := os.Symlink(hubDriver, filepath.Join(hub, "2-0:1.0", "driver")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := (&Device{Bus: 2, Address: 1, sysfsPath: hub}).KernelDriverName(0); err != nil || got != "hub" {
+		t.Errorf("KernelDriverName(0) of a root hub = %q, %v, want hub", got, err)
+	}
+}
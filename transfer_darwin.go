@@ -1,51 +1,83 @@
 package usb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 )
 
-// ErrTimeout represents a timeout error
-var ErrTimeout = fmt.Errorf("transfer timed out")
-
-// ControlTransfer performs a control transfer on the device
+// ControlTransfer performs a control transfer on the default pipe. Bit 7 of
+// requestType is the direction of the data stage: data is sent when it is
+// clear and filled when it is set; ControlIn and ControlOut take the
+// direction from the call instead. More data than wLength can describe
+// returns ErrInvalidParameter. A request the device stalls returns
+// ErrPipeStalled unless the policy of endpoint 0 retries it; see
+// EndpointPolicy.
 func (h *DeviceHandle) ControlTransfer(requestType, request uint8, value, index uint16, data []byte, timeout time.Duration) (int, error) {
+	if len(data) > 0xFFFF {
+		return 0, ErrInvalidParameter
+	}
+
+	n, err := h.controlTransfer(requestType, request, value, index, data, timeout)
+	if errors.Is(err, ErrPipe) {
+		return h.recoverControlStall(err, timeout, func() (int, error) {
+			return h.controlTransfer(requestType, request, value, index, data, timeout)
+		})
+	}
+	return n, err
+}
+
+func (h *DeviceHandle) controlTransfer(requestType, request uint8, value, index uint16, data []byte, timeout time.Duration) (int, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	if h.closed {
 		return 0, fmt.Errorf("device is closed")
 	}
+	return h.defaultPipeTransfer(requestType, request, value, index, data, timeout)
+}
 
-	timeoutMs := uint32(timeout.Milliseconds())
-	if timeoutMs == 0 {
-		timeoutMs = 5000 // Default 5 second timeout
+// BulkTransfer performs a bulk transfer on an endpoint of a claimed interface
+func (h *DeviceHandle) BulkTransfer(endpoint uint8, data []byte, timeout time.Duration) (int, error) {
+	n, err := h.bulkTransfer(endpoint, data, timeout)
+	if errors.Is(err, ErrPipe) {
+		return h.recoverStall(endpoint, n, err, func() (int, error) {
+			return h.bulkTransfer(endpoint, data, timeout)
+		})
 	}
+	return n, err
+}
 
-	return h.devInterface.ControlTransfer(requestType, request, value, index, data, timeoutMs)
+// SetEndpointPolicy sets how bulk transfers on endpoint recover from a stall,
+// like the AUTO_CLEAR_STALL pipe policy of WinUSB. Endpoints start out with
+// the zero policy, under which a stall is left for the caller to clear.
+func (h *DeviceHandle) SetEndpointPolicy(endpoint uint8, policy EndpointPolicy) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return fmt.Errorf("device is closed")
+	}
+
+	h.storeEndpointPolicy(endpoint, policy)
+	return nil
 }
 
-// BulkTransfer performs a bulk transfer on an endpoint
-func (h *DeviceHandle) BulkTransfer(endpoint uint8, data []byte, timeout time.Duration) (int, error) {
+func (h *DeviceHandle) bulkTransfer(endpoint uint8, data []byte, timeout time.Duration) (int, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	if h.closed {
 		return 0, fmt.Errorf("device is closed")
 	}
-
-	// Determine interface from endpoint
-	// This is simplified - need to track which interface owns which endpoint
-	var intf *IOUSBInterfaceInterface
-	for _, i := range h.interfaces {
-		intf = i
-		break
+	if h.backend != nil {
+		return h.backend.Transfer(endpoint, data, timeout)
 	}
 
-	if intf == nil {
-		// No interface claimed, try to auto-claim based on endpoint
-		// In a real implementation, we'd need to properly map endpoints to interfaces
-		return 0, fmt.Errorf("no interface claimed for endpoint %02x", endpoint)
+	intf, pipeRef, err := h.findPipe(endpoint)
+	if err != nil {
+		return 0, err
 	}
 
 	timeoutMs := uint32(timeout.Milliseconds())
@@ -55,15 +87,13 @@ func (h *DeviceHandle) BulkTransfer(endpoint uint8, data []byte, timeout time.Du
 
 	// Determine direction from endpoint address
 	if endpoint&0x80 != 0 {
-		// IN endpoint
-		return intf.BulkTransferIn(endpoint&0x0F, data, timeoutMs)
-	} else {
-		// OUT endpoint
-		return intf.BulkTransferOut(endpoint&0x0F, data, timeoutMs)
+		return intf.BulkTransferIn(pipeRef, data, timeoutMs)
 	}
+	return intf.BulkTransferOut(pipeRef, data, timeoutMs)
 }
 
-// InterruptTransfer performs an interrupt transfer on an endpoint
+// InterruptTransfer performs an interrupt transfer in the direction given by
+// bit 7 of endpoint: IN endpoints fill data, OUT endpoints send it.
 func (h *DeviceHandle) InterruptTransfer(endpoint uint8, data []byte, timeout time.Duration) (int, error) {
 	// On macOS, interrupt transfers use the same mechanism as bulk transfers
 	// The difference is in the endpoint type, which is handled by IOKit
@@ -136,7 +166,7 @@ func (t *Transfer) Submit() error {
 
 	t.actualLength = n
 	if err != nil {
-		if err == ErrTimeout {
+		if errors.Is(err, ErrTimeout) {
 			t.status = TransferTimedOut
 		} else {
 			t.status = TransferError
@@ -220,6 +250,26 @@ func (h *DeviceHandle) FreeStreams(endpoints []uint8) error {
 	return fmt.Errorf("bulk streams not supported on macOS")
 }
 
+// BulkStreamTransfer performs a bulk transfer on one stream of an endpoint
+func (h *DeviceHandle) BulkStreamTransfer(endpoint uint8, streamID uint32, buf []byte, timeout time.Duration) (int, error) {
+	// Stream support would require IOKit USB 3.0 APIs
+	return 0, ErrNotSupported
+}
+
+// ControlTransferContext performs a control transfer that runs until it
+// completes or ctx is done. It is not implemented on macOS and always returns
+// ErrNotSupported; use ControlTransfer with a timeout.
+func (h *DeviceHandle) ControlTransferContext(ctx context.Context, requestType, request uint8, value, index uint16, data []byte) (int, error) {
+	return 0, ErrNotSupported
+}
+
+// BulkTransferContext performs a bulk transfer that runs until it completes or
+// ctx is done. It is not implemented on macOS and always returns
+// ErrNotSupported; use BulkTransfer with a timeout.
+func (h *DeviceHandle) BulkTransferContext(ctx context.Context, endpoint uint8, buf []byte) (int, error) {
+	return 0, ErrNotSupported
+}
+
 // Control transfer helpers
 
 // GetStatus performs a GET_STATUS control request
@@ -1,7 +1,9 @@
 package usb
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"sync"
 	"syscall"
@@ -25,13 +27,50 @@ type Transfer struct {
 
 type TransferCallback func(transfer *Transfer)
 
+// ControlTransfer performs a control transfer on the default pipe. Bit 7 of
+// requestType is the direction of the data stage: data is sent when it is
+// clear and filled when it is set; ControlIn and ControlOut take the
+// direction from the call instead. More data than wLength can describe
+// returns ErrInvalidParameter. A request the device stalls returns
+// ErrPipeStalled unless the policy of endpoint 0 retries it; see
+// EndpointPolicy.
 func (h *DeviceHandle) ControlTransfer(requestType, request uint8, value, index uint16, data []byte, timeout time.Duration) (int, error) {
+	if len(data) > 0xFFFF {
+		return 0, ErrInvalidParameter
+	}
+
+	n, err := h.controlTransfer(requestType, request, value, index, data, timeout)
+	if errors.Is(err, ErrPipeStalled) {
+		return h.recoverControlStall(err, timeout, func() (int, error) {
+			return h.controlTransfer(requestType, request, value, index, data, timeout)
+		})
+	}
+	return n, err
+}
+
+func (h *DeviceHandle) controlTransfer(requestType, request uint8, value, index uint16, data []byte, timeout time.Duration) (int, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	if h.closed {
 		return 0, ErrDeviceNotFound
 	}
+	if h.readOnly {
+		if requestType&0x80 == 0 {
+			return 0, ErrReadOnly
+		}
+		if requestType == 0x80 && request == USB_REQ_GET_DESCRIPTOR {
+			if desc, ok, err := h.cachedDescriptor(uint8(value>>8), uint8(value)); ok {
+				if err != nil {
+					return 0, err
+				}
+				return copy(data, desc), nil
+			}
+		}
+	}
+	if h.backend != nil {
+		return h.backend.ControlTransfer(requestType, request, value, index, data, timeout)
+	}
 
 	var dataPtr unsafe.Pointer
 	dataLen := uint16(len(data))
@@ -52,7 +91,7 @@ func (h *DeviceHandle) ControlTransfer(requestType, request uint8, value, index
 
 	ret, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
 	if errno != 0 {
-		return 0, errno
+		return 0, h.ioctlError(errno)
 	}
 
 	return int(ret), nil
@@ -64,17 +103,207 @@ func (h *DeviceHandle) BulkTransfer(endpoint uint8, data []byte, timeout time.Du
 
 // BulkTransferWithOptions performs a bulk transfer with advanced options
 func (h *DeviceHandle) BulkTransferWithOptions(endpoint uint8, data []byte, timeout time.Duration, allowZeroLength bool) (int, error) {
+	n, err := h.bulkTransfer(endpoint, data, timeout, allowZeroLength)
+	if errors.Is(err, ErrPipeStalled) {
+		return h.recoverStall(endpoint, n, err, func() (int, error) {
+			return h.bulkTransfer(endpoint, data, timeout, allowZeroLength)
+		})
+	}
+	return n, err
+}
+
+// BulkStreamTransfer performs a bulk transfer on one stream of an endpoint
+// whose streams were allocated with AllocStreams, as the data endpoints of a
+// UAS device need. Stream IDs run from 1 to the number of streams allocated;
+// an endpoint without allocated streams or a stream outside that range
+// returns ErrInvalidParameter. A zero timeout waits indefinitely.
+func (h *DeviceHandle) BulkStreamTransfer(endpoint uint8, streamID uint32, buf []byte, timeout time.Duration) (int, error) {
+	urb := &URB{
+		Type:         USBDEVFS_URB_TYPE_BULK,
+		Endpoint:     endpoint,
+		BufferLength: int32(len(buf)),
+	}
+	if len(buf) > 0 {
+		urb.Buffer = unsafe.Pointer(&buf[0])
+	}
+	urb.SetStreamID(streamID)
+
+	done := make(chan error, 1)
+	if err := h.submitStreamURB(urb, done); err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := h.waitURB(ctx, urb, done); err != nil {
+		if err == context.DeadlineExceeded {
+			err = ErrTimeout
+		}
+		return int(urb.ActualLength), err
+	}
+	return int(urb.ActualLength), nil
+}
+
+// submitStreamURB checks the stream of urb against the streams allocated on
+// its endpoint and submits it, sending its completion to done
+func (h *DeviceHandle) submitStreamURB(urb *URB, done chan<- error) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return ErrDeviceNotFound
+	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
+	if h.backend != nil {
+		// Streams are allocated by usbfs, which a Backend is not
+		return ErrNotSupported
+	}
+
+	streamID := uint32(urb.NumberOfPackets)
+	if n := h.streams[urb.Endpoint].count; streamID == 0 || streamID > n {
+		return ErrInvalidParameter
+	}
+
+	return h.submitURB(urb, func(err error) {
+		done <- err
+	})
+}
+
+// ControlTransferContext performs a control transfer on the default pipe
+// that runs until it completes or ctx is done. It is submitted as a URB, and
+// when ctx is done first the URB is discarded and reaped before ctx.Err() is
+// returned, so the kernel no longer touches data by then. Unlike
+// ControlTransfer, a stall is returned to the caller without recovery.
+func (h *DeviceHandle) ControlTransferContext(ctx context.Context, requestType, request uint8, value, index uint16, data []byte) (int, error) {
+	if len(data) > 0xFFFF {
+		return 0, ErrInvalidParameter
+	}
+
+	// Control URBs carry the 8-byte setup packet ahead of the data stage
+	buf := make([]byte, 8+len(data))
+	buf[0] = requestType
+	buf[1] = request
+	binary.LittleEndian.PutUint16(buf[2:4], value)
+	binary.LittleEndian.PutUint16(buf[4:6], index)
+	binary.LittleEndian.PutUint16(buf[6:8], uint16(len(data)))
+	in := requestType&0x80 != 0
+	if !in {
+		copy(buf[8:], data)
+	}
+
+	urb := &URB{
+		Type:         USBDEVFS_URB_TYPE_CONTROL,
+		Buffer:       unsafe.Pointer(&buf[0]),
+		BufferLength: int32(len(buf)),
+	}
+	err := h.transferContext(ctx, urb)
+	n := int(urb.ActualLength)
+	if in {
+		copy(data, buf[8:8+n])
+	}
+	return n, err
+}
+
+// BulkTransferContext performs a bulk transfer in the direction given by bit
+// 7 of endpoint that runs until it completes or ctx is done. When ctx is done
+// first the URB is discarded and reaped before ctx.Err() is returned, along
+// with the number of bytes transferred until then.
+func (h *DeviceHandle) BulkTransferContext(ctx context.Context, endpoint uint8, buf []byte) (int, error) {
+	urb := &URB{
+		Type:         USBDEVFS_URB_TYPE_BULK,
+		Endpoint:     endpoint,
+		BufferLength: int32(len(buf)),
+	}
+	if len(buf) > 0 {
+		urb.Buffer = unsafe.Pointer(&buf[0])
+	}
+	err := h.transferContext(ctx, urb)
+	return int(urb.ActualLength), err
+}
+
+// transferContext submits urb and waits for it with waitURB
+func (h *DeviceHandle) transferContext(ctx context.Context, urb *URB) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	h.mu.RLock()
+	if h.closed {
+		h.mu.RUnlock()
+		return ErrDeviceNotFound
+	}
+	err := h.submitURB(urb, func(err error) {
+		done <- err
+	})
+	h.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	return h.waitURB(ctx, urb, done)
+}
+
+// waitURB waits for the completion of a submitted urb to arrive on done. If
+// ctx is done first, the URB is discarded and its completion still awaited,
+// since the kernel owns the buffer until the URB is reaped; ctx.Err() is
+// returned unless the URB completed successfully in the meantime.
+func (h *DeviceHandle) waitURB(ctx context.Context, urb *URB, done <-chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	h.discardURB(urb)
+	if err := <-done; err == nil {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// SetEndpointPolicy sets how bulk transfers on endpoint recover from a stall,
+// like the AUTO_CLEAR_STALL pipe policy of WinUSB. Endpoints start out with
+// the zero policy, under which a stall is left for the caller to clear.
+func (h *DeviceHandle) SetEndpointPolicy(endpoint uint8, policy EndpointPolicy) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return ErrDeviceNotFound
+	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
+
+	h.storeEndpointPolicy(endpoint, policy)
+	return nil
+}
+
+func (h *DeviceHandle) bulkTransfer(endpoint uint8, data []byte, timeout time.Duration, allowZeroLength bool) (int, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	if h.closed {
 		return 0, ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return 0, ErrReadOnly
+	}
 
 	// Handle zero-length packets
 	if len(data) == 0 && !allowZeroLength {
 		return 0, ErrInvalidParameter
 	}
+	if h.backend != nil {
+		return h.backend.Transfer(endpoint, data, timeout)
+	}
 
 	var dataPtr uintptr
 	if len(data) > 0 {
@@ -93,13 +322,20 @@ func (h *DeviceHandle) BulkTransferWithOptions(endpoint uint8, data []byte, time
 		if errno == syscall.ETIMEDOUT {
 			return 0, ErrTimeout
 		}
-		return 0, errno
+		return 0, transferErrno(errno)
 	}
 
 	return int(ret), nil
 }
 
+// InterruptTransfer performs an interrupt transfer in the direction given by
+// bit 7 of endpoint: IN endpoints fill data, OUT endpoints send it. A failed
+// IN transfer is retried once after clearing the halt. OUT transfers are not
+// retried, since the device may already have received the data.
 func (h *DeviceHandle) InterruptTransfer(endpoint uint8, data []byte, timeout time.Duration) (int, error) {
+	if endpoint&uint8(EndpointDirectionIn) == 0 {
+		return h.InterruptTransferWithRetry(endpoint, data, timeout, 0)
+	}
 	return h.InterruptTransferWithRetry(endpoint, data, timeout, 1)
 }
 
@@ -133,33 +369,46 @@ func (h *DeviceHandle) InterruptTransferWithRetry(endpoint uint8, data []byte, t
 	return 0, lastErr
 }
 
-// ResetDevice performs a USB device reset
-func (h *DeviceHandle) ResetDevice() error {
+// resetDevice releases every claimed interface and issues a USB port reset.
+// The kernel keeps the device at the same address when its descriptors are
+// unchanged; otherwise it re-enumerates and this handle no longer refers to it.
+func (h *DeviceHandle) resetDevice() error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
 
-	// Close and reopen the device file descriptor
-	oldFd := h.fd
-
-	fd, err := syscall.Open(h.device.Path, syscall.O_RDWR, 0)
-	if err != nil {
-		return fmt.Errorf("failed to reopen device: %w", err)
+	if h.backend != nil {
+		return ErrNotSupported
 	}
 
-	h.fd = fd
-	syscall.Close(oldFd)
+	h.invalidateActiveConfig()
 
-	// Clear claimed interfaces state since reset releases all
+	for iface := range h.claimedIfaces {
+		h.releaseInterfaceInternal(iface)
+	}
 	h.claimedIfaces = make(map[uint8]bool)
+	h.streams = nil
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_RESET, 0)
+	if errno != 0 {
+		if errno == syscall.ENODEV || errno == syscall.ENOENT {
+			return ErrDeviceNotFound
+		}
+		return errno
+	}
 
 	return nil
 }
 
-// ResetEndpoint resets a specific endpoint
+// ResetEndpoint resets the data toggle and halt state of an endpoint on the
+// host side only; nothing is sent to the device. Use ClearHalt to recover
+// from a stall reported by the device.
 func (h *DeviceHandle) ResetEndpoint(endpoint uint8) error {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -167,6 +416,13 @@ func (h *DeviceHandle) ResetEndpoint(endpoint uint8) error {
 	if h.closed {
 		return ErrDeviceNotFound
 	}
+	if h.readOnly {
+		return ErrReadOnly
+	}
+
+	if h.backend != nil {
+		return ErrNotSupported
+	}
 
 	ep := uint32(endpoint)
 	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_RESETEP, uintptr(unsafe.Pointer(&ep)))
@@ -303,6 +559,13 @@ type usbBulkTransfer struct {
 }
 
 func (h *DeviceHandle) ReadConfigDescriptor(configIndex uint8) (*ConfigDescriptor, []InterfaceDescriptor, []EndpointDescriptor, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return nil, nil, nil, ErrDeviceNotFound
+	}
+
 	buf := make([]byte, 512)
 
 	ctrl := usbCtrlRequest{
@@ -314,9 +577,15 @@ func (h *DeviceHandle) ReadConfigDescriptor(configIndex uint8) (*ConfigDescripto
 		Data:        unsafe.Pointer(&buf[0]),
 	}
 
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
-	if errno != 0 {
-		return nil, nil, nil, errno
+	if h.backend != nil {
+		if _, err := h.backendControl(&ctrl); err != nil {
+			return nil, nil, nil, err
+		}
+	} else {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(h.fd), USBDEVFS_CONTROL, uintptr(unsafe.Pointer(&ctrl)))
+		if errno != 0 {
+			return nil, nil, nil, errno
+		}
 	}
 
 	if len(buf) < 9 {
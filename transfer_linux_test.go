@@ -0,0 +1,186 @@
+package usb
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"maps"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTransferContextMockBackend(t *testing.T) {
+	// The Backend carries out one URB at a time, so a transfer on 0x81 that
+	// waits for release keeps the ones behind it queued
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	dev := &MockDevice{
+		Bus:     1,
+		Address: 6,
+		Control: func(requestType, request uint8, value, index uint16, data []byte) (int, error) {
+			return copy(data, "ok"), nil
+		},
+		Endpoints: map[uint8]func([]byte) (int, error){
+			0x81: func(data []byte) (int, error) {
+				started <- struct{}{}
+				<-release
+				return copy(data, "late"), nil
+			},
+			0x02: func(data []byte) (int, error) { return len(data), nil },
+		},
+	}
+	h := openMockHandle(t, dev)
+
+	buf := make([]byte, 4)
+	if n, err := h.ControlTransferContext(context.Background(), 0xc0, 0x01, 0, 0, buf); err != nil || string(buf[:n]) != "ok" {
+		t.Errorf("ControlTransferContext() = %q, %v, want \"ok\"", buf[:n], err)
+	}
+	if n, err := h.BulkTransferContext(context.Background(), 0x02, []byte("data")); err != nil || n != 4 {
+		t.Errorf("BulkTransferContext(OUT) = %d, %v, want 4", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := h.BulkTransferContext(ctx, 0x02, []byte("data")); !errors.Is(err, context.Canceled) {
+		t.Errorf("BulkTransferContext() with a done context error = %v, want context.Canceled", err)
+	}
+
+	// Block the queue behind a transfer that only completes on release. The
+	// Backend has started on it, so canceling it has no effect, as for a URB
+	// the kernel finished before the discard.
+	runCtx, runCancel := context.WithCancel(context.Background())
+	blocked := make(chan error, 1)
+	in := make([]byte, 4)
+	go func() {
+		n, err := h.BulkTransferContext(runCtx, 0x81, in)
+		in = in[:n]
+		blocked <- err
+	}()
+	<-started
+	runCancel()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if n, err := h.BulkTransferContext(ctx, 0x02, []byte("data")); !errors.Is(err, context.Canceled) || n != 0 {
+		t.Errorf("BulkTransferContext() canceled while queued = %d, %v, want 0, context.Canceled", n, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := h.ControlTransferContext(ctx, 0xc0, 0x01, 0, 0, buf); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ControlTransferContext() past its deadline error = %v, want context.DeadlineExceeded", err)
+	}
+
+	close(release)
+	if err := <-blocked; err != nil || string(in) != "late" {
+		t.Errorf("BulkTransferContext() canceled while running = %q, %v, want \"late\"", in, err)
+	}
+}
+
+func TestBackendHandleWithoutUsbfs(t *testing.T) {
+	h := openMockHandle(t, &MockDevice{Bus: 1, Address: 7})
+
+	// Nothing that needs a usbfs descriptor may reach the ioctl with fd -1
+	if _, err := h.KernelDriverActive(0); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("KernelDriverActive() error = %v, want ErrNotSupported", err)
+	}
+	if err := h.DetachKernelDriver(0); err != nil {
+		t.Errorf("DetachKernelDriver() error = %v, want nil with no driver bound", err)
+	}
+	if _, err := h.Speed(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Speed() error = %v, want ErrNotSupported", err)
+	}
+	if err := h.ResetEndpoint(0x81); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("ResetEndpoint() error = %v, want ErrNotSupported", err)
+	}
+	if _, err := h.BulkStreamTransfer(0x81, 1, make([]byte, 4), time.Second); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("BulkStreamTransfer() error = %v, want ErrNotSupported", err)
+	}
+}
+
+func TestBulkStreamTransferStreams(t *testing.T) {
+	// A handle whose streams are known but whose usbfs descriptor is not
+	// open, so a URB that passes the stream checks fails at the kernel
+	h := &DeviceHandle{
+		fd:            -1,
+		claimedIfaces: make(map[uint8]bool),
+		refs:          newHandleRefs(),
+		urbReaper:     newURBReaper(),
+		streams:       map[uint8]endpointStreams{0x81: {iface: 1, count: 4}, 0x02: {iface: 1, count: 4}},
+	}
+
+	buf := make([]byte, 512)
+	tests := []struct {
+		name     string
+		endpoint uint8
+		streamID uint32
+		want     error
+	}{
+		{name: "stream_zero", endpoint: 0x81, streamID: 0, want: ErrInvalidParameter},
+		{name: "past_allocated", endpoint: 0x81, streamID: 5, want: ErrInvalidParameter},
+		{name: "no_streams", endpoint: 0x83, streamID: 1, want: ErrInvalidParameter},
+		{name: "allocated", endpoint: 0x81, streamID: 4, want: syscall.EBADF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := h.BulkStreamTransfer(tt.endpoint, tt.streamID, buf, time.Second); !errors.Is(err, tt.want) {
+				t.Errorf("BulkStreamTransfer(0x%02x, %d) error = %v, want %v", tt.endpoint, tt.streamID, err, tt.want)
+			}
+		})
+	}
+
+	// A reset frees every stream, even if it fails on the way
+	h.resetDevice()
+	if len(h.streams) != 0 {
+		t.Errorf("streams after reset = %v, want none", h.streams)
+	}
+	if _, err := h.BulkStreamTransfer(0x81, 1, buf, time.Second); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("BulkStreamTransfer() after reset error = %v, want ErrInvalidParameter", err)
+	}
+}
+
+func TestStreamsDroppedWithInterface(t *testing.T) {
+	config, _ := hex.DecodeString("090247000201008032" +
+		"090400000108065000" + "07058102000200" + // Interface 0: bulk IN 0x81
+		"090401000208066200" + "07058302000200" + "07050402000200" + // Interface 1: bulk 0x83 and 0x04
+		"090401010208066200" + "07058302000200" + "07050402000200") // Its alternate setting 1
+	dev := &MockDevice{
+		Bus:        1,
+		Address:    8,
+		Descriptor: DeviceDescriptor{NumConfigurations: 1},
+		Configs:    [][]byte{config},
+	}
+	h := openMockHandle(t, dev)
+	for _, iface := range []uint8{0, 1} {
+		if err := h.ClaimInterface(iface); err != nil {
+			t.Fatalf("ClaimInterface(%d) error = %v", iface, err)
+		}
+	}
+
+	// The Backend allocates no streams, so set up what AllocStreams records
+	allocated := map[uint8]endpointStreams{
+		0x81: {iface: 0, count: 16},
+		0x83: {iface: 1, count: 16},
+		0x04: {iface: 1, count: 16},
+	}
+	h.streams = maps.Clone(allocated)
+	if err := h.SetInterfaceAltSetting(1, 1); err != nil {
+		t.Fatalf("SetInterfaceAltSetting() error = %v", err)
+	}
+	if want := map[uint8]endpointStreams{0x81: allocated[0x81]}; !maps.Equal(h.streams, want) {
+		t.Errorf("streams after SetInterfaceAltSetting(1) = %v, want %v", h.streams, want)
+	}
+
+	h.streams = maps.Clone(allocated)
+	if err := h.ReleaseInterface(0); err != nil {
+		t.Fatalf("ReleaseInterface() error = %v", err)
+	}
+	delete(allocated, 0x81)
+	if !maps.Equal(h.streams, allocated) {
+		t.Errorf("streams after ReleaseInterface(0) = %v, want %v", h.streams, allocated)
+	}
+}
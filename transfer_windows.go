@@ -1,7 +1,9 @@
 package usb
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"sync"
 	"syscall"
@@ -29,14 +31,37 @@ type Transfer struct {
 // TransferCallback is the callback function type for async transfers
 type TransferCallback func(transfer *Transfer)
 
-// ControlTransfer performs a USB control transfer
+// ControlTransfer performs a control transfer on the default pipe. Bit 7 of
+// requestType is the direction of the data stage: data is sent when it is
+// clear and filled when it is set; ControlIn and ControlOut take the
+// direction from the call instead. More data than wLength can describe
+// returns ErrInvalidParameter. A request the device stalls returns
+// ErrPipeStalled unless the policy of endpoint 0 retries it; see
+// EndpointPolicy.
 func (h *DeviceHandle) ControlTransfer(requestType, request uint8, value, index uint16, data []byte, timeout time.Duration) (int, error) {
+	if len(data) > 0xFFFF {
+		return 0, ErrInvalidParameter
+	}
+
+	n, err := h.controlTransfer(requestType, request, value, index, data, timeout)
+	if errors.Is(err, windows.ERROR_GEN_FAILURE) {
+		return h.recoverControlStall(err, timeout, func() (int, error) {
+			return h.controlTransfer(requestType, request, value, index, data, timeout)
+		})
+	}
+	return n, err
+}
+
+func (h *DeviceHandle) controlTransfer(requestType, request uint8, value, index uint16, data []byte, timeout time.Duration) (int, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	if h.closed {
 		return 0, ErrDeviceNotFound
 	}
+	if h.backend != nil {
+		return h.backend.ControlTransfer(requestType, request, value, index, data, timeout)
+	}
 
 	setupPacket := winusbSetupPacket{
 		RequestType: requestType,
@@ -75,7 +100,7 @@ func (h *DeviceHandle) ControlTransfer(requestType, request uint8, value, index
 	if r0 == 0 {
 		if e1 == windows.ERROR_IO_PENDING {
 			// Wait for completion with timeout
-			waitResult, _ := windows.WaitForSingleObject(event, uint32(timeout.Milliseconds()))
+			waitResult, _ := windows.WaitForSingleObject(event, h.controlTimeout(timeout))
 			if waitResult == uint32(windows.WAIT_TIMEOUT) {
 				return 0, ErrTimeout
 			}
@@ -101,8 +126,76 @@ func (h *DeviceHandle) BulkTransfer(endpoint uint8, data []byte, timeout time.Du
 	return h.BulkTransferWithOptions(endpoint, data, timeout, false)
 }
 
+// BulkStreamTransfer performs a bulk transfer on one stream of an endpoint.
+// WinUSB does not expose bulk streams, so this always returns ErrNotSupported.
+func (h *DeviceHandle) BulkStreamTransfer(endpoint uint8, streamID uint32, buf []byte, timeout time.Duration) (int, error) {
+	return 0, ErrNotSupported
+}
+
+// ControlTransferContext performs a control transfer that runs until it
+// completes or ctx is done. It is not implemented on Windows and always
+// returns ErrNotSupported; use ControlTransfer with a timeout.
+func (h *DeviceHandle) ControlTransferContext(ctx context.Context, requestType, request uint8, value, index uint16, data []byte) (int, error) {
+	return 0, ErrNotSupported
+}
+
+// BulkTransferContext performs a bulk transfer that runs until it completes or
+// ctx is done. It is not implemented on Windows and always returns
+// ErrNotSupported; use BulkTransfer with a timeout.
+func (h *DeviceHandle) BulkTransferContext(ctx context.Context, endpoint uint8, buf []byte) (int, error) {
+	return 0, ErrNotSupported
+}
+
 // BulkTransferWithOptions performs a bulk transfer with advanced options
 func (h *DeviceHandle) BulkTransferWithOptions(endpoint uint8, data []byte, timeout time.Duration, allowZeroLength bool) (int, error) {
+	n, err := h.bulkTransfer(endpoint, data, timeout, allowZeroLength)
+	// WinUSB reports a stalled pipe as ERROR_GEN_FAILURE, a Backend as
+	// ErrPipeStalled
+	if errors.Is(err, windows.ERROR_GEN_FAILURE) || h.backend != nil && errors.Is(err, ErrPipeStalled) {
+		return h.recoverStall(endpoint, n, err, func() (int, error) {
+			return h.bulkTransfer(endpoint, data, timeout, allowZeroLength)
+		})
+	}
+	return n, err
+}
+
+// SetEndpointPolicy sets how bulk transfers on endpoint recover from a
+// stall. AutoClearStall is passed on to WinUSB as the AUTO_CLEAR_STALL pipe
+// policy.
+func (h *DeviceHandle) SetEndpointPolicy(endpoint uint8, policy EndpointPolicy) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return ErrDeviceNotFound
+	}
+
+	// Pipe policies do not apply to the default pipe, whose policy is
+	// carried out by ControlTransfer, nor to a Backend, whose stalls
+	// BulkTransfer recovers from itself
+	if endpoint != 0 && h.backend == nil {
+		var value uint8
+		if policy.AutoClearStall {
+			value = 1
+		}
+		r0, _, e1 := syscall.SyscallN(
+			procWinUsb_SetPipePolicy.Addr(),
+			uintptr(h.winusbHandle),
+			uintptr(endpoint),
+			uintptr(AUTO_CLEAR_STALL),
+			uintptr(1), // AUTO_CLEAR_STALL takes a UCHAR
+			uintptr(unsafe.Pointer(&value)),
+		)
+		if r0 == 0 {
+			return fmt.Errorf("WinUsb_SetPipePolicy failed: %w", e1)
+		}
+	}
+
+	h.storeEndpointPolicy(endpoint, policy)
+	return nil
+}
+
+func (h *DeviceHandle) bulkTransfer(endpoint uint8, data []byte, timeout time.Duration, allowZeroLength bool) (int, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
@@ -113,6 +206,9 @@ func (h *DeviceHandle) BulkTransferWithOptions(endpoint uint8, data []byte, time
 	if len(data) == 0 && !allowZeroLength {
 		return 0, ErrInvalidParameter
 	}
+	if h.backend != nil {
+		return h.backend.Transfer(endpoint, data, timeout)
+	}
 
 	// Set timeout for the pipe
 	if timeout > 0 {
@@ -201,8 +297,14 @@ func (h *DeviceHandle) BulkTransferWithOptions(endpoint uint8, data []byte, time
 	return int(transferred), nil
 }
 
-// InterruptTransfer performs a USB interrupt transfer
+// InterruptTransfer performs an interrupt transfer in the direction given by
+// bit 7 of endpoint: IN endpoints fill data, OUT endpoints send it. A failed
+// IN transfer is retried once after clearing the halt. OUT transfers are not
+// retried, since the device may already have received the data.
 func (h *DeviceHandle) InterruptTransfer(endpoint uint8, data []byte, timeout time.Duration) (int, error) {
+	if endpoint&uint8(EndpointDirectionIn) == 0 {
+		return h.InterruptTransferWithRetry(endpoint, data, timeout, 0)
+	}
 	return h.InterruptTransferWithRetry(endpoint, data, timeout, 1)
 }
 
@@ -234,9 +336,17 @@ func (h *DeviceHandle) InterruptTransferWithRetry(endpoint uint8, data []byte, t
 	return 0, lastErr
 }
 
-// ResetEndpoint resets a specific endpoint
+// ResetEndpoint returns ErrNotSupported. WinUSB has no call that resets the
+// host data toggle and halt state without also sending CLEAR_FEATURE to the
+// device; use ClearHalt, which does both, to recover from a stall.
 func (h *DeviceHandle) ResetEndpoint(endpoint uint8) error {
-	return h.ClearHalt(endpoint)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return ErrDeviceNotFound
+	}
+	return ErrNotSupported
 }
 
 // IsochronousTransfer performs an isochronous transfer (not fully supported on Windows WinUSB)
@@ -1,5 +1,10 @@
 package usb
 
+import (
+	"fmt"
+	"time"
+)
+
 // This file contains common type definitions and constants used across platforms.
 // Platform-specific implementations are in *_linux.go files.
 
@@ -24,6 +29,7 @@ const (
 
 // USB feature selectors
 const (
+	USB_ENDPOINT_HALT            = 0
 	USB_DEVICE_SELF_POWERED      = 0
 	USB_DEVICE_REMOTE_WAKEUP     = 1
 	USB_DEVICE_TEST_MODE         = 2
@@ -61,6 +67,73 @@ const (
 	TransferTypeStream
 )
 
+// String returns the transfer type name
+func (t TransferType) String() string {
+	switch t {
+	case TransferTypeControl:
+		return "Control"
+	case TransferTypeIsochronous:
+		return "Isochronous"
+	case TransferTypeBulk:
+		return "Bulk"
+	case TransferTypeInterrupt:
+		return "Interrupt"
+	case TransferTypeStream:
+		return "Stream"
+	}
+	return "Unknown"
+}
+
+// SyncType is the synchronization type of an isochronous endpoint (bmAttributes bits 3:2)
+type SyncType uint8
+
+const (
+	SyncTypeNone SyncType = iota
+	SyncTypeAsynchronous
+	SyncTypeAdaptive
+	SyncTypeSynchronous
+)
+
+// String returns the synchronization type name
+func (s SyncType) String() string {
+	switch s {
+	case SyncTypeNone:
+		return "None"
+	case SyncTypeAsynchronous:
+		return "Asynchronous"
+	case SyncTypeAdaptive:
+		return "Adaptive"
+	case SyncTypeSynchronous:
+		return "Synchronous"
+	}
+	return "Unknown"
+}
+
+// UsageType is the usage type of an isochronous endpoint (bmAttributes bits 5:4)
+type UsageType uint8
+
+const (
+	UsageTypeData UsageType = iota
+	UsageTypeFeedback
+	UsageTypeImplicitFeedback
+	UsageTypeReserved
+)
+
+// String returns the usage type name
+func (u UsageType) String() string {
+	switch u {
+	case UsageTypeData:
+		return "Data"
+	case UsageTypeFeedback:
+		return "Feedback"
+	case UsageTypeImplicitFeedback:
+		return "Implicit feedback"
+	case UsageTypeReserved:
+		return "Reserved"
+	}
+	return "Unknown"
+}
+
 // Transfer status
 type TransferStatus int
 
@@ -75,6 +148,21 @@ const (
 	TransferInProgress
 )
 
+// PacketError describes an isochronous packet that failed within a transfer
+type PacketError struct {
+	Index  int   // Packet index within the transfer
+	Status int32 // Raw platform status of the packet
+	Err    error // Status mapped onto the package errors, e.g. ErrTimeout or ErrPipeStalled for a stall
+}
+
+func (e PacketError) Error() string {
+	return fmt.Sprintf("packet %d: %v", e.Index, e.Err)
+}
+
+func (e PacketError) Unwrap() error {
+	return e.Err
+}
+
 // DeviceDescriptor represents a USB device descriptor
 type DeviceDescriptor struct {
 	Length            uint8
@@ -93,6 +181,41 @@ type DeviceDescriptor struct {
 	NumConfigurations uint8
 }
 
+// USBVersionString returns bcdUSB in the usual "X.YZ" form, such as "2.10"
+func (d *DeviceDescriptor) USBVersionString() string {
+	return bcdString(d.USBVersion)
+}
+
+// DeviceVersionString returns bcdDevice in the usual "X.YZ" form
+func (d *DeviceDescriptor) DeviceVersionString() string {
+	return bcdString(d.DeviceVersion)
+}
+
+// USBVersionMajor returns the major version of bcdUSB, 3 for USB 3.20
+func (d *DeviceDescriptor) USBVersionMajor() int {
+	return bcdMajor(d.USBVersion)
+}
+
+// USBVersionMinor returns the two digits after the point of bcdUSB, 20 for
+// USB 3.20 and 1 for USB 2.01
+func (d *DeviceDescriptor) USBVersionMinor() int {
+	return bcdMinor(d.USBVersion)
+}
+
+// bcdMajor decodes the high byte of a BCD version number
+func bcdMajor(v uint16) int {
+	return int(v>>12)*10 + int(v>>8&0xf)
+}
+
+// bcdMinor decodes the low byte of a BCD version number
+func bcdMinor(v uint16) int {
+	return int(v>>4&0xf)*10 + int(v&0xf)
+}
+
+func bcdString(v uint16) string {
+	return fmt.Sprintf("%d.%02d", bcdMajor(v), bcdMinor(v))
+}
+
 // RawConfigDescriptor represents a raw USB configuration descriptor
 type RawConfigDescriptor struct {
 	Length             uint8
@@ -128,6 +251,70 @@ type EndpointDescriptor struct {
 	Interval       uint8
 }
 
+// Direction returns the endpoint direction from the address
+func (e EndpointDescriptor) Direction() EndpointDirection {
+	return EndpointDirection(e.EndpointAddr & 0x80)
+}
+
+// TransferType returns the transfer type from the attributes
+func (e EndpointDescriptor) TransferType() TransferType {
+	return TransferType(e.Attributes & 0x03)
+}
+
+// SyncType returns the isochronous synchronization type from the attributes
+func (e EndpointDescriptor) SyncType() SyncType {
+	return SyncType((e.Attributes >> 2) & 0x03)
+}
+
+// UsageType returns the isochronous usage type from the attributes
+func (e EndpointDescriptor) UsageType() UsageType {
+	return UsageType((e.Attributes >> 4) & 0x03)
+}
+
+// PollingInterval returns the service interval of the endpoint at the given
+// device speed; see PollingInterval
+func (e EndpointDescriptor) PollingInterval(speed Speed) time.Duration {
+	return PollingInterval(e.Interval, e.TransferType(), speed)
+}
+
+// PollingInterval decodes bInterval into the period at which the host
+// services a periodic endpoint. Low and full speed interrupt endpoints give
+// the period in frames of 1ms; full speed isochronous endpoints, and
+// periodic endpoints at high speed and above, give an exponent, the period
+// being 2^(bInterval-1) frames or 125µs microframes. Out of range values are
+// clamped. Bulk and control endpoints have no period and return 0, as does
+// an unknown speed.
+func PollingInterval(interval uint8, transferType TransferType, speed Speed) time.Duration {
+	if transferType != TransferTypeInterrupt && transferType != TransferTypeIsochronous {
+		return 0
+	}
+	interval = max(interval, 1)
+
+	exponent := func(unit time.Duration) time.Duration {
+		return unit << (min(interval, 16) - 1)
+	}
+	switch speed {
+	case SpeedLow, SpeedFull:
+		if transferType == TransferTypeInterrupt {
+			return time.Duration(interval) * time.Millisecond
+		}
+		return exponent(time.Millisecond)
+	case SpeedHigh, SpeedSuper, SpeedSuperPlus:
+		return exponent(125 * time.Microsecond)
+	}
+	return 0
+}
+
+// FormatInterval returns the polling period of PollingInterval ready to be
+// printed, such as "1ms" or "125µs", or "" when the endpoint has none
+func FormatInterval(interval uint8, transferType TransferType, speed Speed) string {
+	period := PollingInterval(interval, transferType, speed)
+	if period == 0 {
+		return ""
+	}
+	return period.String()
+}
+
 // USB 3.0+ SuperSpeed Endpoint Companion Descriptor
 type SuperSpeedEndpointCompanionDescriptor struct {
 	Length           uint8
@@ -137,6 +324,32 @@ type SuperSpeedEndpointCompanionDescriptor struct {
 	BytesPerInterval uint16
 }
 
+// MaxStreams returns the number of streams a bulk endpoint supports, from
+// the MaxStreams field in bmAttributes bits 4:0 (2^MaxStreams streams), or 0
+// if it supports none
+func (c *SuperSpeedEndpointCompanionDescriptor) MaxStreams() int {
+	n := c.Attributes & 0x1f
+	if n == 0 || n > 16 {
+		return 0
+	}
+	return 1 << n
+}
+
+// HasSSPIsochCompanion reports whether the companion of an isochronous
+// endpoint is followed by a SuperSpeedPlus isochronous endpoint companion,
+// from bmAttributes bit 7
+func (c *SuperSpeedEndpointCompanionDescriptor) HasSSPIsochCompanion() bool {
+	return c.Attributes&0x80 != 0
+}
+
+// USB 3.1 SuperSpeedPlus Isochronous Endpoint Companion Descriptor
+type SSPIsochEndpointCompanion struct {
+	Length           uint8
+	DescriptorType   uint8 // USB_DT_SUPERSPEEDPLUS_ISOCH_EP_COMP
+	Reserved         uint16
+	BytesPerInterval uint32
+}
+
 // Interface Association Descriptor (IAD)
 type InterfaceAssocDescriptor struct {
 	Length           uint8
@@ -162,7 +375,7 @@ type DeviceCapabilityDescriptor struct {
 	Length            uint8
 	DescriptorType    uint8 // USB_DT_DEVICE_CAPABILITY
 	DevCapabilityType uint8
-	// Capability-specific data follows
+	Data              []byte // The complete capability, header included
 }
 
 // USB 2.0 Extension Capability
@@ -185,6 +398,99 @@ type SuperSpeedUSBCapability struct {
 	U2DevExitLat           uint16
 }
 
+// SuperSpeedPlus USB Capability
+type SuperSpeedPlusCapability struct {
+	Length                 uint8
+	DescriptorType         uint8
+	DevCapabilityType      uint8 // 0x0A
+	Attributes             uint32
+	FunctionalitySupported uint16
+	SublinkSpeedAttributes []SublinkSpeedAttribute
+}
+
+// SublinkSpeedAttributeCount returns the number of sublink speed attribute
+// entries declared in the attributes field
+func (c *SuperSpeedPlusCapability) SublinkSpeedAttributeCount() int {
+	return int(c.Attributes&0x1f) + 1
+}
+
+// SublinkSpeedIDCount returns the number of distinct sublink speed IDs
+func (c *SuperSpeedPlusCapability) SublinkSpeedIDCount() int {
+	return int((c.Attributes>>5)&0x0f) + 1
+}
+
+// MinSpeedAttributeID returns the sublink speed ID of the lowest speed at
+// which the device is fully functional
+func (c *SuperSpeedPlusCapability) MinSpeedAttributeID() uint8 {
+	return uint8(c.FunctionalitySupported & 0x0f)
+}
+
+// MinRxLanes returns the minimum number of receive lanes the device needs
+func (c *SuperSpeedPlusCapability) MinRxLanes() uint8 {
+	return uint8((c.FunctionalitySupported >> 8) & 0x0f)
+}
+
+// MinTxLanes returns the minimum number of transmit lanes the device needs
+func (c *SuperSpeedPlusCapability) MinTxLanes() uint8 {
+	return uint8((c.FunctionalitySupported >> 12) & 0x0f)
+}
+
+// SublinkSpeedAttribute is one bmSublinkSpeedAttr entry of the SuperSpeedPlus
+// capability
+type SublinkSpeedAttribute uint32
+
+// ID returns the sublink speed attribute ID shared by the RX and TX entries
+// of one speed
+func (a SublinkSpeedAttribute) ID() uint8 {
+	return uint8(a & 0x0f)
+}
+
+// LaneSpeedExponent returns the unit of the lane speed mantissa: 0 for b/s,
+// 1 for Kb/s, 2 for Mb/s and 3 for Gb/s
+func (a SublinkSpeedAttribute) LaneSpeedExponent() uint8 {
+	return uint8((a >> 4) & 0x03)
+}
+
+// Asymmetric reports whether the RX and TX lanes run at different speeds
+func (a SublinkSpeedAttribute) Asymmetric() bool {
+	return a&(1<<6) != 0
+}
+
+// Transmit reports whether an asymmetric entry describes the TX direction
+func (a SublinkSpeedAttribute) Transmit() bool {
+	return a&(1<<7) != 0
+}
+
+// LinkProtocol returns 0 for SuperSpeed and 1 for SuperSpeedPlus
+func (a SublinkSpeedAttribute) LinkProtocol() uint8 {
+	return uint8((a >> 14) & 0x03)
+}
+
+// LaneSpeedMantissa returns the lane speed in the unit given by
+// LaneSpeedExponent
+func (a SublinkSpeedAttribute) LaneSpeedMantissa() uint16 {
+	return uint16(a >> 16)
+}
+
+// LaneSpeed returns the speed of a single lane in bits per second
+func (a SublinkSpeedAttribute) LaneSpeed() uint64 {
+	speed := uint64(a.LaneSpeedMantissa())
+	for i := uint8(0); i < a.LaneSpeedExponent(); i++ {
+		speed *= 1000
+	}
+	return speed
+}
+
+// Platform Capability, which carries data defined by the owner of its UUID,
+// such as the Microsoft OS 2.0 and WebUSB descriptor sets
+type PlatformCapability struct {
+	Length            uint8
+	DescriptorType    uint8
+	DevCapabilityType uint8 // 0x05
+	UUID              [16]byte
+	CapabilityData    []byte
+}
+
 // OTG Descriptor
 type OTGDescriptor struct {
 	Length         uint8
@@ -204,3 +510,8 @@ type DeviceQualifierDescriptor struct {
 	NumConfigurations uint8
 	Reserved          uint8
 }
+
+// USBVersionString returns bcdUSB in the usual "X.YZ" form
+func (d *DeviceQualifierDescriptor) USBVersionString() string {
+	return bcdString(d.USBVersion)
+}
@@ -0,0 +1,62 @@
+package usb
+
+import "testing"
+
+func TestDeviceDescriptorVersions(t *testing.T) {
+	tests := []struct {
+		bcd          uint16
+		want         string
+		major, minor int
+	}{
+		{0x0110, "1.10", 1, 10},
+		{0x0200, "2.00", 2, 0},
+		{0x0201, "2.01", 2, 1},
+		{0x0210, "2.10", 2, 10},
+		{0x0320, "3.20", 3, 20},
+		{0x1099, "10.99", 10, 99},
+	}
+
+	for _, tt := range tests {
+		d := DeviceDescriptor{USBVersion: tt.bcd, DeviceVersion: tt.bcd}
+		if got := d.USBVersionString(); got != tt.want {
+			t.Errorf("USBVersionString(0x%04x) = %q, want %q", tt.bcd, got, tt.want)
+		}
+		if got := d.DeviceVersionString(); got != tt.want {
+			t.Errorf("DeviceVersionString(0x%04x) = %q, want %q", tt.bcd, got, tt.want)
+		}
+		if d.USBVersionMajor() != tt.major || d.USBVersionMinor() != tt.minor {
+			t.Errorf("USBVersionMajor/Minor(0x%04x) = %d, %d, want %d, %d",
+				tt.bcd, d.USBVersionMajor(), d.USBVersionMinor(), tt.major, tt.minor)
+		}
+	}
+}
+
+func TestFormatInterval(t *testing.T) {
+	tests := []struct {
+		interval     uint8
+		transferType TransferType
+		speed        Speed
+		want         string
+	}{
+		{10, TransferTypeInterrupt, SpeedFull, "10ms"},
+		{255, TransferTypeInterrupt, SpeedLow, "255ms"},
+		{1, TransferTypeIsochronous, SpeedFull, "1ms"},
+		{4, TransferTypeIsochronous, SpeedFull, "8ms"},
+		{1, TransferTypeInterrupt, SpeedHigh, "125µs"},
+		{4, TransferTypeIsochronous, SpeedHigh, "1ms"},
+		{7, TransferTypeInterrupt, SpeedSuper, "8ms"},
+		{16, TransferTypeInterrupt, SpeedSuperPlus, "4.096s"},
+		{0, TransferTypeIsochronous, SpeedHigh, "125µs"},
+		{32, TransferTypeInterrupt, SpeedHigh, "4.096s"},
+		{0, TransferTypeBulk, SpeedHigh, ""},
+		{1, TransferTypeControl, SpeedFull, ""},
+		{1, TransferTypeInterrupt, SpeedUnknown, ""},
+	}
+
+	for _, tt := range tests {
+		got := FormatInterval(tt.interval, tt.transferType, tt.speed)
+		if got != tt.want {
+			t.Errorf("FormatInterval(%d, %v, %d) = %q, want %q", tt.interval, tt.transferType, tt.speed, got, tt.want)
+		}
+	}
+}
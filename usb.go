@@ -27,6 +27,16 @@ var (
 	ErrInterrupted      = fmt.Errorf("interrupted")
 	ErrNoMem            = fmt.Errorf("no memory")
 	ErrOther            = fmt.Errorf("other error")
+	ErrReadOnly         = fmt.Errorf("device opened read-only")
+	ErrNoDriver         = fmt.Errorf("no kernel driver attached")
+
+	// ErrPipeStalled is returned when the device answers a transfer with a
+	// STALL handshake. It matches ErrPipe as well; ClearHalt recovers the
+	// endpoint.
+	ErrPipeStalled = fmt.Errorf("endpoint stalled: %w", ErrPipe)
+	// ErrBabble is returned when the device sent more data than the packet
+	// or buffer had room for. It matches ErrOverflow as well.
+	ErrBabble = fmt.Errorf("babble: %w", ErrOverflow)
 )
 
 // Speed types
@@ -48,3 +58,21 @@ const (
 	EndpointDirectionOut EndpointDirection = 0
 	EndpointDirectionIn  EndpointDirection = 0x80
 )
+
+// String returns "IN" or "OUT"
+func (d EndpointDirection) String() string {
+	if d&EndpointDirectionIn != 0 {
+		return "IN"
+	}
+	return "OUT"
+}
+
+// Recipient is the recipient of a control request (bmRequestType bits 4:0)
+type Recipient uint8
+
+const (
+	RecipientDevice    Recipient = 0x00
+	RecipientInterface Recipient = 0x01
+	RecipientEndpoint  Recipient = 0x02
+	RecipientOther     Recipient = 0x03
+)
@@ -3,6 +3,7 @@ package usb
 import (
 	"fmt"
 	"os"
+	"sync"
 	"testing"
 	"time"
 )
@@ -238,6 +239,170 @@ func TestStringDescriptor(t *testing.T) {
 	}
 }
 
+func TestConcurrentControlTransfers(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Skipping test that requires root privileges")
+	}
+
+	devices, err := DeviceList()
+	if err != nil || len(devices) == 0 {
+		t.Skip("No USB devices available for testing")
+	}
+
+	var testDevice *Device
+	for _, dev := range devices {
+		if dev.Descriptor.ManufacturerIndex > 0 || dev.Descriptor.ProductIndex > 0 {
+			testDevice = dev
+			break
+		}
+	}
+
+	if testDevice == nil {
+		t.Skip("No device with string descriptors found")
+	}
+
+	handle, err := testDevice.Open()
+	if err != nil {
+		if err == ErrPermissionDenied {
+			t.Skip("Permission denied to open USB device")
+		}
+		t.Fatalf("Failed to open device: %v", err)
+	}
+	defer handle.Close()
+
+	index := testDevice.Descriptor.ProductIndex
+	if index == 0 {
+		index = testDevice.Descriptor.ManufacturerIndex
+	}
+
+	want, err := handle.StringDescriptor(index)
+	if err != nil {
+		t.Skipf("Device does not return string descriptor %d: %v", index, err)
+	}
+	wantStatus, err := handle.GetStatus(0, 0)
+	if err != nil {
+		t.Skipf("Device does not return status: %v", err)
+	}
+
+	const goroutines = 16
+	const iterations = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				status, err := handle.GetStatus(0, 0)
+				if err != nil {
+					errs <- fmt.Errorf("GetStatus: %w", err)
+					return
+				}
+				if status != wantStatus {
+					errs <- fmt.Errorf("GetStatus = 0x%04x, want 0x%04x", status, wantStatus)
+					return
+				}
+
+				str, err := handle.StringDescriptor(index)
+				if err != nil {
+					errs <- fmt.Errorf("StringDescriptor: %w", err)
+					return
+				}
+				if str != want {
+					errs <- fmt.Errorf("StringDescriptor = %q, want %q", str, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestDeviceListWhileOpen(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Skipping test that requires root privileges")
+	}
+
+	devices, err := DeviceList()
+	if err != nil || len(devices) == 0 {
+		t.Skip("No USB devices available for testing")
+	}
+
+	dev := devices[0]
+	handle, err := dev.Open()
+	if err != nil {
+		if err == ErrPermissionDenied {
+			t.Skip("Permission denied to open USB device")
+		}
+		t.Fatalf("Failed to open device: %v", err)
+	}
+	defer handle.Close()
+
+	wantStatus, err := handle.GetStatus(0, 0)
+	if err != nil {
+		t.Skipf("Device does not return status: %v", err)
+	}
+
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			status, err := handle.GetStatus(0, 0)
+			if err != nil {
+				errs <- fmt.Errorf("GetStatus during enumeration: %w", err)
+				return
+			}
+			if status != wantStatus {
+				errs <- fmt.Errorf("GetStatus = 0x%04x, want 0x%04x", status, wantStatus)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		list, err := DeviceList()
+		if err != nil {
+			t.Fatalf("DeviceList() while a handle is open: %v", err)
+		}
+
+		found := false
+		for _, d := range list {
+			if d.Path == dev.Path {
+				found = true
+				if d == dev {
+					t.Error("DeviceList returned the Device the handle was opened from")
+				}
+			}
+		}
+		if !found {
+			t.Errorf("open device %s missing from DeviceList", dev.Path)
+		}
+	}
+	close(stop)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if handle.Device() != dev {
+		t.Error("enumeration changed the handle's Device")
+	}
+	if _, err := handle.GetStatus(0, 0); err != nil {
+		t.Errorf("GetStatus after enumeration: %v", err)
+	}
+}
+
 func BenchmarkDeviceList(b *testing.B) {
 	_, err := DeviceList()
 	if err != nil {
@@ -264,3 +429,77 @@ func ExampleDeviceList() {
 			dev.Descriptor.VendorID, dev.Descriptor.ProductID)
 	}
 }
+
+func BenchmarkGetStatusInto(b *testing.B) {
+	if os.Getuid() != 0 {
+		b.Skip("Skipping benchmark that requires root privileges")
+	}
+
+	devices, err := DeviceList()
+	if err != nil || len(devices) == 0 {
+		b.Skip("No USB devices available for benchmarking")
+	}
+
+	handle, err := devices[0].Open()
+	if err != nil {
+		b.Skipf("Failed to open device: %v", err)
+	}
+	defer handle.Close()
+
+	buf := make([]byte, 2)
+	if _, err := handle.GetStatusInto(0, 0, buf); err != nil {
+		b.Skipf("Device does not return status: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := handle.GetStatusInto(0, 0, buf); err != nil {
+			b.Fatalf("GetStatusInto: %v", err)
+		}
+	}
+	b.StopTimer()
+
+	if allocs := testing.AllocsPerRun(100, func() {
+		handle.GetStatusInto(0, 0, buf)
+	}); allocs != 0 {
+		b.Errorf("GetStatusInto allocated %.1f times per call, want 0", allocs)
+	}
+}
+
+func TestClone(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Skipping test that requires root privileges")
+	}
+
+	devices, err := DeviceList()
+	if err != nil || len(devices) == 0 {
+		t.Skip("No USB devices available for testing")
+	}
+
+	handle, err := devices[0].Open()
+	if err != nil {
+		if err == ErrPermissionDenied {
+			t.Skip("Permission denied to open USB device")
+		}
+		t.Fatalf("Failed to open device: %v", err)
+	}
+
+	clone, err := handle.Clone()
+	if err != nil {
+		handle.Close()
+		t.Fatalf("Clone() error = %v", err)
+	}
+	defer clone.Close()
+
+	// The clone keeps the device open after the original handle is closed
+	if err := handle.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := handle.GetStatus(0, 0); err == nil {
+		t.Error("GetStatus on the closed handle succeeded")
+	}
+	if _, err := clone.GetStatus(0, 0); err != nil {
+		t.Errorf("GetStatus on the clone error = %v", err)
+	}
+}
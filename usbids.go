@@ -2,17 +2,23 @@ package usb
 
 import (
 	"bufio"
+	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
 )
 
+// USBIDDatabase maps vendor, product and class codes to names, in the
+// format of the usb.ids file maintained at http://www.linux-usb.org/usb-ids.html
 type USBIDDatabase struct {
-	vendors map[uint16]Vendor
-	classes map[uint8]string
-	mu      sync.RWMutex
-	loaded  bool
+	vendors    map[uint16]Vendor
+	classes    map[uint8]string
+	subClasses map[uint16]string // class<<8 | subclass
+	protocols  map[uint32]string // class<<16 | subclass<<8 | protocol
+	mu         sync.RWMutex
+	loaded     bool
 }
 
 type Vendor struct {
@@ -21,8 +27,20 @@ type Vendor struct {
 }
 
 var globalUSBIDs = &USBIDDatabase{
-	vendors: make(map[uint16]Vendor),
-	classes: make(map[uint8]string),
+	vendors:    make(map[uint16]Vendor),
+	classes:    make(map[uint8]string),
+	subClasses: make(map[uint16]string),
+	protocols:  make(map[uint32]string),
+}
+
+// systemUSBIDsOnce guards the one attempt to load the system usb.ids
+var systemUSBIDsOnce sync.Once
+
+// systemUSBIDsPaths are where distributions install usb.ids
+var systemUSBIDsPaths = []string{
+	"/usr/share/hwdata/usb.ids",
+	"/usr/share/usb.ids",
+	"/var/lib/usbutils/usb.ids",
 }
 
 func init() {
@@ -106,6 +124,11 @@ func (db *USBIDDatabase) initBasicEntries() {
 	db.classes[0x0e] = "Video"
 	db.classes[0x0f] = "Personal Healthcare"
 	db.classes[0x10] = "Audio/Video Devices"
+	db.classes[0x11] = "Billboard"
+	db.classes[0x12] = "USB Type-C Bridge"
+	db.classes[0x13] = "USB Bulk Display Protocol"
+	db.classes[0x14] = "MCTP over USB Protocol Endpoint"
+	db.classes[0x3c] = "I3C"
 	db.classes[0xdc] = "Diagnostic"
 	db.classes[0xe0] = "Wireless"
 	db.classes[0xef] = "Miscellaneous Device"
@@ -113,80 +136,139 @@ func (db *USBIDDatabase) initBasicEntries() {
 	db.classes[0xff] = "Vendor Specific"
 }
 
+// LoadFromFile replaces the contents of the database with the usb.ids file
+// at path
 func (db *USBIDDatabase) LoadFromFile(path string) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-
 	file, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	var currentVendor uint16
-	var inVendor bool
+	return db.Load(file)
+}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+// Load replaces the contents of the database with data in usb.ids format.
+// Vendors start at the beginning of a line with their 4-digit hex ID and
+// name, and their products follow on lines indented by one tab. A "C" line
+// starts a device class, followed by its subclasses indented by one tab and
+// their protocols by two. IDs may carry a 0x prefix. Lines starting with #
+// are comments, and the other sections of usb.ids, such as HID usages and
+// languages, are skipped. On error the database is left unchanged.
+func (db *USBIDDatabase) Load(r io.Reader) error {
+	parsed := &USBIDDatabase{
+		vendors:    make(map[uint16]Vendor),
+		classes:    make(map[uint8]string),
+		subClasses: make(map[uint16]string),
+		protocols:  make(map[uint32]string),
+	}
+	if err := parsed.parse(r); err != nil {
+		return err
+	}
 
-		// Skip empty lines and comments
-		if len(line) == 0 || strings.HasPrefix(line, "#") {
-			continue
-		}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.vendors = parsed.vendors
+	db.classes = parsed.classes
+	db.subClasses = parsed.subClasses
+	db.protocols = parsed.protocols
+	db.loaded = true
+	return nil
+}
 
-		// Check for class section
-		if strings.HasPrefix(line, "C ") {
-			inVendor = false
+// parse fills the empty maps of db from data in usb.ids format
+func (db *USBIDDatabase) parse(r io.Reader) error {
+	const (
+		sectionNone = iota
+		sectionVendor
+		sectionClass
+	)
+	section := sectionNone
+	var vendor, class, subClass uint64
+	var haveSubClass bool
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
 			continue
 		}
 
-		if !inVendor {
-			// Parse vendor line
-			if len(line) >= 4 && isHex(line[:4]) {
-				vid, err := strconv.ParseUint(line[:4], 16, 16)
+		depth := len(line) - len(strings.TrimLeft(line, "\t"))
+		line = line[depth:]
+
+		if depth == 0 {
+			haveSubClass = false
+			if name, ok := strings.CutPrefix(line, "C "); ok {
+				id, name, err := parseUSBIDsEntry(name, 8)
 				if err != nil {
-					continue
+					return fmt.Errorf("usb.ids line %d: %w", lineNum, err)
 				}
-				currentVendor = uint16(vid)
-				vendorName := strings.TrimSpace(line[4:])
+				class = id
+				db.classes[uint8(class)] = name
+				section = sectionClass
+				continue
+			}
 
-				vendor := db.vendors[currentVendor]
-				vendor.Name = vendorName
-				if vendor.Products == nil {
-					vendor.Products = make(map[uint16]string)
-				}
-				db.vendors[currentVendor] = vendor
-				inVendor = true
+			id, name, err := parseUSBIDsEntry(line, 16)
+			if err != nil {
+				// The header of another section, such as "HID" or "L"
+				section = sectionNone
+				continue
 			}
-		} else {
-			// Parse product line (should start with tab)
-			if strings.HasPrefix(line, "\t") && len(line) >= 5 {
-				line = line[1:] // Remove tab
-				if len(line) >= 4 && isHex(line[:4]) {
-					pid, err := strconv.ParseUint(line[:4], 16, 16)
-					if err != nil {
-						continue
-					}
-					productName := strings.TrimSpace(line[4:])
-
-					vendor := db.vendors[currentVendor]
-					if vendor.Products == nil {
-						vendor.Products = make(map[uint16]string)
-					}
-					vendor.Products[uint16(pid)] = productName
-					db.vendors[currentVendor] = vendor
-				}
-			} else {
-				inVendor = false
+			vendor = id
+			db.vendors[uint16(vendor)] = Vendor{Name: name, Products: make(map[uint16]string)}
+			section = sectionVendor
+			continue
+		}
+
+		switch {
+		case section == sectionVendor && depth == 1:
+			id, name, err := parseUSBIDsEntry(line, 16)
+			if err != nil {
+				return fmt.Errorf("usb.ids line %d: %w", lineNum, err)
 			}
+			db.vendors[uint16(vendor)].Products[uint16(id)] = name
+		case section == sectionClass && depth == 1:
+			id, name, err := parseUSBIDsEntry(line, 8)
+			if err != nil {
+				return fmt.Errorf("usb.ids line %d: %w", lineNum, err)
+			}
+			subClass, haveSubClass = id, true
+			db.subClasses[uint16(class<<8|subClass)] = name
+		case section == sectionClass && depth == 2 && haveSubClass:
+			id, name, err := parseUSBIDsEntry(line, 8)
+			if err != nil {
+				return fmt.Errorf("usb.ids line %d: %w", lineNum, err)
+			}
+			db.protocols[uint32(class<<16|subClass<<8|id)] = name
 		}
+		// Deeper levels, such as the interfaces listed under some
+		// products, are not kept
 	}
-
-	db.loaded = true
 	return scanner.Err()
 }
 
+// parseUSBIDsEntry splits an unindented usb.ids entry into its hex ID of up
+// to bits bits and its name
+func parseUSBIDsEntry(line string, bits int) (uint64, string, error) {
+	idText, name := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		idText, name = line[:i], line[i+1:]
+	}
+	idText = strings.TrimPrefix(strings.TrimPrefix(idText, "0x"), "0X")
+	if idText == "" || len(idText) > bits/4 || !isHex(idText) {
+		return 0, "", fmt.Errorf("invalid ID %q", line)
+	}
+	id, err := strconv.ParseUint(idText, 16, bits)
+	if err != nil {
+		return 0, "", err
+	}
+	return id, strings.TrimSpace(name), nil
+}
+
 func (db *USBIDDatabase) VendorName(vid uint16) string {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
@@ -219,6 +301,26 @@ func (db *USBIDDatabase) ClassName(class uint8) string {
 	return ""
 }
 
+// SubClassName returns the name of a subclass of class, or ""
+func (db *USBIDDatabase) SubClassName(class, subClass uint8) string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.subClasses[uint16(class)<<8|uint16(subClass)]
+}
+
+// ProtocolName returns the name of a protocol of a class and subclass, or ""
+func (db *USBIDDatabase) ProtocolName(class, subClass, protocol uint8) string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.protocols[uint32(class)<<16|uint32(subClass)<<8|uint32(protocol)]
+}
+
+func (db *USBIDDatabase) isLoaded() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.loaded
+}
+
 func isHex(s string) bool {
 	for _, c := range s {
 		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
@@ -228,42 +330,66 @@ func isHex(s string) bool {
 	return true
 }
 
-// Global functions for convenience
-func VendorName(vid uint16) string {
-	// Try to load USB IDs database if not loaded
-	if !globalUSBIDs.loaded {
-		paths := []string{
-			"/usr/share/hwdata/usb.ids",
-			"/usr/share/usb.ids",
-			"/var/lib/usbutils/usb.ids",
+// LoadUSBIDs replaces the database behind VendorName, ProductName,
+// ClassName, SubClassName and ProtocolName with data in usb.ids format, for
+// programs that ship their own copy or update it at runtime. Once a database
+// has been loaded, the system usb.ids is no longer looked for.
+func LoadUSBIDs(r io.Reader) error {
+	return globalUSBIDs.Load(r)
+}
+
+// LoadUSBIDsFromFile is LoadUSBIDs for the usb.ids file at path
+func LoadUSBIDsFromFile(path string) error {
+	return globalUSBIDs.LoadFromFile(path)
+}
+
+// loadSystemUSBIDs loads the usb.ids installed on the system the first time
+// a name is looked up, unless one was loaded explicitly. Until then the
+// lookups use a small built-in table.
+func loadSystemUSBIDs() {
+	systemUSBIDsOnce.Do(func() {
+		if globalUSBIDs.isLoaded() {
+			return
 		}
-		for _, path := range paths {
+		for _, path := range systemUSBIDsPaths {
 			if err := globalUSBIDs.LoadFromFile(path); err == nil {
 				break
 			}
 		}
-	}
+	})
+}
 
+// VendorName returns the name of a vendor ID, or "" if it is unknown
+func VendorName(vid uint16) string {
+	loadSystemUSBIDs()
 	return globalUSBIDs.VendorName(vid)
 }
 
+// ProductName returns the name of a product of a vendor, or "" if it is
+// unknown
 func ProductName(vid, pid uint16) string {
-	if !globalUSBIDs.loaded {
-		paths := []string{
-			"/usr/share/hwdata/usb.ids",
-			"/usr/share/usb.ids",
-			"/var/lib/usbutils/usb.ids",
-		}
-		for _, path := range paths {
-			if err := globalUSBIDs.LoadFromFile(path); err == nil {
-				break
-			}
-		}
-	}
-
+	loadSystemUSBIDs()
 	return globalUSBIDs.ProductName(vid, pid)
 }
 
+// ClassName returns the name of a USB class code as assigned by the USB-IF,
+// for use with device, interface and function class fields. It returns ""
+// for codes that are not assigned.
 func ClassName(class uint8) string {
+	loadSystemUSBIDs()
 	return globalUSBIDs.ClassName(class)
 }
+
+// SubClassName returns the name of a subclass of a USB class code, or "" if
+// it is unknown
+func SubClassName(class, subClass uint8) string {
+	loadSystemUSBIDs()
+	return globalUSBIDs.SubClassName(class, subClass)
+}
+
+// ProtocolName returns the name of a protocol of a USB class and subclass,
+// or "" if it is unknown
+func ProtocolName(class, subClass, protocol uint8) string {
+	loadSystemUSBIDs()
+	return globalUSBIDs.ProtocolName(class, subClass, protocol)
+}
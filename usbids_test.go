@@ -0,0 +1,59 @@
+package usb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUSBIDDatabaseLoad(t *testing.T) {
+	const ids = "# usb.ids excerpt\n" +
+		"046d  Logitech, Inc.\n" +
+		"\t08e5  C920 PRO HD Webcam\n" +
+		"\t\t00  Video interface\n" +
+		"0x1d6b  Linux Foundation\r\n" +
+		"\t0x0002  2.0 root hub\r\n" +
+		"\n" +
+		"C 0e  Video\n" +
+		"\t01  Video Control\n" +
+		"\t02  Video Streaming\n" +
+		"\t\t00  Undefined\n" +
+		"# List of HID usages\n" +
+		"HUT 01  Generic Desktop Controls\n" +
+		"\t002  Mouse\n" +
+		"L 0409  English (US)\n"
+
+	db := &USBIDDatabase{}
+	if err := db.Load(strings.NewReader(ids)); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "vendor", got: db.VendorName(0x046d), want: "Logitech, Inc."},
+		{name: "product", got: db.ProductName(0x046d, 0x08e5), want: "C920 PRO HD Webcam"},
+		{name: "hex_prefixed_vendor", got: db.VendorName(0x1d6b), want: "Linux Foundation"},
+		{name: "hex_prefixed_product", got: db.ProductName(0x1d6b, 0x0002), want: "2.0 root hub"},
+		{name: "unknown_product", got: db.ProductName(0x046d, 0x0000), want: ""},
+		{name: "class", got: db.ClassName(0x0e), want: "Video"},
+		{name: "subclass", got: db.SubClassName(0x0e, 0x02), want: "Video Streaming"},
+		{name: "protocol", got: db.ProtocolName(0x0e, 0x02, 0x00), want: "Undefined"},
+		{name: "language_skipped", got: db.VendorName(0x0409), want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+
+	if err := db.Load(strings.NewReader("046d  Logitech, Inc.\n\tzzzz  Bad product\n")); err == nil {
+		t.Error("Load() of a malformed product line succeeded")
+	}
+	if got := db.VendorName(0x1d6b); got != "Linux Foundation" {
+		t.Errorf("failed Load() changed the database: VendorName(0x1d6b) = %q", got)
+	}
+}
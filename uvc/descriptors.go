@@ -0,0 +1,551 @@
+package uvc
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+// Video interface class, subclass and class-specific descriptor types
+const (
+	CC_VIDEO                      = 0x0e
+	SC_VIDEOCONTROL               = 0x01
+	SC_VIDEOSTREAMING             = 0x02
+	SC_VIDEO_INTERFACE_COLLECTION = 0x03
+
+	USB_DT_CS_INTERFACE = 0x24
+	USB_DT_CS_ENDPOINT  = 0x25
+)
+
+// Video control interface descriptor subtypes
+const (
+	VC_HEADER          = 0x01
+	VC_INPUT_TERMINAL  = 0x02
+	VC_OUTPUT_TERMINAL = 0x03
+	VC_SELECTOR_UNIT   = 0x04
+	VC_PROCESSING_UNIT = 0x05
+	VC_EXTENSION_UNIT  = 0x06
+)
+
+// Video streaming interface descriptor subtypes
+const (
+	VS_INPUT_HEADER        = 0x01
+	VS_OUTPUT_HEADER       = 0x02
+	VS_STILL_IMAGE_FRAME   = 0x03
+	VS_FORMAT_UNCOMPRESSED = 0x04
+	VS_FRAME_UNCOMPRESSED  = 0x05
+	VS_FORMAT_MJPEG        = 0x06
+	VS_FRAME_MJPEG         = 0x07
+	VS_FORMAT_MPEG2TS      = 0x0a
+	VS_FORMAT_DV           = 0x0c
+	VS_COLORFORMAT         = 0x0d
+	VS_FORMAT_FRAME_BASED  = 0x10
+	VS_FRAME_FRAME_BASED   = 0x11
+	VS_FORMAT_STREAM_BASED = 0x12
+)
+
+// Terminal types
+const (
+	TT_VENDOR_SPECIFIC  = 0x0100
+	TT_STREAMING        = 0x0101
+	ITT_VENDOR_SPECIFIC = 0x0200
+	ITT_CAMERA          = 0x0201
+)
+
+// Descriptors is the parsed class-specific descriptor tree of a video
+// function: its control interface with the terminals and units it is built
+// from, and its streaming interfaces with the formats and frames each offers
+type Descriptors struct {
+	Control   *ControlInterface
+	Streaming []StreamingInterface
+}
+
+// ControlInterface is a video control interface and its VC_HEADER
+type ControlInterface struct {
+	Interface      uint8
+	UVC            uint16 // bcdUVC, such as 0x0110 for UVC 1.1
+	ClockFrequency uint32 // Deprecated by UVC 1.5, but still sent
+
+	// StreamingInterfaces lists the streaming interfaces of the collection
+	// (baInterfaceNr)
+	StreamingInterfaces []uint8
+
+	InputTerminals  []InputTerminal
+	OutputTerminals []OutputTerminal
+	ProcessingUnits []ProcessingUnit
+}
+
+// InputTerminal is a VC_INPUT_TERMINAL, the source of a video stream
+type InputTerminal struct {
+	ID            uint8
+	Type          uint16 // wTerminalType, such as ITT_CAMERA
+	AssocTerminal uint8
+	Terminal      uint8 // iTerminal string index
+
+	// Camera holds the camera-specific fields of an ITT_CAMERA terminal
+	Camera *CameraTerminal
+}
+
+// CameraTerminal is the camera-specific part of an ITT_CAMERA input terminal
+type CameraTerminal struct {
+	ObjectiveFocalLengthMin uint16
+	ObjectiveFocalLengthMax uint16
+	OcularFocalLength       uint16
+	Controls                []byte // bmControls, one bit per CT_* control
+}
+
+// OutputTerminal is a VC_OUTPUT_TERMINAL, such as the USB streaming
+// terminal that feeds a streaming interface
+type OutputTerminal struct {
+	ID            uint8
+	Type          uint16
+	AssocTerminal uint8
+	SourceID      uint8
+	Terminal      uint8
+}
+
+// ProcessingUnit is a VC_PROCESSING_UNIT, which owns the image controls
+// such as brightness and white balance
+type ProcessingUnit struct {
+	ID             uint8
+	SourceID       uint8
+	MaxMultiplier  uint16
+	Controls       []byte // bmControls, one bit per PU_* control
+	Processing     uint8  // iProcessing string index
+	VideoStandards uint8  // bmVideoStandards, UVC 1.1 and later
+}
+
+// StreamingInterface is a video streaming interface, its VS_INPUT_HEADER and
+// the formats that follow it
+type StreamingInterface struct {
+	Interface          uint8
+	EndpointAddress    uint8
+	Info               uint8 // bmInfo
+	TerminalLink       uint8
+	StillCaptureMethod uint8
+	TriggerSupport     uint8
+	TriggerUsage       uint8
+
+	Formats []FormatDescriptor
+}
+
+// FormatDescriptor is a VS_FORMAT_* descriptor and the VS_FRAME_*
+// descriptors that follow it. GUID and BitsPerPixel are only set for
+// uncompressed and frame-based formats; formats of other subtypes only
+// have Subtype and Index.
+type FormatDescriptor struct {
+	Subtype           uint8 // VS_FORMAT_UNCOMPRESSED, VS_FORMAT_MJPEG, ...
+	Index             uint8 // bFormatIndex, as used in ProbeControl
+	GUID              [16]byte
+	BitsPerPixel      uint8
+	DefaultFrameIndex uint8
+	AspectRatioX      uint8
+	AspectRatioY      uint8
+	InterlaceFlags    uint8
+	CopyProtect       uint8
+	Flags             uint8 // bmFlags of MJPEG, bVariableSize of frame-based
+
+	Frames []FrameDescriptor
+
+	// Still is the VS_STILL_IMAGE_FRAME of the format, listing the sizes
+	// still images can be captured at with methods 2 and 3, or nil
+	Still *StillImageFrame
+}
+
+// StillImageFrame is a VS_STILL_IMAGE_FRAME descriptor. Its sizes and
+// compressions are selected by their 1-based position in StillProbeControl.
+type StillImageFrame struct {
+	EndpointAddress uint8 // Bulk still image endpoint of method 3, else 0
+	Sizes           []StillImageSize
+	Compression     []uint8 // bCompression of each compression pattern
+}
+
+// StillImageSize is one image size pattern of a StillImageFrame
+type StillImageSize struct {
+	Width  uint16
+	Height uint16
+}
+
+// FourCC returns the four character code at the start of the GUID of an
+// uncompressed or frame-based format, such as "YUY2" or "H264"
+func (f *FormatDescriptor) FourCC() string {
+	return string(f.GUID[:4])
+}
+
+// Frame returns the frame descriptor with the given bFrameIndex
+func (f *FormatDescriptor) Frame(index uint8) *FrameDescriptor {
+	for i := range f.Frames {
+		if f.Frames[i].Index == index {
+			return &f.Frames[i]
+		}
+	}
+	return nil
+}
+
+// FrameDescriptor is a VS_FRAME_* descriptor: one resolution of a format
+// and the frame intervals it can be streamed at. Intervals are in 100ns
+// units. A frame with discrete intervals lists them in Intervals; one with a
+// continuous range (bFrameIntervalType 0) has MinInterval, MaxInterval and
+// IntervalStep instead.
+type FrameDescriptor struct {
+	Subtype                 uint8
+	Index                   uint8 // bFrameIndex, as used in ProbeControl
+	Capabilities            uint8
+	Width                   uint16
+	Height                  uint16
+	MinBitRate              uint32
+	MaxBitRate              uint32
+	MaxVideoFrameBufferSize uint32 // Not sent for frame-based formats
+	BytesPerLine            uint32 // Only sent for frame-based formats
+	DefaultInterval         uint32
+
+	Intervals    []uint32
+	MinInterval  uint32
+	MaxInterval  uint32
+	IntervalStep uint32
+}
+
+// Continuous reports whether the frame has a continuous range of intervals
+// rather than a list
+func (f *FrameDescriptor) Continuous() bool {
+	return f.Intervals == nil
+}
+
+// Format returns the format descriptor with the given bFormatIndex
+func (s *StreamingInterface) Format(index uint8) *FormatDescriptor {
+	for i := range s.Formats {
+		if s.Formats[i].Index == index {
+			return &s.Formats[i]
+		}
+	}
+	return nil
+}
+
+// StreamingInterface returns the streaming interface with the given number
+func (d *Descriptors) StreamingInterface(iface uint8) *StreamingInterface {
+	for i := range d.Streaming {
+		if d.Streaming[i].Interface == iface {
+			return &d.Streaming[i]
+		}
+	}
+	return nil
+}
+
+// ParseDescriptors parses the class-specific descriptors of the first video
+// control interface of config and of every video streaming interface, which
+// Unmarshal leaves in the Extra bytes of their first alternate setting. A
+// camera whose collection has several streaming interfaces, such as one for
+// video and one for still images or depth, gets an entry for each.
+func ParseDescriptors(config *usb.ConfigDescriptor) (*Descriptors, error) {
+	d := &Descriptors{}
+	for i := range config.Interfaces {
+		iface := &config.Interfaces[i]
+		if len(iface.AltSettings) == 0 {
+			continue
+		}
+		alt := &iface.AltSettings[0]
+		if alt.InterfaceClass != CC_VIDEO {
+			continue
+		}
+
+		switch alt.InterfaceSubClass {
+		case SC_VIDEOCONTROL:
+			if d.Control != nil {
+				continue
+			}
+			vc, err := parseControlInterface(alt.InterfaceNumber, alt.Extra)
+			if err != nil {
+				return nil, fmt.Errorf("video control interface %d: %w", alt.InterfaceNumber, err)
+			}
+			d.Control = vc
+		case SC_VIDEOSTREAMING:
+			vs, err := parseStreamingInterface(alt.InterfaceNumber, alt.Extra)
+			if err != nil {
+				return nil, fmt.Errorf("video streaming interface %d: %w", alt.InterfaceNumber, err)
+			}
+			d.Streaming = append(d.Streaming, *vs)
+		}
+	}
+
+	if d.Control == nil {
+		return nil, fmt.Errorf("no video control interface")
+	}
+	return d, nil
+}
+
+// classDescriptors calls fn with each class-specific interface descriptor
+// in extra. A zero length ends the descriptors, as some devices pad them
+// with zeros.
+func classDescriptors(extra []byte, fn func(data []byte) error) error {
+	pos := 0
+	for pos < len(extra) {
+		length := int(extra[pos])
+		if length == 0 {
+			return nil
+		}
+		if length < 2 || pos+length > len(extra) {
+			return fmt.Errorf("invalid descriptor length %d at offset %d", length, pos)
+		}
+
+		data := extra[pos : pos+length]
+		pos += length
+
+		if data[1] != USB_DT_CS_INTERFACE {
+			continue
+		}
+		if length < 3 {
+			return fmt.Errorf("class-specific descriptor too short: %d bytes", length)
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseControlInterface(iface uint8, extra []byte) (*ControlInterface, error) {
+	vc := &ControlInterface{Interface: iface}
+	err := classDescriptors(extra, func(data []byte) error {
+		length := len(data)
+		switch data[2] {
+		case VC_HEADER:
+			if length < 12 || length < 12+int(data[11]) {
+				return fmt.Errorf("invalid VC header length: %d", length)
+			}
+			vc.UVC = binary.LittleEndian.Uint16(data[3:5])
+			vc.ClockFrequency = binary.LittleEndian.Uint32(data[7:11])
+			vc.StreamingInterfaces = append([]uint8(nil), data[12:12+int(data[11])]...)
+
+		case VC_INPUT_TERMINAL:
+			if length < 8 {
+				return fmt.Errorf("invalid input terminal length: %d", length)
+			}
+			it := InputTerminal{
+				ID:            data[3],
+				Type:          binary.LittleEndian.Uint16(data[4:6]),
+				AssocTerminal: data[6],
+				Terminal:      data[7],
+			}
+			if it.Type == ITT_CAMERA {
+				if length < 15 || length < 15+int(data[14]) {
+					return fmt.Errorf("invalid camera terminal length: %d", length)
+				}
+				it.Camera = &CameraTerminal{
+					ObjectiveFocalLengthMin: binary.LittleEndian.Uint16(data[8:10]),
+					ObjectiveFocalLengthMax: binary.LittleEndian.Uint16(data[10:12]),
+					OcularFocalLength:       binary.LittleEndian.Uint16(data[12:14]),
+					Controls:                append([]byte(nil), data[15:15+int(data[14])]...),
+				}
+			}
+			vc.InputTerminals = append(vc.InputTerminals, it)
+
+		case VC_OUTPUT_TERMINAL:
+			if length < 9 {
+				return fmt.Errorf("invalid output terminal length: %d", length)
+			}
+			vc.OutputTerminals = append(vc.OutputTerminals, OutputTerminal{
+				ID:            data[3],
+				Type:          binary.LittleEndian.Uint16(data[4:6]),
+				AssocTerminal: data[6],
+				SourceID:      data[7],
+				Terminal:      data[8],
+			})
+
+		case VC_PROCESSING_UNIT:
+			if length < 8 {
+				return fmt.Errorf("invalid processing unit length: %d", length)
+			}
+			n := int(data[7])
+			if length < 9+n {
+				return fmt.Errorf("invalid processing unit length %d for %d control bytes", length, n)
+			}
+			pu := ProcessingUnit{
+				ID:            data[3],
+				SourceID:      data[4],
+				MaxMultiplier: binary.LittleEndian.Uint16(data[5:7]),
+				Controls:      append([]byte(nil), data[8:8+n]...),
+				Processing:    data[8+n],
+			}
+			if length > 9+n {
+				pu.VideoStandards = data[9+n]
+			}
+			vc.ProcessingUnits = append(vc.ProcessingUnits, pu)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vc, nil
+}
+
+func parseStreamingInterface(iface uint8, extra []byte) (*StreamingInterface, error) {
+	vs := &StreamingInterface{Interface: iface}
+	err := classDescriptors(extra, func(data []byte) error {
+		length := len(data)
+		switch subtype := data[2]; subtype {
+		case VS_INPUT_HEADER:
+			if length < 13 {
+				return fmt.Errorf("invalid VS input header length: %d", length)
+			}
+			vs.EndpointAddress = data[6]
+			vs.Info = data[7]
+			vs.TerminalLink = data[8]
+			vs.StillCaptureMethod = data[9]
+			vs.TriggerSupport = data[10]
+			vs.TriggerUsage = data[11]
+
+		case VS_FORMAT_UNCOMPRESSED, VS_FORMAT_FRAME_BASED:
+			want := 27
+			if subtype == VS_FORMAT_FRAME_BASED {
+				want = 28
+			}
+			if length < want {
+				return fmt.Errorf("invalid format descriptor length: %d", length)
+			}
+			f := FormatDescriptor{
+				Subtype:           subtype,
+				Index:             data[3],
+				BitsPerPixel:      data[21],
+				DefaultFrameIndex: data[22],
+				AspectRatioX:      data[23],
+				AspectRatioY:      data[24],
+				InterlaceFlags:    data[25],
+				CopyProtect:       data[26],
+			}
+			copy(f.GUID[:], data[5:21])
+			if subtype == VS_FORMAT_FRAME_BASED {
+				f.Flags = data[27]
+			}
+			vs.Formats = append(vs.Formats, f)
+
+		case VS_FORMAT_MJPEG:
+			if length < 11 {
+				return fmt.Errorf("invalid MJPEG format length: %d", length)
+			}
+			vs.Formats = append(vs.Formats, FormatDescriptor{
+				Subtype:           subtype,
+				Index:             data[3],
+				Flags:             data[5],
+				DefaultFrameIndex: data[6],
+				AspectRatioX:      data[7],
+				AspectRatioY:      data[8],
+				InterlaceFlags:    data[9],
+				CopyProtect:       data[10],
+			})
+
+		case VS_FORMAT_MPEG2TS, VS_FORMAT_DV, VS_FORMAT_STREAM_BASED:
+			if length < 4 {
+				return fmt.Errorf("invalid format descriptor length: %d", length)
+			}
+			vs.Formats = append(vs.Formats, FormatDescriptor{Subtype: subtype, Index: data[3]})
+
+		case VS_FRAME_UNCOMPRESSED, VS_FRAME_MJPEG, VS_FRAME_FRAME_BASED:
+			if len(vs.Formats) == 0 {
+				return fmt.Errorf("frame descriptor before any format descriptor")
+			}
+			frame, err := parseFrameDescriptor(data)
+			if err != nil {
+				return err
+			}
+			f := &vs.Formats[len(vs.Formats)-1]
+			f.Frames = append(f.Frames, *frame)
+
+		case VS_STILL_IMAGE_FRAME:
+			if len(vs.Formats) == 0 {
+				return fmt.Errorf("still image frame descriptor before any format descriptor")
+			}
+			still, err := parseStillImageFrame(data)
+			if err != nil {
+				return err
+			}
+			vs.Formats[len(vs.Formats)-1].Still = still
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
+
+// parseStillImageFrame parses a VS_STILL_IMAGE_FRAME descriptor: the still
+// endpoint, bNumImageSizePatterns width and height pairs, then
+// bNumCompressionPattern compression bytes
+func parseStillImageFrame(data []byte) (*StillImageFrame, error) {
+	if len(data) < 5 {
+		return nil, fmt.Errorf("invalid still image frame length: %d", len(data))
+	}
+	n := int(data[4])
+	sizesEnd := 5 + 4*n
+	if len(data) < sizesEnd+1 {
+		return nil, fmt.Errorf("still image frame of %d bytes is too short for %d sizes", len(data), n)
+	}
+	m := int(data[sizesEnd])
+	if len(data) < sizesEnd+1+m {
+		return nil, fmt.Errorf("still image frame of %d bytes is too short for %d compressions", len(data), m)
+	}
+
+	still := &StillImageFrame{EndpointAddress: data[3]}
+	for i := 0; i < n; i++ {
+		pos := 5 + 4*i
+		still.Sizes = append(still.Sizes, StillImageSize{
+			Width:  binary.LittleEndian.Uint16(data[pos : pos+2]),
+			Height: binary.LittleEndian.Uint16(data[pos+2 : pos+4]),
+		})
+	}
+	if m > 0 {
+		still.Compression = append([]byte(nil), data[sizesEnd+1:sizesEnd+1+m]...)
+	}
+	return still, nil
+}
+
+// parseFrameDescriptor parses a VS_FRAME_UNCOMPRESSED, VS_FRAME_MJPEG or
+// VS_FRAME_FRAME_BASED descriptor. The frame-based layout replaces
+// dwMaxVideoFrameBufferSize with dwBytesPerLine after bFrameIntervalType.
+func parseFrameDescriptor(data []byte) (*FrameDescriptor, error) {
+	if len(data) < 26 {
+		return nil, fmt.Errorf("invalid frame descriptor length: %d", len(data))
+	}
+
+	f := &FrameDescriptor{
+		Subtype:      data[2],
+		Index:        data[3],
+		Capabilities: data[4],
+		Width:        binary.LittleEndian.Uint16(data[5:7]),
+		Height:       binary.LittleEndian.Uint16(data[7:9]),
+		MinBitRate:   binary.LittleEndian.Uint32(data[9:13]),
+		MaxBitRate:   binary.LittleEndian.Uint32(data[13:17]),
+	}
+	var intervalType uint8
+	if f.Subtype == VS_FRAME_FRAME_BASED {
+		f.DefaultInterval = binary.LittleEndian.Uint32(data[17:21])
+		intervalType = data[21]
+		f.BytesPerLine = binary.LittleEndian.Uint32(data[22:26])
+	} else {
+		f.MaxVideoFrameBufferSize = binary.LittleEndian.Uint32(data[17:21])
+		f.DefaultInterval = binary.LittleEndian.Uint32(data[21:25])
+		intervalType = data[25]
+	}
+
+	intervals := data[26:]
+	if intervalType == 0 {
+		if len(intervals) < 12 {
+			return nil, fmt.Errorf("frame %d: continuous intervals need 12 bytes, have %d", f.Index, len(intervals))
+		}
+		f.MinInterval = binary.LittleEndian.Uint32(intervals[0:4])
+		f.MaxInterval = binary.LittleEndian.Uint32(intervals[4:8])
+		f.IntervalStep = binary.LittleEndian.Uint32(intervals[8:12])
+		return f, nil
+	}
+
+	if len(intervals) < 4*int(intervalType) {
+		return nil, fmt.Errorf("frame %d: %d intervals need %d bytes, have %d", f.Index, intervalType, 4*int(intervalType), len(intervals))
+	}
+	f.Intervals = make([]uint32, intervalType)
+	for i := range f.Intervals {
+		f.Intervals[i] = binary.LittleEndian.Uint32(intervals[4*i:])
+	}
+	return f, nil
+}
@@ -0,0 +1,157 @@
+package uvc
+
+import (
+	"encoding/hex"
+	"testing"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+func videoConfig(t *testing.T, extras map[uint8]string) *usb.ConfigDescriptor {
+	t.Helper()
+	config := &usb.ConfigDescriptor{}
+	for n := uint8(0); n < uint8(len(extras)); n++ {
+		extra, err := hex.DecodeString(extras[n])
+		if err != nil {
+			t.Fatalf("invalid test data for interface %d: %v", n, err)
+		}
+		subclass := uint8(SC_VIDEOSTREAMING)
+		if n == 0 {
+			subclass = SC_VIDEOCONTROL
+		}
+		config.Interfaces = append(config.Interfaces, usb.Interface{
+			AltSettings: []usb.InterfaceAltSetting{{
+				InterfaceNumber:   n,
+				InterfaceClass:    CC_VIDEO,
+				InterfaceSubClass: subclass,
+				Extra:             extra,
+			}},
+		})
+	}
+	return config
+}
+
+const (
+	testVideoControl = "0e240110013400" + "80c3c901" + "020102" + // VC header: UVC 1.1, interfaces 1 and 2
+		"122402010102000000000000000003" + "0a0000" + // Camera terminal 1
+		"0c240502010040027f170000" + // Processing unit 2, source 1
+		"092403030101000200" + // Streaming output terminal 3, source 2
+		"0525034000" // Class-specific interrupt endpoint, skipped
+
+	testStreamingYUY2MJPEG = "0f240102000081000302010001" + "0000" + // Input header, endpoint 0x81
+		"1b24040101" + "5955593200001000800000aa00389b71" + "100100000000" + // YUY2 format 1
+		"22240501008002e001" + "00000000" + "00000000" + "00600900" + "15160500" + "02" + "15160500" + "2a2c0a00" + // 640x480, 30 and 15 fps
+		"0b240602010101000000" + "00" + // MJPEG format 2
+		"26240701000005d002" + "00000000" + "00000000" + "00200e00" + "15160500" + "00" + "15160500" + "80841e00" + "15160500" + // 1280x720, continuous
+		"0000ffff" // Zero-length terminator and padding
+
+	testStreamingH264 = "0d2401010000820003000000" + "00" + // Input header, endpoint 0x82
+		"1c24100101" + "4832363400001000800000aa00389b71" + "10010000000001" + // H264 format 1
+		"1e24110100800738040000000000000000" + "15160500" + "01" + "00000000" + "15160500" // 1920x1080
+)
+
+func TestParseDescriptors(t *testing.T) {
+	d, err := ParseDescriptors(videoConfig(t, map[uint8]string{
+		0: testVideoControl,
+		1: testStreamingYUY2MJPEG,
+		2: testStreamingH264,
+	}))
+	if err != nil {
+		t.Fatalf("ParseDescriptors() error = %v", err)
+	}
+
+	t.Run("control", func(t *testing.T) {
+		vc := d.Control
+		if vc.UVC != 0x0110 || vc.ClockFrequency != 30000000 {
+			t.Errorf("header = UVC %04x, clock %d", vc.UVC, vc.ClockFrequency)
+		}
+		if len(vc.StreamingInterfaces) != 2 || vc.StreamingInterfaces[1] != 2 {
+			t.Errorf("StreamingInterfaces = %v, want [1 2]", vc.StreamingInterfaces)
+		}
+		if len(vc.InputTerminals) != 1 || vc.InputTerminals[0].Camera == nil {
+			t.Fatalf("InputTerminals = %+v, want one camera terminal", vc.InputTerminals)
+		}
+		if cam := vc.InputTerminals[0].Camera; len(cam.Controls) != 3 || cam.Controls[0] != 0x0a {
+			t.Errorf("camera controls = %x, want 0a0000", cam.Controls)
+		}
+		if len(vc.ProcessingUnits) != 1 {
+			t.Fatalf("ProcessingUnits = %+v, want one", vc.ProcessingUnits)
+		}
+		if pu := vc.ProcessingUnits[0]; pu.ID != 2 || pu.SourceID != 1 || pu.MaxMultiplier != 0x4000 || len(pu.Controls) != 2 {
+			t.Errorf("processing unit = %+v", pu)
+		}
+		if len(vc.OutputTerminals) != 1 || vc.OutputTerminals[0].SourceID != 2 || vc.OutputTerminals[0].Type != TT_STREAMING {
+			t.Errorf("OutputTerminals = %+v", vc.OutputTerminals)
+		}
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		if len(d.Streaming) != 2 {
+			t.Fatalf("got %d streaming interfaces, want 2", len(d.Streaming))
+		}
+		vs := d.StreamingInterface(1)
+		if vs == nil || vs.EndpointAddress != 0x81 || vs.TerminalLink != 3 || len(vs.Formats) != 2 {
+			t.Fatalf("streaming interface 1 = %+v", vs)
+		}
+
+		yuy2 := vs.Format(1)
+		if yuy2.Subtype != VS_FORMAT_UNCOMPRESSED || yuy2.FourCC() != "YUY2" || yuy2.BitsPerPixel != 16 {
+			t.Errorf("format 1 = %+v", yuy2)
+		}
+		frame := yuy2.Frame(1)
+		if frame == nil || frame.Width != 640 || frame.Height != 480 || frame.MaxVideoFrameBufferSize != 614400 {
+			t.Fatalf("YUY2 frame 1 = %+v", frame)
+		}
+		if frame.Continuous() || len(frame.Intervals) != 2 || frame.Intervals[1] != 666666 {
+			t.Errorf("YUY2 intervals = %v, want [333333 666666]", frame.Intervals)
+		}
+
+		mjpeg := vs.Format(2)
+		if mjpeg.Subtype != VS_FORMAT_MJPEG || len(mjpeg.Frames) != 1 {
+			t.Fatalf("format 2 = %+v", mjpeg)
+		}
+		if f := mjpeg.Frames[0]; !f.Continuous() || f.MinInterval != 333333 || f.MaxInterval != 2000000 || f.IntervalStep != 333333 {
+			t.Errorf("MJPEG frame = %+v, want continuous 333333-2000000", f)
+		}
+
+		h264 := d.StreamingInterface(2).Format(1)
+		if h264.Subtype != VS_FORMAT_FRAME_BASED || h264.FourCC() != "H264" || h264.Flags != 1 {
+			t.Fatalf("frame-based format = %+v", h264)
+		}
+		if f := h264.Frame(1); f == nil || f.Width != 1920 || f.Height != 1080 || f.DefaultInterval != 333333 || len(f.Intervals) != 1 {
+			t.Errorf("frame-based frame = %+v", f)
+		}
+	})
+}
+
+func TestParseDescriptorsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		extras map[uint8]string
+	}{
+		{
+			name:   "frame_before_format",
+			extras: map[uint8]string{0: testVideoControl, 1: "22240501008002e001" + "00000000" + "00000000" + "00600900" + "15160500" + "01" + "15160500"},
+		},
+		{
+			name:   "truncated_intervals",
+			extras: map[uint8]string{0: testVideoControl, 1: "0b240601010101000000" + "00" + "1e240701008002e001" + "00000000" + "00000000" + "00600900" + "15160500" + "02" + "15160500"},
+		},
+		{
+			name:   "truncated_descriptor",
+			extras: map[uint8]string{0: "0e24011001"},
+		},
+		{
+			name:   "no_control_interface",
+			extras: map[uint8]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseDescriptors(videoConfig(t, tt.extras)); err == nil {
+				t.Error("ParseDescriptors() succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package uvc
+
+import "fmt"
+
+// PayloadFormat is the kind of data a reassembled frame carries
+type PayloadFormat int
+
+const (
+	PayloadFormatUnknown PayloadFormat = iota
+	PayloadFormatMJPEG
+	PayloadFormatUncompressed
+)
+
+func (f PayloadFormat) String() string {
+	switch f {
+	case PayloadFormatUnknown:
+		return "unknown"
+	case PayloadFormatMJPEG:
+		return "MJPEG"
+	case PayloadFormatUncompressed:
+		return "uncompressed"
+	default:
+		return fmt.Sprintf("PayloadFormat(%d)", int(f))
+	}
+}
+
+// uncompressedResolutions are the frame sizes webcams commonly offer for
+// their uncompressed (YUY2) formats
+var uncompressedResolutions = [][2]int{
+	{160, 120}, {176, 144}, {320, 180}, {320, 240}, {352, 288},
+	{424, 240}, {640, 360}, {640, 480}, {800, 448}, {800, 600},
+	{848, 480}, {960, 540}, {1024, 576}, {1024, 768}, {1280, 720},
+	{1280, 800}, {1280, 960}, {1280, 1024}, {1600, 896}, {1600, 1200},
+	{1920, 1080}, {2560, 1440}, {3840, 2160},
+}
+
+// DetectPayloadFormat guesses the format of a frame from its data, the
+// Frame.Data of a FrameAssembler with the payload headers already removed,
+// so that frames can be routed to a decoder without knowing which format
+// was committed. A frame starting with a JPEG SOI marker followed by another
+// marker is MJPEG, even if it was cut short. A frame exactly the size of a
+// common resolution at two bytes per pixel is taken to be YUY2 or another
+// packed 4:2:2 format; a truncated uncompressed frame cannot be told apart
+// from noise and is reported as unknown.
+func DetectPayloadFormat(frame []byte) PayloadFormat {
+	if len(frame) >= 2 && frame[0] == 0xff && frame[1] == 0xd8 {
+		if len(frame) == 2 || frame[2] == 0xff {
+			return PayloadFormatMJPEG
+		}
+	}
+
+	for _, r := range uncompressedResolutions {
+		if len(frame) == r[0]*r[1]*2 {
+			return PayloadFormatUncompressed
+		}
+	}
+	return PayloadFormatUnknown
+}
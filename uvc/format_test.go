@@ -0,0 +1,33 @@
+package uvc
+
+import "testing"
+
+func TestDetectPayloadFormat(t *testing.T) {
+	jpeg := append([]byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10}, make([]byte, 100)...)
+	yuy2 := make([]byte, 640*480*2)
+	// A YUY2 frame that happens to start like a JPEG marker
+	yuy2SOI := make([]byte, 320*240*2)
+	yuy2SOI[0], yuy2SOI[1], yuy2SOI[2] = 0xff, 0xd8, 0x80
+
+	tests := []struct {
+		name  string
+		frame []byte
+		want  PayloadFormat
+	}{
+		{name: "empty", want: PayloadFormatUnknown},
+		{name: "mjpeg", frame: jpeg, want: PayloadFormatMJPEG},
+		{name: "mjpeg_partial", frame: jpeg[:2], want: PayloadFormatMJPEG},
+		{name: "yuy2", frame: yuy2, want: PayloadFormatUncompressed},
+		{name: "yuy2_soi_lookalike", frame: yuy2SOI, want: PayloadFormatUncompressed},
+		{name: "yuy2_truncated", frame: yuy2[:len(yuy2)-3072], want: PayloadFormatUnknown},
+		{name: "single_byte", frame: []byte{0xff}, want: PayloadFormatUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectPayloadFormat(tt.frame); got != tt.want {
+				t.Errorf("DetectPayloadFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+// Package uvc implements parts of the USB Video Class protocol, such as
+// payload header parsing and frame reassembly, on top of the transfers of
+// the usb package.
+package uvc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Payload header bmHeaderInfo bits
+const (
+	PayloadFID = 0x01 // Frame ID, toggles at the start of every frame
+	PayloadEOF = 0x02 // End of frame
+	PayloadPTS = 0x04 // Presentation time stamp present
+	PayloadSCR = 0x08 // Source clock reference present
+	PayloadRES = 0x10 // Reserved, or still image for some formats
+	PayloadSTI = 0x20 // Still image
+	PayloadERR = 0x40 // Error bit
+	PayloadEOH = 0x80 // End of header
+)
+
+// SCR is the source clock reference of a payload: the device's System Time
+// Clock sampled when the payload was assembled, and the 11-bit USB frame
+// counter at that moment
+type SCR struct {
+	STC      uint32
+	SOFCount uint16
+}
+
+// PayloadHeader is the header at the start of every UVC payload
+type PayloadHeader struct {
+	Length uint8
+	Info   uint8 // bmHeaderInfo
+	PTS    uint32
+	SCR    SCR
+}
+
+// FrameID returns the frame ID bit of the payload
+func (h *PayloadHeader) FrameID() uint8 {
+	return h.Info & PayloadFID
+}
+
+// EndOfFrame reports whether the payload is the last one of its frame
+func (h *PayloadHeader) EndOfFrame() bool {
+	return h.Info&PayloadEOF != 0
+}
+
+// HasPTS reports whether the header carries a presentation time stamp
+func (h *PayloadHeader) HasPTS() bool {
+	return h.Info&PayloadPTS != 0
+}
+
+// HasSCR reports whether the header carries a source clock reference
+func (h *PayloadHeader) HasSCR() bool {
+	return h.Info&PayloadSCR != 0
+}
+
+// StillImage reports whether the payload belongs to a still image rather
+// than to the video stream
+func (h *PayloadHeader) StillImage() bool {
+	return h.Info&PayloadSTI != 0
+}
+
+// HasError reports whether the device flagged an error in the payload
+func (h *PayloadHeader) HasError() bool {
+	return h.Info&PayloadERR != 0
+}
+
+// ParsePayloadHeader parses the header at the start of a UVC payload. The
+// payload data follows at offset Length.
+func ParsePayloadHeader(data []byte) (*PayloadHeader, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("payload too short for a header: %d bytes", len(data))
+	}
+
+	h := &PayloadHeader{Length: data[0], Info: data[1]}
+	if int(h.Length) < 2 || int(h.Length) > len(data) {
+		return nil, fmt.Errorf("invalid payload header length %d for a %d byte payload", h.Length, len(data))
+	}
+
+	want := 2
+	if h.HasPTS() {
+		want += 4
+	}
+	if h.HasSCR() {
+		want += 6
+	}
+	if int(h.Length) < want {
+		return nil, fmt.Errorf("payload header length %d too short for flags 0x%02x", h.Length, h.Info)
+	}
+
+	pos := 2
+	if h.HasPTS() {
+		h.PTS = binary.LittleEndian.Uint32(data[pos : pos+4])
+		pos += 4
+	}
+	if h.HasSCR() {
+		h.SCR.STC = binary.LittleEndian.Uint32(data[pos : pos+4])
+		h.SCR.SOFCount = binary.LittleEndian.Uint16(data[pos+4:pos+6]) & 0x7ff
+	}
+
+	return h, nil
+}
+
+// Frame is a video frame reassembled from its payloads
+type Frame struct {
+	Data []byte
+
+	// Device clock information from the payload headers. PTS is taken from
+	// the first payload that carries one and SCR from the last.
+	PTS    uint32
+	HasPTS bool
+	SCR    SCR
+	HasSCR bool
+
+	// Host arrival times of the transfers carrying the first and last
+	// payloads of the frame, for correlating device and host clocks
+	Start time.Time
+	End   time.Time
+
+	// Error is set if any payload of the frame had its error bit set
+	Error bool
+
+	// Still is set if the frame is a still image, sent with still capture
+	// method 1 or 2 in between the video frames
+	Still bool
+}
+
+// FrameAssembler reassembles frames from UVC payloads, such as the packets of
+// completed isochronous transfers or the data of bulk transfers. It is not
+// safe for concurrent use.
+type FrameAssembler struct {
+	onFrame func(*Frame)
+	frame   *Frame
+	fid     uint8
+}
+
+// NewFrameAssembler returns an assembler that calls onFrame with every
+// frame it completes. The frame belongs to onFrame once passed.
+func NewFrameAssembler(onFrame func(*Frame)) *FrameAssembler {
+	return &FrameAssembler{onFrame: onFrame}
+}
+
+// AddPayload adds one payload that was received at arrival, typically the
+// CompletedAt time of the isochronous transfer it came in. Empty payloads,
+// which devices send between frames, are ignored.
+func (a *FrameAssembler) AddPayload(payload []byte, arrival time.Time) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	h, err := ParsePayloadHeader(payload)
+	if err != nil {
+		return err
+	}
+
+	// A toggled frame ID starts a new frame even if EOF was never seen
+	if a.frame != nil && h.FrameID() != a.fid {
+		a.Flush()
+	}
+	if a.frame == nil {
+		a.frame = &Frame{Start: arrival}
+		a.fid = h.FrameID()
+	}
+
+	f := a.frame
+	f.Data = append(f.Data, payload[h.Length:]...)
+	f.End = arrival
+	if h.HasPTS() && !f.HasPTS {
+		f.PTS, f.HasPTS = h.PTS, true
+	}
+	if h.HasSCR() {
+		f.SCR, f.HasSCR = h.SCR, true
+	}
+	if h.HasError() {
+		f.Error = true
+	}
+	if h.StillImage() {
+		f.Still = true
+	}
+
+	if h.EndOfFrame() {
+		a.Flush()
+	}
+	return nil
+}
+
+// Flush delivers the frame being assembled, if any, even though its last
+// payload has not been seen
+func (a *FrameAssembler) Flush() {
+	f := a.frame
+	a.frame = nil
+	if f != nil && a.onFrame != nil {
+		a.onFrame(f)
+	}
+}
@@ -0,0 +1,122 @@
+package uvc
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestParsePayloadHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string // hex encoded
+		wantErr  bool
+		validate func(t *testing.T, h *PayloadHeader)
+	}{
+		{
+			name: "pts_and_scr",
+			data: "0c8d" + // 12 byte header: FID, PTS, SCR, EOH
+				"78563412" + // PTS
+				"efcdab89" + // SCR STC
+				"ff0f" + // SCR SOF counter, upper bits reserved
+				"aabb",
+			validate: func(t *testing.T, h *PayloadHeader) {
+				if h.FrameID() != 1 || h.EndOfFrame() {
+					t.Errorf("Info = 0x%02x, want FID set and EOF clear", h.Info)
+				}
+				if !h.HasPTS() || h.PTS != 0x12345678 {
+					t.Errorf("PTS = 0x%08x, %v", h.PTS, h.HasPTS())
+				}
+				if !h.HasSCR() || h.SCR.STC != 0x89abcdef || h.SCR.SOFCount != 0x7ff {
+					t.Errorf("SCR = %+v, %v", h.SCR, h.HasSCR())
+				}
+			},
+		},
+		{
+			name: "minimal",
+			data: "0282ff",
+			validate: func(t *testing.T, h *PayloadHeader) {
+				if h.HasPTS() || h.HasSCR() || h.FrameID() != 0 || !h.EndOfFrame() {
+					t.Errorf("header = %+v", h)
+				}
+			},
+		},
+		{
+			name:    "length_too_short_for_flags",
+			data:    "0284000000",
+			wantErr: true,
+		},
+		{
+			name:    "length_past_payload",
+			data:    "0c80",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatalf("invalid test data: %v", err)
+			}
+
+			h, err := ParsePayloadHeader(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePayloadHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.validate != nil {
+				tt.validate(t, h)
+			}
+		})
+	}
+}
+
+func TestFrameAssembler(t *testing.T) {
+	var frames []*Frame
+	a := NewFrameAssembler(func(f *Frame) { frames = append(frames, f) })
+
+	t0 := time.Now()
+	payloads := []struct {
+		data string
+		at   time.Duration
+	}{
+		{"068400100000" + "0102", 0}, // FID 0, PTS 0x1000
+		{"0280" + "0304", time.Millisecond},
+		{"0282" + "05", 2 * time.Millisecond},         // EOF
+		{"", 3 * time.Millisecond},                    // Empty packet between frames
+		{"068500200000" + "06", 4 * time.Millisecond}, // FID 1, PTS 0x2000
+		{"0280" + "07", 5 * time.Millisecond},         // FID 0 again, without EOF on the previous frame
+	}
+	for _, p := range payloads {
+		data, err := hex.DecodeString(p.data)
+		if err != nil {
+			t.Fatalf("invalid test data: %v", err)
+		}
+		if err := a.AddPayload(data, t0.Add(p.at)); err != nil {
+			t.Fatalf("AddPayload(%s) error = %v", p.data, err)
+		}
+	}
+	a.Flush()
+
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3", len(frames))
+	}
+
+	f := frames[0]
+	if hex.EncodeToString(f.Data) != "0102030405" {
+		t.Errorf("frame 0 data = %x", f.Data)
+	}
+	if !f.HasPTS || f.PTS != 0x1000 || f.HasSCR {
+		t.Errorf("frame 0 PTS = 0x%x, %v, SCR %v", f.PTS, f.HasPTS, f.HasSCR)
+	}
+	if !f.Start.Equal(t0) || f.End.Sub(f.Start) != 2*time.Millisecond {
+		t.Errorf("frame 0 spans %v to %v", f.Start, f.End)
+	}
+
+	if f := frames[1]; hex.EncodeToString(f.Data) != "06" || f.PTS != 0x2000 {
+		t.Errorf("frame 1 = %x, PTS 0x%x", f.Data, f.PTS)
+	}
+	if f := frames[2]; hex.EncodeToString(f.Data) != "07" || f.HasPTS {
+		t.Errorf("frame 2 = %x, HasPTS %v", f.Data, f.HasPTS)
+	}
+}
@@ -0,0 +1,167 @@
+package uvc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Video streaming interface control selectors
+const (
+	VS_PROBE_CONTROL  = 0x01
+	VS_COMMIT_CONTROL = 0x02
+)
+
+// ProbeControl bmHint bits, naming the fields the device should keep fixed
+// while negotiating the others
+const (
+	HintFrameInterval = 0x0001 // dwFrameInterval
+	HintKeyFrameRate  = 0x0002 // wKeyFrameRate
+	HintPFrameRate    = 0x0004 // wPFrameRate
+	HintCompQuality   = 0x0008 // wCompQuality
+	HintCompWindow    = 0x0010 // wCompWindowSize
+)
+
+// Lengths of the probe and commit control for each revision of the class
+const (
+	probeLengthUVC10 = 26
+	probeLengthUVC11 = 34
+	probeLengthUVC15 = 48
+)
+
+// ProbeControl is the video probe and commit control of a streaming
+// interface, through which the host and device negotiate the format, frame
+// and bandwidth of a stream. Fields added by UVC 1.1 and 1.5 are only sent
+// and received when the version passed to Marshal and Unmarshal has them.
+type ProbeControl struct {
+	Hint                   uint16 // bmHint
+	FormatIndex            uint8
+	FrameIndex             uint8
+	FrameInterval          uint32 // In 100ns units
+	KeyFrameRate           uint16
+	PFrameRate             uint16
+	CompQuality            uint16
+	CompWindowSize         uint16
+	Delay                  uint16 // Internal latency in milliseconds
+	MaxVideoFrameSize      uint32
+	MaxPayloadTransferSize uint32
+
+	// UVC 1.1
+	ClockFrequency   uint32 // Device clock in Hz, for PTS and SCR
+	FramingInfo      uint8  // bmFramingInfo
+	PreferredVersion uint8
+	MinVersion       uint8
+	MaxVersion       uint8
+
+	// UVC 1.5
+	Usage                uint8
+	BitDepthLuma         uint8
+	Settings             uint8 // bmSettings
+	MaxNumberOfRefFrames uint8 // bMaxNumberOfRefFramesPlus1
+	RateControlModes     uint16
+	LayoutPerStream      uint64
+}
+
+// ProbeControlLength returns the length of the probe and commit control for
+// a device of the given UVC version, the bcdUVC of its class-specific
+// video control interface descriptor (0x0100 for UVC 1.0)
+func ProbeControlLength(version uint16) int {
+	switch {
+	case version < 0x0110:
+		return probeLengthUVC10
+	case version < 0x0150:
+		return probeLengthUVC11
+	default:
+		return probeLengthUVC15
+	}
+}
+
+// Interval returns the frame interval as a duration
+func (p *ProbeControl) Interval() time.Duration {
+	return time.Duration(p.FrameInterval) * 100 * time.Nanosecond
+}
+
+// Marshal encodes the control in the layout of the given UVC version, ready
+// for a SET_CUR of VS_PROBE_CONTROL or VS_COMMIT_CONTROL
+func (p *ProbeControl) Marshal(version uint16) []byte {
+	data := make([]byte, ProbeControlLength(version))
+	binary.LittleEndian.PutUint16(data[0:2], p.Hint)
+	data[2] = p.FormatIndex
+	data[3] = p.FrameIndex
+	binary.LittleEndian.PutUint32(data[4:8], p.FrameInterval)
+	binary.LittleEndian.PutUint16(data[8:10], p.KeyFrameRate)
+	binary.LittleEndian.PutUint16(data[10:12], p.PFrameRate)
+	binary.LittleEndian.PutUint16(data[12:14], p.CompQuality)
+	binary.LittleEndian.PutUint16(data[14:16], p.CompWindowSize)
+	binary.LittleEndian.PutUint16(data[16:18], p.Delay)
+	binary.LittleEndian.PutUint32(data[18:22], p.MaxVideoFrameSize)
+	binary.LittleEndian.PutUint32(data[22:26], p.MaxPayloadTransferSize)
+	if len(data) < probeLengthUVC11 {
+		return data
+	}
+
+	binary.LittleEndian.PutUint32(data[26:30], p.ClockFrequency)
+	data[30] = p.FramingInfo
+	data[31] = p.PreferredVersion
+	data[32] = p.MinVersion
+	data[33] = p.MaxVersion
+	if len(data) < probeLengthUVC15 {
+		return data
+	}
+
+	data[34] = p.Usage
+	data[35] = p.BitDepthLuma
+	data[36] = p.Settings
+	data[37] = p.MaxNumberOfRefFrames
+	binary.LittleEndian.PutUint16(data[38:40], p.RateControlModes)
+	binary.LittleEndian.PutUint64(data[40:48], p.LayoutPerStream)
+	return data
+}
+
+// Unmarshal decodes a control returned by a GET_CUR, GET_MIN, GET_MAX or
+// GET_DEF of VS_PROBE_CONTROL or VS_COMMIT_CONTROL on a device of the given
+// UVC version. Some devices return the UVC 1.0 layout whatever their
+// version, so fields beyond the end of data are left zero; data shorter than
+// the UVC 1.0 layout is an error.
+func (p *ProbeControl) Unmarshal(data []byte, version uint16) error {
+	if len(data) < probeLengthUVC10 {
+		return fmt.Errorf("probe control too short: %d bytes", len(data))
+	}
+	if n := ProbeControlLength(version); len(data) > n {
+		data = data[:n]
+	}
+
+	*p = ProbeControl{
+		Hint:                   binary.LittleEndian.Uint16(data[0:2]),
+		FormatIndex:            data[2],
+		FrameIndex:             data[3],
+		FrameInterval:          binary.LittleEndian.Uint32(data[4:8]),
+		KeyFrameRate:           binary.LittleEndian.Uint16(data[8:10]),
+		PFrameRate:             binary.LittleEndian.Uint16(data[10:12]),
+		CompQuality:            binary.LittleEndian.Uint16(data[12:14]),
+		CompWindowSize:         binary.LittleEndian.Uint16(data[14:16]),
+		Delay:                  binary.LittleEndian.Uint16(data[16:18]),
+		MaxVideoFrameSize:      binary.LittleEndian.Uint32(data[18:22]),
+		MaxPayloadTransferSize: binary.LittleEndian.Uint32(data[22:26]),
+	}
+	if len(data) < probeLengthUVC11 {
+		return nil
+	}
+
+	p.ClockFrequency = binary.LittleEndian.Uint32(data[26:30])
+	p.FramingInfo = data[30]
+	p.PreferredVersion = data[31]
+	p.MinVersion = data[32]
+	p.MaxVersion = data[33]
+	if len(data) < probeLengthUVC15 {
+		return nil
+	}
+
+	p.Usage = data[34]
+	p.BitDepthLuma = data[35]
+	p.Settings = data[36]
+	p.MaxNumberOfRefFrames = data[37]
+	p.RateControlModes = binary.LittleEndian.Uint16(data[38:40])
+	p.LayoutPerStream = binary.LittleEndian.Uint64(data[40:48])
+	return nil
+}
@@ -0,0 +1,82 @@
+package uvc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestProbeControl(t *testing.T) {
+	// A UVC 1.5 probe for format 1, frame 2 at 30 fps
+	full, _ := hex.DecodeString(
+		"0100" + "01" + "02" + "15160500" + // bmHint, format, frame, dwFrameInterval
+			"0000" + "0000" + "0000" + "0000" + "2000" + // rates, quality, window, delay
+			"00600900" + "000c0000" + // dwMaxVideoFrameSize, dwMaxPayloadTransferSize
+			"80c3c901" + "03" + "01" + "01" + "01" + // clock, framing, versions
+			"01" + "08" + "02" + "03" + "0500" + "0807060504030201") // UVC 1.5 fields
+
+	tests := []struct {
+		name    string
+		version uint16
+		length  int
+	}{
+		{name: "uvc10", version: 0x0100, length: 26},
+		{name: "uvc11", version: 0x0110, length: 34},
+		{name: "uvc15", version: 0x0150, length: 48},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProbeControlLength(tt.version); got != tt.length {
+				t.Fatalf("ProbeControlLength(0x%04x) = %d, want %d", tt.version, got, tt.length)
+			}
+
+			var p ProbeControl
+			if err := p.Unmarshal(full, tt.version); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if p.Hint != HintFrameInterval || p.FormatIndex != 1 || p.FrameIndex != 2 {
+				t.Errorf("hint/format/frame = %#x/%d/%d", p.Hint, p.FormatIndex, p.FrameIndex)
+			}
+			if p.Interval() != 33333300*time.Nanosecond {
+				t.Errorf("Interval() = %v, want 33.3333ms", p.Interval())
+			}
+			if p.MaxVideoFrameSize != 614400 || p.MaxPayloadTransferSize != 3072 {
+				t.Errorf("sizes = %d/%d, want 614400/3072", p.MaxVideoFrameSize, p.MaxPayloadTransferSize)
+			}
+			wantClock, wantFraming := uint32(0), uint8(0)
+			if tt.length >= 34 {
+				wantClock, wantFraming = 30000000, 3
+			}
+			if p.ClockFrequency != wantClock || p.FramingInfo != wantFraming {
+				t.Errorf("clock/framing = %d/%d, want %d/%d", p.ClockFrequency, p.FramingInfo, wantClock, wantFraming)
+			}
+			if tt.length == 48 && (p.RateControlModes != 5 || p.LayoutPerStream != 0x0102030405060708) {
+				t.Errorf("UVC 1.5 fields = %#x/%#x", p.RateControlModes, p.LayoutPerStream)
+			}
+
+			if got := p.Marshal(tt.version); !bytes.Equal(got, full[:tt.length]) {
+				t.Errorf("Marshal() = %x, want %x", got, full[:tt.length])
+			}
+		})
+	}
+
+	t.Run("short_reply", func(t *testing.T) {
+		// A device answering with the UVC 1.0 layout despite a newer bcdUVC
+		var p ProbeControl
+		if err := p.Unmarshal(full[:26], 0x0150); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		if p.MaxPayloadTransferSize != 3072 || p.ClockFrequency != 0 {
+			t.Errorf("probe = %+v", p)
+		}
+	})
+
+	t.Run("too_short", func(t *testing.T) {
+		var p ProbeControl
+		if err := p.Unmarshal(full[:25], 0x0100); err == nil {
+			t.Error("Unmarshal() of 25 bytes should fail")
+		}
+	})
+}
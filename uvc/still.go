@@ -0,0 +1,299 @@
+package uvc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+// Video streaming interface control selectors for still image capture
+const (
+	VS_STILL_PROBE_CONTROL         = 0x03
+	VS_STILL_COMMIT_CONTROL        = 0x04
+	VS_STILL_IMAGE_TRIGGER_CONTROL = 0x05
+)
+
+// Class-specific request codes
+const (
+	SET_CUR = 0x01
+	GET_CUR = 0x81
+)
+
+// Values of VS_STILL_IMAGE_TRIGGER_CONTROL
+const (
+	TriggerNormal        = 0x00
+	TriggerTransmit      = 0x01 // Send the still image on the video pipe
+	TriggerTransmitBulk  = 0x02 // Send it on the dedicated still image pipe
+	TriggerAbortTransmit = 0x03
+)
+
+// stillProbeLength is the length of the still probe and commit control
+const stillProbeLength = 11
+
+// StillProbeControl is the still probe and commit control of a streaming
+// interface, which selects the format, size and compression of still images
+// captured with method 2 or 3. FrameIndex and CompressionIndex are 1-based
+// positions in the Sizes and Compression of the format's StillImageFrame.
+type StillProbeControl struct {
+	FormatIndex            uint8
+	FrameIndex             uint8
+	CompressionIndex       uint8
+	MaxVideoFrameSize      uint32
+	MaxPayloadTransferSize uint32
+}
+
+// Marshal encodes the control for a SET_CUR of VS_STILL_PROBE_CONTROL or
+// VS_STILL_COMMIT_CONTROL
+func (p *StillProbeControl) Marshal() []byte {
+	data := make([]byte, stillProbeLength)
+	data[0] = p.FormatIndex
+	data[1] = p.FrameIndex
+	data[2] = p.CompressionIndex
+	binary.LittleEndian.PutUint32(data[3:7], p.MaxVideoFrameSize)
+	binary.LittleEndian.PutUint32(data[7:11], p.MaxPayloadTransferSize)
+	return data
+}
+
+// Unmarshal decodes a control returned by a GET_CUR of
+// VS_STILL_PROBE_CONTROL or VS_STILL_COMMIT_CONTROL
+func (p *StillProbeControl) Unmarshal(data []byte) error {
+	if len(data) < stillProbeLength {
+		return fmt.Errorf("still probe control too short: %d bytes", len(data))
+	}
+	*p = StillProbeControl{
+		FormatIndex:            data[0],
+		FrameIndex:             data[1],
+		CompressionIndex:       data[2],
+		MaxVideoFrameSize:      binary.LittleEndian.Uint32(data[3:7]),
+		MaxPayloadTransferSize: binary.LittleEndian.Uint32(data[7:11]),
+	}
+	return nil
+}
+
+// Camera is the video function of an open device, as far as capturing still
+// images from its first streaming interface goes. It is safe to pass frames
+// to HandleFrame from the goroutine running the stream while CaptureStill
+// runs on another.
+type Camera struct {
+	handle      *usb.DeviceHandle
+	descriptors *Descriptors
+	stream      *StreamingInterface
+	config      *usb.ConfigDescriptor
+	timeout     time.Duration
+
+	still StillProbeControl // Set by SetStillFormat or NewCamera
+
+	mu      sync.Mutex
+	waiting chan *Frame // Set while a method 2 capture waits for its frame
+}
+
+// NewCamera parses the video descriptors of the active configuration of
+// handle. Still images are taken in the first format that describes still
+// sizes, at the first size and compression it lists; SetStillFormat picks
+// another one.
+func NewCamera(handle *usb.DeviceHandle) (*Camera, error) {
+	config, err := handle.GetActiveConfigDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	descriptors, err := ParseDescriptors(config)
+	if err != nil {
+		return nil, err
+	}
+	if len(descriptors.Streaming) == 0 {
+		return nil, fmt.Errorf("no video streaming interface: %w", usb.ErrNotFound)
+	}
+
+	c := &Camera{
+		handle:      handle,
+		descriptors: descriptors,
+		stream:      &descriptors.Streaming[0],
+		config:      config,
+		timeout:     5 * time.Second,
+	}
+	for _, f := range c.stream.Formats {
+		if f.Still != nil && len(f.Still.Sizes) > 0 {
+			c.still = StillProbeControl{FormatIndex: f.Index, FrameIndex: 1}
+			if len(f.Still.Compression) > 0 {
+				c.still.CompressionIndex = 1
+			}
+			break
+		}
+	}
+	return c, nil
+}
+
+// Descriptors returns the parsed video descriptors of the camera
+func (c *Camera) Descriptors() *Descriptors {
+	return c.descriptors
+}
+
+// SetTimeout sets how long CaptureStill waits for each control request and
+// for the image
+func (c *Camera) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// SetStillFormat selects the format, size and compression of the images
+// HandleFrame passes a frame of the running video stream to the camera,
+// typically from the onFrame of its FrameAssembler. It reports whether the
+// frame was the still image a method 2 CaptureStill is waiting for, which
+// then belongs to the camera.
+func (c *Camera) HandleFrame(f *Frame) bool {
+	if !f.Still {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.waiting == nil {
+		return false
+	}
+	c.waiting <- f
+	c.waiting = nil
+	return true
+}
+
+// CaptureStill takes one still image and returns its data, with the payload
+// headers removed. It negotiates the still format with
+// VS_STILL_PROBE_CONTROL and VS_STILL_COMMIT_CONTROL, triggers the capture
+// with VS_STILL_IMAGE_TRIGGER_CONTROL and waits for the image. With method 3
+// it is read from the dedicated bulk still endpoint. With method 2 it
+// arrives on the video endpoint among the video frames, so the stream must
+// already be running and hand its frames to HandleFrame, which picks out the
+// still. The streaming interface must be claimed. Cameras offering method 0
+// or 1 only, which have no still trigger, return usb.ErrNotSupported.
+func (c *Camera) CaptureStill() ([]byte, error) {
+	method := c.stream.StillCaptureMethod
+	if method != 2 && method != 3 {
+		return nil, fmt.Errorf("still capture method %d has no trigger: %w", method, usb.ErrNotSupported)
+	}
+
+	format := c.stream.Format(c.still.FormatIndex)
+	if format == nil || format.Still == nil {
+		return nil, fmt.Errorf("format %d has no still image frame: %w", c.still.FormatIndex, usb.ErrNotFound)
+	}
+	endpoint := format.Still.EndpointAddress
+	if method == 3 && !c.isBulkIn(endpoint) {
+		return nil, fmt.Errorf("still image endpoint 0x%02x is not a bulk IN endpoint: %w", endpoint, usb.ErrNotSupported)
+	}
+
+	// Probe, read back what the device settled on, and commit it
+	probe := c.still
+	if err := c.setCur(VS_STILL_PROBE_CONTROL, probe.Marshal()); err != nil {
+		return nil, fmt.Errorf("set still probe: %w", err)
+	}
+	data := make([]byte, stillProbeLength)
+	if err := c.getCur(VS_STILL_PROBE_CONTROL, data); err != nil {
+		return nil, fmt.Errorf("get still probe: %w", err)
+	}
+	if err := probe.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	if err := c.setCur(VS_STILL_COMMIT_CONTROL, probe.Marshal()); err != nil {
+		return nil, fmt.Errorf("commit still probe: %w", err)
+	}
+
+	var still *Frame
+	var err error
+	if method == 3 {
+		if err := c.setCur(VS_STILL_IMAGE_TRIGGER_CONTROL, []byte{TriggerTransmitBulk}); err != nil {
+			return nil, fmt.Errorf("trigger still image: %w", err)
+		}
+		still, err = c.readStill(endpoint, probe)
+	} else {
+		still, err = c.waitStill()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if still.Error {
+		return nil, fmt.Errorf("camera flagged an error in the still image: %w", usb.ErrIO)
+	}
+	return still.Data, nil
+}
+
+// waitStill triggers a method 2 capture and waits for HandleFrame to receive
+// the still image from the running stream
+func (c *Camera) waitStill() (*Frame, error) {
+	waiting := make(chan *Frame, 1)
+	c.mu.Lock()
+	c.waiting = waiting
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		if c.waiting == waiting {
+			c.waiting = nil
+		}
+		c.mu.Unlock()
+	}()
+
+	if err := c.setCur(VS_STILL_IMAGE_TRIGGER_CONTROL, []byte{TriggerTransmit}); err != nil {
+		return nil, fmt.Errorf("trigger still image: %w", err)
+	}
+	select {
+	case f := <-waiting:
+		return f, nil
+	case <-time.After(c.timeout):
+		return nil, fmt.Errorf("no still image after %v: %w", c.timeout, usb.ErrTimeout)
+	}
+}
+
+// readStill reads payloads from the dedicated still endpoint until a still
+// image is complete. Each transfer only gets what is left of the timeout, so
+// the whole image takes no longer than one.
+func (c *Camera) readStill(endpoint uint8, probe StillProbeControl) (*Frame, error) {
+	var still *Frame
+	assembler := NewFrameAssembler(func(f *Frame) {
+		if still == nil {
+			still = f
+		}
+	})
+
+	size := int(probe.MaxPayloadTransferSize)
+	if size == 0 {
+		size = 64 * 1024
+	}
+	buf := make([]byte, size)
+
+	deadline := time.Now().Add(c.timeout)
+	for still == nil {
+		// A zero timeout would wait forever, so stop short of it
+		remaining := time.Until(deadline)
+		if remaining < time.Millisecond {
+			return nil, fmt.Errorf("no still image after %v: %w", c.timeout, usb.ErrTimeout)
+		}
+		n, err := c.handle.BulkTransfer(endpoint, buf, remaining)
+		if err != nil {
+			return nil, fmt.Errorf("read still image: %w", err)
+		}
+		if err := assembler.AddPayload(buf[:n], time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return still, nil
+}
+
+// isBulkIn reports whether endpoint is a bulk IN endpoint of the camera's
+// streaming interface
+func (c *Camera) isBulkIn(endpoint uint8) bool {
+	iface := c.config.Interface(c.stream.Interface)
+	if iface == nil || endpoint&uint8(usb.EndpointDirectionIn) == 0 {
+		return false
+	}
+	ep, _, ok := iface.EndpointInAnyAlt(endpoint)
+	return ok && ep.TransferType() == usb.TransferTypeBulk
+}
+
+// setCur and getCur address a control of the streaming interface
+func (c *Camera) setCur(selector uint8, data []byte) error {
+	_, err := c.handle.ControlTransfer(0x21, SET_CUR, uint16(selector)<<8, uint16(c.stream.Interface), data, c.timeout)
+	return err
+}
+
+func (c *Camera) getCur(selector uint8, data []byte) error {
+	_, err := c.handle.ControlTransfer(0xa1, GET_CUR, uint16(selector)<<8, uint16(c.stream.Interface), data, c.timeout)
+	return err
+}
@@ -0,0 +1,208 @@
+package uvc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	usb "github.com/kevmo314/go-usb"
+)
+
+func TestStillProbeControl(t *testing.T) {
+	p := StillProbeControl{FormatIndex: 2, FrameIndex: 1, CompressionIndex: 1, MaxVideoFrameSize: 1843200, MaxPayloadTransferSize: 16384}
+	data := p.Marshal()
+	want := []byte{0x02, 0x01, 0x01, 0x00, 0x20, 0x1c, 0x00, 0x00, 0x40, 0x00, 0x00}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("Marshal() = %x, want %x", data, want)
+	}
+
+	var got StillProbeControl
+	if err := got.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got != p {
+		t.Errorf("Unmarshal() = %+v, want %+v", got, p)
+	}
+	if err := got.Unmarshal(data[:10]); err == nil {
+		t.Error("Unmarshal() of 10 bytes succeeded, want an error")
+	}
+}
+
+func TestParseStillImageFrame(t *testing.T) {
+	d, err := ParseDescriptors(videoConfig(t, map[uint8]string{
+		0: testVideoControl,
+		1: "0e240101000083000302000000" + "00" + // Input header, endpoint 0x83, still method 2
+			"0b240601010101000000" + "00" + // MJPEG format 1
+			"26240701000005d002" + "00000000" + "00000000" + "00200e00" + "15160500" + "00" + "15160500" + "80841e00" + "15160500" + // 1280x720
+			"0f24038402" + "0005d002" + "0007a005" + "0105", // Still endpoint 0x84, 1280x720 and 1792x1440, one compression
+	}))
+	if err != nil {
+		t.Fatalf("ParseDescriptors() error = %v", err)
+	}
+
+	vs := d.StreamingInterface(1)
+	if vs.StillCaptureMethod != 2 {
+		t.Errorf("StillCaptureMethod = %d, want 2", vs.StillCaptureMethod)
+	}
+	still := vs.Format(1).Still
+	if still == nil {
+		t.Fatal("format 1 has no still image frame")
+	}
+	if still.EndpointAddress != 0x84 || len(still.Sizes) != 2 || len(still.Compression) != 1 || still.Compression[0] != 5 {
+		t.Fatalf("still image frame = %+v", still)
+	}
+	if s := still.Sizes[1]; s.Width != 1792 || s.Height != 1440 {
+		t.Errorf("second still size = %dx%d, want 1792x1440", s.Width, s.Height)
+	}
+
+	if _, err := parseStillImageFrame([]byte{0x0a, 0x24, 0x03, 0x00, 0x02, 0x00, 0x05, 0xd0, 0x02, 0x00}); err == nil {
+		t.Error("parseStillImageFrame() of a truncated descriptor succeeded, want an error")
+	}
+}
+
+// stillCamera returns a Camera on a mock device whose streaming interface 1
+// captures stills with method, on bulk video endpoint 0x81 and bulk still
+// endpoint 0x84. onTrigger is called with the value of each still trigger
+// and still answers reads of 0x84.
+func stillCamera(t *testing.T, method uint8, onTrigger func(trigger uint8), still func([]byte) (int, error)) *Camera {
+	t.Helper()
+	streaming := fmt.Sprintf("0e24010100008100030%d000000", method) + "00" + // Input header, endpoint 0x81
+		"0b240601010101000000" + "00" + // MJPEG format 1
+		"26240701000005d002" + "00000000" + "00000000" + "00200e00" + "15160500" + "00" + "15160500" + "80841e00" + "15160500" + // 1280x720
+		"0b24038401" + "0005d002" + "0105" // Still endpoint 0x84, 1280x720, one compression
+	config, err := hex.DecodeString("0902000002010080fa" +
+		"0904000000" + "0e010000" + testVideoControl +
+		"0904010002" + "0e020000" + streaming +
+		"07058102000200" + "07058402000200")
+	if err != nil {
+		t.Fatalf("invalid test data: %v", err)
+	}
+	binary.LittleEndian.PutUint16(config[2:4], uint16(len(config)))
+
+	dev := &usb.MockDevice{
+		Bus:        1,
+		Address:    5,
+		Descriptor: usb.DeviceDescriptor{VendorID: 0x046d, NumConfigurations: 1},
+		Configs:    [][]byte{config},
+		Control: func(requestType, request uint8, value, index uint16, data []byte) (int, error) {
+			switch {
+			case requestType == 0x21 && request == SET_CUR && value>>8 == VS_STILL_IMAGE_TRIGGER_CONTROL:
+				onTrigger(data[0])
+				return len(data), nil
+			case requestType == 0x21 && request == SET_CUR:
+				return len(data), nil
+			case requestType == 0xa1 && request == GET_CUR && value>>8 == VS_STILL_PROBE_CONTROL:
+				p := StillProbeControl{FormatIndex: 1, FrameIndex: 1, CompressionIndex: 1, MaxVideoFrameSize: 1843200, MaxPayloadTransferSize: 512}
+				return copy(data, p.Marshal()), nil
+			}
+			return 0, usb.ErrPipeStalled
+		},
+		Endpoints: map[uint8]func([]byte) (int, error){0x84: still},
+	}
+	usb.SetBackend(usb.NewMockBackend(dev))
+	t.Cleanup(func() { usb.SetBackend(nil) })
+
+	devices, err := usb.DeviceList()
+	if err != nil || len(devices) != 1 {
+		t.Fatalf("DeviceList() = %v, %v, want the mock device", devices, err)
+	}
+	h, err := devices[0].Open()
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+
+	c, err := NewCamera(h)
+	if err != nil {
+		t.Fatalf("NewCamera() error = %v", err)
+	}
+	c.SetTimeout(100 * time.Millisecond)
+	return c
+}
+
+func TestCaptureStillDedicatedEndpoint(t *testing.T) {
+	payloads := []string{"02a0" + "ffd8", "02a2" + "ffd9"} // Still image, EOF on the second
+	var triggers []uint8
+	c := stillCamera(t, 3, func(trigger uint8) { triggers = append(triggers, trigger) }, func(data []byte) (int, error) {
+		if len(payloads) == 0 {
+			return 0, usb.ErrTimeout
+		}
+		p, _ := hex.DecodeString(payloads[0])
+		payloads = payloads[1:]
+		return copy(data, p), nil
+	})
+
+	image, err := c.CaptureStill()
+	if err != nil {
+		t.Fatalf("CaptureStill() error = %v", err)
+	}
+	if hex.EncodeToString(image) != "ffd8ffd9" {
+		t.Errorf("CaptureStill() = %x, want ffd8ffd9", image)
+	}
+	if len(triggers) != 1 || triggers[0] != TriggerTransmitBulk {
+		t.Errorf("triggers = %v, want [%d]", triggers, TriggerTransmitBulk)
+	}
+
+	// An image that never ends runs out of the one timeout
+	c = stillCamera(t, 3, func(uint8) {}, func(data []byte) (int, error) {
+		time.Sleep(10 * time.Millisecond)
+		return copy(data, []byte{0x02, 0xa0, 0x00}), nil
+	})
+	start := time.Now()
+	if _, err := c.CaptureStill(); !errors.Is(err, usb.ErrTimeout) {
+		t.Errorf("CaptureStill() of an endless image error = %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("CaptureStill() took %v with a 100ms timeout", elapsed)
+	}
+}
+
+func TestCaptureStillVideoStream(t *testing.T) {
+	var c *Camera
+	handled := make(chan []bool, 1)
+	c = stillCamera(t, 2, func(trigger uint8) {
+		if trigger != TriggerTransmit {
+			t.Errorf("trigger = %d, want %d", trigger, TriggerTransmit)
+		}
+		// The running stream delivers a video frame, then the still
+		go func() {
+			handled <- []bool{
+				c.HandleFrame(&Frame{Data: []byte{0x01}}),
+				c.HandleFrame(&Frame{Data: []byte{0xff, 0xd8}, Still: true}),
+				c.HandleFrame(&Frame{Data: []byte{0xff, 0xd8}, Still: true}),
+			}
+		}()
+	}, func([]byte) (int, error) {
+		t.Error("method 2 read the still endpoint")
+		return 0, usb.ErrIO
+	})
+
+	if c.HandleFrame(&Frame{Still: true}) {
+		t.Error("HandleFrame() with no capture waiting = true, want false")
+	}
+	image, err := c.CaptureStill()
+	if err != nil {
+		t.Fatalf("CaptureStill() error = %v", err)
+	}
+	if !bytes.Equal(image, []byte{0xff, 0xd8}) {
+		t.Errorf("CaptureStill() = %x, want ffd8", image)
+	}
+	if got := <-handled; got[0] || !got[1] || got[2] {
+		t.Errorf("HandleFrame() = %v, want only the first still taken", got)
+	}
+
+	// Without a running stream nothing arrives
+	c = stillCamera(t, 2, func(uint8) {}, nil)
+	if _, err := c.CaptureStill(); !errors.Is(err, usb.ErrTimeout) {
+		t.Errorf("CaptureStill() without a stream error = %v, want ErrTimeout", err)
+	}
+
+	c = stillCamera(t, 1, func(uint8) {}, nil)
+	if _, err := c.CaptureStill(); !errors.Is(err, usb.ErrNotSupported) {
+		t.Errorf("CaptureStill() with method 1 error = %v, want ErrNotSupported", err)
+	}
+}